@@ -0,0 +1,285 @@
+package main
+
+import (
+	"RestoreSafe/internal/backup"
+	"RestoreSafe/internal/consolidate"
+	"RestoreSafe/internal/diff"
+	"RestoreSafe/internal/export"
+	"RestoreSafe/internal/importer"
+	"RestoreSafe/internal/list"
+	"RestoreSafe/internal/replicate"
+	"RestoreSafe/internal/restore"
+	"RestoreSafe/internal/util"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// commandLine holds the parsed program arguments.
+//
+// Usage: RestoreSafe.exe [-config=<path>] [<command> -flag=value ...]
+// Without a command, the interactive menu is shown.
+type commandLine struct {
+	ConfigPath  string
+	Command     string
+	Backup      backup.Options
+	Restore     restore.Options
+	List        list.Options
+	Diff        diff.Options
+	Consolidate consolidate.Options
+	Export      export.Options
+	Import      importer.Options
+	Sync        replicate.Options
+}
+
+const (
+	commandBackup      = "backup"
+	commandRestore     = "restore"
+	commandList        = "list"
+	commandDiff        = "diff"
+	commandConsolidate = "consolidate"
+	commandExport      = "export"
+	commandImport      = "import"
+	commandSync        = "sync"
+	commandCleanup     = "cleanup-incomplete"
+)
+
+// commandFlags lists the options accepted by each command.
+var commandFlags = map[string][]string{
+	commandBackup:      {"-stdin", "-name=", "-password-file=", "-resume="},
+	commandRestore:     {"-backup=", "-destination=", "-include=", "-flatten", "-conflict=", "-pipe", "-stdout"},
+	commandList:        {"-backup=", "-include=", "-format=", "-output="},
+	commandDiff:        {"-backup=", "-against=", "-hash", "-format=", "-output="},
+	commandConsolidate: {"-backup="},
+	commandExport:      {"-backup=", "-include=", "-output=", "-volume-size-mb="},
+	commandImport:      {"-archive=", "-name=", "-date="},
+	commandSync:        {"-to=", "-backup=", "-mirror"},
+	commandCleanup:     {},
+}
+
+// parseCommandLine parses args (without the program name). Flags use the
+// equals form only; -include may be repeated.
+func parseCommandLine(args []string, defaultConfigPath string) (commandLine, error) {
+	cl := commandLine{ConfigPath: defaultConfigPath}
+	seen := make(map[string]bool)
+
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			if cl.Command != "" {
+				return cl, fmt.Errorf("Unexpected argument %q. Remedy: Pass a single command followed by its -flag=value options.", arg)
+			}
+			command := strings.ToLower(arg)
+			if _, ok := commandFlags[command]; !ok {
+				return cl, fmt.Errorf("Unknown command %q. Remedy: Use one of: %s, %s, %s, %s, %s, %s, %s, %s, %s.", arg, commandBackup, commandRestore, commandList, commandDiff, commandConsolidate, commandExport, commandImport, commandSync, commandCleanup)
+			}
+			cl.Command = command
+			continue
+		}
+
+		flag, value, hasValue := strings.Cut(arg, "=")
+		name := strings.TrimLeft(flag, "-")
+		value = strings.TrimSpace(value)
+
+		if name == "config" {
+			if !hasValue {
+				return cl, fmt.Errorf("use -config=<absolute-path-to-config.yaml> (equals form only).")
+			}
+			if value == "" {
+				return cl, fmt.Errorf("%s requires a non-empty absolute path. Remedy: Pass %s=<absolute-path-to-config.yaml>.", flag, flag)
+			}
+			if !filepath.IsAbs(value) {
+				return cl, fmt.Errorf("%s requires an absolute path. Remedy: Pass %s=<absolute-path-to-config.yaml>.", flag, flag)
+			}
+			cl.ConfigPath = filepath.Clean(value)
+			continue
+		}
+
+		if cl.Command == "" {
+			return cl, fmt.Errorf("Unknown option -%s. Remedy: Pass command options after the command name.", name)
+		}
+		if len(commandFlags[cl.Command]) == 0 {
+			return cl, fmt.Errorf("Unknown option -%s for command %s. Remedy: Pass %s without options.", name, cl.Command, cl.Command)
+		}
+		if !acceptsFlag(cl.Command, name) {
+			return cl, fmt.Errorf("Unknown option -%s for command %s. Remedy: Use %s.", name, cl.Command, strings.Join(commandFlags[cl.Command], ", "))
+		}
+
+		if name == "flatten" || name == "hash" || name == "mirror" || name == "pipe" || name == "stdin" || name == "stdout" {
+			enabled, err := parseSwitch(name, value)
+			if err != nil {
+				return cl, err
+			}
+			switch name {
+			case "flatten":
+				cl.Restore.Flatten = enabled
+			case "mirror":
+				cl.Sync.Mirror = enabled
+			case "pipe":
+				cl.Restore.Pipe = enabled
+			case "stdin":
+				cl.Backup.Stdin = enabled
+			case "stdout":
+				cl.Restore.Stdout = enabled
+			default:
+				cl.Diff.Hash = enabled
+			}
+			continue
+		}
+
+		if !hasValue || value == "" {
+			return cl, fmt.Errorf("-%s requires a value. Remedy: Pass -%s=<value> (equals form only).", name, name)
+		}
+		seen[name] = true
+		switch cl.Command + " " + name {
+		case "backup name":
+			cl.Backup.Name = value
+		case "backup password-file":
+			cl.Backup.PasswordFile = value
+		case "backup resume":
+			cl.Backup.Resume = value
+		case "restore backup":
+			cl.Restore.Backup = value
+		case "restore destination":
+			cl.Restore.Destination = value
+		case "restore include":
+			cl.Restore.Include = append(cl.Restore.Include, value)
+		case "restore conflict":
+			policy, err := util.ParseConflictPolicy(value)
+			if err != nil {
+				return cl, err
+			}
+			cl.Restore.Conflict = policy
+		case "list backup":
+			cl.List.Backup = value
+		case "list include":
+			cl.List.Include = append(cl.List.Include, value)
+		case "list format":
+			cl.List.Format = value
+		case "list output":
+			cl.List.Output = value
+		case "diff backup":
+			cl.Diff.Backup = value
+		case "diff against":
+			cl.Diff.Against = value
+		case "diff format":
+			cl.Diff.Format = value
+		case "diff output":
+			cl.Diff.Output = value
+		case "consolidate backup":
+			cl.Consolidate.Backup = value
+		case "export backup":
+			cl.Export.Backup = value
+		case "export include":
+			cl.Export.Include = append(cl.Export.Include, value)
+		case "export output":
+			cl.Export.Output = value
+		case "export volume-size-mb":
+			size, err := strconv.Atoi(value)
+			if err != nil || size <= 0 {
+				return cl, fmt.Errorf("Invalid value %q for -volume-size-mb. Remedy: Pass a whole number of MB greater than 0.", value)
+			}
+			cl.Export.VolumeSizeMB = size
+		case "import archive":
+			cl.Import.Archive = value
+		case "import name":
+			cl.Import.Name = value
+		case "import date":
+			cl.Import.Date = value
+		case "sync to":
+			cl.Sync.Target = value
+		case "sync backup":
+			cl.Sync.Backup = value
+		}
+	}
+
+	switch cl.Command {
+	case commandBackup:
+		if !cl.Backup.Stdin {
+			if seen["name"] || seen["password-file"] {
+				return cl, fmt.Errorf("-name and -password-file apply to backups of standard input only. Remedy: Add -stdin, or omit them to back up the sources in config.yaml.")
+			}
+			break
+		}
+		if !seen["name"] {
+			return cl, fmt.Errorf("backup -stdin requires -name=<name>. Remedy: Pass the name of the backup set, e.g. -name=database.sql.")
+		}
+		if seen["resume"] {
+			return cl, fmt.Errorf("-resume applies to backups of the sources in config.yaml only. Remedy: Omit -resume; a backup of standard input cannot be resumed.")
+		}
+	case commandRestore:
+		if !seen["backup"] {
+			return cl, fmt.Errorf("restore requires -backup=<selection>. Remedy: Pass a dot (.), a backup ID or a full backup name.")
+		}
+		if cl.Restore.Stdout {
+			if seen["destination"] || seen["conflict"] || cl.Restore.Flatten || cl.Restore.Pipe {
+				return cl, fmt.Errorf("restore -stdout writes to standard output and cannot be combined with -destination, -conflict, -flatten or -pipe. Remedy: Remove these options or omit -stdout.")
+			}
+			break
+		}
+		if !seen["destination"] {
+			return cl, fmt.Errorf("restore requires -destination=<path>. Remedy: Pass a dot (.) or a destination path.")
+		}
+	case commandList:
+		if !seen["backup"] {
+			return cl, fmt.Errorf("list requires -backup=<selection>. Remedy: Pass a dot (.), a backup ID or a full backup name.")
+		}
+		if _, err := list.ParseFormat(cl.List.Format); err != nil {
+			return cl, err
+		}
+	case commandDiff:
+		if !seen["backup"] {
+			return cl, fmt.Errorf("diff requires -backup=<selection>. Remedy: Pass a dot (.), a backup ID or a full backup name.")
+		}
+		if _, err := diff.ParseFormat(cl.Diff.Format); err != nil {
+			return cl, err
+		}
+	case commandConsolidate:
+		if !seen["backup"] {
+			return cl, fmt.Errorf("consolidate requires -backup=<selection>. Remedy: Pass a dot (.), a backup ID or a full backup name.")
+		}
+	case commandExport:
+		if !seen["backup"] {
+			return cl, fmt.Errorf("export requires -backup=<selection>. Remedy: Pass a dot (.), a backup ID or a full backup name.")
+		}
+		if !seen["output"] {
+			return cl, fmt.Errorf("export requires -output=<file>. Remedy: Pass the path of a new .tar, .tar.gz, .tgz or .zip file.")
+		}
+		if _, err := export.FormatFromPath(cl.Export.Output); err != nil {
+			return cl, err
+		}
+	case commandImport:
+		if !seen["archive"] {
+			return cl, fmt.Errorf("import requires -archive=<file>. Remedy: Pass the path of a .tar, .tar.gz, .tgz or .zip file.")
+		}
+		if _, err := importer.FormatFromPath(cl.Import.Archive); err != nil {
+			return cl, err
+		}
+	case commandSync:
+		if !seen["to"] {
+			return cl, fmt.Errorf("sync requires -to=<directory>. Remedy: Pass the directory or storage URL to copy the backups to.")
+		}
+	}
+
+	return cl, nil
+}
+
+func acceptsFlag(command, name string) bool {
+	for _, flag := range commandFlags[command] {
+		if strings.TrimSuffix(strings.TrimPrefix(flag, "-"), "=") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSwitch interprets the value of a boolean flag such as -flatten or -flatten=false.
+func parseSwitch(name, value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "", "true", "yes":
+		return true, nil
+	case "false", "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("Invalid value %q for -%s. Remedy: Pass -%s or -%s=false.", value, name, name, name)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"RestoreSafe/internal/util"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCommandLineWithoutArgumentsUsesMenu(t *testing.T) {
+	defaultConfig := filepath.Join(t.TempDir(), "config.yaml")
+
+	cl, err := parseCommandLine(nil, defaultConfig)
+	if err != nil {
+		t.Fatalf("parseCommandLine returned error: %v", err)
+	}
+	if cl.Command != "" || cl.ConfigPath != defaultConfig {
+		t.Fatalf("unexpected command line: %+v", cl)
+	}
+}
+
+func TestParseCommandLineRestoreOptions(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "custom.yaml")
+
+	cl, err := parseCommandLine([]string{
+		"-config=" + configPath,
+		"restore",
+		"-backup=ABC123",
+		"-destination=.",
+		"-include=Reports/2025",
+		"-include=*.xlsx",
+		"-flatten",
+		"-pipe",
+	}, "default.yaml")
+	if err != nil {
+		t.Fatalf("parseCommandLine returned error: %v", err)
+	}
+	if cl.ConfigPath != configPath || cl.Command != commandRestore {
+		t.Fatalf("unexpected command line: %+v", cl)
+	}
+	if cl.Restore.Backup != "ABC123" || cl.Restore.Destination != "." || !cl.Restore.Flatten || !cl.Restore.Pipe {
+		t.Fatalf("unexpected restore options: %+v", cl.Restore)
+	}
+	if len(cl.Restore.Include) != 2 || cl.Restore.Include[1] != "*.xlsx" {
+		t.Fatalf("expected repeated -include values, got %q", cl.Restore.Include)
+	}
+}
+
+func TestParseCommandLineRejectsInvalidArguments(t *testing.T) {
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"-config"}, want: "equals form only"},
+		{args: []string{"-config=relative.yaml"}, want: "absolute path"},
+		{args: []string{"unknown"}, want: "Unknown command"},
+		{args: []string{"-backup=ABC123"}, want: "Unknown option -backup"},
+		{args: []string{"restore", "-destination=."}, want: "requires -backup"},
+		{args: []string{"restore", "-backup=.", "-destination"}, want: "-destination requires a value"},
+		{args: []string{"restore", "-backup=.", "-destination=.", "-verbose"}, want: "Unknown option -verbose"},
+	}
+	for _, tc := range cases {
+		_, err := parseCommandLine(tc.args, "config.yaml")
+		if err == nil {
+			t.Fatalf("expected error for %q, got nil", tc.args)
+		}
+		if !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("expected error containing %q for %q, got: %v", tc.want, tc.args, err)
+		}
+	}
+}
+
+func TestParseCommandLineListOptions(t *testing.T) {
+	cl, err := parseCommandLine([]string{"list", "-backup=.", "-include=**/*.xlsx", "-format=csv", "-output=C:/Temp/list.csv"}, "config.yaml")
+	if err != nil {
+		t.Fatalf("parseCommandLine returned error: %v", err)
+	}
+	if cl.Command != commandList || cl.List.Backup != "." || cl.List.Format != "csv" || cl.List.Output != "C:/Temp/list.csv" {
+		t.Fatalf("unexpected list options: %+v", cl.List)
+	}
+	if len(cl.List.Include) != 1 {
+		t.Fatalf("expected one -include value, got %q", cl.List.Include)
+	}
+
+	if _, err := parseCommandLine([]string{"list", "-backup=.", "-format=xml"}, "config.yaml"); err == nil {
+		t.Fatal("expected error for unknown list format, got nil")
+	}
+	if _, err := parseCommandLine([]string{"list", "-backup=.", "-flatten"}, "config.yaml"); err == nil {
+		t.Fatal("expected error for restore-only option on list, got nil")
+	}
+}
+
+func TestParseCommandLineRestoreConflictPolicy(t *testing.T) {
+	cl, err := parseCommandLine([]string{"restore", "-backup=.", "-destination=.", "-conflict=Overwrite-Newer"}, "config.yaml")
+	if err != nil {
+		t.Fatalf("parseCommandLine returned error: %v", err)
+	}
+	if cl.Restore.Conflict != util.ConflictOverwriteNewer {
+		t.Fatalf("expected overwrite-newer policy, got %q", cl.Restore.Conflict)
+	}
+
+	if _, err := parseCommandLine([]string{"restore", "-backup=.", "-destination=.", "-conflict=merge"}, "config.yaml"); err == nil {
+		t.Fatal("expected error for unknown conflict policy, got nil")
+	}
+}
+
+func TestParseCommandLineDiffOptions(t *testing.T) {
+	cl, err := parseCommandLine([]string{"diff", "-backup=ABC123", "-hash", "-format=json", "-output=C:/Temp/diff.json"}, "config.yaml")
+	if err != nil {
+		t.Fatalf("parseCommandLine returned error: %v", err)
+	}
+	if cl.Command != commandDiff || cl.Diff.Backup != "ABC123" || !cl.Diff.Hash || cl.Diff.Format != "json" || cl.Diff.Output != "C:/Temp/diff.json" {
+		t.Fatalf("unexpected diff options: %+v", cl.Diff)
+	}
+
+	if _, err := parseCommandLine([]string{"diff", "-backup=.", "-format=csv"}, "config.yaml"); err == nil {
+		t.Fatal("expected error for unknown diff format, got nil")
+	}
+	if _, err := parseCommandLine([]string{"diff", "-backup=.", "-hash=maybe"}, "config.yaml"); err == nil {
+		t.Fatal("expected error for invalid -hash value, got nil")
+	}
+	if _, err := parseCommandLine([]string{"diff"}, "config.yaml"); err == nil {
+		t.Fatal("expected error for missing -backup, got nil")
+	}
+
+	cl, err = parseCommandLine([]string{"diff", "-backup=ABC123", "-against=XYZ789"}, "config.yaml")
+	if err != nil {
+		t.Fatalf("parseCommandLine returned error: %v", err)
+	}
+	if cl.Diff.Against != "XYZ789" || cl.Diff.Hash {
+		t.Fatalf("unexpected diff options: %+v", cl.Diff)
+	}
+}
+
+func TestParseCommandLineConsolidateOptions(t *testing.T) {
+	cl, err := parseCommandLine([]string{"consolidate", "-backup=ABC123"}, "config.yaml")
+	if err != nil {
+		t.Fatalf("parseCommandLine returned error: %v", err)
+	}
+	if cl.Command != commandConsolidate || cl.Consolidate.Backup != "ABC123" {
+		t.Fatalf("unexpected consolidate options: %+v", cl.Consolidate)
+	}
+
+	if _, err := parseCommandLine([]string{"consolidate"}, "config.yaml"); err == nil {
+		t.Fatal("expected error for missing -backup, got nil")
+	}
+	if _, err := parseCommandLine([]string{"consolidate", "-backup=.", "-hash"}, "config.yaml"); err == nil {
+		t.Fatal("expected error for option of another command, got nil")
+	}
+}
+
+func TestParseCommandLineBackupStdinOptions(t *testing.T) {
+	cl, err := parseCommandLine([]string{"backup", "-stdin", "-name=database.sql", "-password-file=C:/Keys/backup.txt"}, "config.yaml")
+	if err != nil {
+		t.Fatalf("parseCommandLine returned error: %v", err)
+	}
+	if cl.Command != commandBackup || !cl.Backup.Stdin || cl.Backup.Name != "database.sql" || cl.Backup.PasswordFile != "C:/Keys/backup.txt" {
+		t.Fatalf("unexpected backup options: %+v", cl.Backup)
+	}
+
+	cl, err = parseCommandLine([]string{"backup"}, "config.yaml")
+	if err != nil || cl.Backup.Stdin {
+		t.Fatalf("expected a plain backup of the configured sources, got %+v, %v", cl.Backup, err)
+	}
+	if _, err := parseCommandLine([]string{"backup", "-stdin"}, "config.yaml"); err == nil || !strings.Contains(err.Error(), "requires -name") {
+		t.Fatalf("expected error for missing -name, got %v", err)
+	}
+	if _, err := parseCommandLine([]string{"backup", "-name=database.sql"}, "config.yaml"); err == nil {
+		t.Fatal("expected error for -name without -stdin, got nil")
+	}
+}
+
+func TestParseCommandLineBackupResume(t *testing.T) {
+	cl, err := parseCommandLine([]string{"backup", "-resume=ABC123"}, "config.yaml")
+	if err != nil {
+		t.Fatalf("parseCommandLine returned error: %v", err)
+	}
+	if cl.Command != commandBackup || cl.Backup.Resume != "ABC123" {
+		t.Fatalf("unexpected backup options: %+v", cl.Backup)
+	}
+	if _, err := parseCommandLine([]string{"backup", "-stdin", "-name=database.sql", "-resume=ABC123"}, "config.yaml"); err == nil {
+		t.Fatal("expected error for -resume with -stdin, got nil")
+	}
+}
+
+func TestParseCommandLineRestoreStdout(t *testing.T) {
+	cl, err := parseCommandLine([]string{"restore", "-stdout", "-backup=ABC123", "-include=data/report.xlsx"}, "config.yaml")
+	if err != nil {
+		t.Fatalf("parseCommandLine returned error: %v", err)
+	}
+	if !cl.Restore.Stdout || cl.Restore.Backup != "ABC123" || cl.Restore.Destination != "" {
+		t.Fatalf("unexpected restore options: %+v", cl.Restore)
+	}
+
+	for _, extra := range []string{"-destination=.", "-conflict=skip", "-flatten", "-pipe"} {
+		if _, err := parseCommandLine([]string{"restore", "-stdout", "-backup=ABC123", extra}, "config.yaml"); err == nil {
+			t.Fatalf("expected error for -stdout with %s, got nil", extra)
+		}
+	}
+}
+
+func TestParseCommandLineExportOptions(t *testing.T) {
+	cl, err := parseCommandLine([]string{"export", "-backup=ABC123", "-include=Reports/2025", "-output=C:/Handover/docs.zip", "-volume-size-mb=650"}, "config.yaml")
+	if err != nil {
+		t.Fatalf("parseCommandLine returned error: %v", err)
+	}
+	if cl.Command != commandExport || cl.Export.Backup != "ABC123" || cl.Export.Output != "C:/Handover/docs.zip" || cl.Export.VolumeSizeMB != 650 || len(cl.Export.Include) != 1 {
+		t.Fatalf("unexpected export options: %+v", cl.Export)
+	}
+
+	for _, args := range [][]string{
+		{"export", "-output=C:/Handover/docs.zip"},
+		{"export", "-backup=."},
+		{"export", "-backup=.", "-output=C:/Handover/docs.rar"},
+		{"export", "-backup=.", "-output=C:/Handover/docs.zip", "-volume-size-mb=0"},
+	} {
+		if _, err := parseCommandLine(args, "config.yaml"); err == nil {
+			t.Fatalf("expected error for %q, got nil", args)
+		}
+	}
+}
+
+func TestParseCommandLineImportOptions(t *testing.T) {
+	cl, err := parseCommandLine([]string{"import", "-archive=D:/Legacy/invoices-2019.tar.gz", "-name=Invoices", "-date=2019-12-31"}, "config.yaml")
+	if err != nil {
+		t.Fatalf("parseCommandLine returned error: %v", err)
+	}
+	if cl.Command != commandImport || cl.Import.Archive != "D:/Legacy/invoices-2019.tar.gz" || cl.Import.Name != "Invoices" || cl.Import.Date != "2019-12-31" {
+		t.Fatalf("unexpected import options: %+v", cl.Import)
+	}
+
+	if _, err := parseCommandLine([]string{"import", "-name=Invoices"}, "config.yaml"); err == nil {
+		t.Fatal("expected error for missing -archive, got nil")
+	}
+	if _, err := parseCommandLine([]string{"import", "-archive=D:/Legacy/invoices.rar"}, "config.yaml"); err == nil {
+		t.Fatal("expected error for unsupported archive, got nil")
+	}
+}
+
+func TestParseCommandLineSyncOptions(t *testing.T) {
+	cl, err := parseCommandLine([]string{"sync", "-to=s3://offsite/backups", "-mirror"}, "config.yaml")
+	if err != nil {
+		t.Fatalf("parseCommandLine returned error: %v", err)
+	}
+	if cl.Command != commandSync || cl.Sync.Target != "s3://offsite/backups" || cl.Sync.Backup != "" || !cl.Sync.Mirror {
+		t.Fatalf("unexpected sync options: %+v", cl.Sync)
+	}
+
+	cl, err = parseCommandLine([]string{"sync", "-to=E:/Backups", "-backup=ABC123"}, "config.yaml")
+	if err != nil || cl.Sync.Backup != "ABC123" || cl.Sync.Mirror {
+		t.Fatalf("unexpected sync options: %+v, %v", cl.Sync, err)
+	}
+	if _, err := parseCommandLine([]string{"sync", "-backup=."}, "config.yaml"); err == nil {
+		t.Fatal("expected error for missing -to, got nil")
+	}
+}
+
+func TestParseCommandLineCleanupIncomplete(t *testing.T) {
+	cl, err := parseCommandLine([]string{"cleanup-incomplete"}, "config.yaml")
+	if err != nil || cl.Command != commandCleanup {
+		t.Fatalf("unexpected command line: %+v, %v", cl, err)
+	}
+	_, err = parseCommandLine([]string{"cleanup-incomplete", "-backup=."}, "config.yaml")
+	if err == nil || !strings.Contains(err.Error(), "without options") {
+		t.Fatalf("expected error for an option of cleanup-incomplete, got %v", err)
+	}
+}
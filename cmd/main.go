@@ -2,9 +2,18 @@ package main
 
 import (
 	"RestoreSafe/internal/backup"
+	"RestoreSafe/internal/cleanup"
+	"RestoreSafe/internal/consolidate"
+	"RestoreSafe/internal/diff"
+	"RestoreSafe/internal/export"
+	"RestoreSafe/internal/importer"
+	"RestoreSafe/internal/list"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/replicate"
 	"RestoreSafe/internal/restore"
 	"RestoreSafe/internal/security"
 	"RestoreSafe/internal/startup"
+	"RestoreSafe/internal/storage"
 	"RestoreSafe/internal/util"
 	"RestoreSafe/internal/verify"
 	"bufio"
@@ -31,43 +40,49 @@ func main() {
 	}
 	security.SetYkmanExeDir(exeDir)
 
-	// CLI flag for custom config path
-	configPath := filepath.Join(exeDir, "config.yaml")
-	args := os.Args[1:]
-	for i := 0; i < len(args); i++ {
-		arg := args[i]
-		switch {
-		case arg == "-config" || arg == "--config":
-			fmt.Fprintln(os.Stderr, "Error: use -config=<absolute-path-to-config.yaml> (equals form only).")
-			os.Exit(1)
-		case strings.HasPrefix(arg, "-config=") || strings.HasPrefix(arg, "--config="):
-			idx := strings.IndexByte(arg, '=')
-			flag := arg[:idx]
-			value := strings.TrimSpace(arg[idx+1:])
-			if value == "" {
-				fmt.Fprintf(os.Stderr, "Error: %s requires a non-empty absolute path. Remedy: Pass %s=<absolute-path-to-config.yaml>.\n", flag, flag)
-				os.Exit(1)
-			}
-			if !filepath.IsAbs(value) {
-				fmt.Fprintf(os.Stderr, "Error: %s requires an absolute path. Remedy: Pass %s=<absolute-path-to-config.yaml>.\n", flag, flag)
-				os.Exit(1)
-			}
-			configPath = filepath.Clean(value)
-		}
+	// Command-line arguments: custom config path and optional command mode.
+	cl, err := parseCommandLine(os.Args[1:], filepath.Join(exeDir, "config.yaml"))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
 	}
+	configPath := cl.ConfigPath
 
 	cfg, err := util.Load(configPath)
 	if err != nil {
 		exitWithError(fmt.Sprintf("Error loading configuration from %s", configPath), err)
 	}
+	util.SetIORetryPolicy(cfg.IORetry.Policy())
+	// A remote backup directory stays connected until the process exits.
+	if _, err := storage.Mount(cfg); err != nil {
+		exitWithError("Error connecting the backup directory", err)
+	}
+	// A file of a run spanning removable media that is on another medium is asked for.
+	if cfg.Spanning.Enabled {
+		for _, dir := range cfg.BackupDestinations() {
+			if !util.IsStorageURL(dir) {
+				util.MountMedia(util.ResolveDir(dir, exeDir), operation.PromptMedia)
+			}
+		}
+	}
+
+	if cl.Restore.Stdout {
+		// Standard output carries the restored data; everything printed goes to stderr.
+		cl.Restore.Output = os.Stdout
+		os.Stdout = os.Stderr
+	}
 
 	printStartupBanner(Version)
 	health := startup.RunStartupHealthCheck(cfg, exeDir, configPath)
 
+	if cl.Command != "" {
+		os.Exit(runCommand(cl, cfg, exeDir, health))
+	}
+
 	// Interactive menu mode.
 	for {
 		printMenu()
-		choice := getUserInput("Select an option (1-4): ")
+		choice := getUserInput("Select an option (1-11): ")
 		fmt.Println()
 
 		switch strings.TrimSpace(choice) {
@@ -99,6 +114,66 @@ func main() {
 			}
 			fmt.Println()
 		case "4":
+			if health.BlocksRestoreOrVerify() {
+				reportHealthCheckBlocking("Listing")
+				waitForKeyPress()
+			} else if err := list.Run(cfg, exeDir); err != nil {
+				reportOperationError("Listing", err)
+				waitForKeyPress()
+			}
+			fmt.Println()
+		case "5":
+			if health.BlocksRestoreOrVerify() {
+				reportHealthCheckBlocking("Diff")
+				waitForKeyPress()
+			} else if err := diff.Run(cfg, exeDir); err != nil {
+				reportOperationError("Diff", err)
+				waitForKeyPress()
+			}
+			fmt.Println()
+		case "6":
+			if health.BlocksRestoreOrVerify() {
+				reportHealthCheckBlocking("Consolidation")
+				waitForKeyPress()
+			} else if err := consolidate.Run(cfg, exeDir); err != nil {
+				reportOperationError("Consolidation", err)
+				waitForKeyPress()
+			}
+			fmt.Println()
+		case "7":
+			if health.BlocksRestoreOrVerify() {
+				reportHealthCheckBlocking("Export")
+				waitForKeyPress()
+			} else if err := export.Run(cfg, exeDir); err != nil {
+				reportOperationError("Export", err)
+				waitForKeyPress()
+			}
+			fmt.Println()
+		case "8":
+			if health.BlocksBackup() {
+				reportHealthCheckBlocking("Import")
+				waitForKeyPress()
+			} else if err := importer.Run(cfg, exeDir); err != nil {
+				reportOperationError("Import", err)
+				waitForKeyPress()
+			}
+			fmt.Println()
+		case "9":
+			if health.BlocksRestoreOrVerify() {
+				reportHealthCheckBlocking("Sync")
+				waitForKeyPress()
+			} else if err := replicate.Run(cfg, exeDir); err != nil {
+				reportOperationError("Sync", err)
+				waitForKeyPress()
+			}
+			fmt.Println()
+		case "10":
+			if err := cleanup.Run(cfg, exeDir); err != nil {
+				reportOperationError("Cleanup", err)
+				waitForKeyPress()
+			}
+			fmt.Println()
+		case "11":
 			fmt.Println("Goodbye!")
 			return
 		default:
@@ -108,6 +183,90 @@ func main() {
 	}
 }
 
+// runCommand executes a single command passed on the command line and returns the process exit code.
+func runCommand(cl commandLine, cfg *util.Config, exeDir string, health startup.HealthCheckResult) int {
+	switch cl.Command {
+	case commandBackup:
+		if health.BlocksBackup() {
+			reportHealthCheckBlocking("Backup")
+			return 1
+		}
+		if err := backup.RunWithOptions(cfg, exeDir, cl.Backup); err != nil {
+			reportOperationError("Backup", err)
+			return 1
+		}
+	case commandRestore:
+		if health.BlocksRestoreOrVerify() {
+			reportHealthCheckBlocking("Restore")
+			return 1
+		}
+		if err := restore.RunWithOptions(cfg, exeDir, cl.Restore); err != nil {
+			reportOperationError("Restore", err)
+			return 1
+		}
+	case commandList:
+		if health.BlocksRestoreOrVerify() {
+			reportHealthCheckBlocking("Listing")
+			return 1
+		}
+		if err := list.RunWithOptions(cfg, exeDir, cl.List); err != nil {
+			reportOperationError("Listing", err)
+			return 1
+		}
+	case commandDiff:
+		if health.BlocksRestoreOrVerify() {
+			reportHealthCheckBlocking("Diff")
+			return 1
+		}
+		if err := diff.RunWithOptions(cfg, exeDir, cl.Diff); err != nil {
+			reportOperationError("Diff", err)
+			return 1
+		}
+	case commandConsolidate:
+		if health.BlocksRestoreOrVerify() {
+			reportHealthCheckBlocking("Consolidation")
+			return 1
+		}
+		if err := consolidate.RunWithOptions(cfg, exeDir, cl.Consolidate); err != nil {
+			reportOperationError("Consolidation", err)
+			return 1
+		}
+	case commandExport:
+		if health.BlocksRestoreOrVerify() {
+			reportHealthCheckBlocking("Export")
+			return 1
+		}
+		if err := export.RunWithOptions(cfg, exeDir, cl.Export); err != nil {
+			reportOperationError("Export", err)
+			return 1
+		}
+	case commandImport:
+		if health.BlocksBackup() {
+			reportHealthCheckBlocking("Import")
+			return 1
+		}
+		if err := importer.RunWithOptions(cfg, exeDir, cl.Import); err != nil {
+			reportOperationError("Import", err)
+			return 1
+		}
+	case commandSync:
+		if health.BlocksRestoreOrVerify() {
+			reportHealthCheckBlocking("Sync")
+			return 1
+		}
+		if err := replicate.RunWithOptions(cfg, exeDir, cl.Sync); err != nil {
+			reportOperationError("Sync", err)
+			return 1
+		}
+	case commandCleanup:
+		if err := cleanup.Run(cfg, exeDir); err != nil {
+			reportOperationError("Cleanup", err)
+			return 1
+		}
+	}
+	return 0
+}
+
 func reportHealthCheckBlocking(action string) {
 	fmt.Fprintln(os.Stderr)
 	fmt.Fprintf(os.Stderr, "%s cannot proceed: resolve the health check errors reported above first.\n", action)
@@ -131,6 +290,36 @@ func reportOperationError(action string, err error) {
 		fmt.Fprintln(os.Stderr)
 		return
 	}
+	if action == "Listing" && strings.HasPrefix(err.Error(), "List preflight failed:") {
+		fmt.Fprintln(os.Stderr, "Listing failed.")
+		fmt.Fprintln(os.Stderr)
+		return
+	}
+	if action == "Diff" && strings.HasPrefix(err.Error(), "Diff preflight failed:") {
+		fmt.Fprintln(os.Stderr, "Diff failed.")
+		fmt.Fprintln(os.Stderr)
+		return
+	}
+	if action == "Consolidation" && strings.HasPrefix(err.Error(), "Consolidate preflight failed:") {
+		fmt.Fprintln(os.Stderr, "Consolidation failed.")
+		fmt.Fprintln(os.Stderr)
+		return
+	}
+	if action == "Export" && strings.HasPrefix(err.Error(), "Export preflight failed:") {
+		fmt.Fprintln(os.Stderr, "Export failed.")
+		fmt.Fprintln(os.Stderr)
+		return
+	}
+	if action == "Import" && strings.HasPrefix(err.Error(), "Import preflight failed:") {
+		fmt.Fprintln(os.Stderr, "Import failed.")
+		fmt.Fprintln(os.Stderr)
+		return
+	}
+	if action == "Sync" && strings.HasPrefix(err.Error(), "Sync preflight failed:") {
+		fmt.Fprintln(os.Stderr, "Sync failed.")
+		fmt.Fprintln(os.Stderr)
+		return
+	}
 
 	fmt.Fprintf(os.Stderr, "%s failed: %v\n", action, err)
 	fmt.Fprintln(os.Stderr)
@@ -150,7 +339,14 @@ func printMenu() {
 	fmt.Println("1. Create backup")
 	fmt.Println("2. Restore backup")
 	fmt.Println("3. Verify backup")
-	fmt.Println("4. Exit")
+	fmt.Println("4. List backup contents")
+	fmt.Println("5. Compare backup with source directory")
+	fmt.Println("6. Consolidate incremental backups")
+	fmt.Println("7. Export backup")
+	fmt.Println("8. Import archive")
+	fmt.Println("9. Copy backups to another location")
+	fmt.Println("10. Delete incomplete backup runs")
+	fmt.Println("11. Exit")
 	fmt.Println()
 }
 
@@ -29,6 +29,28 @@ func TestReportPreflightErrorStartsWithSingleBlankLine(t *testing.T) {
 	}
 }
 
+func TestReportExportPreflightErrorPrintsOnlyFailure(t *testing.T) {
+	output := captureStderr(t, func() {
+		reportOperationError("Export", errors.New("Export preflight failed: export file exists"))
+	})
+
+	expected := "\nExport failed.\n\n"
+	if output != expected {
+		t.Fatalf("unexpected output.\nexpected: %q\n     got: %q", expected, output)
+	}
+}
+
+func TestReportImportPreflightErrorPrintsOnlyFailure(t *testing.T) {
+	output := captureStderr(t, func() {
+		reportOperationError("Import", errors.New("Import preflight failed: insufficient space"))
+	})
+
+	expected := "\nImport failed.\n\n"
+	if output != expected {
+		t.Fatalf("unexpected output.\nexpected: %q\n     got: %q", expected, output)
+	}
+}
+
 func captureStderr(t *testing.T, fn func()) string {
 	t.Helper()
 
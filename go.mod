@@ -3,8 +3,12 @@ module RestoreSafe
 go 1.26.3
 
 require (
+	github.com/pkg/sftp v1.13.10
 	golang.org/x/crypto v0.51.0
+	golang.org/x/net v0.54.0
 	golang.org/x/sys v0.44.0
 	golang.org/x/term v0.43.0
 	gopkg.in/yaml.v3 v3.0.1
 )
+
+require github.com/kr/fs v0.1.0 // indirect
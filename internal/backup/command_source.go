@@ -0,0 +1,57 @@
+package backup
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"fmt"
+	"os/exec"
+)
+
+// backupCommandSource streams the standard output of a command → encrypt → split-writer.
+// The manifest describes the output as one file named after the source, with its size
+// and SHA-256. Standard error is written to the run log. When the command cannot be
+// started or exits with an error, the parts written so far are removed and the backup
+// set fails.
+func backupCommandSource(
+	source util.CommandSource,
+	backupDir, date string,
+	id util.BackupID,
+	password []byte,
+	params security.Argon2Params,
+	cfg *util.Config,
+	log *util.Logger,
+) (int, error) {
+	commandLine := operation.FormatCommand(source.Command, source.Args)
+	stderr := &operation.CommandLogWriter{Log: log, Prefix: "  [" + source.Name + "] "}
+	cmd := exec.Command(source.Command, source.Args...)
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("Failed to start command %s: %w. Remedy: Check 'command' and 'args' of the command source in config.yaml and that the program is installed.", commandLine, err)
+	}
+	log.Info("  Command: %s", commandLine)
+
+	parts, streamErr := encryptStream(stdout, source.Name, backupDir, date, id, password, params, cfg, log)
+	if streamErr != nil {
+		// Nobody reads the output any more; stop the command instead of letting it block.
+		cmd.Process.Kill() //nolint:errcheck
+	}
+	waitErr := cmd.Wait()
+	stderr.Flush()
+	switch {
+	case waitErr != nil && streamErr == nil:
+		parts.remove()
+		return 0, fmt.Errorf("%w. Remedy: Check the command output in the log and run the command manually to test it.", operation.CommandExitError(commandLine, waitErr, stderr))
+	case streamErr != nil:
+		parts.remove()
+		return 0, streamErr
+	}
+
+	entry := util.BackupEntry{DirectoryName: source.Name, Date: date, ID: id}
+	return parts.finish(entry, catalog.SourceTypeCommand, password, params, cfg, log)
+}
@@ -0,0 +1,119 @@
+package backup
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHelperCommand(t *testing.T) {
+	testutil.RunHelperCommand()
+}
+
+func TestBackupCommandSourceStoresOutput(t *testing.T) {
+	backupDir := t.TempDir()
+	command, args := testutil.HelperCommand(t, "database dump", "dumping tables\n", 0, "")
+	source := util.CommandSource{Name: "db.sql", Command: command, Args: args}
+	entry := util.BackupEntry{DirectoryName: "db.sql", Date: "2026-03-18", ID: util.BackupID("CMD123")}
+	password := []byte("pw")
+
+	logPath := filepath.Join(t.TempDir(), "backup.log")
+	logger, err := util.NewLogger(logPath, "info")
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	parts, backupErr := backupCommandSource(source, backupDir, entry.Date, entry.ID, password, security.DefaultArgon2Params, &util.Config{SplitSizeMB: 1}, logger)
+	logger.Close()
+	if backupErr != nil {
+		t.Fatalf("backupCommandSource failed: %v", backupErr)
+	}
+	if parts != 1 {
+		t.Fatalf("expected 1 part, got %d", parts)
+	}
+
+	partPaths, err := catalog.CollectParts(backupDir, entry)
+	if err != nil {
+		t.Fatalf("CollectParts failed: %v", err)
+	}
+	var stream bytes.Buffer
+	err = operation.RunDecryptPipeline(partPaths, password, nil, entry.DirectoryName, "read", "Stream read", func(r io.Reader) error {
+		_, err := io.Copy(&stream, r)
+		return err
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to decrypt the parts: %v", err)
+	}
+	if stream.String() != "database dump" {
+		t.Fatalf("expected the raw command output in the archive, got %q", stream.String())
+	}
+
+	entries, ok, err := manifest.LoadForBackup(backupDir, entry, password)
+	if err != nil || !ok {
+		t.Fatalf("expected manifest next to the parts, got ok=%v err=%v", ok, err)
+	}
+	if len(entries) != 1 || entries[0].Path != "db.sql" || entries[0].Size != int64(len("database dump")) || entries[0].SHA256 == "" {
+		t.Fatalf("expected one manifest entry describing the output, got %#v", entries)
+	}
+	info, err := catalog.ReadRunInfo(backupDir, entry)
+	if err != nil || !info.IsStream() {
+		t.Fatalf("expected run metadata to mark the stream, got %+v, %v", info, err)
+	}
+
+	logData, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if !strings.Contains(string(logData), "[db.sql] dumping tables") {
+		t.Fatalf("expected standard error of the command in the log, got:\n%s", logData)
+	}
+}
+
+func TestBackupCommandSourceFailsOnNonZeroExit(t *testing.T) {
+	backupDir := t.TempDir()
+	command, args := testutil.HelperCommand(t, "partial dump", "connection refused\n", 3, "")
+	source := util.CommandSource{Name: "db.sql", Command: command, Args: args}
+
+	_, err := backupCommandSource(source, backupDir, "2026-03-18", util.BackupID("CMD124"), []byte("pw"), security.DefaultArgon2Params, &util.Config{SplitSizeMB: 1}, nil)
+	if err == nil {
+		t.Fatal("expected an error for a command exiting with code 3")
+	}
+	if !strings.Contains(err.Error(), "exit code 3") || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("expected exit code and last stderr line in the error, got %v", err)
+	}
+
+	files, err := os.ReadDir(backupDir)
+	if err != nil {
+		t.Fatalf("failed to read backup dir: %v", err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected the parts of the failed set to be removed, found %d file(s)", len(files))
+	}
+}
+
+func TestBackupCommandSourceWritesNothingToTemp(t *testing.T) {
+	backupDir := t.TempDir()
+	command, args := testutil.HelperCommand(t, "database dump", "", 0, "")
+	// The output goes straight into the parts, so a missing temp directory does not matter.
+	missing := filepath.Join(t.TempDir(), "missing")
+	for _, name := range []string{"TMPDIR", "TMP", "TEMP"} {
+		t.Setenv(name, missing)
+	}
+	source := util.CommandSource{Name: "db.sql", Command: command, Args: args}
+
+	parts, err := backupCommandSource(source, backupDir, "2026-03-18", util.BackupID("CMD125"), []byte("pw"), security.DefaultArgon2Params, &util.Config{SplitSizeMB: 1}, nil)
+	if err != nil {
+		t.Fatalf("backupCommandSource failed without a temp directory: %v", err)
+	}
+	if parts != 1 {
+		t.Fatalf("expected 1 part, got %d", parts)
+	}
+}
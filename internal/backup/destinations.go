@@ -0,0 +1,197 @@
+package backup
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/util"
+	"fmt"
+	"path/filepath"
+)
+
+// backupTargets are the backup directories a run is written to. With several
+// directories, Dir is the root of a util.TeeStorage that writes the encrypted
+// stream to all of them in one pass; otherwise Dir is the backup directory itself.
+type backupTargets struct {
+	Dir     string
+	Dirs    []string
+	tee     *util.TeeStorage
+	unmount func()
+	locks   []*util.BackupLock
+}
+
+// openBackupTargets creates and locks the backup directories of cfg for run id.
+// A directory that cannot be created is dropped while another one is left.
+func openBackupTargets(cfg *util.Config, exeDir string, id util.BackupID) (*backupTargets, error) {
+	targets := &backupTargets{unmount: func() {}}
+	for _, dir := range cfg.BackupDestinations() {
+		targets.Dirs = append(targets.Dirs, util.ResolveDir(dir, exeDir))
+	}
+	targets.Dir = targets.Dirs[0]
+	if len(targets.Dirs) > 1 {
+		targets.Dir = "tee://run-" + string(id)
+		targets.tee = util.NewTeeStorage(targets.Dir, targets.Dirs)
+		targets.unmount = util.MountStorage(targets.Dir, targets.tee)
+	}
+	if err := util.StorageFor(targets.Dir).MkdirAll(targets.Dir); err != nil {
+		targets.Close()
+		return nil, fmt.Errorf("Failed to create backup directory: %w. Remedy: Check the path (prefer forward slashes in config.yaml, e.g. C:/Backups) and verify write permissions.", err)
+	}
+	if err := targets.lock(); err != nil {
+		targets.Close()
+		return nil, err
+	}
+	return targets, nil
+}
+
+// lock locks the healthy backup directories. Directories given as a storage URL
+// are not locked; see util.AcquireBackupLock.
+func (t *backupTargets) lock() error {
+	for _, dir := range t.Healthy() {
+		lock, err := util.AcquireBackupLock(dir)
+		if err != nil {
+			return err
+		}
+		t.locks = append(t.locks, lock)
+	}
+	return nil
+}
+
+// unlock releases the locks of the backup directories.
+func (t *backupTargets) unlock() {
+	for _, lock := range t.locks {
+		lock.Release()
+	}
+	t.locks = nil
+}
+
+// Healthy returns the backup directories that have not failed during the run.
+func (t *backupTargets) Healthy() []string {
+	if t.tee == nil {
+		return t.Dirs
+	}
+	var dirs []string
+	for _, dir := range t.Dirs {
+		if !t.tee.Failed(dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// Close releases the locks and unmounts the TeeStorage. It must run after the
+// run's log file is closed, as the log file is written through Dir.
+func (t *backupTargets) Close() {
+	t.unlock()
+	t.unmount()
+}
+
+// markStarted marks run date/id as incomplete in every backup directory before its
+// first file is written.
+func (t *backupTargets) markStarted(date string, id util.BackupID) error {
+	return catalog.MarkRunStarted(t.Dir, date, id)
+}
+
+// markComplete marks run date/id as complete in every backup directory that has
+// not failed during the run. Failed directories keep their incomplete-run marker.
+func (t *backupTargets) markComplete(date string, id util.BackupID) error {
+	for _, dir := range t.Healthy() {
+		if err := catalog.MarkRunComplete(dir, date, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startMediaSpan starts spanning run date/id over the removable media inserted at
+// the backup directory if spanning is enabled, and returns nil otherwise. A full
+// medium leaves the drive without the incomplete-run marker and the lock of the run;
+// the next medium gets both once it is inserted.
+func (t *backupTargets) startMediaSpan(cfg *util.Config, date string, id util.BackupID, log *util.Logger) (*util.MediaSpan, error) {
+	if !cfg.Spanning.Enabled {
+		return nil, nil
+	}
+	const mb = 1024 * 1024
+	span, err := util.StartMediaSpan(t.Dir, date, id, int64(cfg.Spanning.MediaSizeMB)*mb, int64(cfg.Spanning.ReserveMB)*mb, operation.PromptMedia)
+	if err != nil {
+		return nil, err
+	}
+	span.SetSwapHooks(func(volume int) error {
+		if err := catalog.MarkVolumeFinished(t.Dir, date, id); err != nil {
+			return err
+		}
+		t.unlock()
+		log.Info("Volume %d is full; waiting for the medium of volume %d", volume, volume+1)
+		return nil
+	}, func(volume int) error {
+		if err := t.lock(); err != nil {
+			return err
+		}
+		log.Info("Volume %d: medium inserted at %s", volume, filepath.ToSlash(t.Dir))
+		return t.markStarted(date, id)
+	})
+	log.Info("Spanning removable media at %s, starting with volume 1", filepath.ToSlash(t.Dir))
+	return span, nil
+}
+
+// reportFailures logs every backup directory that failed during run date/id and
+// marks its copy of the run as incomplete. It returns the number of failed directories.
+func (t *backupTargets) reportFailures(date string, id util.BackupID, log *util.Logger) int {
+	if t.tee == nil {
+		return 0
+	}
+	failures := t.tee.Failures()
+	for _, failure := range failures {
+		log.Warn("Backup directory %s failed during the backup: %v", filepath.ToSlash(failure.Dir), failure.Err)
+		fmt.Printf("[WARN] Backup directory %s failed during the backup: %v\n", filepath.ToSlash(failure.Dir), failure.Err)
+		marker := util.IncompleteRunFileName(failure.Dir, date, id)
+		reason := fmt.Sprintf("Backup run %s_%s is incomplete in this directory: %v\n", date, string(id), failure.Err)
+		if err := util.WriteStorageFile(marker, []byte(reason)); err != nil {
+			log.Warn("  Could not mark the copy as incomplete (%v). Remedy: Delete the files of run %s_%s from %s.", err, date, string(id), filepath.ToSlash(failure.Dir))
+			continue
+		}
+		log.Warn("  Its copy of this run is incomplete and marked with %s", filepath.Base(marker))
+	}
+	return len(failures)
+}
+
+// applyRetention applies the retention policy in every backup directory that holds
+// a complete copy of the run and returns the number of warnings.
+func (t *backupTargets) applyRetention(retentionKeep int, sources []backupSource, log *util.Logger) int {
+	warnings := 0
+	for _, dir := range t.Healthy() {
+		if len(t.Dirs) > 1 {
+			log.Info("Retention in backup directory %s", filepath.ToSlash(dir))
+		}
+		if err := applyRetentionPolicy(dir, retentionKeep, sources, log); err != nil {
+			log.Warn("Retention cleanup failed: %v", err)
+			warnings++
+		}
+	}
+	for _, dir := range t.Dirs {
+		if t.tee != nil && t.tee.Failed(dir) {
+			log.Info("Retention skipped in %s: its copy of this run is incomplete", filepath.ToSlash(dir))
+		}
+	}
+	return warnings
+}
+
+// printLogFiles prints the path of the run's log file in every healthy backup directory.
+func (t *backupTargets) printLogFiles(date string, id util.BackupID) {
+	fmt.Println()
+	for _, dir := range t.Healthy() {
+		fmt.Printf("Log file: %s\n", util.LogFileName(dir, date, id))
+	}
+}
+
+// stagingVolumeDir returns the backup directory to plan local staging for: the
+// first one that shares a drive with a source, or the first one.
+func stagingVolumeDir(sources []backupSource, dirs []string) string {
+	for _, dir := range dirs {
+		for _, src := range sources {
+			if src.Err == nil && !src.Skip && src.Command == nil && util.SameVolume(src.Resolved, dir) {
+				return dir
+			}
+		}
+	}
+	return dirs[0]
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"sync/atomic"
 )
 
@@ -25,15 +26,18 @@ func newSplitOutput(backupDir, directoryName, date string, id util.BackupID, spl
 		return util.PartFileName(backupDir, directoryName, date, id, seq)
 	}
 	sw := util.NewWriter(nameFunc, splitSizeBytes)
+	sw.SetMediaSpan(util.MediaSpanFor(backupDir))
 	bw := bufio.NewWriterSize(sw, util.SplitWriteBufferSize)
 	return sw, bw
 }
 
-func startTarProducer(log *util.Logger, srcDir, backupDir string, pw *io.PipeWriter) <-chan error {
+// startTarProducer writes the TAR stream of srcDir into pw. opts.OnEntry receives
+// every entry with its offsets and content hash for the manifest.
+func startTarProducer(log *util.Logger, srcDir, backupDir string, pw *io.PipeWriter, opts util.TarWriteOptions) <-chan error {
 	tarErrCh := make(chan error, 1)
 	log.Debug("Starting TAR creation for: %s", srcDir)
 	go func() {
-		err := util.WriteTar(pw, srcDir, backupDir)
+		err := util.WriteTarWithOptions(pw, srcDir, opts, backupDir)
 		pw.CloseWithError(err) //nolint:errcheck
 		tarErrCh <- err
 	}()
@@ -83,7 +87,7 @@ func logPartSummary(sw *util.Writer, directoryName string, ioDiagnostics bool, c
 			continue
 		}
 
-		fi, err := os.Stat(p)
+		fi, err := util.StorageFor(p).Stat(p)
 		if err != nil {
 			log.Warn("Failed to inspect part file %s: %v", filepath.Base(p), err)
 			continue
@@ -96,7 +100,7 @@ func logPartSummary(sw *util.Writer, directoryName string, ioDiagnostics bool, c
 
 type stagedFile struct{ name, src, dst string }
 
-// moveBackupResults moves all encrypted part files and challenge files from staging directory to backup directory.
+// moveBackupResults moves all encrypted part files, challenge files, manifests and run metadata from staging directory to backup directory.
 // directoryOrder specifies the directory names in processing order; if nil, directories are sorted alphabetically.
 // directorySourcePaths maps directory name to original source path for display in log output.
 func moveBackupResults(stagingDir, backupDir string, directoryOrder []string, directorySourcePaths map[string]string, log *util.Logger) error {
@@ -105,7 +109,7 @@ func moveBackupResults(stagingDir, backupDir string, directoryOrder []string, di
 		return fmt.Errorf("Failed to list staging directory: %w", err)
 	}
 	filesByDirectory := make(map[string][]stagedFile)
-	var challengeFiles []stagedFile
+	var sidecarFiles []stagedFile
 
 	for _, entry := range entries {
 		if entry.IsDir() {
@@ -114,14 +118,16 @@ func moveBackupResults(stagingDir, backupDir string, directoryOrder []string, di
 		name := entry.Name()
 		srcPath := filepath.Join(stagingDir, name)
 		dstPath := filepath.Join(backupDir, name)
-		switch filepath.Ext(name) {
-		case ".enc":
+		switch {
+		case strings.HasSuffix(name, util.ManifestFileSuffix), strings.HasSuffix(name, util.RunInfoFileSuffix):
+			sidecarFiles = append(sidecarFiles, stagedFile{name, srcPath, dstPath})
+		case filepath.Ext(name) == ".enc":
 			if backupEntry, _, ok := util.ParsePartFileName(name); ok {
 				fn := backupEntry.DirectoryName
 				filesByDirectory[fn] = append(filesByDirectory[fn], stagedFile{name, srcPath, dstPath})
 			}
-		case ".challenge":
-			challengeFiles = append(challengeFiles, stagedFile{name, srcPath, dstPath})
+		case filepath.Ext(name) == ".challenge":
+			sidecarFiles = append(sidecarFiles, stagedFile{name, srcPath, dstPath})
 		}
 	}
 
@@ -158,12 +164,12 @@ func moveBackupResults(stagingDir, backupDir string, directoryOrder []string, di
 		}
 	}
 
-	for _, f := range challengeFiles {
+	for _, f := range sidecarFiles {
 		if err := util.CopyFile(f.src, f.dst); err != nil {
 			return fmt.Errorf("Failed to move %s to backup directory: %w", f.name, err)
 		}
 		if log != nil {
-			log.Debug("Moved challenge file to backup directory: %s", f.name)
+			log.Debug("Moved %s to backup directory", f.name)
 		}
 	}
 
@@ -200,20 +206,24 @@ func copyFileWithCounters(src, dst string, inBytes, outBytes, outWriteCalls *ato
 	}
 	defer srcFile.Close()
 
-	dstFile, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	dstFile, err := util.CreateAtomic(dst)
 	if err != nil {
 		return fmt.Errorf("Failed to create destination file %q: %w", dst, err)
 	}
-	defer dstFile.Close()
 
 	cr := &operation.CountingReader{R: srcFile, Total: inBytes}
 	cw := &operation.CountingWriter{W: dstFile, Total: outBytes, Calls: outWriteCalls}
 
 	if _, err := io.Copy(cw, cr); err != nil {
+		dstFile.Abort()
 		return fmt.Errorf("Failed to copy %q: %w", src, err)
 	}
 	if err := dstFile.Sync(); err != nil {
+		dstFile.Abort()
 		return fmt.Errorf("Failed to sync %q to disk: %w", dst, err)
 	}
+	if err := dstFile.Close(); err != nil {
+		return fmt.Errorf("Failed to close %q: %w", dst, err)
+	}
 	return nil
 }
@@ -44,7 +44,7 @@ func TestCopyFileWithCountersReturnsErrorForBadDestination(t *testing.T) {
 	}
 }
 
-func TestMoveBackupResultsCopiesOnlyEncryptedAndChallengeFiles(t *testing.T) {
+func TestMoveBackupResultsCopiesOnlyEncryptedChallengeAndManifestFiles(t *testing.T) {
 	t.Parallel()
 
 	stagingDir := t.TempDir()
@@ -53,6 +53,7 @@ func TestMoveBackupResultsCopiesOnlyEncryptedAndChallengeFiles(t *testing.T) {
 	files := map[string]string{
 		"[alpha]_2026-03-21_AB12CD-001.enc": "enc-part",
 		"alpha_2026_AAA111.challenge":        "challenge",
+		"[alpha]_2026-03-21_AB12CD.manifest.enc": "manifest",
 		"notes.txt":                          "ignore",
 	}
 	for name, content := range files {
@@ -71,6 +72,9 @@ func TestMoveBackupResultsCopiesOnlyEncryptedAndChallengeFiles(t *testing.T) {
 	if _, err := os.Stat(filepath.Join(backupDir, "alpha_2026_AAA111.challenge")); err != nil {
 		t.Fatalf("expected .challenge file to be copied: %v", err)
 	}
+	if _, err := os.Stat(filepath.Join(backupDir, "[alpha]_2026-03-21_AB12CD.manifest.enc")); err != nil {
+		t.Fatalf("expected manifest file to be copied: %v", err)
+	}
 	if _, err := os.Stat(filepath.Join(backupDir, "notes.txt")); err == nil {
 		t.Fatal("did not expect non-backup file to be copied")
 	}
@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/util"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// incrementalBase is the parent backup an incremental run is compared with.
+type incrementalBase struct {
+	Entry util.BackupEntry
+	Index manifest.Index
+
+	seen      map[string]bool
+	changed   int
+	unchanged int
+}
+
+func newIncrementalBase(parent util.BackupEntry, entries []manifest.Entry) *incrementalBase {
+	return &incrementalBase{Entry: parent, Index: manifest.NewIndex(entries), seen: make(map[string]bool)}
+}
+
+// planIncrementalBase decides whether directoryName is backed up incrementally and
+// returns the parent to compare with, or nil for a full backup. The parent is the
+// newest backup of the directory; its manifest must be readable with password and
+// its chain must be shorter than the configured limit.
+func planIncrementalBase(cfg *util.Config, backupDir, directoryName string, newest map[string]util.BackupEntry, password []byte, log *util.Logger) *incrementalBase {
+	if cfg.BackupMode != util.BackupModeIncremental {
+		return nil
+	}
+	parent, ok := newest[directoryName]
+	if !ok {
+		log.Info("  Full backup: no previous backup of this directory")
+		return nil
+	}
+
+	chain, err := catalog.ResolveChain(backupDir, parent)
+	if err != nil {
+		log.Warn("Full backup of %s: the chain of the previous backup cannot be used (%v)", directoryName, err)
+		return nil
+	}
+	if len(chain)-1 >= cfg.MaxIncrementalChain {
+		log.Info("  Full backup: %d incremental run(s) since the last full backup (max_incremental_chain=%d)", len(chain)-1, cfg.MaxIncrementalChain)
+		return nil
+	}
+
+	entries, ok, err := manifest.LoadForBackup(backupDir, parent, password)
+	if err != nil {
+		log.Warn("Full backup of %s: the manifest of %s cannot be read with this password (%v)", directoryName, parent.String(), err)
+		return nil
+	}
+	if !ok {
+		log.Info("  Full backup: previous backup %s has no manifest", parent.String())
+		return nil
+	}
+
+	log.Info("  Incremental backup based on: %s", parent.String())
+	return newIncrementalBase(parent, entries)
+}
+
+// parentChallenge returns the YubiKey challenge of the newest previous backup of any
+// source, so that an incremental run derives the same key as its parents.
+func parentChallenge(backupDir string, sources []backupSource, newest map[string]util.BackupEntry) (string, bool) {
+	for _, source := range sources {
+		if source.Err != nil || source.Skip || source.Command != nil {
+			continue
+		}
+		name := source.BackupName
+		if name == "" {
+			name = util.DirectoryBaseName(source.Resolved)
+		}
+		parent, ok := newest[name]
+		if !ok {
+			continue
+		}
+		path, found, err := catalog.FindChallengeFileForRun(backupDir, parent.Date, parent.ID)
+		if err != nil || !found {
+			continue
+		}
+		challenge, err := operation.ReadChallengeFile(path)
+		if err != nil {
+			continue
+		}
+		return challenge, true
+	}
+	return "", false
+}
+
+// skipUnchanged reports whether the regular file at path is unchanged since the
+// parent backup and can be left out of the archive. A file is unchanged when its
+// size and modification time match; when only the time differs, its content hash
+// is compared.
+func (b *incrementalBase) skipUnchanged(path, name string, info os.FileInfo) (bool, error) {
+	prev, ok := b.Index[name]
+	if !ok || prev.Type != "file" || prev.Size != info.Size() {
+		b.changed++
+		return false, nil
+	}
+	if !prev.ModTime.Round(time.Second).Equal(info.ModTime().Round(time.Second)) {
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(sum, prev.Sum()) {
+			b.changed++
+			return false, nil
+		}
+	}
+	b.unchanged++
+	return true, nil
+}
+
+// manifestEntry converts a TAR entry of an incremental run. Skipped files keep the
+// hash and location of the parent's content.
+func (b *incrementalBase) manifestEntry(e util.TarEntry) manifest.Entry {
+	entry := manifest.EntryFromTar(e)
+	b.seen[entry.Path] = true
+	if !e.Skipped {
+		return entry
+	}
+	prev := b.Index[entry.Path]
+	entry.SHA256 = prev.SHA256
+	entry.HeaderOffset = prev.HeaderOffset
+	entry.DataOffset = prev.DataOffset
+	entry.Stored = prev.Stored
+	if entry.Stored == "" {
+		entry.Stored = b.Entry.String()
+	}
+	return entry
+}
+
+// reset forgets the files seen and counted so far, before the archive of the
+// directory is written again from the start.
+func (b *incrementalBase) reset() {
+	b.seen = make(map[string]bool)
+	b.changed = 0
+	b.unchanged = 0
+}
+
+// tombstones returns a deletion marker for every entry of the parent that was not
+// seen in this run.
+func (b *incrementalBase) tombstones() []manifest.Entry {
+	var deleted []manifest.Entry
+	for path := range b.Index {
+		if !b.seen[path] {
+			deleted = append(deleted, manifest.Entry{Path: path, Type: manifest.TypeDeleted})
+		}
+	}
+	sort.Slice(deleted, func(i, j int) bool { return deleted[i].Path < deleted[j].Path })
+	return deleted
+}
+
+func fileSHA256(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open file %q: %w", path, err)
+	}
+	defer f.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return nil, fmt.Errorf("Failed to read file %q: %w", path, err)
+	}
+	return sum.Sum(nil), nil
+}
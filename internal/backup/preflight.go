@@ -12,7 +12,7 @@ import (
 func printBackupPreflightWithYubiKeyCheck(
 	w io.Writer,
 	cfg *util.Config,
-	backupDir string,
+	backupDirs []string,
 	sources []backupSource,
 	stagingPlan operation.LocalStagingPlan,
 	checkYubiKeyConnected func() error,
@@ -21,11 +21,14 @@ func printBackupPreflightWithYubiKeyCheck(
 	fmt.Fprintln(w, "Backup preflight")
 	fmt.Fprintln(w, "----------------")
 	estimatedBytes, estimateWarnings := estimateSelectedSourceBytes(sources)
-	freeBytes, freeErr := util.QueryFreeSpaceBytes(backupDir)
-	sameVolumeNetworkWarning := !stagingPlan.Enabled && stagingPlan.SameVolume && util.IsNetworkVolume(backupDir)
+	stagingDir := stagingVolumeDir(sources, backupDirs)
+	sameVolumeNetworkWarning := !stagingPlan.Enabled && stagingPlan.SameVolume && util.IsNetworkVolume(stagingDir)
 
 	fmt.Fprintln(w, "Source directory(s):")
 	for _, src := range sources {
+		if src.Command != nil {
+			continue
+		}
 		baseName := util.DirectoryBaseName(src.Resolved)
 		backupName := src.BackupName
 		if backupName == "" {
@@ -53,10 +56,11 @@ func printBackupPreflightWithYubiKeyCheck(
 			}
 		}
 
-		if sameVolumeNetworkWarning && !src.Skip && util.SameVolume(src.Resolved, backupDir) {
-			fmt.Fprintf(w, "          → Source and backup directories are on the same drive/share (%s). This can cause long stalls, especially on network/NAS storage. Local staging is unavailable because TEMP is on the same drive/share. Remedy: Prefer a different backup drive/share or point TEMP/TMP to a local drive.\n", util.VolumeDisplay(backupDir))
+		if sameVolumeNetworkWarning && !src.Skip && util.SameVolume(src.Resolved, stagingDir) {
+			fmt.Fprintf(w, "          → Source and backup directories are on the same drive/share (%s). This can cause long stalls, especially on network/NAS storage. Local staging is unavailable because TEMP is on the same drive/share. Remedy: Prefer a different backup drive/share or point TEMP/TMP to a local drive.\n", util.VolumeDisplay(stagingDir))
 		}
 	}
+	printCommandSources(w, sources)
 	for _, warning := range estimateWarnings {
 		fmt.Fprintf(w, "  [WARN] size estimate: %s\n", warning)
 	}
@@ -65,16 +69,37 @@ func printBackupPreflightWithYubiKeyCheck(
 	}
 	fmt.Fprintf(w, "  Needed disk space (total): %s\n", util.FormatBytesBinary(uint64(estimatedBytes)))
 
-	fmt.Fprintln(w, "Backup directory:")
-	fmt.Fprintf(w, "  [OK] %s\n", backupDir)
-	if freeErr != nil {
-		fmt.Fprintf(w, "  Free disk space: unknown (%v)\n", freeErr)
+	if len(backupDirs) == 1 {
+		fmt.Fprintln(w, "Backup directory:")
 	} else {
-		fmt.Fprintf(w, "  Free disk space: %s\n", util.FormatBytesBinary(freeBytes))
+		fmt.Fprintln(w, "Backup directories (each receives a full copy):")
+	}
+	for _, backupDir := range backupDirs {
+		fmt.Fprintf(w, "  [OK] %s\n", backupDir)
+		freeBytes, freeErr := util.StorageFor(backupDir).FreeSpace(backupDir)
+		if freeErr != nil {
+			fmt.Fprintf(w, "  Free disk space: unknown (%v)\n", freeErr)
+		} else {
+			fmt.Fprintf(w, "  Free disk space: %s\n", util.FormatBytesBinary(freeBytes))
+		}
 	}
 
 	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Split size", fmt.Sprintf("%d MB", cfg.SplitSizeMB))
-	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Retention keep", fmt.Sprintf("%d", cfg.RetentionKeep))
+	if cfg.RepositoryFormat == util.RepositoryFormatChunked {
+		operation.PrintField(w, operation.DefaultFieldLabelWidth, "Repository", "chunked (deduplicated)")
+	} else {
+		operation.PrintField(w, operation.DefaultFieldLabelWidth, "Repository", "split-tar")
+	}
+	if cfg.Spanning.Enabled {
+		media := "free space of each medium"
+		if cfg.Spanning.MediaSizeMB > 0 {
+			media = fmt.Sprintf("%d MB per medium", cfg.Spanning.MediaSizeMB)
+		}
+		operation.PrintField(w, operation.DefaultFieldLabelWidth, "Removable media", fmt.Sprintf("spanning (%s, %d MB reserved)", media, cfg.Spanning.ReserveMB))
+		operation.PrintField(w, operation.DefaultFieldLabelWidth, "Retention keep", "not applied to removable media")
+	} else {
+		operation.PrintField(w, operation.DefaultFieldLabelWidth, "Retention keep", fmt.Sprintf("%d", cfg.RetentionKeep))
+	}
 	operation.PrintField(w, operation.DefaultFieldLabelWidth, "KDF (Argon2id)", fmt.Sprintf("time=%d  memory=%d MB  threads=%d", cfg.Argon2.Time, cfg.Argon2.MemoryMB, cfg.Argon2.Threads))
 	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Authentication", cfg.AuthenticationMode.Label())
 	operation.PrintYubiKeyPreflightStatus(w, cfg.UseYubiKey(), "backup", checkYubiKeyConnected)
@@ -82,7 +107,7 @@ func printBackupPreflightWithYubiKeyCheck(
 
 	if stagingPlan.Enabled {
 		fmt.Fprintln(w)
-		fmt.Fprintf(w, "Local staging via temp directory enabled, because source directory(s) and backup directory share the same drive (%s).\n", util.VolumeDisplay(backupDir))
+		fmt.Fprintf(w, "Local staging via temp directory enabled, because source directory(s) and backup directory share the same drive (%s).\n", util.VolumeDisplay(stagingDir))
 		fmt.Fprintln(w, "Temp directory:")
 		fmt.Fprintf(w, "  [OK] %s\n", filepath.ToSlash(stagingPlan.ResolvedTempDir))
 		localFreeBytes, localFreeErr := util.QueryFreeSpaceBytes(stagingPlan.ResolvedTempDir)
@@ -94,6 +119,32 @@ func printBackupPreflightWithYubiKeyCheck(
 	}
 }
 
+// printCommandSources lists the command sources of the backup. Their output size is
+// unknown before they run, so it is not part of the needed disk space.
+func printCommandSources(w io.Writer, sources []backupSource) {
+	printed := false
+	for _, src := range sources {
+		if src.Command == nil {
+			continue
+		}
+		if !printed {
+			fmt.Fprintln(w, "Command source(s):")
+			printed = true
+		}
+		if src.Err != nil {
+			fmt.Fprintf(w, "  [ERROR] %s\n", src.BackupName)
+			fmt.Fprintf(w, "          → command: %s\n", src.Resolved)
+			fmt.Fprintf(w, "          → %v\n", src.Err)
+			continue
+		}
+		fmt.Fprintf(w, "  [OK] %s\n", src.BackupName)
+		fmt.Fprintf(w, "          → command: %s\n", src.Resolved)
+	}
+	if printed {
+		fmt.Fprintln(w, "  Size of command output: unknown until the commands have run")
+	}
+}
+
 func validateSourceDirectories(sources []backupSource) error {
 	return operation.ValidatePreflightItems(
 		sources,
@@ -102,25 +153,39 @@ func validateSourceDirectories(sources []backupSource) error {
 	)
 }
 
-func validateTargetSpaceForBackup(backupDir string, sources []backupSource) error {
-	estimatedBytes, _ := estimateSelectedSourceBytes(sources)
-	if estimatedBytes <= 0 {
+// validateTargetSpace is validateTargetSpaceForBackup for cfg. A run
+// spanning removable media continues on the next medium, so its size is not limited
+// by the free space of the inserted one.
+func validateTargetSpace(cfg *util.Config, backupDirs []string, sources []backupSource) error {
+	if cfg.Spanning.Enabled {
 		return nil
 	}
+	return validateTargetSpaceForBackup(backupDirs, sources)
+}
 
-	freeBytes, err := util.QueryFreeSpaceBytes(backupDir)
-	if err != nil {
+// validateTargetSpaceForBackup checks the free space of every backup directory,
+// as each one receives a full copy of the backup.
+func validateTargetSpaceForBackup(backupDirs []string, sources []backupSource) error {
+	estimatedBytes, _ := estimateSelectedSourceBytes(sources)
+	if estimatedBytes <= 0 {
 		return nil
 	}
 
-	if !util.IsSpaceInsufficient(estimatedBytes, freeBytes) {
-		return nil
+	for _, backupDir := range backupDirs {
+		freeBytes, err := util.StorageFor(backupDir).FreeSpace(backupDir)
+		if err != nil {
+			continue
+		}
+		if !util.IsSpaceInsufficient(estimatedBytes, freeBytes) {
+			continue
+		}
+		message := util.FormatInsufficientBackupSpaceMessage(uint64(estimatedBytes), freeBytes)
+		if len(backupDirs) > 1 {
+			message = fmt.Sprintf("Backup directory %s: %s", filepath.ToSlash(backupDir), message)
+		}
+		return fmt.Errorf("Backup preflight failed: %s", message)
 	}
-
-	return fmt.Errorf(
-		"Backup preflight failed: %s",
-		util.FormatInsufficientBackupSpaceMessage(uint64(estimatedBytes), freeBytes),
-	)
+	return nil
 }
 
 func validateStagingSpaceForBackup(stagingPlan operation.LocalStagingPlan, sources []backupSource) error {
@@ -162,11 +227,11 @@ func estimateSelectedSourceBytes(sources []backupSource) (int64, []string) {
 	warnings := make([]string, 0)
 
 	for _, source := range sources {
-		if source.Err != nil || source.Skip {
+		if source.Err != nil || source.Skip || source.Command != nil {
 			continue
 		}
 
-		size, err := util.DirectorySizeBytes(source.Resolved)
+		size, err := util.SourceSizeBytes(source.Resolved)
 		if err != nil {
 			warnings = append(warnings, fmt.Sprintf("%s (%v)", source.Resolved, err))
 			continue
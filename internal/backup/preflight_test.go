@@ -74,12 +74,9 @@ func TestEstimateSelectedSourceBytes(t *testing.T) {
 func TestEstimateSelectedSourceBytesWarningOnUnreadablePath(t *testing.T) {
 	t.Parallel()
 	root := t.TempDir()
-	filePath := filepath.Join(root, "not-a-dir-file")
-	if err := os.WriteFile(filePath, []byte("x"), 0o600); err != nil {
-		t.Fatalf("failed to write file path: %v", err)
-	}
+	missingPath := filepath.Join(root, "missing")
 
-	total, warnings := estimateSelectedSourceBytes([]backupSource{{Resolved: filePath}})
+	total, warnings := estimateSelectedSourceBytes([]backupSource{{Resolved: missingPath}})
 	if total != 0 {
 		t.Fatalf("expected total 0 bytes when estimation fails, got %d", total)
 	}
@@ -99,7 +96,7 @@ func TestPrintBackupPreflightShowsErrorSourceAndWarnSource(t *testing.T) {
 	stagingPlan := operation.LocalStagingPlan{}
 
 	var sb strings.Builder
-	printBackupPreflightWithYubiKeyCheck(&sb, cfg, backupDir, sources, stagingPlan, func() error { return nil })
+	printBackupPreflightWithYubiKeyCheck(&sb, cfg, []string{backupDir}, sources, stagingPlan, func() error { return nil })
 	output := sb.String()
 
 	if !strings.Contains(output, "[ERROR]") {
@@ -136,7 +133,7 @@ func TestPrintBackupPreflightSuppressesSameVolumeWarningOnLocalDrive(t *testing.
 	stagingPlan := operation.LocalStagingPlan{Enabled: false, SameVolume: true}
 
 	var sb strings.Builder
-	printBackupPreflightWithYubiKeyCheck(&sb, cfg, backupDir, sources, stagingPlan, func() error { return nil })
+	printBackupPreflightWithYubiKeyCheck(&sb, cfg, []string{backupDir}, sources, stagingPlan, func() error { return nil })
 	output := sb.String()
 
 	warnLinePrefix := "→ Source and backup directories are on the same drive/share"
@@ -153,7 +150,7 @@ func TestPrintBackupPreflightShowsSameVolumeWarningForNetworkShare(t *testing.T)
 	stagingPlan := operation.LocalStagingPlan{Enabled: false, SameVolume: true}
 
 	var sb strings.Builder
-	printBackupPreflightWithYubiKeyCheck(&sb, cfg, backupDir, sources, stagingPlan, func() error { return nil })
+	printBackupPreflightWithYubiKeyCheck(&sb, cfg, []string{backupDir}, sources, stagingPlan, func() error { return nil })
 	output := sb.String()
 
 	warnLinePrefix := "→ Source and backup directories are on the same drive/share"
@@ -179,7 +176,7 @@ func TestPrintBackupPreflightShowsYubiKeyOKAfterAuthentication(t *testing.T) {
 	stagingPlan := operation.LocalStagingPlan{}
 
 	var sb strings.Builder
-	printBackupPreflightWithYubiKeyCheck(&sb, cfg, backupDir, sources, stagingPlan, func() error { return nil })
+	printBackupPreflightWithYubiKeyCheck(&sb, cfg, []string{backupDir}, sources, stagingPlan, func() error { return nil })
 	output := sb.String()
 
 	authLine := "Authentication: password + YubiKey"
@@ -216,7 +213,7 @@ func TestPrintBackupPreflightShowsYubiKeyWarnAfterAuthentication(t *testing.T) {
 	stagingPlan := operation.LocalStagingPlan{}
 
 	var sb strings.Builder
-	printBackupPreflightWithYubiKeyCheck(&sb, cfg, backupDir, sources, stagingPlan, func() error { return errors.New("no YubiKey detected") })
+	printBackupPreflightWithYubiKeyCheck(&sb, cfg, []string{backupDir}, sources, stagingPlan, func() error { return errors.New("no YubiKey detected") })
 	output := sb.String()
 
 	authLine := "Authentication: password + YubiKey"
@@ -257,7 +254,7 @@ func TestPrintBackupPreflightShowsLocalFreeSpaceWhenStagingEnabled(t *testing.T)
 	stagingPlan := operation.LocalStagingPlan{Enabled: true, SameVolume: true, ResolvedTempDir: localStagingDir}
 
 	var sb strings.Builder
-	printBackupPreflightWithYubiKeyCheck(&sb, cfg, backupDir, sources, stagingPlan, func() error { return nil })
+	printBackupPreflightWithYubiKeyCheck(&sb, cfg, []string{backupDir}, sources, stagingPlan, func() error { return nil })
 	output := sb.String()
 
 	localStagingLine := "Local staging via temp directory enabled, because source directory(s) and backup directory share the same drive"
@@ -293,7 +290,7 @@ func TestPrintBackupPreflightOmitsLocalFreeSpaceWhenStagingDisabled(t *testing.T
 	stagingPlan := operation.LocalStagingPlan{Enabled: false}
 
 	var sb strings.Builder
-	printBackupPreflightWithYubiKeyCheck(&sb, cfg, backupDir, sources, stagingPlan, func() error { return nil })
+	printBackupPreflightWithYubiKeyCheck(&sb, cfg, []string{backupDir}, sources, stagingPlan, func() error { return nil })
 	output := sb.String()
 
 	if strings.Contains(output, "Temp directory:") {
@@ -316,7 +313,7 @@ func TestValidateTargetSpaceForBackupSkipsWhenTargetUnavailable(t *testing.T) {
 	missingTarget := filepath.Join(root, "missing-target")
 	sources := []backupSource{{Resolved: sourceDir}}
 
-	if err := validateTargetSpaceForBackup(missingTarget, sources); err != nil {
+	if err := validateTargetSpaceForBackup([]string{missingTarget}, sources); err != nil {
 		t.Fatalf("expected no error when free space cannot be determined, got: %v", err)
 	}
 }
@@ -383,11 +380,40 @@ func TestValidateTargetSpacePassesWhenSpaceIsSufficient(t *testing.T) {
 	}
 
 	sources := []backupSource{{Resolved: sourceDir}}
-	if err := validateTargetSpaceForBackup(backupDir, sources); err != nil {
+	if err := validateTargetSpaceForBackup([]string{backupDir}, sources); err != nil {
 		t.Fatalf("expected no error when target space is sufficient, got: %v", err)
 	}
 }
 
+func TestValidateTargetSpaceChecksEveryBackupDirectory(t *testing.T) {
+	root := t.TempDir()
+	sourceDir := filepath.Join(root, "source")
+	if err := os.MkdirAll(sourceDir, 0o750); err != nil {
+		t.Fatalf("failed to create source dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "data.bin"), make([]byte, 4096), 0o600); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+	small := util.NewMemoryStorage()
+	small.SetCapacity(1024)
+	t.Cleanup(util.MountStorage("mem://"+t.Name()+"/small", small))
+	t.Cleanup(util.MountStorage("mem://"+t.Name()+"/large", util.NewMemoryStorage()))
+
+	sources := []backupSource{{Resolved: sourceDir}}
+	dirs := []string{"mem://" + t.Name() + "/large", "mem://" + t.Name() + "/small"}
+	err := validateTargetSpaceForBackup(dirs, sources)
+	if err == nil || !strings.Contains(err.Error(), "Backup directory mem://"+t.Name()+"/small: Insufficient free space for backup:") {
+		t.Fatalf("expected the second backup directory to be reported, got %v", err)
+	}
+
+	var sb strings.Builder
+	cfg := &util.Config{SplitSizeMB: 64, LogLevel: "info", AuthenticationMode: util.AuthModePassword}
+	printBackupPreflightWithYubiKeyCheck(&sb, cfg, dirs, sources, operation.LocalStagingPlan{}, func() error { return nil })
+	if !strings.Contains(sb.String(), "Backup directories (each receives a full copy):") || !strings.Contains(sb.String(), "  Free disk space: 1.00 KB") {
+		t.Fatalf("expected every backup directory in the preflight, got %q", sb.String())
+	}
+}
+
 func TestValidateStagingSpaceReturnsErrorWhenTempSpaceInsufficient(t *testing.T) {
 	t.Parallel()
 
@@ -441,7 +467,7 @@ func TestPrintBackupPreflightOrdersSourceBeforeTargetAndPlacesSourceSizeInSource
 	stagingPlan := operation.LocalStagingPlan{Enabled: false}
 
 	var sb strings.Builder
-	printBackupPreflightWithYubiKeyCheck(&sb, cfg, backupDir, sources, stagingPlan, func() error { return nil })
+	printBackupPreflightWithYubiKeyCheck(&sb, cfg, []string{backupDir}, sources, stagingPlan, func() error { return nil })
 	output := sb.String()
 
 	sourceIdx := strings.Index(output, "Source directory(s):")
@@ -0,0 +1,105 @@
+package backup
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/repository"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"fmt"
+	"path/filepath"
+)
+
+// openRepository opens the chunked repository of backupDir for a backup run, creating
+// it on the first run. A new repository records the YubiKey challenge its keys are
+// encrypted with, so later runs derive the same key.
+func openRepository(cfg *util.Config, backupDir string, password []byte, params security.Argon2Params, challengeContent string, log *util.Logger) (*repository.Repository, error) {
+	created := !repository.Exists(backupDir)
+	repo, err := repository.OpenOrCreate(backupDir, password, params, cfg.SplitSizeMB*1024*1024)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open repository: %w", err)
+	}
+	if created && challengeContent != "" {
+		if err := util.WriteStorageFile(repository.ChallengeFilePath(backupDir), []byte(challengeContent)); err != nil {
+			repo.Close() //nolint:errcheck
+			return nil, fmt.Errorf("Failed to write repository challenge file: %w. Remedy: Check write permissions in the backup directory.", err)
+		}
+	}
+	if created {
+		log.Info("Repository created: %s", filepath.ToSlash(repository.Dir(backupDir)))
+	} else {
+		log.Info("Repository: %s (%d chunk(s))", filepath.ToSlash(repository.Dir(backupDir)), repo.ChunkCount())
+	}
+	return repo, nil
+}
+
+// repositoryChallenge returns the YubiKey challenge of an existing repository.
+func repositoryChallenge(backupDir string) (string, bool) {
+	if !repository.Exists(backupDir) {
+		return "", false
+	}
+	challenge, err := operation.ReadChallengeFile(repository.ChallengeFilePath(backupDir))
+	if err != nil {
+		return "", false
+	}
+	return challenge, true
+}
+
+// backupDirectoryToRepository stores the files of srcDir in the repository and writes
+// the snapshot of the backup directory.
+func backupDirectoryToRepository(
+	srcDir, directoryName, backupDir, date string,
+	id util.BackupID,
+	repo *repository.Repository,
+	password []byte,
+	params security.Argon2Params,
+	log *util.Logger,
+) error {
+	entry := util.BackupEntry{DirectoryName: directoryName, Date: date, ID: id}
+	path := util.SnapshotFileName(backupDir, directoryName, date, id)
+
+	before := repo.Stats()
+	if err := repo.SnapshotDirectory(srcDir, directoryName, path, manifest.Header{Backup: entry.String()}, password, params, backupDir); err != nil {
+		return fmt.Errorf("Storing files in the repository failed: %w. Remedy: Check source-directory access, file permissions and free space in the backup directory.", err)
+	}
+	after := repo.Stats()
+	if util.IsRegularFile(srcDir) {
+		// Restore needs to know without the password that the snapshot holds a single file.
+		if err := catalog.WriteRunInfo(backupDir, entry, catalog.RunInfo{Type: catalog.BackupTypeFull, Source: catalog.SourceTypeFile}); err != nil {
+			return err
+		}
+	}
+
+	log.Info("  Deduplication: %d new chunk(s) (%s), %d chunk(s) already in the repository",
+		after.NewChunks-before.NewChunks,
+		util.FormatBytesBinary(uint64(after.StoredBytes-before.StoredBytes)),
+		after.ReusedChunks-before.ReusedChunks)
+	log.Info("  Created: snapshot %s - [%s] successfully backed up", filepath.Base(path), directoryName)
+	return nil
+}
+
+// collectRepositoryGarbage removes repository data that no snapshot uses any more.
+func collectRepositoryGarbage(repo *repository.Repository, password []byte, log *util.Logger) error {
+	stats, err := repo.CollectGarbage(password)
+	if err != nil {
+		return err
+	}
+	log.Info("Repository cleanup finished: removed %d pack file(s) (%d repacked), freed %s", stats.RemovedPacks, stats.RepackedPacks, util.FormatBytesBinary(uint64(max(stats.FreedBytes, 0))))
+	return nil
+}
+
+// countSnapshots returns the number of repository snapshots in backupDir.
+func countSnapshots(backupDir string) int {
+	index, err := catalog.ScanBackups(backupDir)
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, entry := range index {
+		if catalog.IsSnapshot(backupDir, entry) {
+			count++
+		}
+	}
+	return count
+}
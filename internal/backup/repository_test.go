@@ -0,0 +1,91 @@
+package backup
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupDirectoryToRepositoryDeduplicatesAndCollectsGarbage(t *testing.T) {
+	tempRoot := t.TempDir()
+	sourceDir := filepath.Join(tempRoot, "source")
+	backupDir := filepath.Join(tempRoot, "target")
+	for _, dir := range []string{sourceDir, backupDir} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	// b.txt holds most of the first pack, so dropping its first version repacks it.
+	if err := os.WriteFile(filepath.Join(sourceDir, "a.txt"), []byte("same"), 0o600); err != nil {
+		t.Fatalf("failed to write a.txt: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "b.txt"), []byte("first version"), 0o600); err != nil {
+		t.Fatalf("failed to write b.txt: %v", err)
+	}
+
+	password := []byte("pw")
+	cfg := &util.Config{SplitSizeMB: 1, RepositoryFormat: util.RepositoryFormatChunked}
+	log := util.NewConsoleLogger("info")
+	repo, err := openRepository(cfg, backupDir, password, security.DefaultArgon2Params, "", log)
+	if err != nil {
+		t.Fatalf("openRepository failed: %v", err)
+	}
+	defer repo.Close()
+
+	first := util.BackupEntry{DirectoryName: "source", Date: "2026-03-18", ID: util.BackupID("SNP001")}
+	if err := backupDirectoryToRepository(sourceDir, first.DirectoryName, backupDir, first.Date, first.ID, repo, password, security.DefaultArgon2Params, log); err != nil {
+		t.Fatalf("first backup failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "b.txt"), []byte("second version"), 0o600); err != nil {
+		t.Fatalf("failed to change b.txt: %v", err)
+	}
+	newChunksBefore := repo.Stats().NewChunks
+	second := util.BackupEntry{DirectoryName: "source", Date: "2026-03-19", ID: util.BackupID("SNP002")}
+	if err := backupDirectoryToRepository(sourceDir, second.DirectoryName, backupDir, second.Date, second.ID, repo, password, security.DefaultArgon2Params, log); err != nil {
+		t.Fatalf("second backup failed: %v", err)
+	}
+	if added := repo.Stats().NewChunks - newChunksBefore; added != 1 {
+		t.Fatalf("expected only the changed file to add a chunk, got %d", added)
+	}
+
+	index, err := catalog.ScanBackups(backupDir)
+	if err != nil || len(index) != 2 {
+		t.Fatalf("expected both snapshots in the catalog, got %v, %v", index, err)
+	}
+	// Retention orders by modification time; make the first snapshot the older one.
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(util.SnapshotFileName(backupDir, first.DirectoryName, first.Date, first.ID), old, old); err != nil {
+		t.Fatalf("failed to age snapshot: %v", err)
+	}
+
+	if err := applyRetentionPolicy(backupDir, 1, []backupSource{{Resolved: sourceDir}}, log); err != nil {
+		t.Fatalf("applyRetentionPolicy failed: %v", err)
+	}
+	if countSnapshots(backupDir) != 1 {
+		t.Fatalf("expected retention to delete the older snapshot")
+	}
+	chunksBefore := repo.ChunkCount()
+	if err := collectRepositoryGarbage(repo, password, log); err != nil {
+		t.Fatalf("collectRepositoryGarbage failed: %v", err)
+	}
+	if repo.ChunkCount() != chunksBefore-1 {
+		t.Fatalf("expected the chunk of the first version to be removed, %d -> %d chunk(s)", chunksBefore, repo.ChunkCount())
+	}
+
+	entries, ok, err := manifest.LoadForBackup(backupDir, second, password)
+	if err != nil || !ok {
+		t.Fatalf("expected the remaining snapshot to load, ok=%v err=%v", ok, err)
+	}
+	for _, e := range entries {
+		for _, id := range e.Chunks {
+			if _, err := repo.ReadChunk(id); err != nil {
+				t.Fatalf("chunk of %s is no longer readable: %v", e.Path, err)
+			}
+		}
+	}
+}
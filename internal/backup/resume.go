@@ -0,0 +1,663 @@
+package backup
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// errResumeDiverged is returned when a backup set produces other data than the
+// interrupted run stored, so the set cannot be continued.
+var errResumeDiverged = errors.New("the source changed since the run was interrupted")
+
+// runProgress keeps the checkpoint of a run and writes it to the backup directory
+// whenever a backup set or a part of it is complete. A nil *runProgress records
+// nothing; runs with local staging, a chunked repository or a backup directory that
+// fails resumableDirs are not checkpointed.
+type runProgress struct {
+	backupDir string
+	// dirs are the backup directories of the run; backupDir may be a TeeStorage over them.
+	dirs    []string
+	date    string
+	id      util.BackupID
+	resumed bool
+
+	mu         sync.Mutex
+	checkpoint catalog.RunCheckpoint
+}
+
+// newRunProgress returns the progress of run date/id, continuing the checkpoint of
+// resumed when the run is resumed. It returns nil when a backup directory of the
+// run cannot be resumed safely; see resumableDirs.
+func newRunProgress(targets *backupTargets, date string, id util.BackupID, resumed *catalog.ResumableRun) *runProgress {
+	if !resumableDirs(targets.Healthy()) {
+		return nil
+	}
+	p := &runProgress{backupDir: targets.Dir, dirs: targets.Healthy(), date: date, id: id}
+	if resumed != nil {
+		p.resumed = true
+		p.checkpoint = resumed.Checkpoint
+	}
+	return p
+}
+
+// isCompleted reports whether backup set name was completed by the interrupted run.
+func (p *runProgress) isCompleted(name string) bool {
+	if p == nil || !p.resumed {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.checkpoint.IsCompleted(name)
+}
+
+// setCurrent records the progress of the backup set being written.
+func (p *runProgress) setCurrent(current *catalog.SetCheckpoint) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.checkpoint.Current = current
+	return catalog.WriteCheckpoint(p.backupDir, p.date, p.id, p.checkpoint)
+}
+
+// complete records that backup set name is complete.
+func (p *runProgress) complete(name string) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.checkpoint.IsCompleted(name) {
+		p.checkpoint.Completed = append(p.checkpoint.Completed, name)
+	}
+	p.checkpoint.Current = nil
+	return catalog.WriteCheckpoint(p.backupDir, p.date, p.id, p.checkpoint)
+}
+
+// startFresh prepares entry to be written from the start. In a resumed run, the
+// part files and the manifest the interrupted run left of the set are deleted first.
+func (p *runProgress) startFresh(entry util.BackupEntry) error {
+	if p == nil {
+		return nil
+	}
+	if p.resumed {
+		if err := p.removeManifest(entry); err != nil {
+			return err
+		}
+		for _, dir := range p.dirs {
+			files, err := listSetParts(dir, entry)
+			if err != nil {
+				return err
+			}
+			for _, names := range files {
+				if err := removeFiles(dir, names); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return p.setCurrent(nil)
+}
+
+// resumeSet returns the resume point of entry when the interrupted run was writing
+// it, or nil when the set is written from the start. parent is the backup entry an
+// incremental set is based on now; a set based on another parent is not resumed.
+func (p *runProgress) resumeSet(entry util.BackupEntry, parent string, password []byte, log *util.Logger) (*setResume, error) {
+	if p == nil || !p.resumed {
+		return nil, nil
+	}
+	p.mu.Lock()
+	current := p.checkpoint.Current
+	p.mu.Unlock()
+	if current == nil || current.Name != entry.DirectoryName {
+		return nil, nil
+	}
+	if current.Parent != parent {
+		log.Info("  Cannot resume [%s]: its incremental base changed. It is backed up from the start.", entry.DirectoryName)
+		return nil, nil
+	}
+	if !resumableDirs(p.dirs) {
+		log.Info("  Cannot resume [%s]: unfinished uploads to the backup directory cannot be read back. It is backed up from the start with a new key.", entry.DirectoryName)
+		return nil, nil
+	}
+	resume, err := openSetResume(p.backupDir, p.dirs, entry, *current, password)
+	if errors.Is(err, security.ErrWrongPassword) {
+		return nil, fmt.Errorf("The password does not match the interrupted run %s_%s. Remedy: Enter the password the run was started with, or start a new backup run.", p.date, string(p.id))
+	}
+	if err != nil {
+		log.Info("  Cannot resume [%s]: %v. It is backed up from the start.", entry.DirectoryName, err)
+		return nil, nil
+	}
+	// The manifest is written again from the whole TAR stream.
+	if err := p.removeManifest(entry); err != nil {
+		resume.close()
+		return nil, err
+	}
+	return resume, nil
+}
+
+// removeManifest deletes the manifest the interrupted run left unfinished.
+func (p *runProgress) removeManifest(entry util.BackupEntry) error {
+	path := util.ManifestFileName(p.backupDir, entry.DirectoryName, entry.Date, entry.ID)
+	if err := util.StorageFor(path).Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to delete unfinished manifest %q: %w. Remedy: Check delete permissions in the backup directory.", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// resumableDirs reports whether a set written to dirs can be resumed. A resumed set
+// continues with the key and chunk nonces of the interrupted one, so every byte it
+// encrypts again must be compared with what the interrupted run stored; only local
+// directories keep an unfinished part readable under its partial name. Storages
+// that complete files atomically, such as S3, SFTP and WebDAV, may hold the bytes
+// of an interrupted upload out of sight, and encrypting other data under the same
+// nonces would reuse them. Sets in these directories start over with a new salt.
+func resumableDirs(dirs []string) bool {
+	for _, dir := range dirs {
+		s := util.StorageFor(dir)
+		if a, ok := s.(util.AtomicStorage); ok && a.CreatesAtomically() {
+			return false
+		}
+		if _, ok := s.(util.ReopenStorage); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// partsAlign reports whether parts of splitSizeMB can end at chunk boundaries of
+// the encrypted stream, which resuming requires.
+func partsAlign(splitSizeMB int64) bool {
+	layout := security.Layout()
+	return splitSizeMB*1024*1024-layout.HeaderSize >= layout.FrameSize
+}
+
+// setResume is the point a backup set of an interrupted run continues from.
+type setResume struct {
+	catalog.SetCheckpoint
+	// paths are the finished parts.
+	paths   []string
+	resumer *security.Resumer
+	// remnants hold, per backup directory, the bytes the interrupted run stored
+	// after the finished parts. The resumed set must write the same bytes again,
+	// since they were encrypted with the nonces it continues with.
+	remnants []io.Reader
+	files    []util.StorageFile
+	// remnantPaths are deleted once the set is complete.
+	remnantPaths []string
+}
+
+// openSetResume checks that the finished parts of checkpoint are present in every
+// backup directory, keeps the unfinished parts after them as remnants, and derives
+// the key of the encrypted stream from its first part.
+func openSetResume(backupDir string, dirs []string, entry util.BackupEntry, checkpoint catalog.SetCheckpoint, password []byte) (*setResume, error) {
+	if checkpoint.Parts < 1 {
+		return nil, fmt.Errorf("no finished part")
+	}
+	r := &setResume{SetCheckpoint: checkpoint}
+	for _, dir := range dirs {
+		if err := checkFinishedParts(dir, entry, checkpoint); err != nil {
+			return nil, err
+		}
+	}
+	for seq := 1; seq <= checkpoint.Parts; seq++ {
+		r.paths = append(r.paths, util.PartFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID, seq))
+	}
+
+	first, err := util.StorageFor(r.paths[0]).Open(r.paths[0])
+	if err != nil {
+		return nil, err
+	}
+	r.resumer, err = security.NewResumer(first, password)
+	first.Close() //nolint:errcheck
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range dirs {
+		if err := r.openRemnants(dir, entry); err != nil {
+			r.close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// checkFinishedParts checks that the finished parts of checkpoint are complete in dir.
+func checkFinishedParts(dir string, entry util.BackupEntry, checkpoint catalog.SetCheckpoint) error {
+	var total int64
+	for seq := 1; seq <= checkpoint.Parts; seq++ {
+		path := util.PartFileName(dir, entry.DirectoryName, entry.Date, entry.ID, seq)
+		info, err := util.StorageFor(path).Stat(path)
+		if err != nil {
+			return fmt.Errorf("part %03d is missing in %s", seq, filepath.ToSlash(dir))
+		}
+		total += info.Size()
+	}
+	if total != checkpoint.StreamBytes {
+		return fmt.Errorf("the finished parts in %s hold %d bytes instead of %d", filepath.ToSlash(dir), total, checkpoint.StreamBytes)
+	}
+	return nil
+}
+
+// openRemnants keeps the files of the parts after the finished ones in dir under
+// their remnant names and opens them in order. Of several files of one part, the
+// largest is kept: every attempt wrote the same bytes as the ones before it.
+func (r *setResume) openRemnants(dir string, entry util.BackupEntry) error {
+	files, err := listSetParts(dir, entry)
+	if err != nil {
+		return err
+	}
+	var readers []io.Reader
+	seq := r.Parts + 1
+	for ; len(files[seq]) > 0; seq++ {
+		keep, err := largestFile(dir, files[seq])
+		if err != nil {
+			return err
+		}
+		remnant := util.RemnantFileName(util.PartFileName(dir, entry.DirectoryName, entry.Date, entry.ID, seq))
+		var others []string
+		for _, name := range files[seq] {
+			if name != keep {
+				others = append(others, name)
+			}
+		}
+		if err := removeFiles(dir, others); err != nil {
+			return err
+		}
+		if kept := filepath.Join(dir, keep); kept != remnant {
+			if err := util.StorageFor(kept).Rename(kept, remnant); err != nil {
+				return fmt.Errorf("Failed to keep unfinished part %q: %w", keep, err)
+			}
+		}
+		f, err := util.StorageFor(remnant).Open(remnant)
+		if err != nil {
+			return err
+		}
+		r.files = append(r.files, f)
+		r.remnantPaths = append(r.remnantPaths, remnant)
+		readers = append(readers, f)
+	}
+	// Files of finished parts other than the parts themselves, and files after a
+	// gap, were never read as part of the stream.
+	for other, names := range files {
+		if other > r.Parts && other < seq {
+			continue
+		}
+		var stale []string
+		for _, name := range names {
+			if _, _, ok := util.ParsePartFileName(name); !ok || other >= seq {
+				stale = append(stale, name)
+			}
+		}
+		if err := removeFiles(dir, stale); err != nil {
+			return err
+		}
+	}
+	if len(readers) > 0 {
+		r.remnants = append(r.remnants, io.MultiReader(readers...))
+	}
+	return nil
+}
+
+// close closes the remnant files.
+func (r *setResume) close() {
+	if r == nil {
+		return
+	}
+	for _, f := range r.files {
+		f.Close() //nolint:errcheck
+	}
+	r.files = nil
+}
+
+// removeRemnants deletes the remnant files once the set has been written past them.
+func (r *setResume) removeRemnants() error {
+	r.close()
+	for _, path := range r.remnantPaths {
+		if err := util.StorageFor(path).Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to delete unfinished part %q: %w. Remedy: Check delete permissions in the backup directory.", filepath.Base(path), err)
+		}
+	}
+	return nil
+}
+
+// listSetParts returns the names of the part files of entry in dir by part
+// number, including unfinished parts and remnants.
+func listSetParts(dir string, entry util.BackupEntry) (map[int][]string, error) {
+	des, err := util.StorageFor(dir).List(dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[int][]string)
+	for _, de := range des {
+		name := de.Name()
+		if e, seq, ok := util.ParsePartFileName(unfinishedPartName(name)); ok && e == entry {
+			files[seq] = append(files[seq], name)
+		}
+	}
+	return files, nil
+}
+
+// unfinishedPartName returns the name of the part an unfinished file belongs to:
+// a .partial or .remnant file, or the hidden temporary file an interrupted upload
+// to SFTP or WebDAV leaves behind (".[name].[random].tmp").
+func unfinishedPartName(name string) string {
+	if strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".tmp") {
+		temp := strings.TrimSuffix(strings.TrimPrefix(name, "."), ".tmp")
+		if i := strings.LastIndex(temp, "."); i > 0 {
+			return temp[:i]
+		}
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(name, util.PartialFileSuffix), util.RemnantFileSuffix)
+}
+
+func largestFile(dir string, names []string) (string, error) {
+	largest, size := "", int64(-1)
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		info, err := util.StorageFor(path).Stat(path)
+		if err != nil {
+			return "", err
+		}
+		if info.Size() > size {
+			largest, size = name, info.Size()
+		}
+	}
+	return largest, nil
+}
+
+func removeFiles(dir string, names []string) error {
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		if err := util.StorageFor(path).Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to delete %q: %w. Remedy: Check delete permissions in the backup directory.", name, err)
+		}
+	}
+	return nil
+}
+
+// remnantVerifier passes the encrypted stream of a resumed set on to w after
+// checking it against the remnants. A byte that differs from a stored one is
+// never written; the write fails with errResumeDiverged instead.
+type remnantVerifier struct {
+	w        io.Writer
+	remnants []io.Reader
+	buf      []byte
+}
+
+func (v *remnantVerifier) Write(p []byte) (int, error) {
+	for i, remnant := range v.remnants {
+		if remnant == nil {
+			continue
+		}
+		if cap(v.buf) < len(p) {
+			v.buf = make([]byte, len(p))
+		}
+		stored := v.buf[:len(p)]
+		n, err := io.ReadFull(remnant, stored)
+		if !bytes.Equal(stored[:n], p[:n]) {
+			return 0, errResumeDiverged
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			v.remnants[i] = nil
+		} else if err != nil {
+			return 0, fmt.Errorf("Failed to read unfinished part: %w", err)
+		}
+	}
+	return v.w.Write(p)
+}
+
+// plaintextTracker follows the TAR stream read by the encryption stage. It keeps
+// the SHA-256 state at every chunk boundary and the entries written so far, so a
+// checkpoint can be taken whenever a part ends at a chunk boundary.
+type plaintextTracker struct {
+	r         io.Reader
+	chunkSize int64
+
+	mu     sync.Mutex
+	hash   hash.Hash
+	pos    int64
+	states map[uint64][]byte
+	// entries are the offsets and names of the entries not counted by a checkpoint yet.
+	entries       []trackedEntry
+	files         int
+	lastFile      string
+	checkpointErr error
+}
+
+type trackedEntry struct {
+	offset int64
+	name   string
+}
+
+func newPlaintextTracker(r io.Reader, chunkSize int64) *plaintextTracker {
+	return &plaintextTracker{r: r, chunkSize: chunkSize, hash: sha256.New(), states: make(map[uint64][]byte)}
+}
+
+// Read implements io.Reader.
+func (t *plaintextTracker) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	data := p[:n]
+	for len(data) > 0 {
+		k := t.chunkSize - t.pos%t.chunkSize
+		if k > int64(len(data)) {
+			k = int64(len(data))
+		}
+		t.hash.Write(data[:k]) //nolint:errcheck
+		t.pos += k
+		data = data[k:]
+		if t.pos%t.chunkSize == 0 {
+			state, stateErr := t.hash.(encoding.BinaryMarshaler).MarshalBinary()
+			if stateErr != nil {
+				return n, stateErr
+			}
+			t.states[uint64(t.pos/t.chunkSize)] = state
+		}
+	}
+	return n, err
+}
+
+// addEntry records a TAR entry written by the producer.
+func (t *plaintextTracker) addEntry(e util.TarEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, trackedEntry{offset: e.HeaderOffset, name: e.Header.Name})
+}
+
+// skip reads the first n bytes of the stream, which the finished parts already hold.
+func (t *plaintextTracker) skip(n int64) error {
+	copied, err := io.CopyN(io.Discard, t, n)
+	if copied < n {
+		if err == nil || errors.Is(err, io.EOF) {
+			return errResumeDiverged
+		}
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for index := range t.states {
+		if index < uint64(n/t.chunkSize) {
+			delete(t.states, index)
+		}
+	}
+	return nil
+}
+
+// sum returns the hex SHA-256 of the stream before chunk index chunks.
+func (t *plaintextTracker) sum(chunks uint64) string {
+	t.mu.Lock()
+	state, ok := t.states[chunks]
+	t.mu.Unlock()
+	if !ok {
+		return ""
+	}
+	h := sha256.New()
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// checkpoint returns the progress after the first streamBytes bytes of the
+// encrypted stream. ok is false when they do not end at a chunk boundary.
+func (t *plaintextTracker) checkpoint(layout security.StreamLayout, streamBytes int64) (catalog.SetCheckpoint, bool) {
+	frames := streamBytes - layout.HeaderSize
+	if frames <= 0 || frames%layout.FrameSize != 0 {
+		return catalog.SetCheckpoint{}, false
+	}
+	chunks := uint64(frames / layout.FrameSize)
+	sum := t.sum(chunks)
+	if sum == "" {
+		return catalog.SetCheckpoint{}, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for index := range t.states {
+		if index <= chunks {
+			delete(t.states, index)
+		}
+	}
+	offset := int64(chunks) * t.chunkSize
+	counted := 0
+	for _, e := range t.entries {
+		if e.offset >= offset {
+			break
+		}
+		t.files++
+		t.lastFile = e.name
+		counted++
+	}
+	t.entries = t.entries[counted:]
+	return catalog.SetCheckpoint{
+		StreamBytes: streamBytes,
+		Chunks:      chunks,
+		TarOffset:   offset,
+		TarSHA256:   sum,
+		Files:       t.files,
+		LastFile:    t.lastFile,
+	}, true
+}
+
+// runTrackedEncryptStage is runEncryptStage for a set whose progress is
+// checkpointed: the TAR stream is read through tracker. A resumed set skips the
+// part of the stream its finished parts hold and continues their encrypted stream.
+func runTrackedEncryptStage(log *util.Logger, bw io.Writer, pr *io.PipeReader, tracker *plaintextTracker, password []byte, params security.Argon2Params, resume *setResume, counters *backupCounters) error {
+	defer pr.Close() //nolint:errcheck
+	dst := &operation.CountingWriter{W: bw, Total: &counters.outBytes, Calls: &counters.outWriteCalls}
+	if resume == nil {
+		log.Debug("Starting encryption...")
+		return security.Encrypt(dst, &operation.CountingReader{R: tracker, Total: &counters.inBytes}, password, params)
+	}
+
+	log.Debug("Reading the TAR stream up to the checkpoint...")
+	if err := tracker.skip(resume.TarOffset); err != nil {
+		return err
+	}
+	if tracker.sum(resume.Chunks) != resume.TarSHA256 {
+		return errResumeDiverged
+	}
+	log.Debug("Resuming encryption at chunk %d...", resume.Chunks)
+	verifier := &remnantVerifier{w: dst, remnants: resume.remnants}
+	return resume.resumer.Encrypt(verifier, &operation.CountingReader{R: tracker, Total: &counters.inBytes}, resume.Chunks)
+}
+
+// selectRunToResume returns the interrupted run to resume, or nil to start a new
+// run. With resumeID set, that run must be resumable; otherwise the newest
+// resumable run in the first backup directory is offered. Runs spanning removable
+// media are not resumed, as their earlier volumes are no longer inserted, and
+// neither are runs in backup directories that fail resumableDirs.
+func selectRunToResume(cfg *util.Config, exeDir, resumeID string) (*catalog.ResumableRun, error) {
+	if cfg.Spanning.Enabled {
+		if resumeID != "" {
+			return nil, fmt.Errorf("A backup spanning removable media cannot be resumed, as its earlier volumes are no longer inserted. Remedy: Omit -resume to start a new run.")
+		}
+		return nil, nil
+	}
+	var dirs []string
+	for _, dest := range cfg.BackupDestinations() {
+		dirs = append(dirs, util.ResolveDir(dest, exeDir))
+	}
+	if !resumableDirs(dirs) {
+		if resumeID != "" {
+			return nil, fmt.Errorf("Backup runs in an S3, SFTP or WebDAV backup directory cannot be resumed, as an interrupted upload cannot be read back. Remedy: Omit -resume to start a new run.")
+		}
+		return nil, nil
+	}
+	dir := dirs[0]
+	runs, err := catalog.FindResumableRuns(dir)
+	if resumeID != "" {
+		if err != nil {
+			return nil, fmt.Errorf("Failed to scan the backup directory for interrupted runs: %w. Remedy: Check read permissions in the backup directory.", err)
+		}
+		for i := range runs {
+			if string(runs[i].ID) == resumeID {
+				return &runs[i], nil
+			}
+		}
+		return nil, fmt.Errorf("No interrupted backup run with ID %q can be resumed in %s. Remedy: Pass the ID of an incomplete run that has a checkpoint (YYYY-MM-DD_ID.checkpoint), or omit -resume to start a new run.", resumeID, filepath.ToSlash(dir))
+	}
+	// A backup directory that cannot be scanned has no run to offer; opening it for
+	// the new run reports the problem.
+	if err != nil || len(runs) == 0 || cfg.RepositoryFormat == util.RepositoryFormatChunked {
+		return nil, nil
+	}
+
+	run := runs[len(runs)-1]
+	fmt.Println()
+	fmt.Printf("Interrupted backup run found: %s (%s)\n", run.String(), describeCheckpoint(run.Checkpoint))
+	confirmed, err := operation.PromptConfirm("Resume it instead of starting a new run?")
+	if err != nil || !confirmed {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// describeCheckpoint summarizes the progress recorded in checkpoint.
+func describeCheckpoint(checkpoint catalog.RunCheckpoint) string {
+	desc := fmt.Sprintf("%d backup set(s) complete", len(checkpoint.Completed))
+	if current := checkpoint.Current; current != nil {
+		desc += fmt.Sprintf(", [%s] at part %03d after %d file(s)", current.Name, current.Parts, current.Files)
+	}
+	return desc
+}
+
+// readResumePassword asks for the password of resumed and verifies it with a
+// finished part of the run. With a YubiKey, the run's challenge is used again, so
+// the resumed sets are encrypted with the key of the interrupted run.
+func readResumePassword(backupDir string, resumed *catalog.ResumableRun, log *util.Logger) ([]byte, string, error) {
+	rep := util.BackupEntry{Date: resumed.Date, ID: resumed.ID}
+	if len(resumed.Entries) > 0 {
+		rep = resumed.Entries[0]
+	}
+	password, err := operation.ReadPasswordWithRetry(backupDir, rep, "Enter backup password: ", log)
+	if err != nil {
+		return nil, "", err
+	}
+	challengeHex := ""
+	if path, found, err := catalog.FindChallengeFileForRun(backupDir, resumed.Date, resumed.ID); err == nil && found {
+		if challengeHex, err = operation.ReadChallengeFile(path); err != nil {
+			security.ZeroBytes(password)
+			return nil, "", err
+		}
+	}
+	return password, challengeHex, nil
+}
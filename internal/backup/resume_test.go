@@ -0,0 +1,282 @@
+package backup
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeResumeSource writes a source directory whose TAR stream spans three
+// encrypted chunks, so parts of 9 MB hold one chunk each.
+func writeResumeSource(t *testing.T, sourceDir string) {
+	t.Helper()
+	if err := os.MkdirAll(sourceDir, 0o750); err != nil {
+		t.Fatalf("failed to create source dir: %v", err)
+	}
+	for name, size := range map[string]int{"a.bin": 12 << 20, "b.bin": 9 << 20} {
+		data := make([]byte, size)
+		for i := range data {
+			data[i] = byte(i*7 + len(name))
+		}
+		if err := os.WriteFile(filepath.Join(sourceDir, name), data, 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
+
+// interruptAfterCheckpoint turns the parts after the checkpoint of the run into
+// what an interruption leaves behind: half of the next part under its partial name.
+func interruptAfterCheckpoint(t *testing.T, backupDir string, entry util.BackupEntry) catalog.RunCheckpoint {
+	t.Helper()
+	checkpoint, found, err := catalog.ReadCheckpoint(backupDir, entry.Date, entry.ID)
+	if err != nil || !found || checkpoint.Current == nil {
+		t.Fatalf("expected a checkpoint of the set, got %+v, %v, %v", checkpoint, found, err)
+	}
+	if checkpoint.Current.Parts != 2 {
+		t.Fatalf("expected the checkpoint after part 002, got part %03d", checkpoint.Current.Parts)
+	}
+	next := util.PartFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID, 3)
+	data, err := os.ReadFile(next)
+	if err != nil {
+		t.Fatalf("failed to read part 003: %v", err)
+	}
+	if err := os.Remove(next); err != nil {
+		t.Fatalf("failed to remove part 003: %v", err)
+	}
+	if err := os.WriteFile(util.PartialFileName(next), data[:len(data)/2], 0o600); err != nil {
+		t.Fatalf("failed to write unfinished part: %v", err)
+	}
+	return checkpoint
+}
+
+func readParts(t *testing.T, backupDir string, entry util.BackupEntry) [][]byte {
+	t.Helper()
+	paths, err := catalog.CollectParts(backupDir, entry)
+	if err != nil {
+		t.Fatalf("CollectParts returned error: %v", err)
+	}
+	var parts [][]byte
+	for _, path := range paths {
+		data, err := util.ReadStorageFile(path)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", path, err)
+		}
+		parts = append(parts, data)
+	}
+	return parts
+}
+
+func assertNoUnfinishedParts(t *testing.T, backupDir string) {
+	t.Helper()
+	des, err := os.ReadDir(backupDir)
+	if err != nil {
+		t.Fatalf("failed to list backup dir: %v", err)
+	}
+	for _, de := range des {
+		if strings.HasSuffix(de.Name(), util.PartialFileSuffix) || strings.HasSuffix(de.Name(), util.RemnantFileSuffix) {
+			t.Fatalf("unexpected unfinished part left behind: %s", de.Name())
+		}
+	}
+}
+
+func TestBackupDirectoryResumesAfterLastFinishedPart(t *testing.T) {
+	tempRoot := t.TempDir()
+	sourceDir := filepath.Join(tempRoot, "Data")
+	backupDir := filepath.Join(tempRoot, "target")
+	writeResumeSource(t, sourceDir)
+	if err := os.MkdirAll(backupDir, 0o750); err != nil {
+		t.Fatalf("failed to create backup dir: %v", err)
+	}
+
+	entry := util.BackupEntry{DirectoryName: "Data", Date: "2026-10-19", ID: util.BackupID("RES123")}
+	cfg := &util.Config{SplitSizeMB: 9}
+	password := []byte("pw")
+	params := security.Argon2Params{Time: 1, MemoryKB: 8 * 1024, Threads: 1}
+	log := util.NewConsoleLogger("error")
+
+	progress := &runProgress{backupDir: backupDir, dirs: []string{backupDir}, date: entry.Date, id: entry.ID}
+	if _, err := backupDirectoryWithProgress(sourceDir, entry.DirectoryName, backupDir, entry.Date, entry.ID, password, params, nil, cfg, log, progress); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	original := readParts(t, backupDir, entry)
+	if len(original) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(original))
+	}
+
+	checkpoint := interruptAfterCheckpoint(t, backupDir, entry)
+	resumed := &runProgress{backupDir: backupDir, dirs: []string{backupDir}, date: entry.Date, id: entry.ID, resumed: true, checkpoint: checkpoint}
+	if _, err := backupDirectoryWithProgress(sourceDir, entry.DirectoryName, backupDir, entry.Date, entry.ID, password, params, nil, cfg, log, resumed); err != nil {
+		t.Fatalf("resumed backup failed: %v", err)
+	}
+
+	// The same key and nonces over the same data give the same parts.
+	parts := readParts(t, backupDir, entry)
+	if len(parts) != len(original) {
+		t.Fatalf("expected %d parts after resume, got %d", len(original), len(parts))
+	}
+	for i := range parts {
+		if !bytes.Equal(parts[i], original[i]) {
+			t.Fatalf("part %03d differs from the uninterrupted backup", i+1)
+		}
+	}
+	assertNoUnfinishedParts(t, backupDir)
+}
+
+func TestBackupDirectoryStartsOverWhenSourceChangedAfterInterruption(t *testing.T) {
+	tempRoot := t.TempDir()
+	sourceDir := filepath.Join(tempRoot, "Data")
+	backupDir := filepath.Join(tempRoot, "target")
+	writeResumeSource(t, sourceDir)
+	if err := os.MkdirAll(backupDir, 0o750); err != nil {
+		t.Fatalf("failed to create backup dir: %v", err)
+	}
+
+	entry := util.BackupEntry{DirectoryName: "Data", Date: "2026-10-19", ID: util.BackupID("RES124")}
+	cfg := &util.Config{SplitSizeMB: 9}
+	password := []byte("pw")
+	params := security.Argon2Params{Time: 1, MemoryKB: 8 * 1024, Threads: 1}
+	log := util.NewConsoleLogger("error")
+
+	progress := &runProgress{backupDir: backupDir, dirs: []string{backupDir}, date: entry.Date, id: entry.ID}
+	if _, err := backupDirectoryWithProgress(sourceDir, entry.DirectoryName, backupDir, entry.Date, entry.ID, password, params, nil, cfg, log, progress); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	original := readParts(t, backupDir, entry)
+	checkpoint := interruptAfterCheckpoint(t, backupDir, entry)
+
+	// Only b.bin changes after the checkpoint: the TAR stream up to the checkpoint
+	// matches, but the unfinished part holds other data. The checkpoint is at 16 MB
+	// of the TAR stream, b.bin starts at 12 MB + 1 KB and the unfinished part holds
+	// the next 2.5 MB or so.
+	bPath := filepath.Join(sourceDir, "b.bin")
+	info, err := os.Stat(bPath)
+	if err != nil {
+		t.Fatalf("failed to inspect source file: %v", err)
+	}
+	changed, err := os.ReadFile(bPath)
+	if err != nil {
+		t.Fatalf("failed to read source file: %v", err)
+	}
+	copy(changed[5<<20:], bytes.Repeat([]byte("x"), 1024))
+	if err := os.WriteFile(bPath, changed, 0o600); err != nil {
+		t.Fatalf("failed to change source file: %v", err)
+	}
+	if err := os.Chtimes(bPath, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("failed to keep modification time: %v", err)
+	}
+	resumed := &runProgress{backupDir: backupDir, dirs: []string{backupDir}, date: entry.Date, id: entry.ID, resumed: true, checkpoint: checkpoint}
+	if _, err := backupDirectoryWithProgress(sourceDir, entry.DirectoryName, backupDir, entry.Date, entry.ID, password, params, nil, cfg, log, resumed); err != nil {
+		t.Fatalf("resumed backup failed: %v", err)
+	}
+
+	parts := readParts(t, backupDir, entry)
+	if bytes.Equal(parts[0][:security.Layout().HeaderSize], original[0][:security.Layout().HeaderSize]) {
+		t.Fatalf("expected the set to start over with a new salt")
+	}
+	assertNoUnfinishedParts(t, backupDir)
+
+	var plaintext bytes.Buffer
+	if err := security.Decrypt(&plaintext, bytes.NewReader(bytes.Join(parts, nil)), password); err != nil {
+		t.Fatalf("Decrypt returned error: %v", err)
+	}
+	tr := tar.NewReader(&plaintext)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			t.Fatalf("b.bin not found in the archive")
+		}
+		if err != nil {
+			t.Fatalf("reading archive failed: %v", err)
+		}
+		if hdr.Name != "b.bin" {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil || !bytes.Equal(data, changed) {
+			t.Fatalf("expected the changed content of b.bin, got %d bytes, %v", len(data), err)
+		}
+		return
+	}
+}
+
+// uploadStorage is a MemoryStorage that completes files atomically like S3, SFTP or
+// WebDAV: the bytes of an upload that was never committed cannot be listed or read.
+type uploadStorage struct {
+	*util.MemoryStorage
+}
+
+func (uploadStorage) CreatesAtomically() bool { return true }
+
+func TestBackupDirectoryStartsOverWithNewKeyWhenUnfinishedUploadsAreInvisible(t *testing.T) {
+	tempRoot := t.TempDir()
+	sourceDir := filepath.Join(tempRoot, "Data")
+	writeResumeSource(t, sourceDir)
+	backupDir := "mem://" + t.Name()
+	t.Cleanup(util.MountStorage(backupDir, uploadStorage{util.NewMemoryStorage()}))
+	if err := util.StorageFor(backupDir).MkdirAll(backupDir); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+
+	entry := util.BackupEntry{DirectoryName: "Data", Date: "2026-10-19", ID: util.BackupID("UPL123")}
+	cfg := &util.Config{SplitSizeMB: 9}
+	password := []byte("pw")
+	params := security.Argon2Params{Time: 1, MemoryKB: 8 * 1024, Threads: 1}
+	log := util.NewConsoleLogger("error")
+
+	// Runs in such a backup directory are not checkpointed.
+	if p := newRunProgress(&backupTargets{Dir: backupDir, Dirs: []string{backupDir}}, entry.Date, entry.ID, nil); p != nil {
+		t.Fatal("expected no checkpoint for a backup directory that completes files atomically")
+	}
+
+	// A checkpoint left there anyway must not make the set continue with the key of
+	// its finished parts: the interrupted upload of part 003 may be stored out of
+	// sight, encrypted with the nonces the set would continue with.
+	progress := &runProgress{backupDir: backupDir, dirs: []string{backupDir}, date: entry.Date, id: entry.ID}
+	if _, err := backupDirectoryWithProgress(sourceDir, entry.DirectoryName, backupDir, entry.Date, entry.ID, password, params, nil, cfg, log, progress); err != nil {
+		t.Fatalf("backup failed: %v", err)
+	}
+	original := readParts(t, backupDir, entry)
+	checkpoint, found, err := catalog.ReadCheckpoint(backupDir, entry.Date, entry.ID)
+	if err != nil || !found || checkpoint.Current == nil || checkpoint.Current.Parts != 2 {
+		t.Fatalf("expected a checkpoint after part 002, got %+v, %v, %v", checkpoint, found, err)
+	}
+	uncommitted := util.PartFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID, 3)
+	if err := util.StorageFor(uncommitted).Remove(uncommitted); err != nil {
+		t.Fatalf("failed to remove part 003: %v", err)
+	}
+
+	resumed := &runProgress{backupDir: backupDir, dirs: []string{backupDir}, date: entry.Date, id: entry.ID, resumed: true, checkpoint: checkpoint}
+	if _, err := backupDirectoryWithProgress(sourceDir, entry.DirectoryName, backupDir, entry.Date, entry.ID, password, params, nil, cfg, log, resumed); err != nil {
+		t.Fatalf("resumed backup failed: %v", err)
+	}
+	parts := readParts(t, backupDir, entry)
+	if len(parts) != len(original) {
+		t.Fatalf("expected %d parts, got %d", len(original), len(parts))
+	}
+	// A new salt gives a new key, so no chunk nonce is used twice under one key.
+	headerSize := security.Layout().HeaderSize
+	if bytes.Equal(parts[0][:headerSize], original[0][:headerSize]) {
+		t.Fatal("expected the set to start over with a new salt and key")
+	}
+	for i := range parts {
+		if bytes.Equal(parts[i], original[i]) {
+			t.Fatalf("part %03d was written again with the key of the interrupted run", i+1)
+		}
+	}
+}
+
+func TestUnfinishedPartNameRecognizesUploadTempFiles(t *testing.T) {
+	part := "Data_2026-10-19_RES125-003.enc"
+	for _, name := range []string{part, part + util.PartialFileSuffix, part + util.RemnantFileSuffix, "." + part + ".9f3a1c.tmp"} {
+		if got := unfinishedPartName(name); got != part {
+			t.Fatalf("unfinishedPartName(%q) = %q, want %q", name, got, part)
+		}
+	}
+}
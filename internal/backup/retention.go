@@ -11,7 +11,9 @@ import (
 	"time"
 )
 
-var logFilePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})_([A-Z0-9]{6})\.log$`)
+// logFilePattern matches the log file of a run, its run markers and its checkpoint,
+// which are all removed once no backup set of the run is left.
+var logFilePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})_([A-Z0-9]{6})\.(log|incomplete|complete|checkpoint)$`)
 
 func applyRetentionPolicy(backupDir string, retentionKeep int, sources []backupSource, log *util.Logger) error {
 	if retentionKeep <= 0 {
@@ -49,7 +51,7 @@ func applyRetentionPolicy(backupDir string, retentionKeep int, sources []backupS
 		if !directorySet[entry.DirectoryName] {
 			continue
 		}
-		newestTime, err := catalog.NewestPartModTime(backupDir, entry)
+		newestTime, err := catalog.BackupTime(backupDir, entry)
 		if err != nil {
 			log.Warn("Retention cleanup skipped: failed to inspect backup set %s (%v)", entry.String(), err)
 			log.Warn("No retention cleanup was performed to avoid deleting backups based on incomplete metadata.")
@@ -77,8 +79,23 @@ func applyRetentionPolicy(backupDir string, retentionKeep int, sources []backupS
 			continue
 		}
 
+		retained := make([]util.BackupEntry, 0, retentionKeep)
+		for _, kept := range entries[:retentionKeep] {
+			retained = append(retained, kept.entry)
+		}
+		needed, err := parentsOf(backupDir, retained)
+		if err != nil {
+			log.Warn("Retention cleanup skipped: failed to read backup chains of %s (%v)", directoryName, err)
+			log.Warn("No retention cleanup was performed to avoid deleting a backup that an incremental backup still needs.")
+			return nil
+		}
+
 		toDelete := entries[retentionKeep:]
 		for _, candidate := range toDelete {
+			if child, ok := needed[candidate.entry]; ok {
+				log.Info("Retention [%s]: keeping %s, still needed by incremental backup %s", directoryName, candidate.entry.String(), child.String())
+				continue
+			}
 			removed, err := deleteBackupEntryFiles(backupDir, candidate.entry)
 			if err != nil {
 				return fmt.Errorf("Failed to delete old backup set %s: %w. Remedy: Check delete permissions in the backup directory.", candidate.entry.String(), err)
@@ -98,6 +115,31 @@ func applyRetentionPolicy(backupDir string, retentionKeep int, sources []backupS
 	return nil
 }
 
+// parentsOf returns every backup that one of retained depends on, mapped to the
+// retained backup that needs it.
+func parentsOf(backupDir string, retained []util.BackupEntry) (map[util.BackupEntry]util.BackupEntry, error) {
+	needed := make(map[util.BackupEntry]util.BackupEntry)
+	for _, child := range retained {
+		current := child
+		for {
+			info, err := catalog.ReadRunInfo(backupDir, current)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsIncremental() {
+				break
+			}
+			parent := info.Parent.Entry()
+			if _, seen := needed[parent]; seen || parent == child {
+				break
+			}
+			needed[parent] = child
+			current = parent
+		}
+	}
+	return needed, nil
+}
+
 func deleteBackupEntryFiles(backupDir string, entry util.BackupEntry) (int, error) {
 	removed := 0
 	parts, err := catalog.CollectParts(backupDir, entry)
@@ -105,7 +147,7 @@ func deleteBackupEntryFiles(backupDir string, entry util.BackupEntry) (int, erro
 		return removed, err
 	}
 	for _, part := range parts {
-		err := os.Remove(part)
+		err := util.StorageFor(part).Remove(part)
 		if err != nil {
 			if os.IsNotExist(err) {
 				continue
@@ -115,11 +157,18 @@ func deleteBackupEntryFiles(backupDir string, entry util.BackupEntry) (int, erro
 		removed++
 	}
 
-	challengePath := util.ChallengeFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID)
-	if err := os.Remove(challengePath); err == nil {
-		removed++
-	} else if !os.IsNotExist(err) {
-		return removed, err
+	sidecars := []string{
+		util.ChallengeFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID),
+		util.ManifestFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID),
+		util.RunInfoFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID),
+		util.SnapshotFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID),
+	}
+	for _, path := range sidecars {
+		if err := util.StorageFor(path).Remove(path); err == nil {
+			removed++
+		} else if !os.IsNotExist(err) {
+			return removed, err
+		}
 	}
 
 	return removed, nil
@@ -138,8 +187,22 @@ func deleteOrphanLogFiles(backupDir string) (int, error) {
 	for _, entry := range index {
 		activeRuns[entry.RunKey()] = true
 	}
+	// Incomplete runs are hidden from the index but keep their log file and
+	// markers while they still have other files; cleanup-incomplete deletes them.
+	incomplete, err := catalog.FindIncompleteRuns(backupDir)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+	for _, run := range incomplete {
+		for _, path := range run.Files {
+			if !logFilePattern.MatchString(filepath.Base(path)) {
+				activeRuns[run.Date+"|"+string(run.ID)] = true
+				break
+			}
+		}
+	}
 
-	des, err := os.ReadDir(backupDir)
+	des, err := util.StorageFor(backupDir).List(backupDir)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return 0, nil
@@ -164,7 +227,7 @@ func deleteOrphanLogFiles(backupDir string) (int, error) {
 		}
 
 		logPath := filepath.Join(backupDir, de.Name())
-		err := os.Remove(logPath)
+		err := util.StorageFor(logPath).Remove(logPath)
 		if err != nil {
 			if os.IsNotExist(err) {
 				continue
@@ -1,14 +1,16 @@
 package backup
 
 import (
+	"RestoreSafe/internal/catalog"
 	"RestoreSafe/internal/util"
 	"errors"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
-func TestDeleteBackupEntryFilesRemovesPartsAndChallenge(t *testing.T) {
+func TestDeleteBackupEntryFilesRemovesPartsChallengeAndManifest(t *testing.T) {
 	t.Parallel()
 
 	dir := t.TempDir()
@@ -17,22 +19,28 @@ func TestDeleteBackupEntryFilesRemovesPartsAndChallenge(t *testing.T) {
 	part1 := util.PartFileName(dir, entry.DirectoryName, entry.Date, entry.ID, 1)
 	part2 := util.PartFileName(dir, entry.DirectoryName, entry.Date, entry.ID, 2)
 	challenge := util.ChallengeFileName(dir, entry.DirectoryName, entry.Date, entry.ID)
+	manifestFile := util.ManifestFileName(dir, entry.DirectoryName, entry.Date, entry.ID)
+	runInfo := util.RunInfoFileName(dir, entry.DirectoryName, entry.Date, entry.ID)
 
 	createFile(t, part1, "p1")
 	createFile(t, part2, "p2")
 	createFile(t, challenge, "challenge")
+	createFile(t, manifestFile, "manifest")
+	createFile(t, runInfo, "{}")
 
 	removed, err := deleteBackupEntryFiles(dir, entry)
 	if err != nil {
 		t.Fatalf("deleteBackupEntryFiles returned error: %v", err)
 	}
-	if removed != 3 {
-		t.Fatalf("expected 3 removed files, got %d", removed)
+	if removed != 5 {
+		t.Fatalf("expected 5 removed files, got %d", removed)
 	}
 
 	assertNotExists(t, part1)
 	assertNotExists(t, part2)
 	assertNotExists(t, challenge)
+	assertNotExists(t, manifestFile)
+	assertNotExists(t, runInfo)
 }
 
 func TestDeleteBackupEntryFilesSkipsWhenNoChallengeFile(t *testing.T) {
@@ -67,22 +75,28 @@ func TestDeleteOrphanLogFilesKeepsActiveRunLogs(t *testing.T) {
 	createFile(t, activePart, "enc")
 
 	activeLog := util.LogFileName(dir, active.Date, active.ID)
+	activeMarker := util.IncompleteRunFileName(dir, active.Date, active.ID)
 	orphanLog := util.LogFileName(dir, otherDate, otherID)
+	orphanMarker := util.IncompleteRunFileName(dir, otherDate, otherID)
 	unrelated := filepath.Join(dir, "notes.log")
 	createFile(t, activeLog, "active")
+	createFile(t, activeMarker, "incomplete")
 	createFile(t, orphanLog, "orphan")
+	createFile(t, orphanMarker, "incomplete")
 	createFile(t, unrelated, "keep")
 
 	deleted, err := deleteOrphanLogFiles(dir)
 	if err != nil {
 		t.Fatalf("deleteOrphanLogFiles returned error: %v", err)
 	}
-	if deleted != 1 {
-		t.Fatalf("expected exactly 1 deleted orphan log, got %d", deleted)
+	if deleted != 2 {
+		t.Fatalf("expected the orphan log and marker to be deleted, got %d", deleted)
 	}
 
 	assertExists(t, activeLog)
+	assertExists(t, activeMarker)
 	assertNotExists(t, orphanLog)
+	assertNotExists(t, orphanMarker)
 	assertExists(t, unrelated)
 }
 
@@ -161,6 +175,86 @@ func TestApplyRetentionPolicyDeletesOlderSetsAboveRetentionKeep(t *testing.T) {
 	assertExists(t, part2)
 }
 
+func TestApplyRetentionPolicyKeepsParentsOfRetainedIncrementalBackups(t *testing.T) {
+	dir := t.TempDir()
+	log := util.NewConsoleLogger("info")
+
+	older := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-12", ID: util.BackupID("OLD001")}
+	full := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-13", ID: util.BackupID("FUL002")}
+	incremental := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-14", ID: util.BackupID("INC003")}
+
+	olderPart := util.PartFileName(dir, older.DirectoryName, older.Date, older.ID, 1)
+	fullPart := util.PartFileName(dir, full.DirectoryName, full.Date, full.ID, 1)
+	incrementalPart := util.PartFileName(dir, incremental.DirectoryName, incremental.Date, incremental.ID, 1)
+	createFile(t, olderPart, "older data")
+	createFile(t, fullPart, "full data")
+	createFile(t, incrementalPart, "incremental data")
+	if err := catalog.WriteRunInfo(dir, incremental, catalog.NewIncrementalRunInfo(full)); err != nil {
+		t.Fatalf("WriteRunInfo returned error: %v", err)
+	}
+	// Part modification times decide the order of backup runs.
+	for i, part := range []string{olderPart, fullPart, incrementalPart} {
+		modTime := time.Date(2026, 3, 12+i, 12, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(part, modTime, modTime); err != nil {
+			t.Fatalf("failed to set part time: %v", err)
+		}
+	}
+
+	sources := []backupSource{{Resolved: dir + "/Docs", BackupName: "Docs"}}
+	if err := applyRetentionPolicy(dir, 1, sources, log); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	assertNotExists(t, olderPart)
+	assertExists(t, fullPart)
+	assertExists(t, incrementalPart)
+}
+
+func TestApplyRetentionPolicyOrdersConsolidatedSetsByTheirState(t *testing.T) {
+	dir := t.TempDir()
+	log := util.NewConsoleLogger("info")
+
+	full := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-12", ID: util.BackupID("FUL001")}
+	incremental := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-13", ID: util.BackupID("INC002")}
+	newer := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-14", ID: util.BackupID("NEW003")}
+	consolidated := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-13", ID: util.BackupID("CON004")}
+	parts := make(map[util.BackupEntry]string)
+	for i, entry := range []util.BackupEntry{full, incremental, newer, consolidated} {
+		parts[entry] = util.PartFileName(dir, entry.DirectoryName, entry.Date, entry.ID, 1)
+		createFile(t, parts[entry], "data")
+		modTime := time.Date(2026, 3, 12+i, 12, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(parts[entry], modTime, modTime); err != nil {
+			t.Fatalf("failed to set part time: %v", err)
+		}
+	}
+	if err := catalog.WriteRunInfo(dir, incremental, catalog.NewIncrementalRunInfo(full)); err != nil {
+		t.Fatalf("WriteRunInfo returned error: %v", err)
+	}
+	if err := catalog.WriteRunInfo(dir, newer, catalog.NewIncrementalRunInfo(incremental)); err != nil {
+		t.Fatalf("WriteRunInfo returned error: %v", err)
+	}
+	// The chain up to incremental was consolidated after newer was taken.
+	stateTime := time.Date(2026, 3, 13, 12, 0, 0, 1, time.UTC)
+	if err := catalog.WriteRunInfo(dir, consolidated, catalog.RunInfo{Type: catalog.BackupTypeFull, StateTime: stateTime}); err != nil {
+		t.Fatalf("WriteRunInfo returned error: %v", err)
+	}
+
+	sources := []backupSource{{Resolved: dir + "/Docs", BackupName: "Docs"}}
+	if err := applyRetentionPolicy(dir, 2, sources, log); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	// newer and consolidated are kept, and newer still needs its chain.
+	for _, entry := range []util.BackupEntry{full, incremental, newer, consolidated} {
+		assertExists(t, parts[entry])
+	}
+	if err := applyRetentionPolicy(dir, 1, sources, log); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	assertExists(t, parts[newer])
+	assertNotExists(t, parts[consolidated])
+}
+
 func createFile(t *testing.T, path string, content string) {
 	t.Helper()
 	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
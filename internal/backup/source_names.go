@@ -1,6 +1,7 @@
 package backup
 
 import (
+	"RestoreSafe/internal/operation"
 	"RestoreSafe/internal/util"
 	"errors"
 	"fmt"
@@ -15,6 +16,8 @@ type backupSource struct {
 	Warning        string
 	Skip           bool
 	Err            error
+	// Command is set for a command source; Resolved then shows its command line.
+	Command *util.CommandSource
 }
 
 func resolveBackupSources(sourceDirectories []string, exeDir string) []backupSource {
@@ -23,7 +26,7 @@ func resolveBackupSources(sourceDirectories []string, exeDir string) []backupSou
 		resolved := util.ResolveDir(src, exeDir)
 		status := backupSource{Resolved: resolved, normalizedPath: util.NormalizePathKey(resolved)}
 
-		status.Err = util.ValidateSourceDirectory(resolved)
+		status.Err = util.ValidateSource(resolved)
 		result = append(result, status)
 	}
 	markIdenticalSourceDuplicates(result)
@@ -31,6 +34,33 @@ func resolveBackupSources(sourceDirectories []string, exeDir string) []backupSou
 	return result
 }
 
+// appendCommandSources adds the configured command sources to sources. A command
+// source whose name is already the backup name of a directory is rejected, since both
+// would write the same backup files.
+func appendCommandSources(sources []backupSource, commands []util.CommandSource) []backupSource {
+	taken := make(map[string]string)
+	for _, source := range sources {
+		if source.Err == nil {
+			taken[strings.ToLower(source.BackupName)] = source.Resolved
+		}
+	}
+	for i := range commands {
+		command := &commands[i]
+		source := backupSource{
+			Resolved:   operation.FormatCommand(command.Command, command.Args),
+			BackupName: command.Name,
+			Command:    command,
+		}
+		if owner, exists := taken[strings.ToLower(command.Name)]; exists {
+			source.Err = fmt.Errorf("backup name %q is already used by %s; rename the command source", command.Name, owner)
+		} else {
+			source.Err = operation.ValidateCommand(command.Command)
+		}
+		sources = append(sources, source)
+	}
+	return sources
+}
+
 func markIdenticalSourceDuplicates(sources []backupSource) {
 	seenByPath := make(map[string]int)
 	for i := range sources {
@@ -198,3 +228,15 @@ func sanitizeAliasPart(part string) string {
 
 	return b.String()
 }
+
+// SourceDirectoryForBackupName returns the configured source directory whose backups are
+// stored under backupName, applying the same naming and alias rules as the backup workflow.
+// The returned directory is resolved against exeDir but not required to exist.
+func SourceDirectoryForBackupName(sourceDirectories []string, exeDir, backupName string) (string, bool) {
+	for _, source := range resolveBackupSources(sourceDirectories, exeDir) {
+		if strings.EqualFold(source.BackupName, backupName) {
+			return source.Resolved, true
+		}
+	}
+	return "", false
+}
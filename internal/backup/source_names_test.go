@@ -29,8 +29,8 @@ func TestPlanBackupSourcesReportsExpectedStatuses(t *testing.T) {
 	if plans[0].Err != nil {
 		t.Fatalf("expected first source to be valid, got error: %v", plans[0].Err)
 	}
-	if plans[1].Err == nil {
-		t.Fatal("expected file path to be rejected as non-directory")
+	if plans[1].Err != nil {
+		t.Fatalf("expected file path to be accepted as a single-file source, got error: %v", plans[1].Err)
 	}
 	if plans[2].Err == nil {
 		t.Fatal("expected missing path to return error")
@@ -39,7 +39,7 @@ func TestPlanBackupSourcesReportsExpectedStatuses(t *testing.T) {
 		t.Fatalf("expected first source backup name ok, got %q", plans[0].BackupName)
 	}
 	if plans[1].BackupName != "not-a-dir.txt" {
-		t.Fatalf("expected file-path backup name fallback, got %q", plans[1].BackupName)
+		t.Fatalf("expected file source backup name not-a-dir.txt, got %q", plans[1].BackupName)
 	}
 }
 
@@ -340,3 +340,31 @@ func TestSanitizeAliasPartEncodesNonAlphaNumericAsUTF8Hex(t *testing.T) {
 		}
 	}
 }
+
+func TestSourceDirectoryForBackupNameUsesBackupNaming(t *testing.T) {
+	t.Parallel()
+
+	exeDir := t.TempDir()
+	first := filepath.Join(exeDir, "RootA", "Documents")
+	second := filepath.Join(exeDir, "RootB", "Documents")
+	for _, dir := range []string{first, second} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatalf("failed to create source directory: %v", err)
+		}
+	}
+	sources := []string{first, second, filepath.Join(exeDir, "Missing")}
+
+	plans := resolveBackupSources(sources, exeDir)
+	for i, plan := range plans[:2] {
+		dir, ok := SourceDirectoryForBackupName(sources, exeDir, plan.BackupName)
+		if !ok || dir != plan.Resolved {
+			t.Fatalf("source %d: expected %q for %q, got %q (found=%v)", i, plan.Resolved, plan.BackupName, dir, ok)
+		}
+	}
+	if dir, ok := SourceDirectoryForBackupName(sources, exeDir, "missing"); !ok || !strings.HasSuffix(dir, "Missing") {
+		t.Fatalf("expected missing source to still map by name, got %q (found=%v)", dir, ok)
+	}
+	if _, ok := SourceDirectoryForBackupName(sources, exeDir, "Pictures"); ok {
+		t.Fatal("expected unknown backup name not to match")
+	}
+}
@@ -0,0 +1,143 @@
+package backup
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Options selects a backup that is not the interactive backup of the configured sources.
+type Options struct {
+	// Stdin backs up the stream read from standard input as one backup set.
+	Stdin bool
+	// Name names the backup set of the stream and the file it is restored as.
+	Name string
+	// PasswordFile holds the backup password; without it the password is read from
+	// the environment variable operation.PasswordEnv.
+	PasswordFile string
+	// Resume continues the interrupted run with this ID from its checkpoint.
+	Resume string
+}
+
+// RunWithOptions executes the backup selected by opts. Without Stdin it runs the
+// interactive backup workflow.
+func RunWithOptions(cfg *util.Config, exeDir string, opts Options) error {
+	if !opts.Stdin {
+		return runBackup(cfg, exeDir, opts.Resume)
+	}
+	return runStdin(cfg, exeDir, opts, os.Stdin)
+}
+
+// runStdin streams stdin → encrypt → split-writer as the backup set opts.Name. Standard
+// input carries the data, so there is no preflight confirmation and the password is
+// not prompted.
+func runStdin(cfg *util.Config, exeDir string, opts Options, stdin io.Reader) error {
+	if cfg.Spanning.Enabled {
+		return fmt.Errorf("A backup of standard input cannot span removable media, as the next medium is asked for on standard input. Remedy: Write the stream to a file and back up its directory, or disable 'spanning'.")
+	}
+	name := strings.TrimSpace(opts.Name)
+	if name != opts.Name || !util.IsValidStreamName(name) {
+		return fmt.Errorf("Invalid backup name %q. Remedy: Pass -name=<name> with a plain file name without brackets, path separators or the characters : * ? \" < > |.", opts.Name)
+	}
+	for _, source := range appendCommandSources(resolveBackupSources(cfg.SourceDirectories, exeDir), cfg.CommandSources) {
+		if source.BackupName != "" && strings.EqualFold(source.BackupName, name) {
+			return fmt.Errorf("Backup name %q is already used by source %s in config.yaml. Remedy: Pass a different -name.", name, source.Resolved)
+		}
+	}
+
+	id, err := util.NewBackupID()
+	if err != nil {
+		return err
+	}
+	date := util.DateString()
+	targets, err := openBackupTargets(cfg, exeDir, id)
+	if err != nil {
+		return err
+	}
+	defer targets.Close()
+	backupDir := targets.Dir
+
+	logPath := util.LogFileName(backupDir, date, id)
+	log, err := util.NewLogger(logPath, cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+	ioRetries := util.WatchIORetries(log)
+	defer ioRetries.Stop()
+
+	var password []byte
+	if cfg.IsYubiKeyOnly() {
+		password = []byte{}
+	} else if password, err = operation.ReadPasswordNonInteractive(opts.PasswordFile); err != nil {
+		return err
+	}
+	defer func() { security.ZeroBytes(password) }()
+
+	var challengeHex string
+	if cfg.UseYubiKey() {
+		if err := security.CheckYubiKeyConnected(); err != nil {
+			return security.ErrYubiKeyRequired
+		}
+		fmt.Println("YubiKey connected. Please touch the YubiKey button.")
+		rawPassword := password
+		password, challengeHex, err = security.CombineWithPassword(rawPassword)
+		security.ZeroBytes(rawPassword)
+		if err != nil {
+			return fmt.Errorf("YubiKey authentication failed: %w", err)
+		}
+	}
+
+	argon2Params := security.Argon2Params{
+		Time:     uint32(cfg.Argon2.Time),
+		MemoryKB: uint32(cfg.Argon2.MemoryMB) * 1024,
+		Threads:  uint8(cfg.Argon2.Threads),
+	}
+
+	if err := targets.markStarted(date, id); err != nil {
+		return err
+	}
+	log.Info("Backup started - ID: %s, date: %s, standard input as %s", string(id), date, name)
+	parts, err := encryptStream(stdin, name, backupDir, date, id, password, argon2Params, cfg, log)
+	if err != nil {
+		parts.remove()
+		return fmt.Errorf("Backup of standard input failed: %w", err)
+	}
+	entry := util.BackupEntry{DirectoryName: name, Date: date, ID: id}
+	if _, err := parts.finish(entry, catalog.SourceTypeStdin, password, argon2Params, cfg, log); err != nil {
+		return fmt.Errorf("Backup of standard input failed: %w", err)
+	}
+
+	if challengeHex != "" {
+		challengeContent := challengeHex
+		if cfg.IsYubiKeyOnly() {
+			challengeContent = "NOPW:" + challengeHex
+		}
+		if err := util.WriteStorageFile(util.ChallengeFileName(backupDir, name, date, id), []byte(challengeContent)); err != nil {
+			return fmt.Errorf("Failed to write challenge file: %w. Remedy: Check write permissions in the backup directory; for YubiKey backups, the .challenge file must be in the same directory as the .enc files.", err)
+		}
+	}
+
+	failedDirs := targets.reportFailures(date, id, log)
+	if err := targets.markComplete(date, id); err != nil {
+		return err
+	}
+	warningCount := failedDirs + targets.applyRetention(cfg.RetentionKeep, []backupSource{{BackupName: name}}, log)
+	warningCount += operation.LogIORetries(ioRetries, log)
+
+	if failedDirs > 0 {
+		log.Warn("Backup completed in %d of %d backup directories", len(targets.Dirs)-failedDirs, len(targets.Dirs))
+	} else {
+		log.Info("Backup completed successfully")
+	}
+	targets.printLogFiles(date, id)
+	if warningCount > 0 {
+		fmt.Printf("Warnings: %d\n", warningCount)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package backup
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/util"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunStdinBacksUpStreamAsNamedSet(t *testing.T) {
+	t.Setenv(operation.PasswordEnv, "stdin-password")
+	backupDir := t.TempDir()
+	cfg := &util.Config{
+		BackupDirectory:    backupDir,
+		SplitSizeMB:        1,
+		LogLevel:           "info",
+		AuthenticationMode: util.AuthModePassword,
+		Argon2:             util.Argon2Config{Time: 3, MemoryMB: 64, Threads: 4},
+	}
+
+	if err := runStdin(cfg, t.TempDir(), Options{Stdin: true, Name: "home.tar"}, strings.NewReader("tar stream")); err != nil {
+		t.Fatalf("runStdin failed: %v", err)
+	}
+
+	index, err := catalog.ScanBackups(backupDir)
+	if err != nil || len(index) != 1 || index[0].DirectoryName != "home.tar" {
+		t.Fatalf("expected one backup set named home.tar, got %+v, %v", index, err)
+	}
+	info, err := catalog.ReadRunInfo(backupDir, index[0])
+	if err != nil || info.Source != catalog.SourceTypeStdin || !info.IsStream() {
+		t.Fatalf("expected run metadata to mark a stdin stream, got %+v, %v", info, err)
+	}
+	entries, ok, err := manifest.LoadForBackup(backupDir, index[0], []byte("stdin-password"))
+	if err != nil || !ok || len(entries) != 1 || entries[0].Size != int64(len("tar stream")) {
+		t.Fatalf("expected one manifest entry describing the stream, got %#v, ok=%v, err=%v", entries, ok, err)
+	}
+}
+
+func TestRunStdinRejectsInvalidOrTakenName(t *testing.T) {
+	t.Setenv(operation.PasswordEnv, "stdin-password")
+	sourceDir := t.TempDir()
+	cfg := &util.Config{BackupDirectory: t.TempDir(), SourceDirectories: []string{sourceDir}, SplitSizeMB: 1}
+
+	if err := runStdin(cfg, t.TempDir(), Options{Stdin: true, Name: "a/b"}, strings.NewReader("x")); err == nil || !strings.Contains(err.Error(), "Invalid backup name") {
+		t.Fatalf("expected an invalid name error, got %v", err)
+	}
+	taken := util.DirectoryBaseName(sourceDir)
+	if err := runStdin(cfg, t.TempDir(), Options{Stdin: true, Name: taken}, strings.NewReader("x")); err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Fatalf("expected a name collision error, got %v", err)
+	}
+}
+
+func TestRunStdinWritesToMountedStorage(t *testing.T) {
+	t.Setenv(operation.PasswordEnv, "stdin-password")
+	backupDir := "mem://" + t.Name()
+	storage := util.NewMemoryStorage()
+	t.Cleanup(util.MountStorage(backupDir, storage))
+	cfg := &util.Config{
+		BackupDirectory:    backupDir,
+		SplitSizeMB:        1,
+		LogLevel:           "info",
+		AuthenticationMode: util.AuthModePassword,
+		Argon2:             util.Argon2Config{Time: 3, MemoryMB: 64, Threads: 4},
+	}
+
+	if err := runStdin(cfg, t.TempDir(), Options{Stdin: true, Name: "db.dump"}, strings.NewReader("dump stream")); err != nil {
+		t.Fatalf("runStdin failed: %v", err)
+	}
+
+	index, err := catalog.ScanBackups(backupDir)
+	if err != nil || len(index) != 1 || index[0].DirectoryName != "db.dump" {
+		t.Fatalf("expected one backup set in memory storage, got %+v, %v", index, err)
+	}
+	entries, ok, err := manifest.LoadForBackup(backupDir, index[0], []byte("stdin-password"))
+	if err != nil || !ok || len(entries) != 1 || entries[0].Size != int64(len("dump stream")) {
+		t.Fatalf("expected the manifest in memory storage, got %#v, ok=%v, err=%v", entries, ok, err)
+	}
+}
+
+// offlineStorage is a MemoryStorage that fails to create encrypted files, like a
+// share that disconnects once the backup has started.
+type offlineStorage struct {
+	*util.MemoryStorage
+}
+
+func (s offlineStorage) Create(p string) (util.StorageWriter, error) {
+	if strings.Contains(p, ".enc") {
+		return nil, errors.New("network name is no longer available")
+	}
+	return s.MemoryStorage.Create(p)
+}
+
+func TestRunStdinWritesEveryBackupDirectoryAndMarksFailedCopy(t *testing.T) {
+	t.Setenv(operation.PasswordEnv, "stdin-password")
+	first, second := t.TempDir(), t.TempDir()
+	offline := "mem://" + t.Name()
+	storage := offlineStorage{util.NewMemoryStorage()}
+	t.Cleanup(util.MountStorage(offline, storage))
+	cfg := &util.Config{
+		BackupDirectory:    first,
+		BackupDirectories:  []string{first, offline, second},
+		SplitSizeMB:        1,
+		LogLevel:           "info",
+		AuthenticationMode: util.AuthModePassword,
+		Argon2:             util.Argon2Config{Time: 3, MemoryMB: 64, Threads: 4},
+	}
+
+	if err := runStdin(cfg, t.TempDir(), Options{Stdin: true, Name: "db.dump"}, strings.NewReader("dump stream")); err != nil {
+		t.Fatalf("runStdin failed: %v", err)
+	}
+
+	for _, dir := range []string{first, second} {
+		index, err := catalog.ScanBackups(dir)
+		if err != nil || len(index) != 1 || index[0].DirectoryName != "db.dump" {
+			t.Fatalf("expected the backup set in %s, got %+v, %v", dir, index, err)
+		}
+		entries, ok, err := manifest.LoadForBackup(dir, index[0], []byte("stdin-password"))
+		if err != nil || !ok || len(entries) != 1 || entries[0].Size != int64(len("dump stream")) {
+			t.Fatalf("expected the manifest in %s, got %#v, ok=%v, err=%v", dir, entries, ok, err)
+		}
+		logs, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+		if len(logs) != 1 {
+			t.Fatalf("expected the log file in %s, got %v", dir, logs)
+		}
+	}
+
+	entries, err := storage.List(offline)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var markers []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), util.IncompleteRunFileSuffix) {
+			markers = append(markers, entry.Name())
+		}
+	}
+	if len(markers) != 1 {
+		t.Fatalf("expected the failed copy to be marked incomplete, got %v", entries)
+	}
+	reason, err := util.ReadStorageFile(offline + "/" + markers[0])
+	if err != nil || !strings.Contains(string(reason), "network name is no longer available") {
+		t.Fatalf("expected the marker to hold the error, got %q, %v", reason, err)
+	}
+}
+
+func TestRunStdinKeepsOnlyTheLogInTemp(t *testing.T) {
+	t.Setenv(operation.PasswordEnv, "stdin-password")
+	backupDir := t.TempDir()
+	exeDir := t.TempDir()
+	tempDir := t.TempDir()
+	for _, name := range []string{"TMPDIR", "TMP", "TEMP"} {
+		t.Setenv(name, tempDir)
+	}
+	cfg := &util.Config{
+		BackupDirectory:    backupDir,
+		SplitSizeMB:        1,
+		LogLevel:           "info",
+		AuthenticationMode: util.AuthModePassword,
+		Argon2:             util.Argon2Config{Time: 3, MemoryMB: 64, Threads: 4},
+	}
+
+	stdin := &tempWatchReader{r: strings.NewReader("tar stream"), dir: tempDir}
+	if err := runStdin(cfg, exeDir, Options{Stdin: true, Name: "home.tar"}, stdin); err != nil {
+		t.Fatalf("runStdin failed: %v", err)
+	}
+	// Standard input goes straight into the parts; only the run log is kept in TEMP.
+	for _, name := range stdin.atEOF {
+		if filepath.Ext(name) != ".log" {
+			t.Fatalf("expected nothing but the log in the temp directory, found %s", name)
+		}
+	}
+}
+
+// tempWatchReader lists dir when r reaches its end.
+type tempWatchReader struct {
+	r     io.Reader
+	dir   string
+	atEOF []string
+}
+
+func (w *tempWatchReader) Read(p []byte) (int, error) {
+	n, err := w.r.Read(p)
+	if err == io.EOF && w.atEOF == nil {
+		files, _ := os.ReadDir(w.dir)
+		w.atEOF = []string{}
+		for _, file := range files {
+			w.atEOF = append(w.atEOF, file.Name())
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,113 @@
+package backup
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// streamParts describes a raw stream written into encrypted split parts.
+type streamParts struct {
+	sw       *util.Writer
+	counters *backupCounters
+	size     int64
+	sum      []byte
+}
+
+// encryptStream streams r → encrypt → split-writer into the parts of backup name. The
+// archive holds the raw stream instead of a TAR. Parts written before an error are
+// left in place; remove deletes them.
+func encryptStream(
+	r io.Reader,
+	name, backupDir, date string,
+	id util.BackupID,
+	password []byte,
+	params security.Argon2Params,
+	cfg *util.Config,
+	log *util.Logger,
+) (streamParts, error) {
+	sw, bw := newSplitOutput(backupDir, name, date, id, cfg.SplitSizeMB)
+	sw.SetPartOpenedHook(func(seq int, path string) {
+		log.Info("  Part %03d: %s", seq, filepath.Base(path))
+	})
+	parts := streamParts{sw: sw, counters: &backupCounters{}}
+	var progressLog *util.Logger
+	if cfg.IODiagnostics {
+		progressLog = log
+	}
+	stopProgress := operation.StartProgressTracking(progressLog, name, "encrypted", &parts.counters.inBytes, &parts.counters.outBytes, &parts.counters.outWriteCalls)
+	defer stopProgress()
+
+	pr, pw := io.Pipe()
+	sum := sha256.New()
+	copyErrCh := make(chan error, 1)
+	go func() {
+		n, err := io.Copy(io.MultiWriter(pw, sum), r)
+		parts.size = n
+		pw.CloseWithError(err) //nolint:errcheck
+		copyErrCh <- err
+	}()
+	encErr := runEncryptStage(log, bw, pr, password, params, parts.counters)
+	copyErr := <-copyErrCh
+	closeErr := closeSplitOutput(bw, sw)
+	parts.sum = sum.Sum(nil)
+
+	switch {
+	case encErr != nil:
+		return parts, fmt.Errorf("Encryption failed: %w. Remedy: Check password/YubiKey and retry.", encErr)
+	case copyErr != nil:
+		return parts, fmt.Errorf("Reading the stream failed: %w", copyErr)
+	}
+	return parts, closeErr
+}
+
+// remove deletes the parts of a failed backup set.
+func (p streamParts) remove() {
+	for _, path := range p.sw.Paths() {
+		util.StorageFor(path).Remove(path) //nolint:errcheck
+	}
+}
+
+// finish writes the manifest, describing the stream as one file named after the
+// backup, and the run metadata marking the stream with source. On error the parts
+// are removed.
+func (p streamParts) finish(entry util.BackupEntry, source string, password []byte, params security.Argon2Params, cfg *util.Config, log *util.Logger) (int, error) {
+	fail := func(err error) (int, error) {
+		p.remove()
+		return 0, err
+	}
+	manifestPath := util.ManifestFileName(filepath.Dir(p.sw.Paths()[0]), entry.DirectoryName, entry.Date, entry.ID)
+	mw, err := manifest.Create(manifestPath, manifest.Header{Backup: entry.String()}, password, params)
+	if err != nil {
+		return fail(err)
+	}
+	if err := mw.Add(manifest.Entry{
+		Path:    entry.DirectoryName,
+		Type:    "file",
+		Size:    p.size,
+		ModTime: time.Now().UTC().Truncate(time.Second),
+		Mode:    0o640,
+		SHA256:  hex.EncodeToString(p.sum),
+	}); err != nil {
+		mw.Abort()
+		return fail(err)
+	}
+	if err := mw.Close(); err != nil {
+		return fail(err)
+	}
+	if err := catalog.WriteRunInfo(filepath.Dir(manifestPath), entry, catalog.RunInfo{Type: catalog.BackupTypeFull, Source: source}); err != nil {
+		return fail(err)
+	}
+
+	log.Info("  Stream size: %s", util.FormatBytesBinary(uint64(p.size)))
+	logPartSummary(p.sw, entry.DirectoryName, cfg.IODiagnostics, p.counters, log)
+	return len(p.sw.Paths()), nil
+}
@@ -1,13 +1,19 @@
 // Package backup orchestrates the full backup workflow:
 //  1. Prompt for password (and optionally YubiKey 2FA)
-//  2. For each source directory: stream TAR → split → encrypt → write .enc parts
+//  2. For each source directory: stream TAR → split → encrypt → write .enc parts,
+//     or with repository_format "chunked": chunk → deduplicate → encrypt into packs
+//     and write a snapshot; for each command source: stream its output → split → encrypt
 //  3. Write a log file per backup run
 package backup
 
 import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
 	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/repository"
 	"RestoreSafe/internal/security"
 	"RestoreSafe/internal/util"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -17,26 +23,40 @@ import (
 
 // Run executes the full backup workflow.
 func Run(cfg *util.Config, exeDir string) error {
-	// Resolve backup directory (may be relative to exe dir).
-	backupDir := util.ResolveDir(cfg.BackupDirectory, exeDir)
-	if err := os.MkdirAll(backupDir, 0o750); err != nil {
-		return fmt.Errorf("Failed to create backup directory: %w. Remedy: Check the path (prefer forward slashes in config.yaml, e.g. C:/Backups) and verify write permissions.", err)
-	}
+	return runBackup(cfg, exeDir, "")
+}
 
-	lock, err := util.AcquireBackupLock(backupDir)
+// runBackup executes the backup workflow. It continues an interrupted run from its
+// checkpoint when resumeID names one, or when the user chooses to resume the newest
+// interrupted run; otherwise it starts a new run.
+func runBackup(cfg *util.Config, exeDir, resumeID string) error {
+	resumed, err := selectRunToResume(cfg, exeDir, resumeID)
 	if err != nil {
 		return err
 	}
-	defer lock.Release()
-
-	sources := resolveBackupSources(cfg.SourceDirectories, exeDir)
 
 	// Determine backup run identifiers.
-	id, err := util.NewBackupID()
+	var id util.BackupID
+	var date string
+	if resumed != nil {
+		id, date = resumed.ID, resumed.Date
+	} else {
+		if id, err = util.NewBackupID(); err != nil {
+			return err
+		}
+		date = util.DateString()
+	}
+
+	// Resolve backup directories (may be relative to exe dir). With several
+	// directories, backupDir writes to all of them at once.
+	targets, err := openBackupTargets(cfg, exeDir, id)
 	if err != nil {
 		return err
 	}
-	date := util.DateString()
+	defer targets.Close()
+	backupDir := targets.Dir
+
+	sources := appendCommandSources(resolveBackupSources(cfg.SourceDirectories, exeDir), cfg.CommandSources)
 
 	// Set up logger.
 	logPath := util.LogFileName(backupDir, date, id)
@@ -45,6 +65,8 @@ func Run(cfg *util.Config, exeDir string) error {
 		return err
 	}
 	defer log.Close()
+	ioRetries := util.WatchIORetries(log)
+	defer ioRetries.Stop()
 
 	if err := validateSourceDirectories(sources); err != nil {
 		return err
@@ -53,22 +75,31 @@ func Run(cfg *util.Config, exeDir string) error {
 	// Plan local staging to mitigate same-volume read+write contention.
 	// Prefer a source that shares the backup volume so the plan correctly detects contention
 	// when only some sources are on the same drive as the backup directory.
+	// The chunked repository is written in place, since new chunks are appended to shared packs.
+	chunked := cfg.RepositoryFormat == util.RepositoryFormatChunked
+	stagingDestDir := stagingVolumeDir(sources, targets.Dirs)
 	stagingSourceDir := ""
 	for _, src := range sources {
-		if src.Err == nil && !src.Skip {
+		if src.Err == nil && !src.Skip && src.Command == nil {
 			if stagingSourceDir == "" {
 				stagingSourceDir = src.Resolved
 			}
-			if util.SameVolume(src.Resolved, backupDir) {
+			if util.SameVolume(src.Resolved, stagingDestDir) {
 				stagingSourceDir = src.Resolved
 				break
 			}
 		}
 	}
-	stagingPlan := operation.PlanLocalStaging(stagingSourceDir, backupDir, os.TempDir())
+	// A resumed run continues the parts in the backup directory, so it is not staged.
+	// Neither is a run spanning removable media, which asks for the next medium as
+	// soon as one is full.
+	var stagingPlan operation.LocalStagingPlan
+	if !chunked && resumed == nil && !cfg.Spanning.Enabled {
+		stagingPlan = operation.PlanLocalStaging(stagingSourceDir, stagingDestDir, os.TempDir())
+	}
 
-	printBackupPreflightWithYubiKeyCheck(os.Stdout, cfg, backupDir, sources, stagingPlan, security.CheckYubiKeyConnected)
-	if err := validateTargetSpaceForBackup(backupDir, sources); err != nil {
+	printBackupPreflightWithYubiKeyCheck(os.Stdout, cfg, targets.Healthy(), sources, stagingPlan, security.CheckYubiKeyConnected)
+	if err := validateTargetSpace(cfg, targets.Healthy(), sources); err != nil {
 		if strings.Contains(err.Error(), "Insufficient free space for backup:") {
 			fmt.Println()
 			fmt.Printf("[ERROR] %s\n", strings.TrimPrefix(err.Error(), "Backup preflight failed: "))
@@ -93,42 +124,31 @@ func Run(cfg *util.Config, exeDir string) error {
 		return nil
 	}
 
-	// Collect password.
-	var password []byte
-	if cfg.IsYubiKeyOnly() {
-		fmt.Println("YubiKey-only mode: no password required.")
-		password = []byte{}
-	} else {
-		var err error
-		password, err = security.ReadPasswordConfirmedWithPrompts("Enter backup password: ", "Re-enter backup password: ")
+	// Previous backups are the parents of incremental runs.
+	newestEntries := make(map[string]util.BackupEntry)
+	if cfg.BackupMode == util.BackupModeIncremental {
+		index, err := catalog.ScanBackups(backupDir)
 		if err != nil {
+			return fmt.Errorf("Failed to scan previous backups: %w. Remedy: Check read permissions in the backup directory.", err)
+		}
+		if newestEntries, err = catalog.NewestEntryPerDirectory(backupDir, index); err != nil {
 			return err
 		}
 	}
-	defer func() { security.ZeroBytes(password) }()
 
-	// Optional YubiKey factor (2FA or sole factor in yubikey mode).
+	// Collect password and the optional YubiKey factor. A resumed run uses the
+	// password and challenge of the interrupted run.
+	var password []byte
 	var challengeHex string
-	if cfg.UseYubiKey() {
-		// Verify ykman is installed and a device is physically connected.
-		if err := security.CheckYubiKeyConnected(); err != nil {
-			return security.ErrYubiKeyRequired
-		}
-		fmt.Println("YubiKey connected. Please touch the YubiKey button.")
-		rawPassword := password
-		combined, hex, err := security.CombineWithPassword(rawPassword)
-		security.ZeroBytes(rawPassword)
-		if err != nil {
-			return fmt.Errorf("YubiKey authentication failed: %w", err)
-		}
-		password = combined
-		challengeHex = hex
-		if cfg.IsYubiKeyOnly() {
-			log.Info("YubiKey-only authentication successful. Challenge: %s", challengeHex)
-		} else {
-			log.Info("YubiKey-2FA successful. Challenge: %s", challengeHex)
-		}
+	if resumed != nil {
+		password, challengeHex, err = readResumePassword(backupDir, resumed, log)
+	} else {
+		password, challengeHex, err = readBackupPassword(cfg, backupDir, chunked, sources, newestEntries, log)
 	}
+	if err != nil {
+		return err
+	}
+	defer func() { security.ZeroBytes(password) }()
 
 	fmt.Println()
 	n := runnableSourceCount(sources)
@@ -136,7 +156,11 @@ func Run(cfg *util.Config, exeDir string) error {
 	if n == 1 {
 		dirWord = "directory"
 	}
-	log.Info("Backup started - ID: %s, date: %s, %d source %s", string(id), date, n, dirWord)
+	if resumed != nil {
+		log.Info("Backup resumed - ID: %s, date: %s, %d source %s (%s)", string(id), date, n, dirWord, describeCheckpoint(resumed.Checkpoint))
+	} else {
+		log.Info("Backup started - ID: %s, date: %s, %d source %s", string(id), date, n, dirWord)
+	}
 	warningCount := 0
 	totalPartsCreated := 0
 	processedDirectories := make([]string, 0)
@@ -153,6 +177,48 @@ func Run(cfg *util.Config, exeDir string) error {
 	workingDir := staging.ActiveDir(backupDir)
 	defer staging.Cleanup()
 
+	argon2Params := security.Argon2Params{
+		Time:     uint32(cfg.Argon2.Time),
+		MemoryKB: uint32(cfg.Argon2.MemoryMB) * 1024,
+		Threads:  uint8(cfg.Argon2.Threads),
+	}
+
+	challengeContent := challengeHex
+	if cfg.IsYubiKeyOnly() && challengeHex != "" {
+		challengeContent = "NOPW:" + challengeHex
+	}
+
+	var repo *repository.Repository
+	if chunked {
+		repo, err = openRepository(cfg, backupDir, password, argon2Params, challengeContent, log)
+		if err != nil {
+			return err
+		}
+		defer repo.Close()
+	}
+
+	// The run stays hidden from restores and retention until every source succeeded.
+	if err := targets.markStarted(date, id); err != nil {
+		return err
+	}
+	span, err := targets.startMediaSpan(cfg, date, id, log)
+	if err != nil {
+		return err
+	}
+	defer span.Close()
+
+	// Runs written directly to the backup directory record a checkpoint, so an
+	// interrupted run can be resumed. Runs spanning removable media cannot be.
+	var progress *runProgress
+	if staging.Dir == "" && repo == nil && span == nil {
+		progress = newRunProgress(targets, date, id, resumed)
+		if resumed == nil {
+			if err := progress.setCurrent(nil); err != nil {
+				return err
+			}
+		}
+	}
+
 	// Back up each source directory.
 	for _, source := range sources {
 		if source.Warning != "" {
@@ -169,34 +235,56 @@ func Run(cfg *util.Config, exeDir string) error {
 			directoryName = util.DirectoryBaseName(srcAbs)
 		}
 
-		log.Info("Processing source directory: %s", srcAbs)
-		log.Debug("Directory name in archive: %s", directoryName)
-
-		argon2Params := security.Argon2Params{
-			Time:     uint32(cfg.Argon2.Time),
-			MemoryKB: uint32(cfg.Argon2.MemoryMB) * 1024,
-			Threads:  uint8(cfg.Argon2.Threads),
-		}
-		partCount, err := backupDirectory(srcAbs, directoryName, workingDir, date, id, password, argon2Params, cfg, log)
-		if err != nil {
-			return fmt.Errorf("Backup of %q failed: %w", srcAbs, err)
+		if progress.isCompleted(directoryName) {
+			log.Info("Already backed up before the interruption: [%s]", directoryName)
+			processedDirectories = append(processedDirectories, directoryName)
+			directorySourcePaths[directoryName] = srcAbs
+			continue
 		}
-		totalPartsCreated += partCount
-		processedDirectories = append(processedDirectories, directoryName)
-		directorySourcePaths[directoryName] = srcAbs
 
-		// Write YubiKey challenge file if needed.
+		// Write YubiKey challenge file if needed. It is written first, so a resumed
+		// run finds the challenge of the interrupted one.
 		if cfg.UseYubiKey() && challengeHex != "" {
-			challengeContent := challengeHex
-			if cfg.IsYubiKeyOnly() {
-				challengeContent = "NOPW:" + challengeHex
-			}
 			challengePath := util.ChallengeFileName(workingDir, directoryName, date, id)
-			if err := os.WriteFile(challengePath, []byte(challengeContent), 0o600); err != nil {
+			if err := util.WriteStorageFile(challengePath, []byte(challengeContent)); err != nil {
 				return fmt.Errorf("Failed to write challenge file: %w. Remedy: Check write permissions in the backup directory; for YubiKey backups, the .challenge file must be in the same directory as the .enc files.", err)
 			}
 			log.Debug("Challenge file written: %s", challengePath)
 		}
+
+		if source.Command != nil {
+			// Command output is always streamed into split parts, also with a chunked repository.
+			// It cannot be read again, so an interrupted command source starts over.
+			log.Info("Processing command source: %s", directoryName)
+			if err := progress.startFresh(util.BackupEntry{DirectoryName: directoryName, Date: date, ID: id}); err != nil {
+				return err
+			}
+			partCount, err := backupCommandSource(*source.Command, workingDir, date, id, password, argon2Params, cfg, log)
+			if err != nil {
+				return fmt.Errorf("Backup of command source %q failed: %w", directoryName, err)
+			}
+			totalPartsCreated += partCount
+		} else if repo != nil {
+			log.Info("Processing source directory: %s", srcAbs)
+			log.Debug("Directory name in archive: %s", directoryName)
+			if err := backupDirectoryToRepository(srcAbs, directoryName, backupDir, date, id, repo, password, argon2Params, log); err != nil {
+				return fmt.Errorf("Backup of %q failed: %w", srcAbs, err)
+			}
+		} else {
+			log.Info("Processing source directory: %s", srcAbs)
+			log.Debug("Directory name in archive: %s", directoryName)
+			base := planIncrementalBase(cfg, backupDir, directoryName, newestEntries, password, log)
+			partCount, err := backupDirectoryWithProgress(srcAbs, directoryName, workingDir, date, id, password, argon2Params, base, cfg, log, progress)
+			if err != nil {
+				return fmt.Errorf("Backup of %q failed: %w", srcAbs, err)
+			}
+			totalPartsCreated += partCount
+		}
+		processedDirectories = append(processedDirectories, directoryName)
+		directorySourcePaths[directoryName] = srcAbs
+		if err := progress.complete(directoryName); err != nil {
+			return err
+		}
 	}
 
 	// Move results from staging to backup directory if needed.
@@ -206,27 +294,185 @@ func Run(cfg *util.Config, exeDir string) error {
 		}
 	}
 
-	if err := applyRetentionPolicy(backupDir, cfg.RetentionKeep, sources, log); err != nil {
-		log.Warn("Retention cleanup failed: %v", err)
-		warningCount++
+	failedDirs := targets.reportFailures(date, id, log)
+	warningCount += failedDirs
+	if err := span.Finish(); err != nil {
+		return err
+	}
+	if err := targets.markComplete(date, id); err != nil {
+		return err
+	}
+
+	snapshotsBefore := countSnapshots(backupDir)
+	if span != nil {
+		// Earlier runs are on other media, so retention cannot count them.
+		log.Info("Backup written to %d volume(s); restores start with volume %d, whose label lists the files on all volumes", span.Volume(), span.Volume())
+		log.Info("Retention skipped for removable media")
+	} else {
+		warningCount += targets.applyRetention(cfg.RetentionKeep, sources, log)
+	}
+	// Chunks are shared between snapshots, so they are only removed once no snapshot uses them.
+	if repo != nil && countSnapshots(backupDir) < snapshotsBefore {
+		if err := collectRepositoryGarbage(repo, password, log); err != nil {
+			log.Warn("Repository cleanup failed: %v", err)
+			warningCount++
+		}
 	}
 
-	log.Info("Backup completed successfully")
-	fmt.Printf("\nLog file: %s\n", logPath)
+	warningCount += operation.LogIORetries(ioRetries, log)
+
+	if failedDirs > 0 {
+		log.Warn("Backup completed in %d of %d backup directories", len(targets.Dirs)-failedDirs, len(targets.Dirs))
+	} else {
+		log.Info("Backup completed successfully")
+	}
+	targets.printLogFiles(date, id)
 	if warningCount > 0 {
 		fmt.Printf("Warnings: %d\n", warningCount)
 	}
 	return nil
 }
 
+// readBackupPassword asks for the password of a new run and, with a YubiKey,
+// combines it with the YubiKey response. It returns the password and the challenge.
+func readBackupPassword(cfg *util.Config, backupDir string, chunked bool, sources []backupSource, newestEntries map[string]util.BackupEntry, log *util.Logger) ([]byte, string, error) {
+	var password []byte
+	if cfg.IsYubiKeyOnly() {
+		fmt.Println("YubiKey-only mode: no password required.")
+		password = []byte{}
+	} else {
+		var err error
+		password, err = security.ReadPasswordConfirmedWithPrompts("Enter backup password: ", "Re-enter backup password: ")
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	// Optional YubiKey factor (2FA or sole factor in yubikey mode).
+	var challengeHex string
+	if !cfg.UseYubiKey() {
+		return password, challengeHex, nil
+	}
+	// Verify ykman is installed and a device is physically connected.
+	if err := security.CheckYubiKeyConnected(); err != nil {
+		security.ZeroBytes(password)
+		return nil, "", security.ErrYubiKeyRequired
+	}
+	fmt.Println("YubiKey connected. Please touch the YubiKey button.")
+	rawPassword := password
+	var combined []byte
+	var hex string
+	var err error
+	if existing, ok := repositoryChallenge(backupDir); ok && chunked {
+		// Every run of a chunked repository uses the key the repository was created with.
+		hex = existing
+		combined, err = security.CombineWithPasswordForRestore(rawPassword, hex)
+	} else if parent, ok := parentChallenge(backupDir, sources, newestEntries); ok {
+		// Incremental runs reuse the challenge of their parents so the whole
+		// chain is encrypted with the same key.
+		hex = parent
+		combined, err = security.CombineWithPasswordForRestore(rawPassword, hex)
+	} else {
+		combined, hex, err = security.CombineWithPassword(rawPassword)
+	}
+	security.ZeroBytes(rawPassword)
+	if err != nil {
+		return nil, "", fmt.Errorf("YubiKey authentication failed: %w", err)
+	}
+	challengeHex = hex
+	if cfg.IsYubiKeyOnly() {
+		log.Info("YubiKey-only authentication successful. Challenge: %s", challengeHex)
+	} else {
+		log.Info("YubiKey-2FA successful. Challenge: %s", challengeHex)
+	}
+	return combined, challengeHex, nil
+}
+
 // backupDirectory streams directory → TAR → encrypt → split-writer.
+// A single-file source becomes an archive with one entry named directoryName.
+// While streaming, every TAR entry is recorded in the encrypted manifest next to the parts.
+// With a non-nil base, files unchanged since that parent backup are left out of the
+// archive and deleted files are recorded as tombstones in the manifest.
 func backupDirectory(
 	srcDir, directoryName, backupDir, date string,
 	id util.BackupID,
 	password []byte,
 	params security.Argon2Params,
+	base *incrementalBase,
+	cfg *util.Config,
+	log *util.Logger,
+) (int, error) {
+	return backupDirectoryWithProgress(srcDir, directoryName, backupDir, date, id, password, params, base, cfg, log, nil)
+}
+
+// backupDirectoryWithProgress is backupDirectory for a run that records its
+// progress. Every part ends at a chunk boundary of the encrypted stream and is
+// recorded in the run's checkpoint once finished. When the interrupted run was
+// writing this directory, the directory continues after its last finished part,
+// or starts over if the source changed since.
+func backupDirectoryWithProgress(
+	srcDir, directoryName, backupDir, date string,
+	id util.BackupID,
+	password []byte,
+	params security.Argon2Params,
+	base *incrementalBase,
 	cfg *util.Config,
 	log *util.Logger,
+	progress *runProgress,
+) (int, error) {
+	entry := util.BackupEntry{DirectoryName: directoryName, Date: date, ID: id}
+	parent := ""
+	if base != nil {
+		parent = base.Entry.String()
+	}
+	var resume *setResume
+	if partsAlign(cfg.SplitSizeMB) {
+		var err error
+		if resume, err = progress.resumeSet(entry, parent, password, log); err != nil {
+			return 0, err
+		}
+	}
+	if resume == nil {
+		if err := progress.startFresh(entry); err != nil {
+			return 0, err
+		}
+		return writeDirectorySet(srcDir, directoryName, backupDir, date, id, password, params, base, cfg, log, progress, nil)
+	}
+
+	log.Info("  Resuming [%s] after part %03d: %d file(s) archived before the interruption", directoryName, resume.Parts, resume.Files)
+	partCount, err := writeDirectorySet(srcDir, directoryName, backupDir, date, id, password, params, base, cfg, log, progress, resume)
+	if errors.Is(err, errResumeDiverged) {
+		resume.close()
+		log.Warn("  Cannot resume [%s]: %v. It is backed up from the start.", directoryName, errResumeDiverged)
+		if err := progress.startFresh(entry); err != nil {
+			return 0, err
+		}
+		if base != nil {
+			base.reset()
+		}
+		return writeDirectorySet(srcDir, directoryName, backupDir, date, id, password, params, base, cfg, log, progress, nil)
+	}
+	if err != nil {
+		resume.close()
+		return 0, err
+	}
+	if err := resume.removeRemnants(); err != nil {
+		return 0, err
+	}
+	return partCount, nil
+}
+
+// writeDirectorySet writes the backup set of directoryName, continuing resume if set.
+func writeDirectorySet(
+	srcDir, directoryName, backupDir, date string,
+	id util.BackupID,
+	password []byte,
+	params security.Argon2Params,
+	base *incrementalBase,
+	cfg *util.Config,
+	log *util.Logger,
+	progress *runProgress,
+	resume *setResume,
 ) (int, error) {
 	sw, bw := newSplitOutput(backupDir, directoryName, date, id, cfg.SplitSizeMB)
 	sw.SetPartOpenedHook(func(seq int, path string) {
@@ -235,6 +481,18 @@ func backupDirectory(
 	pr, pw := io.Pipe()
 	counters := &backupCounters{}
 
+	// Parts that end at chunk boundaries can be continued with the next chunk.
+	layout := security.Layout()
+	var tracker *plaintextTracker
+	if progress != nil && sw.AlignParts(layout.HeaderSize, layout.FrameSize) {
+		tracker = newPlaintextTracker(pr, layout.ChunkSize)
+		if resume != nil {
+			sw.ResumeAfter(resume.paths, resume.StreamBytes)
+		}
+	} else if progress != nil {
+		log.Info("  [%s] cannot be resumed if interrupted: split_size_mb is smaller than one encrypted chunk", directoryName)
+	}
+
 	var progressLog *util.Logger
 	if cfg.IODiagnostics {
 		progressLog = log
@@ -242,20 +500,101 @@ func backupDirectory(
 	stopProgress := operation.StartProgressTracking(progressLog, directoryName, "encrypted", &counters.inBytes, &counters.outBytes, &counters.outWriteCalls)
 	defer stopProgress()
 
-	tarErrCh := startTarProducer(log, srcDir, backupDir, pw)
-	encErr := runEncryptStage(log, bw, pr, password, params, counters)
+	entry := util.BackupEntry{DirectoryName: directoryName, Date: date, ID: id}
+	header := manifest.Header{Backup: entry.String()}
+	runInfo := catalog.RunInfo{Type: catalog.BackupTypeFull}
+	tarOpts := util.TarWriteOptions{}
+	if base != nil {
+		header.Parent = base.Entry.String()
+		runInfo = catalog.NewIncrementalRunInfo(base.Entry)
+		tarOpts.SkipContent = base.skipUnchanged
+	}
+	if util.IsRegularFile(srcDir) {
+		tarOpts.FileName = directoryName
+		runInfo.Source = catalog.SourceTypeFile
+	}
+
+	// On removable media, the manifest is written locally while the parts may
+	// continue on the next medium, and moved to the medium once it is complete.
+	span := util.MediaSpanFor(backupDir)
+	manifestPath := util.ManifestFileName(backupDir, directoryName, date, id)
+	if span != nil {
+		manifestPath = util.ManifestFileName(span.TempDir(), directoryName, date, id)
+	}
+	mw, err := manifest.Create(manifestPath, header, password, params)
+	if err != nil {
+		pw.Close() //nolint:errcheck
+		sw.Close() //nolint:errcheck
+		return 0, err
+	}
+	tarOpts.OnEntry = func(e util.TarEntry) error {
+		if tracker != nil {
+			tracker.addEntry(e)
+		}
+		if base != nil {
+			return mw.Add(base.manifestEntry(e))
+		}
+		return mw.Add(manifest.EntryFromTar(e))
+	}
+
+	if tracker != nil {
+		sw.SetPartClosedHook(func(seq int, path string, streamBytes int64) {
+			checkpoint, ok := tracker.checkpoint(layout, streamBytes)
+			if !ok {
+				return
+			}
+			checkpoint.Name, checkpoint.Parent, checkpoint.Parts = directoryName, header.Parent, seq
+			if err := progress.setCurrent(&checkpoint); err != nil {
+				log.Warn("Checkpoint after part %03d not written: %v", seq, err)
+			}
+		})
+	}
+
+	tarErrCh := startTarProducer(log, srcDir, backupDir, pw, tarOpts)
+	var encErr error
+	if tracker != nil {
+		encErr = runTrackedEncryptStage(log, bw, pr, tracker, password, params, resume, counters)
+	} else {
+		encErr = runEncryptStage(log, bw, pr, password, params, counters)
+	}
 	tarErr := <-tarErrCh
 	closeErr := closeSplitOutput(bw, sw)
 
 	if encErr != nil {
+		mw.Abort()
 		return 0, fmt.Errorf("Encryption failed: %w. Remedy: Check password/YubiKey and retry.", encErr)
 	}
 	if closeErr != nil {
+		mw.Abort()
 		return 0, closeErr
 	}
 	if tarErr != nil {
+		mw.Abort()
 		return 0, fmt.Errorf("Creating TAR failed: %w. Remedy: Check source-directory access and file permissions.", tarErr)
 	}
+	if base != nil {
+		deleted := base.tombstones()
+		for _, tombstone := range deleted {
+			if err := mw.Add(tombstone); err != nil {
+				mw.Abort()
+				return 0, err
+			}
+		}
+		log.Info("  Changes since %s: %d changed or new file(s), %d unchanged, %d deleted", base.Entry.String(), base.changed, base.unchanged, len(deleted))
+	}
+	if err := mw.Close(); err != nil {
+		return 0, err
+	}
+	if span != nil {
+		if err := span.Place(manifestPath); err != nil {
+			return 0, err
+		}
+		manifestPath = util.ManifestFileName(backupDir, directoryName, date, id)
+	}
+	log.Debug("Manifest written: %s", manifestPath)
+	if err := catalog.WriteRunInfo(backupDir, entry, runInfo); err != nil {
+		return 0, err
+	}
 
 	logPartSummary(sw, directoryName, cfg.IODiagnostics, counters, log)
 	return len(sw.Paths()), nil
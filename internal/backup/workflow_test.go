@@ -1,12 +1,18 @@
 package backup
 
 import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
 	"RestoreSafe/internal/security"
 	"RestoreSafe/internal/testutil"
 	"RestoreSafe/internal/util"
+	"archive/tar"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -35,7 +41,7 @@ func TestBackupDirectoryLogsTarBeforeEncryption(t *testing.T) {
 	}
 
 	cfg := &util.Config{SplitSizeMB: 1, IODiagnostics: false}
-	_, backupErr := backupDirectory(sourceDir, filepath.Base(sourceDir), backupDir, "2026-03-18", util.BackupID("ORD123"), []byte("pw"), security.DefaultArgon2Params, cfg, logger)
+	_, backupErr := backupDirectory(sourceDir, filepath.Base(sourceDir), backupDir, "2026-03-18", util.BackupID("ORD123"), []byte("pw"), security.DefaultArgon2Params, nil, cfg, logger)
 	logger.Close()
 	if backupErr != nil {
 		t.Fatalf("backupDirectory failed: %v", backupErr)
@@ -83,7 +89,7 @@ func TestBackupDirectoryLogsIODiagnosticsWhenEnabled(t *testing.T) {
 	}
 
 	cfg := &util.Config{SplitSizeMB: 1, IODiagnostics: true}
-	_, backupErr := backupDirectory(sourceDir, filepath.Base(sourceDir), backupDir, "2026-03-18", util.BackupID("DIA999"), []byte("pw"), security.DefaultArgon2Params, cfg, logger)
+	_, backupErr := backupDirectory(sourceDir, filepath.Base(sourceDir), backupDir, "2026-03-18", util.BackupID("DIA999"), []byte("pw"), security.DefaultArgon2Params, nil, cfg, logger)
 	logger.Close()
 	if backupErr != nil {
 		t.Fatalf("backupDirectory failed: %v", backupErr)
@@ -194,7 +200,7 @@ func TestBackupDirectoryLogsPartNamesAtInfoLevel(t *testing.T) {
 	}
 
 	cfg := &util.Config{SplitSizeMB: 1, IODiagnostics: false}
-	_, backupErr := backupDirectory(sourceDir, filepath.Base(sourceDir), backupDir, "2026-03-18", util.BackupID("ORD124"), []byte("pw"), security.DefaultArgon2Params, cfg, logger)
+	_, backupErr := backupDirectory(sourceDir, filepath.Base(sourceDir), backupDir, "2026-03-18", util.BackupID("ORD124"), []byte("pw"), security.DefaultArgon2Params, nil, cfg, logger)
 	logger.Close()
 	if backupErr != nil {
 		t.Fatalf("backupDirectory failed: %v", backupErr)
@@ -222,3 +228,162 @@ func TestBackupDirectoryLogsPartNamesAtInfoLevel(t *testing.T) {
 		t.Fatalf("expected created summary after part lines, got: %q", logContent)
 	}
 }
+
+func TestBackupDirectoryWritesManifest(t *testing.T) {
+	tempRoot := t.TempDir()
+	sourceDir := filepath.Join(tempRoot, "source")
+	backupDir := filepath.Join(tempRoot, "target")
+	if err := os.MkdirAll(sourceDir, 0o750); err != nil {
+		t.Fatalf("failed to create source dir: %v", err)
+	}
+	if err := os.MkdirAll(backupDir, 0o750); err != nil {
+		t.Fatalf("failed to create target dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "sample.txt"), []byte("hello"), 0o600); err != nil {
+		t.Fatalf("failed to write sample file: %v", err)
+	}
+
+	logger, err := util.NewLogger(filepath.Join(backupDir, "manifest.log"), "info")
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	cfg := &util.Config{SplitSizeMB: 1}
+	entry := util.BackupEntry{DirectoryName: "source", Date: "2026-03-18", ID: util.BackupID("MAN123")}
+	_, backupErr := backupDirectory(sourceDir, entry.DirectoryName, backupDir, entry.Date, entry.ID, []byte("pw"), security.DefaultArgon2Params, nil, cfg, logger)
+	logger.Close()
+	if backupErr != nil {
+		t.Fatalf("backupDirectory failed: %v", backupErr)
+	}
+
+	entries, ok, err := manifest.LoadForBackup(backupDir, entry, []byte("pw"))
+	if err != nil || !ok {
+		t.Fatalf("expected manifest next to the parts, got ok=%v err=%v", ok, err)
+	}
+	sample := manifest.NewIndex(entries)["sample.txt"]
+	if sample.Type != "file" || sample.Size != 5 || sample.SHA256 == "" {
+		t.Fatalf("unexpected manifest entry for sample.txt: %#v", sample)
+	}
+}
+
+func TestBackupDirectoryArchivesSingleFileSource(t *testing.T) {
+	tempRoot := t.TempDir()
+	sourceFile := filepath.Join(tempRoot, "vault.hc")
+	backupDir := filepath.Join(tempRoot, "target")
+	if err := os.MkdirAll(backupDir, 0o750); err != nil {
+		t.Fatalf("failed to create target dir: %v", err)
+	}
+	if err := os.WriteFile(sourceFile, []byte("container"), 0o600); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+
+	sources := resolveBackupSources([]string{sourceFile}, tempRoot)
+	if sources[0].Err != nil || sources[0].BackupName != "vault.hc" {
+		t.Fatalf("expected the file to be a valid source named vault.hc, got %+v", sources[0])
+	}
+
+	cfg := &util.Config{SplitSizeMB: 1}
+	entry := util.BackupEntry{DirectoryName: sources[0].BackupName, Date: "2026-03-18", ID: util.BackupID("FIL123")}
+	if _, err := backupDirectory(sourceFile, entry.DirectoryName, backupDir, entry.Date, entry.ID, []byte("pw"), security.DefaultArgon2Params, nil, cfg, nil); err != nil {
+		t.Fatalf("backupDirectory failed: %v", err)
+	}
+
+	entries, ok, err := manifest.LoadForBackup(backupDir, entry, []byte("pw"))
+	if err != nil || !ok {
+		t.Fatalf("expected manifest next to the parts, got ok=%v err=%v", ok, err)
+	}
+	if len(entries) != 1 || entries[0].Path != "vault.hc" || entries[0].Size != int64(len("container")) {
+		t.Fatalf("expected one entry named after the backup, got %#v", entries)
+	}
+	info, err := catalog.ReadRunInfo(backupDir, entry)
+	if err != nil || !info.IsFile() {
+		t.Fatalf("expected run metadata to mark a single-file backup, got %+v, %v", info, err)
+	}
+}
+
+func TestBackupDirectoryIncrementalStoresOnlyChangedFiles(t *testing.T) {
+	tempRoot := t.TempDir()
+	sourceDir := filepath.Join(tempRoot, "source")
+	backupDir := filepath.Join(tempRoot, "target")
+	if err := os.MkdirAll(sourceDir, 0o750); err != nil {
+		t.Fatalf("failed to create source dir: %v", err)
+	}
+	if err := os.MkdirAll(backupDir, 0o750); err != nil {
+		t.Fatalf("failed to create target dir: %v", err)
+	}
+	for name, body := range map[string]string{"keep.txt": "keep", "change.txt": "before", "gone.txt": "gone"} {
+		if err := os.WriteFile(filepath.Join(sourceDir, name), []byte(body), 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	password := []byte("pw")
+	cfg := &util.Config{SplitSizeMB: 1, BackupMode: util.BackupModeIncremental, MaxIncrementalChain: util.DefaultMaxIncrementalChain}
+	full := util.BackupEntry{DirectoryName: "source", Date: "2026-03-18", ID: util.BackupID("FUL001")}
+	if _, err := backupDirectory(sourceDir, full.DirectoryName, backupDir, full.Date, full.ID, password, security.DefaultArgon2Params, nil, cfg, nil); err != nil {
+		t.Fatalf("full backupDirectory failed: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(sourceDir, "change.txt"), []byte("after the change"), 0o600); err != nil {
+		t.Fatalf("failed to change file: %v", err)
+	}
+	if err := os.Remove(filepath.Join(sourceDir, "gone.txt")); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "new.txt"), []byte("new"), 0o600); err != nil {
+		t.Fatalf("failed to write new file: %v", err)
+	}
+
+	base := planIncrementalBase(cfg, backupDir, full.DirectoryName, map[string]util.BackupEntry{full.DirectoryName: full}, password, nil)
+	if base == nil {
+		t.Fatalf("expected an incremental backup based on %s", full.String())
+	}
+	incremental := util.BackupEntry{DirectoryName: "source", Date: "2026-03-19", ID: util.BackupID("INC001")}
+	if _, err := backupDirectory(sourceDir, incremental.DirectoryName, backupDir, incremental.Date, incremental.ID, password, security.DefaultArgon2Params, base, cfg, nil); err != nil {
+		t.Fatalf("incremental backupDirectory failed: %v", err)
+	}
+
+	info, err := catalog.ReadRunInfo(backupDir, incremental)
+	if err != nil || !info.IsIncremental() || info.Parent.Entry() != full {
+		t.Fatalf("expected run metadata with parent %s, got %#v, %v", full.String(), info, err)
+	}
+
+	header, entries, ok, err := manifest.LoadWithHeaderForBackup(backupDir, incremental, password)
+	if err != nil || !ok {
+		t.Fatalf("expected manifest, got ok=%v err=%v", ok, err)
+	}
+	if header.Parent != full.String() {
+		t.Fatalf("expected manifest parent %s, got %q", full.String(), header.Parent)
+	}
+	byPath := make(map[string]manifest.Entry)
+	for _, e := range entries {
+		byPath[e.Path] = e
+	}
+	if byPath["keep.txt"].Stored != full.String() || byPath["keep.txt"].SHA256 == "" {
+		t.Fatalf("expected keep.txt to be stored in the parent, got %#v", byPath["keep.txt"])
+	}
+	if !byPath["change.txt"].InArchive() || !byPath["new.txt"].InArchive() {
+		t.Fatalf("expected changed and new files in the archive, got %#v / %#v", byPath["change.txt"], byPath["new.txt"])
+	}
+	if !byPath["gone.txt"].Deleted() {
+		t.Fatalf("expected a deletion marker for gone.txt, got %#v", byPath["gone.txt"])
+	}
+
+	parts, err := catalog.CollectParts(backupDir, incremental)
+	if err != nil {
+		t.Fatalf("CollectParts failed: %v", err)
+	}
+	var archived []string
+	err = operation.RunDecryptPipeline(parts, password, nil, incremental.DirectoryName, "read", "Archive read", func(r io.Reader) error {
+		return util.WalkTar(r, func(hdr *tar.Header, _ io.Reader) error {
+			archived = append(archived, hdr.Name)
+			return nil
+		})
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to read incremental archive: %v", err)
+	}
+	sort.Strings(archived)
+	if strings.Join(archived, ",") != ".,change.txt,new.txt" {
+		t.Fatalf("expected only changed files in the archive, got %v", archived)
+	}
+}
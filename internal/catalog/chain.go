@@ -0,0 +1,182 @@
+package catalog
+
+import (
+	"RestoreSafe/internal/util"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Backup types recorded in run metadata.
+const (
+	BackupTypeFull        = "full"
+	BackupTypeIncremental = "incremental"
+)
+
+// Source types recorded in run metadata. Backups of a directory leave the source empty.
+const (
+	SourceTypeFile = "file"
+	// SourceTypeCommand marks the backup of a command's output. Its archive is the
+	// raw output stream instead of a TAR; the manifest describes it as one file.
+	SourceTypeCommand = "command"
+	// SourceTypeStdin marks the backup of a stream read from standard input. It is
+	// stored like the output of a command.
+	SourceTypeStdin = "stdin"
+)
+
+// RunInfo is the plain-text metadata stored next to the parts of a backup entry.
+// It is readable without the password so retention and the health check can follow
+// incremental chains.
+type RunInfo struct {
+	Type   string      `json:"type"`
+	Parent *ParentInfo `json:"parent,omitempty"`
+	// Source is SourceTypeFile, SourceTypeCommand or SourceTypeStdin when the backup
+	// holds a single file or a stream instead of a directory.
+	Source string `json:"source,omitempty"`
+	// StateTime is set for a consolidated backup: just after the time of the backup
+	// it replaces. Its own parts are newer than runs taken after that backup, so
+	// BackupTime orders it by StateTime instead.
+	StateTime time.Time `json:"state_time,omitzero"`
+}
+
+// ParentInfo identifies the backup entry an incremental run is based on.
+type ParentInfo struct {
+	DirectoryName string `json:"directory"`
+	Date          string `json:"date"`
+	ID            string `json:"id"`
+}
+
+// Entry returns the parent as a backup entry.
+func (p ParentInfo) Entry() util.BackupEntry {
+	return util.BackupEntry{DirectoryName: p.DirectoryName, Date: p.Date, ID: util.BackupID(p.ID)}
+}
+
+// NewIncrementalRunInfo returns the metadata of an incremental run based on parent.
+func NewIncrementalRunInfo(parent util.BackupEntry) RunInfo {
+	return RunInfo{
+		Type:   BackupTypeIncremental,
+		Parent: &ParentInfo{DirectoryName: parent.DirectoryName, Date: parent.Date, ID: string(parent.ID)},
+	}
+}
+
+// IsIncremental reports whether the run depends on a parent backup.
+func (r RunInfo) IsIncremental() bool {
+	return r.Type == BackupTypeIncremental && r.Parent != nil
+}
+
+// IsFile reports whether the backup holds a single file, which is restored directly
+// into the restore directory instead of into a subdirectory.
+func (r RunInfo) IsFile() bool {
+	return r.Source == SourceTypeFile
+}
+
+// IsStream reports whether the archive of the backup is a raw stream, not a TAR.
+func (r RunInfo) IsStream() bool {
+	return r.Source == SourceTypeCommand || r.Source == SourceTypeStdin
+}
+
+// WriteRunInfo writes the run metadata of entry into backupDir.
+func WriteRunInfo(backupDir string, entry util.BackupEntry, info RunInfo) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := util.RunInfoFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID)
+	if err := util.WriteStorageFile(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("Failed to write run metadata %q: %w. Remedy: Check write permissions in the backup directory.", path, err)
+	}
+	return nil
+}
+
+// ReadRunInfo reads the run metadata of entry. Backups without metadata, such as
+// those created before incremental backups were introduced, are full backups.
+func ReadRunInfo(backupDir string, entry util.BackupEntry) (RunInfo, error) {
+	path := util.RunInfoFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID)
+	data, err := util.ReadStorageFile(path)
+	if os.IsNotExist(err) {
+		return RunInfo{Type: BackupTypeFull}, nil
+	}
+	if err != nil {
+		return RunInfo{}, fmt.Errorf("Failed to read run metadata %q: %w. Remedy: Check read permissions in the backup directory.", path, err)
+	}
+	var info RunInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return RunInfo{}, fmt.Errorf("Invalid run metadata %q: %w. Remedy: Restore the file from a copy of the backup directory; incremental backups cannot be restored without it.", path, err)
+	}
+	if info.Type == BackupTypeIncremental && info.Parent == nil {
+		return RunInfo{}, fmt.Errorf("Invalid run metadata %q: incremental backup without parent. Remedy: Restore the file from a copy of the backup directory.", path)
+	}
+	return info, nil
+}
+
+// ResolveChain returns the backup entries needed to restore entry, starting with
+// the full backup and ending with entry itself. It fails when a parent is missing
+// from backupDir or the chain loops.
+func ResolveChain(backupDir string, entry util.BackupEntry) ([]util.BackupEntry, error) {
+	chain := []util.BackupEntry{entry}
+	seen := map[util.BackupEntry]bool{entry: true}
+	current := entry
+	for {
+		info, err := ReadRunInfo(backupDir, current)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsIncremental() {
+			break
+		}
+		parent := info.Parent.Entry()
+		if seen[parent] {
+			return nil, fmt.Errorf("Backup chain of %s loops at %s. Remedy: Check the .run.json files of this backup chain.", entry.String(), parent.String())
+		}
+		parts, err := CollectParts(backupDir, parent)
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) == 0 {
+			return nil, fmt.Errorf("Backup chain of %s is incomplete: parent backup %s is missing. Remedy: Put all .enc files of the parent backup into the backup directory; an incremental backup cannot be restored without its parents.", entry.String(), parent.String())
+		}
+		seen[parent] = true
+		chain = append(chain, parent)
+		current = parent
+	}
+
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain, nil
+}
+
+// BackupTime returns the time that orders entry among the backups of its directory:
+// the newest modification time of its parts, or the time recorded for a
+// consolidated backup.
+func BackupTime(backupDir string, entry util.BackupEntry) (time.Time, error) {
+	info, err := ReadRunInfo(backupDir, entry)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !info.StateTime.IsZero() {
+		return info.StateTime, nil
+	}
+	return NewestPartModTime(backupDir, entry)
+}
+
+// NewestEntryPerDirectory returns the newest backup entry of every directory name in index.
+func NewestEntryPerDirectory(backupDir string, index []util.BackupEntry) (map[string]util.BackupEntry, error) {
+	newest := make(map[string]util.BackupEntry)
+	if len(index) == 0 {
+		return newest, nil
+	}
+	runs, err := BackupRunSummaries(backupDir, index)
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range runs {
+		for _, entry := range run.Entries {
+			if _, ok := newest[entry.DirectoryName]; !ok {
+				newest[entry.DirectoryName] = entry
+			}
+		}
+	}
+	return newest, nil
+}
@@ -0,0 +1,77 @@
+package catalog
+
+import (
+	"RestoreSafe/internal/util"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestResolveChainReturnsFullBackupFirst(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	full := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-12", ID: util.BackupID("FUL001")}
+	inc1 := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-13", ID: util.BackupID("INC001")}
+	inc2 := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-14", ID: util.BackupID("INC002")}
+	for _, entry := range []util.BackupEntry{full, inc1, inc2} {
+		writeChainPart(t, dir, entry)
+	}
+	writeChainRunInfo(t, dir, inc1, NewIncrementalRunInfo(full))
+	writeChainRunInfo(t, dir, inc2, NewIncrementalRunInfo(inc1))
+
+	chain, err := ResolveChain(dir, inc2)
+	if err != nil {
+		t.Fatalf("ResolveChain returned error: %v", err)
+	}
+	if len(chain) != 3 || chain[0] != full || chain[1] != inc1 || chain[2] != inc2 {
+		t.Fatalf("unexpected chain: %v", chain)
+	}
+
+	chain, err = ResolveChain(dir, full)
+	if err != nil || len(chain) != 1 || chain[0] != full {
+		t.Fatalf("expected a full backup to be its own chain, got %v, %v", chain, err)
+	}
+}
+
+func TestResolveChainFailsForMissingParent(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	parent := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-13", ID: util.BackupID("GONE01")}
+	entry := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-14", ID: util.BackupID("INC001")}
+	writeChainPart(t, dir, entry)
+	writeChainRunInfo(t, dir, entry, NewIncrementalRunInfo(parent))
+
+	_, err := ResolveChain(dir, entry)
+	if err == nil || !strings.Contains(err.Error(), "parent backup "+parent.String()+" is missing") {
+		t.Fatalf("expected missing parent error, got: %v", err)
+	}
+}
+
+func TestReadRunInfoTreatsMissingFileAsFullBackup(t *testing.T) {
+	t.Parallel()
+
+	entry := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-14", ID: util.BackupID("ABC123")}
+	info, err := ReadRunInfo(t.TempDir(), entry)
+	if err != nil {
+		t.Fatalf("ReadRunInfo returned error: %v", err)
+	}
+	if info.Type != BackupTypeFull || info.IsIncremental() {
+		t.Fatalf("expected full backup, got %#v", info)
+	}
+}
+
+func writeChainPart(t *testing.T, dir string, entry util.BackupEntry) {
+	t.Helper()
+	if err := os.WriteFile(util.PartFileName(dir, entry.DirectoryName, entry.Date, entry.ID, 1), []byte("x"), 0o600); err != nil {
+		t.Fatalf("failed to write part: %v", err)
+	}
+}
+
+func writeChainRunInfo(t *testing.T, dir string, entry util.BackupEntry, info RunInfo) {
+	t.Helper()
+	if err := WriteRunInfo(dir, entry, info); err != nil {
+		t.Fatalf("WriteRunInfo returned error: %v", err)
+	}
+}
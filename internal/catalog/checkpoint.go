@@ -0,0 +1,106 @@
+package catalog
+
+import (
+	"RestoreSafe/internal/util"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RunCheckpoint records the progress of a backup run in its checkpoint file, so
+// that an interrupted run can be resumed instead of started over. It is rewritten
+// whenever a backup set or a part of it is complete, and removed by MarkRunComplete.
+type RunCheckpoint struct {
+	// Completed names the backup sets of the run that are complete.
+	Completed []string `json:"completed"`
+	// Current is the progress of the backup set that was being written.
+	Current *SetCheckpoint `json:"current,omitempty"`
+}
+
+// SetCheckpoint is the progress of a backup set whose TAR stream is encrypted
+// into part files. Every part ends at a chunk boundary of the encrypted stream,
+// so the set continues with the next chunk after its finished parts.
+type SetCheckpoint struct {
+	Name string `json:"name"`
+	// Parent is the backup entry an incremental set is based on.
+	Parent string `json:"parent,omitempty"`
+	// Parts is the number of finished parts; StreamBytes is their total size.
+	Parts       int   `json:"parts"`
+	StreamBytes int64 `json:"stream_bytes"`
+	// Chunks is the number of encrypted chunks in the finished parts, which is
+	// the index of the next chunk.
+	Chunks uint64 `json:"chunks"`
+	// TarOffset is the TAR stream position the next chunk starts at, and TarSHA256
+	// the hash of the TAR stream before it.
+	TarOffset int64  `json:"tar_offset"`
+	TarSHA256 string `json:"tar_sha256"`
+	// Files is the number of TAR entries that start before TarOffset, and LastFile
+	// the name of the last of them.
+	Files    int    `json:"files"`
+	LastFile string `json:"last_file,omitempty"`
+}
+
+// IsCompleted reports whether the backup set name is complete.
+func (c RunCheckpoint) IsCompleted(name string) bool {
+	for _, completed := range c.Completed {
+		if completed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteCheckpoint writes the checkpoint of run date/id into backupDir.
+func WriteCheckpoint(backupDir, date string, id util.BackupID, checkpoint RunCheckpoint) error {
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := util.CheckpointFileName(backupDir, date, id)
+	if err := util.WriteStorageFile(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("Failed to write checkpoint %q: %w. Remedy: Check write permissions in the backup directory.", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// ReadCheckpoint reads the checkpoint of run date/id from backupDir. found is
+// false when the run has no checkpoint.
+func ReadCheckpoint(backupDir, date string, id util.BackupID) (checkpoint RunCheckpoint, found bool, err error) {
+	path := util.CheckpointFileName(backupDir, date, id)
+	data, err := util.ReadStorageFile(path)
+	if os.IsNotExist(err) {
+		return RunCheckpoint{}, false, nil
+	}
+	if err != nil {
+		return RunCheckpoint{}, false, fmt.Errorf("Failed to read checkpoint %q: %w. Remedy: Check read permissions in the backup directory.", filepath.Base(path), err)
+	}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return RunCheckpoint{}, false, fmt.Errorf("Invalid checkpoint %q: %w. Remedy: Start a new backup run; delete the interrupted run with cleanup-incomplete.", filepath.Base(path), err)
+	}
+	return checkpoint, true, nil
+}
+
+// ResumableRun is an incomplete run that has a checkpoint.
+type ResumableRun struct {
+	IncompleteRun
+	Checkpoint RunCheckpoint
+}
+
+// FindResumableRuns returns the incomplete runs in backupDir that have a valid
+// checkpoint, oldest first.
+func FindResumableRuns(backupDir string) ([]ResumableRun, error) {
+	runs, err := FindIncompleteRuns(backupDir)
+	if err != nil {
+		return nil, err
+	}
+	var result []ResumableRun
+	for _, run := range runs {
+		checkpoint, found, err := ReadCheckpoint(backupDir, run.Date, run.ID)
+		if err != nil || !found {
+			continue
+		}
+		result = append(result, ResumableRun{IncompleteRun: run, Checkpoint: checkpoint})
+	}
+	return result, nil
+}
@@ -0,0 +1,234 @@
+package catalog
+
+import (
+	"RestoreSafe/internal/util"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MarkRunStarted writes the incomplete-run marker of run date/id into backupDir
+// before the run writes its first file. Until MarkRunComplete is called, the run
+// is incomplete: ScanBackups hides its sets, so the sets of an interrupted run are
+// neither restored nor counted by retention.
+func MarkRunStarted(backupDir, date string, id util.BackupID) error {
+	marker := util.IncompleteRunFileName(backupDir, date, id)
+	reason := fmt.Sprintf("Backup run %s_%s is incomplete in this directory: the run started %s and has not completed\n", date, string(id), time.Now().Format("2006-01-02 15:04:05"))
+	if err := util.WriteStorageFile(marker, []byte(reason)); err != nil {
+		return fmt.Errorf("Failed to write run marker %q: %w. Remedy: Check write permissions in the backup directory.", filepath.Base(marker), err)
+	}
+	return nil
+}
+
+// MarkRunComplete writes the completion marker of run date/id into backupDir once
+// every backup set of the run is written, and removes its incomplete-run marker
+// and checkpoint.
+func MarkRunComplete(backupDir, date string, id util.BackupID) error {
+	marker := util.CompleteRunFileName(backupDir, date, id)
+	note := fmt.Sprintf("Backup run %s_%s completed %s\n", date, string(id), time.Now().Format("2006-01-02 15:04:05"))
+	if err := util.WriteStorageFile(marker, []byte(note)); err != nil {
+		return fmt.Errorf("Failed to write run marker %q: %w. Remedy: Check write permissions in the backup directory.", filepath.Base(marker), err)
+	}
+	return removeRunMarkers(backupDir, date, id)
+}
+
+// MarkVolumeFinished removes the incomplete-run marker and checkpoint of run date/id
+// from backupDir before the medium holding a full volume of a run spanning removable
+// media is removed. Its volume label keeps the sets on it hidden until the label of
+// the last volume is listed, and cleanup leaves them alone.
+func MarkVolumeFinished(backupDir, date string, id util.BackupID) error {
+	return removeRunMarkers(backupDir, date, id)
+}
+
+// removeRunMarkers removes the incomplete-run marker and checkpoint of run date/id.
+func removeRunMarkers(backupDir, date string, id util.BackupID) error {
+	for _, path := range []string{util.IncompleteRunFileName(backupDir, date, id), util.CheckpointFileName(backupDir, date, id)} {
+		if err := util.StorageFor(path).Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("Failed to remove run marker %q: %w. Remedy: Check delete permissions in the backup directory.", filepath.Base(path), err)
+		}
+	}
+	return nil
+}
+
+// IsRunIncomplete reports whether run date/id in backupDir is incomplete.
+func IsRunIncomplete(backupDir, date string, id util.BackupID) bool {
+	runs, err := FindIncompleteRuns(backupDir)
+	if err != nil {
+		return false
+	}
+	for _, run := range runs {
+		if run.Date == date && run.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// IncompleteRun is a backup run whose files in a backup directory must not be
+// relied on: it has an incomplete-run marker or unfinished part files, and no
+// completion marker. Runs written before run markers were introduced have neither
+// marker and count as complete.
+type IncompleteRun struct {
+	Date string
+	ID   util.BackupID
+	// Reason is the reason recorded in the incomplete-run marker.
+	Reason string
+	// Entries are the backup sets of the run with at least one finished part or a snapshot.
+	Entries []util.BackupEntry
+	// Files are the paths of all files of the run except its log file, sorted by name.
+	Files []string
+}
+
+// String returns the run as YYYY-MM-DD_ID.
+func (r IncompleteRun) String() string {
+	return r.Date + "_" + string(r.ID)
+}
+
+// runState collects the files of one run found in a backup directory listing.
+// spanned is set for a run with a volume label: a run spanning removable media.
+type runState struct {
+	started, completed, partial, spanned bool
+	entries                              []util.BackupEntry
+	files                                []string
+}
+
+// scanRuns groups the files of des by run key. Files that belong to no run, such
+// as log files, are left out.
+func scanRuns(des []fs.DirEntry) map[string]*runState {
+	runs := make(map[string]*runState)
+	state := func(date string, id util.BackupID) *runState {
+		key := date + "|" + string(id)
+		if runs[key] == nil {
+			runs[key] = &runState{}
+		}
+		return runs[key]
+	}
+	for _, de := range des {
+		if de.IsDir() {
+			continue
+		}
+		name := de.Name()
+		if date, id, suffix, ok := util.ParseRunMarkerFileName(name); ok {
+			s := state(date, id)
+			s.started = s.started || suffix == util.IncompleteRunFileSuffix
+			s.completed = s.completed || suffix == util.CompleteRunFileSuffix
+			s.spanned = s.spanned || suffix == util.VolumeLabelFileSuffix
+			s.files = append(s.files, name)
+			continue
+		}
+		unfinished := strings.TrimSuffix(strings.TrimSuffix(name, util.PartialFileSuffix), util.RemnantFileSuffix)
+		if entry, _, ok := util.ParsePartFileName(unfinished); ok {
+			s := state(entry.Date, entry.ID)
+			if unfinished != name {
+				s.partial = true
+			} else if !containsEntry(s.entries, entry) {
+				s.entries = append(s.entries, entry)
+			}
+			s.files = append(s.files, name)
+			continue
+		}
+		if entry, ok := util.ParseSnapshotFileName(name); ok {
+			s := state(entry.Date, entry.ID)
+			if !containsEntry(s.entries, entry) {
+				s.entries = append(s.entries, entry)
+			}
+			s.files = append(s.files, name)
+			continue
+		}
+		if entry, ok := parseSidecarFileName(name); ok {
+			s := state(entry.Date, entry.ID)
+			s.files = append(s.files, name)
+		}
+	}
+	return runs
+}
+
+// incomplete reports whether the run has not completed.
+func (s *runState) incomplete() bool {
+	return (s.started || s.partial) && !s.completed
+}
+
+// hidden reports whether the sets of the run must not be restored: the run is
+// incomplete, or the directory holds an earlier volume of a spanned run without the
+// label of its last volume, which lists the parts on the other volumes.
+func (s *runState) hidden() bool {
+	return s.incomplete() || s.spanned && !s.completed
+}
+
+// sidecarFilePattern matches:  [name]_{YYYY-MM-DD}_{ID}.challenge, .manifest.enc and .run.json
+var sidecarFilePattern = regexp.MustCompile(
+	`^\[(.+?)\]_(\d{4}-\d{2}-\d{2})_([A-Z0-9]{6})\.(?:challenge|manifest\.enc|run\.json)$`,
+)
+
+func parseSidecarFileName(name string) (util.BackupEntry, bool) {
+	m := sidecarFilePattern.FindStringSubmatch(name)
+	if m == nil {
+		return util.BackupEntry{}, false
+	}
+	return util.BackupEntry{DirectoryName: m[1], Date: m[2], ID: util.BackupID(m[3])}, true
+}
+
+func containsEntry(entries []util.BackupEntry, entry util.BackupEntry) bool {
+	for _, e := range entries {
+		if e == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// FindIncompleteRuns returns the incomplete runs in backupDir, oldest first.
+func FindIncompleteRuns(backupDir string) ([]IncompleteRun, error) {
+	des, err := util.StorageFor(backupDir).List(backupDir)
+	if err != nil {
+		return nil, err
+	}
+	var result []IncompleteRun
+	for key, s := range scanRuns(des) {
+		if !s.incomplete() {
+			continue
+		}
+		date, id, _ := strings.Cut(key, "|")
+		run := IncompleteRun{Date: date, ID: util.BackupID(id), Entries: s.entries, Reason: "unfinished part files"}
+		sort.Strings(s.files)
+		for _, name := range s.files {
+			run.Files = append(run.Files, filepath.Join(backupDir, name))
+		}
+		if s.started {
+			run.Reason = readMarkerReason(util.IncompleteRunFileName(backupDir, date, run.ID))
+		}
+		result = append(result, run)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].String() < result[j].String() })
+	return result, nil
+}
+
+// readMarkerReason returns the reason recorded in an incomplete-run marker.
+func readMarkerReason(path string) string {
+	reason := "the run did not complete"
+	if data, err := util.ReadStorageFile(path); err == nil {
+		if _, after, ok := strings.Cut(strings.TrimSpace(string(data)), ": "); ok {
+			reason = after
+		}
+	}
+	return reason
+}
+
+// RemoveIncompleteRun deletes the files of run and returns the number of files
+// deleted. The log file of the run is kept; retention removes it later.
+func RemoveIncompleteRun(run IncompleteRun) (int, error) {
+	removed := 0
+	for _, path := range run.Files {
+		if err := util.StorageFor(path).Remove(path); err == nil {
+			removed++
+		} else if !os.IsNotExist(err) {
+			return removed, fmt.Errorf("Failed to delete %q: %w. Remedy: Check delete permissions in the backup directory.", filepath.Base(path), err)
+		}
+	}
+	return removed, nil
+}
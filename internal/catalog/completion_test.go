@@ -0,0 +1,91 @@
+package catalog
+
+import (
+	"RestoreSafe/internal/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", filepath.Base(path), err)
+	}
+}
+
+func TestScanBackupsHidesIncompleteRuns(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	legacy := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-13", ID: util.BackupID("LEG001")}
+	complete := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-14", ID: util.BackupID("CMP001")}
+	started := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-15", ID: util.BackupID("RUN001")}
+	crashed := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-16", ID: util.BackupID("CRS001")}
+	for _, entry := range []util.BackupEntry{legacy, complete, started, crashed} {
+		writeTestFile(t, util.PartFileName(dir, entry.DirectoryName, entry.Date, entry.ID, 1))
+	}
+	if err := MarkRunStarted(dir, complete.Date, complete.ID); err != nil {
+		t.Fatalf("MarkRunStarted failed: %v", err)
+	}
+	if err := MarkRunComplete(dir, complete.Date, complete.ID); err != nil {
+		t.Fatalf("MarkRunComplete failed: %v", err)
+	}
+	if err := MarkRunStarted(dir, started.Date, started.ID); err != nil {
+		t.Fatalf("MarkRunStarted failed: %v", err)
+	}
+	// A crash while writing the second part leaves it under its partial name.
+	writeTestFile(t, util.PartialFileName(util.PartFileName(dir, crashed.DirectoryName, crashed.Date, crashed.ID, 2)))
+	writeTestFile(t, util.RunInfoFileName(dir, crashed.DirectoryName, crashed.Date, crashed.ID))
+
+	index, err := ScanBackups(dir)
+	if err != nil || len(index) != 2 {
+		t.Fatalf("expected only the legacy and the complete run, got %v, %v", index, err)
+	}
+	for _, entry := range index {
+		if entry != legacy && entry != complete {
+			t.Fatalf("unexpected entry in index: %s", entry.String())
+		}
+	}
+	if _, err := os.Stat(util.IncompleteRunFileName(dir, complete.Date, complete.ID)); !os.IsNotExist(err) {
+		t.Fatalf("expected MarkRunComplete to remove the incomplete-run marker, got %v", err)
+	}
+
+	runs, err := FindIncompleteRuns(dir)
+	if err != nil || len(runs) != 2 {
+		t.Fatalf("expected two incomplete runs, got %v, %v", runs, err)
+	}
+	if runs[0].String() != "2026-03-15_RUN001" || !strings.Contains(runs[0].Reason, "has not completed") || len(runs[0].Files) != 2 {
+		t.Fatalf("unexpected started run: %+v", runs[0])
+	}
+	if runs[1].String() != "2026-03-16_CRS001" || runs[1].Reason != "unfinished part files" || len(runs[1].Files) != 3 || len(runs[1].Entries) != 1 {
+		t.Fatalf("unexpected crashed run: %+v", runs[1])
+	}
+	if !IsRunIncomplete(dir, crashed.Date, crashed.ID) || IsRunIncomplete(dir, legacy.Date, legacy.ID) {
+		t.Fatal("IsRunIncomplete disagrees with FindIncompleteRuns")
+	}
+}
+
+func TestScanBackupsHidesEarlierVolumesOfSpannedRuns(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	entry := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-17", ID: util.BackupID("VOL001")}
+	writeTestFile(t, util.PartFileName(dir, entry.DirectoryName, entry.Date, entry.ID, 1))
+	writeTestFile(t, util.VolumeLabelFileName(dir, entry.Date, entry.ID))
+	if err := MarkRunStarted(dir, entry.Date, entry.ID); err != nil {
+		t.Fatalf("MarkRunStarted failed: %v", err)
+	}
+	if err := MarkVolumeFinished(dir, entry.Date, entry.ID); err != nil {
+		t.Fatalf("MarkVolumeFinished failed: %v", err)
+	}
+
+	// A full volume is neither listed nor taken for an interrupted run.
+	if index, err := ScanBackups(dir); err != nil || len(index) != 0 {
+		t.Fatalf("expected no runs on an earlier volume, got %v, %v", index, err)
+	}
+	if runs, err := FindIncompleteRuns(dir); err != nil || len(runs) != 0 {
+		t.Fatalf("expected no incomplete runs, got %v, %v", runs, err)
+	}
+}
@@ -3,13 +3,15 @@ package catalog
 import (
 	"RestoreSafe/internal/util"
 	"fmt"
-	"os"
+	"path/filepath"
 	"sort"
 )
 
 // InspectBackupParts validates split-part continuity and returns part count and total size.
+// A snapshot of the chunked repository is reported as one part of the snapshot's size;
+// its chunks are shared with other snapshots and are checked by verify.
 func InspectBackupParts(backupDir string, entry util.BackupEntry) (int, int64, error) {
-	entries, err := os.ReadDir(backupDir)
+	entries, err := util.StorageFor(backupDir).List(backupDir)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -37,6 +39,15 @@ func InspectBackupParts(backupDir string, entry util.BackupEntry) (int, int64, e
 	}
 
 	if len(parts) == 0 {
+		if path, found, err := FindSnapshotFile(backupDir, entry); err != nil {
+			return 0, 0, err
+		} else if found {
+			info, err := util.StorageFor(path).Stat(path)
+			if err != nil {
+				return 0, 0, fmt.Errorf("Failed to inspect snapshot file %q: %w", filepath.Base(path), err)
+			}
+			return 1, info.Size(), nil
+		}
 		return 0, 0, fmt.Errorf("No part files found. Remedy: Ensure the .enc files are present in the backup directory.")
 	}
 
@@ -10,12 +10,17 @@ import (
 	"time"
 )
 
-// ScanBackups walks backupDir and builds an index of all backup entries.
+// ScanBackups walks backupDir and builds an index of all backup entries, both
+// split-TAR backups (.enc parts) and snapshots of the chunked repository.
+// Entries of incomplete runs are left out; see FindIncompleteRuns. So are the
+// entries of a run spanning removable media while its last volume has not been
+// listed; see util.MediaStorage.
 func ScanBackups(backupDir string) ([]util.BackupEntry, error) {
-	entries, err := os.ReadDir(backupDir)
+	entries, err := util.StorageFor(backupDir).List(backupDir)
 	if err != nil {
 		return nil, err
 	}
+	runs := scanRuns(entries)
 
 	seen := make(map[string]bool)
 	var result []util.BackupEntry
@@ -26,6 +31,11 @@ func ScanBackups(backupDir string) ([]util.BackupEntry, error) {
 		}
 		entry, _, ok := util.ParsePartFileName(de.Name())
 		if !ok {
+			if entry, ok = util.ParseSnapshotFileName(de.Name()); !ok {
+				continue
+			}
+		}
+		if s := runs[entry.Date+"|"+string(entry.ID)]; s != nil && s.hidden() {
 			continue
 		}
 		key := entry.String()
@@ -40,7 +50,7 @@ func ScanBackups(backupDir string) ([]util.BackupEntry, error) {
 
 // CollectParts returns the sorted part file paths for an entry.
 func CollectParts(backupDir string, entry util.BackupEntry) ([]string, error) {
-	des, err := os.ReadDir(backupDir)
+	des, err := util.StorageFor(backupDir).List(backupDir)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to read backup directory %q: %w", backupDir, err)
 	}
@@ -98,7 +108,7 @@ func BackupRunUsesYubiKey(backupDir string, entry util.BackupEntry) (bool, bool,
 
 // FindChallengeFileForRun returns the .challenge file path for date+ID if present.
 func FindChallengeFileForRun(backupDir, date string, id util.BackupID) (string, bool, error) {
-	entries, err := os.ReadDir(backupDir)
+	entries, err := util.StorageFor(backupDir).List(backupDir)
 	if err != nil {
 		return "", false, err
 	}
@@ -116,10 +126,50 @@ func FindChallengeFileForRun(backupDir, date string, id util.BackupID) (string,
 	return "", false, nil
 }
 
+// FindManifestFile returns the encrypted manifest path of entry if it exists.
+// Backups created before manifests were introduced have none.
+func FindManifestFile(backupDir string, entry util.BackupEntry) (string, bool, error) {
+	path := util.ManifestFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID)
+	info, err := util.StorageFor(path).Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	if info.IsDir() {
+		return "", false, nil
+	}
+	return path, true, nil
+}
+
+// FindSnapshotFile returns the encrypted snapshot path of entry if the backup is
+// stored in the chunked repository format.
+func FindSnapshotFile(backupDir string, entry util.BackupEntry) (string, bool, error) {
+	path := util.SnapshotFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID)
+	info, err := util.StorageFor(path).Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	if info.IsDir() {
+		return "", false, nil
+	}
+	return path, true, nil
+}
+
+// IsSnapshot reports whether entry is stored in the chunked repository format.
+func IsSnapshot(backupDir string, entry util.BackupEntry) bool {
+	_, found, err := FindSnapshotFile(backupDir, entry)
+	return err == nil && found
+}
+
 // IsChallengeFileYubiKeyOnly reports whether the challenge file was written
 // for a YubiKey-only (no-password) backup by checking for the "NOPW:" prefix.
 func IsChallengeFileYubiKeyOnly(path string) bool {
-	data, err := os.ReadFile(path)
+	data, err := util.ReadStorageFile(path)
 	if err != nil {
 		return false
 	}
@@ -127,18 +177,24 @@ func IsChallengeFileYubiKeyOnly(path string) bool {
 }
 
 // NewestPartModTime returns the newest modification time among all part files.
+// For a snapshot of the chunked repository, the snapshot file counts as its part.
 func NewestPartModTime(backupDir string, entry util.BackupEntry) (time.Time, error) {
 	parts, err := CollectParts(backupDir, entry)
 	if err != nil {
 		return time.Time{}, err
 	}
+	if len(parts) == 0 {
+		if path, found, err := FindSnapshotFile(backupDir, entry); err == nil && found {
+			parts = []string{path}
+		}
+	}
 	if len(parts) == 0 {
 		return time.Time{}, fmt.Errorf("No part files found. Remedy: Ensure all .enc parts for this backup are present in the backup directory.")
 	}
 
 	var newest time.Time
 	for _, part := range parts {
-		fi, err := os.Stat(part)
+		fi, err := util.StorageFor(part).Stat(part)
 		if err != nil {
 			return newest, err
 		}
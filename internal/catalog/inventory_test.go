@@ -222,3 +222,52 @@ func TestNewestPartModTimeErrorsForMissingParts(t *testing.T) {
 		t.Fatal("expected error for missing parts, got nil")
 	}
 }
+
+func TestFindManifestFileFindsMatchingFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	entry := util.BackupEntry{DirectoryName: "Music", Date: "2026-03-15", ID: util.BackupID("ABC123")}
+	if _, ok, err := FindManifestFile(dir, entry); err != nil || ok {
+		t.Fatalf("expected no manifest before it is written, got ok=%v err=%v", ok, err)
+	}
+
+	manifestPath := util.ManifestFileName(dir, entry.DirectoryName, entry.Date, entry.ID)
+	if err := os.WriteFile(manifestPath, []byte("x"), 0o600); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	found, ok, err := FindManifestFile(dir, entry)
+	if err != nil || !ok || found != manifestPath {
+		t.Fatalf("expected %s, got %s ok=%v err=%v", manifestPath, found, ok, err)
+	}
+}
+
+func TestScanBackupsIndexesRepositorySnapshots(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	entry := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-14", ID: util.BackupID("SNP001")}
+	snapshotPath := util.SnapshotFileName(dir, entry.DirectoryName, entry.Date, entry.ID)
+	if err := os.WriteFile(snapshotPath, []byte("snapshot"), 0o600); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+
+	index, err := ScanBackups(dir)
+	if err != nil {
+		t.Fatalf("ScanBackups returned error: %v", err)
+	}
+	if len(index) != 1 || index[0] != entry {
+		t.Fatalf("expected the snapshot entry, got %#v", index)
+	}
+	if !IsSnapshot(dir, entry) {
+		t.Fatalf("expected %s to be a snapshot", entry.String())
+	}
+
+	partCount, size, err := InspectBackupParts(dir, entry)
+	if err != nil || partCount != 1 || size != int64(len("snapshot")) {
+		t.Fatalf("expected the snapshot to count as one part, got %d parts, %d bytes, %v", partCount, size, err)
+	}
+	if _, err := NewestPartModTime(dir, entry); err != nil {
+		t.Fatalf("NewestPartModTime returned error for snapshot: %v", err)
+	}
+}
@@ -18,7 +18,7 @@ type BackupRunSummary struct {
 func BackupRunSummaries(backupDir string, index []util.BackupEntry) ([]BackupRunSummary, error) {
 	runsByKey := make(map[string]BackupRunSummary)
 	for _, entry := range index {
-		newestTime, err := NewestPartModTime(backupDir, entry)
+		newestTime, err := BackupTime(backupDir, entry)
 		if err != nil {
 			return nil, fmt.Errorf("Failed to inspect backup sets: %w", err)
 		}
@@ -0,0 +1,136 @@
+// Package cleanup deletes incomplete backup runs from the backup directories:
+//  1. Find the runs in every backup directory that have an incomplete-run marker
+//     or unfinished .partial part files and no completion marker
+//  2. Show the runs and their files and ask for confirmation
+//  3. Delete the part files, sidecar files and run markers of each run
+//
+// The log file of a deleted run is kept until retention removes it, so the
+// reason of the failure can still be looked up.
+package cleanup
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/util"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Run deletes the incomplete runs in every backup directory after confirmation.
+func Run(cfg *util.Config, exeDir string) error {
+	var dirs []string
+	for _, dir := range cfg.BackupDestinations() {
+		dirs = append(dirs, util.ResolveDir(dir, exeDir))
+	}
+
+	for _, dir := range dirs {
+		lock, err := util.AcquireBackupLock(dir)
+		if err != nil {
+			return err
+		}
+		defer lock.Release()
+	}
+
+	plan := buildCleanupPlan(dirs)
+	printCleanupPreflight(os.Stdout, plan)
+	if countRuns(plan) == 0 {
+		fmt.Println()
+		fmt.Println("Nothing to clean up: no incomplete backup runs found.")
+		return nil
+	}
+
+	confirmed, err := operation.PromptStartAction("cleanup")
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		fmt.Println("Cleanup cancelled.")
+		return nil
+	}
+
+	log := util.NewConsoleLogger(cfg.LogLevel)
+	deletedRuns, deletedFiles, err := deleteRuns(plan, log)
+	if err != nil {
+		return err
+	}
+	log.Info("Cleanup completed successfully: %d incomplete run(s) deleted (%d file(s)).", deletedRuns, deletedFiles)
+	return nil
+}
+
+// cleanupItem holds the incomplete runs of one backup directory.
+type cleanupItem struct {
+	Dir  string
+	Runs []catalog.IncompleteRun
+	Err  error
+}
+
+func buildCleanupPlan(dirs []string) []cleanupItem {
+	plan := make([]cleanupItem, 0, len(dirs))
+	for _, dir := range dirs {
+		item := cleanupItem{Dir: dir}
+		item.Runs, item.Err = catalog.FindIncompleteRuns(dir)
+		if os.IsNotExist(item.Err) {
+			item.Err = nil
+		}
+		plan = append(plan, item)
+	}
+	return plan
+}
+
+func countRuns(plan []cleanupItem) int {
+	count := 0
+	for _, item := range plan {
+		count += len(item.Runs)
+	}
+	return count
+}
+
+func printCleanupPreflight(w io.Writer, plan []cleanupItem) {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Cleanup preflight")
+	fmt.Fprintln(w, "-----------------")
+
+	for _, item := range plan {
+		fmt.Fprintln(w, "Backup directory:")
+		fmt.Fprintf(w, "  Path: %s\n", filepath.ToSlash(item.Dir))
+		if item.Err != nil {
+			fmt.Fprintf(w, "  [WARN] not readable, skipped (%v)\n", item.Err)
+			continue
+		}
+		for _, run := range item.Runs {
+			fmt.Fprintf(w, "  [DELETE] %s (files: %d, %s): %s\n", run.String(), len(run.Files), util.FormatBytesBinary(uint64(runSize(run))), run.Reason)
+		}
+		if len(item.Runs) == 0 {
+			fmt.Fprintln(w, "  [OK] no incomplete runs")
+		}
+	}
+}
+
+// runSize returns the total size of the files of run that can still be inspected.
+func runSize(run catalog.IncompleteRun) int64 {
+	var total int64
+	for _, path := range run.Files {
+		if info, err := util.StorageFor(path).Stat(path); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+func deleteRuns(plan []cleanupItem, log *util.Logger) (int, int, error) {
+	deletedRuns, deletedFiles := 0, 0
+	for _, item := range plan {
+		for _, run := range item.Runs {
+			removed, err := catalog.RemoveIncompleteRun(run)
+			deletedFiles += removed
+			if err != nil {
+				return deletedRuns, deletedFiles, fmt.Errorf("Failed to delete run %s from %s: %w", run.String(), filepath.ToSlash(item.Dir), err)
+			}
+			log.Info("Deleted: %s from %s (%d file(s))", run.String(), filepath.ToSlash(item.Dir), removed)
+			deletedRuns++
+		}
+	}
+	return deletedRuns, deletedFiles, nil
+}
@@ -0,0 +1,72 @@
+package cleanup
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeleteRunsRemovesIncompleteRunsOnly(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	password := []byte("cleanup-password")
+	complete := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-20", ID: "CMP001"}
+	interrupted := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-21", ID: "INT001"}
+	legacy := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-19", ID: "OLD001"}
+	for _, entry := range []util.BackupEntry{complete, interrupted, legacy} {
+		testutil.CreateBackupInDir(t, dir, entry, password)
+	}
+	if err := catalog.MarkRunStarted(dir, complete.Date, complete.ID); err != nil {
+		t.Fatalf("MarkRunStarted failed: %v", err)
+	}
+	if err := catalog.MarkRunComplete(dir, complete.Date, complete.ID); err != nil {
+		t.Fatalf("MarkRunComplete failed: %v", err)
+	}
+	if err := catalog.MarkRunStarted(dir, interrupted.Date, interrupted.ID); err != nil {
+		t.Fatalf("MarkRunStarted failed: %v", err)
+	}
+	partial := util.PartialFileName(util.PartFileName(dir, interrupted.DirectoryName, interrupted.Date, interrupted.ID, 2))
+	if err := os.WriteFile(partial, []byte("unfinished"), 0o600); err != nil {
+		t.Fatalf("failed to write partial part: %v", err)
+	}
+	runLog := util.LogFileName(dir, interrupted.Date, interrupted.ID)
+	if err := os.WriteFile(runLog, []byte("log"), 0o600); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	plan := buildCleanupPlan([]string{dir, filepath.Join(t.TempDir(), "missing")})
+	if countRuns(plan) != 1 || plan[0].Runs[0].String() != "2026-03-21_INT001" || plan[1].Err != nil {
+		t.Fatalf("expected only the interrupted run, got %+v", plan)
+	}
+	var out bytes.Buffer
+	printCleanupPreflight(&out, plan)
+	if !strings.Contains(out.String(), "[DELETE] 2026-03-21_INT001 (files: 3,") || !strings.Contains(out.String(), "has not completed") {
+		t.Fatalf("expected the run, its files and reason in the preflight, got %q", out.String())
+	}
+
+	runs, files, err := deleteRuns(plan, util.NewConsoleLogger("info"))
+	if err != nil || runs != 1 || files != 3 {
+		t.Fatalf("deleteRuns returned %d, %d, %v", runs, files, err)
+	}
+	for _, path := range []string{partial, util.IncompleteRunFileName(dir, interrupted.Date, interrupted.ID)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be deleted, got %v", filepath.Base(path), err)
+		}
+	}
+	if _, err := os.Stat(runLog); err != nil {
+		t.Fatalf("expected the log file of the run to be kept: %v", err)
+	}
+	index, err := catalog.ScanBackups(dir)
+	if err != nil || len(index) != 2 {
+		t.Fatalf("expected the complete and the legacy run to stay, got %v, %v", index, err)
+	}
+	if runs, err := catalog.FindIncompleteRuns(dir); err != nil || len(runs) != 0 {
+		t.Fatalf("expected no incomplete runs left, got %v, %v", runs, err)
+	}
+}
@@ -0,0 +1,180 @@
+package consolidate
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// consolidateEntry writes target as a self-contained full backup of the state
+// recorded by the last entry of chain. Every file is read once from the archive
+// that holds it, located through the manifest offsets, and the merged TAR stream is
+// encrypted into new split parts next to the chain. It returns the number of parts
+// written.
+func consolidateEntry(chain []util.BackupEntry, target util.BackupEntry, backupDir string, password []byte, params security.Argon2Params, splitSizeMB int64, log *util.Logger) (int, error) {
+	tip := chain[len(chain)-1]
+	entries, ok, err := manifest.LoadForBackup(backupDir, tip, password)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to read manifest of %s: %w", tip.String(), err)
+	}
+	if !ok {
+		return 0, fmt.Errorf("Manifest of %s is missing. Remedy: Restore the .manifest.enc file from a copy of the backup directory; a chain cannot be consolidated without it.", tip.String())
+	}
+
+	// The consolidated set is ordered right after the tip it replaces, not by the
+	// time its parts are written, which is later than runs taken after the tip.
+	tipTime, err := catalog.BackupTime(backupDir, tip)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to inspect %s: %w", tip.String(), err)
+	}
+	stateTime := tipTime.Add(time.Nanosecond)
+
+	log.Info("Consolidating backup directory: %s", tip.DirectoryName)
+	for _, entry := range chain {
+		log.Info("  Read: %s", entry.String())
+	}
+
+	mw, err := manifest.Create(util.ManifestFileName(backupDir, target.DirectoryName, target.Date, target.ID), manifest.Header{Backup: target.String()}, password, params)
+	if err != nil {
+		return 0, err
+	}
+
+	sw := util.NewWriter(func(seq int) string {
+		return util.PartFileName(backupDir, target.DirectoryName, target.Date, target.ID, seq)
+	}, splitSizeMB*1024*1024)
+	bw := bufio.NewWriterSize(sw, util.SplitWriteBufferSize)
+	pr, pw := io.Pipe()
+	encErrCh := make(chan error, 1)
+	go func() {
+		err := security.Encrypt(bw, pr, password, params)
+		pr.CloseWithError(err) //nolint:errcheck
+		encErrCh <- err
+	}()
+
+	mergeErr := withArchiveReaders(backupDir, chain, password, log, map[string]io.ReadSeeker{}, func(archives map[string]io.ReadSeeker) error {
+		return mergeArchives(pw, entries, tip.String(), archives, mw)
+	})
+	pw.CloseWithError(mergeErr) //nolint:errcheck
+	encErr := <-encErrCh
+
+	err = mergeErr
+	if err == nil {
+		err = encErr
+	}
+	if err == nil {
+		if flushErr := bw.Flush(); flushErr != nil {
+			err = fmt.Errorf("Flushing split buffer failed: %w", flushErr)
+		}
+	}
+	if closeErr := sw.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("Closing split-writer failed: %w", closeErr)
+	}
+	if err != nil {
+		mw.Abort()
+		removeParts(sw.Paths())
+		return 0, err
+	}
+	if err := mw.Close(); err != nil {
+		removeParts(sw.Paths())
+		return 0, err
+	}
+	// The new set is a full backup of the same source as the chain.
+	tipInfo, err := catalog.ReadRunInfo(backupDir, tip)
+	if err != nil {
+		return 0, err
+	}
+	if err := catalog.WriteRunInfo(backupDir, target, catalog.RunInfo{Type: catalog.BackupTypeFull, Source: tipInfo.Source, StateTime: stateTime}); err != nil {
+		return 0, err
+	}
+
+	log.Info("  Created: %d part file(s) - [%s] successfully consolidated", len(sw.Paths()), target.DirectoryName)
+	return len(sw.Paths()), nil
+}
+
+// withArchiveReaders opens a seekable plaintext reader for every entry of chain,
+// keyed by its backup name, and calls consume once all are open.
+func withArchiveReaders(backupDir string, chain []util.BackupEntry, password []byte, log *util.Logger, open map[string]io.ReadSeeker, consume func(map[string]io.ReadSeeker) error) error {
+	if len(chain) == 0 {
+		return consume(open)
+	}
+	entry := chain[0]
+	parts, err := catalog.CollectParts(backupDir, entry)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("No part files found for %s. Remedy: Ensure all .enc files for this backup are in the same backup directory.", entry.String())
+	}
+	return operation.RunDecryptReader(
+		parts,
+		password,
+		log,
+		entry.String(),
+		"read",
+		"Consolidation",
+		func(r io.ReadSeeker) error {
+			open[entry.String()] = r
+			return withArchiveReaders(backupDir, chain[1:], password, log, open, consume)
+		},
+		nil,
+	)
+}
+
+// mergeArchives writes the entries of the manifest, in manifest order, into a new
+// TAR stream on w and records them in mw. The content of each entry is read from
+// the archive named by its Stored field, or from tip's own archive.
+func mergeArchives(w io.Writer, entries []manifest.Entry, tip string, archives map[string]io.ReadSeeker, mw *manifest.Writer) error {
+	copier := util.NewTarCopier(w)
+	for _, e := range entries {
+		if e.Deleted() {
+			continue
+		}
+		source := tip
+		if e.Stored != "" {
+			source = e.Stored
+		}
+		archive, ok := archives[source]
+		if !ok {
+			return fmt.Errorf("%s is stored in %s, which is not part of the backup chain. Remedy: Verify the backup chain; the manifest does not match the .run.json files.", e.Path, source)
+		}
+
+		if _, err := archive.Seek(e.HeaderOffset, io.SeekStart); err != nil {
+			return fmt.Errorf("Failed to seek to %s in %s: %w", e.Path, source, err)
+		}
+		tr := tar.NewReader(archive)
+		hdr, err := tr.Next()
+		if err != nil {
+			return fmt.Errorf("Failed to read %s from %s: %w. Remedy: Verify the backup chain; the archive may be damaged.", e.Path, source, err)
+		}
+		if strings.TrimSuffix(hdr.Name, "/") != e.Path {
+			return fmt.Errorf("Archive %s holds %q where the manifest records %q. Remedy: Verify the backup chain; the manifest does not match the archive.", source, hdr.Name, e.Path)
+		}
+
+		copied, err := copier.Copy(hdr, tr)
+		if err != nil {
+			return err
+		}
+		if want := e.Sum(); want != nil && !bytes.Equal(copied.SHA256, want) {
+			return fmt.Errorf("Integrity check failed for %s in %s: content hash differs from the manifest. Remedy: Do not rely on this backup chain; create a new full backup.", e.Path, source)
+		}
+		if err := mw.Add(manifest.EntryFromTar(copied)); err != nil {
+			return err
+		}
+	}
+	return copier.Close()
+}
+
+func removeParts(paths []string) {
+	for _, path := range paths {
+		util.StorageFor(path).Remove(path) //nolint:errcheck
+	}
+}
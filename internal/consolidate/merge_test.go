@@ -0,0 +1,198 @@
+package consolidate
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConsolidateEntryWritesSelfContainedFullBackup(t *testing.T) {
+	password := []byte("consolidate-password")
+	workspace := t.TempDir()
+	srcDir := filepath.Join(workspace, "Docs")
+	backupDir := filepath.Join(workspace, "target")
+	for _, dir := range []string{srcDir, backupDir} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	writeSource(t, srcDir, "a.txt", "alpha")
+	writeSource(t, srcDir, "b.txt", "bravo")
+	writeSource(t, srcDir, "c.txt", "charlie")
+
+	full := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-12", ID: util.BackupID("FUL001")}
+	testutil.CreateChainBackup(t, srcDir, backupDir, full, nil, password)
+	writeSource(t, srcDir, "b.txt", "bravo, second version")
+	if err := os.Remove(filepath.Join(srcDir, "c.txt")); err != nil {
+		t.Fatalf("failed to remove c.txt: %v", err)
+	}
+	inc := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-13", ID: util.BackupID("INC001")}
+	testutil.CreateChainBackup(t, srcDir, backupDir, inc, &full, password)
+
+	chain, err := catalog.ResolveChain(backupDir, inc)
+	if err != nil {
+		t.Fatalf("ResolveChain failed: %v", err)
+	}
+	target := util.BackupEntry{DirectoryName: "Docs", Date: inc.Date, ID: util.BackupID("CON001")}
+	partCount, err := consolidateEntry(chain, target, backupDir, password, security.DefaultArgon2Params, 1, nil)
+	if err != nil {
+		t.Fatalf("consolidateEntry failed: %v", err)
+	}
+	if partCount < 1 {
+		t.Fatalf("expected at least one part, got %d", partCount)
+	}
+
+	// The consolidated set is a full backup: no parent, no entries stored elsewhere.
+	targetChain, err := catalog.ResolveChain(backupDir, target)
+	if err != nil || len(targetChain) != 1 {
+		t.Fatalf("expected a self-contained backup, got chain %v, %v", targetChain, err)
+	}
+	entries, ok, err := manifest.LoadForBackup(backupDir, target, password)
+	if err != nil || !ok {
+		t.Fatalf("expected manifest, got ok=%v err=%v", ok, err)
+	}
+	for _, e := range entries {
+		if !e.InArchive() {
+			t.Fatalf("expected every manifest entry in the archive, got %#v", e)
+		}
+	}
+
+	parts, err := catalog.CollectParts(backupDir, target)
+	if err != nil {
+		t.Fatalf("CollectParts failed: %v", err)
+	}
+	restoreDir := filepath.Join(workspace, "restore")
+	var stats util.ExtractStats
+	err = operation.RunDecryptPipeline(parts, password, nil, target.DirectoryName, "decrypted", "Extraction", func(r io.Reader) error {
+		var extractErr error
+		stats, extractErr = util.ExtractTarSelected(r, restoreDir, util.ExtractOptions{ExpectedSHA256: manifest.NewIndex(entries).ExpectedSHA256})
+		return extractErr
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to extract consolidated backup: %v", err)
+	}
+	if stats.Files != 2 || stats.Verified != 2 {
+		t.Fatalf("expected 2 verified files, got %+v", stats)
+	}
+	for name, want := range map[string]string{"a.txt": "alpha", "b.txt": "bravo, second version"} {
+		got, err := os.ReadFile(filepath.Join(restoreDir, name))
+		if err != nil || string(got) != want {
+			t.Fatalf("expected %s to contain %q, got %q, %v", name, want, got, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(restoreDir, "c.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected deleted file c.txt to be dropped, stat err: %v", err)
+	}
+}
+
+func TestConsolidateEntryRemovesPartsOnFailure(t *testing.T) {
+	password := []byte("consolidate-password")
+	workspace := t.TempDir()
+	srcDir := filepath.Join(workspace, "Docs")
+	backupDir := filepath.Join(workspace, "target")
+	for _, dir := range []string{srcDir, backupDir} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	writeSource(t, srcDir, "a.txt", "alpha")
+
+	full := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-12", ID: util.BackupID("FUL001")}
+	testutil.CreateChainBackup(t, srcDir, backupDir, full, nil, password)
+	writeSource(t, srcDir, "b.txt", "bravo")
+	inc := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-13", ID: util.BackupID("INC001")}
+	testutil.CreateChainBackup(t, srcDir, backupDir, inc, &full, password)
+
+	// Without the full backup in the chain, a.txt cannot be read.
+	target := util.BackupEntry{DirectoryName: "Docs", Date: inc.Date, ID: util.BackupID("CON001")}
+	if _, err := consolidateEntry([]util.BackupEntry{inc}, target, backupDir, password, security.DefaultArgon2Params, 1, nil); err == nil {
+		t.Fatal("expected consolidateEntry to fail, got nil")
+	}
+	parts, err := catalog.CollectParts(backupDir, target)
+	if err != nil {
+		t.Fatalf("CollectParts failed: %v", err)
+	}
+	if len(parts) != 0 {
+		t.Fatalf("expected incomplete parts to be removed, got %v", parts)
+	}
+	if _, found, _ := catalog.FindManifestFile(backupDir, target); found {
+		t.Fatal("expected incomplete manifest to be removed")
+	}
+}
+
+func TestConsolidatedBackupIsOrderedBeforeLaterRuns(t *testing.T) {
+	password := []byte("consolidate-password")
+	workspace := t.TempDir()
+	srcDir := filepath.Join(workspace, "Docs")
+	backupDir := filepath.Join(workspace, "target")
+	for _, dir := range []string{srcDir, backupDir} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	writeSource(t, srcDir, "a.txt", "alpha")
+
+	full := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-12", ID: util.BackupID("FUL001")}
+	testutil.CreateChainBackup(t, srcDir, backupDir, full, nil, password)
+	writeSource(t, srcDir, "b.txt", "bravo")
+	inc := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-13", ID: util.BackupID("INC001")}
+	testutil.CreateChainBackup(t, srcDir, backupDir, inc, &full, password)
+	setPartTimes(t, backupDir, full, time.Now().Add(-3*time.Hour))
+	setPartTimes(t, backupDir, inc, time.Now().Add(-2*time.Hour))
+
+	// The chain is consolidated after a newer run was taken.
+	newer := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-14", ID: util.BackupID("NEW001")}
+	testutil.CreateChainBackup(t, srcDir, backupDir, newer, &inc, password)
+	setPartTimes(t, backupDir, newer, time.Now().Add(-time.Hour))
+	chain, err := catalog.ResolveChain(backupDir, inc)
+	if err != nil {
+		t.Fatalf("ResolveChain failed: %v", err)
+	}
+	target := util.BackupEntry{DirectoryName: "Docs", Date: inc.Date, ID: util.BackupID("CON001")}
+	if _, err := consolidateEntry(chain, target, backupDir, password, security.DefaultArgon2Params, 1, nil); err != nil {
+		t.Fatalf("consolidateEntry failed: %v", err)
+	}
+
+	// The next incremental backup is based on the newer run, not on the consolidated set.
+	index, err := catalog.ScanBackups(backupDir)
+	if err != nil {
+		t.Fatalf("ScanBackups failed: %v", err)
+	}
+	newest, err := catalog.NewestEntryPerDirectory(backupDir, index)
+	if err != nil || newest["Docs"] != newer {
+		t.Fatalf("expected %s as newest backup, got %v, %v", newer.String(), newest, err)
+	}
+	incTime, _ := catalog.BackupTime(backupDir, inc)
+	targetTime, err := catalog.BackupTime(backupDir, target)
+	if err != nil || !targetTime.After(incTime) {
+		t.Fatalf("expected the consolidated set right after %s, got %v, %v", inc.String(), targetTime, err)
+	}
+}
+
+func setPartTimes(t *testing.T, backupDir string, entry util.BackupEntry, modTime time.Time) {
+	t.Helper()
+	parts, err := catalog.CollectParts(backupDir, entry)
+	if err != nil || len(parts) == 0 {
+		t.Fatalf("failed to find parts of %s: %v", entry.String(), err)
+	}
+	for _, part := range parts {
+		if err := os.Chtimes(part, modTime, modTime); err != nil {
+			t.Fatalf("failed to set part time: %v", err)
+		}
+	}
+}
+
+func writeSource(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+}
@@ -0,0 +1,297 @@
+// Package consolidate turns an incremental backup chain into a new full backup:
+//  1. Let the user choose which backup run to consolidate
+//  2. Resolve the chain of every selected incremental backup and check free space
+//  3. Verify password (up to 3 attempts)
+//  4. Read every file once from the archive that holds it and write a new, self-contained
+//     full backup set through the split writer; the source directories are not read
+package consolidate
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Options holds consolidate choices passed as arguments instead of being entered at the prompts.
+type Options struct {
+	// Backup selects the backup(s) to consolidate: a dot (.), a backup ID or a full backup name.
+	Backup string
+}
+
+// Run consolidates selected incremental backups into new full backups.
+func Run(cfg *util.Config, exeDir string) error {
+	return run(cfg, exeDir, nil)
+}
+
+// RunWithOptions consolidates the backups selected by opts.
+// The confirmation and password are still prompted.
+func RunWithOptions(cfg *util.Config, exeDir string, opts Options) error {
+	return run(cfg, exeDir, &opts)
+}
+
+func run(cfg *util.Config, exeDir string, opts *Options) error {
+	backupDir := util.ResolveDir(cfg.BackupDirectory, exeDir)
+
+	index, err := catalog.ScanBackups(backupDir)
+	if err != nil {
+		return fmt.Errorf("Failed to scan backup directory %q: %w. Remedy: Check the backup_directory path in config.yaml and ensure the directory is readable.", backupDir, err)
+	}
+	if len(index) == 0 {
+		fmt.Println("No backups found in backup directory. Remedy: Check whether .enc files are in the backup directory and whether the correct directory is selected.")
+		return nil
+	}
+
+	selected, _, err := resolveConsolidateSelection(backupDir, index, opts)
+	if err != nil {
+		if errors.Is(err, operation.ErrSelectionCancelled) {
+			fmt.Println("Consolidation cancelled.")
+			return nil
+		}
+		return err
+	}
+
+	lock, err := util.AcquireBackupLock(backupDir)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	requiresYubiKey, yubiKeyOnly, err := catalog.BackupRunUsesYubiKey(backupDir, selected[0])
+	if err != nil {
+		return fmt.Errorf("Failed to inspect backup authentication: %w. Remedy: Check read permissions in the backup directory and existing .challenge files.", err)
+	}
+
+	// The consolidated sets form a new backup run dated like the state they hold.
+	id, err := util.NewBackupID()
+	if err != nil {
+		return err
+	}
+	target := util.BackupEntry{Date: selected[0].Date, ID: id}
+
+	logPath := util.LogFileName(backupDir, target.Date, target.ID)
+	log := operation.OpenLogger(cfg, backupDir, target)
+	warningCount := 0
+	if log.IsConsoleOnly() {
+		warningCount++
+	}
+	defer log.Close()
+
+	preflight := buildConsolidatePreflight(selected, backupDir)
+	printConsolidatePreflightWithYubiKeyCheck(os.Stdout, cfg, backupDir, preflight, requiresYubiKey, yubiKeyOnly, security.CheckYubiKeyConnected)
+	if err := validateConsolidatePreflight(preflight, backupDir); err != nil {
+		return err
+	}
+	if countIncremental(preflight) == 0 {
+		fmt.Println()
+		fmt.Println("Nothing to consolidate: the selected backups are full backups.")
+		return nil
+	}
+
+	confirmed, err := operation.PromptStartAction("consolidation")
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		log.InfoLogOnly("Consolidation cancelled by user before start")
+		fmt.Println("Consolidation cancelled.")
+		return nil
+	}
+
+	password, err := operation.ReadPasswordWithRetry(backupDir, selected[0], "Enter consolidation password: ", log)
+	if err != nil {
+		return err
+	}
+	defer func() { security.ZeroBytes(password) }()
+
+	argon2Params := security.Argon2Params{
+		Time:     uint32(cfg.Argon2.Time),
+		MemoryKB: uint32(cfg.Argon2.MemoryMB) * 1024,
+		Threads:  uint8(cfg.Argon2.Threads),
+	}
+
+	fmt.Println()
+	if err := catalog.MarkRunStarted(backupDir, target.Date, target.ID); err != nil {
+		return err
+	}
+	log.Info("Consolidation started - ID: %s, date: %s", string(target.ID), target.Date)
+	totalPartsCreated := 0
+	for _, item := range preflight {
+		if len(item.Chain) < 2 {
+			log.Info("Skipped: %s is a full backup", item.Entry.String())
+			continue
+		}
+		entryTarget := util.BackupEntry{DirectoryName: item.Entry.DirectoryName, Date: target.Date, ID: target.ID}
+		partCount, err := consolidateEntry(item.Chain, entryTarget, backupDir, password, argon2Params, cfg.SplitSizeMB, log)
+		if err != nil {
+			return fmt.Errorf("Failed to consolidate %q: %w", item.Entry.String(), err)
+		}
+		// The consolidated set is decrypted with the same YubiKey response as its chain.
+		if err := copyChallengeFile(backupDir, item.Entry, entryTarget); err != nil {
+			return err
+		}
+		totalPartsCreated += partCount
+		log.Info("  New full backup: %s (replaces a chain of %d backups)", entryTarget.String(), len(item.Chain))
+	}
+
+	if err := catalog.MarkRunComplete(backupDir, target.Date, target.ID); err != nil {
+		return err
+	}
+	log.Info("Consolidation completed successfully: %d part file(s) created. Retention removes the previous chain once it is no longer needed.", totalPartsCreated)
+	fmt.Printf("\nLog file: %s\n", logPath)
+	if warningCount > 0 {
+		fmt.Printf("Warnings: %d\n", warningCount)
+	}
+	return nil
+}
+
+func resolveConsolidateSelection(backupDir string, index []util.BackupEntry, opts *Options) ([]util.BackupEntry, string, error) {
+	if opts != nil {
+		return operation.ResolveBackupSelection(backupDir, index, opts.Backup)
+	}
+	return operation.PromptBackupSelection("consolidate", backupDir, index)
+}
+
+type consolidatePreflightItem struct {
+	Entry util.BackupEntry
+	// Chain lists the backups the entry is restored from, the full backup first.
+	Chain          []util.BackupEntry
+	PartCount      int
+	TotalSizeBytes int64
+	Err            error
+}
+
+func buildConsolidatePreflight(selected []util.BackupEntry, backupDir string) []consolidatePreflightItem {
+	items := make([]consolidatePreflightItem, 0, len(selected))
+	for _, entry := range selected {
+		item := consolidatePreflightItem{Entry: entry}
+		item.Chain, item.Err = catalog.ResolveChain(backupDir, entry)
+		for _, chainEntry := range item.Chain {
+			if item.Err != nil {
+				break
+			}
+			partCount, sizeBytes, err := catalog.InspectBackupParts(backupDir, chainEntry)
+			item.PartCount += partCount
+			item.TotalSizeBytes += sizeBytes
+			item.Err = err
+		}
+		if item.Err == nil && len(item.Chain) > 1 {
+			if _, found, err := catalog.FindManifestFile(backupDir, entry); err != nil {
+				item.Err = err
+			} else if !found {
+				item.Err = fmt.Errorf("Manifest of %s is missing. Remedy: Restore the .manifest.enc file from a copy of the backup directory; a chain cannot be consolidated without it.", entry.String())
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func printConsolidatePreflightWithYubiKeyCheck(
+	w io.Writer,
+	cfg *util.Config,
+	backupDir string,
+	items []consolidatePreflightItem,
+	requiresYubiKey, yubiKeyOnly bool,
+	checkYubiKeyConnected func() error,
+) {
+	var issues []string
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Consolidation preflight")
+	fmt.Fprintln(w, "-----------------------")
+
+	// Backup selection
+	fmt.Fprintln(w, "Backup selection:")
+	fmt.Fprintf(w, "  Path: %s\n", filepath.ToSlash(backupDir))
+	for _, item := range items {
+		switch {
+		case item.Err != nil:
+			fmt.Fprintf(w, "  [ERROR] %s\n", item.Entry.String())
+			issues = append(issues, item.Err.Error())
+		case len(item.Chain) < 2:
+			fmt.Fprintf(w, "  [SKIP] %s (full backup)\n", item.Entry.String())
+		default:
+			fmt.Fprintf(w, "  [OK] %s (chain: %d backups, parts: %d)\n", item.Entry.String(), len(item.Chain), item.PartCount)
+		}
+	}
+	if totalBytes := estimateConsolidateBytes(items); totalBytes > 0 {
+		fmt.Fprintf(w, "  Used disk space of the chains (total): %s\n", util.FormatBytesBinary(uint64(totalBytes)))
+	}
+
+	// Authentication and Log level
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Authentication", operation.BackupAuthenticationLabel(requiresYubiKey, yubiKeyOnly))
+	operation.PrintYubiKeyPreflightStatus(w, requiresYubiKey, "consolidation", checkYubiKeyConnected)
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Log level", strings.ToLower(cfg.LogLevel))
+
+	// Print collected issues
+	if len(issues) > 0 {
+		fmt.Fprintln(w)
+		for _, issue := range issues {
+			fmt.Fprintf(w, "[ERROR] %s\n", issue)
+		}
+	}
+}
+
+// estimateConsolidateBytes returns the size of the chains to consolidate. The new
+// full backups are at most this large, since deleted and replaced files are dropped.
+func estimateConsolidateBytes(items []consolidatePreflightItem) int64 {
+	var total int64
+	for _, item := range items {
+		if item.Err == nil && len(item.Chain) > 1 {
+			total += item.TotalSizeBytes
+		}
+	}
+	return total
+}
+
+func countIncremental(items []consolidatePreflightItem) int {
+	count := 0
+	for _, item := range items {
+		if item.Err == nil && len(item.Chain) > 1 {
+			count++
+		}
+	}
+	return count
+}
+
+func validateConsolidatePreflight(items []consolidatePreflightItem, backupDir string) error {
+	if err := operation.ValidatePreflightItems(
+		items,
+		func(item consolidatePreflightItem) bool { return item.Err != nil },
+		"Consolidate preflight failed: %d selected item(s) are incomplete or invalid. Remedy: Fix the [ERROR] entries above and start consolidation again.",
+	); err != nil {
+		return err
+	}
+
+	estimatedBytes := estimateConsolidateBytes(items)
+	if estimatedBytes <= 0 {
+		return nil
+	}
+	freeBytes, err := util.StorageFor(backupDir).FreeSpace(backupDir)
+	if err != nil || !util.IsSpaceInsufficient(estimatedBytes, freeBytes) {
+		return nil
+	}
+	message := util.FormatInsufficientBackupSpaceMessage(uint64(estimatedBytes), freeBytes)
+	fmt.Println()
+	fmt.Printf("[ERROR] %s\n", message)
+	return fmt.Errorf("Consolidate preflight failed: %s", message)
+}
+
+// copyChallengeFile gives target the YubiKey challenge of entry, if it has one.
+func copyChallengeFile(backupDir string, entry, target util.BackupEntry) error {
+	source := util.ChallengeFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID)
+	if _, err := util.StorageFor(source).Stat(source); os.IsNotExist(err) {
+		return nil
+	}
+	if err := util.CopyFile(source, util.ChallengeFileName(backupDir, target.DirectoryName, target.Date, target.ID)); err != nil {
+		return fmt.Errorf("Failed to write challenge file: %w. Remedy: Check write permissions in the backup directory; for YubiKey backups, the .challenge file must be in the same directory as the .enc files.", err)
+	}
+	return nil
+}
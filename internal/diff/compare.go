@@ -0,0 +1,251 @@
+package diff
+
+import (
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// entryState is the comparable metadata of one file system or archive entry.
+type entryState struct {
+	Type    string
+	Size    int64
+	ModTime time.Time
+	Perm    fs.FileMode
+}
+
+func stateFromHeader(hdr *tar.Header) entryState {
+	state := entryState{ModTime: hdr.ModTime, Perm: hdr.FileInfo().Mode().Perm()}
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		state.Type = "dir"
+	case tar.TypeReg:
+		state.Type = "file"
+		state.Size = hdr.Size
+	case tar.TypeSymlink:
+		state.Type = "symlink"
+	default:
+		state.Type = "other"
+	}
+	return state
+}
+
+func stateFromFileInfo(info fs.FileInfo) entryState {
+	state := entryState{ModTime: info.ModTime(), Perm: info.Mode().Perm()}
+	switch {
+	case info.IsDir():
+		state.Type = "dir"
+	case info.Mode().IsRegular():
+		state.Type = "file"
+		state.Size = info.Size()
+	case info.Mode()&fs.ModeSymlink != 0:
+		state.Type = "symlink"
+	default:
+		state.Type = "other"
+	}
+	return state
+}
+
+// compareStates returns the change between an old and a new state of the same path,
+// or ok=false when nothing relevant differs. Directory timestamps change whenever
+// their contents do, so directories are only compared by type and permissions.
+// Timestamps are rounded to whole seconds because TAR headers may not store
+// more; ignoreModTime skips them when the content has already been compared.
+func compareStates(path string, before, after entryState, ignoreModTime bool) (Change, bool) {
+	change := Change{
+		Path:       path,
+		Type:       after.Type,
+		OldSize:    before.Size,
+		NewSize:    after.Size,
+		OldModTime: before.ModTime,
+		NewModTime: after.ModTime,
+		OldMode:    before.Perm.String(),
+		NewMode:    after.Perm.String(),
+	}
+
+	if before.Type != after.Type {
+		change.Kind = KindModified
+		change.Reasons = []string{ReasonType}
+		return change, true
+	}
+	if before.Type == "file" {
+		if before.Size != after.Size {
+			change.Reasons = append(change.Reasons, ReasonSize)
+		}
+		if !ignoreModTime && !before.ModTime.Round(time.Second).Equal(after.ModTime.Round(time.Second)) {
+			change.Reasons = append(change.Reasons, ReasonModTime)
+		}
+	}
+	if len(change.Reasons) > 0 {
+		change.Kind = KindModified
+		return change, true
+	}
+	if before.Perm != after.Perm {
+		change.Kind = KindPermissions
+		change.Reasons = []string{ReasonPermissions}
+		return change, true
+	}
+	return Change{}, false
+}
+
+// compareWithDirectory walks a backup TAR stream and compares every entry with the
+// live directory liveDir. When hash is set, files whose size matches are compared by
+// SHA-256 of their content instead of by modification time. Entries below any of
+// excludeDirs are ignored, mirroring util.WriteTar.
+func compareWithDirectory(r io.Reader, from, liveDir string, excludeDirs []string, hash bool) (Result, error) {
+	return compareEntriesWithDirectory(func(emit func(archiveEntry) error) error {
+		return tarEntries(r, hash, emit)
+	}, from, liveDir, excludeDirs, hash)
+}
+
+// compareManifestWithDirectory compares the snapshot recorded in a manifest with
+// liveDir. It is used for incremental backups, whose own archive holds only the
+// files changed since their parent.
+func compareManifestWithDirectory(entries []manifest.Entry, from, liveDir string, excludeDirs []string, hash bool) (Result, error) {
+	return compareEntriesWithDirectory(func(emit func(archiveEntry) error) error {
+		return manifestEntries(entries, hash, emit)
+	}, from, liveDir, excludeDirs, hash)
+}
+
+// compareEntriesWithDirectory compares the entries emitted by produce with liveDir.
+func compareEntriesWithDirectory(produce func(emit func(archiveEntry) error) error, from, liveDir string, excludeDirs []string, hash bool) (Result, error) {
+	result := Result{From: from, To: filepath.ToSlash(liveDir), Hash: hash}
+	seen := make(map[string]bool)
+	// A single-file source is compared with the only entry of its backup.
+	singleFile := util.IsRegularFile(liveDir)
+
+	err := produce(func(entry archiveEntry) error {
+		name := entry.Name
+		seen[strings.ToLower(name)] = true
+		before := entry.State
+
+		livePath := filepath.Join(liveDir, filepath.FromSlash(name))
+		if singleFile {
+			livePath = liveDir
+		}
+		info, err := os.Lstat(livePath)
+		if os.IsNotExist(err) {
+			result.add(Change{Path: name, Kind: KindDeleted, Type: before.Type, OldSize: before.Size, OldModTime: before.ModTime, OldMode: before.Perm.String()})
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to inspect live file %q: %w. Remedy: Check read permissions in the source directory.", livePath, err)
+		}
+		after := stateFromFileInfo(info)
+
+		hashed := hash && entry.Sum != nil && before.Type == "file" && after.Type == "file" && before.Size == after.Size
+		if hashed {
+			same, err := sameContent(entry.Sum, livePath)
+			if err != nil {
+				return err
+			}
+			if !same {
+				result.add(contentChange(name, before, after))
+				return nil
+			}
+		}
+
+		if change, changed := compareStates(name, before, after, hashed); changed {
+			result.add(change)
+		} else {
+			result.Summary.Unchanged++
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	if !singleFile {
+		if err := collectAdded(&result, liveDir, excludeDirs, seen); err != nil {
+			return result, err
+		}
+	}
+	result.sort()
+	return result, nil
+}
+
+// contentChange describes a file whose content hash differs.
+func contentChange(path string, before, after entryState) Change {
+	return Change{
+		Path:       path,
+		Kind:       KindModified,
+		Type:       after.Type,
+		Reasons:    []string{ReasonContent},
+		OldSize:    before.Size,
+		NewSize:    after.Size,
+		OldModTime: before.ModTime,
+		NewModTime: after.ModTime,
+		OldMode:    before.Perm.String(),
+		NewMode:    after.Perm.String(),
+	}
+}
+
+// collectAdded records every live entry that does not appear in the archive.
+func collectAdded(result *Result, liveDir string, excludeDirs []string, seen map[string]bool) error {
+	if _, err := os.Stat(liveDir); os.IsNotExist(err) {
+		return nil
+	}
+
+	excluded := make([]string, 0, len(excludeDirs))
+	for _, dir := range excludeDirs {
+		if dir != "" {
+			excluded = append(excluded, filepath.Clean(dir))
+		}
+	}
+
+	return filepath.WalkDir(liveDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("Failed to scan source directory at %q: %w. Remedy: Check read permissions in the source directory.", path, err)
+		}
+		for _, ex := range excluded {
+			rel, relErr := filepath.Rel(ex, path)
+			if relErr == nil && !strings.HasPrefix(rel, "..") {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		rel, err := filepath.Rel(liveDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if seen[strings.ToLower(rel)] {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("Failed to inspect live file %q: %w. Remedy: Check read permissions in the source directory.", path, err)
+		}
+		after := stateFromFileInfo(info)
+		result.add(Change{Path: rel, Kind: KindAdded, Type: after.Type, NewSize: after.Size, NewModTime: after.ModTime, NewMode: after.Perm.String()})
+		return nil
+	})
+}
+
+// sameContent reports whether the file at path has the SHA-256 hash archived.
+func sameContent(archived []byte, path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("Failed to open live file %q: %w. Remedy: Check that the file is readable and not locked by another program.", path, err)
+	}
+	defer f.Close()
+	live := sha256.New()
+	if _, err := io.Copy(live, f); err != nil {
+		return false, fmt.Errorf("Failed to read live file %q: %w. Remedy: Check that the file is readable and not locked by another program.", path, err)
+	}
+	return bytes.Equal(archived, live.Sum(nil)), nil
+}
@@ -0,0 +1,198 @@
+package diff
+
+import (
+	"RestoreSafe/internal/util"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func snapshotDir(t *testing.T, dir string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := util.WriteTar(&buf, dir); err != nil {
+		t.Fatalf("WriteTar failed: %v", err)
+	}
+	return &buf
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		t.Fatalf("failed to create parent directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+func changeByPath(result Result, path string) (Change, bool) {
+	for _, change := range result.Changes {
+		if change.Path == path {
+			return change, true
+		}
+	}
+	return Change{}, false
+}
+
+func TestCompareWithDirectoryReportsAllChangeKinds(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "keep.txt"), "unchanged")
+	writeFile(t, filepath.Join(dir, "grow.txt"), "short")
+	writeFile(t, filepath.Join(dir, "gone.txt"), "bye")
+	writeFile(t, filepath.Join(dir, "mode.txt"), "mode")
+	writeFile(t, filepath.Join(dir, "sub", "inner.txt"), "inner")
+	archive := snapshotDir(t, dir)
+
+	writeFile(t, filepath.Join(dir, "grow.txt"), "much longer content")
+	if err := os.Remove(filepath.Join(dir, "gone.txt")); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "mode.txt"), 0o400); err != nil {
+		t.Fatalf("failed to chmod: %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "new", "added.txt"), "new")
+
+	result, err := compareWithDirectory(archive, "Docs_2026-03-14_ABC123", dir, nil, false)
+	if err != nil {
+		t.Fatalf("compareWithDirectory failed: %v", err)
+	}
+
+	want := map[string]Kind{
+		"grow.txt":      KindModified,
+		"gone.txt":      KindDeleted,
+		"mode.txt":      KindPermissions,
+		"new":           KindAdded,
+		"new/added.txt": KindAdded,
+	}
+	for path, kind := range want {
+		change, ok := changeByPath(result, path)
+		if !ok || change.Kind != kind {
+			t.Fatalf("expected %s to be %s, got %+v (found=%v)", path, kind, change, ok)
+		}
+	}
+	if len(result.Changes) != len(want) {
+		t.Fatalf("expected %d changes, got %+v", len(want), result.Changes)
+	}
+	if result.Summary.Added != 2 || result.Summary.Deleted != 1 || result.Summary.Modified != 1 || result.Summary.Permissions != 1 {
+		t.Fatalf("unexpected summary: %+v", result.Summary)
+	}
+	if result.Summary.Unchanged != 3 { // keep.txt, sub, sub/inner.txt
+		t.Fatalf("expected 3 unchanged entries, got %d", result.Summary.Unchanged)
+	}
+}
+
+func TestCompareWithDirectoryDetectsTouchedFileByModTime(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "touched.txt")
+	writeFile(t, path, "same")
+	archive := snapshotDir(t, dir)
+
+	later := time.Now().Add(2 * time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("failed to change mtime: %v", err)
+	}
+
+	result, err := compareWithDirectory(archive, "b", dir, nil, false)
+	if err != nil {
+		t.Fatalf("compareWithDirectory failed: %v", err)
+	}
+	change, ok := changeByPath(result, "touched.txt")
+	if !ok || change.Kind != KindModified || len(change.Reasons) != 1 || change.Reasons[0] != ReasonModTime {
+		t.Fatalf("expected mtime modification, got %+v (found=%v)", change, ok)
+	}
+}
+
+func TestCompareWithDirectoryHashIgnoresTouchAndFindsSameSizeEdit(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	touched := filepath.Join(dir, "touched.txt")
+	edited := filepath.Join(dir, "edited.txt")
+	writeFile(t, touched, "same")
+	writeFile(t, edited, "aaaa")
+	archive := snapshotDir(t, dir)
+
+	later := time.Now().Add(2 * time.Hour)
+	if err := os.Chtimes(touched, later, later); err != nil {
+		t.Fatalf("failed to change mtime: %v", err)
+	}
+	writeFile(t, edited, "bbbb")
+	if err := os.Chtimes(edited, later, later); err != nil {
+		t.Fatalf("failed to change mtime: %v", err)
+	}
+
+	result, err := compareWithDirectory(archive, "b", dir, nil, true)
+	if err != nil {
+		t.Fatalf("compareWithDirectory failed: %v", err)
+	}
+	if _, ok := changeByPath(result, "touched.txt"); ok {
+		t.Fatalf("expected touched file with identical content to be unchanged, got %+v", result.Changes)
+	}
+	change, ok := changeByPath(result, "edited.txt")
+	if !ok || change.Kind != KindModified || change.Reasons[0] != ReasonContent {
+		t.Fatalf("expected content modification, got %+v (found=%v)", change, ok)
+	}
+}
+
+func TestCompareWithDirectoryMissingSourceReportsDeletions(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.txt"), "a")
+	archive := snapshotDir(t, dir)
+
+	result, err := compareWithDirectory(archive, "b", filepath.Join(t.TempDir(), "missing"), nil, false)
+	if err != nil {
+		t.Fatalf("compareWithDirectory failed: %v", err)
+	}
+	if result.Summary.Deleted != 1 || result.Summary.Added != 0 {
+		t.Fatalf("expected one deletion, got %+v", result.Summary)
+	}
+}
+
+func TestCompareWithDirectorySkipsExcludedDirectories(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, "backups")
+	writeFile(t, filepath.Join(dir, "a.txt"), "a")
+	var archive bytes.Buffer
+	if err := util.WriteTar(&archive, dir, backupDir); err != nil {
+		t.Fatalf("WriteTar failed: %v", err)
+	}
+	writeFile(t, filepath.Join(backupDir, "x.enc"), "cipher")
+
+	result, err := compareWithDirectory(&archive, "b", dir, []string{backupDir}, false)
+	if err != nil {
+		t.Fatalf("compareWithDirectory failed: %v", err)
+	}
+	if len(result.Changes) != 0 {
+		t.Fatalf("expected no changes, got %+v", result.Changes)
+	}
+}
+
+func TestCompareWithDirectoryComparesSingleFileSource(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "vault.hc")
+	writeFile(t, file, "container")
+	writeFile(t, filepath.Join(dir, "sibling.txt"), "not part of the source")
+	archive := snapshotDir(t, file)
+
+	writeFile(t, file, "container, grown")
+	result, err := compareWithDirectory(archive, "vault.hc_2026-03-14_ABC123", file, nil, false)
+	if err != nil {
+		t.Fatalf("compareWithDirectory failed: %v", err)
+	}
+	if result.Summary.Modified != 1 || result.Summary.Added != 0 || result.Summary.Deleted != 0 {
+		t.Fatalf("expected only the file to be modified, got %+v", result.Summary)
+	}
+}
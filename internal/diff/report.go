@@ -0,0 +1,256 @@
+package diff
+
+import (
+	"RestoreSafe/internal/util"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format selects how a diff report is written.
+type Format string
+
+const (
+	FormatReport Format = "report"
+	FormatJSON   Format = "json"
+)
+
+// ParseFormat converts user input into a Format. An empty value selects FormatReport.
+func ParseFormat(value string) (Format, error) {
+	switch Format(strings.ToLower(strings.TrimSpace(value))) {
+	case "", FormatReport:
+		return FormatReport, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	}
+	return "", fmt.Errorf("Unknown diff format %q. Remedy: Use report or json.", value)
+}
+
+// Kind classifies a change.
+type Kind string
+
+const (
+	KindAdded       Kind = "added"
+	KindDeleted     Kind = "deleted"
+	KindModified    Kind = "modified"
+	KindPermissions Kind = "permissions"
+)
+
+// Reasons explain why an entry is reported as modified or permissions-changed.
+const (
+	ReasonType        = "type"
+	ReasonSize        = "size"
+	ReasonModTime     = "mtime"
+	ReasonContent     = "content"
+	ReasonPermissions = "mode"
+)
+
+// Change describes one path that differs between the two sides of a diff.
+// Old* fields describe the backup side and New* fields the compared side.
+type Change struct {
+	Path       string    `json:"path"`
+	Kind       Kind      `json:"kind"`
+	Type       string    `json:"type"`
+	Reasons    []string  `json:"reasons,omitempty"`
+	OldSize    int64     `json:"old_size,omitempty"`
+	NewSize    int64     `json:"new_size,omitempty"`
+	SizeDelta  int64     `json:"size_delta,omitempty"`
+	OldModTime time.Time `json:"old_mtime,omitzero"`
+	NewModTime time.Time `json:"new_mtime,omitzero"`
+	OldMode    string    `json:"old_mode,omitempty"`
+	NewMode    string    `json:"new_mode,omitempty"`
+}
+
+// Summary counts the changes of a diff by kind and sums the file bytes involved.
+type Summary struct {
+	Added       int `json:"added"`
+	Deleted     int `json:"deleted"`
+	Modified    int `json:"modified"`
+	Permissions int `json:"permissions"`
+	Unchanged   int `json:"unchanged"`
+
+	BytesAdded    int64 `json:"bytes_added"`
+	BytesDeleted  int64 `json:"bytes_deleted"`
+	BytesModified int64 `json:"bytes_modified"` // current size of modified files
+	NetDelta      int64 `json:"net_delta"`
+}
+
+// Result holds all changes between one backup set and the side it was compared with.
+type Result struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Hash    bool     `json:"hash"`
+	Changes []Change `json:"changes"`
+	Summary Summary  `json:"summary"`
+}
+
+func (r *Result) add(change Change) {
+	change.SizeDelta = change.NewSize - change.OldSize
+	r.Changes = append(r.Changes, change)
+	r.Summary.NetDelta += change.SizeDelta
+	switch change.Kind {
+	case KindAdded:
+		r.Summary.Added++
+		r.Summary.BytesAdded += change.NewSize
+	case KindDeleted:
+		r.Summary.Deleted++
+		r.Summary.BytesDeleted += change.OldSize
+	case KindModified:
+		r.Summary.Modified++
+		r.Summary.BytesModified += change.NewSize
+	case KindPermissions:
+		r.Summary.Permissions++
+	}
+}
+
+// sort orders changes by path so reports are stable regardless of walk order.
+func (r *Result) sort() {
+	sort.SliceStable(r.Changes, func(i, j int) bool {
+		li, lj := strings.ToLower(r.Changes[i].Path), strings.ToLower(r.Changes[j].Path)
+		if li != lj {
+			return li < lj
+		}
+		return r.Changes[i].Path < r.Changes[j].Path
+	})
+}
+
+// Write renders diff results to w in the given format.
+func Write(w io.Writer, format Format, results []Result) error {
+	switch format {
+	case FormatReport:
+		return writeReport(w, results)
+	case FormatJSON:
+		return writeJSON(w, results)
+	}
+	return fmt.Errorf("Unknown diff format %q. Remedy: Use report or json.", format)
+}
+
+var reportGroups = []struct {
+	kind   Kind
+	title  string
+	marker string
+}{
+	{KindAdded, "Added", "+"},
+	{KindDeleted, "Deleted", "-"},
+	{KindModified, "Modified", "~"},
+	{KindPermissions, "Permissions changed", "*"},
+}
+
+func writeReport(w io.Writer, results []Result) error {
+	for i, result := range results {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Diff: %s → %s\n", result.From, result.To)
+		if result.Hash {
+			fmt.Fprintln(w, "Compared by: size and SHA-256 content hash")
+		} else {
+			fmt.Fprintln(w, "Compared by: size and modification time")
+		}
+
+		if len(result.Changes) == 0 {
+			fmt.Fprintln(w, "No differences.")
+		}
+		for _, group := range reportGroups {
+			changes := changesOfKind(result.Changes, group.kind)
+			if len(changes) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "%s (%d):\n", group.title, len(changes))
+			for _, change := range changes {
+				fmt.Fprintf(w, "  %s %s\n", group.marker, describeChange(change))
+			}
+		}
+		fmt.Fprintln(w, formatSummary(result.Summary))
+		fmt.Fprintln(w, formatChurn(result.Summary))
+	}
+	return nil
+}
+
+func changesOfKind(changes []Change, kind Kind) []Change {
+	var matched []Change
+	for _, change := range changes {
+		if change.Kind == kind {
+			matched = append(matched, change)
+		}
+	}
+	return matched
+}
+
+func describeChange(c Change) string {
+	name := c.Path
+	if c.Type == "dir" {
+		name += "/"
+	}
+
+	switch c.Kind {
+	case KindAdded:
+		if c.Type == "file" {
+			return fmt.Sprintf("%s (%s)", name, util.FormatBytesBinary(uint64(c.NewSize)))
+		}
+		return name
+	case KindDeleted:
+		if c.Type == "file" {
+			return fmt.Sprintf("%s (%s)", name, util.FormatBytesBinary(uint64(c.OldSize)))
+		}
+		return name
+	case KindPermissions:
+		return fmt.Sprintf("%s: %s → %s", name, c.OldMode, c.NewMode)
+	}
+
+	details := make([]string, 0, len(c.Reasons))
+	for _, reason := range c.Reasons {
+		switch reason {
+		case ReasonType:
+			details = append(details, "type changed")
+		case ReasonSize:
+			details = append(details, fmt.Sprintf("size %s → %s (%s)", util.FormatBytesBinary(uint64(c.OldSize)), util.FormatBytesBinary(uint64(c.NewSize)), formatDelta(c.SizeDelta)))
+		case ReasonModTime:
+			details = append(details, fmt.Sprintf("modified %s → %s", formatModTime(c.OldModTime), formatModTime(c.NewModTime)))
+		case ReasonContent:
+			details = append(details, "content differs")
+		}
+	}
+	return fmt.Sprintf("%s: %s", name, strings.Join(details, ", "))
+}
+
+func formatSummary(s Summary) string {
+	return fmt.Sprintf("Summary: %d added, %d deleted, %d modified, %d permissions changed, %d unchanged", s.Added, s.Deleted, s.Modified, s.Permissions, s.Unchanged)
+}
+
+func formatChurn(s Summary) string {
+	return fmt.Sprintf("Churn: %s added, %s deleted, %s in modified files, net %s",
+		util.FormatBytesBinary(uint64(s.BytesAdded)),
+		util.FormatBytesBinary(uint64(s.BytesDeleted)),
+		util.FormatBytesBinary(uint64(s.BytesModified)),
+		formatDelta(s.NetDelta))
+}
+
+// formatDelta formats a signed byte difference such as "+1.00 KB" or "-512 B".
+func formatDelta(delta int64) string {
+	if delta < 0 {
+		return "-" + util.FormatBytesBinary(uint64(-delta))
+	}
+	return "+" + util.FormatBytesBinary(uint64(delta))
+}
+
+func formatModTime(ts time.Time) string {
+	return ts.Local().Format("2006-01-02 15:04:05")
+}
+
+func writeJSON(w io.Writer, results []Result) error {
+	doc := struct {
+		Diffs []Result `json:"diffs"`
+	}{Diffs: results}
+	for i := range doc.Diffs {
+		if doc.Diffs[i].Changes == nil {
+			doc.Diffs[i].Changes = []Change{}
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
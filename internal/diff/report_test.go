@@ -0,0 +1,90 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleResults() []Result {
+	mtime := time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)
+	result := Result{From: "Docs_2026-03-14_ABC123", To: "C:/Users/me/Docs"}
+	result.add(Change{Path: "new.txt", Kind: KindAdded, Type: "file", NewSize: 2048, NewModTime: mtime})
+	result.add(Change{Path: "old", Kind: KindDeleted, Type: "dir"})
+	result.add(Change{Path: "report.xlsx", Kind: KindModified, Type: "file", Reasons: []string{ReasonSize}, OldSize: 1024, NewSize: 2048})
+	result.add(Change{Path: "run.bat", Kind: KindPermissions, Type: "file", OldMode: "-rw-r--r--", NewMode: "-r--r--r--"})
+	result.Summary.Unchanged = 7
+	return []Result{result}
+}
+
+func TestParseFormatDefaultsToReport(t *testing.T) {
+	t.Parallel()
+
+	if format, err := ParseFormat(""); err != nil || format != FormatReport {
+		t.Fatalf("expected report default, got %q (err=%v)", format, err)
+	}
+	if format, err := ParseFormat("JSON"); err != nil || format != FormatJSON {
+		t.Fatalf("expected json, got %q (err=%v)", format, err)
+	}
+	if _, err := ParseFormat("csv"); err == nil {
+		t.Fatal("expected error for unsupported format")
+	}
+}
+
+func TestWriteReportGroupsChanges(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatReport, sampleResults()); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"Diff: Docs_2026-03-14_ABC123 → C:/Users/me/Docs",
+		"Added (1):\n  + new.txt (2.00 KB)",
+		"Deleted (1):\n  - old/",
+		"Modified (1):\n  ~ report.xlsx: size 1.00 KB → 2.00 KB (+1.00 KB)",
+		"Permissions changed (1):\n  * run.bat: -rw-r--r-- → -r--r--r--",
+		"Summary: 1 added, 1 deleted, 1 modified, 1 permissions changed, 7 unchanged",
+		"Churn: 2.00 KB added, 0 B deleted, 2.00 KB in modified files, net +3.00 KB",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected report to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteReportWithoutChanges(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatReport, []Result{{From: "a", To: "b", Hash: true}}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "No differences.") || !strings.Contains(buf.String(), "SHA-256") {
+		t.Fatalf("unexpected report:\n%s", buf.String())
+	}
+}
+
+func TestWriteJSONProducesParsableDocument(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatJSON, sampleResults()); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	var doc struct {
+		Diffs []Result `json:"diffs"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, buf.String())
+	}
+	if len(doc.Diffs) != 1 || len(doc.Diffs[0].Changes) != 4 || doc.Diffs[0].Summary.Unchanged != 7 {
+		t.Fatalf("unexpected JSON document: %+v", doc)
+	}
+	if strings.Contains(buf.String(), "0001-01-01") {
+		t.Fatalf("expected zero timestamps to be omitted, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,278 @@
+package diff
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// errStreamStopped ends an entry producer whose consumer no longer reads.
+var errStreamStopped = errors.New("Entry stream stopped")
+
+// archiveEntry is the metadata of one TAR entry and, when hashing, the SHA-256 of its content.
+type archiveEntry struct {
+	Name  string
+	State entryState
+	Sum   []byte
+}
+
+// entryStream delivers the entries of one archive produced in a separate goroutine.
+type entryStream struct {
+	entries  chan archiveEntry
+	done     chan error
+	stop     chan struct{}
+	next     archiveEntry
+	ok       bool
+	finished bool
+	err      error
+}
+
+// startEntryStream runs produce in a goroutine. produce calls emit once per entry;
+// emit returns errStreamStopped after close has been called. Call advance to load
+// the first entry.
+func startEntryStream(produce func(emit func(archiveEntry) error) error) *entryStream {
+	s := &entryStream{
+		entries: make(chan archiveEntry, 64),
+		done:    make(chan error, 1),
+		stop:    make(chan struct{}),
+	}
+	go func() {
+		err := produce(func(entry archiveEntry) error {
+			select {
+			case s.entries <- entry:
+				return nil
+			case <-s.stop:
+				return errStreamStopped
+			}
+		})
+		close(s.entries)
+		s.done <- err
+	}()
+	return s
+}
+
+// advance loads the next entry into s.next. At the end of the stream s.ok is false
+// and s.err holds the producer's error.
+func (s *entryStream) advance() {
+	s.next, s.ok = <-s.entries
+	if !s.ok {
+		s.err = <-s.done
+		s.finished = true
+	}
+}
+
+// close stops the producer and waits for it to finish.
+func (s *entryStream) close() {
+	close(s.stop)
+	for !s.finished {
+		s.advance()
+	}
+}
+
+// tarEntries emits the entries of a TAR stream in archive order.
+func tarEntries(r io.Reader, hash bool, emit func(archiveEntry) error) error {
+	return util.WalkTar(r, func(hdr *tar.Header, body io.Reader) error {
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if name == "." {
+			return nil
+		}
+		entry := archiveEntry{Name: name, State: stateFromHeader(hdr)}
+		if hash && entry.State.Type == "file" {
+			sum := sha256.New()
+			if _, err := io.Copy(sum, body); err != nil {
+				return fmt.Errorf("Failed to read archived content of %q: %w. Remedy: Check .enc part completeness.", name, err)
+			}
+			entry.Sum = sum.Sum(nil)
+		}
+		return emit(entry)
+	})
+}
+
+// manifestEntries emits the entries recorded in a manifest in archive order.
+func manifestEntries(entries []manifest.Entry, hash bool, emit func(archiveEntry) error) error {
+	for _, e := range entries {
+		if e.Path == "." || e.Deleted() {
+			continue
+		}
+		entry := archiveEntry{Name: e.Path, State: stateFromHeader(e.Header())}
+		if hash && entry.State.Type == "file" {
+			entry.Sum = e.Sum()
+		}
+		if err := emit(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compareEntryStreams merges two entry streams and reports the differences from
+// older to newer. Both streams are consumed concurrently; the stream whose next
+// entry comes first in walk order is advanced, so archives written by util.WriteTar
+// are matched with only a handful of entries held in memory. Entries in any other
+// order are still matched correctly, at the cost of buffering them until their
+// counterpart arrives.
+func compareEntryStreams(older, newer *entryStream, from, to string, hash bool) (Result, error) {
+	defer older.close()
+	defer newer.close()
+
+	result := Result{From: from, To: to, Hash: hash}
+	older.advance()
+	newer.advance()
+	pendingOld := make(map[string]archiveEntry)
+	pendingNew := make(map[string]archiveEntry)
+
+	for older.ok || newer.ok {
+		if older.err != nil || newer.err != nil {
+			break
+		}
+		takeOld := older.ok && (!newer.ok || !walkOrderLess(newer.next.Name, older.next.Name))
+		if takeOld {
+			entry := older.next
+			key := strings.ToLower(entry.Name)
+			if match, found := pendingNew[key]; found {
+				delete(pendingNew, key)
+				compareArchiveEntries(&result, entry, match, hash)
+			} else {
+				pendingOld[key] = entry
+			}
+			older.advance()
+		} else {
+			entry := newer.next
+			key := strings.ToLower(entry.Name)
+			if match, found := pendingOld[key]; found {
+				delete(pendingOld, key)
+				compareArchiveEntries(&result, match, entry, hash)
+			} else {
+				pendingNew[key] = entry
+			}
+			newer.advance()
+		}
+	}
+	if older.err != nil {
+		return result, older.err
+	}
+	if newer.err != nil {
+		return result, newer.err
+	}
+
+	for _, entry := range pendingOld {
+		s := entry.State
+		result.add(Change{Path: entry.Name, Kind: KindDeleted, Type: s.Type, OldSize: s.Size, OldModTime: s.ModTime, OldMode: s.Perm.String()})
+	}
+	for _, entry := range pendingNew {
+		s := entry.State
+		result.add(Change{Path: entry.Name, Kind: KindAdded, Type: s.Type, NewSize: s.Size, NewModTime: s.ModTime, NewMode: s.Perm.String()})
+	}
+	result.sort()
+	return result, nil
+}
+
+// compareArchiveEntries records the change between two archived versions of the same path.
+func compareArchiveEntries(result *Result, before, after archiveEntry, hash bool) {
+	hashed := hash && before.Sum != nil && after.Sum != nil && before.State.Size == after.State.Size
+	if hashed && !bytes.Equal(before.Sum, after.Sum) {
+		result.add(contentChange(after.Name, before.State, after.State))
+		return
+	}
+	if change, changed := compareStates(after.Name, before.State, after.State, hashed); changed {
+		result.add(change)
+	} else {
+		result.Summary.Unchanged++
+	}
+}
+
+// walkOrderLess reports whether archive path a is visited before b by filepath.Walk,
+// which visits a directory before its contents and siblings in byte order.
+func walkOrderLess(a, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// diffRuns decrypts the same directory from two backup runs in parallel and compares them.
+func diffRuns(older, newer util.BackupEntry, backupDir string, olderPassword, newerPassword []byte, log *util.Logger, hash bool) (Result, error) {
+	olderStream, err := startRunEntryStream(older, backupDir, olderPassword, log, hash)
+	if err != nil {
+		return Result{}, err
+	}
+	newerStream, err := startRunEntryStream(newer, backupDir, newerPassword, log, hash)
+	if err != nil {
+		olderStream.close()
+		return Result{}, err
+	}
+	return compareEntryStreams(olderStream, newerStream, older.String(), newer.String(), hash)
+}
+
+func startRunEntryStream(entry util.BackupEntry, backupDir string, password []byte, log *util.Logger, hash bool) (*entryStream, error) {
+	// The manifest holds the metadata and content hashes of every entry, so the
+	// archive does not need to be decrypted when it is available.
+	entries, hasManifest, err := manifest.LoadForBackup(backupDir, entry, password)
+	if err != nil {
+		log.Warn("Manifest of %s could not be read, reading the backup parts instead: %v", entry.String(), err)
+	}
+	if hasManifest {
+		return startEntryStream(func(emit func(archiveEntry) error) error {
+			return manifestEntries(entries, hash, emit)
+		}), nil
+	}
+	if err := requireManifestForIncremental(backupDir, entry, hasManifest); err != nil {
+		return nil, err
+	}
+
+	parts, err := catalog.CollectParts(backupDir, entry)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("No part files found for %s. Remedy: Ensure all .enc files for this backup are in the same backup directory.", entry.String())
+	}
+
+	return startEntryStream(func(emit func(archiveEntry) error) error {
+		err := operation.RunDecryptPipeline(
+			parts,
+			password,
+			log,
+			entry.String(),
+			"compared",
+			"Archive comparison",
+			func(r io.Reader) error { return tarEntries(r, hash, emit) },
+			nil,
+		)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.String(), err)
+		}
+		return nil
+	}), nil
+}
+
+// requireManifestForIncremental fails for an incremental backup without a readable
+// manifest: its archive alone holds only the files changed since its parent. A
+// repository snapshot has no archive at all.
+func requireManifestForIncremental(backupDir string, entry util.BackupEntry, hasManifest bool) error {
+	if hasManifest {
+		return nil
+	}
+	if catalog.IsSnapshot(backupDir, entry) {
+		return fmt.Errorf("Snapshot of %s is unreadable. Remedy: Restore the .snapshot.enc file from a copy of the backup directory; a repository snapshot cannot be compared without it.", entry.String())
+	}
+	info, err := catalog.ReadRunInfo(backupDir, entry)
+	if err != nil {
+		return err
+	}
+	if info.IsIncremental() {
+		return fmt.Errorf("Manifest of incremental backup %s is missing or unreadable. Remedy: Restore the .manifest.enc file from a copy of the backup directory; an incremental backup cannot be compared without it.", entry.String())
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package diff
+
+import (
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tarStream(t *testing.T, dir string, hash bool) *entryStream {
+	t.Helper()
+	archive := snapshotDir(t, dir)
+	return startEntryStream(func(emit func(archiveEntry) error) error {
+		return tarEntries(archive, hash, emit)
+	})
+}
+
+func TestWalkOrderLessMatchesDirectoryWalk(t *testing.T) {
+	t.Parallel()
+
+	ordered := []string{"a", "a/b", "a/b/c.txt", "a/z.txt", "a.txt", "b"}
+	for i := 0; i+1 < len(ordered); i++ {
+		if !walkOrderLess(ordered[i], ordered[i+1]) {
+			t.Fatalf("expected %q before %q", ordered[i], ordered[i+1])
+		}
+		if walkOrderLess(ordered[i+1], ordered[i]) {
+			t.Fatalf("expected %q not before %q", ordered[i+1], ordered[i])
+		}
+	}
+}
+
+func TestCompareEntryStreamsReportsChangesAndChurn(t *testing.T) {
+	t.Parallel()
+
+	older := t.TempDir()
+	writeFile(t, filepath.Join(older, "keep.txt"), "same")
+	writeFile(t, filepath.Join(older, "grow.txt"), "12345")
+	writeFile(t, filepath.Join(older, "old", "gone.txt"), "0123456789")
+
+	newer := t.TempDir()
+	writeFile(t, filepath.Join(newer, "keep.txt"), "same")
+	writeFile(t, filepath.Join(newer, "grow.txt"), "1234567890")
+	writeFile(t, filepath.Join(newer, "fresh.txt"), "abc")
+	syncModTimes(t, older, newer, "keep.txt")
+
+	result, err := compareEntryStreams(tarStream(t, older, false), tarStream(t, newer, false), "A", "B", false)
+	if err != nil {
+		t.Fatalf("compareEntryStreams failed: %v", err)
+	}
+
+	want := map[string]Kind{
+		"grow.txt":     KindModified,
+		"fresh.txt":    KindAdded,
+		"old":          KindDeleted,
+		"old/gone.txt": KindDeleted,
+	}
+	for path, kind := range want {
+		change, ok := changeByPath(result, path)
+		if !ok || change.Kind != kind {
+			t.Fatalf("expected %s to be %s, got %+v (found=%v)", path, kind, change, ok)
+		}
+	}
+	if len(result.Changes) != len(want) || result.Summary.Unchanged != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	grow, _ := changeByPath(result, "grow.txt")
+	if grow.SizeDelta != 5 {
+		t.Fatalf("expected size delta +5, got %d", grow.SizeDelta)
+	}
+	s := result.Summary
+	if s.BytesAdded != 3 || s.BytesDeleted != 10 || s.BytesModified != 10 || s.NetDelta != 3+5-10 {
+		t.Fatalf("unexpected churn summary: %+v", s)
+	}
+}
+
+func TestCompareEntryStreamsHashIgnoresTimestampOnlyChanges(t *testing.T) {
+	t.Parallel()
+
+	older := t.TempDir()
+	writeFile(t, filepath.Join(older, "doc.txt"), "content")
+	newer := t.TempDir()
+	writeFile(t, filepath.Join(newer, "doc.txt"), "content")
+	later := time.Now().Add(3 * time.Hour)
+	if err := os.Chtimes(filepath.Join(newer, "doc.txt"), later, later); err != nil {
+		t.Fatalf("failed to set mtime: %v", err)
+	}
+
+	result, err := compareEntryStreams(tarStream(t, older, true), tarStream(t, newer, true), "A", "B", true)
+	if err != nil {
+		t.Fatalf("compareEntryStreams failed: %v", err)
+	}
+	if _, ok := changeByPath(result, "doc.txt"); ok {
+		t.Fatalf("expected identical content to be unchanged, got %+v", result.Changes)
+	}
+}
+
+func TestCompareEntryStreamsMatchesEntriesOutOfWalkOrder(t *testing.T) {
+	t.Parallel()
+
+	mtime := time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)
+	stream := func(names ...string) *entryStream {
+		return startEntryStream(func(emit func(archiveEntry) error) error {
+			for _, name := range names {
+				if err := emit(archiveEntry{Name: name, State: entryState{Type: "file", Size: 1, ModTime: mtime}}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	result, err := compareEntryStreams(stream("c", "a", "b"), stream("b", "c", "a"), "A", "B", false)
+	if err != nil {
+		t.Fatalf("compareEntryStreams failed: %v", err)
+	}
+	if len(result.Changes) != 0 || result.Summary.Unchanged != 3 {
+		t.Fatalf("expected all entries to match, got %+v", result)
+	}
+}
+
+func TestCompareEntryStreamsStopsOnProducerError(t *testing.T) {
+	t.Parallel()
+
+	failing := startEntryStream(func(func(archiveEntry) error) error {
+		return errors.New("broken archive")
+	})
+	var endless bytes.Buffer
+	tw := tar.NewWriter(&endless)
+	for i := 0; i < 500; i++ {
+		if err := tw.WriteHeader(&tar.Header{Name: strings.Repeat("x", i%50+1) + ".txt", Typeflag: tar.TypeReg, Mode: 0o600}); err != nil {
+			t.Fatalf("failed to write header: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+	other := startEntryStream(func(emit func(archiveEntry) error) error {
+		return tarEntries(&endless, false, emit)
+	})
+
+	if _, err := compareEntryStreams(failing, other, "A", "B", false); err == nil || !strings.Contains(err.Error(), "broken archive") {
+		t.Fatalf("expected producer error, got: %v", err)
+	}
+}
+
+func TestDiffRunsComparesTwoBackupRuns(t *testing.T) {
+	password := []byte("diff-runs-password")
+	fx := testutil.NewBackupFixture(t, password)
+	second := util.BackupEntry{DirectoryName: fx.Entry.DirectoryName, Date: "2026-03-15", ID: util.BackupID("FIX002")}
+	testutil.CreateBackupInDir(t, fx.BackupDir, second, password)
+
+	result, err := diffRuns(fx.Entry, second, fx.BackupDir, password, password, nil, false)
+	if err != nil {
+		t.Fatalf("diffRuns failed: %v", err)
+	}
+	if result.From != fx.Entry.String() || result.To != second.String() {
+		t.Fatalf("unexpected sides: %s → %s", result.From, result.To)
+	}
+	if _, ok := changeByPath(result, "data.txt"); !ok || result.Summary.Added != 1 {
+		t.Fatalf("expected data.txt to be added, got %+v", result.Changes)
+	}
+	if change, ok := changeByPath(result, "large.bin"); !ok || change.Kind != KindDeleted {
+		t.Fatalf("expected large.bin to be deleted, got %+v", result.Changes)
+	}
+}
+
+func TestDiffRunsWrongPasswordFails(t *testing.T) {
+	password := []byte("diff-runs-password")
+	fx := testutil.NewBackupFixture(t, password)
+	second := util.BackupEntry{DirectoryName: fx.Entry.DirectoryName, Date: "2026-03-15", ID: util.BackupID("FIX002")}
+	testutil.CreateBackupInDir(t, fx.BackupDir, second, password)
+
+	if _, err := diffRuns(fx.Entry, second, fx.BackupDir, password, []byte("wrong"), nil, false); err == nil {
+		t.Fatal("expected error for wrong password of the second run, got nil")
+	}
+}
+
+// syncModTimes gives name the same modification time in both directories.
+func syncModTimes(t *testing.T, older, newer, name string) {
+	t.Helper()
+	mtime := time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)
+	for _, dir := range []string{older, newer} {
+		if err := os.Chtimes(filepath.Join(dir, name), mtime, mtime); err != nil {
+			t.Fatalf("failed to set mtime: %v", err)
+		}
+	}
+}
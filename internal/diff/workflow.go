@@ -0,0 +1,545 @@
+// Package diff compares backup sets with the live source directories they were created from,
+// or with the same directories in a second backup run:
+//  1. Let the user choose which backup(s) to compare and what to compare them with
+//  2. Map each backup to its source directory in config.yaml or to its counterpart in the second run
+//  3. Verify password(s) (up to 3 attempts per run)
+//  4. Decrypt the parts, walk the TAR stream(s) and compare every entry
+//  5. Print a grouped report or JSON of added, deleted, modified and permission-changed entries
+package diff
+
+import (
+	"RestoreSafe/internal/backup"
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readLineFn is the line reader used by the diff prompts; tests replace it.
+var readLineFn = security.ReadLine
+
+// Options holds diff choices passed as arguments instead of being entered at the prompts.
+type Options struct {
+	// Backup selects the backup(s) to compare: a dot (.), a backup ID or a full backup name.
+	Backup string
+	// Against selects a second backup run to compare with; empty compares with the live
+	// source directories.
+	Against string
+	// Hash compares file contents by SHA-256 instead of by modification time.
+	Hash bool
+	// Format is report (default) or json.
+	Format string
+	// Output writes the report to this file instead of the console.
+	Output string
+}
+
+// settings are the resolved comparison and output choices of one diff run.
+type settings struct {
+	hash   bool
+	format Format
+	output string
+}
+
+// Run compares selected backup sets with their live source directories.
+func Run(cfg *util.Config, exeDir string) error {
+	return run(cfg, exeDir, nil)
+}
+
+// RunWithOptions compares the backup sets selected by opts with their live source directories.
+// The password is still prompted.
+func RunWithOptions(cfg *util.Config, exeDir string, opts Options) error {
+	return run(cfg, exeDir, &opts)
+}
+
+func run(cfg *util.Config, exeDir string, opts *Options) error {
+	backupDir := util.ResolveDir(cfg.BackupDirectory, exeDir)
+
+	index, err := catalog.ScanBackups(backupDir)
+	if err != nil {
+		return fmt.Errorf("Failed to scan backup directory %q: %w. Remedy: Check the backup_directory path in config.yaml and ensure the directory is readable.", backupDir, err)
+	}
+	if len(index) == 0 {
+		fmt.Println("No backups found in backup directory. Remedy: Check whether .enc files are in the backup directory and whether the correct directory is selected.")
+		return nil
+	}
+
+	selected, err := resolveDiffSelection(backupDir, index, opts)
+	if err != nil {
+		if errors.Is(err, operation.ErrSelectionCancelled) {
+			fmt.Println("Diff cancelled.")
+			return nil
+		}
+		return err
+	}
+
+	against, err := resolveDiffAgainst(backupDir, index, opts)
+	if err != nil {
+		if errors.Is(err, operation.ErrSelectionCancelled) {
+			fmt.Println("Diff cancelled.")
+			return nil
+		}
+		return err
+	}
+
+	s, err := resolveDiffSettings(opts)
+	if err != nil {
+		if errors.Is(err, operation.ErrSelectionCancelled) {
+			fmt.Println("Diff cancelled.")
+			return nil
+		}
+		return err
+	}
+
+	requiresYubiKey, yubiKeyOnly, err := catalog.BackupRunUsesYubiKey(backupDir, selected[0])
+	if err != nil {
+		return fmt.Errorf("Failed to inspect backup authentication: %w. Remedy: Check read permissions in the backup directory and existing .challenge files.", err)
+	}
+	if len(against) > 0 {
+		againstYubiKey, againstYubiKeyOnly, err := catalog.BackupRunUsesYubiKey(backupDir, against[0])
+		if err != nil {
+			return fmt.Errorf("Failed to inspect backup authentication: %w. Remedy: Check read permissions in the backup directory and existing .challenge files.", err)
+		}
+		requiresYubiKey = requiresYubiKey || againstYubiKey
+		yubiKeyOnly = yubiKeyOnly && againstYubiKeyOnly
+	}
+
+	logPath := util.LogFileName(backupDir, selected[0].Date, selected[0].ID)
+	log := operation.OpenLogger(cfg, backupDir, selected[0])
+	warningCount := 0
+	if log.IsConsoleOnly() {
+		warningCount++
+	}
+	defer log.Close()
+
+	preflight := buildDiffPreflight(selected, against, backupDir, cfg.SourceDirectories, exeDir)
+	printDiffPreflightWithYubiKeyCheck(os.Stdout, cfg, backupDir, preflight, s, requiresYubiKey, yubiKeyOnly, security.CheckYubiKeyConnected)
+	if err := validateDiffPreflight(preflight, s); err != nil {
+		return err
+	}
+	for _, item := range preflight {
+		if item.Warning != "" {
+			warningCount++
+		}
+	}
+
+	passwordPrompt := "Enter diff password: "
+	if len(against) > 0 {
+		passwordPrompt = fmt.Sprintf("Enter password for backup %s: ", selected[0].ID)
+	}
+	password, err := operation.ReadPasswordWithRetry(backupDir, selected[0], passwordPrompt, log)
+	if err != nil {
+		return err
+	}
+	defer func() { security.ZeroBytes(password) }()
+
+	againstPassword := password
+	if len(against) > 0 {
+		againstPassword, err = operation.ReadPasswordWithRetry(backupDir, against[0], fmt.Sprintf("Enter password for backup %s: ", against[0].ID), log)
+		if err != nil {
+			return err
+		}
+		defer func() { security.ZeroBytes(againstPassword) }()
+	}
+
+	log.InfoLogOnly("Diff started - ID: %s, date: %s", string(selected[0].ID), selected[0].Date)
+	for _, item := range preflight {
+		log.InfoLogOnly("  %s ↔ %s", item.Entry.String(), item.target())
+	}
+
+	results, err := diffSelectedEntries(preflight, backupDir, password, againstPassword, log, s.hash)
+	if err != nil {
+		return err
+	}
+
+	if err := writeResults(s, results); err != nil {
+		return err
+	}
+
+	log.InfoLogOnly("Diff completed successfully.")
+	fmt.Printf("\nLog file: %s\n", logPath)
+	if warningCount > 0 {
+		fmt.Printf("Warnings: %d\n", warningCount)
+	}
+	return nil
+}
+
+func resolveDiffSelection(backupDir string, index []util.BackupEntry, opts *Options) ([]util.BackupEntry, error) {
+	if opts != nil {
+		selected, _, err := operation.ResolveBackupSelection(backupDir, index, opts.Backup)
+		return selected, err
+	}
+	selected, _, err := operation.PromptBackupSelection("compare", backupDir, index)
+	return selected, err
+}
+
+// resolveDiffAgainst returns the entries of the second backup run to compare with,
+// or nil to compare with the live source directories.
+func resolveDiffAgainst(backupDir string, index []util.BackupEntry, opts *Options) ([]util.BackupEntry, error) {
+	if opts != nil {
+		if strings.TrimSpace(opts.Against) == "" {
+			return nil, nil
+		}
+		against, _, err := operation.ResolveBackupSelection(backupDir, index, opts.Against)
+		return against, err
+	}
+	return promptDiffAgainst(backupDir, index)
+}
+
+func promptDiffAgainst(backupDir string, index []util.BackupEntry) ([]util.BackupEntry, error) {
+	for {
+		fmt.Printf("Compare with:\n")
+		fmt.Printf("  - Press Enter → the live source directories from config.yaml\n")
+		fmt.Printf("  - Enter a backup ID or full backup name → the same directories in a second backup run\n")
+		fmt.Printf("  - Enter q → cancel\n")
+		fmt.Println()
+
+		input, err := readLineFn("Compare with: ")
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println()
+		input = strings.TrimSpace(input)
+
+		switch input {
+		case "":
+			return nil, nil
+		case "q":
+			return nil, operation.ErrSelectionCancelled
+		}
+
+		against, _, err := operation.ResolveBackupSelection(backupDir, index, input)
+		if err != nil {
+			fmt.Printf("%v\n\n", err)
+			continue
+		}
+		return against, nil
+	}
+}
+
+func resolveDiffSettings(opts *Options) (settings, error) {
+	if opts != nil {
+		format, err := ParseFormat(opts.Format)
+		if err != nil {
+			return settings{}, err
+		}
+		return settings{hash: opts.Hash, format: format, output: strings.TrimSpace(opts.Output)}, nil
+	}
+
+	hash, err := promptHash()
+	if err != nil {
+		return settings{}, err
+	}
+	format, err := promptDiffFormat()
+	if err != nil {
+		return settings{}, err
+	}
+	return settings{hash: hash, format: format}, nil
+}
+
+func promptHash() (bool, error) {
+	for {
+		answer, err := readLineFn("Compare file contents by SHA-256 hash (slower, reads every unchanged-size file)? [y/N/q]: ")
+		if err != nil {
+			return false, err
+		}
+		fmt.Println()
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "", "n", "no":
+			return false, nil
+		case "y", "yes":
+			return true, nil
+		case "q":
+			return false, operation.ErrSelectionCancelled
+		}
+		fmt.Println("Please answer y, n or q.")
+		fmt.Println()
+	}
+}
+
+func promptDiffFormat() (Format, error) {
+	for {
+		answer, err := readLineFn("Output format [report/json] (Enter = report): ")
+		if err != nil {
+			return "", err
+		}
+		fmt.Println()
+		format, err := ParseFormat(answer)
+		if err != nil {
+			fmt.Printf("%v\n\n", err)
+			continue
+		}
+		return format, nil
+	}
+}
+
+type diffPreflightItem struct {
+	Entry     util.BackupEntry
+	PartCount int
+	// SourceDir is the live directory to compare with; empty when Against is set.
+	SourceDir string
+	// Against is the same directory in the second backup run, if one was selected.
+	Against      *util.BackupEntry
+	AgainstParts int
+	Warning      string
+	Err          error
+}
+
+// target describes what the entry is compared with.
+func (item diffPreflightItem) target() string {
+	if item.Against != nil {
+		return item.Against.String()
+	}
+	if item.SourceDir == "" {
+		return "-"
+	}
+	return filepath.ToSlash(item.SourceDir)
+}
+
+func buildDiffPreflight(selected, against []util.BackupEntry, backupDir string, sourceDirectories []string, exeDir string) []diffPreflightItem {
+	items := make([]diffPreflightItem, 0, len(selected))
+	for _, entry := range selected {
+		item := diffPreflightItem{Entry: entry}
+		item.PartCount, item.Err = inspectDiffParts(backupDir, entry)
+
+		if len(against) > 0 {
+			pairRunEntry(&item, against, backupDir)
+			items = append(items, item)
+			continue
+		}
+
+		// A stream from a command or standard input has no source on disk; only runs can be compared.
+		if info, err := catalog.ReadRunInfo(backupDir, entry); err == nil && info.IsStream() {
+			if item.Err == nil {
+				item.Err = fmt.Errorf("Backup %s holds a stream from a command or standard input and cannot be compared with a source directory. Remedy: Compare it with another backup run using -against.", entry.String())
+			}
+			items = append(items, item)
+			continue
+		}
+
+		sourceDir, ok := backup.SourceDirectoryForBackupName(sourceDirectories, exeDir, entry.DirectoryName)
+		if !ok {
+			if item.Err == nil {
+				item.Err = fmt.Errorf("No source directory in config.yaml is backed up as %q. Remedy: Add the original directory to source_directories or select a different backup.", entry.DirectoryName)
+			}
+		} else {
+			item.SourceDir = sourceDir
+			if _, statErr := os.Stat(sourceDir); statErr != nil {
+				item.Warning = fmt.Sprintf("Source %s does not exist; all entries will be reported as deleted.", filepath.ToSlash(sourceDir))
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+func inspectDiffParts(backupDir string, entry util.BackupEntry) (int, error) {
+	partCount, _, err := catalog.InspectBackupParts(backupDir, entry)
+	if err == nil && partCount == 0 {
+		err = fmt.Errorf("No part files found. Remedy: Ensure all .enc parts of this backup are in the same backup directory.")
+	}
+	return partCount, err
+}
+
+// pairRunEntry finds the backup of item's directory in the second run.
+func pairRunEntry(item *diffPreflightItem, against []util.BackupEntry, backupDir string) {
+	for i := range against {
+		if !strings.EqualFold(against[i].DirectoryName, item.Entry.DirectoryName) {
+			continue
+		}
+		if against[i].Date == item.Entry.Date && against[i].ID == item.Entry.ID {
+			if item.Err == nil {
+				item.Err = fmt.Errorf("%s would be compared with itself. Remedy: Select two different backup runs.", item.Entry.String())
+			}
+			return
+		}
+		match := against[i]
+		item.Against = &match
+		partCount, err := inspectDiffParts(backupDir, match)
+		item.AgainstParts = partCount
+		if item.Err == nil && err != nil {
+			item.Err = fmt.Errorf("%s: %w", match.String(), err)
+		}
+		return
+	}
+	if item.Err == nil {
+		item.Err = fmt.Errorf("Backup run %s has no backup of directory %q. Remedy: Select a run that contains the same source directory.", against[0].ID, item.Entry.DirectoryName)
+	}
+}
+
+func printDiffPreflightWithYubiKeyCheck(
+	w io.Writer,
+	cfg *util.Config,
+	backupDir string,
+	items []diffPreflightItem,
+	s settings,
+	requiresYubiKey, yubiKeyOnly bool,
+	checkYubiKeyConnected func() error,
+) {
+	var issues, warnings []string
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Diff preflight")
+	fmt.Fprintln(w, "--------------")
+
+	// Backup selection and live source directories
+	fmt.Fprintln(w, "Backup selection:")
+	fmt.Fprintf(w, "  Path: %s\n", filepath.ToSlash(backupDir))
+	for _, item := range items {
+		status := "[OK]"
+		switch {
+		case item.Err != nil:
+			status = "[ERROR]"
+			issues = append(issues, item.Err.Error())
+		case item.Warning != "":
+			status = "[WARN]"
+			warnings = append(warnings, item.Warning)
+		}
+		if item.Against != nil {
+			fmt.Fprintf(w, "  %s %s (parts: %d) ↔ %s (parts: %d)\n", status, item.Entry.String(), item.PartCount, item.target(), item.AgainstParts)
+		} else {
+			fmt.Fprintf(w, "  %s %s (parts: %d) ↔ %s\n", status, item.Entry.String(), item.PartCount, item.target())
+		}
+	}
+
+	// Comparison and output
+	compare := "size and modification time"
+	if s.hash {
+		compare = "size and SHA-256 content hash"
+	}
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Compare by", compare)
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Format", string(s.format))
+	if s.output == "" {
+		operation.PrintField(w, operation.DefaultFieldLabelWidth, "Output", "console")
+	} else {
+		operation.PrintField(w, operation.DefaultFieldLabelWidth, "Output", filepath.ToSlash(s.output))
+		if _, err := os.Stat(s.output); err == nil {
+			issues = append(issues, fmt.Sprintf("Output file %s already exists. Remedy: Choose a different output path or delete the existing file.", filepath.ToSlash(s.output)))
+		}
+	}
+
+	// Authentication and Log level
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Authentication", operation.BackupAuthenticationLabel(requiresYubiKey, yubiKeyOnly))
+	operation.PrintYubiKeyPreflightStatus(w, requiresYubiKey, "the comparison", checkYubiKeyConnected)
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Log level", strings.ToLower(cfg.LogLevel))
+
+	// Print collected warnings and issues
+	if len(warnings) > 0 || len(issues) > 0 {
+		fmt.Fprintln(w)
+		for _, warning := range warnings {
+			fmt.Fprintf(w, "[WARN] %s\n", warning)
+		}
+		for _, issue := range issues {
+			fmt.Fprintf(w, "[ERROR] %s\n", issue)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+func validateDiffPreflight(items []diffPreflightItem, s settings) error {
+	if err := operation.ValidatePreflightItems(
+		items,
+		func(item diffPreflightItem) bool { return item.Err != nil },
+		"Diff preflight failed: %d selected item(s) are incomplete or have nothing to compare with. Remedy: Fix the [ERROR] entries above and start the diff again.",
+	); err != nil {
+		return err
+	}
+	if s.output != "" {
+		if _, err := os.Stat(s.output); err == nil {
+			return fmt.Errorf("Diff preflight failed: output file %s already exists. Remedy: Choose a different output path or delete the existing file.", filepath.ToSlash(s.output))
+		}
+	}
+	return nil
+}
+
+func diffSelectedEntries(items []diffPreflightItem, backupDir string, password, againstPassword []byte, log *util.Logger, hash bool) ([]Result, error) {
+	results := make([]Result, 0, len(items))
+	for _, item := range items {
+		var result Result
+		var err error
+		if item.Against != nil {
+			result, err = diffRuns(item.Entry, *item.Against, backupDir, password, againstPassword, log, hash)
+		} else {
+			result, err = diffEntry(item.Entry, item.SourceDir, backupDir, password, log, hash)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Failed to compare directory %q: %w", item.Entry.String(), err)
+		}
+		s := result.Summary
+		log.InfoLogOnly("  Compared: %d added, %d deleted, %d modified, %d permissions changed - [%s]", s.Added, s.Deleted, s.Modified, s.Permissions, item.Entry.DirectoryName)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// diffEntry decrypts all parts of one backup entry and compares the TAR stream with sourceDir.
+func diffEntry(entry util.BackupEntry, sourceDir, backupDir string, password []byte, log *util.Logger, hash bool) (Result, error) {
+	parts, err := catalog.CollectParts(backupDir, entry)
+	if err != nil {
+		return Result{}, err
+	}
+	snapshot := len(parts) == 0 && catalog.IsSnapshot(backupDir, entry)
+	if len(parts) == 0 && !snapshot {
+		return Result{}, fmt.Errorf("No part files found for %s. Remedy: Ensure all .enc files for this backup are in the same backup directory.", entry.String())
+	}
+
+	// An incremental archive holds only changed files; its manifest records the full snapshot.
+	// A repository snapshot has no archive and is compared through its entries as well.
+	info, err := catalog.ReadRunInfo(backupDir, entry)
+	if err != nil {
+		return Result{}, err
+	}
+	if info.IsIncremental() || snapshot {
+		entries, hasManifest, err := manifest.LoadForBackup(backupDir, entry, password)
+		if err != nil {
+			log.Warn("Manifest of %s could not be read: %v", entry.String(), err)
+		}
+		if err := requireManifestForIncremental(backupDir, entry, hasManifest); err != nil {
+			return Result{}, err
+		}
+		return compareManifestWithDirectory(entries, entry.String(), sourceDir, []string{backupDir}, hash)
+	}
+
+	var result Result
+	err = operation.RunDecryptPipeline(
+		parts,
+		password,
+		log,
+		entry.DirectoryName,
+		"compared",
+		"Archive comparison",
+		func(r io.Reader) error {
+			var compareErr error
+			result, compareErr = compareWithDirectory(r, entry.String(), sourceDir, []string{backupDir}, hash)
+			return compareErr
+		},
+		nil,
+	)
+	return result, err
+}
+
+func writeResults(s settings, results []Result) error {
+	if s.output == "" {
+		return Write(os.Stdout, s.format, results)
+	}
+
+	f, err := os.OpenFile(s.output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("Failed to create output file %q: %w. Remedy: Check the output path and write permissions.", s.output, err)
+	}
+	if err := Write(f, s.format, results); err != nil {
+		f.Close() //nolint:errcheck
+		return fmt.Errorf("Failed to write output file %q: %w", s.output, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("Failed to close output file %q: %w", s.output, err)
+	}
+	fmt.Printf("Diff report written to: %s\n", filepath.ToSlash(s.output))
+	return nil
+}
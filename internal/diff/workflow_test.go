@@ -0,0 +1,141 @@
+package diff
+
+import (
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDiffEntryComparesBackupWithLiveDirectory(t *testing.T) {
+	password := []byte("diff-password")
+	fx := testutil.NewBackupFixture(t, password)
+
+	if err := os.Remove(filepath.Join(fx.SrcDir, "large.bin")); err != nil {
+		t.Fatalf("failed to remove fixture file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(fx.SrcDir, "added.txt"), []byte("new"), 0o600); err != nil {
+		t.Fatalf("failed to add file: %v", err)
+	}
+
+	result, err := diffEntry(fx.Entry, fx.SrcDir, fx.BackupDir, password, nil, true)
+	if err != nil {
+		t.Fatalf("diffEntry failed: %v", err)
+	}
+	if result.From != fx.Entry.String() {
+		t.Fatalf("expected from %q, got %q", fx.Entry.String(), result.From)
+	}
+	if result.Summary.Added != 1 || result.Summary.Deleted != 1 || result.Summary.Modified != 0 {
+		t.Fatalf("unexpected summary: %+v (changes: %+v)", result.Summary, result.Changes)
+	}
+}
+
+func TestDiffEntryWrongPasswordFails(t *testing.T) {
+	fx := testutil.NewBackupFixture(t, []byte("correct-password"))
+
+	if _, err := diffEntry(fx.Entry, fx.SrcDir, fx.BackupDir, []byte("wrong-password"), nil, false); err == nil {
+		t.Fatal("expected error for wrong password, got nil")
+	}
+}
+
+func TestBuildDiffPreflightMapsBackupToSourceDirectory(t *testing.T) {
+	t.Parallel()
+
+	fx := testutil.NewBackupFixture(t, []byte("diff-preflight"))
+	items := buildDiffPreflight([]util.BackupEntry{fx.Entry}, nil, fx.BackupDir, []string{fx.SrcDir}, "")
+	if len(items) != 1 || items[0].Err != nil || items[0].Warning != "" {
+		t.Fatalf("expected a valid preflight item, got %+v", items)
+	}
+	if filepath.Clean(items[0].SourceDir) != filepath.Clean(fx.SrcDir) {
+		t.Fatalf("expected source %q, got %q", fx.SrcDir, items[0].SourceDir)
+	}
+}
+
+func TestBuildDiffPreflightRejectsUnknownSource(t *testing.T) {
+	t.Parallel()
+
+	fx := testutil.NewBackupFixture(t, []byte("diff-preflight"))
+	items := buildDiffPreflight([]util.BackupEntry{fx.Entry}, nil, fx.BackupDir, []string{t.TempDir()}, "")
+	if len(items) != 1 || items[0].Err == nil || !strings.Contains(items[0].Err.Error(), "source_directories") {
+		t.Fatalf("expected unmatched-source error, got %+v", items)
+	}
+	if err := validateDiffPreflight(items, settings{format: FormatReport}); err == nil || !strings.HasPrefix(err.Error(), "Diff preflight failed:") {
+		t.Fatalf("expected preflight failure, got: %v", err)
+	}
+}
+
+func TestResolveDiffSettingsPromptsForHashAndFormat(t *testing.T) {
+	answers := []string{"y", "json"}
+	original := readLineFn
+	readLineFn = func(string) (string, error) {
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, nil
+	}
+	t.Cleanup(func() { readLineFn = original })
+
+	var s settings
+	testutil.CaptureStdout(t, func() {
+		var err error
+		s, err = resolveDiffSettings(nil)
+		if err != nil {
+			t.Errorf("resolveDiffSettings failed: %v", err)
+		}
+	})
+	if !s.hash || s.format != FormatJSON {
+		t.Fatalf("unexpected settings: %+v", s)
+	}
+}
+
+func TestRunReturnsNilWhenNoBackupsFound(t *testing.T) {
+	t.Parallel()
+	cfg := &util.Config{BackupDirectory: t.TempDir()}
+
+	output := testutil.CaptureStdout(t, func() {
+		if err := Run(cfg, ""); err != nil {
+			t.Errorf("expected nil for empty backup dir, got: %v", err)
+		}
+	})
+	if !strings.Contains(output, "No backups found") {
+		t.Fatalf("expected no-backups message in output, got: %q", output)
+	}
+}
+
+func TestBuildDiffPreflightPairsDirectoriesOfTwoRuns(t *testing.T) {
+	t.Parallel()
+
+	password := []byte("diff-pair")
+	fx := testutil.NewBackupFixture(t, password)
+	second := util.BackupEntry{DirectoryName: fx.Entry.DirectoryName, Date: "2026-03-15", ID: util.BackupID("FIX002")}
+	testutil.CreateBackupInDir(t, fx.BackupDir, second, password)
+
+	items := buildDiffPreflight([]util.BackupEntry{fx.Entry}, []util.BackupEntry{second}, fx.BackupDir, nil, "")
+	if len(items) != 1 || items[0].Err != nil || items[0].Against == nil || *items[0].Against != second || items[0].AgainstParts == 0 {
+		t.Fatalf("expected paired preflight item, got %+v", items)
+	}
+
+	items = buildDiffPreflight([]util.BackupEntry{fx.Entry}, []util.BackupEntry{fx.Entry}, fx.BackupDir, nil, "")
+	if items[0].Err == nil || !strings.Contains(items[0].Err.Error(), "itself") {
+		t.Fatalf("expected same-run error, got %+v", items)
+	}
+
+	other := util.BackupEntry{DirectoryName: "Pictures", Date: "2026-03-16", ID: util.BackupID("FIX003")}
+	items = buildDiffPreflight([]util.BackupEntry{fx.Entry}, []util.BackupEntry{other}, fx.BackupDir, nil, "")
+	if items[0].Err == nil || !strings.Contains(items[0].Err.Error(), "no backup of directory") {
+		t.Fatalf("expected unmatched-directory error, got %+v", items)
+	}
+}
+
+func TestBuildDiffPreflightRejectsCommandOutputAgainstSource(t *testing.T) {
+	t.Parallel()
+	backupDir := t.TempDir()
+	entry := util.BackupEntry{DirectoryName: "crm.dump", Date: "2026-03-12", ID: util.BackupID("CMD001")}
+	testutil.CreateStreamBackup(t, backupDir, entry, []byte("dump content"), []byte("pw"))
+
+	items := buildDiffPreflight([]util.BackupEntry{entry}, nil, backupDir, []string{t.TempDir()}, "")
+	if items[0].Err == nil || !strings.Contains(items[0].Err.Error(), "-against") {
+		t.Fatalf("expected an error pointing to -against, got %+v", items[0])
+	}
+}
@@ -0,0 +1,164 @@
+package export
+
+import (
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Format is the archive format of an export. It follows from the extension of the output file.
+type Format string
+
+const (
+	FormatTar   Format = "tar"
+	FormatTarGz Format = "tar.gz"
+	FormatZip   Format = "zip"
+)
+
+// FormatFromPath returns the Format for the extension of path: .tar, .tar.gz, .tgz or .zip.
+func FormatFromPath(path string) (Format, error) {
+	lower := strings.ToLower(strings.TrimSpace(path))
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return FormatTarGz, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return FormatTar, nil
+	case strings.HasSuffix(lower, ".zip"):
+		return FormatZip, nil
+	}
+	return "", fmt.Errorf("Unsupported export file %q. Remedy: Use an output file name ending in .tar, .tar.gz, .tgz or .zip.", filepath.Base(path))
+}
+
+// VolumeName returns the path of volume seq (1-based) of a split export, e.g. documents.zip.001.
+// The volumes joined in order form the archive.
+func VolumeName(path string, seq int) string {
+	return fmt.Sprintf("%s.%03d", path, seq)
+}
+
+// archiveWriter adds the entries of an export to an archive.
+type archiveWriter interface {
+	// WriteEntry adds a directory or a regular file; body is read for regular files only.
+	WriteEntry(hdr *tar.Header, body io.Reader) error
+	Close() error
+}
+
+func newArchiveWriter(w io.Writer, format Format) archiveWriter {
+	switch format {
+	case FormatZip:
+		return &zipArchive{zw: zip.NewWriter(w)}
+	case FormatTarGz:
+		gz := gzip.NewWriter(w)
+		return &tarArchive{tw: tar.NewWriter(gz), gz: gz}
+	}
+	return &tarArchive{tw: tar.NewWriter(w)}
+}
+
+type tarArchive struct {
+	tw *tar.Writer
+	gz *gzip.Writer
+}
+
+func (a *tarArchive) WriteEntry(hdr *tar.Header, body io.Reader) error {
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil
+	}
+	_, err := io.Copy(a.tw, body)
+	return err
+}
+
+func (a *tarArchive) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	if a.gz != nil {
+		return a.gz.Close()
+	}
+	return nil
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (a *zipArchive) WriteEntry(hdr *tar.Header, body io.Reader) error {
+	fh := &zip.FileHeader{Name: hdr.Name, Modified: hdr.ModTime, Method: zip.Deflate}
+	fh.SetMode(hdr.FileInfo().Mode())
+	if hdr.Typeflag == tar.TypeDir {
+		fh.Name = strings.TrimSuffix(hdr.Name, "/") + "/"
+		fh.Method = zip.Store
+	}
+	w, err := a.zw.CreateHeader(fh)
+	if err != nil || hdr.Typeflag == tar.TypeDir {
+		return err
+	}
+	_, err = io.Copy(w, body)
+	return err
+}
+
+func (a *zipArchive) Close() error {
+	return a.zw.Close()
+}
+
+// exportFile is the output of an export: a single new file or, with a volume size,
+// a series of volumes named by VolumeName.
+type exportFile struct {
+	bw    *bufio.Writer
+	file  *os.File
+	split *util.Writer
+}
+
+func createExportFile(path string, volumeBytes int64) (*exportFile, error) {
+	if volumeBytes > 0 {
+		split := util.NewWriter(func(seq int) string { return VolumeName(path, seq) }, volumeBytes)
+		return &exportFile{bw: bufio.NewWriterSize(split, util.SplitWriteBufferSize), split: split}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create export file %q: %w. Remedy: Check the output path and write permissions.", path, err)
+	}
+	return &exportFile{bw: bufio.NewWriter(f), file: f}, nil
+}
+
+func (f *exportFile) Write(p []byte) (int, error) {
+	return f.bw.Write(p)
+}
+
+// Close flushes buffered data and closes the current file.
+func (f *exportFile) Close() error {
+	flushErr := f.bw.Flush()
+	var closeErr error
+	if f.split != nil {
+		closeErr = f.split.Close()
+	} else {
+		closeErr = f.file.Close()
+	}
+	if flushErr != nil {
+		return flushErr
+	}
+	return closeErr
+}
+
+// Paths returns the files written, in order.
+func (f *exportFile) Paths() []string {
+	if f.split != nil {
+		return f.split.Paths()
+	}
+	return []string{f.file.Name()}
+}
+
+// remove deletes the files of a failed export.
+func (f *exportFile) remove() {
+	for _, path := range f.Paths() {
+		os.Remove(path) //nolint:errcheck
+	}
+}
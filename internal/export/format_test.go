@@ -0,0 +1,35 @@
+package export
+
+import (
+	"testing"
+)
+
+func TestFormatFromPath(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]Format{
+		"C:/Handover/docs.zip":    FormatZip,
+		"C:/Handover/docs.TAR":    FormatTar,
+		"C:/Handover/docs.tar.gz": FormatTarGz,
+		"docs.tgz":                FormatTarGz,
+	}
+	for path, want := range cases {
+		got, err := FormatFromPath(path)
+		if err != nil || got != want {
+			t.Fatalf("FormatFromPath(%q) = %q, %v; want %q", path, got, err, want)
+		}
+	}
+	for _, path := range []string{"", "docs.7z", "docs.gz"} {
+		if _, err := FormatFromPath(path); err == nil {
+			t.Fatalf("expected error for %q, got nil", path)
+		}
+	}
+}
+
+func TestVolumeName(t *testing.T) {
+	t.Parallel()
+
+	if got := VolumeName("C:/Handover/docs.zip", 2); got != "C:/Handover/docs.zip.002" {
+		t.Fatalf("unexpected volume name %q", got)
+	}
+}
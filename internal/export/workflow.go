@@ -0,0 +1,560 @@
+// Package export writes backup sets to standard archives for recipients without RestoreSafe:
+//  1. Let the user choose which backup(s) to export
+//  2. Optionally filter entries by path or pattern, choose the export file and volume size
+//  3. Check the parts and the free space at the export location
+//  4. Verify password (up to 3 attempts)
+//  5. Decrypt the parts and write the matching entries to a .tar, .tar.gz or .zip archive,
+//     one directory per backup set, optionally split into volumes
+package export
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/repository"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// readLineFn is the line reader used by the export prompts; tests replace it.
+var readLineFn = security.ReadLine
+
+// Options holds export choices passed as arguments instead of being entered at the prompts.
+type Options struct {
+	// Backup selects the backup(s) to export: a dot (.), a backup ID or a full backup name.
+	Backup string
+	// Include limits the export to matching entries; empty exports everything.
+	Include []string
+	// Output is the export file; its extension selects the format.
+	Output string
+	// VolumeSizeMB splits the export into volumes of this size; 0 writes a single file.
+	VolumeSizeMB int
+}
+
+// settings are the resolved filter and output choices of one export run.
+type settings struct {
+	selector    *util.PathSelector
+	format      Format
+	output      string
+	volumeBytes int64
+}
+
+// Run exports selected backup sets.
+func Run(cfg *util.Config, exeDir string) error {
+	return run(cfg, exeDir, nil)
+}
+
+// RunWithOptions exports the backup sets selected by opts.
+// The confirmation and password are still prompted.
+func RunWithOptions(cfg *util.Config, exeDir string, opts Options) error {
+	return run(cfg, exeDir, &opts)
+}
+
+func run(cfg *util.Config, exeDir string, opts *Options) error {
+	backupDir := util.ResolveDir(cfg.BackupDirectory, exeDir)
+
+	index, err := catalog.ScanBackups(backupDir)
+	if err != nil {
+		return fmt.Errorf("Failed to scan backup directory %q: %w. Remedy: Check the backup_directory path in config.yaml and ensure the directory is readable.", backupDir, err)
+	}
+	if len(index) == 0 {
+		fmt.Println("No backups found in backup directory. Remedy: Check whether .enc files are in the backup directory and whether the correct directory is selected.")
+		return nil
+	}
+
+	selected, _, err := resolveExportSelection(backupDir, index, opts)
+	if err != nil {
+		if errors.Is(err, operation.ErrSelectionCancelled) {
+			fmt.Println("Export cancelled.")
+			return nil
+		}
+		return err
+	}
+
+	s, err := resolveExportSettings(opts)
+	if err != nil {
+		if errors.Is(err, operation.ErrSelectionCancelled) {
+			fmt.Println("Export cancelled.")
+			return nil
+		}
+		return err
+	}
+
+	lock, err := util.AcquireBackupLock(backupDir)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	requiresYubiKey, yubiKeyOnly, err := catalog.BackupRunUsesYubiKey(backupDir, selected[0])
+	if err != nil {
+		return fmt.Errorf("Failed to inspect backup authentication: %w. Remedy: Check read permissions in the backup directory and existing .challenge files.", err)
+	}
+
+	logPath := util.LogFileName(backupDir, selected[0].Date, selected[0].ID)
+	log := operation.OpenLogger(cfg, backupDir, selected[0])
+	warningCount := 0
+	if log.IsConsoleOnly() {
+		warningCount++
+	}
+	defer log.Close()
+
+	preflight := buildExportPreflight(selected, backupDir)
+	printExportPreflightWithYubiKeyCheck(os.Stdout, cfg, backupDir, preflight, s, requiresYubiKey, yubiKeyOnly, security.CheckYubiKeyConnected)
+	if err := validateExportPreflight(preflight, s); err != nil {
+		return err
+	}
+
+	confirmed, err := operation.PromptStartAction("export")
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		log.InfoLogOnly("Export cancelled by user before start")
+		fmt.Println("Export cancelled.")
+		return nil
+	}
+
+	password, err := operation.ReadPasswordWithRetry(backupDir, selected[0], "Enter export password: ", log)
+	if err != nil {
+		return err
+	}
+	defer func() { security.ZeroBytes(password) }()
+
+	log.Info("Export started - ID: %s, date: %s, export file: %s", string(selected[0].ID), selected[0].Date, filepath.ToSlash(s.output))
+	if !s.selector.IsEmpty() {
+		log.Info("Filter: %s", strings.Join(s.selector.Patterns(), "; "))
+	}
+
+	paths, err := exportSelectedEntries(selected, backupDir, password, log, s)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Export completed successfully: %d file(s) written.", len(paths))
+	for _, path := range paths {
+		fmt.Printf("Export written to: %s\n", filepath.ToSlash(path))
+	}
+	fmt.Printf("\nLog file: %s\n", logPath)
+	if warningCount > 0 {
+		fmt.Printf("Warnings: %d\n", warningCount)
+	}
+	return nil
+}
+
+func resolveExportSelection(backupDir string, index []util.BackupEntry, opts *Options) ([]util.BackupEntry, string, error) {
+	if opts != nil {
+		return operation.ResolveBackupSelection(backupDir, index, opts.Backup)
+	}
+	return operation.PromptBackupSelection("export", backupDir, index)
+}
+
+func resolveExportSettings(opts *Options) (settings, error) {
+	var patterns []string
+	output := ""
+	volumeSizeMB := 0
+	if opts == nil {
+		var err error
+		if patterns, err = promptExportFilter(); err != nil {
+			return settings{}, err
+		}
+		if output, err = promptExportFile(); err != nil {
+			return settings{}, err
+		}
+		if volumeSizeMB, err = promptVolumeSize(); err != nil {
+			return settings{}, err
+		}
+	} else {
+		patterns = opts.Include
+		output = strings.TrimSpace(opts.Output)
+		volumeSizeMB = opts.VolumeSizeMB
+	}
+
+	selector, err := util.NewPathSelector(patterns)
+	if err != nil {
+		return settings{}, err
+	}
+	format, err := FormatFromPath(output)
+	if err != nil {
+		return settings{}, err
+	}
+	if volumeSizeMB < 0 {
+		return settings{}, fmt.Errorf("Invalid volume size %d MB. Remedy: Pass a size greater than 0, or 0 to write a single file.", volumeSizeMB)
+	}
+	return settings{selector: selector, format: format, output: filepath.Clean(output), volumeBytes: int64(volumeSizeMB) * 1024 * 1024}, nil
+}
+
+func promptExportFilter() ([]string, error) {
+	for {
+		fmt.Printf("Filter entries:\n")
+		fmt.Printf("  - Press Enter → export all entries\n")
+		fmt.Printf("  - Enter path(s) or pattern(s) relative to the backed-up directory, separated by ; (e.g. Reports/2025;**/*.xlsx) → export only matching entries\n")
+		fmt.Printf("  - Enter q → cancel\n")
+		fmt.Println()
+
+		input, err := readLineFn("Filter: ")
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println()
+		input = strings.TrimSpace(input)
+
+		switch input {
+		case "":
+			return nil, nil
+		case "q":
+			return nil, operation.ErrSelectionCancelled
+		}
+
+		patterns := util.ParseSelectionPatterns(input)
+		if _, err := util.NewPathSelector(patterns); err != nil {
+			fmt.Printf("%v\n\n", err)
+			continue
+		}
+		return patterns, nil
+	}
+}
+
+func promptExportFile() (string, error) {
+	for {
+		input, err := readLineFn("Export file (.tar, .tar.gz, .tgz or .zip, e.g. C:/Handover/documents.zip; q = cancel): ")
+		if err != nil {
+			return "", err
+		}
+		fmt.Println()
+		input = strings.Trim(strings.TrimSpace(input), `"`)
+		if input == "q" {
+			return "", operation.ErrSelectionCancelled
+		}
+		if _, err := FormatFromPath(input); err != nil {
+			fmt.Printf("%v\n\n", err)
+			continue
+		}
+		return input, nil
+	}
+}
+
+func promptVolumeSize() (int, error) {
+	for {
+		input, err := readLineFn("Split into volumes of how many MB? (Enter = single file): ")
+		if err != nil {
+			return 0, err
+		}
+		fmt.Println()
+		input = strings.TrimSpace(input)
+		if input == "" {
+			return 0, nil
+		}
+		size, err := strconv.Atoi(input)
+		if err != nil || size <= 0 {
+			fmt.Printf("Invalid volume size %q. Remedy: Enter a whole number of MB greater than 0, or press Enter for a single file.\n\n", input)
+			continue
+		}
+		return size, nil
+	}
+}
+
+type exportPreflightItem struct {
+	Entry          util.BackupEntry
+	PartCount      int
+	TotalSizeBytes int64
+	Err            error
+}
+
+func buildExportPreflight(selected []util.BackupEntry, backupDir string) []exportPreflightItem {
+	items := make([]exportPreflightItem, 0, len(selected))
+	for _, entry := range selected {
+		partCount, totalSizeBytes, err := catalog.InspectBackupParts(backupDir, entry)
+		if err == nil && partCount == 0 {
+			err = fmt.Errorf("No part files found. Remedy: Ensure all .enc parts of this backup are in the same backup directory.")
+		}
+		if err == nil {
+			// The archive of an incremental backup holds only the files changed since its parent.
+			chain, chainErr := catalog.ResolveChain(backupDir, entry)
+			switch {
+			case chainErr != nil:
+				err = chainErr
+			case len(chain) > 1:
+				err = fmt.Errorf("%s is an incremental backup. Remedy: Consolidate it first (menu option 6 or the consolidate command) and export the new full backup.", entry.String())
+			}
+		}
+		items = append(items, exportPreflightItem{
+			Entry:          entry,
+			PartCount:      partCount,
+			TotalSizeBytes: totalSizeBytes,
+			Err:            err,
+		})
+	}
+	return items
+}
+
+func printExportPreflightWithYubiKeyCheck(
+	w io.Writer,
+	cfg *util.Config,
+	backupDir string,
+	items []exportPreflightItem,
+	s settings,
+	requiresYubiKey, yubiKeyOnly bool,
+	checkYubiKeyConnected func() error,
+) {
+	var issues []string
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Export preflight")
+	fmt.Fprintln(w, "----------------")
+
+	// Backup selection
+	fmt.Fprintln(w, "Backup selection:")
+	fmt.Fprintf(w, "  Path: %s\n", filepath.ToSlash(backupDir))
+	for _, item := range items {
+		if item.Err != nil {
+			fmt.Fprintf(w, "  [ERROR] %s (parts: %d)\n", item.Entry.String(), item.PartCount)
+			issues = append(issues, item.Err.Error())
+		} else {
+			fmt.Fprintf(w, "  [OK] %s (parts: %d)\n", item.Entry.String(), item.PartCount)
+		}
+	}
+	estimatedBytes := estimateExportBytes(items)
+	if estimatedBytes > 0 {
+		fmt.Fprintf(w, "  Export size (at most): %s\n", util.FormatBytesBinary(uint64(estimatedBytes)))
+	}
+
+	// Filter and export file
+	filter := "none (all entries)"
+	if !s.selector.IsEmpty() {
+		filter = strings.Join(s.selector.Patterns(), "; ")
+	}
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Filter", filter)
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Format", string(s.format))
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Export file", filepath.ToSlash(s.output))
+	if s.volumeBytes > 0 {
+		operation.PrintField(w, operation.DefaultFieldLabelWidth, "Volumes", fmt.Sprintf("%s each (%s, ...)", util.FormatBytesBinary(uint64(s.volumeBytes)), filepath.Base(VolumeName(s.output, 1))))
+	}
+	if err := checkExportFile(s, estimatedBytes); err != nil {
+		issues = append(issues, err.Error())
+	}
+
+	// Authentication and Log level
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Authentication", operation.BackupAuthenticationLabel(requiresYubiKey, yubiKeyOnly))
+	operation.PrintYubiKeyPreflightStatus(w, requiresYubiKey, "export", checkYubiKeyConnected)
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Log level", strings.ToLower(cfg.LogLevel))
+
+	// Print collected issues
+	if len(issues) > 0 {
+		fmt.Fprintln(w)
+		for _, issue := range issues {
+			fmt.Fprintf(w, "[ERROR] %s\n", issue)
+		}
+	}
+}
+
+// estimateExportBytes returns the size of the selected archives. The decrypted archives
+// are about as large, and an export with a filter is smaller.
+func estimateExportBytes(items []exportPreflightItem) int64 {
+	var total int64
+	for _, item := range items {
+		if item.Err == nil {
+			total += item.TotalSizeBytes
+		}
+	}
+	return total
+}
+
+// checkExportFile fails when the export file or its first volume already exists, its
+// directory does not exist, or the directory has less free space than estimatedBytes.
+func checkExportFile(s settings, estimatedBytes int64) error {
+	first := s.output
+	if s.volumeBytes > 0 {
+		first = VolumeName(s.output, 1)
+	}
+	if _, err := os.Stat(first); err == nil {
+		return fmt.Errorf("Export file %s already exists. Remedy: Choose a different export file or delete the existing file.", filepath.ToSlash(first))
+	}
+	dir := filepath.Dir(s.output)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("Export directory %s does not exist. Remedy: Create the directory or choose a different export file.", filepath.ToSlash(dir))
+	}
+	freeBytes, err := util.QueryFreeSpaceBytes(dir)
+	if err == nil && util.IsSpaceInsufficient(estimatedBytes, freeBytes) {
+		return errors.New(util.FormatInsufficientExportSpaceMessage(uint64(estimatedBytes), freeBytes))
+	}
+	return nil
+}
+
+func validateExportPreflight(items []exportPreflightItem, s settings) error {
+	if err := operation.ValidatePreflightItems(
+		items,
+		func(item exportPreflightItem) bool { return item.Err != nil },
+		"Export preflight failed: %d selected item(s) are incomplete or invalid. Remedy: Fix the [ERROR] entries above and start the export again.",
+	); err != nil {
+		return err
+	}
+	if err := checkExportFile(s, estimateExportBytes(items)); err != nil {
+		fmt.Println()
+		fmt.Printf("[ERROR] %v\n", err)
+		return fmt.Errorf("Export preflight failed: %w", err)
+	}
+	return nil
+}
+
+// exportStats counts the entries written for one backup set.
+type exportStats struct {
+	Files       int
+	Directories int
+	Bytes       int64
+	Verified    int
+}
+
+// exportSelectedEntries writes the matching entries of every selected backup set to
+// the export file and returns the paths written. A failed export is removed.
+func exportSelectedEntries(selected []util.BackupEntry, backupDir string, password []byte, log *util.Logger, s settings) ([]string, error) {
+	out, err := createExportFile(s.output, s.volumeBytes)
+	if err != nil {
+		return nil, err
+	}
+	archive := newArchiveWriter(out, s.format)
+	fail := func(err error) ([]string, error) {
+		out.Close() //nolint:errcheck
+		out.remove()
+		return nil, err
+	}
+
+	for _, entry := range selected {
+		log.Info("Processing backup directory: %s", entry.DirectoryName)
+		stats, err := exportEntry(archive, entry, backupDir, password, log, s.selector)
+		if err != nil {
+			return fail(fmt.Errorf("Failed to export %q: %w", entry.String(), err))
+		}
+		log.Info("  Exported: %d file(s), %d directories, %s", stats.Files, stats.Directories, util.FormatBytesBinary(uint64(stats.Bytes)))
+		if stats.Verified > 0 {
+			log.Info("  Integrity: %d file(s) match the hashes in the manifest", stats.Verified)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return fail(fmt.Errorf("Failed to finish export file %q: %w", s.output, err))
+	}
+	if err := out.Close(); err != nil {
+		return fail(fmt.Errorf("Failed to close export file %q: %w", s.output, err))
+	}
+	return out.Paths(), nil
+}
+
+// exportEntry adds the entries of one backup set matching selector to archive. They are
+// placed in a directory named after the backup set, except for the backup of a single
+// file or a stream, whose only entry already carries that name. Files are checked
+// against the hashes in the manifest if the backup has one.
+func exportEntry(archive archiveWriter, entry util.BackupEntry, backupDir string, password []byte, log *util.Logger, selector *util.PathSelector) (exportStats, error) {
+	var stats exportStats
+	parts, err := catalog.CollectParts(backupDir, entry)
+	if err != nil {
+		return stats, err
+	}
+	snapshot := len(parts) == 0 && catalog.IsSnapshot(backupDir, entry)
+	if len(parts) == 0 && !snapshot {
+		return stats, fmt.Errorf("No part files found for %s. Remedy: Put all related .enc files into the same backup directory.", entry.String())
+	}
+	entries, hasManifest, err := manifest.LoadForBackup(backupDir, entry, password)
+	if err != nil {
+		if snapshot {
+			return stats, fmt.Errorf("Snapshot of %s could not be read: %w", entry.String(), err)
+		}
+		log.Warn("Manifest of %s could not be read, exporting without per-file integrity checks: %v", entry.String(), err)
+	}
+	index := manifest.NewIndex(entries)
+
+	prefix := entry.DirectoryName + "/"
+	info, err := catalog.ReadRunInfo(backupDir, entry)
+	if err == nil && (info.IsFile() || info.IsStream()) {
+		prefix = ""
+	}
+
+	add := func(hdr *tar.Header, body io.Reader) error {
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if !selector.Match(name) {
+			return nil
+		}
+		out := *hdr
+		out.Name = prefix + hdr.Name
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			stats.Directories++
+			return archive.WriteEntry(&out, nil)
+		case tar.TypeReg:
+		default:
+			log.Warn("  Skipped %s: only directories and regular files are exported", hdr.Name)
+			return nil
+		}
+
+		sum := sha256.New()
+		var size atomic.Int64
+		if err := archive.WriteEntry(&out, io.TeeReader(&operation.CountingReader{R: body, Total: &size}, sum)); err != nil {
+			return err
+		}
+		if size.Load() != hdr.Size {
+			return fmt.Errorf("Integrity check failed: %s has %d byte(s) instead of %d. Remedy: Run verify for this backup and export from an intact copy of the backup directory.", name, size.Load(), hdr.Size)
+		}
+		if want, ok := index.ExpectedSHA256(name); ok {
+			if !bytes.Equal(sum.Sum(nil), want) {
+				return fmt.Errorf("Integrity check failed: %s does not match the hash in the manifest. Remedy: Run verify for this backup and export from an intact copy of the backup directory.", name)
+			}
+			stats.Verified++
+		}
+		stats.Files++
+		stats.Bytes += hdr.Size
+		return nil
+	}
+
+	switch {
+	case info.IsStream():
+		file, err := streamEntry(entry, entries, hasManifest)
+		if err != nil {
+			return stats, err
+		}
+		if !selector.Match(file.Path) {
+			return stats, nil
+		}
+		err = operation.RunDecryptPipeline(parts, password, log, entry.DirectoryName, "decrypted", "Export", func(r io.Reader) error {
+			if err := add(file.Header(), r); err != nil {
+				return err
+			}
+			if extra, err := io.Copy(io.Discard, r); err != nil || extra > 0 {
+				return fmt.Errorf("Integrity check failed: stream of %s is longer than recorded in the manifest. Remedy: Run verify for this backup and export from an intact copy of the backup directory.", entry.String())
+			}
+			return nil
+		}, nil)
+		return stats, err
+	case snapshot:
+		repo, err := repository.Open(backupDir, password)
+		if err != nil {
+			return stats, fmt.Errorf("Failed to open repository: %w", err)
+		}
+		defer repo.Close()
+		err = repo.StreamTar(entries, func(r io.Reader) error {
+			return util.WalkTar(r, add)
+		})
+		return stats, err
+	}
+	err = operation.RunDecryptPipeline(parts, password, log, entry.DirectoryName, "decrypted", "Export", func(r io.Reader) error {
+		return util.WalkTar(r, add)
+	}, nil)
+	return stats, err
+}
+
+// streamEntry returns the single manifest entry describing the stream of a stream backup.
+func streamEntry(entry util.BackupEntry, entries []manifest.Entry, hasManifest bool) (manifest.Entry, error) {
+	if !hasManifest || len(entries) != 1 || entries[0].Type != "file" {
+		return manifest.Entry{}, fmt.Errorf("Manifest of stream backup %s is missing or invalid. Remedy: Restore the .manifest.enc file from a copy of the backup directory; a stream backup cannot be exported without it.", entry.String())
+	}
+	return entries[0], nil
+}
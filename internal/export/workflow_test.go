@@ -0,0 +1,185 @@
+package export
+
+import (
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportSelectedEntriesWritesFilteredZip(t *testing.T) {
+	t.Parallel()
+
+	fx := testutil.NewBackupFixture(t, []byte("export-password"))
+	selector, err := util.NewPathSelector([]string{"**/small.txt"})
+	if err != nil {
+		t.Fatalf("NewPathSelector failed: %v", err)
+	}
+	output := filepath.Join(t.TempDir(), "handover.zip")
+	s := settings{selector: selector, format: FormatZip, output: output}
+
+	paths, err := exportSelectedEntries([]util.BackupEntry{fx.Entry}, fx.BackupDir, fx.Password, nil, s)
+	if err != nil {
+		t.Fatalf("exportSelectedEntries failed: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != output {
+		t.Fatalf("expected a single export file, got %v", paths)
+	}
+
+	zr, err := zip.OpenReader(output)
+	if err != nil {
+		t.Fatalf("export is not a valid zip file: %v", err)
+	}
+	defer zr.Close()
+	if len(zr.File) != 1 || zr.File[0].Name != fx.Entry.DirectoryName+"/nested/small.txt" {
+		t.Fatalf("expected only the selected file below the backup name, got %d entries", len(zr.File))
+	}
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatalf("failed to open zip entry: %v", err)
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	if err != nil || string(content) != "hello restoresafe" {
+		t.Fatalf("unexpected zip entry content %q, %v", content, err)
+	}
+}
+
+func TestExportSelectedEntriesSplitsTarIntoVolumes(t *testing.T) {
+	t.Parallel()
+
+	fx := testutil.NewBackupFixture(t, []byte("export-password"))
+	output := filepath.Join(t.TempDir(), "handover.tar")
+	s := settings{format: FormatTar, output: output, volumeBytes: 1024 * 1024}
+
+	paths, err := exportSelectedEntries([]util.BackupEntry{fx.Entry}, fx.BackupDir, fx.Password, nil, s)
+	if err != nil {
+		t.Fatalf("exportSelectedEntries failed: %v", err)
+	}
+	if len(paths) != 3 || paths[0] != VolumeName(output, 1) {
+		t.Fatalf("expected three 1 MB volumes, got %v", paths)
+	}
+
+	var joined bytes.Buffer
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read volume: %v", err)
+		}
+		joined.Write(data)
+	}
+	sizes := readTar(t, &joined)
+	if sizes[fx.Entry.DirectoryName+"/large.bin"] != 2*1024*1024+256 || sizes[fx.Entry.DirectoryName+"/nested/small.txt"] != int64(len("hello restoresafe")) {
+		t.Fatalf("unexpected entries in the joined volumes: %v", sizes)
+	}
+}
+
+func TestExportSelectedEntriesWritesStreamAsFile(t *testing.T) {
+	t.Parallel()
+
+	password := []byte("stream-password")
+	backupDir := t.TempDir()
+	entry := util.BackupEntry{DirectoryName: "crm.dump", Date: "2026-03-12", ID: util.BackupID("EXP001")}
+	testutil.CreateStreamBackup(t, backupDir, entry, []byte("dump content"), password)
+	output := filepath.Join(t.TempDir(), "crm.tar.gz")
+
+	if _, err := exportSelectedEntries([]util.BackupEntry{entry}, backupDir, password, nil, settings{format: FormatTarGz, output: output}); err != nil {
+		t.Fatalf("exportSelectedEntries failed: %v", err)
+	}
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatalf("failed to open export: %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("export is not gzip-compressed: %v", err)
+	}
+	if sizes := readTar(t, gz); len(sizes) != 1 || sizes["crm.dump"] != int64(len("dump content")) {
+		t.Fatalf("expected the stream as crm.dump at the archive root, got %v", sizes)
+	}
+}
+
+func TestExportSelectedEntriesRemovesFailedExport(t *testing.T) {
+	t.Parallel()
+
+	fx := testutil.NewBackupFixture(t, []byte("export-password"))
+	output := filepath.Join(t.TempDir(), "handover.zip")
+
+	_, err := exportSelectedEntries([]util.BackupEntry{fx.Entry}, fx.BackupDir, []byte("wrong-password"), nil, settings{format: FormatZip, output: output})
+	if err == nil {
+		t.Fatal("expected error for a wrong password, got nil")
+	}
+	if _, statErr := os.Stat(output); !os.IsNotExist(statErr) {
+		t.Fatalf("expected the failed export to be removed, got %v", statErr)
+	}
+}
+
+func TestBuildExportPreflightRejectsIncrementalBackup(t *testing.T) {
+	t.Parallel()
+
+	password := []byte("export-password")
+	srcDir := t.TempDir()
+	backupDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("alpha"), 0o600); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+	full := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-12", ID: util.BackupID("FUL001")}
+	testutil.CreateChainBackup(t, srcDir, backupDir, full, nil, password)
+	inc := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-13", ID: util.BackupID("INC001")}
+	testutil.CreateChainBackup(t, srcDir, backupDir, inc, &full, password)
+
+	items := buildExportPreflight([]util.BackupEntry{full, inc}, backupDir)
+	if items[0].Err != nil {
+		t.Fatalf("expected the full backup to be exportable, got %v", items[0].Err)
+	}
+	if items[1].Err == nil || !strings.Contains(items[1].Err.Error(), "Consolidate") {
+		t.Fatalf("expected the incremental backup to be rejected, got %v", items[1].Err)
+	}
+}
+
+func TestCheckExportFileRejectsExistingFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "handover.zip")
+	if err := checkExportFile(settings{output: output}, 0); err != nil {
+		t.Fatalf("expected a new export file to be accepted, got %v", err)
+	}
+	if err := os.WriteFile(VolumeName(output, 1), nil, 0o600); err != nil {
+		t.Fatalf("failed to write volume: %v", err)
+	}
+	if err := checkExportFile(settings{output: output, volumeBytes: 1024 * 1024}, 0); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected an existing first volume to be rejected, got %v", err)
+	}
+	if err := checkExportFile(settings{output: filepath.Join(dir, "missing", "handover.zip")}, 0); err == nil {
+		t.Fatal("expected a missing export directory to be rejected, got nil")
+	}
+}
+
+// readTar returns the sizes of the regular files in the TAR stream r.
+func readTar(t *testing.T, r io.Reader) map[string]int64 {
+	t.Helper()
+
+	sizes := map[string]int64{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return sizes
+		}
+		if err != nil {
+			t.Fatalf("export is not a valid TAR archive: %v", err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			sizes[hdr.Name] = hdr.Size
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package importer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Format is the format of an archive to import. It follows from the file extension.
+type Format string
+
+const (
+	FormatTar   Format = "tar"
+	FormatTarGz Format = "tar.gz"
+	FormatZip   Format = "zip"
+)
+
+// FormatFromPath returns the Format for the extension of path: .tar, .tar.gz, .tgz or .zip.
+func FormatFromPath(archivePath string) (Format, error) {
+	lower := strings.ToLower(strings.TrimSpace(archivePath))
+	switch {
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return FormatTarGz, nil
+	case strings.HasSuffix(lower, ".tar"):
+		return FormatTar, nil
+	case strings.HasSuffix(lower, ".zip"):
+		return FormatZip, nil
+	}
+	return "", fmt.Errorf("Unsupported archive %q. Remedy: Import a .tar, .tar.gz, .tgz or .zip file.", filepath.Base(archivePath))
+}
+
+// walkArchive calls fn for every directory and regular file of the archive at
+// archivePath, in archive order, with a TAR header holding its normalised path, type,
+// size, permissions and modification time. Zip entries are converted on the fly.
+// Other entry types, such as links, are passed to skip instead.
+func walkArchive(archivePath string, format Format, fn func(hdr *tar.Header, body io.Reader) error, skip func(name string)) error {
+	if format == FormatZip {
+		return walkZip(archivePath, fn, skip)
+	}
+
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("Failed to open archive %q: %w. Remedy: Check the archive path and read permissions.", archivePath, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if format == FormatTarGz {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("Failed to read %q as gzip: %w. Remedy: Check that the file is a complete .tar.gz archive.", archivePath, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		src, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to read archive %q: %w. Remedy: Check that the file is a complete TAR archive.", archivePath, err)
+		}
+		var typeflag byte
+		switch src.Typeflag {
+		case tar.TypeDir:
+			typeflag = tar.TypeDir
+		case tar.TypeReg, tar.TypeRegA: //nolint:staticcheck // legacy archives use TypeRegA
+			typeflag = tar.TypeReg
+		default:
+			skip(src.Name)
+			continue
+		}
+		hdr, ok, err := normalizedHeader(src.Name, typeflag, src.Size, src.FileInfo().Mode().Perm(), src.ModTime)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func walkZip(archivePath string, fn func(hdr *tar.Header, body io.Reader) error, skip func(name string)) error {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("Failed to open zip archive %q: %w. Remedy: Check that the file is a complete .zip archive.", archivePath, err)
+	}
+	defer zr.Close()
+
+	for _, file := range zr.File {
+		mode := file.Mode()
+		var typeflag byte
+		switch {
+		case mode.IsDir():
+			typeflag = tar.TypeDir
+		case mode.IsRegular():
+			typeflag = tar.TypeReg
+		default:
+			skip(file.Name)
+			continue
+		}
+		hdr, ok, err := normalizedHeader(file.Name, typeflag, int64(file.UncompressedSize64), mode.Perm(), file.Modified)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		if typeflag == tar.TypeDir {
+			err = fn(hdr, nil)
+		} else {
+			err = walkZipFile(file, hdr, fn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkZipFile(file *zip.File, hdr *tar.Header, fn func(hdr *tar.Header, body io.Reader) error) error {
+	rc, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("Failed to read %q from zip archive: %w. Remedy: Check that the archive is not damaged or encrypted.", file.Name, err)
+	}
+	defer rc.Close()
+	return fn(hdr, rc)
+}
+
+// normalizedHeader builds the header an archive entry is imported with. Paths use
+// forward slashes and are relative; ok is false for the archive root itself.
+func normalizedHeader(name string, typeflag byte, size int64, perm os.FileMode, modTime time.Time) (*tar.Header, bool, error) {
+	clean := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if clean == "." || clean == "/" {
+		return nil, false, nil
+	}
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") || strings.Contains(clean, ":") {
+		return nil, false, fmt.Errorf("Archive entry %q has an absolute or parent-relative path. Remedy: Repack the archive with relative paths before importing it.", name)
+	}
+	if perm == 0 {
+		perm = 0o644
+		if typeflag == tar.TypeDir {
+			perm = 0o755
+		}
+	}
+	hdr := &tar.Header{
+		Typeflag: typeflag,
+		Name:     clean,
+		Mode:     int64(perm),
+		ModTime:  modTime,
+	}
+	if typeflag == tar.TypeDir {
+		hdr.Name += "/"
+	} else {
+		hdr.Size = size
+	}
+	return hdr, true, nil
+}
+
+// archiveSummary describes the entries of an archive to import.
+type archiveSummary struct {
+	Files       int
+	Directories int
+	Skipped     int
+	Bytes       int64
+	// Newest is the latest modification time of an entry; zero for an empty archive.
+	Newest time.Time
+}
+
+// scanArchive reads the headers of the archive at archivePath.
+func scanArchive(archivePath string, format Format) (archiveSummary, error) {
+	var s archiveSummary
+	err := walkArchive(archivePath, format, func(hdr *tar.Header, _ io.Reader) error {
+		if hdr.Typeflag == tar.TypeDir {
+			s.Directories++
+		} else {
+			s.Files++
+			s.Bytes += hdr.Size
+		}
+		if hdr.ModTime.After(s.Newest) {
+			s.Newest = hdr.ModTime
+		}
+		return nil
+	}, func(string) { s.Skipped++ })
+	return s, err
+}
@@ -0,0 +1,134 @@
+package importer
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var legacyTime = time.Date(2019, 12, 30, 10, 0, 0, 0, time.UTC)
+
+// writeLegacyTarGz writes a .tar.gz with a directory, two files and a symlink.
+func writeLegacyTarGz(t *testing.T, path string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	entries := []struct {
+		hdr  tar.Header
+		body string
+	}{
+		{hdr: tar.Header{Typeflag: tar.TypeDir, Name: "./invoices/", Mode: 0o755, ModTime: legacyTime}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "./invoices/2019-001.txt", Mode: 0o644, ModTime: legacyTime}, body: "invoice one"},
+		{hdr: tar.Header{Typeflag: tar.TypeSymlink, Name: "./latest", Linkname: "invoices/2019-001.txt", ModTime: legacyTime}},
+		{hdr: tar.Header{Typeflag: tar.TypeReg, Name: "./readme.txt", Mode: 0o600, ModTime: legacyTime.Add(-24 * time.Hour)}, body: "legacy archive"},
+	}
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.body))
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatalf("failed to write header: %v", err)
+		}
+		if _, err := io.WriteString(tw, e.body); err != nil {
+			t.Fatalf("failed to write body: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %v", err)
+	}
+}
+
+// writeLegacyZip writes a .zip with an implicit directory and two files.
+func writeLegacyZip(t *testing.T, path string) {
+	t.Helper()
+
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, body := range map[string]string{"invoices\\2019-001.txt": "invoice one", "readme.txt": "legacy archive"} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: legacyTime})
+		if err != nil {
+			t.Fatalf("failed to add zip entry: %v", err)
+		}
+		if _, err := io.WriteString(w, body); err != nil {
+			t.Fatalf("failed to write zip entry: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip writer: %v", err)
+	}
+}
+
+func TestScanArchiveSummarisesTarGz(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "legacy.tar.gz")
+	writeLegacyTarGz(t, path)
+
+	summary, err := scanArchive(path, FormatTarGz)
+	if err != nil {
+		t.Fatalf("scanArchive failed: %v", err)
+	}
+	if summary.Files != 2 || summary.Directories != 1 || summary.Skipped != 1 || summary.Bytes != int64(len("invoice one")+len("legacy archive")) {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	if !summary.Newest.Equal(legacyTime) {
+		t.Fatalf("expected newest time %v, got %v", legacyTime, summary.Newest)
+	}
+}
+
+func TestWalkArchiveConvertsZipEntries(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "legacy.zip")
+	writeLegacyZip(t, path)
+
+	contents := map[string]string{}
+	err := walkArchive(path, FormatZip, func(hdr *tar.Header, body io.Reader) error {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		if int64(len(data)) != hdr.Size || hdr.Typeflag != tar.TypeReg {
+			t.Fatalf("unexpected header for %s: %+v", hdr.Name, hdr)
+		}
+		contents[hdr.Name] = string(data)
+		return nil
+	}, func(name string) { t.Fatalf("unexpected skipped entry %s", name) })
+	if err != nil {
+		t.Fatalf("walkArchive failed: %v", err)
+	}
+	if contents["invoices/2019-001.txt"] != "invoice one" || contents["readme.txt"] != "legacy archive" {
+		t.Fatalf("unexpected converted entries: %v", contents)
+	}
+}
+
+func TestNormalizedHeaderRejectsUnsafePaths(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"../etc/passwd", "/etc/passwd", "C:/Windows/win.ini", "a/../../b"} {
+		if _, _, err := normalizedHeader(name, tar.TypeReg, 0, 0o644, legacyTime); err == nil || !strings.Contains(err.Error(), "relative paths") {
+			t.Fatalf("expected %q to be rejected, got %v", name, err)
+		}
+	}
+	if _, ok, err := normalizedHeader("./", tar.TypeDir, 0, 0, legacyTime); ok || err != nil {
+		t.Fatalf("expected the archive root to be left out, got ok=%v err=%v", ok, err)
+	}
+}
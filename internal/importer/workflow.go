@@ -0,0 +1,449 @@
+// Package importer brings existing archives under RestoreSafe's encryption and retention:
+//  1. Let the user choose the archive (.tar, .tar.gz, .tgz or .zip), the backup name and the date
+//  2. Read the archive headers and check the free space in the backup directory
+//  3. Prompt for password (and optionally YubiKey 2FA)
+//  4. Stream the archive, converting zip entries to TAR on the fly, → encrypt → split-writer,
+//     with a manifest like every backup run
+package importer
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// readLineFn is the line reader used by the import prompts; tests replace it.
+var readLineFn = security.ReadLine
+
+// Options holds import choices passed as arguments instead of being entered at the prompts.
+type Options struct {
+	// Archive is the .tar, .tar.gz, .tgz or .zip file to import.
+	Archive string
+	// Name is the backup name of the imported set, used like the name of a source directory.
+	Name string
+	// Date is the backup date (YYYY-MM-DD); empty takes the newest modification time in the archive.
+	Date string
+}
+
+// settings are the resolved choices of one import run.
+type settings struct {
+	archive string
+	format  Format
+	name    string
+	date    string
+}
+
+// Run imports an archive as a new backup set.
+func Run(cfg *util.Config, exeDir string) error {
+	return run(cfg, exeDir, nil)
+}
+
+// RunWithOptions imports the archive selected by opts.
+// The confirmation and password are still prompted.
+func RunWithOptions(cfg *util.Config, exeDir string, opts Options) error {
+	return run(cfg, exeDir, &opts)
+}
+
+func run(cfg *util.Config, exeDir string, opts *Options) error {
+	backupDir := util.ResolveDir(cfg.BackupDirectory, exeDir)
+	if err := util.StorageFor(backupDir).MkdirAll(backupDir); err != nil {
+		return fmt.Errorf("Failed to create backup directory: %w. Remedy: Check the path (prefer forward slashes in config.yaml, e.g. C:/Backups) and verify write permissions.", err)
+	}
+
+	s, err := resolveImportSettings(opts)
+	if err != nil {
+		if errors.Is(err, operation.ErrSelectionCancelled) {
+			fmt.Println("Import cancelled.")
+			return nil
+		}
+		return err
+	}
+
+	lock, err := util.AcquireBackupLock(backupDir)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	summary, err := scanArchive(s.archive, s.format)
+	if err != nil {
+		return err
+	}
+	if s.date == "" {
+		s.date = archiveDate(summary)
+	}
+
+	id, err := util.NewBackupID()
+	if err != nil {
+		return err
+	}
+	target := util.BackupEntry{DirectoryName: s.name, Date: s.date, ID: id}
+
+	logPath := util.LogFileName(backupDir, target.Date, target.ID)
+	log, err := util.NewLogger(logPath, cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	existing, err := countExistingSets(backupDir, s.name)
+	if err != nil {
+		return err
+	}
+	printImportPreflightWithYubiKeyCheck(os.Stdout, cfg, backupDir, s, target, summary, existing, security.CheckYubiKeyConnected)
+	if err := validateImportSpace(backupDir, summary); err != nil {
+		fmt.Println()
+		fmt.Printf("[ERROR] %s\n", strings.TrimPrefix(err.Error(), "Import preflight failed: "))
+		return err
+	}
+
+	confirmed, err := operation.PromptStartAction("import")
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		log.InfoLogOnly("Import cancelled by user before start")
+		fmt.Println("Import cancelled.")
+		return nil
+	}
+
+	var password []byte
+	if cfg.IsYubiKeyOnly() {
+		fmt.Println("YubiKey-only mode: no password required.")
+		password = []byte{}
+	} else if password, err = security.ReadPasswordConfirmedWithPrompts("Enter backup password: ", "Re-enter backup password: "); err != nil {
+		return err
+	}
+	defer func() { security.ZeroBytes(password) }()
+
+	var challengeHex string
+	if cfg.UseYubiKey() {
+		if err := security.CheckYubiKeyConnected(); err != nil {
+			return security.ErrYubiKeyRequired
+		}
+		fmt.Println("YubiKey connected. Please touch the YubiKey button.")
+		rawPassword := password
+		password, challengeHex, err = security.CombineWithPassword(rawPassword)
+		security.ZeroBytes(rawPassword)
+		if err != nil {
+			return fmt.Errorf("YubiKey authentication failed: %w", err)
+		}
+	}
+
+	argon2Params := security.Argon2Params{
+		Time:     uint32(cfg.Argon2.Time),
+		MemoryKB: uint32(cfg.Argon2.MemoryMB) * 1024,
+		Threads:  uint8(cfg.Argon2.Threads),
+	}
+
+	fmt.Println()
+	if err := catalog.MarkRunStarted(backupDir, target.Date, target.ID); err != nil {
+		return err
+	}
+	log.Info("Import started - ID: %s, date: %s, archive: %s as %s", string(id), target.Date, filepath.ToSlash(s.archive), s.name)
+	partCount, err := importArchive(s.archive, s.format, target, backupDir, password, argon2Params, cfg.SplitSizeMB, log)
+	if err != nil {
+		return fmt.Errorf("Failed to import %q: %w", s.archive, err)
+	}
+
+	if challengeHex != "" {
+		challengeContent := challengeHex
+		if cfg.IsYubiKeyOnly() {
+			challengeContent = "NOPW:" + challengeHex
+		}
+		if err := util.WriteStorageFile(util.ChallengeFileName(backupDir, target.DirectoryName, target.Date, target.ID), []byte(challengeContent)); err != nil {
+			return fmt.Errorf("Failed to write challenge file: %w. Remedy: Check write permissions in the backup directory; for YubiKey backups, the .challenge file must be in the same directory as the .enc files.", err)
+		}
+	}
+
+	if err := catalog.MarkRunComplete(backupDir, target.Date, target.ID); err != nil {
+		return err
+	}
+	log.Info("Import completed successfully: %s with %d part file(s).", target.String(), partCount)
+	fmt.Printf("\nLog file: %s\n", logPath)
+	return nil
+}
+
+func resolveImportSettings(opts *Options) (settings, error) {
+	var archive, name, date string
+	if opts == nil {
+		var err error
+		if archive, err = promptArchive(); err != nil {
+			return settings{}, err
+		}
+		if name, err = promptName(defaultName(archive)); err != nil {
+			return settings{}, err
+		}
+		if date, err = promptDate(); err != nil {
+			return settings{}, err
+		}
+	} else {
+		archive = strings.TrimSpace(opts.Archive)
+		name = opts.Name
+		if name == "" {
+			name = defaultName(archive)
+		}
+		date = strings.TrimSpace(opts.Date)
+	}
+
+	format, err := FormatFromPath(archive)
+	if err != nil {
+		return settings{}, err
+	}
+	if info, err := os.Stat(archive); err != nil || info.IsDir() {
+		return settings{}, fmt.Errorf("Archive %q not found. Remedy: Check the path of the archive to import.", archive)
+	}
+	if err := validateName(name); err != nil {
+		return settings{}, err
+	}
+	if err := validateDate(date); err != nil {
+		return settings{}, err
+	}
+	return settings{archive: filepath.Clean(archive), format: format, name: name, date: date}, nil
+}
+
+// defaultName derives the backup name from the archive file name without its extension.
+func defaultName(archive string) string {
+	base := filepath.Base(strings.TrimSpace(archive))
+	lower := strings.ToLower(base)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, ext) {
+			return base[:len(base)-len(ext)]
+		}
+	}
+	return base
+}
+
+func validateName(name string) error {
+	if strings.TrimSpace(name) != name || !util.IsValidStreamName(name) {
+		return fmt.Errorf("Invalid backup name %q. Remedy: Use a plain name without brackets, path separators or the characters : * ? \" < > |.", name)
+	}
+	return nil
+}
+
+func validateDate(date string) error {
+	if date == "" {
+		return nil
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return fmt.Errorf("Invalid backup date %q. Remedy: Use the form YYYY-MM-DD, e.g. 2019-12-31.", date)
+	}
+	return nil
+}
+
+// archiveDate returns the date of the newest entry of the archive, or today for an
+// archive without modification times.
+func archiveDate(summary archiveSummary) string {
+	if summary.Newest.IsZero() {
+		return util.DateString()
+	}
+	return summary.Newest.Local().Format("2006-01-02")
+}
+
+func promptArchive() (string, error) {
+	for {
+		input, err := readLineFn("Archive to import (.tar, .tar.gz, .tgz or .zip; q = cancel): ")
+		if err != nil {
+			return "", err
+		}
+		fmt.Println()
+		input = strings.Trim(strings.TrimSpace(input), `"`)
+		if input == "q" {
+			return "", operation.ErrSelectionCancelled
+		}
+		if _, err := FormatFromPath(input); err != nil {
+			fmt.Printf("%v\n\n", err)
+			continue
+		}
+		if info, err := os.Stat(input); err != nil || info.IsDir() {
+			fmt.Printf("Archive %q not found. Remedy: Check the path of the archive to import.\n\n", input)
+			continue
+		}
+		return input, nil
+	}
+}
+
+func promptName(defaultValue string) (string, error) {
+	for {
+		input, err := readLineFn(fmt.Sprintf("Backup name (Enter = %s): ", defaultValue))
+		if err != nil {
+			return "", err
+		}
+		fmt.Println()
+		name := strings.TrimSpace(input)
+		if name == "" {
+			name = defaultValue
+		}
+		if err := validateName(name); err != nil {
+			fmt.Printf("%v\n\n", err)
+			continue
+		}
+		return name, nil
+	}
+}
+
+func promptDate() (string, error) {
+	for {
+		input, err := readLineFn("Backup date YYYY-MM-DD (Enter = date of the newest file in the archive): ")
+		if err != nil {
+			return "", err
+		}
+		fmt.Println()
+		date := strings.TrimSpace(input)
+		if err := validateDate(date); err != nil {
+			fmt.Printf("%v\n\n", err)
+			continue
+		}
+		return date, nil
+	}
+}
+
+// countExistingSets returns the number of backup sets named name in backupDir.
+func countExistingSets(backupDir, name string) (int, error) {
+	index, err := catalog.ScanBackups(backupDir)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to scan backup directory %q: %w. Remedy: Check the backup_directory path in config.yaml and ensure the directory is readable.", backupDir, err)
+	}
+	count := 0
+	for _, entry := range index {
+		if strings.EqualFold(entry.DirectoryName, name) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func printImportPreflightWithYubiKeyCheck(
+	w io.Writer,
+	cfg *util.Config,
+	backupDir string,
+	s settings,
+	target util.BackupEntry,
+	summary archiveSummary,
+	existing int,
+	checkYubiKeyConnected func() error,
+) {
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Import preflight")
+	fmt.Fprintln(w, "----------------")
+
+	// Archive
+	fmt.Fprintln(w, "Archive:")
+	fmt.Fprintf(w, "  Path: %s (%s)\n", filepath.ToSlash(s.archive), s.format)
+	fmt.Fprintf(w, "  Entries: %d file(s), %d directories, %s\n", summary.Files, summary.Directories, util.FormatBytesBinary(uint64(summary.Bytes)))
+	if summary.Skipped > 0 {
+		fmt.Fprintf(w, "  [WARN] %d link(s) or special file(s) are not imported\n", summary.Skipped)
+	}
+
+	// Backup set
+	fmt.Fprintln(w, "Backup set:")
+	fmt.Fprintf(w, "  Path: %s\n", filepath.ToSlash(backupDir))
+	fmt.Fprintf(w, "  Name: %s\n", target.String())
+	if existing > 0 {
+		fmt.Fprintf(w, "  Existing sets named %s: %d (retention_keep: %d applies to all of them)\n", target.DirectoryName, existing, cfg.RetentionKeep)
+	}
+
+	// Authentication and Log level
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Authentication", operation.BackupAuthenticationLabel(cfg.UseYubiKey(), cfg.IsYubiKeyOnly()))
+	operation.PrintYubiKeyPreflightStatus(w, cfg.UseYubiKey(), "import", checkYubiKeyConnected)
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Split size", fmt.Sprintf("%d MB", cfg.SplitSizeMB))
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Log level", strings.ToLower(cfg.LogLevel))
+}
+
+// validateImportSpace fails when the backup directory has less free space than the
+// content of the archive, which the encrypted set needs at most.
+func validateImportSpace(backupDir string, summary archiveSummary) error {
+	freeBytes, err := util.StorageFor(backupDir).FreeSpace(backupDir)
+	if err != nil || !util.IsSpaceInsufficient(summary.Bytes, freeBytes) {
+		return nil
+	}
+	return fmt.Errorf("Import preflight failed: %s", util.FormatInsufficientBackupSpaceMessage(uint64(summary.Bytes), freeBytes))
+}
+
+// importArchive streams the archive at archivePath → TAR → encrypt → split-writer as
+// the backup set target and records every entry in its manifest. It returns the number
+// of parts written; a failed import leaves no parts behind.
+func importArchive(archivePath string, format Format, target util.BackupEntry, backupDir string, password []byte, params security.Argon2Params, splitSizeMB int64, log *util.Logger) (int, error) {
+	mw, err := manifest.Create(util.ManifestFileName(backupDir, target.DirectoryName, target.Date, target.ID), manifest.Header{Backup: target.String()}, password, params)
+	if err != nil {
+		return 0, err
+	}
+
+	sw := util.NewWriter(func(seq int) string {
+		return util.PartFileName(backupDir, target.DirectoryName, target.Date, target.ID, seq)
+	}, splitSizeMB*1024*1024)
+	sw.SetPartOpenedHook(func(seq int, path string) {
+		log.Info("  Part %03d: %s", seq, filepath.Base(path))
+	})
+	bw := bufio.NewWriterSize(sw, util.SplitWriteBufferSize)
+	pr, pw := io.Pipe()
+	encErrCh := make(chan error, 1)
+	go func() {
+		err := security.Encrypt(bw, pr, password, params)
+		pr.CloseWithError(err) //nolint:errcheck
+		encErrCh <- err
+	}()
+
+	var files int
+	var bytes int64
+	copier := util.NewTarCopier(pw)
+	convertErr := walkArchive(archivePath, format, func(hdr *tar.Header, body io.Reader) error {
+		copied, err := copier.Copy(hdr, body)
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			files++
+			bytes += hdr.Size
+		}
+		return mw.Add(manifest.EntryFromTar(copied))
+	}, func(name string) {
+		log.Warn("  Skipped %s: only directories and regular files are imported", name)
+	})
+	if convertErr == nil {
+		convertErr = copier.Close()
+	}
+	pw.CloseWithError(convertErr) //nolint:errcheck
+	encErr := <-encErrCh
+
+	err = convertErr
+	if err == nil {
+		err = encErr
+	}
+	if err == nil {
+		if flushErr := bw.Flush(); flushErr != nil {
+			err = fmt.Errorf("Flushing split buffer failed: %w", flushErr)
+		}
+	}
+	if closeErr := sw.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("Closing split-writer failed: %w", closeErr)
+	}
+	if err == nil {
+		err = mw.Close()
+	} else {
+		mw.Abort()
+	}
+	if err == nil {
+		err = catalog.WriteRunInfo(backupDir, target, catalog.RunInfo{Type: catalog.BackupTypeFull})
+	}
+	if err != nil {
+		for _, path := range sw.Paths() {
+			util.StorageFor(path).Remove(path) //nolint:errcheck
+		}
+		return 0, err
+	}
+
+	log.Info("  Imported: %d file(s), %s - [%s]", files, util.FormatBytesBinary(uint64(bytes)), target.DirectoryName)
+	return len(sw.Paths()), nil
+}
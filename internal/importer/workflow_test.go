@@ -0,0 +1,98 @@
+package importer
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+func TestImportArchiveCreatesRegularBackupSet(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		file   string
+		format Format
+		write  func(*testing.T, string)
+	}{
+		{file: "legacy.tar.gz", format: FormatTarGz, write: writeLegacyTarGz},
+		{file: "legacy.zip", format: FormatZip, write: writeLegacyZip},
+	} {
+		archive := filepath.Join(t.TempDir(), tc.file)
+		tc.write(t, archive)
+		backupDir := t.TempDir()
+		password := []byte("import-password")
+		target := util.BackupEntry{DirectoryName: "Invoices", Date: "2019-12-30", ID: util.BackupID("IMP001")}
+
+		partCount, err := importArchive(archive, tc.format, target, backupDir, password, security.DefaultArgon2Params, 1, nil)
+		if err != nil {
+			t.Fatalf("importArchive(%s) failed: %v", tc.file, err)
+		}
+		if partCount != 1 {
+			t.Fatalf("expected one part for %s, got %d", tc.file, partCount)
+		}
+
+		index, err := catalog.ScanBackups(backupDir)
+		if err != nil || len(index) != 1 || index[0] != target {
+			t.Fatalf("expected the imported set in the catalog, got %v, %v", index, err)
+		}
+		entries, ok, err := manifest.LoadForBackup(backupDir, target, password)
+		if err != nil || !ok {
+			t.Fatalf("expected a manifest for %s: ok=%v err=%v", tc.file, ok, err)
+		}
+		sums := manifest.NewIndex(entries)
+		if sums["readme.txt"].SHA256 == "" || sums["invoices/2019-001.txt"].Size != int64(len("invoice one")) {
+			t.Fatalf("unexpected manifest entries for %s: %+v", tc.file, entries)
+		}
+
+		parts, err := catalog.CollectParts(backupDir, target)
+		if err != nil {
+			t.Fatalf("CollectParts failed: %v", err)
+		}
+		contents := map[string]string{}
+		err = operation.RunDecryptPipeline(parts, password, nil, target.DirectoryName, "decrypted", "Test", func(r io.Reader) error {
+			return util.WalkTar(r, func(hdr *tar.Header, body io.Reader) error {
+				data, err := io.ReadAll(body)
+				contents[hdr.Name] = string(data)
+				return err
+			})
+		}, nil)
+		if err != nil {
+			t.Fatalf("failed to decrypt the imported set: %v", err)
+		}
+		if contents["invoices/2019-001.txt"] != "invoice one" || contents["readme.txt"] != "legacy archive" {
+			t.Fatalf("unexpected archive content for %s: %v", tc.file, contents)
+		}
+	}
+}
+
+func TestResolveImportSettingsDefaultsNameAndChecksDate(t *testing.T) {
+	t.Parallel()
+
+	archive := filepath.Join(t.TempDir(), "Invoices 2019.tar.gz")
+	writeLegacyTarGz(t, archive)
+
+	s, err := resolveImportSettings(&Options{Archive: archive})
+	if err != nil {
+		t.Fatalf("resolveImportSettings failed: %v", err)
+	}
+	if s.name != "Invoices 2019" || s.format != FormatTarGz || s.date != "" {
+		t.Fatalf("unexpected settings: %+v", s)
+	}
+
+	for _, opts := range []Options{
+		{Archive: archive, Date: "30.12.2019"},
+		{Archive: archive, Name: "a/b"},
+		{Archive: filepath.Join(t.TempDir(), "missing.zip")},
+		{Archive: archive + ".rar"},
+	} {
+		if _, err := resolveImportSettings(&opts); err == nil {
+			t.Fatalf("expected error for %+v, got nil", opts)
+		}
+	}
+}
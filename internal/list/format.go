@@ -0,0 +1,282 @@
+package list
+
+import (
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Format selects how a listing is written.
+type Format string
+
+const (
+	FormatTree  Format = "tree"
+	FormatTable Format = "table"
+	FormatJSON  Format = "json"
+	FormatCSV   Format = "csv"
+)
+
+// ParseFormat converts user input into a Format. An empty value selects FormatTree.
+func ParseFormat(value string) (Format, error) {
+	switch Format(strings.ToLower(strings.TrimSpace(value))) {
+	case "", FormatTree:
+		return FormatTree, nil
+	case FormatTable:
+		return FormatTable, nil
+	case FormatJSON:
+		return FormatJSON, nil
+	case FormatCSV:
+		return FormatCSV, nil
+	}
+	return "", fmt.Errorf("Unknown list format %q. Remedy: Use tree, table, json or csv.", value)
+}
+
+// Item describes one archive entry.
+type Item struct {
+	Path    string    `json:"path"`
+	Type    string    `json:"type"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Mode    string    `json:"mode"`
+}
+
+// Totals summarises the items of one or more listings.
+type Totals struct {
+	Files       int   `json:"files"`
+	Directories int   `json:"directories"`
+	Bytes       int64 `json:"bytes"`
+}
+
+// Listing holds the matching entries of one backup directory.
+type Listing struct {
+	Backup string `json:"backup"`
+	Items  []Item `json:"entries"`
+	Total  Totals `json:"total"`
+}
+
+func (t *Totals) add(item Item) {
+	switch item.Type {
+	case "dir":
+		t.Directories++
+	case "file":
+		t.Files++
+		t.Bytes += item.Size
+	}
+}
+
+func (t *Totals) merge(other Totals) {
+	t.Files += other.Files
+	t.Directories += other.Directories
+	t.Bytes += other.Bytes
+}
+
+func itemFromHeader(hdr *tar.Header) Item {
+	item := Item{
+		Path:    strings.TrimSuffix(hdr.Name, "/"),
+		ModTime: hdr.ModTime,
+		Mode:    hdr.FileInfo().Mode().String(),
+	}
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		item.Type = "dir"
+	case tar.TypeReg:
+		item.Type = "file"
+		item.Size = hdr.Size
+	case tar.TypeSymlink:
+		item.Type = "symlink"
+	default:
+		item.Type = "other"
+	}
+	return item
+}
+
+// Write renders listings to w in the given format.
+func Write(w io.Writer, format Format, listings []Listing) error {
+	switch format {
+	case FormatTree:
+		return writeTree(w, listings)
+	case FormatTable:
+		return writeTable(w, listings)
+	case FormatJSON:
+		return writeJSON(w, listings)
+	case FormatCSV:
+		return writeCSV(w, listings)
+	}
+	return fmt.Errorf("Unknown list format %q. Remedy: Use tree, table, json or csv.", format)
+}
+
+func grandTotal(listings []Listing) Totals {
+	var total Totals
+	for _, listing := range listings {
+		total.merge(listing.Total)
+	}
+	return total
+}
+
+func formatTotals(t Totals) string {
+	return fmt.Sprintf("Total: %d file(s), %d directory(s), %s", t.Files, t.Directories, util.FormatBytesBinary(uint64(t.Bytes)))
+}
+
+func formatModTime(ts time.Time) string {
+	return ts.Local().Format("2006-01-02 15:04:05")
+}
+
+type treeNode struct {
+	name     string
+	item     *Item
+	children map[string]*treeNode
+}
+
+func (n *treeNode) child(name string) *treeNode {
+	if n.children == nil {
+		n.children = make(map[string]*treeNode)
+	}
+	c, ok := n.children[name]
+	if !ok {
+		c = &treeNode{name: name}
+		n.children[name] = c
+	}
+	return c
+}
+
+func (n *treeNode) sortedChildren() []*treeNode {
+	children := make([]*treeNode, 0, len(n.children))
+	for _, c := range n.children {
+		children = append(children, c)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		li, lj := strings.ToLower(children[i].name), strings.ToLower(children[j].name)
+		if li != lj {
+			return li < lj
+		}
+		return children[i].name < children[j].name
+	})
+	return children
+}
+
+func (n *treeNode) isDir() bool {
+	return len(n.children) > 0 || (n.item != nil && n.item.Type == "dir")
+}
+
+func writeTree(w io.Writer, listings []Listing) error {
+	for i, listing := range listings {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		root := &treeNode{}
+		for j := range listing.Items {
+			item := &listing.Items[j]
+			node := root
+			for _, segment := range strings.Split(item.Path, "/") {
+				node = node.child(segment)
+			}
+			node.item = item
+		}
+
+		fmt.Fprintln(w, listing.Backup)
+		writeTreeChildren(w, root, "")
+		fmt.Fprintln(w, formatTotals(listing.Total))
+	}
+	if len(listings) > 1 {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Grand total (%d backup directories): %s\n", len(listings), strings.TrimPrefix(formatTotals(grandTotal(listings)), "Total: "))
+	}
+	return nil
+}
+
+func writeTreeChildren(w io.Writer, node *treeNode, prefix string) {
+	children := node.sortedChildren()
+	for i, c := range children {
+		branch, indent := "├── ", "│   "
+		if i == len(children)-1 {
+			branch, indent = "└── ", "    "
+		}
+		switch {
+		case c.isDir():
+			fmt.Fprintf(w, "%s%s%s/\n", prefix, branch, c.name)
+		case c.item != nil && c.item.Type == "file":
+			fmt.Fprintf(w, "%s%s%s  (%s, %s)\n", prefix, branch, c.name, util.FormatBytesBinary(uint64(c.item.Size)), formatModTime(c.item.ModTime))
+		default:
+			fmt.Fprintf(w, "%s%s%s\n", prefix, branch, c.name)
+		}
+		writeTreeChildren(w, c, prefix+indent)
+	}
+}
+
+func writeTable(w io.Writer, listings []Listing) error {
+	for i, listing := range listings {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Backup: %s\n", listing.Backup)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "MODE\tSIZE\tMODIFIED\tPATH")
+		for _, item := range listing.Items {
+			size := "-"
+			if item.Type == "file" {
+				size = util.FormatBytesBinary(uint64(item.Size))
+			}
+			name := item.Path
+			if item.Type == "dir" {
+				name += "/"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", item.Mode, size, formatModTime(item.ModTime), name)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintln(w, formatTotals(listing.Total))
+	}
+	if len(listings) > 1 {
+		fmt.Fprintln(w)
+		fmt.Fprintf(w, "Grand total (%d backup directories): %s\n", len(listings), strings.TrimPrefix(formatTotals(grandTotal(listings)), "Total: "))
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, listings []Listing) error {
+	doc := struct {
+		Backups []Listing `json:"backups"`
+		Total   Totals    `json:"total"`
+	}{Backups: listings, Total: grandTotal(listings)}
+	for i := range doc.Backups {
+		if doc.Backups[i].Items == nil {
+			doc.Backups[i].Items = []Item{}
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func writeCSV(w io.Writer, listings []Listing) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"backup", "path", "type", "size", "mtime", "mode"}); err != nil {
+		return err
+	}
+	for _, listing := range listings {
+		for _, item := range listing.Items {
+			record := []string{
+				listing.Backup,
+				item.Path,
+				item.Type,
+				strconv.FormatInt(item.Size, 10),
+				item.ModTime.UTC().Format(time.RFC3339),
+				item.Mode,
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,124 @@
+package list
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sampleListings() []Listing {
+	mtime := time.Date(2026, 3, 14, 10, 30, 0, 0, time.UTC)
+	listing := Listing{Backup: "Docs_2026-03-14_ABC123"}
+	for _, item := range []Item{
+		{Path: "reports", Type: "dir", ModTime: mtime, Mode: "drwxr-x---"},
+		{Path: "reports/q1.xlsx", Type: "file", Size: 2048, ModTime: mtime, Mode: "-rw-r-----"},
+		{Path: "reports/archive/old.xlsx", Type: "file", Size: 10, ModTime: mtime, Mode: "-rw-r-----"},
+		{Path: "notes.txt", Type: "file", Size: 5, ModTime: mtime, Mode: "-rw-r-----"},
+	} {
+		listing.Items = append(listing.Items, item)
+		listing.Total.add(item)
+	}
+	return []Listing{listing}
+}
+
+func TestParseFormat(t *testing.T) {
+	t.Parallel()
+
+	for input, want := range map[string]Format{"": FormatTree, "TABLE": FormatTable, " json ": FormatJSON, "csv": FormatCSV} {
+		got, err := ParseFormat(input)
+		if err != nil || got != want {
+			t.Fatalf("ParseFormat(%q): expected %q, got %q (err=%v)", input, want, got, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Fatal("expected error for unknown format, got nil")
+	}
+}
+
+func TestWriteTreeNestsEntriesAndPrintsTotal(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatTree, sampleListings()); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	output := buf.String()
+
+	for _, want := range []string{
+		"Docs_2026-03-14_ABC123\n",
+		"├── notes.txt  (5 B, ",
+		"└── reports/\n",
+		"    ├── archive/\n",
+		"    │   └── old.xlsx  (10 B, ",
+		"    └── q1.xlsx  (2.00 KB, ",
+		"Total: 3 file(s), 1 directory(s), 2.01 KB\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Fatalf("expected tree output to contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestWriteTableListsEntriesInArchiveOrder(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatTable, sampleListings()); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 7 {
+		t.Fatalf("expected 7 lines (backup, header, 4 rows, total), got %d:\n%s", len(lines), buf.String())
+	}
+	if !strings.HasPrefix(lines[1], "MODE") || !strings.HasSuffix(lines[2], "reports/") || !strings.HasSuffix(lines[5], "notes.txt") {
+		t.Fatalf("unexpected table layout:\n%s", buf.String())
+	}
+}
+
+func TestWriteJSONIncludesEntriesAndTotals(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatJSON, sampleListings()); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+
+	var doc struct {
+		Backups []Listing `json:"backups"`
+		Total   Totals    `json:"total"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("output is not valid JSON: %v", err)
+	}
+	if len(doc.Backups) != 1 || len(doc.Backups[0].Items) != 4 {
+		t.Fatalf("unexpected JSON document: %+v", doc)
+	}
+	if doc.Total.Files != 3 || doc.Total.Bytes != 2063 {
+		t.Fatalf("unexpected totals: %+v", doc.Total)
+	}
+}
+
+func TestWriteCSVWritesHeaderAndRows(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatCSV, sampleListings()); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("output is not valid CSV: %v", err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("expected header and 4 rows, got %d", len(records))
+	}
+	if strings.Join(records[0], ",") != "backup,path,type,size,mtime,mode" {
+		t.Fatalf("unexpected CSV header: %v", records[0])
+	}
+	if records[2][1] != "reports/q1.xlsx" || records[2][3] != "2048" || records[2][4] != "2026-03-14T10:30:00Z" {
+		t.Fatalf("unexpected CSV row: %v", records[2])
+	}
+}
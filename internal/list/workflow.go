@@ -0,0 +1,428 @@
+// Package list shows the contents of backup sets without restoring them:
+//  1. Let the user choose which backup(s) to list
+//  2. Optionally filter entries by path or pattern
+//  3. Verify password (up to 3 attempts)
+//  4. Decrypt the parts, walk the TAR headers and print a tree, table, JSON or CSV listing
+package list
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readLineFn is the line reader used by the list prompts; tests replace it.
+var readLineFn = security.ReadLine
+
+// Options holds list choices passed as arguments instead of being entered at the prompts.
+type Options struct {
+	// Backup selects the backup(s) to list: a dot (.), a backup ID or a full backup name.
+	Backup string
+	// Include limits the listing to matching entries; empty lists everything.
+	Include []string
+	// Format is tree (default), table, json or csv.
+	Format string
+	// Output writes the listing to this file instead of the console.
+	Output string
+}
+
+// settings are the resolved filter and output choices of one list run.
+type settings struct {
+	selector *util.PathSelector
+	format   Format
+	output   string
+}
+
+// Run lists the contents of selected backup sets.
+func Run(cfg *util.Config, exeDir string) error {
+	return run(cfg, exeDir, nil)
+}
+
+// RunWithOptions lists the contents of the backup sets selected by opts.
+// The password is still prompted.
+func RunWithOptions(cfg *util.Config, exeDir string, opts Options) error {
+	return run(cfg, exeDir, &opts)
+}
+
+func run(cfg *util.Config, exeDir string, opts *Options) error {
+	backupDir := util.ResolveDir(cfg.BackupDirectory, exeDir)
+
+	index, err := catalog.ScanBackups(backupDir)
+	if err != nil {
+		return fmt.Errorf("Failed to scan backup directory %q: %w. Remedy: Check the backup_directory path in config.yaml and ensure the directory is readable.", backupDir, err)
+	}
+	if len(index) == 0 {
+		fmt.Println("No backups found in backup directory. Remedy: Check whether .enc files are in the backup directory and whether the correct directory is selected.")
+		return nil
+	}
+
+	selected, selection, err := resolveListSelection(backupDir, index, opts)
+	if err != nil {
+		if errors.Is(err, operation.ErrSelectionCancelled) {
+			fmt.Println("Listing cancelled.")
+			return nil
+		}
+		return err
+	}
+	warningCount := listSelectionWarningCount(selection, index)
+
+	s, err := resolveListSettings(opts)
+	if err != nil {
+		if errors.Is(err, operation.ErrSelectionCancelled) {
+			fmt.Println("Listing cancelled.")
+			return nil
+		}
+		return err
+	}
+
+	requiresYubiKey, yubiKeyOnly, err := catalog.BackupRunUsesYubiKey(backupDir, selected[0])
+	if err != nil {
+		return fmt.Errorf("Failed to inspect backup authentication: %w. Remedy: Check read permissions in the backup directory and existing .challenge files.", err)
+	}
+
+	logPath := util.LogFileName(backupDir, selected[0].Date, selected[0].ID)
+	log := operation.OpenLogger(cfg, backupDir, selected[0])
+	if log.IsConsoleOnly() {
+		warningCount++
+	}
+	defer log.Close()
+
+	preflight := buildListPreflight(selected, backupDir)
+	printListPreflightWithYubiKeyCheck(os.Stdout, cfg, backupDir, preflight, s, requiresYubiKey, yubiKeyOnly, security.CheckYubiKeyConnected)
+	if err := validateListPreflight(preflight, s); err != nil {
+		return err
+	}
+
+	password, err := operation.ReadPasswordWithRetry(backupDir, selected[0], "Enter list password: ", log)
+	if err != nil {
+		return err
+	}
+	defer func() { security.ZeroBytes(password) }()
+
+	log.InfoLogOnly("Listing started - ID: %s, date: %s", string(selected[0].ID), selected[0].Date)
+	for _, entry := range selected {
+		log.InfoLogOnly("  %s", entry.String())
+	}
+	if !s.selector.IsEmpty() {
+		log.InfoLogOnly("Filter: %s", strings.Join(s.selector.Patterns(), "; "))
+	}
+
+	listings, err := listSelectedEntries(selected, backupDir, password, log, s.selector)
+	if err != nil {
+		return err
+	}
+
+	if err := writeListings(s, listings); err != nil {
+		return err
+	}
+
+	log.InfoLogOnly("Listing completed successfully.")
+	fmt.Printf("\nLog file: %s\n", logPath)
+	if warningCount > 0 {
+		fmt.Printf("Warnings: %d\n", warningCount)
+	}
+	return nil
+}
+
+func resolveListSelection(backupDir string, index []util.BackupEntry, opts *Options) ([]util.BackupEntry, string, error) {
+	if opts != nil {
+		return operation.ResolveBackupSelection(backupDir, index, opts.Backup)
+	}
+	return operation.PromptBackupSelection("list", backupDir, index)
+}
+
+func resolveListSettings(opts *Options) (settings, error) {
+	var patterns []string
+	formatValue := ""
+	output := ""
+	if opts == nil {
+		var err error
+		patterns, err = promptListFilter()
+		if err != nil {
+			return settings{}, err
+		}
+		formatValue, err = promptListFormat()
+		if err != nil {
+			return settings{}, err
+		}
+	} else {
+		patterns = opts.Include
+		formatValue = opts.Format
+		output = strings.TrimSpace(opts.Output)
+	}
+
+	selector, err := util.NewPathSelector(patterns)
+	if err != nil {
+		return settings{}, err
+	}
+	format, err := ParseFormat(formatValue)
+	if err != nil {
+		return settings{}, err
+	}
+	return settings{selector: selector, format: format, output: output}, nil
+}
+
+func promptListFilter() ([]string, error) {
+	for {
+		fmt.Printf("Filter entries:\n")
+		fmt.Printf("  - Press Enter → list all entries\n")
+		fmt.Printf("  - Enter path(s) or pattern(s) relative to the backed-up directory, separated by ; (e.g. Reports/2025;**/*.xlsx) → list only matching entries\n")
+		fmt.Printf("  - Enter q → cancel\n")
+		fmt.Println()
+
+		input, err := readLineFn("Filter: ")
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println()
+		input = strings.TrimSpace(input)
+
+		switch input {
+		case "":
+			return nil, nil
+		case "q":
+			return nil, operation.ErrSelectionCancelled
+		}
+
+		patterns := util.ParseSelectionPatterns(input)
+		if _, err := util.NewPathSelector(patterns); err != nil {
+			fmt.Printf("%v\n\n", err)
+			continue
+		}
+		return patterns, nil
+	}
+}
+
+func promptListFormat() (string, error) {
+	for {
+		answer, err := readLineFn("Output format [tree/table/json/csv] (Enter = tree): ")
+		if err != nil {
+			return "", err
+		}
+		fmt.Println()
+		if _, err := ParseFormat(answer); err != nil {
+			fmt.Printf("%v\n\n", err)
+			continue
+		}
+		return answer, nil
+	}
+}
+
+type listPreflightItem struct {
+	Entry          util.BackupEntry
+	PartCount      int
+	TotalSizeBytes int64
+	Err            error
+}
+
+func buildListPreflight(selected []util.BackupEntry, backupDir string) []listPreflightItem {
+	items := make([]listPreflightItem, 0, len(selected))
+	for _, entry := range selected {
+		partCount, totalSizeBytes, err := catalog.InspectBackupParts(backupDir, entry)
+		if err == nil && partCount == 0 {
+			err = fmt.Errorf("No part files found. Remedy: Ensure all .enc parts of this backup are in the same backup directory.")
+		}
+		items = append(items, listPreflightItem{
+			Entry:          entry,
+			PartCount:      partCount,
+			TotalSizeBytes: totalSizeBytes,
+			Err:            err,
+		})
+	}
+	return items
+}
+
+func printListPreflightWithYubiKeyCheck(
+	w io.Writer,
+	cfg *util.Config,
+	backupDir string,
+	items []listPreflightItem,
+	s settings,
+	requiresYubiKey, yubiKeyOnly bool,
+	checkYubiKeyConnected func() error,
+) {
+	var issues []string
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "List preflight")
+	fmt.Fprintln(w, "--------------")
+
+	// Backup selection
+	fmt.Fprintln(w, "Backup selection:")
+	fmt.Fprintf(w, "  Path: %s\n", filepath.ToSlash(backupDir))
+	for _, item := range items {
+		if item.Err != nil {
+			fmt.Fprintf(w, "  [ERROR] %s (parts: %d)\n", item.Entry.String(), item.PartCount)
+			issues = append(issues, item.Err.Error())
+		} else {
+			fmt.Fprintf(w, "  [OK] %s (parts: %d)\n", item.Entry.String(), item.PartCount)
+		}
+	}
+
+	// Filter and output
+	filter := "none (all entries)"
+	if !s.selector.IsEmpty() {
+		filter = strings.Join(s.selector.Patterns(), "; ")
+	}
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Filter", filter)
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Format", string(s.format))
+	if s.output == "" {
+		operation.PrintField(w, operation.DefaultFieldLabelWidth, "Output", "console")
+	} else {
+		operation.PrintField(w, operation.DefaultFieldLabelWidth, "Output", filepath.ToSlash(s.output))
+		if _, err := os.Stat(s.output); err == nil {
+			issues = append(issues, fmt.Sprintf("Output file %s already exists. Remedy: Choose a different output path or delete the existing file.", filepath.ToSlash(s.output)))
+		}
+	}
+
+	// Authentication and Log level
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Authentication", operation.BackupAuthenticationLabel(requiresYubiKey, yubiKeyOnly))
+	operation.PrintYubiKeyPreflightStatus(w, requiresYubiKey, "listing", checkYubiKeyConnected)
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Log level", strings.ToLower(cfg.LogLevel))
+
+	// Print collected issues
+	if len(issues) > 0 {
+		fmt.Fprintln(w)
+		for _, issue := range issues {
+			fmt.Fprintf(w, "[ERROR] %s\n", issue)
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+func validateListPreflight(items []listPreflightItem, s settings) error {
+	if err := operation.ValidatePreflightItems(
+		items,
+		func(item listPreflightItem) bool { return item.Err != nil },
+		"List preflight failed: %d selected item(s) are incomplete or invalid. Remedy: Fix the [ERROR] entries above and start the listing again.",
+	); err != nil {
+		return err
+	}
+	if s.output != "" {
+		if _, err := os.Stat(s.output); err == nil {
+			return fmt.Errorf("List preflight failed: output file %s already exists. Remedy: Choose a different output path or delete the existing file.", filepath.ToSlash(s.output))
+		}
+	}
+	return nil
+}
+
+func listSelectedEntries(selected []util.BackupEntry, backupDir string, password []byte, log *util.Logger, selector *util.PathSelector) ([]Listing, error) {
+	listings := make([]Listing, 0, len(selected))
+	for _, entry := range selected {
+		listing, err := listEntry(entry, backupDir, password, log, selector)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list directory %q: %w", entry.String(), err)
+		}
+		log.InfoLogOnly("  Listed: %d entries - [%s]", len(listing.Items), entry.DirectoryName)
+		listings = append(listings, listing)
+	}
+	return listings, nil
+}
+
+// listEntry collects the matching entries of one backup entry. The encrypted manifest
+// is used when present; otherwise all parts are decrypted and the TAR headers read.
+func listEntry(entry util.BackupEntry, backupDir string, password []byte, log *util.Logger, selector *util.PathSelector) (Listing, error) {
+	listing := Listing{Backup: entry.String()}
+
+	entries, ok, err := manifest.LoadForBackup(backupDir, entry, password)
+	if err != nil {
+		if catalog.IsSnapshot(backupDir, entry) {
+			return listing, fmt.Errorf("Snapshot of %s could not be read: %w", entry.String(), err)
+		}
+		log.Warn("Manifest of %s could not be read, reading the backup parts instead: %v", entry.String(), err)
+	}
+	if ok {
+		for _, e := range entries {
+			if e.Deleted() {
+				continue
+			}
+			hdr := e.Header()
+			if !selector.Match(hdr.Name) {
+				continue
+			}
+			item := itemFromHeader(hdr)
+			item.Mode = e.Mode.String()
+			listing.Items = append(listing.Items, item)
+			listing.Total.add(item)
+		}
+		return listing, nil
+	}
+
+	parts, err := catalog.CollectParts(backupDir, entry)
+	if err != nil {
+		return listing, err
+	}
+	if len(parts) == 0 {
+		return listing, fmt.Errorf("No part files found for %s. Remedy: Ensure all .enc files for this backup are in the same backup directory.", entry.String())
+	}
+
+	err = operation.RunDecryptPipeline(
+		parts,
+		password,
+		log,
+		entry.DirectoryName,
+		"listed",
+		"Archive listing",
+		func(r io.Reader) error {
+			return util.WalkTar(r, func(hdr *tar.Header, _ io.Reader) error {
+				if !selector.Match(hdr.Name) {
+					return nil
+				}
+				item := itemFromHeader(hdr)
+				listing.Items = append(listing.Items, item)
+				listing.Total.add(item)
+				return nil
+			})
+		},
+		nil,
+	)
+	if err != nil {
+		return listing, err
+	}
+
+	return listing, nil
+}
+
+func writeListings(s settings, listings []Listing) error {
+	if s.output == "" {
+		return Write(os.Stdout, s.format, listings)
+	}
+
+	f, err := os.OpenFile(s.output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("Failed to create output file %q: %w. Remedy: Check the output path and write permissions.", s.output, err)
+	}
+	if err := Write(f, s.format, listings); err != nil {
+		f.Close() //nolint:errcheck
+		return fmt.Errorf("Failed to write output file %q: %w", s.output, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("Failed to close output file %q: %w", s.output, err)
+	}
+	fmt.Printf("Listing written to: %s\n", filepath.ToSlash(s.output))
+	return nil
+}
+
+func listSelectionWarningCount(selection string, index []util.BackupEntry) int {
+	normalized := strings.ToUpper(strings.TrimSpace(selection))
+	if !catalog.IsRawBackupID(normalized) {
+		return 0
+	}
+	_, _, allDates, found := catalog.ResolveSelectionForIDNewestDate(normalized, index)
+	if !found {
+		return 0
+	}
+	if len(allDates) > 1 {
+		return 1
+	}
+	return 0
+}
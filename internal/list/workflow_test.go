@@ -0,0 +1,105 @@
+package list
+
+import (
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestListEntryCollectsArchiveEntries(t *testing.T) {
+	password := []byte("list-password")
+	fx := testutil.NewBackupFixture(t, password)
+
+	listing, err := listEntry(fx.Entry, fx.BackupDir, password, nil, nil)
+	if err != nil {
+		t.Fatalf("listEntry failed: %v", err)
+	}
+	if listing.Backup != fx.Entry.String() {
+		t.Fatalf("expected backup name %q, got %q", fx.Entry.String(), listing.Backup)
+	}
+	if listing.Total.Files != 2 || listing.Total.Directories < 1 {
+		t.Fatalf("unexpected totals: %+v", listing.Total)
+	}
+
+	paths := make([]string, 0, len(listing.Items))
+	for _, item := range listing.Items {
+		paths = append(paths, item.Path)
+	}
+	joined := strings.Join(paths, ",")
+	if !strings.Contains(joined, "nested/small.txt") || !strings.Contains(joined, "large.bin") {
+		t.Fatalf("expected fixture files in listing, got %v", paths)
+	}
+}
+
+func TestListEntryAppliesFilter(t *testing.T) {
+	password := []byte("list-filter-password")
+	fx := testutil.NewBackupFixture(t, password)
+
+	selector, err := util.NewPathSelector([]string{"*.bin"})
+	if err != nil {
+		t.Fatalf("NewPathSelector returned error: %v", err)
+	}
+	listing, err := listEntry(fx.Entry, fx.BackupDir, password, nil, selector)
+	if err != nil {
+		t.Fatalf("listEntry failed: %v", err)
+	}
+	if len(listing.Items) != 1 || listing.Items[0].Path != "large.bin" || listing.Items[0].Type != "file" {
+		t.Fatalf("expected only large.bin, got %+v", listing.Items)
+	}
+}
+
+func TestListEntryWrongPasswordFails(t *testing.T) {
+	fx := testutil.NewBackupFixture(t, []byte("correct-password"))
+
+	if _, err := listEntry(fx.Entry, fx.BackupDir, []byte("wrong-password"), nil, nil); err == nil {
+		t.Fatal("expected error for wrong password, got nil")
+	}
+}
+
+func TestRunReturnsNilWhenNoBackupsFound(t *testing.T) {
+	t.Parallel()
+	cfg := &util.Config{BackupDirectory: t.TempDir()}
+
+	output := testutil.CaptureStdout(t, func() {
+		if err := Run(cfg, ""); err != nil {
+			t.Errorf("expected nil for empty backup dir, got: %v", err)
+		}
+	})
+	if !strings.Contains(output, "No backups found") {
+		t.Fatalf("expected no-backups message in output, got: %q", output)
+	}
+}
+
+func TestValidateListPreflightRejectsExistingOutputFile(t *testing.T) {
+	t.Parallel()
+
+	output := filepath.Join(t.TempDir(), "listing.csv")
+	if err := os.WriteFile(output, []byte("x"), 0o600); err != nil {
+		t.Fatalf("failed to create output file: %v", err)
+	}
+
+	err := validateListPreflight(nil, settings{format: FormatCSV, output: output})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected existing-output error, got: %v", err)
+	}
+}
+
+func TestWriteListingsCreatesOutputFile(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "listing.json")
+
+	testutil.CaptureStdout(t, func() {
+		if err := writeListings(settings{format: FormatJSON, output: output}, sampleListings()); err != nil {
+			t.Errorf("writeListings failed: %v", err)
+		}
+	})
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("failed to read output file: %v", err)
+	}
+	if !strings.Contains(string(data), `"backup": "Docs_2026-03-14_ABC123"`) {
+		t.Fatalf("unexpected output file content:\n%s", data)
+	}
+}
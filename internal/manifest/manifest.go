@@ -0,0 +1,351 @@
+// Package manifest reads and writes the encrypted manifest stored next to the parts
+// of every backup directory.
+//
+// The manifest lists every TAR entry of the backup with its size, modification time,
+// mode, SHA-256 (regular files) and offsets in the TAR stream. It lets list, verify,
+// restore and diff work from the metadata without decrypting the whole archive.
+//
+// File layout: the manifest is encrypted with security.Encrypt using the same
+// password (and YubiKey response) as the parts. The plaintext is JSON Lines:
+//
+//	{"format":"restoresafe-manifest","version":1,"backup":"...","created":"..."}
+//	{"path":"...","type":"file","size":123,"mtime":"...","mode":420,"sha256":"...","header_offset":0,"data_offset":512}
+//	...
+//
+// The manifest of an incremental run lists the complete state of the directory:
+// unchanged files name the earlier backup holding their content in "stored", and
+// files deleted since the parent backup are recorded as tombstones of type "deleted".
+//
+// Snapshots of the chunked repository (see package repository) use the same format.
+// Their file entries list the keyed hashes of the chunks holding the content in
+// "chunks" instead of archive offsets, and LoadForBackup returns them for backups
+// that have no manifest of their own.
+package manifest
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+const (
+	formatName    = "restoresafe-manifest"
+	formatVersion = 1
+)
+
+// Header is the first line of a manifest.
+type Header struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Backup  string    `json:"backup"`
+	Created time.Time `json:"created"`
+	// Parent names the backup an incremental run is based on; empty for full backups.
+	Parent string `json:"parent,omitempty"`
+}
+
+// TypeDeleted marks a tombstone: a path of the parent backup that no longer exists.
+const TypeDeleted = "deleted"
+
+// Entry describes one TAR entry of a backup.
+type Entry struct {
+	Path         string      `json:"path"`
+	Type         string      `json:"type"`
+	Size         int64       `json:"size"`
+	ModTime      time.Time   `json:"mtime"`
+	Mode         fs.FileMode `json:"mode"`
+	SHA256       string      `json:"sha256,omitempty"`
+	HeaderOffset int64       `json:"header_offset"`
+	DataOffset   int64       `json:"data_offset"`
+	// Stored names the backup whose archive holds the content when it is not this
+	// backup's own archive, i.e. an unchanged file of an incremental run. The offsets
+	// then refer to that archive.
+	Stored string `json:"stored,omitempty"`
+	// Chunks lists the IDs of the repository chunks holding the content of a file
+	// in a snapshot of the chunked repository, in order.
+	Chunks []string `json:"chunks,omitempty"`
+}
+
+// Deleted reports whether the entry is a tombstone.
+func (e Entry) Deleted() bool {
+	return e.Type == TypeDeleted
+}
+
+// InArchive reports whether the entry is contained in this backup's own archive.
+func (e Entry) InArchive() bool {
+	return !e.Deleted() && e.Stored == ""
+}
+
+// EntryFromTar converts an entry reported by util.WriteTarIndexed.
+func EntryFromTar(e util.TarEntry) Entry {
+	hdr := e.Header
+	entry := Entry{
+		Path: strings.TrimSuffix(hdr.Name, "/"),
+		// tar.Writer rounds modification times to whole seconds; record what the archive holds.
+		ModTime:      hdr.ModTime.Round(time.Second),
+		Mode:         hdr.FileInfo().Mode(),
+		HeaderOffset: e.HeaderOffset,
+		DataOffset:   e.DataOffset,
+	}
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		entry.Type = "dir"
+	case tar.TypeReg:
+		entry.Type = "file"
+		entry.Size = hdr.Size
+	case tar.TypeSymlink:
+		entry.Type = "symlink"
+	default:
+		entry.Type = "other"
+	}
+	if e.SHA256 != nil {
+		entry.SHA256 = hex.EncodeToString(e.SHA256)
+	}
+	return entry
+}
+
+// Header reconstructs the TAR header metadata of the entry.
+func (e Entry) Header() *tar.Header {
+	hdr := &tar.Header{
+		Name:    e.Path,
+		Size:    e.Size,
+		Mode:    int64(e.Mode.Perm()),
+		ModTime: e.ModTime,
+	}
+	switch e.Type {
+	case "dir":
+		hdr.Typeflag = tar.TypeDir
+	case "file":
+		hdr.Typeflag = tar.TypeReg
+	case "symlink":
+		hdr.Typeflag = tar.TypeSymlink
+	default:
+		hdr.Typeflag = tar.TypeBlock
+	}
+	return hdr
+}
+
+// Sum returns the decoded SHA-256 of the entry, or nil when none is recorded.
+func (e Entry) Sum() []byte {
+	if e.SHA256 == "" {
+		return nil
+	}
+	sum, err := hex.DecodeString(e.SHA256)
+	if err != nil {
+		return nil
+	}
+	return sum
+}
+
+// Writer streams manifest entries into an encrypted file.
+type Writer struct {
+	path string
+	file util.StorageWriter
+	pw   *io.PipeWriter
+	bw   *bufio.Writer
+	enc  *json.Encoder
+	done chan error
+}
+
+// Create starts a new encrypted manifest at path. header names the backup and, for
+// incremental runs, its parent; format, version and creation time are filled in.
+// The file must not exist yet.
+func Create(path string, header Header, password []byte, params security.Argon2Params) (*Writer, error) {
+	f, err := util.StorageFor(path).CreateNew(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create manifest %q: %w. Remedy: Check write permissions in the backup directory.", path, err)
+	}
+
+	pr, pw := io.Pipe()
+	w := &Writer{path: path, file: f, pw: pw, done: make(chan error, 1)}
+	w.bw = bufio.NewWriter(pw)
+	w.enc = json.NewEncoder(w.bw)
+	go func() {
+		err := security.Encrypt(f, pr, password, params)
+		pr.CloseWithError(err) //nolint:errcheck
+		w.done <- err
+	}()
+
+	header.Format, header.Version, header.Created = formatName, formatVersion, time.Now().UTC()
+	if err := w.enc.Encode(header); err != nil {
+		w.Abort()
+		return nil, fmt.Errorf("Failed to write manifest header: %w", err)
+	}
+	return w, nil
+}
+
+// Add appends one entry.
+func (w *Writer) Add(entry Entry) error {
+	if err := w.enc.Encode(entry); err != nil {
+		return fmt.Errorf("Failed to write manifest entry %q: %w", entry.Path, err)
+	}
+	return nil
+}
+
+// Close finishes encryption and syncs the manifest to disk.
+func (w *Writer) Close() error {
+	flushErr := w.bw.Flush()
+	w.pw.Close() //nolint:errcheck
+	encErr := <-w.done
+	syncErr := w.file.Sync()
+	closeErr := w.file.Close()
+	for _, err := range []error{flushErr, encErr, syncErr, closeErr} {
+		if err != nil {
+			util.StorageFor(w.path).Remove(w.path) //nolint:errcheck
+			return fmt.Errorf("Failed to write manifest %q: %w. Remedy: Check free space and write permissions in the backup directory.", w.path, err)
+		}
+	}
+	return nil
+}
+
+// Abort stops writing and removes the incomplete manifest.
+func (w *Writer) Abort() {
+	w.pw.CloseWithError(errors.New("Manifest aborted")) //nolint:errcheck
+	<-w.done
+	w.file.Close()                         //nolint:errcheck
+	util.StorageFor(w.path).Remove(w.path) //nolint:errcheck
+}
+
+// Reader reads the entries of an encrypted manifest one by one.
+type Reader struct {
+	file   util.StorageFile
+	dec    *json.Decoder
+	header Header
+}
+
+// Open decrypts the manifest at path and reads its header.
+// A wrong password is reported as security.ErrWrongPassword.
+func Open(path string, password []byte) (*Reader, error) {
+	f, err := util.StorageFor(path).Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open manifest %q: %w", path, err)
+	}
+	dr, err := security.NewDecryptReader(bufio.NewReader(f), password)
+	if err != nil {
+		f.Close() //nolint:errcheck
+		return nil, err
+	}
+
+	r := &Reader{file: f, dec: json.NewDecoder(dr)}
+	if err := r.dec.Decode(&r.header); err != nil {
+		f.Close() //nolint:errcheck
+		if errors.Is(err, security.ErrWrongPassword) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("Failed to read manifest header %q: %w. Remedy: The manifest is damaged; list, verify and restore fall back to the backup parts.", path, err)
+	}
+	if r.header.Format != formatName {
+		f.Close() //nolint:errcheck
+		return nil, fmt.Errorf("Invalid manifest %q: not a RestoreSafe manifest. Remedy: Remove the file; the backup parts remain usable without it.", path)
+	}
+	if r.header.Version != formatVersion {
+		f.Close() //nolint:errcheck
+		return nil, fmt.Errorf("Unsupported manifest version %d in %q (this RestoreSafe version uses %d). Remedy: Use the RestoreSafe version that created the backup.", r.header.Version, path, formatVersion)
+	}
+	return r, nil
+}
+
+// Header returns the manifest header.
+func (r *Reader) Header() Header {
+	return r.header
+}
+
+// Next returns the next entry, or io.EOF after the last one.
+func (r *Reader) Next() (Entry, error) {
+	var entry Entry
+	if err := r.dec.Decode(&entry); err != nil {
+		if errors.Is(err, io.EOF) {
+			return Entry{}, io.EOF
+		}
+		if errors.Is(err, security.ErrWrongPassword) {
+			return Entry{}, err
+		}
+		return Entry{}, fmt.Errorf("Failed to read manifest entry: %w. Remedy: The manifest is damaged; list, verify and restore fall back to the backup parts.", err)
+	}
+	return entry, nil
+}
+
+// Close closes the underlying file.
+func (r *Reader) Close() error {
+	return r.file.Close()
+}
+
+// Load reads all entries of the manifest at path.
+func Load(path string, password []byte) (Header, []Entry, error) {
+	r, err := Open(path, password)
+	if err != nil {
+		return Header{}, nil, err
+	}
+	defer r.Close()
+
+	var entries []Entry
+	for {
+		entry, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return r.Header(), entries, nil
+		}
+		if err != nil {
+			return Header{}, nil, err
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// LoadForBackup loads the manifest of entry from backupDir, or its snapshot when the
+// backup is stored in the chunked repository format.
+// ok is false when the backup has no manifest, e.g. because it predates manifests.
+func LoadForBackup(backupDir string, entry util.BackupEntry, password []byte) (entries []Entry, ok bool, err error) {
+	_, entries, ok, err = LoadWithHeaderForBackup(backupDir, entry, password)
+	return entries, ok, err
+}
+
+// LoadWithHeaderForBackup is LoadForBackup that also returns the manifest header.
+func LoadWithHeaderForBackup(backupDir string, entry util.BackupEntry, password []byte) (Header, []Entry, bool, error) {
+	path, found, err := catalog.FindManifestFile(backupDir, entry)
+	if err == nil && !found {
+		path, found, err = catalog.FindSnapshotFile(backupDir, entry)
+	}
+	if err != nil || !found {
+		return Header{}, nil, false, err
+	}
+	header, entries, err := Load(path, password)
+	if err != nil {
+		return Header{}, nil, false, err
+	}
+	return header, entries, true, nil
+}
+
+// Index maps the entries of a manifest by archive path. Tombstones are not indexed.
+type Index map[string]Entry
+
+// NewIndex builds an Index from entries.
+func NewIndex(entries []Entry) Index {
+	index := make(Index, len(entries))
+	for _, entry := range entries {
+		if entry.Deleted() {
+			continue
+		}
+		index[entry.Path] = entry
+	}
+	return index
+}
+
+// ExpectedSHA256 returns the recorded content hash of the regular file at name.
+// It matches the signature of util.ExtractOptions.ExpectedSHA256.
+func (idx Index) ExpectedSHA256(name string) ([]byte, bool) {
+	entry, ok := idx[strings.TrimSuffix(name, "/")]
+	if !ok || entry.Type != "file" {
+		return nil, false
+	}
+	sum := entry.Sum()
+	return sum, sum != nil
+}
@@ -0,0 +1,150 @@
+package manifest
+
+import (
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeSource(t *testing.T) string {
+	t.Helper()
+	src := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0o750); err != nil {
+		t.Fatalf("failed to create sub dir: %v", err)
+	}
+	files := map[string]string{"a.txt": "alpha", "sub/b.txt": "bravo bravo"}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(src, filepath.FromSlash(name)), []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	return src
+}
+
+func writeManifest(t *testing.T, src, path string, password []byte) []byte {
+	t.Helper()
+	mw, err := Create(path, Header{Backup: "src_2026-03-14_ABC123"}, password, security.DefaultArgon2Params)
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	var archive bytes.Buffer
+	err = util.WriteTarIndexed(&archive, src, func(e util.TarEntry) error { return mw.Add(EntryFromTar(e)) })
+	if err != nil {
+		mw.Abort()
+		t.Fatalf("WriteTarIndexed returned error: %v", err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	return archive.Bytes()
+}
+
+func TestManifestRoundTripRecordsHashesAndOffsets(t *testing.T) {
+	t.Parallel()
+	src := writeSource(t)
+	path := filepath.Join(t.TempDir(), "[src]_2026-03-14_ABC123.manifest.enc")
+	archive := writeManifest(t, src, path, []byte("pw"))
+
+	header, entries, err := Load(path, []byte("pw"))
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if header.Backup != "src_2026-03-14_ABC123" || header.Version != formatVersion {
+		t.Fatalf("unexpected header: %#v", header)
+	}
+	index := NewIndex(entries)
+	if len(index) != 4 {
+		t.Fatalf("expected 4 entries (., a.txt, sub, sub/b.txt), got %d: %#v", len(index), entries)
+	}
+
+	b := index["sub/b.txt"]
+	wantSum := sha256.Sum256([]byte("bravo bravo"))
+	if b.Type != "file" || b.Size != 11 || b.SHA256 != hex.EncodeToString(wantSum[:]) {
+		t.Fatalf("unexpected entry for sub/b.txt: %#v", b)
+	}
+	if index["sub"].Type != "dir" || index["sub"].SHA256 != "" {
+		t.Fatalf("unexpected entry for sub: %#v", index["sub"])
+	}
+
+	// The recorded offsets point at the entry's header and content in the TAR stream.
+	tr := tar.NewReader(bytes.NewReader(archive[b.HeaderOffset:]))
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != "sub/b.txt" {
+		t.Fatalf("expected sub/b.txt header at offset %d, got %v, %v", b.HeaderOffset, hdr, err)
+	}
+	content := archive[b.DataOffset : b.DataOffset+b.Size]
+	if string(content) != "bravo bravo" {
+		t.Fatalf("expected content at data offset, got %q", content)
+	}
+
+	if sum, ok := index.ExpectedSHA256("sub/b.txt"); !ok || !bytes.Equal(sum, wantSum[:]) {
+		t.Fatalf("ExpectedSHA256 returned %x, %v", sum, ok)
+	}
+	if _, ok := index.ExpectedSHA256("sub"); ok {
+		t.Fatalf("expected no hash for a directory")
+	}
+}
+
+func TestManifestEntryHeaderMatchesArchiveHeader(t *testing.T) {
+	t.Parallel()
+	src := writeSource(t)
+	path := filepath.Join(t.TempDir(), "m.manifest.enc")
+	archive := writeManifest(t, src, path, []byte("pw"))
+
+	_, entries, err := Load(path, []byte("pw"))
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	index := NewIndex(entries)
+
+	err = util.WalkTar(bytes.NewReader(archive), func(hdr *tar.Header, _ io.Reader) error {
+		got := index[hdr.Name].Header()
+		if got.Name != hdr.Name || got.Typeflag != hdr.Typeflag || got.Size != hdr.Size || !got.ModTime.Equal(hdr.ModTime) {
+			t.Fatalf("manifest header %#v does not match archive header %#v", got, hdr)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkTar returned error: %v", err)
+	}
+}
+
+func TestManifestOpenWrongPassword(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "m.manifest.enc")
+	writeManifest(t, writeSource(t), path, []byte("pw"))
+
+	if _, err := Open(path, []byte("wrong")); !errors.Is(err, security.ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword, got %v", err)
+	}
+}
+
+func TestManifestAbortRemovesFile(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "m.manifest.enc")
+	mw, err := Create(path, Header{Backup: "x"}, []byte("pw"), security.DefaultArgon2Params)
+	if err != nil {
+		t.Fatalf("Create returned error: %v", err)
+	}
+	mw.Abort()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected aborted manifest to be removed, stat err: %v", err)
+	}
+}
+
+func TestLoadForBackupWithoutManifest(t *testing.T) {
+	t.Parallel()
+	entry := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-14", ID: util.BackupID("ABC123")}
+	entries, ok, err := LoadForBackup(t.TempDir(), entry, []byte("pw"))
+	if err != nil || ok || entries != nil {
+		t.Fatalf("expected no manifest, got %v, %v, %v", entries, ok, err)
+	}
+}
@@ -0,0 +1,94 @@
+package operation
+
+import (
+	"RestoreSafe/internal/util"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// CommandLogWriter writes every line a command prints, usually its standard error,
+// to the run log. The last non-empty line is kept for error messages.
+type CommandLogWriter struct {
+	Log    *util.Logger
+	Prefix string
+
+	mu      sync.Mutex
+	pending []byte
+	last    string
+}
+
+func (w *CommandLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = append(w.pending, p...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+		w.logLine(string(w.pending[:i]))
+		w.pending = w.pending[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush logs output that did not end with a newline.
+func (w *CommandLogWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.pending) > 0 {
+		w.logLine(string(w.pending))
+		w.pending = nil
+	}
+}
+
+// LastLine returns the last non-empty line written.
+func (w *CommandLogWriter) LastLine() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.last
+}
+
+func (w *CommandLogWriter) logLine(line string) {
+	line = strings.TrimRight(line, "\r")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	w.last = line
+	w.Log.Info("%s%s", w.Prefix, line)
+}
+
+// FormatCommand returns command and args as one line for display.
+func FormatCommand(command string, args []string) string {
+	parts := make([]string, 0, len(args)+1)
+	for _, part := range append([]string{command}, args...) {
+		if part == "" || strings.ContainsAny(part, " \t\"") {
+			part = fmt.Sprintf("%q", part)
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+// CommandExitError describes the failure of a command that was run, including the
+// last line it wrote to standard error.
+func CommandExitError(command string, err error, stderr *CommandLogWriter) error {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		err = fmt.Errorf("exit code %d", exitErr.ExitCode())
+	}
+	if last := stderr.LastLine(); last != "" {
+		return fmt.Errorf("Command %s failed: %v (%s)", command, err, last)
+	}
+	return fmt.Errorf("Command %s failed: %v", command, err)
+}
+
+// ValidateCommand checks that command names an executable program.
+func ValidateCommand(command string) error {
+	if _, err := exec.LookPath(command); err != nil {
+		return fmt.Errorf("Command not found or not executable: %w. Remedy: Use the full path of the program in config.yaml and check that it is installed.", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package operation
+
+import (
+	"RestoreSafe/internal/util"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommandLogWriterLogsLinesAndKeepsLastLine(t *testing.T) {
+	t.Parallel()
+
+	logPath := filepath.Join(t.TempDir(), "command.log")
+	log, err := util.NewLogger(logPath, "info")
+	if err != nil {
+		t.Fatalf("failed to create logger: %v", err)
+	}
+	w := &CommandLogWriter{Log: log, Prefix: "  [dump] "}
+	if _, err := w.Write([]byte("first line\r\nsecond ")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if _, err := w.Write([]byte("line\n\nunterminated")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	w.Flush()
+	log.Close()
+
+	if got := w.LastLine(); got != "unterminated" {
+		t.Fatalf("expected last line %q, got %q", "unterminated", got)
+	}
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	for _, want := range []string{"[dump] first line", "[dump] second line", "[dump] unterminated"} {
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("expected log to contain %q, got:\n%s", want, data)
+		}
+	}
+}
+
+func TestCommandExitErrorIncludesLastStderrLine(t *testing.T) {
+	t.Parallel()
+
+	w := &CommandLogWriter{}
+	w.Write([]byte("pg_dump: error: connection refused\n")) //nolint:errcheck
+	err := CommandExitError("pg_dump", errors.New("exit status 1"), w)
+	if !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("expected stderr line in error, got: %v", err)
+	}
+}
+
+func TestFormatCommandQuotesArgumentsWithSpaces(t *testing.T) {
+	t.Parallel()
+
+	got := FormatCommand("C:/Program Files/pg_dump.exe", []string{"-Fc", "my db"})
+	if got != `"C:/Program Files/pg_dump.exe" -Fc "my db"` {
+		t.Fatalf("unexpected command line: %s", got)
+	}
+}
@@ -52,10 +52,7 @@ func RunDecryptPipeline(
 	decErr := <-decErrCh
 
 	if decErr != nil {
-		if errors.Is(decErr, security.ErrWrongPassword) {
-			return fmt.Errorf("%w. Remedy: Check the password; for YubiKey backups, the matching .challenge file must be in the same directory as the .enc files.", security.ErrWrongPassword)
-		}
-		return fmt.Errorf("Decryption failed: %w", decErr)
+		return wrapDecryptError(decErr)
 	}
 	if consumeErr != nil {
 		return fmt.Errorf("%s failed: %w", consumeFailurePrefix, consumeErr)
@@ -63,3 +60,11 @@ func RunDecryptPipeline(
 
 	return nil
 }
+
+// wrapDecryptError adds the user-facing remedy to errors returned by the decryption layer.
+func wrapDecryptError(err error) error {
+	if errors.Is(err, security.ErrWrongPassword) {
+		return fmt.Errorf("%w. Remedy: Check the password; for YubiKey backups, the matching .challenge file must be in the same directory as the .enc files.", security.ErrWrongPassword)
+	}
+	return fmt.Errorf("Decryption failed: %w", err)
+}
@@ -0,0 +1,84 @@
+package operation
+
+import (
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// RunDecryptReader decrypts selected parts on demand and passes a seekable
+// plaintext reader to consume. Unlike RunDecryptPipeline, data that consume
+// skips with Seek is neither read from disk nor decrypted, which makes this
+// variant the right choice when only a few archive entries are needed.
+// onPartStart is called whenever a part file is opened (1-based index, total count);
+// pass nil to skip per-part callbacks.
+func RunDecryptReader(
+	parts []string,
+	password []byte,
+	log *util.Logger,
+	directoryName string,
+	progressVerb string,
+	consumeFailurePrefix string,
+	consume func(io.ReadSeeker) error,
+	onPartStart func(partIndex, partCount int),
+) error {
+	seqReader := util.NewSequentialReader(parts)
+	defer seqReader.Close()
+
+	seqReader.SetOnFileOpen(onPartStart)
+
+	var inBytes atomic.Int64
+	var outBytes atomic.Int64
+	var outReadCalls atomic.Int64
+	stopProgress := StartProgressTracking(log, directoryName, progressVerb, &inBytes, &outBytes, &outReadCalls)
+	defer stopProgress()
+
+	decReader, err := security.NewDecryptReader(&countingReadSeeker{rs: seqReader, total: &inBytes}, password)
+	if err != nil {
+		return wrapDecryptError(err)
+	}
+
+	plaintext := &countingReadSeeker{rs: decReader, total: &outBytes, calls: &outReadCalls}
+	if err := consume(plaintext); err != nil {
+		// Decryption errors surface through the consumer; report them as such.
+		if plaintext.err != nil {
+			return wrapDecryptError(plaintext.err)
+		}
+		return fmt.Errorf("%s failed: %w", consumeFailurePrefix, err)
+	}
+
+	return nil
+}
+
+// countingReadSeeker tracks bytes read and remembers the first non-EOF read error.
+type countingReadSeeker struct {
+	rs    io.ReadSeeker
+	total *atomic.Int64
+	calls *atomic.Int64
+	err   error
+}
+
+func (c *countingReadSeeker) Read(p []byte) (int, error) {
+	if c.calls != nil {
+		c.calls.Add(1)
+	}
+	n, err := c.rs.Read(p)
+	if n > 0 {
+		c.total.Add(int64(n))
+	}
+	if err != nil && !errors.Is(err, io.EOF) && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
+
+func (c *countingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := c.rs.Seek(offset, whence)
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	return pos, err
+}
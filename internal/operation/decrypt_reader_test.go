@@ -0,0 +1,78 @@
+package operation
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRunDecryptReaderScansSelection(t *testing.T) {
+	t.Parallel()
+
+	fx := testutil.NewBackupFixture(t, []byte("correct-pass"))
+	parts, err := catalog.CollectParts(fx.BackupDir, fx.Entry)
+	if err != nil {
+		t.Fatalf("failed to collect parts: %v", err)
+	}
+	selector, err := util.NewPathSelector([]string{"nested"})
+	if err != nil {
+		t.Fatalf("NewPathSelector returned error: %v", err)
+	}
+
+	var stats util.TarSelectionStats
+	err = RunDecryptReader(
+		parts,
+		[]byte("correct-pass"),
+		nil,
+		fx.Entry.DirectoryName,
+		"scanned",
+		"File selection scan",
+		func(r io.ReadSeeker) error {
+			var scanErr error
+			stats, scanErr = util.ScanTarSelection(r, "", util.ExtractOptions{Selector: selector})
+			return scanErr
+		},
+		nil,
+	)
+	if err != nil {
+		t.Fatalf("expected successful scan, got: %v", err)
+	}
+	if stats.Files != 1 {
+		t.Fatalf("expected 1 matching file, got %d", stats.Files)
+	}
+}
+
+func TestRunDecryptReaderWrongPassword(t *testing.T) {
+	t.Parallel()
+
+	fx := testutil.NewBackupFixture(t, []byte("correct-pass"))
+	parts, err := catalog.CollectParts(fx.BackupDir, fx.Entry)
+	if err != nil {
+		t.Fatalf("failed to collect parts: %v", err)
+	}
+
+	err = RunDecryptReader(
+		parts,
+		[]byte("wrong-pass"),
+		nil,
+		fx.Entry.DirectoryName,
+		"scanned",
+		"File selection scan",
+		func(r io.ReadSeeker) error {
+			_, scanErr := util.ScanTarSelection(r, "", util.ExtractOptions{})
+			return scanErr
+		},
+		nil,
+	)
+	if !errors.Is(err, security.ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "Remedy:") {
+		t.Fatalf("expected remedy in wrong-password error, got: %v", err)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"RestoreSafe/internal/catalog"
 	"RestoreSafe/internal/security"
 	"RestoreSafe/internal/util"
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
@@ -24,10 +25,46 @@ func OpenLogger(cfg *util.Config, backupDir string, rep util.BackupEntry) *util.
 	return log
 }
 
+// LogIORetries logs the transient I/O errors retried since watch started and
+// returns the number of warnings to add to the summary: 1 if any was retried.
+func LogIORetries(watch *util.IORetryWatch, log *util.Logger) int {
+	totals := watch.Totals()
+	if totals.Retries == 0 {
+		return 0
+	}
+	log.Warn("I/O retries: %d retry(s) of transient errors, %d operation(s) recovered, %d failed", totals.Retries, totals.Recovered, totals.Failed)
+	return 1
+}
+
 func PromptStartAction(action string) (bool, error) {
+	return PromptConfirm(fmt.Sprintf("Start %s now?", action))
+}
+
+// ErrMediaNotInserted is returned by PromptMedia when the user stops instead of
+// inserting a medium.
+var ErrMediaNotInserted = errors.New("stopped by the user")
+
+// PromptMedia shows message, which asks for a removable medium, and waits until the
+// user presses Enter once it is inserted. Typing "stop" returns ErrMediaNotInserted.
+func PromptMedia(message string) error {
+	fmt.Println()
+	fmt.Println(message)
+	answer, err := readLineFn("Press Enter when the medium is ready, or type stop to cancel: ")
+	fmt.Println()
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(strings.TrimSpace(answer), "stop") {
+		return ErrMediaNotInserted
+	}
+	return nil
+}
+
+// PromptConfirm asks question until it is answered with yes or no; yes is the default.
+func PromptConfirm(question string) (bool, error) {
 	for {
 		fmt.Println()
-		answer, err := readLineFn(fmt.Sprintf("Start %s now? [Y/n]: ", action))
+		answer, err := readLineFn(question + " [Y/n]: ")
 		fmt.Println()
 		if err != nil {
 			return false, err
@@ -99,7 +136,7 @@ func ReadPasswordWithRetry(
 		}
 
 		if requiresYubiKey {
-			challengeHex, err := readChallengeFile(challengePath)
+			challengeHex, err := ReadChallengeFile(challengePath)
 			if err != nil {
 				security.ZeroBytes(password)
 				return nil, fmt.Errorf("YubiKey challenge file not found: %w. Remedy: Ensure the matching .challenge file is in the same directory as the .enc files.", err)
@@ -130,6 +167,12 @@ func ReadPasswordWithRetry(
 			security.ZeroBytes(password)
 			return nil, err
 		}
+		if len(parts) == 0 {
+			// A snapshot of the chunked repository is encrypted like a part.
+			if snapshotPath, found, err := catalog.FindSnapshotFile(backupDir, rep); err == nil && found {
+				parts = []string{snapshotPath}
+			}
+		}
 		if len(parts) > 0 {
 			if err := verifyPassword(parts[0], password); err == nil {
 				return password, nil // caller is responsible for zeroing
@@ -165,7 +208,7 @@ func ReadPasswordWithRetry(
 }
 
 func verifyPassword(partPath string, password []byte) error {
-	f, err := os.Open(partPath)
+	f, err := util.StorageFor(partPath).Open(partPath)
 	if err != nil {
 		return fmt.Errorf("Failed to open file: %w", err)
 	}
@@ -202,12 +245,12 @@ func (vw *verifyWriter) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
-// readChallengeFile reads the challenge hex from a .challenge file.
+// ReadChallengeFile reads the challenge hex from a .challenge file.
 // It strips the "NOPW:" prefix used by YubiKey-only backups so the caller
 // always receives a plain hex string suitable for CombineWithPasswordForRestore.
 // The content is validated: it must be non-empty, valid hex, and the correct length.
-func readChallengeFile(path string) (string, error) {
-	data, err := os.ReadFile(path)
+func ReadChallengeFile(path string) (string, error) {
+	data, err := util.ReadStorageFile(path)
 	if err != nil {
 		return "", err
 	}
@@ -221,3 +264,29 @@ func readChallengeFile(path string) (string, error) {
 	}
 	return content, nil
 }
+
+// PasswordEnv names the environment variable non-interactive runs read the password from.
+const PasswordEnv = "RESTORESAFE_PASSWORD"
+
+// ReadPasswordNonInteractive returns the password for a run that cannot prompt, for
+// example because standard input carries the data: the content of passwordFile if set,
+// otherwise the value of PasswordEnv. A trailing line break is removed.
+func ReadPasswordNonInteractive(passwordFile string) ([]byte, error) {
+	var password []byte
+	if passwordFile != "" {
+		data, err := os.ReadFile(passwordFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read password file: %w. Remedy: Check the -password-file path and its read permissions.", err)
+		}
+		password = data
+	} else if value, ok := os.LookupEnv(PasswordEnv); ok {
+		password = []byte(value)
+	} else {
+		return nil, fmt.Errorf("No password available: standard input is used for data. Remedy: Pass -password-file=<path> or set the environment variable %s.", PasswordEnv)
+	}
+	password = bytes.TrimRight(password, "\r\n")
+	if len(password) == 0 {
+		return nil, fmt.Errorf("Password must not be empty.")
+	}
+	return password, nil
+}
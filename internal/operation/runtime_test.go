@@ -63,9 +63,9 @@ func TestReadChallengeFileTrimsWhitespace(t *testing.T) {
 		t.Fatalf("failed to write challenge file: %v", err)
 	}
 
-	challenge, err := readChallengeFile(challengePath)
+	challenge, err := ReadChallengeFile(challengePath)
 	if err != nil {
-		t.Fatalf("readChallengeFile returned error: %v", err)
+		t.Fatalf("ReadChallengeFile returned error: %v", err)
 	}
 	if challenge != valid {
 		t.Fatalf("expected trimmed challenge, got %q", challenge)
@@ -80,7 +80,7 @@ func TestReadChallengeFileAcceptsNOPWPrefix(t *testing.T) {
 		t.Fatalf("failed to write challenge file: %v", err)
 	}
 
-	challenge, err := readChallengeFile(challengePath)
+	challenge, err := ReadChallengeFile(challengePath)
 	if err != nil {
 		t.Fatalf("expected no error for NOPW: prefix, got: %v", err)
 	}
@@ -97,7 +97,7 @@ func TestReadChallengeFileRejectsEmpty(t *testing.T) {
 		t.Fatalf("failed to write challenge file: %v", err)
 	}
 
-	_, err := readChallengeFile(challengePath)
+	_, err := ReadChallengeFile(challengePath)
 	if err == nil || !strings.Contains(err.Error(), "empty") {
 		t.Fatalf("expected empty-file error, got: %v", err)
 	}
@@ -111,7 +111,7 @@ func TestReadChallengeFileRejectsNonHex(t *testing.T) {
 		t.Fatalf("failed to write challenge file: %v", err)
 	}
 
-	_, err := readChallengeFile(challengePath)
+	_, err := ReadChallengeFile(challengePath)
 	if err == nil || !strings.Contains(err.Error(), "invalid format") {
 		t.Fatalf("expected invalid-format error, got: %v", err)
 	}
@@ -125,7 +125,7 @@ func TestReadChallengeFileRejectsWrongLength(t *testing.T) {
 		t.Fatalf("failed to write challenge file: %v", err)
 	}
 
-	_, err := readChallengeFile(challengePath)
+	_, err := ReadChallengeFile(challengePath)
 	if err == nil || !strings.Contains(err.Error(), "invalid format") {
 		t.Fatalf("expected invalid-format error for short hex, got: %v", err)
 	}
@@ -265,3 +265,25 @@ func TestPromptStartActionPrintsSingleBlankLineOnRetry(t *testing.T) {
 		t.Fatalf("unexpected stdout.\nexpected: %q\n     got: %q", expected, got)
 	}
 }
+
+func TestReadPasswordNonInteractivePrefersFileOverEnvironment(t *testing.T) {
+	t.Setenv(PasswordEnv, "from-env")
+	passwordFile := filepath.Join(t.TempDir(), "password.txt")
+	if err := os.WriteFile(passwordFile, []byte("from-file\r\n"), 0o600); err != nil {
+		t.Fatalf("failed to write password file: %v", err)
+	}
+
+	password, err := ReadPasswordNonInteractive(passwordFile)
+	if err != nil || string(password) != "from-file" {
+		t.Fatalf("expected the password file without line break, got %q, %v", password, err)
+	}
+	password, err = ReadPasswordNonInteractive("")
+	if err != nil || string(password) != "from-env" {
+		t.Fatalf("expected the password from %s, got %q, %v", PasswordEnv, password, err)
+	}
+
+	os.Unsetenv(PasswordEnv) //nolint:errcheck
+	if _, err := ReadPasswordNonInteractive(""); err == nil || !strings.Contains(err.Error(), PasswordEnv) {
+		t.Fatalf("expected an error naming %s, got %v", PasswordEnv, err)
+	}
+}
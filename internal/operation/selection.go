@@ -68,6 +68,37 @@ func PromptBackupSelection(action, backupDir string, index []util.BackupEntry) (
 	}
 }
 
+// ResolveBackupSelection resolves a selection passed as an argument, using the same
+// syntax as the interactive prompt: a dot for the newest backup set, a backup ID, or a
+// full backup name. A warning is printed when a backup ID exists on several dates.
+func ResolveBackupSelection(backupDir string, index []util.BackupEntry, selection string) ([]util.BackupEntry, string, error) {
+	selection = strings.TrimSpace(selection)
+	if selection == "" {
+		return nil, "", fmt.Errorf("Backup selection must not be empty. Remedy: Pass a dot (.), a backup ID or a full backup name.")
+	}
+	if selection == "." {
+		return catalog.ResolveNewestBackupRunSelection(backupDir, index)
+	}
+
+	normalized := strings.ToUpper(selection)
+	if catalog.IsRawBackupID(normalized) {
+		selected, newestDate, allDates, found := catalog.ResolveSelectionForIDNewestDate(normalized, index)
+		if !found {
+			return nil, "", fmt.Errorf("Backup %q not found. Remedy: Check the backup ID in the backup directory.", normalized)
+		}
+		if len(allDates) > 1 {
+			fmt.Printf("Warning: Backup ID %s exists on multiple dates (%s). Using newest date %s. Remedy: Pass a full backup name if you want a specific date.\n\n", normalized, strings.Join(allDates, ", "), newestDate)
+		}
+		return selected, normalized, nil
+	}
+
+	selected, err := catalog.ResolveSelection(selection, index)
+	if err != nil {
+		return nil, "", err
+	}
+	return selected, selection, nil
+}
+
 func printBackupSelectionPrompt(action, backupDir string, index []util.BackupEntry) error {
 	fmt.Println("Available backups:")
 	runs, err := catalog.BackupRunSummaries(backupDir, index)
@@ -98,6 +129,10 @@ func completedActionLabel(action string) string {
 		return "restored"
 	case "verify":
 		return "verified"
+	case "consolidate":
+		return "consolidated"
+	case "copy":
+		return "copied"
 	default:
 		return action + "ed"
 	}
@@ -256,3 +256,32 @@ func TestPromptBackupSelectionUnknownNamePrintsError(t *testing.T) {
 		t.Fatal("expected some output for unknown selection input")
 	}
 }
+
+func TestResolveBackupSelectionByIDAndName(t *testing.T) {
+	t.Parallel()
+
+	index := []util.BackupEntry{
+		{DirectoryName: "Docs", Date: "2026-03-14", ID: util.BackupID("ABC123")},
+		{DirectoryName: "Photos", Date: "2026-03-14", ID: util.BackupID("ABC123")},
+	}
+
+	selected, label, err := ResolveBackupSelection(t.TempDir(), index, "abc123")
+	if err != nil {
+		t.Fatalf("ResolveBackupSelection by ID returned error: %v", err)
+	}
+	if len(selected) != 2 || label != "ABC123" {
+		t.Fatalf("expected both entries for ID selection, got %d (label %q)", len(selected), label)
+	}
+
+	selected, _, err = ResolveBackupSelection(t.TempDir(), index, "Photos_2026-03-14_ABC123")
+	if err != nil {
+		t.Fatalf("ResolveBackupSelection by name returned error: %v", err)
+	}
+	if len(selected) != 1 || selected[0].DirectoryName != "Photos" {
+		t.Fatalf("expected Photos entry, got %v", selected)
+	}
+
+	if _, _, err := ResolveBackupSelection(t.TempDir(), index, "ZZZ999"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("expected not-found error for unknown ID, got: %v", err)
+	}
+}
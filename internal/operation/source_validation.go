@@ -21,7 +21,7 @@ func InspectSourceDirectoriesForValidation(sourceDirectories []string, exeDir st
 		resolved := util.ResolveDir(src, exeDir)
 		status := SourceValidationStatus{Resolved: resolved}
 
-		status.Err = util.ValidateSourceDirectory(resolved)
+		status.Err = util.ValidateSource(resolved)
 		statuses = append(statuses, status)
 	}
 
@@ -27,8 +27,8 @@ func TestInspectSourceDirectoriesForValidationReportsDirectoryErrors(t *testing.
 	if statuses[0].Err != nil {
 		t.Fatalf("expected first source to be valid, got error: %v", statuses[0].Err)
 	}
-	if statuses[1].Err == nil {
-		t.Fatal("expected non-directory path to fail")
+	if statuses[1].Err != nil {
+		t.Fatalf("expected file path to be accepted as a single-file source, got error: %v", statuses[1].Err)
 	}
 	if statuses[2].Err == nil {
 		t.Fatal("expected missing path to fail")
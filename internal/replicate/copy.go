@@ -0,0 +1,196 @@
+package replicate
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/util"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// copySet copies the files of item that the target does not hold yet and returns
+// the number of files copied. The sidecar files are copied before the parts, so a
+// set listed in the target can always be decrypted once its last part is there;
+// likewise the repository files are copied before a snapshot.
+func copySet(item syncPreflightItem, backupDir, target string, log *util.Logger) (int, error) {
+	copied := 0
+	for _, f := range item.pending() {
+		if dir := filepath.Dir(f.Name); dir != "." {
+			if err := util.StorageFor(target).MkdirAll(filepath.Join(target, dir)); err != nil {
+				return copied, err
+			}
+		}
+		if err := copyVerified(filepath.Join(backupDir, f.Name), filepath.Join(target, f.Name)); err != nil {
+			return copied, err
+		}
+		log.Debug("  Copied and verified: %s", filepath.ToSlash(f.Name))
+		copied++
+	}
+	log.Info("  %d file(s) copied and verified (%s)", copied, util.FormatBytesBinary(uint64(item.pendingBytes())))
+	return copied, nil
+}
+
+// copyVerified copies src to a temporary file next to dst, compares the SHA-256
+// checksums of both files and only then renames the copy to dst, so dst is either
+// missing or a verified copy.
+func copyVerified(src, dst string) error {
+	tmp := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".sync.tmp")
+	if err := util.CopyFile(src, tmp); err != nil {
+		util.StorageFor(tmp).Remove(tmp) //nolint:errcheck
+		return err
+	}
+	want, err := fileSHA256(src)
+	if err == nil {
+		var got []byte
+		if got, err = fileSHA256(tmp); err == nil && !bytes.Equal(got, want) {
+			err = fmt.Errorf("Checksum of the copy of %q does not match the original. Remedy: Check the target storage and start the sync again.", filepath.Base(src))
+		}
+	}
+	if err == nil {
+		err = util.StorageFor(tmp).Rename(tmp, dst)
+	}
+	if err != nil {
+		util.StorageFor(tmp).Remove(tmp) //nolint:errcheck
+		return err
+	}
+	return nil
+}
+
+func fileSHA256(path string) ([]byte, error) {
+	f, err := util.StorageFor(path).Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %q for verification: %w", path, err)
+	}
+	defer f.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, f); err != nil {
+		return nil, fmt.Errorf("Failed to read %q for verification: %w", path, err)
+	}
+	return sum.Sum(nil), nil
+}
+
+// findStaleEntries returns the backup sets in target that a sync copied from
+// backupDir, according to record, but that are no longer in index, typically
+// because retention deleted them from the backup directory. Sets that were not
+// copied from backupDir, such as the backups of another installation, and sets of
+// incomplete runs are left alone; cleanup-incomplete deletes the latter. Deleting a
+// snapshot keeps the repository files, as removing unused packs needs the password.
+func findStaleEntries(index []util.BackupEntry, record syncRecord, backupDir, target string) ([]util.BackupEntry, error) {
+	targetIndex, err := catalog.ScanBackups(target)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	current := make(map[util.BackupEntry]bool, len(index))
+	directoryNames := make(map[string]bool)
+	for _, entry := range index {
+		current[entry] = true
+		directoryNames[entry.DirectoryName] = true
+	}
+	var stale []util.BackupEntry
+	for _, entry := range catalog.SortedEntries(targetIndex) {
+		if directoryNames[entry.DirectoryName] && !current[entry] && record.copiedFrom(entry, backupDir) {
+			stale = append(stale, entry)
+		}
+	}
+	return stale, nil
+}
+
+// removeSet deletes the parts or the snapshot of entry and its sidecar files from
+// dir and returns the number of files deleted. Once no set of the run is left in
+// dir, its run markers are deleted as well.
+func removeSet(dir string, entry util.BackupEntry) (int, error) {
+	paths, err := catalog.CollectParts(dir, entry)
+	if err != nil {
+		return 0, err
+	}
+	paths = append(paths,
+		util.ChallengeFileName(dir, entry.DirectoryName, entry.Date, entry.ID),
+		util.ManifestFileName(dir, entry.DirectoryName, entry.Date, entry.ID),
+		util.RunInfoFileName(dir, entry.DirectoryName, entry.Date, entry.ID),
+		util.SnapshotFileName(dir, entry.DirectoryName, entry.Date, entry.ID),
+	)
+	removed := 0
+	for _, path := range paths {
+		if err := util.StorageFor(path).Remove(path); err == nil {
+			removed++
+		} else if !os.IsNotExist(err) {
+			return removed, err
+		}
+	}
+
+	index, err := catalog.ScanBackups(dir)
+	if err != nil {
+		return removed, err
+	}
+	incomplete, err := catalog.FindIncompleteRuns(dir)
+	if err != nil {
+		return removed, err
+	}
+	for _, run := range incomplete {
+		index = append(index, run.Entries...)
+	}
+	for _, other := range index {
+		if other.RunKey() == entry.RunKey() {
+			return removed, nil
+		}
+	}
+	for _, marker := range []string{
+		util.IncompleteRunFileName(dir, entry.Date, entry.ID),
+		util.CompleteRunFileName(dir, entry.Date, entry.ID),
+		util.CheckpointFileName(dir, entry.Date, entry.ID),
+	} {
+		if err := util.StorageFor(marker).Remove(marker); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// completeRuns marks every run in target as complete whose sets were all copied by
+// this sync, such as a run that failed in a second backup directory: the
+// completion marker of the run is copied from backupDir and the incomplete-run
+// marker in target is deleted. Runs from before run markers have no completion
+// marker to copy and only lose their incomplete-run marker.
+func completeRuns(items []syncPreflightItem, index []util.BackupEntry, backupDir, target string, log *util.Logger) {
+	synced := make(map[util.BackupEntry]bool)
+	for _, item := range items {
+		if item.Err == nil && item.Reason == "" {
+			synced[item.Entry] = true
+		}
+	}
+	complete := make(map[string]bool)
+	for _, item := range items {
+		complete[item.Entry.RunKey()] = true
+	}
+	for _, entry := range index {
+		if _, ok := complete[entry.RunKey()]; ok && !synced[entry] {
+			complete[entry.RunKey()] = false
+		}
+	}
+	for _, item := range items {
+		if !complete[item.Entry.RunKey()] {
+			continue
+		}
+		complete[item.Entry.RunKey()] = false
+		date, id := item.Entry.Date, item.Entry.ID
+		completion := util.CompleteRunFileName(backupDir, date, id)
+		if fileExists(completion) {
+			if err := copyVerified(completion, util.CompleteRunFileName(target, date, id)); err != nil {
+				log.Warn("Could not copy %s to the target: %v", filepath.Base(completion), err)
+				continue
+			}
+		}
+		marker := util.IncompleteRunFileName(target, date, id)
+		if err := util.StorageFor(marker).Remove(marker); err == nil {
+			log.Info("Run %s_%s is complete in the target again: deleted %s", date, string(id), filepath.Base(marker))
+		} else if !os.IsNotExist(err) {
+			log.Warn("Could not delete %s from the target: %v", filepath.Base(marker), err)
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package replicate
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/repository"
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// corruptingStorage is a MemoryStorage that flips the first byte of every file written.
+type corruptingStorage struct {
+	*util.MemoryStorage
+}
+
+func (s corruptingStorage) Create(p string) (util.StorageWriter, error) {
+	w, err := s.MemoryStorage.Create(p)
+	if err != nil {
+		return nil, err
+	}
+	return &corruptingWriter{StorageWriter: w}, nil
+}
+
+type corruptingWriter struct {
+	util.StorageWriter
+	started bool
+}
+
+func (w *corruptingWriter) Write(p []byte) (int, error) {
+	if !w.started && len(p) > 0 {
+		w.started = true
+		p = append([]byte{p[0] ^ 0xff}, p[1:]...)
+	}
+	return w.StorageWriter.Write(p)
+}
+
+func createSyncBackup(t *testing.T, backupDir string, entry util.BackupEntry) {
+	t.Helper()
+	testutil.CreateBackupInDir(t, backupDir, entry, []byte("sync-password"))
+	if err := os.WriteFile(util.ChallengeFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID), []byte("challenge"), 0o600); err != nil {
+		t.Fatalf("failed to write challenge file: %v", err)
+	}
+	if err := catalog.WriteRunInfo(backupDir, entry, catalog.RunInfo{}); err != nil {
+		t.Fatalf("failed to write run info: %v", err)
+	}
+}
+
+func TestCopySetCopiesMissingFilesAndSkipsPresentSets(t *testing.T) {
+	t.Parallel()
+
+	backupDir := t.TempDir()
+	entry := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-20", ID: "SYN001"}
+	createSyncBackup(t, backupDir, entry)
+	target := "mem://" + t.Name()
+	t.Cleanup(util.MountStorage(target, util.NewMemoryStorage()))
+
+	items := buildSyncPreflight([]util.BackupEntry{entry}, backupDir, target)
+	if items[0].Err != nil || len(items[0].pending()) != 3 || !strings.HasSuffix(items[0].Files[0].Name, ".challenge") {
+		t.Fatalf("expected the challenge, run info and part to be pending, got %+v", items[0])
+	}
+	copied, err := copySet(items[0], backupDir, target, util.NewConsoleLogger("info"))
+	if err != nil || copied != 3 {
+		t.Fatalf("copySet returned %d, %v", copied, err)
+	}
+
+	parts, err := catalog.CollectParts(target, entry)
+	if err != nil || len(parts) != 1 {
+		t.Fatalf("expected the part in the target, got %v, %v", parts, err)
+	}
+	want, err := os.ReadFile(util.PartFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID, 1))
+	if err != nil {
+		t.Fatalf("failed to read the original part: %v", err)
+	}
+	if got, err := util.ReadStorageFile(parts[0]); err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("expected an identical copy of the part, got %d bytes, %v", len(got), err)
+	}
+	entries, err := util.StorageFor(target).List(target)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("expected no temporary files in the target, got %v, %v", entries, err)
+	}
+
+	items = buildSyncPreflight([]util.BackupEntry{entry}, backupDir, target)
+	if items[0].Err != nil || len(items[0].pending()) != 0 || countPending(items) != 0 {
+		t.Fatalf("expected the set to be present in the target, got %+v", items[0])
+	}
+}
+
+func TestCopyVerifiedRejectsCorruptedCopy(t *testing.T) {
+	t.Parallel()
+
+	src := filepath.Join(t.TempDir(), "part.enc")
+	if err := os.WriteFile(src, []byte("encrypted data"), 0o600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	target := "mem://" + t.Name()
+	t.Cleanup(util.MountStorage(target, corruptingStorage{util.NewMemoryStorage()}))
+	if err := util.StorageFor(target).MkdirAll(target); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+
+	err := copyVerified(src, target+"/part.enc")
+	if err == nil || !strings.Contains(err.Error(), "Checksum") {
+		t.Fatalf("expected a checksum error, got %v", err)
+	}
+	if entries, err := util.StorageFor(target).List(target); err != nil || len(entries) != 0 {
+		t.Fatalf("expected neither the copy nor its temporary file in the target, got %v, %v", entries, err)
+	}
+}
+
+func TestBuildSyncPreflightSkipsIncompleteRuns(t *testing.T) {
+	t.Parallel()
+
+	backupDir := t.TempDir()
+	incomplete := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-20", ID: "INC001"}
+	createSyncBackup(t, backupDir, incomplete)
+	if err := os.WriteFile(util.IncompleteRunFileName(backupDir, incomplete.Date, incomplete.ID), nil, 0o600); err != nil {
+		t.Fatalf("failed to write marker: %v", err)
+	}
+
+	items := buildSyncPreflight([]util.BackupEntry{incomplete}, backupDir, t.TempDir())
+	if len(items) != 1 || items[0].Reason == "" || items[0].Err != nil {
+		t.Fatalf("expected the incomplete run to be skipped, got %+v", items)
+	}
+	if countPending(items) != 0 || pendingBytes(items) != 0 {
+		t.Fatal("expected nothing to copy")
+	}
+}
+
+func TestSyncCopiesSnapshotsWithTheirRepository(t *testing.T) {
+	t.Parallel()
+
+	backupDir := t.TempDir()
+	password := []byte("sync-password")
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), bytes.Repeat([]byte("alpha"), 1000), 0o600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	first := util.BackupEntry{DirectoryName: "Mail", Date: "2026-03-19", ID: "SNP001"}
+	second := util.BackupEntry{DirectoryName: "Mail", Date: "2026-03-20", ID: "SNP002"}
+	testutil.CreateSnapshotBackup(t, srcDir, backupDir, first, password)
+	testutil.CreateSnapshotBackup(t, srcDir, backupDir, second, password)
+	target := t.TempDir()
+
+	items := buildSyncPreflight([]util.BackupEntry{first, second}, backupDir, target)
+	if len(items) != 2 || countPending(items) != 2 {
+		t.Fatalf("expected both snapshots to be copied, got %+v", items)
+	}
+	// The repository is copied once, before the first snapshot.
+	names := make(map[string]int)
+	for _, item := range items {
+		for _, f := range item.Files {
+			names[filepath.ToSlash(f.Name)]++
+		}
+		if last := item.Files[len(item.Files)-1].Name; !strings.HasSuffix(last, ".snapshot.enc") {
+			t.Fatalf("expected the snapshot to be copied last, got %s", last)
+		}
+	}
+	if names[util.RepositoryDirName+"/keys.enc"] != 1 || len(names) < 5 {
+		t.Fatalf("expected the keys, packs and indexes once, got %v", names)
+	}
+	for _, item := range items {
+		if _, err := copySet(item, backupDir, target, util.NewConsoleLogger("info")); err != nil {
+			t.Fatalf("copySet failed: %v", err)
+		}
+	}
+
+	index, err := catalog.ScanBackups(target)
+	if err != nil || len(index) != 2 || !catalog.IsSnapshot(target, index[0]) {
+		t.Fatalf("expected both snapshots in the target, got %v, %v", index, err)
+	}
+	source, err := repository.Open(backupDir, password)
+	if err != nil {
+		t.Fatalf("failed to open the source repository: %v", err)
+	}
+	defer source.Close()
+	copied, err := repository.Open(target, password)
+	if err != nil {
+		t.Fatalf("failed to open the copied repository: %v", err)
+	}
+	defer copied.Close()
+	if copied.ChunkCount() == 0 || copied.ChunkCount() != source.ChunkCount() {
+		t.Fatalf("expected %d chunks in the copy, got %d", source.ChunkCount(), copied.ChunkCount())
+	}
+	if countPending(buildSyncPreflight([]util.BackupEntry{first, second}, backupDir, target)) != 0 {
+		t.Fatal("expected nothing left to copy")
+	}
+
+	// -mirror deletes a snapshot that retention removed and keeps the repository.
+	record := syncRecord{Sets: make(map[string]string)}
+	record.add(first, backupDir)
+	record.add(second, backupDir)
+	stale, err := findStaleEntries([]util.BackupEntry{second}, record, backupDir, target)
+	if err != nil || len(stale) != 1 || stale[0] != first {
+		t.Fatalf("expected the first snapshot to be stale, got %v, %v", stale, err)
+	}
+	if _, err := removeSet(target, first); err != nil {
+		t.Fatalf("removeSet failed: %v", err)
+	}
+	if catalog.IsSnapshot(target, first) || !repository.Exists(target) {
+		t.Fatal("expected the snapshot to be deleted and the repository to be kept")
+	}
+}
+
+func TestBuildSyncPreflightRefusesSnapshotsForOtherRepository(t *testing.T) {
+	t.Parallel()
+
+	backupDir := t.TempDir()
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("alpha"), 0o600); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+	snapshot := util.BackupEntry{DirectoryName: "Mail", Date: "2026-03-20", ID: "SNP003"}
+	testutil.CreateSnapshotBackup(t, srcDir, backupDir, snapshot, []byte("sync-password"))
+	target := t.TempDir()
+	testutil.CreateSnapshotBackup(t, srcDir, target, util.BackupEntry{DirectoryName: "Mail", Date: "2026-03-18", ID: "SNP004"}, []byte("other-password"))
+
+	items := buildSyncPreflight([]util.BackupEntry{snapshot}, backupDir, target)
+	if len(items) != 1 || !strings.Contains(items[0].Reason, "other keys") {
+		t.Fatalf("expected the snapshot to be refused, got %+v", items)
+	}
+}
+
+func TestSyncOfIncrementalSetCopiesItsChain(t *testing.T) {
+	t.Parallel()
+
+	backupDir := t.TempDir()
+	full := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-18", ID: "FUL001"}
+	middle := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-19", ID: "INC001"}
+	latest := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-20", ID: "INC002"}
+	for _, entry := range []util.BackupEntry{full, middle, latest} {
+		createSyncBackup(t, backupDir, entry)
+	}
+	for child, parent := range map[util.BackupEntry]util.BackupEntry{middle: full, latest: middle} {
+		if err := catalog.WriteRunInfo(backupDir, child, catalog.NewIncrementalRunInfo(parent)); err != nil {
+			t.Fatalf("failed to write run info: %v", err)
+		}
+	}
+	target := t.TempDir()
+
+	items := buildSyncPreflight([]util.BackupEntry{latest}, backupDir, target)
+	if len(items) != 3 || items[0].Entry != full || items[1].Entry != middle || items[2].Entry != latest {
+		t.Fatalf("expected the chain full, middle, latest, got %+v", items)
+	}
+	if items[0].ParentOf == nil || *items[0].ParentOf != latest || items[2].ParentOf != nil {
+		t.Fatalf("expected the parents to be marked as needed by the selected set, got %+v", items)
+	}
+	for _, item := range items {
+		if item.Reason != "" || item.Err != nil {
+			t.Fatalf("expected %s to be copied, got %+v", item.Entry.String(), item)
+		}
+		if _, err := copySet(item, backupDir, target, util.NewConsoleLogger("info")); err != nil {
+			t.Fatalf("copySet failed: %v", err)
+		}
+	}
+
+	chain, err := catalog.ResolveChain(target, latest)
+	if err != nil || len(chain) != 3 {
+		t.Fatalf("expected the whole chain in the target, got %v, %v", chain, err)
+	}
+	var out bytes.Buffer
+	printSyncPreflight(&out, &util.Config{LogLevel: "info"}, backupDir, settings{target: target}, buildSyncPreflight([]util.BackupEntry{latest}, backupDir, target), nil)
+	if strings.Count(out.String(), "(already in the target)") != 3 {
+		t.Fatalf("expected the copied chain to be in the target, got:\n%s", out.String())
+	}
+}
+
+func TestBuildSyncPreflightRefusesSetWhoseParentCannotBeCopied(t *testing.T) {
+	t.Parallel()
+
+	backupDir := t.TempDir()
+	full := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-18", ID: "FUL002"}
+	incremental := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-20", ID: "INC003"}
+	for _, entry := range []util.BackupEntry{full, incremental} {
+		createSyncBackup(t, backupDir, entry)
+	}
+	if err := catalog.WriteRunInfo(backupDir, incremental, catalog.NewIncrementalRunInfo(full)); err != nil {
+		t.Fatalf("failed to write run info: %v", err)
+	}
+	if err := os.WriteFile(util.IncompleteRunFileName(backupDir, full.Date, full.ID), nil, 0o600); err != nil {
+		t.Fatalf("failed to write marker: %v", err)
+	}
+
+	items := buildSyncPreflight([]util.BackupEntry{incremental}, backupDir, t.TempDir())
+	if len(items) != 2 || items[1].Entry != incremental || !strings.Contains(items[1].Reason, full.String()) {
+		t.Fatalf("expected the incremental set to be refused because of its parent, got %+v", items)
+	}
+	if countPending(items) != 0 {
+		t.Fatal("expected nothing to copy")
+	}
+}
+
+func TestMirrorDeletesSetsRemovedFromBackupDirectory(t *testing.T) {
+	t.Parallel()
+
+	backupDir := `C:\Backups`
+	target := t.TempDir()
+	kept := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-20", ID: "NEW001"}
+	expired := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-01", ID: "OLD001"}
+	foreign := util.BackupEntry{DirectoryName: "Photos", Date: "2026-03-01", ID: "OLD001"}
+	for _, entry := range []util.BackupEntry{kept, expired, foreign} {
+		createSyncBackup(t, target, entry)
+	}
+	if err := os.WriteFile(util.CompleteRunFileName(target, expired.Date, expired.ID), nil, 0o600); err != nil {
+		t.Fatalf("failed to write marker: %v", err)
+	}
+	record := syncRecord{Sets: make(map[string]string)}
+	for _, entry := range []util.BackupEntry{kept, expired, foreign} {
+		record.add(entry, "C:/Backups")
+	}
+
+	stale, err := findStaleEntries([]util.BackupEntry{kept}, record, backupDir, target)
+	if err != nil || len(stale) != 1 || stale[0] != expired {
+		t.Fatalf("expected only the expired set of a known directory, got %v, %v", stale, err)
+	}
+	removed, err := removeSet(target, expired)
+	if err != nil || removed != 3 {
+		t.Fatalf("removeSet returned %d, %v", removed, err)
+	}
+	// The run is still held by the Photos set, so its marker stays.
+	if _, err := os.Stat(util.CompleteRunFileName(target, expired.Date, expired.ID)); err != nil {
+		t.Fatalf("expected the marker to stay while the run has sets: %v", err)
+	}
+	if _, err := removeSet(target, foreign); err != nil {
+		t.Fatalf("removeSet returned %v", err)
+	}
+	if _, err := os.Stat(util.CompleteRunFileName(target, expired.Date, expired.ID)); !os.IsNotExist(err) {
+		t.Fatalf("expected the marker to be deleted with the last set of the run, got %v", err)
+	}
+
+	index, err := catalog.ScanBackups(target)
+	if err != nil || len(index) != 1 || index[0] != kept {
+		t.Fatalf("expected only the kept set in the target, got %v, %v", index, err)
+	}
+}
+
+func TestMirrorKeepsSetsNotCopiedFromBackupDirectory(t *testing.T) {
+	t.Parallel()
+
+	backupDir := t.TempDir()
+	target := t.TempDir()
+	kept := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-20", ID: "NEW001"}
+	unrecorded := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-01", ID: "OWN001"}
+	otherSource := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-02", ID: "OTH001"}
+	incomplete := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-03", ID: "INC001"}
+	for _, entry := range []util.BackupEntry{kept, unrecorded, otherSource, incomplete} {
+		createSyncBackup(t, target, entry)
+	}
+	if err := os.WriteFile(util.IncompleteRunFileName(target, incomplete.Date, incomplete.ID), nil, 0o600); err != nil {
+		t.Fatalf("failed to write marker: %v", err)
+	}
+	record := syncRecord{Sets: make(map[string]string)}
+	record.add(kept, backupDir)
+	record.add(otherSource, t.TempDir())
+	record.add(incomplete, backupDir)
+	if err := record.write(target); err != nil {
+		t.Fatalf("failed to write the sync record: %v", err)
+	}
+	record, err := readSyncRecord(target)
+	if err != nil || !record.copiedFrom(kept, backupDir) || record.copiedFrom(otherSource, backupDir) {
+		t.Fatalf("unexpected sync record %+v, %v", record, err)
+	}
+
+	stale, err := findStaleEntries([]util.BackupEntry{kept}, record, backupDir, target)
+	if err != nil || len(stale) != 0 {
+		t.Fatalf("expected no set to delete, got %v, %v", stale, err)
+	}
+}
+
+func TestCompleteRunsCopiesCompletionMarkerAfterCompleteRun(t *testing.T) {
+	t.Parallel()
+
+	backupDir, target := t.TempDir(), t.TempDir()
+	docs := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-20", ID: "RUN001"}
+	mail := util.BackupEntry{DirectoryName: "Mail", Date: "2026-03-20", ID: "RUN001"}
+	if err := catalog.MarkRunComplete(backupDir, docs.Date, docs.ID); err != nil {
+		t.Fatalf("MarkRunComplete failed: %v", err)
+	}
+	marker := util.IncompleteRunFileName(target, docs.Date, docs.ID)
+	if err := os.WriteFile(marker, nil, 0o600); err != nil {
+		t.Fatalf("failed to write marker: %v", err)
+	}
+	index := []util.BackupEntry{docs, mail}
+	log := util.NewConsoleLogger("info")
+
+	completeRuns([]syncPreflightItem{{Entry: docs}}, index, backupDir, target, log)
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatalf("expected the marker to stay while a set of the run was not copied: %v", err)
+	}
+	completeRuns([]syncPreflightItem{{Entry: docs}, {Entry: mail}}, index, backupDir, target, log)
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Fatalf("expected the marker to be deleted, got %v", err)
+	}
+	if _, err := os.Stat(util.CompleteRunFileName(target, docs.Date, docs.ID)); err != nil {
+		t.Fatalf("expected the completion marker in the target: %v", err)
+	}
+}
@@ -0,0 +1,302 @@
+package replicate
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/repository"
+	"RestoreSafe/internal/util"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// syncFile is a file of a backup set and whether the target already holds it.
+type syncFile struct {
+	// Name is the path of the file relative to the backup directory.
+	Name    string
+	Size    int64
+	Present bool
+}
+
+type syncPreflightItem struct {
+	Entry util.BackupEntry
+	// Files lists the sidecar files of the set followed by its parts. For a snapshot,
+	// the files of the chunked repository come first (see repositoryFiles).
+	Files []syncFile
+	// Reason explains why the set is not copied; empty for sets that are.
+	Reason string
+	Err    error
+	// ParentOf is the selected incremental set that needs this set, which was not
+	// selected itself, to be restored.
+	ParentOf *util.BackupEntry
+}
+
+// pending returns the files the target does not hold yet.
+func (item syncPreflightItem) pending() []syncFile {
+	var files []syncFile
+	for _, f := range item.Files {
+		if !f.Present {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+func (item syncPreflightItem) pendingBytes() int64 {
+	var total int64
+	for _, f := range item.pending() {
+		total += f.Size
+	}
+	return total
+}
+
+// buildSyncPreflight compares the selected sets with target. The parents of an
+// incremental set are added before it, so the target holds everything needed to
+// restore it; a set whose chain cannot be copied completely is refused. The files
+// of the chunked repository are copied with the first snapshot.
+func buildSyncPreflight(selected []util.BackupEntry, backupDir, target string) []syncPreflightItem {
+	items := make([]syncPreflightItem, 0, len(selected))
+	planned := make(map[util.BackupEntry]int)
+	repositoryPlanned := false
+	for _, entry := range selected {
+		if _, ok := planned[entry]; ok {
+			continue
+		}
+		item := planSet(backupDir, target, entry)
+		if item.Reason == "" && item.Err == nil && catalog.IsSnapshot(backupDir, entry) && !repositoryPlanned {
+			files, reason, err := repositoryFiles(backupDir, target)
+			item.Files, item.Reason, item.Err = append(files, item.Files...), reason, err
+			repositoryPlanned = reason == "" && err == nil
+		}
+		if item.Reason == "" && item.Err == nil {
+			chain, err := catalog.ResolveChain(backupDir, entry)
+			if err != nil {
+				item.Reason = "its backup chain is incomplete in the backup directory"
+			}
+			for _, parent := range chain[:max(len(chain)-1, 0)] {
+				i, ok := planned[parent]
+				if !ok {
+					parentItem := planSet(backupDir, target, parent)
+					parentItem.ParentOf = &entry
+					i = len(items)
+					planned[parent] = i
+					items = append(items, parentItem)
+				}
+				if items[i].Reason != "" || items[i].Err != nil {
+					item.Reason = fmt.Sprintf("its parent backup %s cannot be copied", parent.String())
+					break
+				}
+			}
+		}
+		planned[entry] = len(items)
+		items = append(items, item)
+	}
+	return items
+}
+
+// planSet compares the files of entry with target.
+func planSet(backupDir, target string, entry util.BackupEntry) syncPreflightItem {
+	item := syncPreflightItem{Entry: entry}
+	switch {
+	case catalog.IsRunIncomplete(backupDir, entry.Date, entry.ID):
+		item.Reason = "its run is incomplete in the backup directory"
+	case catalog.IsSnapshot(backupDir, entry):
+		item.Files, item.Err = snapshotFiles(backupDir, target, entry)
+	default:
+		item.Files, item.Err = setFiles(backupDir, target, entry)
+	}
+	return item
+}
+
+// setFiles returns the files of entry in backupDir: its .challenge, .run.json and
+// .manifest.enc files, as far as it has them, followed by its parts in order.
+func setFiles(backupDir, target string, entry util.BackupEntry) ([]syncFile, error) {
+	if _, _, err := catalog.InspectBackupParts(backupDir, entry); err != nil {
+		return nil, err
+	}
+	names := []string{
+		filepath.Base(util.ChallengeFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID)),
+		filepath.Base(util.RunInfoFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID)),
+		filepath.Base(util.ManifestFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID)),
+	}
+	parts, err := catalog.CollectParts(backupDir, entry)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts {
+		names = append(names, filepath.Base(part))
+	}
+	return compareFiles(backupDir, target, names, 3)
+}
+
+// snapshotFiles returns the files of the snapshot entry in backupDir: its .run.json
+// file, if it has one, followed by the snapshot.
+func snapshotFiles(backupDir, target string, entry util.BackupEntry) ([]syncFile, error) {
+	names := []string{
+		filepath.Base(util.RunInfoFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID)),
+		filepath.Base(util.SnapshotFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID)),
+	}
+	return compareFiles(backupDir, target, names, 1)
+}
+
+// repositoryFiles returns the files of the chunked repository in backupDir. Sync
+// needs no password, so it cannot tell which packs a snapshot uses and copies all of
+// them. A target whose repository has other keys is refused with a reason: its
+// snapshots could no longer be read.
+func repositoryFiles(backupDir, target string) ([]syncFile, string, error) {
+	names, err := repository.Files(backupDir)
+	if err != nil {
+		return nil, "", err
+	}
+	files, err := compareFiles(backupDir, target, names, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	if targetKeys := repository.KeysFilePath(target); fileExists(targetKeys) {
+		want, err := fileSHA256(repository.KeysFilePath(backupDir))
+		if err != nil {
+			return nil, "", err
+		}
+		got, err := fileSHA256(targetKeys)
+		if err != nil {
+			return nil, "", err
+		}
+		if !bytes.Equal(got, want) {
+			return nil, "the target holds a chunked repository with other keys", nil
+		}
+	}
+	return files, "", nil
+}
+
+// compareFiles returns the files of backupDir named by names, paths relative to
+// backupDir. The first optional files are left out when backupDir does not have
+// them. A file counts as present in target when a file of the same name and size
+// is there.
+func compareFiles(backupDir, target string, names []string, optional int) ([]syncFile, error) {
+	var files []syncFile
+	for i, name := range names {
+		path := filepath.Join(backupDir, name)
+		info, err := util.StorageFor(path).Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) && i < optional {
+				continue
+			}
+			return nil, fmt.Errorf("Failed to inspect %q: %w", filepath.ToSlash(name), err)
+		}
+		f := syncFile{Name: name, Size: info.Size()}
+		copyPath := filepath.Join(target, f.Name)
+		copyInfo, err := util.StorageFor(copyPath).Stat(copyPath)
+		switch {
+		case err == nil:
+			f.Present = !copyInfo.IsDir() && copyInfo.Size() == f.Size
+		case !os.IsNotExist(err):
+			return nil, fmt.Errorf("Failed to inspect the target copy of %q: %w", filepath.ToSlash(f.Name), err)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+func fileExists(path string) bool {
+	_, err := util.StorageFor(path).Stat(path)
+	return err == nil
+}
+
+func printSyncPreflight(w io.Writer, cfg *util.Config, backupDir string, s settings, items []syncPreflightItem, stale []util.BackupEntry) {
+	var issues []string
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Sync preflight")
+	fmt.Fprintln(w, "--------------")
+
+	// Backup selection
+	fmt.Fprintln(w, "Backup selection:")
+	fmt.Fprintf(w, "  Path: %s\n", filepath.ToSlash(backupDir))
+	for _, item := range items {
+		switch {
+		case item.Err != nil:
+			fmt.Fprintf(w, "  [ERROR] %s\n", item.Entry.String())
+			issues = append(issues, fmt.Sprintf("%s: %v", item.Entry.String(), item.Err))
+		case item.Reason != "":
+			fmt.Fprintf(w, "  [SKIP] %s (%s)\n", item.Entry.String(), item.Reason)
+		case len(item.pending()) == 0:
+			fmt.Fprintf(w, "  [OK] %s (already in the target)\n", item.Entry.String())
+		case item.ParentOf != nil:
+			fmt.Fprintf(w, "  [COPY] %s (files: %d, %s, parent of %s)\n", item.Entry.String(), len(item.pending()), util.FormatBytesBinary(uint64(item.pendingBytes())), item.ParentOf.String())
+		default:
+			fmt.Fprintf(w, "  [COPY] %s (files: %d, %s)\n", item.Entry.String(), len(item.pending()), util.FormatBytesBinary(uint64(item.pendingBytes())))
+		}
+	}
+	fmt.Fprintf(w, "  Data to copy (total): %s\n", util.FormatBytesBinary(uint64(pendingBytes(items))))
+
+	// Target
+	fmt.Fprintln(w, "Target:")
+	fmt.Fprintf(w, "  Path: %s\n", filepath.ToSlash(s.target))
+	if freeBytes, err := util.StorageFor(s.target).FreeSpace(s.target); err == nil {
+		fmt.Fprintf(w, "  Free space: %s\n", util.FormatBytesBinary(freeBytes))
+	} else {
+		fmt.Fprintf(w, "  Free space: unknown (%v)\n", err)
+	}
+	if s.mirror {
+		fmt.Fprintln(w, "  Delete sets no longer in the backup directory:")
+		for _, entry := range stale {
+			fmt.Fprintf(w, "    [DELETE] %s\n", entry.String())
+		}
+		if len(stale) == 0 {
+			fmt.Fprintln(w, "    none")
+		}
+	}
+
+	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Log level", strings.ToLower(cfg.LogLevel))
+
+	// Print collected issues
+	if len(issues) > 0 {
+		fmt.Fprintln(w)
+		for _, issue := range issues {
+			fmt.Fprintf(w, "[ERROR] %s\n", issue)
+		}
+	}
+}
+
+func pendingBytes(items []syncPreflightItem) int64 {
+	var total int64
+	for _, item := range items {
+		if item.Err == nil && item.Reason == "" {
+			total += item.pendingBytes()
+		}
+	}
+	return total
+}
+
+func countPending(items []syncPreflightItem) int {
+	count := 0
+	for _, item := range items {
+		if item.Err == nil && item.Reason == "" && len(item.pending()) > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func validateSyncPreflight(items []syncPreflightItem, target string) error {
+	if err := operation.ValidatePreflightItems(
+		items,
+		func(item syncPreflightItem) bool { return item.Err != nil },
+		"Sync preflight failed: %d selected item(s) are incomplete or invalid. Remedy: Fix the [ERROR] entries above and start the sync again.",
+	); err != nil {
+		return err
+	}
+
+	neededBytes := pendingBytes(items)
+	freeBytes, err := util.StorageFor(target).FreeSpace(target)
+	if err != nil || !util.IsSpaceInsufficient(neededBytes, freeBytes) {
+		return nil
+	}
+	message := fmt.Sprintf("Insufficient free space in the sync target: needed %s, available %s. Remedy: Free space in the target or select fewer backups.", util.FormatBytesBinary(uint64(neededBytes)), util.FormatBytesBinary(freeBytes))
+	fmt.Println()
+	fmt.Printf("[ERROR] %s\n", message)
+	return fmt.Errorf("Sync preflight failed: %s", message)
+}
@@ -0,0 +1,69 @@
+package replicate
+
+import (
+	"RestoreSafe/internal/util"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// syncRecordFileName is the replication record in a sync target. It lists the
+// backup sets a sync copied into the target together with the backup directory
+// they came from, so -mirror only deletes sets that this backup directory put there.
+const syncRecordFileName = "restoresafe.sync.json"
+
+// syncRecord maps the names of copied backup sets to their backup directory.
+type syncRecord struct {
+	Sets map[string]string `json:"sets"`
+}
+
+// readSyncRecord reads the replication record of target. A target without one
+// holds no sets copied by sync.
+func readSyncRecord(target string) (syncRecord, error) {
+	record := syncRecord{Sets: make(map[string]string)}
+	path := filepath.Join(target, syncRecordFileName)
+	data, err := util.ReadStorageFile(path)
+	if os.IsNotExist(err) {
+		return record, nil
+	}
+	if err != nil {
+		return record, fmt.Errorf("Failed to read sync record %q: %w. Remedy: Check read permissions in the sync target.", filepath.ToSlash(path), err)
+	}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, fmt.Errorf("Invalid sync record %q: %w. Remedy: Delete the file; -mirror then deletes no sets until they are copied again.", filepath.ToSlash(path), err)
+	}
+	if record.Sets == nil {
+		record.Sets = make(map[string]string)
+	}
+	return record, nil
+}
+
+// write stores the record in target.
+func (r syncRecord) write(target string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(target, syncRecordFileName)
+	if err := util.WriteStorageFile(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("Failed to write sync record %q: %w. Remedy: Check write permissions in the sync target.", filepath.ToSlash(path), err)
+	}
+	return nil
+}
+
+// add records entry as copied from backupDir.
+func (r syncRecord) add(entry util.BackupEntry, backupDir string) {
+	r.Sets[entry.String()] = filepath.ToSlash(backupDir)
+}
+
+// remove forgets entry.
+func (r syncRecord) remove(entry util.BackupEntry) {
+	delete(r.Sets, entry.String())
+}
+
+// copiedFrom reports whether entry was copied into the target from backupDir.
+func (r syncRecord) copiedFrom(entry util.BackupEntry, backupDir string) bool {
+	source, ok := r.Sets[entry.String()]
+	return ok && sameDirectory(source, backupDir)
+}
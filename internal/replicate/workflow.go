@@ -0,0 +1,296 @@
+// Package replicate copies existing backup sets to a secondary location:
+//  1. Let the user choose the target directory and which backup(s) to copy
+//  2. Compare the selected sets with the target and check its free space
+//  3. Copy the missing part files and their .challenge, .run.json and .manifest.enc
+//     files, or the snapshots and the chunked repository, and verify each copy
+//     against the SHA-256 checksum of its original
+//  4. Copy the completion marker of every run whose sets are all in the target
+//  5. Optionally delete the sets from the target that retention has removed from
+//     the backup directory
+//
+// The encrypted files are copied as they are, so no password is needed.
+package replicate
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/storage"
+	"RestoreSafe/internal/util"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readLineFn is the line reader used by the sync prompts; tests replace it.
+var readLineFn = security.ReadLine
+
+// Options holds sync choices passed as arguments instead of being entered at the prompts.
+type Options struct {
+	// Backup selects the backup(s) to copy: a dot (.), a backup ID or a full backup
+	// name. Empty copies every backup set.
+	Backup string
+	// Target is the directory or storage URL the backup sets are copied to.
+	Target string
+	// Mirror deletes backup sets from the target that are no longer in the backup directory.
+	Mirror bool
+}
+
+// Run copies selected backup sets to another directory.
+func Run(cfg *util.Config, exeDir string) error {
+	return run(cfg, exeDir, nil)
+}
+
+// RunWithOptions copies the backup sets selected by opts.
+// The confirmation is still prompted.
+func RunWithOptions(cfg *util.Config, exeDir string, opts Options) error {
+	return run(cfg, exeDir, &opts)
+}
+
+func run(cfg *util.Config, exeDir string, opts *Options) error {
+	backupDir := util.ResolveDir(cfg.BackupDirectory, exeDir)
+
+	index, err := catalog.ScanBackups(backupDir)
+	if err != nil {
+		return fmt.Errorf("Failed to scan backup directory %q: %w. Remedy: Check the backup_directory path in config.yaml and ensure the directory is readable.", backupDir, err)
+	}
+	if len(index) == 0 {
+		fmt.Println("No backups found in backup directory. Remedy: Check whether .enc files are in the backup directory and whether the correct directory is selected.")
+		return nil
+	}
+
+	s, err := resolveSyncSettings(backupDir, exeDir, index, opts)
+	if err != nil {
+		if errors.Is(err, operation.ErrSelectionCancelled) {
+			fmt.Println("Sync cancelled.")
+			return nil
+		}
+		return err
+	}
+
+	unmount, err := storage.MountDirectory(s.target, cfg)
+	if err != nil {
+		return fmt.Errorf("Failed to connect the sync target: %w", err)
+	}
+	defer unmount()
+	if err := util.StorageFor(s.target).MkdirAll(s.target); err != nil {
+		return fmt.Errorf("Failed to create sync target %q: %w. Remedy: Check the path and verify write permissions.", filepath.ToSlash(s.target), err)
+	}
+
+	lock, err := util.AcquireBackupLock(backupDir)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	targetLock, err := util.AcquireBackupLock(s.target)
+	if err != nil {
+		return err
+	}
+	defer targetLock.Release()
+
+	logPath := util.LogFileName(backupDir, s.selected[0].Date, s.selected[0].ID)
+	log := operation.OpenLogger(cfg, backupDir, s.selected[0])
+	warningCount := 0
+	if log.IsConsoleOnly() {
+		warningCount++
+	}
+	defer log.Close()
+
+	items := buildSyncPreflight(s.selected, backupDir, s.target)
+	record, err := readSyncRecord(s.target)
+	if err != nil {
+		return err
+	}
+	var stale []util.BackupEntry
+	if s.mirror {
+		if stale, err = findStaleEntries(index, record, backupDir, s.target); err != nil {
+			return fmt.Errorf("Failed to scan sync target %q: %w. Remedy: Check that the target is readable.", filepath.ToSlash(s.target), err)
+		}
+	}
+	printSyncPreflight(os.Stdout, cfg, backupDir, s, items, stale)
+	if err := validateSyncPreflight(items, s.target); err != nil {
+		return err
+	}
+	if countPending(items) == 0 && len(stale) == 0 {
+		fmt.Println()
+		fmt.Println("Nothing to sync: the selected backups are already in the target.")
+		return nil
+	}
+
+	confirmed, err := operation.PromptStartAction("sync")
+	if err != nil {
+		return err
+	}
+	if !confirmed {
+		log.InfoLogOnly("Sync cancelled by user before start")
+		fmt.Println("Sync cancelled.")
+		return nil
+	}
+
+	log.Info("Sync started - target: %s", filepath.ToSlash(s.target))
+	copiedSets, copiedFiles := 0, 0
+	for _, item := range items {
+		switch {
+		case item.Reason != "":
+			log.Warn("Skipped: %s (%s)", item.Entry.String(), item.Reason)
+			warningCount++
+			continue
+		case len(item.pending()) == 0:
+			log.Info("Already in the target: %s", item.Entry.String())
+			continue
+		}
+		log.Info("Copying: %s", item.Entry.String())
+		// The set is recorded before its first file is copied, so -mirror can also
+		// delete what an interrupted sync left of it.
+		record.add(item.Entry, backupDir)
+		if err := record.write(s.target); err != nil {
+			return err
+		}
+		n, err := copySet(item, backupDir, s.target, log)
+		copiedFiles += n
+		if err != nil {
+			return fmt.Errorf("Failed to copy %q: %w", item.Entry.String(), err)
+		}
+		copiedSets++
+	}
+	completeRuns(items, index, backupDir, s.target, log)
+
+	deletedSets := 0
+	for _, entry := range stale {
+		removed, err := removeSet(s.target, entry)
+		if err != nil {
+			return fmt.Errorf("Failed to delete %s from the sync target: %w. Remedy: Check delete permissions in the target.", entry.String(), err)
+		}
+		log.Info("Deleted from the target: %s (%d file(s)), no longer in the backup directory", entry.String(), removed)
+		deletedSets++
+		record.remove(entry)
+		if err := record.write(s.target); err != nil {
+			return err
+		}
+	}
+
+	log.Info("Sync completed successfully: %d backup set(s) copied and verified (%d file(s)), %d deleted from the target.", copiedSets, copiedFiles, deletedSets)
+	fmt.Printf("\nLog file: %s\n", logPath)
+	if warningCount > 0 {
+		fmt.Printf("Warnings: %d\n", warningCount)
+	}
+	return nil
+}
+
+// settings are the resolved target and selection of one sync run.
+type settings struct {
+	target   string
+	selected []util.BackupEntry
+	label    string
+	mirror   bool
+}
+
+func resolveSyncSettings(backupDir, exeDir string, index []util.BackupEntry, opts *Options) (settings, error) {
+	var s settings
+	var err error
+	target := ""
+	if opts != nil {
+		target = strings.TrimSpace(opts.Target)
+	} else if target, err = promptSyncTarget(); err != nil {
+		return settings{}, err
+	}
+	if s.target, err = resolveTarget(target, backupDir, exeDir); err != nil {
+		return settings{}, err
+	}
+
+	switch {
+	case opts != nil && strings.TrimSpace(opts.Backup) == "":
+		s.selected, s.label = catalog.SortedEntries(index), "all backup sets"
+	case opts != nil:
+		s.selected, s.label, err = operation.ResolveBackupSelection(backupDir, index, opts.Backup)
+	default:
+		s.selected, s.label, err = promptSyncSelection(backupDir, index)
+	}
+	if err != nil {
+		return settings{}, err
+	}
+
+	if opts != nil {
+		s.mirror = opts.Mirror
+	} else if s.mirror, err = promptMirror(); err != nil {
+		return settings{}, err
+	}
+	return s, nil
+}
+
+// resolveTarget resolves target like backup_directory and rejects the backup directory itself.
+func resolveTarget(target, backupDir, exeDir string) (string, error) {
+	if target == "" {
+		return "", fmt.Errorf("Sync target must not be empty. Remedy: Pass the directory or storage URL to copy the backups to.")
+	}
+	resolved := util.ResolveDir(target, exeDir)
+	if sameDirectory(resolved, backupDir) {
+		return "", fmt.Errorf("Sync target %q is the backup directory. Remedy: Choose another directory, drive or storage URL.", filepath.ToSlash(target))
+	}
+	return resolved, nil
+}
+
+func sameDirectory(a, b string) bool {
+	if util.IsStorageURL(a) || util.IsStorageURL(b) {
+		return util.CleanStoragePath(a) == util.CleanStoragePath(b)
+	}
+	return util.NormalizePathKey(a) == util.NormalizePathKey(b)
+}
+
+func promptSyncTarget() (string, error) {
+	for {
+		input, err := readLineFn("Target directory (path or storage URL, e.g. E:/Backups or s3://bucket/backups; q = cancel): ")
+		if err != nil {
+			return "", err
+		}
+		fmt.Println()
+		input = strings.TrimSpace(input)
+		switch {
+		case strings.EqualFold(input, "q"):
+			return "", operation.ErrSelectionCancelled
+		case input == "":
+			fmt.Println("Target directory must not be empty.")
+			fmt.Println()
+		default:
+			return input, nil
+		}
+	}
+}
+
+func promptSyncSelection(backupDir string, index []util.BackupEntry) ([]util.BackupEntry, string, error) {
+	for {
+		answer, err := readLineFn("Copy all backup sets? [Y/n]: ")
+		if err != nil {
+			return nil, "", err
+		}
+		fmt.Println()
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "", "y", "yes":
+			return catalog.SortedEntries(index), "all backup sets", nil
+		case "n", "no":
+			return operation.PromptBackupSelection("copy", backupDir, index)
+		default:
+			fmt.Println("Please enter y (yes) or n (no).")
+		}
+	}
+}
+
+func promptMirror() (bool, error) {
+	for {
+		answer, err := readLineFn("Also delete backup sets from the target that are no longer in the backup directory? [y/N]: ")
+		if err != nil {
+			return false, err
+		}
+		fmt.Println()
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "", "n", "no":
+			return false, nil
+		case "y", "yes":
+			return true, nil
+		default:
+			fmt.Println("Please enter y (yes) or n (no).")
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package repository
+
+import (
+	"errors"
+	"io"
+)
+
+// Chunk size bounds of the content-defined chunker. Cut points depend only on the
+// content around them, so an insertion near the start of a file changes the chunks
+// around the insertion while the rest of the file deduplicates against earlier runs.
+const (
+	MinChunkSize = 512 * 1024
+	AvgChunkSize = 1024 * 1024
+	MaxChunkSize = 8 * 1024 * 1024
+)
+
+// gearTable maps every byte value to a pseudo-random 64-bit value for the rolling
+// gear hash. It is generated from a fixed seed; changing it would not break existing
+// repositories, but new chunks would no longer deduplicate against old ones.
+var gearTable = func() [256]uint64 {
+	var table [256]uint64
+	state := uint64(0x5265_7374_6f72_6553) // "RestoreS"
+	for i := range table {
+		// SplitMix64
+		state += 0x9E3779B97F4A7C15
+		z := state
+		z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+		z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// Chunker splits a stream into content-defined chunks with FastCDC: a gear hash is
+// rolled over the data and a chunk ends where the hash matches a mask. Before the
+// average size a stricter mask is used and after it a looser one, which keeps chunk
+// sizes close to the average (normalized chunking).
+type Chunker struct {
+	r        io.Reader
+	buf      []byte
+	start    int
+	end      int
+	eof      bool
+	min, avg int
+	max      int
+	maskS    uint64
+	maskL    uint64
+}
+
+// NewChunker returns a chunker with the default chunk sizes.
+func NewChunker(r io.Reader) *Chunker {
+	return newChunkerWithSizes(r, MinChunkSize, AvgChunkSize, MaxChunkSize)
+}
+
+// newChunkerWithSizes returns a chunker with custom bounds; avg must be a power of two.
+func newChunkerWithSizes(r io.Reader, min, avg, max int) *Chunker {
+	bits := 0
+	for 1<<bits < avg {
+		bits++
+	}
+	return &Chunker{
+		r:     r,
+		buf:   make([]byte, 2*max),
+		min:   min,
+		avg:   avg,
+		max:   max,
+		maskS: highBitsMask(bits + 2),
+		maskL: highBitsMask(bits - 2),
+	}
+}
+
+// highBitsMask returns a mask of the n most significant bits. The gear hash shifts
+// left, so its high bits depend on the most bytes of the window.
+func highBitsMask(n int) uint64 {
+	if n <= 0 {
+		return 0
+	}
+	return ^uint64(0) << (64 - n)
+}
+
+// Next returns the next chunk, or io.EOF after the last one. The returned slice is
+// only valid until the next call.
+func (c *Chunker) Next() ([]byte, error) {
+	if err := c.fill(); err != nil {
+		return nil, err
+	}
+	if c.start == c.end {
+		return nil, io.EOF
+	}
+	n := c.cut(c.buf[c.start:c.end])
+	chunk := c.buf[c.start : c.start+n]
+	c.start += n
+	return chunk, nil
+}
+
+// fill makes at least max bytes available unless the input ends first.
+func (c *Chunker) fill() error {
+	if c.eof || c.end-c.start >= c.max {
+		return nil
+	}
+	c.end = copy(c.buf, c.buf[c.start:c.end])
+	c.start = 0
+	for c.end < len(c.buf) {
+		n, err := c.r.Read(c.buf[c.end:])
+		c.end += n
+		if errors.Is(err, io.EOF) {
+			c.eof = true
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cut returns the length of the chunk at the start of data.
+func (c *Chunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.min {
+		return n
+	}
+	if n > c.max {
+		n = c.max
+	}
+	normal := c.avg
+	if normal > n {
+		normal = n
+	}
+
+	var fp uint64
+	i := c.min
+	for ; i < normal; i++ {
+		fp = (fp << 1) + gearTable[data[i]]
+		if fp&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = (fp << 1) + gearTable[data[i]]
+		if fp&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func TestChunkerRespectsSizeBoundsAndReassembles(t *testing.T) {
+	t.Parallel()
+
+	data := randomData(1, 64*1024)
+	chunker := newChunkerWithSizes(bytes.NewReader(data), 256, 1024, 4096)
+	var joined []byte
+	chunks := 0
+	for {
+		chunk, err := chunker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next returned error: %v", err)
+		}
+		if len(chunk) > 4096 {
+			t.Fatalf("chunk of %d bytes exceeds the maximum", len(chunk))
+		}
+		if len(chunk) < 256 && len(joined)+len(chunk) != len(data) {
+			t.Fatalf("chunk of %d bytes below the minimum before the end of the data", len(chunk))
+		}
+		joined = append(joined, chunk...)
+		chunks++
+	}
+	if !bytes.Equal(joined, data) {
+		t.Fatalf("chunks do not reassemble the input")
+	}
+	if chunks < 8 {
+		t.Fatalf("expected content-defined cuts, got only %d chunk(s)", chunks)
+	}
+}
+
+func TestChunkerCutPointsSurviveInsertion(t *testing.T) {
+	t.Parallel()
+
+	data := randomData(2, 64*1024)
+	shifted := append([]byte("inserted at the start"), data...)
+
+	original := chunkSet(t, data)
+	reused := 0
+	for chunk := range chunkSet(t, shifted) {
+		if original[chunk] {
+			reused++
+		}
+	}
+	if reused < len(original)-2 {
+		t.Fatalf("expected all but the first chunks to be unchanged, %d of %d reused", reused, len(original))
+	}
+}
+
+func randomData(seed int64, size int) []byte {
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data) //nolint:errcheck
+	return data
+}
+
+func chunkSet(t *testing.T, data []byte) map[string]bool {
+	t.Helper()
+	chunker := newChunkerWithSizes(bytes.NewReader(data), 256, 1024, 4096)
+	set := make(map[string]bool)
+	for {
+		chunk, err := chunker.Next()
+		if errors.Is(err, io.EOF) {
+			return set
+		}
+		if err != nil {
+			t.Fatalf("Next returned error: %v", err)
+		}
+		set[string(chunk)] = true
+	}
+}
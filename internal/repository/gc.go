@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/util"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GCStats summarizes a garbage collection run.
+type GCStats struct {
+	// RemovedPacks counts deleted packs, including the packs that were repacked.
+	RemovedPacks  int
+	RepackedPacks int
+	FreedBytes    int64
+}
+
+// CollectGarbage removes the chunks that no snapshot in the backup directory refers
+// to any more. Every snapshot must be readable with password; otherwise nothing is
+// removed, so a chunk still in use is never deleted.
+//
+// Packs without used chunks are deleted. Packs where at least half of the data is
+// unused are repacked: their used chunks are copied into a new pack before the old
+// pack is deleted. Packs without an index, left over from interrupted runs, are
+// deleted as well.
+func (r *Repository) CollectGarbage(password []byte) (GCStats, error) {
+	var stats GCStats
+	if err := r.Flush(); err != nil {
+		return stats, err
+	}
+	referenced, err := r.referencedChunks(password)
+	if err != nil {
+		return stats, err
+	}
+
+	names := make([]string, 0, len(r.packs))
+	for name := range r.packs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var obsolete []string
+	var copiedBytes int64
+	for _, name := range names {
+		entries := r.packs[name]
+		var live []indexEntry
+		var total, liveBytes int64
+		for _, e := range entries {
+			total += e.Length
+			if referenced[e.ID] {
+				live = append(live, e)
+				liveBytes += e.Length
+			}
+		}
+		switch {
+		case len(live) == len(entries):
+			continue
+		case len(live) == 0:
+			obsolete = append(obsolete, name)
+		case (total-liveBytes)*2 >= total:
+			for _, e := range live {
+				sealed, err := r.readSealed(location{pack: name, offset: e.Offset, length: e.Length})
+				if err != nil {
+					return stats, err
+				}
+				if err := r.appendSealed(e.ID, sealed); err != nil {
+					return stats, err
+				}
+				copiedBytes += e.Length
+			}
+			obsolete = append(obsolete, name)
+			stats.RepackedPacks++
+		}
+	}
+	// The copied chunks must be part of the repository before their old packs go.
+	if err := r.Flush(); err != nil {
+		return stats, err
+	}
+
+	for _, name := range obsolete {
+		freed, err := r.removePack(name)
+		if err != nil {
+			return stats, err
+		}
+		stats.RemovedPacks++
+		stats.FreedBytes += freed
+	}
+	stats.FreedBytes -= copiedBytes
+
+	orphans, err := r.removeIncompletePacks()
+	if err != nil {
+		return stats, err
+	}
+	stats.FreedBytes += orphans
+	return stats, nil
+}
+
+// referencedChunks returns the IDs of all chunks used by a snapshot in the backup
+// directory.
+func (r *Repository) referencedChunks(password []byte) (map[string]bool, error) {
+	des, err := r.storage.List(r.backupDir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read backup directory: %w", err)
+	}
+	referenced := make(map[string]bool)
+	for _, de := range des {
+		if de.IsDir() {
+			continue
+		}
+		if _, ok := util.ParseSnapshotFileName(de.Name()); !ok {
+			continue
+		}
+		_, entries, err := manifest.Load(filepath.Join(r.backupDir, de.Name()), password)
+		if err != nil {
+			return nil, fmt.Errorf("Snapshot %q cannot be read: %w. Remedy: Remove or repair the snapshot; unused repository data is only removed when every snapshot is readable.", de.Name(), err)
+		}
+		for _, e := range entries {
+			for _, id := range e.Chunks {
+				referenced[id] = true
+			}
+		}
+	}
+	return referenced, nil
+}
+
+// removePack deletes a pack and its index and returns the pack size. The index is
+// removed first, so an interrupted removal leaves an incomplete pack behind rather
+// than an index that points to a missing pack.
+func (r *Repository) removePack(name string) (int64, error) {
+	if f, ok := r.readers[name]; ok {
+		f.Close() //nolint:errcheck
+		delete(r.readers, name)
+	}
+	var size int64
+	if info, err := r.storage.Stat(r.packPath(name)); err == nil {
+		size = info.Size()
+	}
+	for _, path := range []string{r.indexPath(name), r.packPath(name)} {
+		if err := r.storage.Remove(path); err != nil && !os.IsNotExist(err) {
+			return 0, fmt.Errorf("Failed to remove %q: %w. Remedy: Check delete permissions in the backup directory.", filepath.Base(path), err)
+		}
+	}
+	for _, e := range r.packs[name] {
+		if loc, ok := r.index[e.ID]; ok && loc.pack == name {
+			delete(r.index, e.ID)
+		}
+	}
+	delete(r.packs, name)
+	return size, nil
+}
+
+// removeIncompletePacks deletes packs that have no index and leftover temporary
+// files, and returns the bytes freed.
+func (r *Repository) removeIncompletePacks() (int64, error) {
+	dir := filepath.Join(r.dir, packsDirName)
+	des, err := r.storage.List(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("Failed to read repository packs: %w", err)
+	}
+	var freed int64
+	for _, de := range des {
+		if de.IsDir() {
+			continue
+		}
+		name, isPack := strings.CutSuffix(de.Name(), packFileSuffix)
+		_, complete := r.packs[name]
+		incomplete := isPack && !complete
+		if !incomplete && !strings.HasSuffix(de.Name(), ".tmp") {
+			continue
+		}
+		if info, err := de.Info(); err == nil {
+			freed += info.Size()
+		}
+		if err := r.storage.Remove(filepath.Join(dir, de.Name())); err != nil && !os.IsNotExist(err) {
+			return freed, fmt.Errorf("Failed to remove %q: %w. Remedy: Check delete permissions in the backup directory.", de.Name(), err)
+		}
+	}
+	return freed, nil
+}
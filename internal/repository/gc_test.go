@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/util"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCollectGarbageRemovesChunksOfDeletedSnapshots(t *testing.T) {
+	t.Parallel()
+
+	workspace := t.TempDir()
+	srcDir := filepath.Join(workspace, "Docs")
+	backupDir := filepath.Join(workspace, "target")
+	password := []byte("repository-password")
+	if err := os.MkdirAll(backupDir, 0o750); err != nil {
+		t.Fatalf("failed to create backup dir: %v", err)
+	}
+	repo, err := OpenOrCreate(backupDir, password, testParams, 1024*1024)
+	if err != nil {
+		t.Fatalf("OpenOrCreate returned error: %v", err)
+	}
+	defer repo.Close()
+
+	writeTestFile(t, srcDir, "kept.txt", "kept in both runs")
+	writeTestFile(t, srcDir, "old.txt", "only in the first run")
+	first := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-13", ID: util.BackupID("SNP001")}
+	snapshot(t, repo, srcDir, backupDir, first, password)
+
+	if err := os.Remove(filepath.Join(srcDir, "old.txt")); err != nil {
+		t.Fatalf("failed to remove old.txt: %v", err)
+	}
+	second := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-14", ID: util.BackupID("SNP002")}
+	snapshot(t, repo, srcDir, backupDir, second, password)
+
+	// An incomplete pack from an interrupted run.
+	orphan := filepath.Join(Dir(backupDir), packsDirName, "0000"+packFileSuffix)
+	if err := os.WriteFile(orphan, []byte("partial"), 0o600); err != nil {
+		t.Fatalf("failed to write orphan pack: %v", err)
+	}
+
+	stats, err := repo.CollectGarbage(password)
+	if err != nil {
+		t.Fatalf("CollectGarbage returned error: %v", err)
+	}
+	if stats.RemovedPacks != 0 {
+		t.Fatalf("expected every pack to be in use while both snapshots exist, got %#v", stats)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Fatalf("expected the incomplete pack to be removed, stat err: %v", err)
+	}
+
+	if err := os.Remove(util.SnapshotFileName(backupDir, first.DirectoryName, first.Date, first.ID)); err != nil {
+		t.Fatalf("failed to remove snapshot: %v", err)
+	}
+	stats, err = repo.CollectGarbage(password)
+	if err != nil {
+		t.Fatalf("CollectGarbage returned error: %v", err)
+	}
+	if stats.RemovedPacks != 1 || stats.RepackedPacks != 1 || stats.FreedBytes <= 0 {
+		t.Fatalf("expected the half-unused pack to be repacked, got %#v", stats)
+	}
+	if repo.ChunkCount() != 1 {
+		t.Fatalf("expected one chunk to remain, got %d", repo.ChunkCount())
+	}
+
+	reopened, err := Open(backupDir, password)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer reopened.Close()
+	entries, _, err := manifest.LoadForBackup(backupDir, second, password)
+	if err != nil {
+		t.Fatalf("failed to load snapshot: %v", err)
+	}
+	for _, e := range entries {
+		for _, id := range e.Chunks {
+			if _, err := reopened.ReadChunk(id); err != nil {
+				t.Fatalf("chunk of %s is no longer readable: %v", e.Path, err)
+			}
+		}
+	}
+}
+
+func TestCollectGarbageKeepsDataWhenSnapshotIsUnreadable(t *testing.T) {
+	t.Parallel()
+
+	workspace := t.TempDir()
+	srcDir := filepath.Join(workspace, "Docs")
+	backupDir := filepath.Join(workspace, "target")
+	password := []byte("repository-password")
+	if err := os.MkdirAll(backupDir, 0o750); err != nil {
+		t.Fatalf("failed to create backup dir: %v", err)
+	}
+	repo, err := OpenOrCreate(backupDir, password, testParams, 1024*1024)
+	if err != nil {
+		t.Fatalf("OpenOrCreate returned error: %v", err)
+	}
+	defer repo.Close()
+	writeTestFile(t, srcDir, "a.txt", "alpha")
+	entry := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-13", ID: util.BackupID("SNP001")}
+	snapshot(t, repo, srcDir, backupDir, entry, password)
+
+	foreign := util.BackupEntry{DirectoryName: "Other", Date: "2026-03-13", ID: util.BackupID("SNP001")}
+	snapshot(t, repo, srcDir, backupDir, foreign, []byte("another password"))
+
+	if _, err := repo.CollectGarbage(password); err == nil {
+		t.Fatal("expected garbage collection to stop at the unreadable snapshot")
+	}
+	if repo.ChunkCount() != 1 {
+		t.Fatalf("expected no chunk to be removed, got %d chunk(s)", repo.ChunkCount())
+	}
+}
+
+func snapshot(t *testing.T, repo *Repository, srcDir, backupDir string, entry util.BackupEntry, password []byte) {
+	t.Helper()
+	path := util.SnapshotFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID)
+	if err := repo.SnapshotDirectory(srcDir, entry.DirectoryName, path, manifest.Header{Backup: entry.String()}, password, testParams); err != nil {
+		t.Fatalf("SnapshotDirectory returned error: %v", err)
+	}
+}
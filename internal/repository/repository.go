@@ -0,0 +1,519 @@
+// Package repository implements the chunked repository format, an alternative to
+// one encrypted TAR per backup run that stores identical data only once:
+//
+//   - Files are split into content-defined chunks (FastCDC, see Chunker).
+//   - Every chunk is identified by a keyed hash (HMAC-SHA256) of its content, so
+//     chunk IDs reveal nothing about the content to someone without the key.
+//   - New chunks are sealed with AES-256-GCM and appended to pack files of about
+//     split_size_mb; chunks already in the repository are only referenced.
+//   - Every backup run writes one snapshot per source directory: an encrypted
+//     manifest whose file entries list their chunk IDs (see package manifest).
+//
+// Layout inside the backup directory:
+//
+//	repository/keys.enc         chunk ID and data keys, encrypted with the backup password
+//	repository/keys.challenge   YubiKey challenge the keys were encrypted with, if any
+//	repository/packs/{id}.pack  sealed chunks, back to back
+//	repository/packs/{id}.idx   sealed list of the chunks in the pack with their offsets
+//	[name]_YYYY-MM-DD_ID.snapshot.enc
+//
+// A pack becomes part of the repository once its index is written; packs without an
+// index are left over from interrupted runs and removed by CollectGarbage.
+package repository
+
+import (
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	keysFileName      = "keys.enc"
+	challengeFileName = "keys.challenge"
+	packsDirName      = "packs"
+	packFileSuffix    = ".pack"
+	indexFileSuffix   = ".idx"
+	keysVersion       = 1
+)
+
+// keys holds the secrets of a repository. They are generated once and stored
+// encrypted with the backup password, so every run derives the same chunk IDs.
+type keys struct {
+	Version int    `json:"version"`
+	IDKey   []byte `json:"id_key"`
+	DataKey []byte `json:"data_key"`
+}
+
+// indexEntry locates one sealed chunk inside a pack.
+type indexEntry struct {
+	ID     string `json:"id"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"`
+}
+
+type packIndex struct {
+	Chunks []indexEntry `json:"chunks"`
+}
+
+type location struct {
+	pack   string
+	offset int64
+	length int64
+}
+
+// Stats counts the chunks written by Store.
+type Stats struct {
+	NewChunks    int
+	ReusedChunks int
+	// StoredBytes is the encrypted size of the new chunks.
+	StoredBytes int64
+}
+
+// Repository is an open chunked repository.
+type Repository struct {
+	backupDir string
+	dir       string
+	storage   util.Storage
+	keys      keys
+	packSize  int64
+	index     map[string]location
+	packs     map[string][]indexEntry
+	current   *packWriter
+	readers   map[string]util.StorageFile
+	stats     Stats
+}
+
+type packWriter struct {
+	name    string
+	file    util.StorageWriter
+	size    int64
+	entries []indexEntry
+}
+
+// Dir returns the repository directory inside backupDir.
+func Dir(backupDir string) string {
+	return filepath.Join(backupDir, util.RepositoryDirName)
+}
+
+// ChallengeFilePath returns the path of the YubiKey challenge the repository keys
+// are encrypted with.
+func ChallengeFilePath(backupDir string) string {
+	return filepath.Join(Dir(backupDir), challengeFileName)
+}
+
+// KeysFilePath returns the path of the encrypted repository keys.
+func KeysFilePath(backupDir string) string {
+	return filepath.Join(Dir(backupDir), keysFileName)
+}
+
+// Exists reports whether backupDir contains a chunked repository.
+func Exists(backupDir string) bool {
+	path := KeysFilePath(backupDir)
+	info, err := util.StorageFor(path).Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// Files returns the files of the repository in backupDir relative to backupDir, so
+// it can be copied without the password: the YubiKey challenge if there is one, the
+// keys, and every complete pack followed by its index. A copy made in this order is
+// usable at every step, since a pack only counts once its index is there.
+func Files(backupDir string) ([]string, error) {
+	var names []string
+	challenge := ChallengeFilePath(backupDir)
+	if _, err := util.StorageFor(challenge).Stat(challenge); err == nil {
+		names = append(names, filepath.Join(util.RepositoryDirName, challengeFileName))
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	names = append(names, filepath.Join(util.RepositoryDirName, keysFileName))
+
+	packs := filepath.Join(Dir(backupDir), packsDirName)
+	des, err := util.StorageFor(packs).List(packs)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("Failed to read repository packs: %w", err)
+	}
+	for _, de := range des {
+		name, ok := strings.CutSuffix(de.Name(), indexFileSuffix)
+		if !ok || de.IsDir() {
+			continue
+		}
+		names = append(names,
+			filepath.Join(util.RepositoryDirName, packsDirName, name+packFileSuffix),
+			filepath.Join(util.RepositoryDirName, packsDirName, de.Name()))
+	}
+	return names, nil
+}
+
+// Open opens the repository in backupDir with password.
+// A wrong password is reported as security.ErrWrongPassword.
+func Open(backupDir string, password []byte) (*Repository, error) {
+	r := newRepository(backupDir, util.DefaultSplitSizeMB*1024*1024)
+	if err := r.readKeys(password); err != nil {
+		return nil, err
+	}
+	if err := r.loadIndex(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// OpenOrCreate opens the repository in backupDir, creating it with new keys when it
+// does not exist yet. New packs are closed once they reach packSize bytes.
+func OpenOrCreate(backupDir string, password []byte, params security.Argon2Params, packSize int64) (*Repository, error) {
+	if !Exists(backupDir) {
+		r := newRepository(backupDir, packSize)
+		if err := r.create(password, params); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	r, err := Open(backupDir, password)
+	if err != nil {
+		return nil, err
+	}
+	r.packSize = packSize
+	return r, nil
+}
+
+func newRepository(backupDir string, packSize int64) *Repository {
+	return &Repository{
+		backupDir: backupDir,
+		dir:       Dir(backupDir),
+		packSize:  packSize,
+		index:     make(map[string]location),
+		packs:     make(map[string][]indexEntry),
+		readers:   make(map[string]util.StorageFile),
+		storage:   util.StorageFor(backupDir),
+	}
+}
+
+func (r *Repository) create(password []byte, params security.Argon2Params) error {
+	if err := r.storage.MkdirAll(filepath.Join(r.dir, packsDirName)); err != nil {
+		return fmt.Errorf("Failed to create repository directory: %w. Remedy: Check write permissions in the backup directory.", err)
+	}
+	idKey, err := security.NewRandomKey()
+	if err != nil {
+		return err
+	}
+	dataKey, err := security.NewRandomKey()
+	if err != nil {
+		return err
+	}
+	r.keys = keys{Version: keysVersion, IDKey: idKey, DataKey: dataKey}
+
+	plain, err := json.Marshal(r.keys)
+	if err != nil {
+		return err
+	}
+	var encrypted bytes.Buffer
+	if err := security.Encrypt(&encrypted, bytes.NewReader(plain), password, params); err != nil {
+		return fmt.Errorf("Failed to encrypt repository keys: %w", err)
+	}
+	if err := writeFileAtomic(r.storage, filepath.Join(r.dir, keysFileName), encrypted.Bytes()); err != nil {
+		return fmt.Errorf("Failed to write repository keys: %w. Remedy: Check free space and write permissions in the backup directory.", err)
+	}
+	return nil
+}
+
+func (r *Repository) readKeys(password []byte) error {
+	f, err := r.storage.Open(filepath.Join(r.dir, keysFileName))
+	if err != nil {
+		return fmt.Errorf("Failed to open repository keys: %w. Remedy: Restore the repository directory from a copy of the backup directory.", err)
+	}
+	defer f.Close()
+
+	var plain bytes.Buffer
+	if err := security.Decrypt(&plain, f, password); err != nil {
+		if errors.Is(err, security.ErrWrongPassword) {
+			return fmt.Errorf("Repository keys cannot be decrypted: %w. Remedy: Use the password (and YubiKey) the repository was created with, or choose another backup_directory.", err)
+		}
+		return fmt.Errorf("Failed to read repository keys: %w", err)
+	}
+	if err := json.Unmarshal(plain.Bytes(), &r.keys); err != nil {
+		return fmt.Errorf("Invalid repository keys: %w. Remedy: Restore the repository directory from a copy of the backup directory.", err)
+	}
+	if r.keys.Version != keysVersion {
+		return fmt.Errorf("Unsupported repository version %d (this RestoreSafe version uses %d). Remedy: Use the RestoreSafe version that created the repository.", r.keys.Version, keysVersion)
+	}
+	if len(r.keys.IDKey) != security.KeySize || len(r.keys.DataKey) != security.KeySize {
+		return fmt.Errorf("Invalid repository keys. Remedy: Restore the repository directory from a copy of the backup directory.")
+	}
+	return nil
+}
+
+// loadIndex reads the index of every complete pack.
+func (r *Repository) loadIndex() error {
+	des, err := r.storage.List(filepath.Join(r.dir, packsDirName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("Failed to read repository packs: %w", err)
+	}
+	for _, de := range des {
+		name, ok := strings.CutSuffix(de.Name(), indexFileSuffix)
+		if !ok || de.IsDir() {
+			continue
+		}
+		entries, err := r.readPackIndex(name)
+		if err != nil {
+			return err
+		}
+		r.packs[name] = entries
+		for _, e := range entries {
+			r.index[e.ID] = location{pack: name, offset: e.Offset, length: e.Length}
+		}
+	}
+	return nil
+}
+
+func (r *Repository) readPackIndex(name string) ([]indexEntry, error) {
+	path := r.indexPath(name)
+	sealed, err := util.ReadStorageFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read pack index %q: %w", filepath.Base(path), err)
+	}
+	plain, err := security.OpenBlob(r.keys.DataKey, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("Pack index %q is damaged: %w. Remedy: Restore the repository directory from a copy of the backup directory.", filepath.Base(path), err)
+	}
+	var idx packIndex
+	if err := json.Unmarshal(plain, &idx); err != nil {
+		return nil, fmt.Errorf("Pack index %q is damaged: %w. Remedy: Restore the repository directory from a copy of the backup directory.", filepath.Base(path), err)
+	}
+	return idx.Chunks, nil
+}
+
+// ChunkCount returns the number of chunks in the repository.
+func (r *Repository) ChunkCount() int {
+	return len(r.index)
+}
+
+// Stats returns the chunks written since the repository was opened.
+func (r *Repository) Stats() Stats {
+	return r.stats
+}
+
+// StoredContent describes content added with Store.
+type StoredContent struct {
+	// Chunks lists the chunk IDs of the content in order.
+	Chunks []string
+	SHA256 []byte
+	Size   int64
+}
+
+// Store splits src into chunks and adds the chunks the repository does not hold yet.
+func (r *Repository) Store(src io.Reader) (StoredContent, error) {
+	sum := sha256.New()
+	chunker := NewChunker(io.TeeReader(src, sum))
+	var content StoredContent
+	for {
+		data, err := chunker.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return StoredContent{}, err
+		}
+		id := r.chunkID(data)
+		if _, ok := r.index[id]; ok {
+			r.stats.ReusedChunks++
+		} else if err := r.addChunk(id, data); err != nil {
+			return StoredContent{}, err
+		}
+		content.Chunks = append(content.Chunks, id)
+		content.Size += int64(len(data))
+	}
+	content.SHA256 = sum.Sum(nil)
+	return content, nil
+}
+
+func (r *Repository) chunkID(data []byte) string {
+	mac := hmac.New(sha256.New, r.keys.IDKey)
+	mac.Write(data) //nolint:errcheck
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (r *Repository) addChunk(id string, data []byte) error {
+	sealed, err := security.SealBlob(r.keys.DataKey, data)
+	if err != nil {
+		return err
+	}
+	if err := r.appendSealed(id, sealed); err != nil {
+		return err
+	}
+	r.stats.NewChunks++
+	r.stats.StoredBytes += int64(len(sealed))
+	return nil
+}
+
+// appendSealed writes an already sealed chunk to the current pack.
+func (r *Repository) appendSealed(id string, sealed []byte) error {
+	if r.current == nil {
+		pack, err := r.newPack()
+		if err != nil {
+			return err
+		}
+		r.current = pack
+	}
+	pack := r.current
+	if _, err := pack.file.Write(sealed); err != nil {
+		return fmt.Errorf("Failed to write pack %q: %w. Remedy: Check free space in the backup directory.", pack.name+packFileSuffix, err)
+	}
+	entry := indexEntry{ID: id, Offset: pack.size, Length: int64(len(sealed))}
+	pack.entries = append(pack.entries, entry)
+	pack.size += entry.Length
+	r.index[id] = location{pack: pack.name, offset: entry.Offset, length: entry.Length}
+
+	if pack.size >= r.packSize {
+		return r.finishPack()
+	}
+	return nil
+}
+
+func (r *Repository) newPack() (*packWriter, error) {
+	var raw [16]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return nil, fmt.Errorf("Failed to generate pack name: %w", err)
+	}
+	name := hex.EncodeToString(raw[:])
+	if err := r.storage.MkdirAll(filepath.Join(r.dir, packsDirName)); err != nil {
+		return nil, fmt.Errorf("Failed to create repository directory: %w. Remedy: Check write permissions in the backup directory.", err)
+	}
+	f, err := r.storage.CreateNew(r.packPath(name))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create pack: %w. Remedy: Check write permissions in the backup directory.", err)
+	}
+	return &packWriter{name: name, file: f}, nil
+}
+
+// finishPack syncs the current pack and writes its index, which adds the pack to
+// the repository.
+func (r *Repository) finishPack() error {
+	pack := r.current
+	r.current = nil
+	syncErr := pack.file.Sync()
+	closeErr := pack.file.Close()
+	if err := errors.Join(syncErr, closeErr); err != nil {
+		return fmt.Errorf("Failed to write pack %q: %w. Remedy: Check free space in the backup directory.", pack.name+packFileSuffix, err)
+	}
+
+	plain, err := json.Marshal(packIndex{Chunks: pack.entries})
+	if err != nil {
+		return err
+	}
+	sealed, err := security.SealBlob(r.keys.DataKey, plain)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(r.storage, r.indexPath(pack.name), sealed); err != nil {
+		return fmt.Errorf("Failed to write pack index %q: %w. Remedy: Check free space in the backup directory.", pack.name+indexFileSuffix, err)
+	}
+	r.packs[pack.name] = pack.entries
+	return nil
+}
+
+// Flush completes the current pack, so every chunk stored so far is part of the
+// repository. Snapshots must only be written after Flush.
+func (r *Repository) Flush() error {
+	if r.current == nil {
+		return nil
+	}
+	return r.finishPack()
+}
+
+// Close flushes pending chunks and closes open packs.
+func (r *Repository) Close() error {
+	err := r.Flush()
+	for name, f := range r.readers {
+		f.Close() //nolint:errcheck
+		delete(r.readers, name)
+	}
+	return err
+}
+
+// ReadChunk returns the content of the chunk with id. The content is authenticated
+// and checked against the chunk ID.
+func (r *Repository) ReadChunk(id string) ([]byte, error) {
+	loc, ok := r.index[id]
+	if !ok {
+		return nil, fmt.Errorf("Chunk %s is missing from the repository. Remedy: Restore the repository directory from a copy of the backup directory; files that use this chunk cannot be restored.", shortID(id))
+	}
+	sealed, err := r.readSealed(loc)
+	if err != nil {
+		return nil, err
+	}
+	data, err := security.OpenBlob(r.keys.DataKey, sealed)
+	if err == nil && r.chunkID(data) != id {
+		err = errors.New("content does not match the chunk ID")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Chunk %s in pack %s is damaged: %w. Remedy: Restore the repository directory from a copy of the backup directory; files that use this chunk cannot be restored.", shortID(id), loc.pack+packFileSuffix, err)
+	}
+	return data, nil
+}
+
+func (r *Repository) readSealed(loc location) ([]byte, error) {
+	f, ok := r.readers[loc.pack]
+	if !ok {
+		var err error
+		if f, err = r.storage.Open(r.packPath(loc.pack)); err != nil {
+			return nil, fmt.Errorf("Failed to open pack %q: %w. Remedy: Restore the repository directory from a copy of the backup directory.", loc.pack+packFileSuffix, err)
+		}
+		r.readers[loc.pack] = f
+	}
+	sealed := make([]byte, loc.length)
+	if _, err := f.ReadAt(sealed, loc.offset); err != nil {
+		return nil, fmt.Errorf("Failed to read pack %q: %w. Remedy: Restore the repository directory from a copy of the backup directory.", loc.pack+packFileSuffix, err)
+	}
+	return sealed, nil
+}
+
+func (r *Repository) packPath(name string) string {
+	return filepath.Join(r.dir, packsDirName, name+packFileSuffix)
+}
+
+func (r *Repository) indexPath(name string) string {
+	return filepath.Join(r.dir, packsDirName, name+indexFileSuffix)
+}
+
+// shortID shortens a chunk ID for messages.
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames it, so
+// readers never see a partially written file.
+func writeFileAtomic(storage util.Storage, path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := storage.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, writeErr := f.Write(data)
+	syncErr := f.Sync()
+	closeErr := f.Close()
+	if err := errors.Join(writeErr, syncErr, closeErr); err != nil {
+		storage.Remove(tmp) //nolint:errcheck
+		return err
+	}
+	if err := storage.Rename(tmp, path); err != nil {
+		storage.Remove(tmp) //nolint:errcheck
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testParams = security.Argon2Params{Time: 1, MemoryKB: 8 * 1024, Threads: 1}
+
+func TestStoreDeduplicatesAndReadsBackChunks(t *testing.T) {
+	t.Parallel()
+
+	backupDir := t.TempDir()
+	password := []byte("repository-password")
+	repo, err := OpenOrCreate(backupDir, password, testParams, 1024*1024)
+	if err != nil {
+		t.Fatalf("OpenOrCreate returned error: %v", err)
+	}
+	data := randomData(3, 3*MaxChunkSize)
+
+	first, err := repo.Store(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Store returned error: %v", err)
+	}
+	if first.Size != int64(len(data)) || len(first.Chunks) < 2 {
+		t.Fatalf("unexpected stored content: size %d, %d chunk(s)", first.Size, len(first.Chunks))
+	}
+	stored := repo.Stats().StoredBytes
+	second, err := repo.Store(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Store returned error: %v", err)
+	}
+	if repo.Stats().StoredBytes != stored || repo.Stats().ReusedChunks != len(second.Chunks) {
+		t.Fatalf("expected identical content to be stored once, stats: %#v", repo.Stats())
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	reopened, err := Open(backupDir, password)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer reopened.Close()
+	if reopened.ChunkCount() != len(first.Chunks) {
+		t.Fatalf("expected %d chunk(s) after reopening, got %d", len(first.Chunks), reopened.ChunkCount())
+	}
+	var joined []byte
+	for _, id := range first.Chunks {
+		chunk, err := reopened.ReadChunk(id)
+		if err != nil {
+			t.Fatalf("ReadChunk returned error: %v", err)
+		}
+		joined = append(joined, chunk...)
+	}
+	if !bytes.Equal(joined, data) {
+		t.Fatalf("chunks read back do not match the stored content")
+	}
+}
+
+func TestOpenRejectsWrongPassword(t *testing.T) {
+	t.Parallel()
+
+	backupDir := t.TempDir()
+	repo, err := OpenOrCreate(backupDir, []byte("right"), testParams, 1024*1024)
+	if err != nil {
+		t.Fatalf("OpenOrCreate returned error: %v", err)
+	}
+	repo.Close() //nolint:errcheck
+
+	if _, err := Open(backupDir, []byte("wrong")); !errors.Is(err, security.ErrWrongPassword) {
+		t.Fatalf("expected wrong password error, got: %v", err)
+	}
+}
+
+func TestReadChunkDetectsDamagedPack(t *testing.T) {
+	t.Parallel()
+
+	backupDir := t.TempDir()
+	password := []byte("repository-password")
+	repo, err := OpenOrCreate(backupDir, password, testParams, 1024*1024)
+	if err != nil {
+		t.Fatalf("OpenOrCreate returned error: %v", err)
+	}
+	content, err := repo.Store(bytes.NewReader([]byte("some file content")))
+	if err != nil {
+		t.Fatalf("Store returned error: %v", err)
+	}
+	repo.Close() //nolint:errcheck
+
+	packs, _ := filepath.Glob(filepath.Join(Dir(backupDir), packsDirName, "*"+packFileSuffix))
+	if len(packs) != 1 {
+		t.Fatalf("expected one pack, got %v", packs)
+	}
+	data, _ := os.ReadFile(packs[0])
+	data[len(data)-1] ^= 0xFF
+	if err := os.WriteFile(packs[0], data, 0o600); err != nil {
+		t.Fatalf("failed to damage pack: %v", err)
+	}
+
+	reopened, err := Open(backupDir, password)
+	if err != nil {
+		t.Fatalf("Open returned error: %v", err)
+	}
+	defer reopened.Close()
+	if _, err := reopened.ReadChunk(content.Chunks[0]); err == nil {
+		t.Fatal("expected damaged chunk to be rejected")
+	}
+}
+
+func TestSnapshotDirectoryRoundTripsThroughTar(t *testing.T) {
+	t.Parallel()
+
+	workspace := t.TempDir()
+	srcDir := filepath.Join(workspace, "Docs")
+	backupDir := filepath.Join(workspace, "target")
+	password := []byte("repository-password")
+	writeTestFile(t, srcDir, "a.txt", "alpha")
+	writeTestFile(t, srcDir, "sub/b.txt", "bravo")
+	writeTestFile(t, srcDir, "sub/copy.txt", "alpha")
+	if err := os.MkdirAll(backupDir, 0o750); err != nil {
+		t.Fatalf("failed to create backup dir: %v", err)
+	}
+
+	repo, err := OpenOrCreate(backupDir, password, testParams, 1024*1024)
+	if err != nil {
+		t.Fatalf("OpenOrCreate returned error: %v", err)
+	}
+	defer repo.Close()
+	entry := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-14", ID: util.BackupID("SNP001")}
+	path := util.SnapshotFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID)
+	if err := repo.SnapshotDirectory(srcDir, entry.DirectoryName, path, manifest.Header{Backup: entry.String()}, password, testParams); err != nil {
+		t.Fatalf("SnapshotDirectory returned error: %v", err)
+	}
+	if repo.Stats().NewChunks != 2 || repo.Stats().ReusedChunks != 1 {
+		t.Fatalf("expected the duplicate file to reuse its chunk, stats: %#v", repo.Stats())
+	}
+
+	entries, ok, err := manifest.LoadForBackup(backupDir, entry, password)
+	if err != nil || !ok {
+		t.Fatalf("expected the snapshot to load as manifest, ok=%v err=%v", ok, err)
+	}
+	contents := make(map[string]string)
+	err = repo.StreamTar(entries, func(r io.Reader) error {
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if hdr.Typeflag == tar.TypeReg {
+				data, err := io.ReadAll(tr)
+				if err != nil {
+					return err
+				}
+				contents[hdr.Name] = string(data)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatalf("StreamTar returned error: %v", err)
+	}
+	want := map[string]string{"a.txt": "alpha", "sub/b.txt": "bravo", "sub/copy.txt": "alpha"}
+	if len(contents) != len(want) {
+		t.Fatalf("expected %v, got %v", want, contents)
+	}
+	for name, content := range want {
+		if contents[name] != content {
+			t.Fatalf("expected %s to contain %q, got %q", name, content, contents[name])
+		}
+	}
+}
+
+func writeTestFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		t.Fatalf("failed to create directory for %s: %v", name, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+}
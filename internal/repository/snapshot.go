@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SnapshotDirectory stores the files of srcDir in the repository and writes the
+// encrypted snapshot listing them to path. The directory is walked like a split-TAR
+// backup, with the same entry order and exclusions, but file content goes into
+// chunks instead of an archive. The snapshot is only written once all its chunks
+// are part of the repository; on error no snapshot is left behind. When srcDir is a
+// single file, the snapshot holds one entry called name.
+func (r *Repository) SnapshotDirectory(srcDir, name, path string, header manifest.Header, password []byte, params security.Argon2Params, excludeDirs ...string) error {
+	mw, err := manifest.Create(path, header, password, params)
+	if err != nil {
+		return err
+	}
+
+	stored := make(map[string]StoredContent)
+	opts := util.TarWriteOptions{
+		FileName: name,
+		SkipContent: func(path, name string, _ os.FileInfo) (bool, error) {
+			f, err := os.Open(path)
+			if err != nil {
+				return false, fmt.Errorf("Failed to open file %q: %w", path, err)
+			}
+			defer f.Close()
+			content, err := r.Store(f)
+			if err != nil {
+				return false, fmt.Errorf("Failed to store file %q: %w", path, err)
+			}
+			stored[name] = content
+			return true, nil
+		},
+		OnEntry: func(e util.TarEntry) error {
+			entry := manifest.EntryFromTar(e)
+			// Offsets refer to the header-only walk and have no meaning in a snapshot.
+			entry.HeaderOffset, entry.DataOffset = 0, 0
+			if content, ok := stored[entry.Path]; ok {
+				// The size read may differ from the size listed when the file changed meanwhile.
+				entry.Chunks, entry.Size = content.Chunks, content.Size
+				entry.SHA256 = hex.EncodeToString(content.SHA256)
+				delete(stored, entry.Path)
+			}
+			return mw.Add(entry)
+		},
+	}
+	if err := util.WriteTarWithOptions(io.Discard, srcDir, opts, excludeDirs...); err != nil {
+		mw.Abort()
+		return err
+	}
+	if err := r.Flush(); err != nil {
+		mw.Abort()
+		return err
+	}
+	return mw.Close()
+}
+
+// WriteTar writes the entries of a snapshot as a TAR stream to w, reading the
+// content of every file from its chunks. The stream has the same layout as the
+// archive of a split-TAR backup, so restore and verify can process it unchanged.
+func (r *Repository) WriteTar(w io.Writer, entries []manifest.Entry) error {
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		if e.Deleted() {
+			continue
+		}
+		if err := tw.WriteHeader(e.Header()); err != nil {
+			return fmt.Errorf("Failed to write %s: %w", e.Path, err)
+		}
+		if e.Type != "file" {
+			continue
+		}
+		var written int64
+		for _, id := range e.Chunks {
+			data, err := r.ReadChunk(id)
+			if err != nil {
+				return fmt.Errorf("Failed to read %s: %w", e.Path, err)
+			}
+			if _, err := tw.Write(data); err != nil {
+				return fmt.Errorf("Failed to write %s: %w", e.Path, err)
+			}
+			written += int64(len(data))
+		}
+		if written != e.Size {
+			return fmt.Errorf("Snapshot entry %s lists %d byte(s) of chunks for a file of %d byte(s). Remedy: The snapshot is damaged; restore it from a copy of the backup directory.", e.Path, written, e.Size)
+		}
+	}
+	return tw.Close()
+}
+
+var errStreamClosed = errors.New("TAR stream closed by the reader")
+
+// StreamTar runs WriteTar in the background and passes the TAR stream to consume.
+// An error while reading chunks takes precedence over the error of consume, which
+// usually only reports the interrupted stream.
+func (r *Repository) StreamTar(entries []manifest.Entry, consume func(io.Reader) error) error {
+	pr, pw := io.Pipe()
+	writeErrCh := make(chan error, 1)
+	go func() {
+		err := r.WriteTar(pw, entries)
+		pw.CloseWithError(err) //nolint:errcheck
+		writeErrCh <- err
+	}()
+
+	consumeErr := consume(pr)
+	if consumeErr == nil {
+		// Let the writer finish the end-of-archive marker.
+		_, consumeErr = io.Copy(io.Discard, pr)
+	}
+	pr.CloseWithError(errStreamClosed) //nolint:errcheck
+	if writeErr := <-writeErrCh; writeErr != nil && !errors.Is(writeErr, errStreamClosed) {
+		return writeErr
+	}
+	return consumeErr
+}
@@ -0,0 +1,97 @@
+package restore
+
+import (
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/util"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resolveConflictPolicy returns the conflict policy from opts, or prompts for it
+// when the restore runs interactively and a restore directory (or, for the backup of
+// a single file, the restored file) already exists. A directory that holds an
+// interrupted restore of the entry is continued without asking.
+func resolveConflictPolicy(selected []util.BackupEntry, backupDir, restorePath string, opts *Options) (util.ConflictPolicy, error) {
+	if opts != nil {
+		if opts.Conflict == "" {
+			return util.ConflictFail, nil
+		}
+		return opts.Conflict, nil
+	}
+
+	var existing []string
+	for _, entry := range selected {
+		outputDir := filepath.Join(restorePath, entry.DirectoryName)
+		info, err := os.Stat(outputDir)
+		if err != nil {
+			continue
+		}
+		singleFile := isSingleFileBackup(backupDir, entry)
+		if _, resumable, _ := readRestoreCheckpoint(restorePath, entry); resumable && !singleFile && info.IsDir() {
+			continue
+		}
+		if info.IsDir() || singleFile && info.Mode().IsRegular() {
+			existing = append(existing, displayRestoreOutputDir(outputDir))
+		}
+	}
+	if len(existing) == 0 {
+		return util.ConflictFail, nil
+	}
+	return promptConflictPolicy(existing)
+}
+
+func promptConflictPolicy(existing []string) (util.ConflictPolicy, error) {
+	for {
+		fmt.Println("Restore directory(s) already exist:")
+		for _, dir := range existing {
+			fmt.Printf("  - %s\n", dir)
+		}
+		fmt.Println()
+		fmt.Printf("Choose how to handle files that already exist:\n")
+		fmt.Printf("  - Enter s → skip: keep existing files\n")
+		fmt.Printf("  - Enter o → overwrite: replace existing files\n")
+		fmt.Printf("  - Enter n → overwrite-newer: replace existing files only if the backed-up file is newer\n")
+		fmt.Printf("  - Enter r → rename: restore next to existing files (e.g. \"report (restored).xlsx\")\n")
+		fmt.Printf("  - Enter q → cancel\n")
+		fmt.Println()
+
+		answer, err := readLineFn("Conflict policy: ")
+		if err != nil {
+			return "", err
+		}
+		fmt.Println()
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "s":
+			return util.ConflictSkip, nil
+		case "o":
+			return util.ConflictOverwrite, nil
+		case "n":
+			return util.ConflictOverwriteNewer, nil
+		case "r":
+			return util.ConflictRename, nil
+		case "q":
+			return "", operation.ErrSelectionCancelled
+		default:
+			fmt.Println("Please enter s, o, n, r or q.")
+			fmt.Println()
+		}
+	}
+}
+
+func logConflictDecision(log *util.Logger, decision util.ConflictDecision) {
+	switch decision.Action {
+	case util.ConflictActionSkipped:
+		log.InfoLogOnly("  Conflict: %s - skipped (%s)", decision.Path, decision.Reason)
+	case util.ConflictActionOverwritten:
+		if decision.Reason != "" {
+			log.InfoLogOnly("  Conflict: %s - overwritten (%s)", decision.Path, decision.Reason)
+		} else {
+			log.InfoLogOnly("  Conflict: %s - overwritten", decision.Path)
+		}
+	case util.ConflictActionRenamed:
+		log.InfoLogOnly("  Conflict: %s - restored as %s", decision.Path, filepath.Base(decision.RenamedTo))
+	}
+}
@@ -0,0 +1,97 @@
+package restore
+
+import (
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRestoreEntryIntoExistingDirectorySkipsExistingFiles(t *testing.T) {
+	password := []byte("conflict-skip-password")
+	fx := testutil.NewRestoreFixture(t, password)
+
+	outDir := filepath.Join(fx.RestoreRoot, fx.Entry.DirectoryName)
+	existing := filepath.Join(outDir, "nested", "small.txt")
+	if err := os.MkdirAll(filepath.Dir(existing), 0o750); err != nil {
+		t.Fatalf("failed to create existing directory: %v", err)
+	}
+	if err := os.WriteFile(existing, []byte("local edit"), 0o600); err != nil {
+		t.Fatalf("failed to create existing file: %v", err)
+	}
+
+	if _, err := restoreEntry(fx.Entry, fx.BackupDir, fx.RestoreRoot, password, nil, util.ExtractOptions{Conflict: util.ConflictSkip}); err != nil {
+		t.Fatalf("restoreEntry failed: %v", err)
+	}
+
+	if got, _ := os.ReadFile(existing); string(got) != "local edit" {
+		t.Fatalf("expected existing file to be kept, got %q", got)
+	}
+	testutil.AssertFileContentEqual(t,
+		filepath.Join(fx.SrcDir, "large.bin"),
+		filepath.Join(outDir, "large.bin"),
+	)
+}
+
+func TestBuildRestorePreflightAllowsExistingDirectoryWithPolicy(t *testing.T) {
+	password := []byte("conflict-preflight-password")
+	fx := testutil.NewRestoreFixture(t, password)
+
+	outDir := filepath.Join(fx.RestoreRoot, fx.Entry.DirectoryName)
+	if err := os.MkdirAll(outDir, 0o750); err != nil {
+		t.Fatalf("failed to create existing directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "large.bin"), []byte("old"), 0o600); err != nil {
+		t.Fatalf("failed to create existing file: %v", err)
+	}
+
+	items := buildRestorePreflight([]util.BackupEntry{fx.Entry}, fx.BackupDir, fx.RestoreRoot, util.ConflictOverwrite)
+	if items[0].OutputDirErr != nil || !items[0].OutputDirExists {
+		t.Fatalf("expected existing directory to be accepted, got %+v", items[0])
+	}
+	if !restoreNeedsScan(items, util.ExtractOptions{Conflict: util.ConflictOverwrite}) {
+		t.Fatal("expected a scan for an existing restore directory")
+	}
+	if err := scanRestoreArchives(items, fx.BackupDir, password, util.ExtractOptions{Conflict: util.ConflictOverwrite}); err != nil {
+		t.Fatalf("scanRestoreArchives failed: %v", err)
+	}
+	if items[0].Conflicts != 1 || items[0].Selective {
+		t.Fatalf("expected one conflict without file selection, got %+v", items[0])
+	}
+
+	var sb strings.Builder
+	printRestorePreflightWithYubiKeyCheck(&sb, &util.Config{}, fx.BackupDir, fx.RestoreRoot, items, util.ConflictOverwrite, false, false, operation.LocalStagingPlan{}, func() error { return nil })
+	output := sb.String()
+	if !strings.Contains(output, "(existing directory, conflicts: 1)") || !strings.Contains(output, "Conflict policy: overwrite") {
+		t.Fatalf("expected conflict details in preflight output, got:\n%s", output)
+	}
+}
+
+func TestPromptConflictPolicyMapsAnswers(t *testing.T) {
+	prevReadLine := readLineFn
+	t.Cleanup(func() { readLineFn = prevReadLine })
+
+	for answer, want := range map[string]util.ConflictPolicy{"s": util.ConflictSkip, "O": util.ConflictOverwrite, "n": util.ConflictOverwriteNewer, "r": util.ConflictRename} {
+		readLineFn = func(string) (string, error) { return answer, nil }
+		var got util.ConflictPolicy
+		var err error
+		testutil.CaptureStdout(t, func() {
+			got, err = promptConflictPolicy([]string{"D:/Restore/Docs"})
+		})
+		if err != nil || got != want {
+			t.Fatalf("answer %q: expected %q, got %q (err=%v)", answer, want, got, err)
+		}
+	}
+
+	readLineFn = func(string) (string, error) { return "q", nil }
+	testutil.CaptureStdout(t, func() {
+		_, err := promptConflictPolicy([]string{"D:/Restore/Docs"})
+		if !errors.Is(err, operation.ErrSelectionCancelled) {
+			t.Errorf("expected ErrSelectionCancelled, got %v", err)
+		}
+	})
+}
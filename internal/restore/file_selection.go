@@ -0,0 +1,202 @@
+package restore
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// resolveFileSelection returns the extraction options from opts, or prompts for
+// them when the restore runs interactively.
+func resolveFileSelection(opts *Options) (util.ExtractOptions, error) {
+	var patterns []string
+	flatten := false
+	if opts == nil {
+		var err error
+		patterns, flatten, err = promptFileSelection()
+		if err != nil {
+			return util.ExtractOptions{}, err
+		}
+	} else {
+		patterns = opts.Include
+		flatten = opts.Flatten
+	}
+
+	selector, err := util.NewPathSelector(patterns)
+	if err != nil {
+		return util.ExtractOptions{}, err
+	}
+	if selector.IsEmpty() && flatten {
+		return util.ExtractOptions{}, fmt.Errorf("Flattened restore requires a file selection. Remedy: Pass at least one -include pattern together with -flatten.")
+	}
+	return util.ExtractOptions{Selector: selector, Flatten: flatten}, nil
+}
+
+func promptFileSelection() ([]string, bool, error) {
+	for {
+		fmt.Printf("Select files to restore:\n")
+		fmt.Printf("  - Press Enter → restore all files\n")
+		fmt.Printf("  - Enter path(s) or pattern(s) relative to the backed-up directory, separated by ; (e.g. Reports/2025;*.xlsx) → restore only matching files and directories\n")
+		fmt.Printf("  - Enter q → cancel\n")
+		fmt.Println()
+
+		input, err := readLineFn("File selection: ")
+		if err != nil {
+			return nil, false, err
+		}
+		fmt.Println()
+		input = strings.TrimSpace(input)
+
+		switch input {
+		case "":
+			return nil, false, nil
+		case "q":
+			return nil, false, operation.ErrSelectionCancelled
+		}
+
+		patterns := util.ParseSelectionPatterns(input)
+		if _, err := util.NewPathSelector(patterns); err != nil {
+			fmt.Printf("%v\n\n", err)
+			continue
+		}
+
+		flatten, err := promptFlatten()
+		if err != nil {
+			return nil, false, err
+		}
+		return patterns, flatten, nil
+	}
+}
+
+func promptFlatten() (bool, error) {
+	for {
+		answer, err := readLineFn("Keep directory structure? [Y/n]: ")
+		if err != nil {
+			return false, err
+		}
+		fmt.Println()
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "", "y", "yes":
+			return false, nil
+		case "n", "no":
+			return true, nil
+		default:
+			fmt.Println("Please enter y (yes) or n (no).")
+		}
+	}
+}
+
+// restoreNeedsScan reports whether the preflight must read the archives: to count
+// files matching a file selection or files conflicting with an existing restore directory.
+func restoreNeedsScan(items []restorePreflightItem, opts util.ExtractOptions) bool {
+	if !opts.Selector.IsEmpty() {
+		return true
+	}
+	for _, item := range items {
+		if item.OutputDirExists {
+			return true
+		}
+	}
+	return false
+}
+
+// scanRestoreArchives counts the files matching the file selection and the files
+// that already exist in an existing restore directory for every valid preflight item.
+func scanRestoreArchives(items []restorePreflightItem, backupDir string, password []byte, opts util.ExtractOptions) error {
+	selective := !opts.Selector.IsEmpty()
+	for i := range items {
+		item := &items[i]
+		item.Selective = selective
+		if item.Err != nil || (!selective && !item.OutputDirExists) {
+			continue
+		}
+
+		parts, err := catalog.CollectParts(backupDir, item.Entry)
+		if err != nil {
+			item.Err = err
+			continue
+		}
+
+		destDir := ""
+		if item.OutputDirExists {
+			destDir = item.extractDir()
+		}
+
+		var stats util.TarSelectionStats
+		if headers, ok := manifestHeaders(backupDir, item.Entry, password); ok {
+			stats, err = util.ScanHeaderSelection(headers, destDir, opts)
+		} else {
+			err = operation.RunDecryptReader(
+				parts,
+				password,
+				nil,
+				item.Entry.DirectoryName,
+				"scanned",
+				"Archive scan",
+				func(r io.ReadSeeker) error {
+					var scanErr error
+					stats, scanErr = util.ScanTarSelection(r, destDir, opts)
+					return scanErr
+				},
+				nil,
+			)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to scan %q: %w", item.Entry.String(), err)
+		}
+
+		item.MatchedFiles = stats.Files
+		item.MatchedBytes = stats.Bytes
+		item.Conflicts = stats.Conflicts
+		if selective && item.MatchedFiles == 0 {
+			// Nothing is written for this entry, so an existing output directory is harmless.
+			item.OutputDirErr = nil
+		}
+	}
+	return nil
+}
+
+// manifestHeaders returns the TAR headers recorded in the manifest of entry.
+// ok is false when there is no readable manifest and the archive must be scanned.
+func manifestHeaders(backupDir string, entry util.BackupEntry, password []byte) ([]*tar.Header, bool) {
+	entries, ok, err := manifest.LoadForBackup(backupDir, entry, password)
+	if err != nil || !ok {
+		return nil, false
+	}
+	headers := make([]*tar.Header, 0, len(entries))
+	for _, e := range entries {
+		if e.Deleted() {
+			continue
+		}
+		headers = append(headers, e.Header())
+	}
+	return headers, true
+}
+
+func validateRestoreSelectionMatches(items []restorePreflightItem) error {
+	if len(items) == 0 || !items[0].Selective {
+		return nil
+	}
+	for _, item := range items {
+		if item.MatchedFiles > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("Restore preflight failed: no files match the file selection. Remedy: Check the paths and patterns; they are relative to the backed-up directory.")
+}
+
+func entriesWithMatches(items []restorePreflightItem) []util.BackupEntry {
+	entries := make([]util.BackupEntry, 0, len(items))
+	for _, item := range items {
+		if item.Selective && item.MatchedFiles == 0 {
+			continue
+		}
+		entries = append(entries, item.Entry)
+	}
+	return entries
+}
@@ -0,0 +1,147 @@
+package restore
+
+import (
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRestoreEntryWithFileSelectionRestoresOnlyMatches(t *testing.T) {
+	password := []byte("selective-restore-password")
+	fx := testutil.NewRestoreFixture(t, password)
+
+	selector, err := util.NewPathSelector([]string{"nested"})
+	if err != nil {
+		t.Fatalf("NewPathSelector returned error: %v", err)
+	}
+	if _, err := restoreEntry(fx.Entry, fx.BackupDir, fx.RestoreRoot, password, nil, util.ExtractOptions{Selector: selector}); err != nil {
+		t.Fatalf("restoreEntry failed: %v", err)
+	}
+
+	restoredDir := filepath.Join(fx.RestoreRoot, fx.Entry.DirectoryName)
+	testutil.AssertFileContentEqual(t,
+		filepath.Join(fx.SrcDir, "nested", "small.txt"),
+		filepath.Join(restoredDir, "nested", "small.txt"),
+	)
+	if _, err := os.Stat(filepath.Join(restoredDir, "large.bin")); !os.IsNotExist(err) {
+		t.Fatalf("expected large.bin to be skipped, stat err=%v", err)
+	}
+}
+
+func TestRestoreEntryWithFlattenWritesIntoOutputDir(t *testing.T) {
+	password := []byte("flatten-restore-password")
+	fx := testutil.NewRestoreFixture(t, password)
+
+	selector, err := util.NewPathSelector([]string{"**/small.txt"})
+	if err != nil {
+		t.Fatalf("NewPathSelector returned error: %v", err)
+	}
+	opts := util.ExtractOptions{Selector: selector, Flatten: true}
+	if _, err := restoreEntry(fx.Entry, fx.BackupDir, fx.RestoreRoot, password, nil, opts); err != nil {
+		t.Fatalf("restoreEntry failed: %v", err)
+	}
+
+	testutil.AssertFileContentEqual(t,
+		filepath.Join(fx.SrcDir, "nested", "small.txt"),
+		filepath.Join(fx.RestoreRoot, fx.Entry.DirectoryName, "small.txt"),
+	)
+}
+
+func TestScanRestoreSelectionCountsMatchesPerEntry(t *testing.T) {
+	password := []byte("scan-selection-password")
+	fx := testutil.NewRestoreFixture(t, password)
+
+	items := buildRestorePreflight([]util.BackupEntry{fx.Entry}, fx.BackupDir, fx.RestoreRoot, util.ConflictFail)
+	selector, err := util.NewPathSelector([]string{"*.bin"})
+	if err != nil {
+		t.Fatalf("NewPathSelector returned error: %v", err)
+	}
+	if err := scanRestoreArchives(items, fx.BackupDir, password, util.ExtractOptions{Selector: selector}); err != nil {
+		t.Fatalf("scanRestoreSelection failed: %v", err)
+	}
+	if !items[0].Selective || items[0].MatchedFiles != 1 {
+		t.Fatalf("expected one matching file, got %+v", items[0])
+	}
+	if got := estimateRestoreBytes(items); got != items[0].MatchedBytes {
+		t.Fatalf("expected estimate to use matched bytes %d, got %d", items[0].MatchedBytes, got)
+	}
+}
+
+func TestPrintRestorePreflightShowsMatchedFiles(t *testing.T) {
+	t.Parallel()
+
+	restorePath := t.TempDir()
+	items := []restorePreflightItem{
+		{Entry: util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-20", ID: util.BackupID("ABC123")}, PartCount: 2, OutputDir: filepath.Join(restorePath, "Docs"), Selective: true, MatchedFiles: 7, MatchedBytes: 1024},
+		{Entry: util.BackupEntry{DirectoryName: "Photos", Date: "2026-03-20", ID: util.BackupID("ABC123")}, PartCount: 3, OutputDir: filepath.Join(restorePath, "Photos"), Selective: true},
+	}
+
+	var sb strings.Builder
+	printRestorePreflightWithYubiKeyCheck(&sb, &util.Config{}, t.TempDir(), restorePath, items, util.ConflictFail, false, false, operation.LocalStagingPlan{}, func() error { return nil })
+	output := sb.String()
+
+	if !strings.Contains(output, "(parts: 2, matched files: 7)") {
+		t.Fatalf("expected matched file count in preflight output, got:\n%s", output)
+	}
+	if !strings.Contains(output, "[WARN] Photos_2026-03-20_ABC123 (parts: 3, matched files: 0)") {
+		t.Fatalf("expected warning for entry without matches, got:\n%s", output)
+	}
+	if strings.Contains(output, "Photos\n") {
+		t.Fatalf("expected skipped entry to be omitted from restored directories, got:\n%s", output)
+	}
+}
+
+func TestValidateRestoreSelectionMatchesRejectsNoMatches(t *testing.T) {
+	t.Parallel()
+
+	items := []restorePreflightItem{{Selective: true}, {Selective: true}}
+	if err := validateRestoreSelectionMatches(items); err == nil {
+		t.Fatal("expected error when no entry has matching files, got nil")
+	}
+
+	items[1].MatchedFiles = 1
+	if err := validateRestoreSelectionMatches(items); err != nil {
+		t.Fatalf("expected no error with matches, got: %v", err)
+	}
+	if got := entriesWithMatches(items); len(got) != 1 {
+		t.Fatalf("expected 1 entry with matches, got %d", len(got))
+	}
+}
+
+func TestResolveFileSelectionPromptsForPatternsAndStructure(t *testing.T) {
+	answers := []string{"Reports/2025; *.xlsx", "n"}
+	prevReadLine := readLineFn
+	t.Cleanup(func() { readLineFn = prevReadLine })
+	readLineFn = func(string) (string, error) {
+		answer := answers[0]
+		answers = answers[1:]
+		return answer, nil
+	}
+
+	var opts util.ExtractOptions
+	var err error
+	testutil.CaptureStdout(t, func() {
+		opts, err = resolveFileSelection(nil)
+	})
+	if err != nil {
+		t.Fatalf("resolveFileSelection returned error: %v", err)
+	}
+	if got := opts.Selector.Patterns(); len(got) != 2 || got[0] != "Reports/2025" || got[1] != "*.xlsx" {
+		t.Fatalf("unexpected patterns: %q", got)
+	}
+	if !opts.Flatten {
+		t.Fatal("expected flatten when directory structure is not kept")
+	}
+}
+
+func TestResolveFileSelectionRejectsFlattenWithoutInclude(t *testing.T) {
+	t.Parallel()
+
+	if _, err := resolveFileSelection(&Options{Flatten: true}); err == nil {
+		t.Fatal("expected error for -flatten without -include, got nil")
+	}
+}
@@ -0,0 +1,160 @@
+package restore
+
+import (
+	"RestoreSafe/internal/util"
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// restoreCheckpointSuffix ends the name of the checkpoint file that lists the files
+// of a backup entry that are restored. It is written next to the restore directory,
+// like the rename report, and removed once the entry is restored completely.
+const restoreCheckpointSuffix = ".restore-checkpoint"
+
+// restoreCheckpointPath returns the path of the checkpoint of entry in destDir.
+func restoreCheckpointPath(destDir string, entry util.BackupEntry) string {
+	return filepath.Join(destDir, entry.DirectoryName+restoreCheckpointSuffix)
+}
+
+// readRestoreCheckpoint returns the archive names of the files of entry that an
+// interrupted restore into destDir already put in place. found is false when there
+// is no checkpoint, or when it belongs to the restore of another backup run.
+//
+// The first line of the checkpoint names the backup entry; every further line holds
+// one quoted archive name. A line cut off by the interruption is ignored, so that
+// file is restored again.
+func readRestoreCheckpoint(destDir string, entry util.BackupEntry) (done map[string]bool, found bool, err error) {
+	data, err := os.ReadFile(restoreCheckpointPath(destDir, entry))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to read restore checkpoint: %w. Remedy: Check read permissions in the restore destination.", err)
+	}
+	lines := strings.Split(string(data), "\n")
+	if lines[0] != entry.String() {
+		return nil, false, nil
+	}
+	done = make(map[string]bool)
+	for _, line := range lines[1:] {
+		if name, err := strconv.Unquote(line); err == nil {
+			done[name] = true
+		}
+	}
+	return done, true, nil
+}
+
+// restoreCheckpoint records the files of one backup entry as they are restored.
+type restoreCheckpoint struct {
+	path string
+	// resumed is set when the checkpoint continues an interrupted restore; done
+	// holds the files that restore put in place.
+	resumed bool
+	done    map[string]bool
+	file    *os.File
+	w       *bufio.Writer
+}
+
+// openRestoreCheckpoint opens the checkpoint of entry in destDir. An existing
+// checkpoint of entry is continued; the temporary files the interrupted restore
+// left in outDir are removed then. Otherwise a new checkpoint is started.
+func openRestoreCheckpoint(destDir, outDir string, entry util.BackupEntry) (*restoreCheckpoint, error) {
+	done, found, err := readRestoreCheckpoint(destDir, entry)
+	if err != nil {
+		return nil, err
+	}
+	path := restoreCheckpointPath(destDir, entry)
+	flag := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !found {
+		done = make(map[string]bool)
+		flag |= os.O_TRUNC
+	} else if err := removeArchiveTempFiles(outDir); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(destDir, 0o750); err != nil {
+		return nil, fmt.Errorf("Failed to create restore destination: %w. Remedy: Check write permissions and use a valid destination path.", err)
+	}
+	f, err := os.OpenFile(path, flag, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to write restore checkpoint %q: %w. Remedy: Check write permissions in the restore destination.", path, err)
+	}
+	c := &restoreCheckpoint{path: path, resumed: found, done: done, file: f, w: bufio.NewWriter(f)}
+	if !found {
+		c.w.WriteString(entry.String() + "\n") //nolint:errcheck // reported by the flush
+		if err := c.flush(); err != nil {
+			c.file.Close() //nolint:errcheck
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// apply makes opts skip the files that are already restored and record every file
+// put in place. Files restored after the last recorded one may exist already, so
+// with the default conflict policy they are overwritten instead of failing.
+func (c *restoreCheckpoint) apply(opts *util.ExtractOptions) {
+	opts.OnFileWritten = c.record
+	if !c.resumed {
+		return
+	}
+	if len(c.done) > 0 {
+		include := opts.Include
+		opts.Include = func(name string) bool {
+			return !c.done[name] && (include == nil || include(name))
+		}
+	}
+	if !opts.Conflict.AllowsExisting() {
+		opts.Conflict = util.ConflictOverwrite
+	}
+}
+
+// record adds name to the checkpoint. The line is written to the file at once, so
+// it is kept when the program is interrupted.
+func (c *restoreCheckpoint) record(name string) error {
+	c.w.WriteString(strconv.Quote(name) + "\n") //nolint:errcheck // reported by the flush
+	return c.flush()
+}
+
+func (c *restoreCheckpoint) flush() error {
+	if err := c.w.Flush(); err != nil {
+		return fmt.Errorf("Failed to write restore checkpoint %q: %w. Remedy: Check free space in the restore destination.", c.path, err)
+	}
+	return nil
+}
+
+// close closes the checkpoint and keeps it for a later resume.
+func (c *restoreCheckpoint) close() error {
+	return c.file.Close()
+}
+
+// remove closes and deletes the checkpoint once the entry is restored completely.
+func (c *restoreCheckpoint) remove() error {
+	c.file.Close() //nolint:errcheck
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to remove restore checkpoint %q: %w", c.path, err)
+	}
+	return nil
+}
+
+// removeArchiveTempFiles deletes the files below dir that an interrupted
+// extraction did not finish.
+func removeArchiveTempFiles(dir string) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(d.Name(), util.ArchiveTempSuffix) {
+			return os.Remove(path)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to remove unfinished files of the interrupted restore: %w. Remedy: Check write permissions in the restore directory.", err)
+	}
+	return nil
+}
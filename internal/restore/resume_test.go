@@ -0,0 +1,77 @@
+package restore
+
+import (
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// interruptRestore leaves what an interrupted restore of fx leaves behind: a
+// checkpoint listing nested/small.txt, that file, a partly written large.bin that
+// was not recorded yet, and a temporary file.
+func interruptRestore(t *testing.T, fx *testutil.RestoreFixture) string {
+	t.Helper()
+	outDir := filepath.Join(fx.RestoreRoot, fx.Entry.DirectoryName)
+	if err := os.MkdirAll(filepath.Join(outDir, "nested"), 0o750); err != nil {
+		t.Fatalf("failed to create restore directory: %v", err)
+	}
+	files := map[string]string{
+		filepath.Join(outDir, "nested", "small.txt"):                  "restored before the interruption",
+		filepath.Join(outDir, "large.bin"):                            "not recorded yet",
+		filepath.Join(outDir, "large.bin.123"+util.ArchiveTempSuffix): "unfinished",
+		restoreCheckpointPath(fx.RestoreRoot, fx.Entry):               fx.Entry.String() + "\n" + strconv.Quote("nested/small.txt") + "\n\"cut off",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", path, err)
+		}
+	}
+	return outDir
+}
+
+func TestRestoreEntryResumesInterruptedRestore(t *testing.T) {
+	password := []byte("restore-resume-password")
+	fx := testutil.NewRestoreFixture(t, password)
+	outDir := interruptRestore(t, fx)
+
+	if _, err := restoreEntry(fx.Entry, fx.BackupDir, fx.RestoreRoot, password, nil, util.ExtractOptions{}); err != nil {
+		t.Fatalf("restoreEntry returned error: %v", err)
+	}
+
+	// Recorded files are not restored again; all other files are.
+	if got, _ := os.ReadFile(filepath.Join(outDir, "nested", "small.txt")); string(got) != "restored before the interruption" {
+		t.Fatalf("expected the recorded file to be kept, got %q", got)
+	}
+	testutil.AssertFileContentEqual(t, filepath.Join(fx.SrcDir, "large.bin"), filepath.Join(outDir, "large.bin"))
+	if _, err := os.Stat(filepath.Join(outDir, "large.bin.123"+util.ArchiveTempSuffix)); !os.IsNotExist(err) {
+		t.Fatalf("expected the temporary file to be removed, stat err: %v", err)
+	}
+	if _, err := os.Stat(restoreCheckpointPath(fx.RestoreRoot, fx.Entry)); !os.IsNotExist(err) {
+		t.Fatalf("expected the checkpoint to be removed, stat err: %v", err)
+	}
+}
+
+func TestBuildRestorePreflightResumesInterruptedRestore(t *testing.T) {
+	password := []byte("restore-resume-password")
+	fx := testutil.NewRestoreFixture(t, password)
+	interruptRestore(t, fx)
+
+	items := buildRestorePreflight([]util.BackupEntry{fx.Entry}, fx.BackupDir, fx.RestoreRoot, util.ConflictFail)
+	if len(items) != 1 || items[0].OutputDirErr != nil || !items[0].Resume || items[0].ResumedFiles != 1 {
+		t.Fatalf("expected the restore directory to be resumed, got %+v", items)
+	}
+
+	// A checkpoint of another backup run does not make the directory resumable.
+	other := fx.Entry
+	other.ID = util.BackupID("OTHER1")
+	if err := os.WriteFile(restoreCheckpointPath(fx.RestoreRoot, fx.Entry), []byte(other.String()+"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write checkpoint: %v", err)
+	}
+	items = buildRestorePreflight([]util.BackupEntry{fx.Entry}, fx.BackupDir, fx.RestoreRoot, util.ConflictFail)
+	if items[0].Resume || items[0].OutputDirErr == nil {
+		t.Fatalf("expected the existing restore directory to be rejected, got %+v", items[0])
+	}
+}
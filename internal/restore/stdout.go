@@ -0,0 +1,206 @@
+package restore
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/repository"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// runToOutput writes one backup to opts.Output instead of restoring it into a
+// directory: the decrypted TAR archive, the raw stream of a stream backup or, with a
+// file selection, the content of the one selected file. Nothing is written to disk,
+// so there is no preflight confirmation.
+func runToOutput(cfg *util.Config, exeDir string, opts Options) error {
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	backupDir := util.ResolveDir(cfg.BackupDirectory, exeDir)
+
+	index, err := catalog.ScanBackups(backupDir)
+	if err != nil {
+		return fmt.Errorf("Failed to scan backup directory %q: %w. Remedy: Check the backup_directory path in config.yaml and ensure the directory exists and is readable.", backupDir, err)
+	}
+	selected, _, err := operation.ResolveBackupSelection(backupDir, index, opts.Backup)
+	if err != nil {
+		return err
+	}
+	if len(selected) != 1 {
+		return fmt.Errorf("Restore to standard output needs exactly one backup, but %q selects %d. Remedy: Pass the full backup name, e.g. -backup=%s.", opts.Backup, len(selected), selected[0].String())
+	}
+	entry := selected[0]
+	chain, err := catalog.ResolveChain(backupDir, entry)
+	if err != nil {
+		return err
+	}
+	if len(chain) > 1 {
+		return fmt.Errorf("%s is an incremental backup, whose archive holds only the files changed since %s. Remedy: Consolidate the backup first or restore it into a directory.", entry.String(), chain[len(chain)-2].String())
+	}
+	selector, err := util.NewPathSelector(opts.Include)
+	if err != nil {
+		return err
+	}
+
+	logPath := util.LogFileName(backupDir, entry.Date, entry.ID)
+	log := operation.OpenLogger(cfg, backupDir, entry)
+	defer log.Close()
+	ioRetries := util.WatchIORetries(log)
+	defer ioRetries.Stop()
+
+	password, err := operation.ReadPasswordWithRetry(backupDir, entry, "Enter restore password: ", log)
+	if err != nil {
+		return err
+	}
+	defer security.ZeroBytes(password)
+
+	log.Info("Restore to standard output started - %s", entry.String())
+	if err := writeEntry(out, entry, backupDir, password, log, selector); err != nil {
+		return fmt.Errorf("Failed to restore %q: %w", entry.String(), err)
+	}
+	operation.LogIORetries(ioRetries, log)
+	log.Info("Restore completed successfully.")
+	fmt.Printf("\nLog file: %s\n", logPath)
+	return nil
+}
+
+// writeEntry writes the archive of entry, or the one file matching selector, to out.
+func writeEntry(out io.Writer, entry util.BackupEntry, backupDir string, password []byte, log *util.Logger, selector *util.PathSelector) error {
+	parts, err := catalog.CollectParts(backupDir, entry)
+	if err != nil {
+		return err
+	}
+	snapshot := len(parts) == 0 && catalog.IsSnapshot(backupDir, entry)
+	if len(parts) == 0 && !snapshot {
+		return fmt.Errorf("No part files found for %s. Remedy: Put all related .enc files into the same backup directory.", entry.String())
+	}
+	entries, hasManifest, err := manifest.LoadForBackup(backupDir, entry, password)
+	if err != nil {
+		if snapshot {
+			return fmt.Errorf("Snapshot of %s could not be read: %w", entry.String(), err)
+		}
+		log.Warn("Manifest of %s could not be read, writing without integrity checks: %v", entry.String(), err)
+	}
+
+	if isStreamBackup(backupDir, entry) {
+		file, err := streamEntry(entry, entries, hasManifest)
+		if err != nil {
+			return err
+		}
+		if !selector.Match(file.Path) {
+			return errNoSelectedFile
+		}
+		return writeStream(out, entry, parts, file, password, log)
+	}
+
+	consume := func(r io.Reader) error {
+		_, err := io.Copy(out, r)
+		return err
+	}
+	if !selector.IsEmpty() {
+		var expected map[string][]byte
+		if hasManifest {
+			if err := checkSingleSelection(entries, selector); err != nil {
+				return err
+			}
+			index := manifest.NewIndex(entries)
+			expected = make(map[string][]byte)
+			for name, e := range index {
+				expected[name] = e.Sum()
+			}
+		}
+		consume = func(r io.Reader) error {
+			return writeSelectedFile(out, r, selector, expected)
+		}
+	}
+
+	if snapshot {
+		repo, err := repository.Open(backupDir, password)
+		if err != nil {
+			return fmt.Errorf("Failed to open repository: %w", err)
+		}
+		defer repo.Close()
+		return repo.StreamTar(entries, consume)
+	}
+	return operation.RunDecryptPipeline(parts, password, log, entry.DirectoryName, "decrypted", "Writing to standard output", consume, nil)
+}
+
+var errNoSelectedFile = errors.New("No file matches the file selection. Remedy: Check the -include pattern; it is relative to the backed-up directory.")
+
+// checkSingleSelection fails unless selector matches exactly one regular file in entries.
+func checkSingleSelection(entries []manifest.Entry, selector *util.PathSelector) error {
+	var matches []string
+	for _, e := range entries {
+		if e.Type == "file" && !e.Deleted() && selector.Match(e.Path) {
+			matches = append(matches, e.Path)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return errNoSelectedFile
+	case 1:
+		return nil
+	}
+	return fmt.Errorf("The file selection matches %d files (%s, ...), but standard output takes a single file. Remedy: Select exactly one file, or omit -include to write the whole TAR archive.", len(matches), strings.Join(matches[:2], ", "))
+}
+
+// writeSelectedFile reads the TAR stream r and writes the content of the one regular
+// file matching selector to out, checking it against its hash in expected if present.
+func writeSelectedFile(out io.Writer, r io.Reader, selector *util.PathSelector, expected map[string][]byte) error {
+	found := ""
+	err := util.WalkTar(r, func(hdr *tar.Header, body io.Reader) error {
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if hdr.Typeflag != tar.TypeReg || !selector.Match(name) {
+			return nil
+		}
+		if found != "" {
+			return fmt.Errorf("The file selection matches more than one file (%s, %s), but standard output takes a single file. Remedy: Select exactly one file.", found, name)
+		}
+		found = name
+		sum := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(out, sum), body); err != nil {
+			return err
+		}
+		if want := expected[name]; want != nil && !bytes.Equal(sum.Sum(nil), want) {
+			return fmt.Errorf("Integrity check failed: %s does not match the hash in the manifest. Remedy: Run verify for this backup and restore from an intact copy of the backup directory.", name)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if found == "" {
+		return errNoSelectedFile
+	}
+	return nil
+}
+
+// writeStream writes the raw stream of a stream backup to out and checks it against
+// the size and hash in the manifest.
+func writeStream(out io.Writer, entry util.BackupEntry, parts []string, file manifest.Entry, password []byte, log *util.Logger) error {
+	sum := sha256.New()
+	var size int64
+	err := operation.RunDecryptPipeline(parts, password, log, entry.DirectoryName, "decrypted", "Writing to standard output", func(r io.Reader) error {
+		n, err := io.Copy(io.MultiWriter(out, sum), r)
+		size = n
+		return err
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if size != file.Size || !bytes.Equal(sum.Sum(nil), file.Sum()) {
+		return fmt.Errorf("Integrity check failed: stream of %s does not match the size and hash in the manifest. Remedy: Run verify for this backup and restore from an intact copy of the backup directory.", entry.String())
+	}
+	log.Info("  Integrity: stream matches the hash in the manifest")
+	return nil
+}
@@ -0,0 +1,227 @@
+package restore
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/util"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// isStreamBackup reports whether entry holds the output of a command source or a stream
+// read from standard input, whose archive is the raw stream instead of a TAR.
+func isStreamBackup(backupDir string, entry util.BackupEntry) bool {
+	info, err := catalog.ReadRunInfo(backupDir, entry)
+	return err == nil && info.IsStream()
+}
+
+// streamEntry returns the single manifest entry describing the stream of a stream backup.
+func streamEntry(entry util.BackupEntry, entries []manifest.Entry, hasManifest bool) (manifest.Entry, error) {
+	if !hasManifest || len(entries) != 1 || entries[0].Type != "file" {
+		return manifest.Entry{}, fmt.Errorf("Manifest of stream backup %s is missing or invalid. Remedy: Restore the .manifest.enc file from a copy of the backup directory; a stream backup cannot be restored without it.", entry.String())
+	}
+	return entries[0], nil
+}
+
+// extractStream restores the stream of a stream backup as a file in outDir. The
+// decrypted stream is wrapped into a TAR entry described by the manifest, so the file
+// selection, conflict policy and hash check work as for every other backup.
+func extractStream(entry util.BackupEntry, parts []string, file manifest.Entry, outDir string, password []byte, log *util.Logger, opts util.ExtractOptions) (util.ExtractStats, error) {
+	var stats util.ExtractStats
+	err := operation.RunDecryptPipeline(
+		parts,
+		password,
+		log,
+		entry.DirectoryName,
+		"decrypted",
+		"Extraction",
+		func(r io.Reader) error {
+			pr, pw := io.Pipe()
+			wrapErrCh := make(chan error, 1)
+			go func() {
+				err := wrapStream(pw, file, r)
+				pw.CloseWithError(err) //nolint:errcheck
+				wrapErrCh <- err
+			}()
+			var extractErr error
+			stats, extractErr = util.ExtractTarSelected(pr, outDir, opts)
+			pr.CloseWithError(io.ErrClosedPipe) //nolint:errcheck
+			if wrapErr := <-wrapErrCh; wrapErr != nil && extractErr == nil {
+				return wrapErr
+			}
+			return extractErr
+		},
+		nil,
+	)
+	return stats, err
+}
+
+// wrapStream writes r as the only entry of a TAR stream to w. The stream must have
+// exactly the size recorded in the manifest.
+func wrapStream(w io.Writer, file manifest.Entry, r io.Reader) error {
+	tc := util.NewTarCopier(w)
+	if _, err := tc.Copy(file.Header(), r); err != nil {
+		return err
+	}
+	if err := tc.Close(); err != nil {
+		return fmt.Errorf("Stream is shorter than recorded in the manifest: %w", err)
+	}
+	extra, err := io.Copy(io.Discard, r)
+	if err != nil {
+		return err
+	}
+	if extra > 0 {
+		return fmt.Errorf("Stream is %d byte(s) longer than recorded in the manifest", extra)
+	}
+	return nil
+}
+
+// pipeStream decrypts the output of a command source into the standard input of its
+// restore command and checks size and SHA-256 of the stream against the manifest.
+func pipeStream(entry util.BackupEntry, parts []string, file manifest.Entry, source util.CommandSource, password []byte, log *util.Logger) error {
+	commandLine := operation.FormatCommand(source.RestoreCommand, source.RestoreArgs)
+	log.Info("  Restore command: %s", commandLine)
+	output := &operation.CommandLogWriter{Log: log, Prefix: "  [" + entry.DirectoryName + "] "}
+	cmd := exec.Command(source.RestoreCommand, source.RestoreArgs...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Failed to start restore command %s: %w. Remedy: Check 'restore_command' and 'restore_args' of the command source in config.yaml and that the program is installed.", commandLine, err)
+	}
+	streamErr := writeStream(stdin, entry, parts, file, password, log)
+	stdin.Close() //nolint:errcheck
+	waitErr := cmd.Wait()
+	output.Flush()
+	if waitErr != nil {
+		return fmt.Errorf("%w. Remedy: Check the command output in the log and run the restore command manually to test it.", operation.CommandExitError(commandLine, waitErr, output))
+	}
+	return streamErr
+}
+
+// resolveRestoreCommands returns the command sources whose output is piped into their
+// restore command, keyed by backup name. Stream backups missing from the result are
+// written to a file. Interactive restores ask when a restore command is configured.
+func resolveRestoreCommands(cfg *util.Config, selected []util.BackupEntry, backupDir string, opts *Options) (map[string]util.CommandSource, error) {
+	var pipeable []util.CommandSource
+	var missing []string
+	for _, entry := range selected {
+		if !isStreamBackup(backupDir, entry) {
+			continue
+		}
+		source, ok := cfg.FindCommandSource(entry.DirectoryName)
+		if !ok || source.RestoreCommand == "" {
+			missing = append(missing, entry.DirectoryName)
+			continue
+		}
+		pipeable = append(pipeable, source)
+	}
+
+	pipe := false
+	switch {
+	case opts != nil:
+		pipe = opts.Pipe
+	case len(pipeable) > 0:
+		var err error
+		pipe, err = promptPipe(pipeable)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !pipe {
+		return nil, nil
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("No restore command configured for command source(s): %s. Remedy: Add 'restore_command' to these entries of command_sources in config.yaml, or restore without -pipe to write the output to a file.", strings.Join(missing, ", "))
+	}
+	if len(pipeable) == 0 {
+		return nil, fmt.Errorf("-pipe requires the output of a command source in the backup selection. Remedy: Select a command source backup or restore without -pipe.")
+	}
+
+	commands := make(map[string]util.CommandSource, len(pipeable))
+	for _, source := range pipeable {
+		commands[source.Name] = source
+	}
+	return commands, nil
+}
+
+func promptPipe(sources []util.CommandSource) (bool, error) {
+	fmt.Println("The selection contains the output of command source(s) with a restore command:")
+	for _, source := range sources {
+		fmt.Printf("  - %s → %s\n", source.Name, operation.FormatCommand(source.RestoreCommand, source.RestoreArgs))
+	}
+	fmt.Println()
+	for {
+		answer, err := readLineFn("Pipe the output into the restore command instead of writing a file? [y/N]: ")
+		if err != nil {
+			return false, err
+		}
+		fmt.Println()
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "", "n", "no":
+			return false, nil
+		case "y", "yes":
+			return true, nil
+		default:
+			fmt.Println("Please enter y (yes) or n (no).")
+		}
+	}
+}
+
+// withoutPiped returns the entries of selected that are restored into the restore destination.
+func withoutPiped(selected []util.BackupEntry, commands map[string]util.CommandSource) []util.BackupEntry {
+	if len(commands) == 0 {
+		return selected
+	}
+	entries := make([]util.BackupEntry, 0, len(selected))
+	for _, entry := range selected {
+		if _, ok := commands[entry.DirectoryName]; !ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// markPipedItems marks the preflight items whose output is piped into a restore
+// command; their restore directory is not used.
+func markPipedItems(items []restorePreflightItem, commands map[string]util.CommandSource) {
+	for i := range items {
+		source, ok := commands[items[i].Entry.DirectoryName]
+		if !ok {
+			continue
+		}
+		items[i].PipeCommand = operation.FormatCommand(source.RestoreCommand, source.RestoreArgs)
+		items[i].OutputDirErr = nil
+		items[i].OutputDirExists = false
+	}
+}
+
+// pipeEntry decrypts the output of a command source backup into its restore command.
+func pipeEntry(entry util.BackupEntry, backupDir string, source util.CommandSource, password []byte, log *util.Logger) (int, error) {
+	parts, err := catalog.CollectParts(backupDir, entry)
+	if err != nil {
+		return 0, err
+	}
+	if len(parts) == 0 {
+		return 0, fmt.Errorf("No part files found for %s. Remedy: Put all related .enc files into the same backup directory.", entry.String())
+	}
+	log.Info("Processing backup directory: %s", entry.DirectoryName)
+	entries, hasManifest, err := manifest.LoadForBackup(backupDir, entry, password)
+	if err != nil {
+		return 0, fmt.Errorf("Manifest of %s could not be read: %w", entry.String(), err)
+	}
+	file, err := streamEntry(entry, entries, hasManifest)
+	if err != nil {
+		return 0, err
+	}
+	if err := pipeStream(entry, parts, file, source, password, log); err != nil {
+		return 0, err
+	}
+	return len(parts), nil
+}
@@ -1,15 +1,19 @@
 // Package restore orchestrates the full restore workflow:
 //  1. List available backups in the backup directory
 //  2. Let the user choose which backup(s) to restore
-//  3. Verify password (up to 3 attempts)
-//  4. Decrypt and extract to the user-specified restore path
+//  3. Optionally limit the restore to selected files and subtrees
+//  4. Verify password (up to 3 attempts)
+//  5. Decrypt and extract to the user-specified restore path
 package restore
 
 import (
 	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
 	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/repository"
 	"RestoreSafe/internal/security"
 	"RestoreSafe/internal/util"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -18,8 +22,46 @@ import (
 	"strings"
 )
 
+// readLineFn is the line reader used by the restore prompts; tests replace it.
+var readLineFn = security.ReadLine
+
+// Options holds restore choices passed as arguments instead of being entered at the prompts.
+type Options struct {
+	// Backup selects the backup(s) to restore: a dot (.), a backup ID or a full backup name.
+	Backup string
+	// Destination is the restore destination; a dot (.) restores into the backup directory.
+	Destination string
+	// Include limits the restore to matching files and directories; empty restores everything.
+	Include []string
+	// Flatten restores matching files without their directory structure.
+	Flatten bool
+	// Conflict decides how files that already exist in the restore directory are handled.
+	Conflict util.ConflictPolicy
+	// Pipe writes the output of command sources into their restore command instead of a file.
+	Pipe bool
+	// Stdout writes one backup to Output instead of a restore directory: its TAR archive,
+	// its raw stream, or the content of the one file selected by Include.
+	Stdout bool
+	// Output receives the backup with Stdout; nil means os.Stdout.
+	Output io.Writer
+}
+
 // Run executes the full restore workflow.
 func Run(cfg *util.Config, exeDir string) error {
+	return run(cfg, exeDir, nil)
+}
+
+// RunWithOptions executes the restore workflow with the backup selection, destination and
+// file selection taken from opts. Password and start confirmation are still prompted;
+// with opts.Stdout there is no start confirmation.
+func RunWithOptions(cfg *util.Config, exeDir string, opts Options) error {
+	if opts.Stdout {
+		return runToOutput(cfg, exeDir, opts)
+	}
+	return run(cfg, exeDir, &opts)
+}
+
+func run(cfg *util.Config, exeDir string, opts *Options) error {
 	backupDir := util.ResolveDir(cfg.BackupDirectory, exeDir)
 
 	// Enumerate backups.
@@ -32,7 +74,7 @@ func Run(cfg *util.Config, exeDir string) error {
 		return nil
 	}
 
-	selected, selection, err := resolveRestoreSelection(backupDir, index)
+	selected, selection, err := resolveRestoreSelection(backupDir, index, opts)
 	if err != nil {
 		if errors.Is(err, operation.ErrSelectionCancelled) {
 			fmt.Println("Restore cancelled.")
@@ -53,8 +95,37 @@ func Run(cfg *util.Config, exeDir string) error {
 		warningCount++
 	}
 	defer log.Close()
+	ioRetries := util.WatchIORetries(log)
+	defer ioRetries.Stop()
+
+	commands, err := resolveRestoreCommands(cfg, selected, backupDir, opts)
+	if err != nil {
+		if errors.Is(err, operation.ErrSelectionCancelled) {
+			fmt.Println("Restore cancelled.")
+			return nil
+		}
+		return err
+	}
+
+	restorePath, err := resolveRestoreDestination(backupDir, opts)
+	if err != nil {
+		if errors.Is(err, operation.ErrSelectionCancelled) {
+			fmt.Println("Restore cancelled.")
+			return nil
+		}
+		return err
+	}
 
-	restorePath, err := promptRestoreDestination(backupDir)
+	extractOpts, err := resolveFileSelection(opts)
+	if err != nil {
+		if errors.Is(err, operation.ErrSelectionCancelled) {
+			fmt.Println("Restore cancelled.")
+			return nil
+		}
+		return err
+	}
+
+	extractOpts.Conflict, err = resolveConflictPolicy(withoutPiped(selected, commands), backupDir, restorePath, opts)
 	if err != nil {
 		if errors.Is(err, operation.ErrSelectionCancelled) {
 			fmt.Println("Restore cancelled.")
@@ -64,11 +135,33 @@ func Run(cfg *util.Config, exeDir string) error {
 	}
 
 	stagingPlan := operation.PlanLocalStaging(backupDir, restorePath, os.TempDir())
-	preflight := buildRestorePreflight(selected, backupDir, restorePath)
-	printRestorePreflightWithYubiKeyCheck(os.Stdout, cfg, backupDir, restorePath, preflight, requiresYubiKey, yubiKeyOnly, stagingPlan, security.CheckYubiKeyConnected)
+	preflight := buildRestorePreflight(selected, backupDir, restorePath, extractOpts.Conflict)
+	markPipedItems(preflight, commands)
+
+	// Counting matching and conflicting files requires reading the archives, so the
+	// password is collected before the preflight when a scan is needed.
+	rep := selected[0]
+	var password []byte
+	defer func() { security.ZeroBytes(password) }()
+	if restoreNeedsScan(preflight, extractOpts) {
+		password, err = operation.ReadPasswordWithRetry(backupDir, rep, "Enter restore password: ", log)
+		if err != nil {
+			return err
+		}
+		fmt.Println()
+		fmt.Println("Scanning backup(s) for matching and existing files...")
+		if err := scanRestoreArchives(preflight, backupDir, password, extractOpts); err != nil {
+			return err
+		}
+	}
+
+	printRestorePreflightWithYubiKeyCheck(os.Stdout, cfg, backupDir, restorePath, preflight, extractOpts.Conflict, requiresYubiKey, yubiKeyOnly, stagingPlan, security.CheckYubiKeyConnected)
 	if err := validateRestorePreflight(preflight); err != nil {
 		return err
 	}
+	if err := validateRestoreSelectionMatches(preflight); err != nil {
+		return err
+	}
 	if err := validateRestoreTargetSpace(restorePath, preflight); err != nil {
 		return err
 	}
@@ -91,12 +184,12 @@ func Run(cfg *util.Config, exeDir string) error {
 	}
 
 	// Collect password (with retry).
-	rep := selected[0]
-	password, err := operation.ReadPasswordWithRetry(backupDir, rep, "Enter restore password: ", log)
-	if err != nil {
-		return err
+	if password == nil {
+		password, err = operation.ReadPasswordWithRetry(backupDir, rep, "Enter restore password: ", log)
+		if err != nil {
+			return err
+		}
 	}
-	defer func() { security.ZeroBytes(password) }()
 
 	fmt.Println()
 	log.Info("Restore started - ID: %s, date: %s", string(selected[0].ID), selected[0].Date)
@@ -104,12 +197,22 @@ func Run(cfg *util.Config, exeDir string) error {
 	for _, entry := range selected {
 		log.Info("  %s", entry.String())
 	}
+	if !extractOpts.Selector.IsEmpty() {
+		log.Info("File selection: %s", strings.Join(extractOpts.Selector.Patterns(), "; "))
+		if extractOpts.Flatten {
+			log.Info("Directory structure: flattened")
+		}
+	}
+	if extractOpts.Conflict.AllowsExisting() {
+		log.Info("Conflict policy: %s", extractOpts.Conflict)
+	}
 
-	_, err = restoreSelectedEntries(selected, backupDir, restorePath, password, log, stagingPlan)
+	_, err = restoreSelectedEntries(entriesWithMatches(preflight), backupDir, restorePath, password, log, stagingPlan, extractOpts, commands)
 	if err != nil {
 		return err
 	}
 
+	warningCount += operation.LogIORetries(ioRetries, log)
 	log.Info("Restore completed successfully.")
 	fmt.Printf("\nLog file: %s\n", logPath)
 	if warningCount > 0 {
@@ -118,10 +221,27 @@ func Run(cfg *util.Config, exeDir string) error {
 	return nil
 }
 
-func resolveRestoreSelection(backupDir string, index []util.BackupEntry) ([]util.BackupEntry, string, error) {
+func resolveRestoreSelection(backupDir string, index []util.BackupEntry, opts *Options) ([]util.BackupEntry, string, error) {
+	if opts != nil {
+		return operation.ResolveBackupSelection(backupDir, index, opts.Backup)
+	}
 	return operation.PromptBackupSelection("restore", backupDir, index)
 }
 
+func resolveRestoreDestination(backupDir string, opts *Options) (string, error) {
+	if opts == nil {
+		return promptRestoreDestination(backupDir)
+	}
+	destination := strings.TrimSpace(opts.Destination)
+	switch destination {
+	case "":
+		return "", fmt.Errorf("Restore destination must not be empty. Remedy: Pass a dot (.) or a destination path.")
+	case ".":
+		return backupDir, nil
+	}
+	return destination, nil
+}
+
 func promptRestoreDestination(backupDir string) (string, error) {
 	for {
 		fmt.Printf("Enter restore destination:\n")
@@ -130,7 +250,7 @@ func promptRestoreDestination(backupDir string) (string, error) {
 		fmt.Printf("  - Enter q → cancel\n")
 		fmt.Println()
 
-		restorePath, err := security.ReadLine("Restore destination: ")
+		restorePath, err := readLineFn("Restore destination: ")
 		if err != nil {
 			return "", err
 		}
@@ -156,9 +276,33 @@ type restorePreflightItem struct {
 	OutputDir      string
 	Err            error // parts-level error (inspection failure, no parts found)
 	OutputDirErr   error // output directory error (already exists)
+
+	// OutputDirExists is set when the output directory exists and the conflict
+	// policy allows restoring into it; Conflicts counts files that already exist.
+	OutputDirExists bool
+	Conflicts       int
+
+	// Resume is set when the output directory holds an interrupted restore of the
+	// entry; ResumedFiles counts the files it restored.
+	Resume       bool
+	ResumedFiles int
+
+	// SingleFile is set for the backup of a single file; OutputDir is then the
+	// path of the restored file.
+	SingleFile bool
+
+	// PipeCommand is set when the output of a command source is piped into its
+	// restore command; nothing is written to OutputDir then.
+	PipeCommand string
+
+	// Selective is set when a file selection is active; MatchedFiles and
+	// MatchedBytes then describe the matching regular files.
+	Selective    bool
+	MatchedFiles int
+	MatchedBytes int64
 }
 
-func buildRestorePreflight(selected []util.BackupEntry, backupDir, restorePath string) []restorePreflightItem {
+func buildRestorePreflight(selected []util.BackupEntry, backupDir, restorePath string, policy util.ConflictPolicy) []restorePreflightItem {
 	items := make([]restorePreflightItem, 0, len(selected))
 	for _, entry := range selected {
 		partCount, totalSizeBytes, err := catalog.InspectBackupParts(backupDir, entry)
@@ -174,19 +318,64 @@ func buildRestorePreflight(selected []util.BackupEntry, backupDir, restorePath s
 		if item.PartCount == 0 && item.Err == nil {
 			item.Err = fmt.Errorf("No part files found. Remedy: Ensure all .enc parts of this backup are in the same backup directory.")
 		}
-		if _, err := os.Stat(item.OutputDir); err == nil {
-			item.OutputDirErr = fmt.Errorf("Restore directory already exists. Remedy: Choose a different restore destination or rename/delete the existing restore directory.")
+		if item.Err == nil {
+			// Incremental backups need their parents, which are staged and read as well.
+			chain, err := catalog.ResolveChain(backupDir, entry)
+			if err != nil {
+				item.Err = err
+			} else {
+				for _, parent := range chain[:len(chain)-1] {
+					_, parentSizeBytes, err := catalog.InspectBackupParts(backupDir, parent)
+					if err != nil {
+						item.Err = err
+						break
+					}
+					item.TotalSizeBytes += parentSizeBytes
+				}
+			}
+		}
+		item.SingleFile = isSingleFileBackup(backupDir, entry)
+		if info, err := os.Stat(item.OutputDir); err == nil {
+			done, resumable, checkpointErr := readRestoreCheckpoint(restorePath, entry)
+			switch {
+			case checkpointErr != nil:
+				item.OutputDirErr = checkpointErr
+			case resumable && !item.SingleFile && info.IsDir():
+				item.Resume = true
+				item.ResumedFiles = len(done)
+			case item.SingleFile && info.IsDir():
+				item.OutputDirErr = fmt.Errorf("Restore file path %s is an existing directory. Remedy: Choose a different restore destination or rename/delete the existing directory.", filepath.ToSlash(item.OutputDir))
+			case item.SingleFile && policy.AllowsExisting():
+				item.OutputDirExists = true
+			case item.SingleFile:
+				item.OutputDirErr = fmt.Errorf("Restore file already exists. Remedy: Choose a different restore destination, rename/delete the existing file, or choose a conflict policy (%s).", strings.Join(util.ConflictPolicyNames[1:], ", "))
+			case !info.IsDir():
+				item.OutputDirErr = fmt.Errorf("Restore directory path %s is an existing file. Remedy: Choose a different restore destination or rename/delete the existing file.", filepath.ToSlash(item.OutputDir))
+			case policy.AllowsExisting():
+				item.OutputDirExists = true
+			default:
+				item.OutputDirErr = fmt.Errorf("Restore directory already exists. Remedy: Choose a different restore destination, rename/delete the existing restore directory, or choose a conflict policy (%s).", strings.Join(util.ConflictPolicyNames[1:], ", "))
+			}
 		}
 		items = append(items, item)
 	}
 	return items
 }
 
+// extractDir returns the directory the archive of item is extracted into.
+func (item restorePreflightItem) extractDir() string {
+	if item.SingleFile {
+		return filepath.Dir(item.OutputDir)
+	}
+	return item.OutputDir
+}
+
 func printRestorePreflightWithYubiKeyCheck(
 	w io.Writer,
 	cfg *util.Config,
 	backupDir, restorePath string,
 	items []restorePreflightItem,
+	policy util.ConflictPolicy,
 	requiresYubiKey, yubiKeyOnly bool,
 	stagingPlan operation.LocalStagingPlan,
 	checkYubiKeyConnected func() error,
@@ -201,10 +390,16 @@ func printRestorePreflightWithYubiKeyCheck(
 	fmt.Fprintln(w, "Backup selection:")
 	fmt.Fprintf(w, "  Path: %s\n", filepath.ToSlash(backupDir))
 	for _, item := range items {
-		if item.Err != nil {
+		switch {
+		case item.Err != nil:
 			fmt.Fprintf(w, "  [ERROR] %s (parts: %d)\n", item.Entry.String(), item.PartCount)
 			issues = append(issues, item.Err.Error())
-		} else {
+		case item.Selective && item.MatchedFiles == 0:
+			fmt.Fprintf(w, "  [WARN] %s (parts: %d, matched files: 0)\n", item.Entry.String(), item.PartCount)
+			issues = append(issues, fmt.Sprintf("[WARN] No files in %s match the file selection; this directory will be skipped.", item.Entry.String()))
+		case item.Selective:
+			fmt.Fprintf(w, "  [OK] %s (parts: %d, matched files: %d)\n", item.Entry.String(), item.PartCount, item.MatchedFiles)
+		default:
 			fmt.Fprintf(w, "  [OK] %s (parts: %d)\n", item.Entry.String(), item.PartCount)
 		}
 	}
@@ -233,14 +428,27 @@ func printRestorePreflightWithYubiKeyCheck(
 	// Restored directory(s)
 	fmt.Fprintln(w, "Restored directory(s):")
 	for _, item := range items {
+		if item.Selective && item.MatchedFiles == 0 {
+			continue
+		}
 		displayDir := displayRestoreOutputDir(item.OutputDir)
-		if item.OutputDirErr != nil {
+		switch {
+		case item.PipeCommand != "":
+			fmt.Fprintf(w, "  [OK] %s → %s\n", item.Entry.DirectoryName, item.PipeCommand)
+		case item.OutputDirErr != nil:
 			fmt.Fprintf(w, "  [ERROR] %s\n", displayDir)
 			issues = append(issues, item.OutputDirErr.Error())
-		} else {
+		case item.Resume:
+			fmt.Fprintf(w, "  [RESUME] %s (interrupted restore, %d file(s) restored)\n", displayDir, item.ResumedFiles)
+		case item.OutputDirExists:
+			fmt.Fprintf(w, "  [OK] %s (existing directory, conflicts: %d)\n", displayDir, item.Conflicts)
+		default:
 			fmt.Fprintf(w, "  [OK] %s\n", displayDir)
 		}
 	}
+	if policy.AllowsExisting() {
+		fmt.Fprintf(w, "  Conflict policy: %s\n", policy)
+	}
 
 	// Authentication and Log level
 	operation.PrintField(w, operation.DefaultFieldLabelWidth, "Authentication", operation.BackupAuthenticationLabel(requiresYubiKey, yubiKeyOnly))
@@ -343,6 +551,10 @@ func estimateRestoreBytes(items []restorePreflightItem) int64 {
 		if item.Err != nil {
 			continue
 		}
+		if item.Selective {
+			total += item.MatchedBytes
+			continue
+		}
 		total += item.TotalSizeBytes
 	}
 	return total
@@ -369,11 +581,14 @@ func queryRestoreTargetFreeBytes(restorePath string) (uint64, error) {
 	return util.QueryFreeSpaceBytes(restorePath)
 }
 
-func restoreSelectedEntries(selected []util.BackupEntry, backupDir, restorePath string, password []byte, log *util.Logger, stagingPlan operation.LocalStagingPlan) (int, error) {
+// restoreSelectedEntries restores every entry of selected into restorePath. The output
+// of command sources listed in commands is piped into their restore command instead.
+func restoreSelectedEntries(selected []util.BackupEntry, backupDir, restorePath string, password []byte, log *util.Logger, stagingPlan operation.LocalStagingPlan, opts util.ExtractOptions, commands map[string]util.CommandSource) (int, error) {
 	totalPartsProcessed := 0
 	for _, entry := range selected {
 		var scope *operation.StagingScope
-		if stagingPlan.Enabled {
+		// Snapshots share the repository with other backups and are read in place.
+		if stagingPlan.Enabled && !catalog.IsSnapshot(backupDir, entry) {
 			stagedDir, err := stageBackupEntryLocally(backupDir, entry, stagingPlan.ResolvedTempDir, log)
 			if err != nil {
 				return 0, fmt.Errorf("Local staging failed for %q: %w", entry.String(), err)
@@ -381,7 +596,13 @@ func restoreSelectedEntries(selected []util.BackupEntry, backupDir, restorePath
 			scope = operation.ActiveStagingScope(stagedDir, log)
 		}
 
-		partCount, err := restoreEntry(entry, scope.ActiveDir(backupDir), restorePath, password, log)
+		var partCount int
+		var err error
+		if source, ok := commands[entry.DirectoryName]; ok {
+			partCount, err = pipeEntry(entry, scope.ActiveDir(backupDir), source, password, log)
+		} else {
+			partCount, err = restoreEntry(entry, scope.ActiveDir(backupDir), restorePath, password, log, opts)
+		}
 		if err != nil {
 			scope.Cleanup()
 			return 0, fmt.Errorf("Failed to restore directory %q: %w", entry.String(), err)
@@ -401,6 +622,11 @@ func stageBackupEntryLocally(backupDir string, entry util.BackupEntry, tempDir s
 	if len(parts) == 0 {
 		return "", fmt.Errorf("No part files found for %s. Remedy: Ensure all .enc files for this backup are in the same backup directory.", entry.String())
 	}
+	// An incremental backup is staged together with the parents it depends on.
+	chain, err := catalog.ResolveChain(backupDir, entry)
+	if err != nil {
+		return "", err
+	}
 
 	stageDir, err := operation.CreateStagingDir(tempDir, "restoresafe-restore-stage-*")
 	if err != nil {
@@ -412,53 +638,320 @@ func stageBackupEntryLocally(backupDir string, entry util.BackupEntry, tempDir s
 	log.Info("  To: %s", filepath.ToSlash(stageDir))
 	log.Info("Copying backup files of directory: %s", entry.DirectoryName)
 
-	for _, partPath := range parts {
-		log.Info("  Copy: %s", filepath.Base(partPath))
-		destinationPath := filepath.Join(stageDir, filepath.Base(partPath))
-		if err := util.CopyFile(partPath, destinationPath); err != nil {
+	copied := 0
+	for _, chainEntry := range chain {
+		files, err := catalog.CollectParts(backupDir, chainEntry)
+		if err != nil {
+			operation.CleanupStagingDirDuring(stageDir, "error recovery", log)
+			return "", err
+		}
+		for _, partPath := range files {
+			log.Info("  Copy: %s", filepath.Base(partPath))
+			destinationPath := filepath.Join(stageDir, filepath.Base(partPath))
+			if err := util.CopyFile(partPath, destinationPath); err != nil {
+				operation.CleanupStagingDirDuring(stageDir, "error recovery", log)
+				return "", err
+			}
+		}
+		copied += len(files)
+
+		if err := stageSidecarFiles(backupDir, chainEntry, stageDir); err != nil {
 			operation.CleanupStagingDirDuring(stageDir, "error recovery", log)
 			return "", err
 		}
 	}
 
-	log.Info("  Copied: %d part file(s) - [%s] successfully copied", len(parts), entry.DirectoryName)
+	log.Info("  Copied: %d part file(s) - [%s] successfully copied", copied, entry.DirectoryName)
 
 	return stageDir, nil
 }
 
+// stageSidecarFiles copies the manifest and run metadata of entry, if present.
+func stageSidecarFiles(backupDir string, entry util.BackupEntry, stageDir string) error {
+	manifestPath, hasManifest, err := catalog.FindManifestFile(backupDir, entry)
+	if err != nil {
+		return err
+	}
+	if hasManifest {
+		if err := util.CopyFile(manifestPath, filepath.Join(stageDir, filepath.Base(manifestPath))); err != nil {
+			return err
+		}
+	}
+
+	runInfoPath := util.RunInfoFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID)
+	if _, err := util.StorageFor(runInfoPath).Stat(runInfoPath); err == nil {
+		if err := util.CopyFile(runInfoPath, filepath.Join(stageDir, filepath.Base(runInfoPath))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // restoreEntry decrypts all parts of one backup entry and extracts to destDir.
-func restoreEntry(entry util.BackupEntry, backupDir, destDir string, password []byte, log *util.Logger) (int, error) {
+// With a file selection in opts, only matching entries are written and the
+// archive data of all other entries is skipped without being decrypted.
+// Unchanged files of an incremental backup are extracted from its parents.
+// Names that are not valid on this system are restored under a mapped name and
+// listed in a rename report next to the restored data.
+// The restored files of a directory are recorded in a checkpoint, so that a
+// restore of entry that was interrupted continues with the files still missing.
+func restoreEntry(entry util.BackupEntry, backupDir, destDir string, password []byte, log *util.Logger, opts util.ExtractOptions) (int, error) {
+	opts.Names = util.NewNameMapper(util.TargetNameRules())
+	var checkpoint *restoreCheckpoint
+	if !isSingleFileBackup(backupDir, entry) {
+		var err error
+		checkpoint, err = openRestoreCheckpoint(destDir, filepath.Join(destDir, entry.DirectoryName), entry)
+		if err != nil {
+			return 0, err
+		}
+		if checkpoint.resumed {
+			log.Info("  Resumed: %d file(s) of [%s] were restored before the interruption", len(checkpoint.done), entry.DirectoryName)
+		}
+		checkpoint.apply(&opts)
+	}
+	partCount, err := extractEntry(entry, backupDir, destDir, password, log, opts)
+	if err != nil {
+		if checkpoint != nil {
+			checkpoint.close() //nolint:errcheck
+		}
+		return 0, err
+	}
+	if err := writeRenameReport(destDir, entry, opts.Names, log); err != nil {
+		return 0, err
+	}
+	if checkpoint != nil {
+		if err := checkpoint.remove(); err != nil {
+			return 0, err
+		}
+	}
+	return partCount, nil
+}
+
+// renameReportPath returns the path of the rename report of entry in destDir.
+func renameReportPath(destDir string, entry util.BackupEntry) string {
+	return filepath.Join(destDir, entry.DirectoryName+".renames.txt")
+}
+
+// writeRenameReport writes the names changed during the restore of entry to its
+// rename report. Nothing is written when all names were restored unchanged.
+func writeRenameReport(destDir string, entry util.BackupEntry, names *util.NameMapper, log *util.Logger) error {
+	renames := names.Renames()
+	if len(renames) == 0 {
+		return nil
+	}
+	path := renameReportPath(destDir, entry)
+	var report bytes.Buffer
+	if err := names.WriteReport(&report); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, report.Bytes(), 0o640); err != nil {
+		return fmt.Errorf("Failed to write rename report %q: %w. Remedy: Check write permissions in the restore destination.", path, err)
+	}
+	log.Warn("  Renamed: %d name(s) not valid on this system, see %s", len(renames), path)
+	return nil
+}
+
+// extractEntry does the work of restoreEntry and returns the number of parts read.
+func extractEntry(entry util.BackupEntry, backupDir, destDir string, password []byte, log *util.Logger, opts util.ExtractOptions) (int, error) {
 	parts, err := catalog.CollectParts(backupDir, entry)
 	if err != nil {
 		return 0, err
 	}
-	if len(parts) == 0 {
+	snapshot := len(parts) == 0 && catalog.IsSnapshot(backupDir, entry)
+	if len(parts) == 0 && !snapshot {
 		return 0, fmt.Errorf("No part files found for %s. Remedy: Put all related .enc files into the same backup directory.", entry.String())
 	}
+	chain, err := catalog.ResolveChain(backupDir, entry)
+	if err != nil {
+		return 0, err
+	}
 
 	log.Info("Processing backup directory: %s", entry.DirectoryName)
 
 	// Verify restore directory can be created before starting decryption.
-	outDir := filepath.Join(destDir, entry.DirectoryName)
+	outDir := restoreOutputDir(backupDir, destDir, entry)
 	if err := os.MkdirAll(outDir, 0o750); err != nil {
 		return 0, fmt.Errorf("Failed to create restore directory: %w. Remedy: Check write permissions and use a valid destination path.", err)
 	}
 
-	err = operation.RunDecryptPipeline(
-		parts,
-		password,
-		log,
-		entry.DirectoryName,
-		"decrypted",
-		"Extraction",
-		func(r io.Reader) error { return util.ExtractTar(r, outDir) },
-		nil,
-	)
+	opts.OnConflict = func(decision util.ConflictDecision) { logConflictDecision(log, decision) }
+
+	// Restored files are checked against the hashes in the manifest, if the backup has one.
+	entries, hasManifest, err := manifest.LoadForBackup(backupDir, entry, password)
+	if err != nil {
+		if snapshot {
+			return 0, fmt.Errorf("Snapshot of %s could not be read: %w", entry.String(), err)
+		}
+		if len(chain) > 1 {
+			return 0, fmt.Errorf("Manifest of incremental backup %s could not be read: %w. Remedy: Restore the .manifest.enc file from a copy of the backup directory; an incremental backup cannot be restored without it.", entry.String(), err)
+		}
+		log.Warn("Manifest of %s could not be read, restoring without per-file integrity checks: %v", entry.String(), err)
+	}
+	if !hasManifest && len(chain) > 1 {
+		return 0, fmt.Errorf("Manifest of incremental backup %s is missing. Remedy: Restore the .manifest.enc file from a copy of the backup directory; an incremental backup cannot be restored without it.", entry.String())
+	}
+	if hasManifest {
+		opts.ExpectedSHA256 = manifest.NewIndex(entries).ExpectedSHA256
+	}
+
+	if isStreamBackup(backupDir, entry) {
+		file, err := streamEntry(entry, entries, hasManifest)
+		if err != nil {
+			return 0, err
+		}
+		stats, err := extractStream(entry, parts, file, outDir, password, log, opts)
+		if err != nil {
+			return 0, err
+		}
+		logRestoreStats(log, stats, opts, hasManifest)
+		return len(parts), nil
+	}
+
+	if snapshot {
+		stats, err := extractSnapshot(backupDir, entries, outDir, password, opts)
+		if err != nil {
+			return 0, err
+		}
+		logRestoreStats(log, stats, opts, hasManifest)
+		return 1, nil
+	}
+
+	stats, err := extractArchive(entry, parts, outDir, password, log, opts)
 	if err != nil {
 		return 0, err
 	}
+	partCount := len(parts)
+
+	stored := storedInParents(entries)
+	for _, parent := range chain[:len(chain)-1] {
+		names := stored[parent.String()]
+		if len(names) == 0 {
+			continue
+		}
+		parentParts, err := catalog.CollectParts(backupDir, parent)
+		if err != nil {
+			return 0, err
+		}
+		log.Info("  Unchanged files from: %s (%d file(s))", parent.String(), len(names))
+		parentOpts := opts
+		include := opts.Include
+		parentOpts.Include = func(name string) bool { return names[name] && (include == nil || include(name)) }
+		parentStats, err := extractArchive(entry, parentParts, outDir, password, log, parentOpts)
+		if err != nil {
+			return 0, err
+		}
+		stats.Add(parentStats)
+		partCount += len(parentParts)
+	}
+
+	logRestoreStats(log, stats, opts, hasManifest)
+	return partCount, nil
+}
+
+// restoreOutputDir returns the directory entry is extracted into: a subdirectory of
+// destDir named after the backup, or destDir itself for the backup of a single file
+// or command output, whose only archive entry already carries that name.
+func restoreOutputDir(backupDir, destDir string, entry util.BackupEntry) string {
+	if isSingleFileBackup(backupDir, entry) {
+		return destDir
+	}
+	return filepath.Join(destDir, entry.DirectoryName)
+}
+
+// isSingleFileBackup reports whether the run metadata of entry marks it as the backup
+// of a single file or of the output of a command, which is restored as a file.
+func isSingleFileBackup(backupDir string, entry util.BackupEntry) bool {
+	info, err := catalog.ReadRunInfo(backupDir, entry)
+	return err == nil && (info.IsFile() || info.IsStream())
+}
+
+func logRestoreStats(log *util.Logger, stats util.ExtractStats, opts util.ExtractOptions, hasManifest bool) {
+	if !opts.Selector.IsEmpty() {
+		log.Info("  Restored: %d file(s), %s matching the file selection", stats.Files, util.FormatBytesBinary(uint64(stats.Bytes)))
+	}
+	if hasManifest {
+		log.Info("  Integrity: %d file(s) match the hashes in the manifest", stats.Verified)
+	}
+	if stats.Skipped+stats.Overwritten+stats.Renamed > 0 {
+		log.Info("  Conflicts: %d skipped, %d overwritten, %d renamed", stats.Skipped, stats.Overwritten, stats.Renamed)
+	}
+}
+
+// extractSnapshot restores a snapshot of the chunked repository by extracting the TAR
+// stream rebuilt from its chunks. Files left out by the selection are still read.
+func extractSnapshot(backupDir string, entries []manifest.Entry, outDir string, password []byte, opts util.ExtractOptions) (util.ExtractStats, error) {
+	repo, err := repository.Open(backupDir, password)
+	if err != nil {
+		return util.ExtractStats{}, fmt.Errorf("Failed to open repository: %w", err)
+	}
+	defer repo.Close()
+
+	var stats util.ExtractStats
+	err = repo.StreamTar(entries, func(r io.Reader) error {
+		var extractErr error
+		stats, extractErr = util.ExtractTarSelected(r, outDir, opts)
+		return extractErr
+	})
+	if err != nil {
+		return util.ExtractStats{}, fmt.Errorf("Extraction failed: %w", err)
+	}
+	return stats, nil
+}
 
-	return len(parts), nil
+// extractArchive decrypts parts and extracts the archive into outDir. Without a
+// selection the archive is streamed; otherwise it is read with seeks so that the
+// data of unselected entries is skipped.
+func extractArchive(entry util.BackupEntry, parts []string, outDir string, password []byte, log *util.Logger, opts util.ExtractOptions) (util.ExtractStats, error) {
+	var stats util.ExtractStats
+	var err error
+	if opts.Selector.IsEmpty() && !opts.Flatten && opts.Include == nil {
+		err = operation.RunDecryptPipeline(
+			parts,
+			password,
+			log,
+			entry.DirectoryName,
+			"decrypted",
+			"Extraction",
+			func(r io.Reader) error {
+				var extractErr error
+				stats, extractErr = util.ExtractTarSelected(r, outDir, opts)
+				return extractErr
+			},
+			nil,
+		)
+	} else {
+		err = operation.RunDecryptReader(
+			parts,
+			password,
+			log,
+			entry.DirectoryName,
+			"decrypted",
+			"Extraction",
+			func(r io.ReadSeeker) error {
+				var extractErr error
+				stats, extractErr = util.ExtractTarSelected(r, outDir, opts)
+				return extractErr
+			},
+			nil,
+		)
+	}
+	return stats, err
+}
+
+// storedInParents groups the files of an incremental manifest by the parent backup
+// that holds their content.
+func storedInParents(entries []manifest.Entry) map[string]map[string]bool {
+	stored := make(map[string]map[string]bool)
+	for _, e := range entries {
+		if e.Stored == "" || e.Deleted() {
+			continue
+		}
+		if stored[e.Stored] == nil {
+			stored[e.Stored] = make(map[string]bool)
+		}
+		stored[e.Stored][e.Path] = true
+	}
+	return stored
 }
 
 func restoreSelectionWarningCount(selection string, index []util.BackupEntry) int {
@@ -476,4 +969,3 @@ func restoreSelectionWarningCount(selection string, index []util.BackupEntry) in
 	}
 	return 0
 }
-
@@ -26,7 +26,7 @@ func TestBackupRestoreVerifyRoundTrip(t *testing.T) {
 	}
 
 	// Step 2: Restore.
-	partCount, err := restoreEntry(fx.Entry, fx.BackupDir, fx.RestoreRoot, password, nil)
+	partCount, err := restoreEntry(fx.Entry, fx.BackupDir, fx.RestoreRoot, password, nil, util.ExtractOptions{})
 	if err != nil {
 		t.Fatalf("restoreEntry failed: %v", err)
 	}
@@ -3,8 +3,11 @@ package restore
 import (
 	"RestoreSafe/internal/security"
 	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
 	"errors"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -16,7 +19,7 @@ func TestBackupAndRestoreEntryRoundTrip(t *testing.T) {
 		t.Fatalf("expected multiple split parts, got %d", fx.Parts)
 	}
 
-	if _, err := restoreEntry(fx.Entry, fx.BackupDir, fx.RestoreRoot, password, nil); err != nil {
+	if _, err := restoreEntry(fx.Entry, fx.BackupDir, fx.RestoreRoot, password, nil, util.ExtractOptions{}); err != nil {
 		t.Fatalf("restoreEntry returned error: %v", err)
 	}
 
@@ -28,7 +31,7 @@ func TestBackupAndRestoreEntryRoundTrip(t *testing.T) {
 func TestRestoreEntryRejectsWrongPassword(t *testing.T) {
 	fx := testutil.NewRestoreFixture(t, []byte("correct-password"))
 
-	_, err := restoreEntry(fx.Entry, fx.BackupDir, fx.RestoreRoot, []byte("wrong-password"), nil)
+	_, err := restoreEntry(fx.Entry, fx.BackupDir, fx.RestoreRoot, []byte("wrong-password"), nil, util.ExtractOptions{})
 	if err == nil {
 		t.Fatal("expected restoreEntry to fail for wrong password")
 	}
@@ -36,3 +39,31 @@ func TestRestoreEntryRejectsWrongPassword(t *testing.T) {
 		t.Fatalf("expected ErrWrongPassword, got: %v", err)
 	}
 }
+
+func TestWriteRenameReportListsChangedNames(t *testing.T) {
+	t.Parallel()
+
+	destDir := t.TempDir()
+	entry := util.BackupEntry{DirectoryName: "Notes", Date: "2026-03-12", ID: util.BackupID("REN001")}
+	names := util.NewNameMapper(util.NameRules{Windows: true, FoldCase: true})
+	names.Map("ok.txt")
+
+	if err := writeRenameReport(destDir, entry, names, nil); err != nil {
+		t.Fatalf("writeRenameReport failed: %v", err)
+	}
+	if _, err := os.Stat(renameReportPath(destDir, entry)); !os.IsNotExist(err) {
+		t.Fatalf("expected no report without renames, stat err=%v", err)
+	}
+
+	names.Map("10:30 meeting.txt")
+	if err := writeRenameReport(destDir, entry, names, nil); err != nil {
+		t.Fatalf("writeRenameReport failed: %v", err)
+	}
+	report, err := os.ReadFile(filepath.Join(destDir, "Notes.renames.txt"))
+	if err != nil {
+		t.Fatalf("expected a rename report: %v", err)
+	}
+	if !strings.Contains(string(report), "10:30 meeting.txt\t10~3A~30 meeting.txt\tinvalid character") {
+		t.Fatalf("unexpected rename report:\n%s", report)
+	}
+}
@@ -0,0 +1,67 @@
+package restore
+
+import (
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRestoreEntryWritesSingleFileBackupIntoRestorePath(t *testing.T) {
+	password := []byte("single-file-password")
+	workspace := t.TempDir()
+	srcFile := filepath.Join(workspace, "data", "vault.hc")
+	backupDir := filepath.Join(workspace, "target")
+	restoreRoot := filepath.Join(workspace, "restore")
+	for _, dir := range []string{filepath.Dir(srcFile), backupDir, restoreRoot} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	writeSource(t, filepath.Dir(srcFile), "vault.hc", "container")
+
+	entry := util.BackupEntry{DirectoryName: "vault.hc", Date: "2026-03-12", ID: util.BackupID("FIL001")}
+	testutil.CreateChainBackup(t, srcFile, backupDir, entry, nil, password)
+
+	if _, err := restoreEntry(entry, backupDir, restoreRoot, password, nil, util.ExtractOptions{}); err != nil {
+		t.Fatalf("restoreEntry failed: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(restoreRoot, "vault.hc"))
+	if err != nil || string(got) != "container" {
+		t.Fatalf("expected the file at restorePath/vault.hc, got %q, %v", got, err)
+	}
+}
+
+func TestBuildRestorePreflightReportsExistingSingleFile(t *testing.T) {
+	password := []byte("single-file-password")
+	workspace := t.TempDir()
+	srcFile := filepath.Join(workspace, "mail.pst")
+	backupDir := filepath.Join(workspace, "target")
+	restoreRoot := filepath.Join(workspace, "restore")
+	for _, dir := range []string{backupDir, restoreRoot} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	writeSource(t, workspace, "mail.pst", "mailbox")
+	entry := util.BackupEntry{DirectoryName: "mail.pst", Date: "2026-03-12", ID: util.BackupID("FIL002")}
+	testutil.CreateChainBackup(t, srcFile, backupDir, entry, nil, password)
+	writeSource(t, restoreRoot, "mail.pst", "older mailbox")
+
+	items := buildRestorePreflight([]util.BackupEntry{entry}, backupDir, restoreRoot, util.ConflictFail)
+	if !items[0].SingleFile || items[0].OutputDirErr == nil {
+		t.Fatalf("expected an existing-file error for the single-file backup, got %+v", items[0])
+	}
+
+	items = buildRestorePreflight([]util.BackupEntry{entry}, backupDir, restoreRoot, util.ConflictSkip)
+	if items[0].OutputDirErr != nil || !items[0].OutputDirExists || items[0].extractDir() != restoreRoot {
+		t.Fatalf("expected the existing file to be handled by the conflict policy, got %+v", items[0])
+	}
+	if err := scanRestoreArchives(items, backupDir, password, util.ExtractOptions{Conflict: util.ConflictSkip}); err != nil {
+		t.Fatalf("scanRestoreArchives failed: %v", err)
+	}
+	if items[0].Conflicts != 1 {
+		t.Fatalf("expected one conflicting file, got %d", items[0].Conflicts)
+	}
+}
@@ -0,0 +1,100 @@
+package restore
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRestoreEntryReconstructsIncrementalChain(t *testing.T) {
+	password := []byte("incremental-password")
+	workspace := t.TempDir()
+	srcDir := filepath.Join(workspace, "Docs")
+	backupDir := filepath.Join(workspace, "target")
+	restoreRoot := filepath.Join(workspace, "restore")
+	for _, dir := range []string{srcDir, backupDir, restoreRoot} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	writeSource(t, srcDir, "a.txt", "alpha")
+	writeSource(t, srcDir, "b.txt", "bravo")
+	writeSource(t, srcDir, "c.txt", "charlie")
+
+	full := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-12", ID: util.BackupID("FUL001")}
+	testutil.CreateChainBackup(t, srcDir, backupDir, full, nil, password)
+
+	writeSource(t, srcDir, "b.txt", "bravo, second version")
+	if err := os.Remove(filepath.Join(srcDir, "c.txt")); err != nil {
+		t.Fatalf("failed to remove c.txt: %v", err)
+	}
+	inc1 := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-13", ID: util.BackupID("INC001")}
+	testutil.CreateChainBackup(t, srcDir, backupDir, inc1, &full, password)
+
+	writeSource(t, srcDir, "d.txt", "delta")
+	inc2 := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-14", ID: util.BackupID("INC002")}
+	testutil.CreateChainBackup(t, srcDir, backupDir, inc2, &inc1, password)
+
+	partCount, err := restoreEntry(inc2, backupDir, restoreRoot, password, nil, util.ExtractOptions{})
+	if err != nil {
+		t.Fatalf("restoreEntry failed: %v", err)
+	}
+	if partCount != 3 {
+		t.Fatalf("expected the parts of all three backups to be read, got %d", partCount)
+	}
+
+	restoredDir := filepath.Join(restoreRoot, "Docs")
+	for name, want := range map[string]string{"a.txt": "alpha", "b.txt": "bravo, second version", "d.txt": "delta"} {
+		got, err := os.ReadFile(filepath.Join(restoredDir, name))
+		if err != nil || string(got) != want {
+			t.Fatalf("expected %s to contain %q, got %q, %v", name, want, got, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(restoredDir, "c.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected deleted file c.txt not to be restored, stat err: %v", err)
+	}
+}
+
+func TestRestoreEntryFailsWhenParentIsMissing(t *testing.T) {
+	password := []byte("incremental-password")
+	workspace := t.TempDir()
+	srcDir := filepath.Join(workspace, "Docs")
+	backupDir := filepath.Join(workspace, "target")
+	for _, dir := range []string{srcDir, backupDir} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	writeSource(t, srcDir, "a.txt", "alpha")
+
+	full := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-12", ID: util.BackupID("FUL001")}
+	testutil.CreateChainBackup(t, srcDir, backupDir, full, nil, password)
+	inc := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-13", ID: util.BackupID("INC001")}
+	testutil.CreateChainBackup(t, srcDir, backupDir, inc, &full, password)
+
+	parts, err := catalog.CollectParts(backupDir, full)
+	if err != nil {
+		t.Fatalf("CollectParts failed: %v", err)
+	}
+	for _, part := range parts {
+		if err := os.Remove(part); err != nil {
+			t.Fatalf("failed to remove part: %v", err)
+		}
+	}
+
+	_, err = restoreEntry(inc, backupDir, filepath.Join(workspace, "restore"), password, nil, util.ExtractOptions{})
+	if err == nil || !strings.Contains(err.Error(), "Backup chain") {
+		t.Fatalf("expected incomplete chain error, got: %v", err)
+	}
+}
+
+func writeSource(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+}
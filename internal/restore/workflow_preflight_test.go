@@ -33,7 +33,7 @@ func TestBuildRestorePreflightReportsErrors(t *testing.T) {
 		t.Fatalf("failed to create restore output dir: %v", err)
 	}
 
-	items := buildRestorePreflight([]util.BackupEntry{entryWithParts, entryWithoutParts}, backupDir, restorePath)
+	items := buildRestorePreflight([]util.BackupEntry{entryWithParts, entryWithoutParts}, backupDir, restorePath, util.ConflictFail)
 	if len(items) != 2 {
 		t.Fatalf("expected 2 preflight items, got %d", len(items))
 	}
@@ -60,7 +60,7 @@ func TestPrintRestorePreflightShowsRestoreDirectoriesWithPerDirectoryErrors(t *t
 	}}
 
 	var sb strings.Builder
-	printRestorePreflightWithYubiKeyCheck(&sb, &util.Config{}, backupDir, restorePath, items, false, false, operation.LocalStagingPlan{}, func() error { return nil })
+	printRestorePreflightWithYubiKeyCheck(&sb, &util.Config{}, backupDir, restorePath, items, util.ConflictFail, false, false, operation.LocalStagingPlan{}, func() error { return nil })
 	output := sb.String()
 
 	if strings.Contains(output, "Restore target :") {
@@ -90,7 +90,7 @@ func TestPrintRestorePreflightShowsYubiKeyOKAfterAuthentication(t *testing.T) {
 	items := []restorePreflightItem{{Entry: util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-20", ID: util.BackupID("ABC123")}, PartCount: 1}}
 
 	var sb strings.Builder
-	printRestorePreflightWithYubiKeyCheck(&sb, &util.Config{}, backupDir, restorePath, items, true, false, operation.LocalStagingPlan{}, func() error { return nil })
+	printRestorePreflightWithYubiKeyCheck(&sb, &util.Config{}, backupDir, restorePath, items, util.ConflictFail, true, false, operation.LocalStagingPlan{}, func() error { return nil })
 	output := sb.String()
 
 	authLine := "Authentication: password + YubiKey"
@@ -117,7 +117,7 @@ func TestPrintRestorePreflightShowsYubiKeyWarnAfterAuthentication(t *testing.T)
 	items := []restorePreflightItem{{Entry: util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-20", ID: util.BackupID("ABC123")}, PartCount: 1}}
 
 	var sb strings.Builder
-	printRestorePreflightWithYubiKeyCheck(&sb, &util.Config{}, backupDir, restorePath, items, true, false, operation.LocalStagingPlan{}, func() error { return errors.New("no YubiKey detected") })
+	printRestorePreflightWithYubiKeyCheck(&sb, &util.Config{}, backupDir, restorePath, items, util.ConflictFail, true, false, operation.LocalStagingPlan{}, func() error { return errors.New("no YubiKey detected") })
 	output := sb.String()
 
 	authLine := "Authentication: password + YubiKey"
@@ -152,7 +152,7 @@ func TestBuildRestorePreflightIncludesTotalSizeBytes(t *testing.T) {
 		t.Fatalf("failed to create part file: %v", err)
 	}
 
-	items := buildRestorePreflight([]util.BackupEntry{entry}, backupDir, restorePath)
+	items := buildRestorePreflight([]util.BackupEntry{entry}, backupDir, restorePath, util.ConflictFail)
 	if len(items) != 1 {
 		t.Fatalf("expected one preflight item, got %d", len(items))
 	}
@@ -176,7 +176,7 @@ func TestPrintRestorePreflightShowsInsufficientSpaceError(t *testing.T) {
 	}}
 
 	var sb strings.Builder
-	printRestorePreflightWithYubiKeyCheck(&sb, &util.Config{}, backupDir, restorePath, items, false, false, operation.LocalStagingPlan{}, func() error { return nil })
+	printRestorePreflightWithYubiKeyCheck(&sb, &util.Config{}, backupDir, restorePath, items, util.ConflictFail, false, false, operation.LocalStagingPlan{}, func() error { return nil })
 	output := sb.String()
 
 	if !strings.Contains(output, "[ERROR] Insufficient free space for restore:") {
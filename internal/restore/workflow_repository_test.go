@@ -0,0 +1,43 @@
+package restore
+
+import (
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRestoreEntryExtractsRepositorySnapshot(t *testing.T) {
+	password := []byte("repository-password")
+	workspace := t.TempDir()
+	srcDir := filepath.Join(workspace, "Docs")
+	backupDir := filepath.Join(workspace, "target")
+	restoreRoot := filepath.Join(workspace, "restore")
+	for _, dir := range []string{filepath.Join(srcDir, "sub"), backupDir, restoreRoot} {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			t.Fatalf("failed to create %s: %v", dir, err)
+		}
+	}
+	writeSource(t, srcDir, "a.txt", "alpha")
+	writeSource(t, srcDir, filepath.Join("sub", "b.txt"), "bravo")
+
+	entry := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-12", ID: util.BackupID("SNP001")}
+	testutil.CreateSnapshotBackup(t, srcDir, backupDir, entry, password)
+
+	partCount, err := restoreEntry(entry, backupDir, restoreRoot, password, nil, util.ExtractOptions{})
+	if err != nil {
+		t.Fatalf("restoreEntry failed: %v", err)
+	}
+	if partCount != 1 {
+		t.Fatalf("expected the snapshot to count as one part, got %d", partCount)
+	}
+
+	restoredDir := filepath.Join(restoreRoot, "Docs")
+	for name, want := range map[string]string{"a.txt": "alpha", filepath.Join("sub", "b.txt"): "bravo"} {
+		got, err := os.ReadFile(filepath.Join(restoredDir, name))
+		if err != nil || string(got) != want {
+			t.Fatalf("expected %s to contain %q, got %q, %v", name, want, got, err)
+		}
+	}
+}
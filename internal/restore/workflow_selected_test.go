@@ -20,6 +20,8 @@ func TestRestoreSelectedEntriesRoundTrip(t *testing.T) {
 		password,
 		nil,
 		operation.LocalStagingPlan{},
+		util.ExtractOptions{},
+		nil,
 	)
 	if err != nil {
 		t.Fatalf("restoreSelectedEntries failed: %v", err)
@@ -45,6 +47,8 @@ func TestRestoreSelectedEntriesWrongPasswordFails(t *testing.T) {
 		[]byte("wrong-password"),
 		nil,
 		operation.LocalStagingPlan{},
+		util.ExtractOptions{},
+		nil,
 	)
 	if err == nil {
 		t.Fatal("expected error for wrong password, got nil")
@@ -65,6 +69,8 @@ func TestRestoreSelectedEntriesWithStagingRoundTrip(t *testing.T) {
 		password,
 		nil,
 		plan,
+		util.ExtractOptions{},
+		nil,
 	)
 	if err != nil {
 		t.Fatalf("restoreSelectedEntries with staging failed: %v", err)
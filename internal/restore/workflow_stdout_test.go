@@ -0,0 +1,82 @@
+package restore
+
+import (
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriteEntryWritesTarArchive(t *testing.T) {
+	t.Parallel()
+
+	fx := testutil.NewBackupFixture(t, []byte("stdout-password"))
+	var out bytes.Buffer
+	if err := writeEntry(&out, fx.Entry, fx.BackupDir, fx.Password, nil, &util.PathSelector{}); err != nil {
+		t.Fatalf("writeEntry failed: %v", err)
+	}
+
+	names := map[string]bool{}
+	tr := tar.NewReader(&out)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("output is not a valid TAR archive: %v", err)
+		}
+		names[strings.TrimSuffix(hdr.Name, "/")] = true
+	}
+	if !names["nested/small.txt"] || !names["large.bin"] {
+		t.Fatalf("expected the backed-up files in the TAR archive, got %v", names)
+	}
+}
+
+func TestWriteEntryWritesSingleSelectedFile(t *testing.T) {
+	t.Parallel()
+
+	fx := testutil.NewBackupFixture(t, []byte("stdout-password"))
+	selector, err := util.NewPathSelector([]string{"**/small.txt"})
+	if err != nil {
+		t.Fatalf("NewPathSelector failed: %v", err)
+	}
+	var out bytes.Buffer
+	if err := writeEntry(&out, fx.Entry, fx.BackupDir, fx.Password, nil, selector); err != nil {
+		t.Fatalf("writeEntry failed: %v", err)
+	}
+	if out.String() != "hello restoresafe" {
+		t.Fatalf("expected the content of the selected file, got %q", out.String())
+	}
+
+	missing, _ := util.NewPathSelector([]string{"missing.txt"})
+	if err := writeEntry(io.Discard, fx.Entry, fx.BackupDir, fx.Password, nil, missing); !errors.Is(err, errNoSelectedFile) {
+		t.Fatalf("expected errNoSelectedFile, got %v", err)
+	}
+
+	all, _ := util.NewPathSelector([]string{"**"})
+	if err := writeEntry(io.Discard, fx.Entry, fx.BackupDir, fx.Password, nil, all); err == nil || !strings.Contains(err.Error(), "more than one file") {
+		t.Fatalf("expected a selection of several files to be rejected, got %v", err)
+	}
+}
+
+func TestWriteEntryWritesRawStream(t *testing.T) {
+	t.Parallel()
+
+	password := []byte("stream-password")
+	backupDir := t.TempDir()
+	entry := util.BackupEntry{DirectoryName: "crm.dump", Date: "2026-03-12", ID: util.BackupID("OUT001")}
+	testutil.CreateStreamBackup(t, backupDir, entry, []byte("dump content"), password)
+
+	var out bytes.Buffer
+	if err := writeEntry(&out, entry, backupDir, password, nil, &util.PathSelector{}); err != nil {
+		t.Fatalf("writeEntry failed: %v", err)
+	}
+	if out.String() != "dump content" {
+		t.Fatalf("expected the raw stream, got %q", out.String())
+	}
+}
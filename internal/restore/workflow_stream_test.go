@@ -0,0 +1,92 @@
+package restore
+
+import (
+	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHelperCommand(t *testing.T) {
+	testutil.RunHelperCommand()
+}
+
+func TestRestoreEntryWritesCommandOutputAsFile(t *testing.T) {
+	password := []byte("stream-password")
+	backupDir := t.TempDir()
+	restoreRoot := t.TempDir()
+	entry := util.BackupEntry{DirectoryName: "crm.dump", Date: "2026-03-12", ID: util.BackupID("CMD001")}
+	testutil.CreateStreamBackup(t, backupDir, entry, []byte("dump content"), password)
+
+	if _, err := restoreEntry(entry, backupDir, restoreRoot, password, nil, util.ExtractOptions{}); err != nil {
+		t.Fatalf("restoreEntry failed: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(restoreRoot, "crm.dump"))
+	if err != nil || string(got) != "dump content" {
+		t.Fatalf("expected the command output at restorePath/crm.dump, got %q, %v", got, err)
+	}
+
+	// A second restore follows the conflict policy like any other file.
+	_, err = restoreEntry(entry, backupDir, restoreRoot, password, nil, util.ExtractOptions{Conflict: util.ConflictRename})
+	if err != nil {
+		t.Fatalf("restoreEntry with rename policy failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(restoreRoot, "crm (restored).dump")); err != nil {
+		t.Fatalf("expected the output restored next to the existing file: %v", err)
+	}
+}
+
+func TestRestoreSelectedEntriesPipesCommandOutput(t *testing.T) {
+	password := []byte("stream-password")
+	backupDir := t.TempDir()
+	restoreRoot := t.TempDir()
+	entry := util.BackupEntry{DirectoryName: "crm.dump", Date: "2026-03-12", ID: util.BackupID("CMD002")}
+	testutil.CreateStreamBackup(t, backupDir, entry, []byte("dump content"), password)
+
+	received := filepath.Join(t.TempDir(), "stdin.bin")
+	command, args := testutil.HelperCommand(t, "", "", 0, received)
+	commands := map[string]util.CommandSource{
+		"crm.dump": {Name: "crm.dump", RestoreCommand: command, RestoreArgs: args},
+	}
+	if _, err := restoreSelectedEntries([]util.BackupEntry{entry}, backupDir, restoreRoot, password, nil, operation.LocalStagingPlan{}, util.ExtractOptions{}, commands); err != nil {
+		t.Fatalf("restoreSelectedEntries failed: %v", err)
+	}
+	got, err := os.ReadFile(received)
+	if err != nil || string(got) != "dump content" {
+		t.Fatalf("expected the command output on standard input of the restore command, got %q, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(restoreRoot, "crm.dump")); !os.IsNotExist(err) {
+		t.Fatalf("expected no file in the restore destination, got %v", err)
+	}
+
+	failing, failingArgs := testutil.HelperCommand(t, "", "relation already exists\n", 1, received)
+	commands["crm.dump"] = util.CommandSource{Name: "crm.dump", RestoreCommand: failing, RestoreArgs: failingArgs}
+	_, err = restoreSelectedEntries([]util.BackupEntry{entry}, backupDir, restoreRoot, password, nil, operation.LocalStagingPlan{}, util.ExtractOptions{}, commands)
+	if err == nil || !strings.Contains(err.Error(), "relation already exists") {
+		t.Fatalf("expected the failing restore command to be reported, got %v", err)
+	}
+}
+
+func TestResolveRestoreCommandsRequiresRestoreCommandForPipe(t *testing.T) {
+	backupDir := t.TempDir()
+	entry := util.BackupEntry{DirectoryName: "crm.dump", Date: "2026-03-12", ID: util.BackupID("CMD003")}
+	testutil.CreateStreamBackup(t, backupDir, entry, []byte("dump content"), []byte("pw"))
+	cfg := &util.Config{CommandSources: []util.CommandSource{{Name: "crm.dump", Command: "pg_dump"}}}
+
+	commands, err := resolveRestoreCommands(cfg, []util.BackupEntry{entry}, backupDir, &Options{})
+	if err != nil || commands != nil {
+		t.Fatalf("expected the output to be written to a file without -pipe, got %v, %v", commands, err)
+	}
+	if _, err := resolveRestoreCommands(cfg, []util.BackupEntry{entry}, backupDir, &Options{Pipe: true}); err == nil || !strings.Contains(err.Error(), "No restore command") {
+		t.Fatalf("expected an error for -pipe without restore_command, got %v", err)
+	}
+
+	cfg.CommandSources[0].RestoreCommand = "psql"
+	commands, err = resolveRestoreCommands(cfg, []util.BackupEntry{entry}, backupDir, &Options{Pipe: true})
+	if err != nil || commands["crm.dump"].RestoreCommand != "psql" {
+		t.Fatalf("expected the restore command to be used, got %v, %v", commands, err)
+	}
+}
@@ -67,7 +67,7 @@ func TestRestoreEntryReturnsErrorWhenNoPartsFound(t *testing.T) {
 	backupDir := t.TempDir()
 	entry := util.BackupEntry{DirectoryName: "Ghost", Date: "2026-03-14", ID: util.BackupID("GHO001")}
 
-	_, err := restoreEntry(entry, backupDir, t.TempDir(), []byte("pw"), nil)
+	_, err := restoreEntry(entry, backupDir, t.TempDir(), []byte("pw"), nil, util.ExtractOptions{})
 	if err == nil {
 		t.Fatal("expected error when no parts found, got nil")
 	}
@@ -0,0 +1,76 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// KeySize is the length of the raw keys used by SealBlob and OpenBlob.
+const KeySize = keyLen
+
+// ErrBlobAuthentication is returned when a sealed blob fails authentication.
+var ErrBlobAuthentication = errors.New("Encrypted data is corrupted or was sealed with a different key")
+
+// NewRandomKey returns a random 256-bit key.
+func NewRandomKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("Failed to generate key: %w", err)
+	}
+	return key, nil
+}
+
+// SealBlob encrypts a self-contained blob with a raw 256-bit key using AES-256-GCM.
+// Unlike Encrypt, no key is derived from a password, so sealing many small blobs
+// (such as repository chunks) stays cheap. The result is a random nonce followed by
+// the ciphertext and tag.
+func SealBlob(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newBlobGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceLen, nonceLen+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("Failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// OpenBlob decrypts a blob produced by SealBlob.
+func OpenBlob(key, sealed []byte) ([]byte, error) {
+	gcm, err := newBlobGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < nonceLen+gcm.Overhead() {
+		return nil, ErrBlobAuthentication
+	}
+	plaintext, err := gcm.Open(nil, sealed[:nonceLen], sealed[nonceLen:], nil)
+	if err != nil {
+		return nil, ErrBlobAuthentication
+	}
+	return plaintext, nil
+}
+
+// SealedBlobSize returns the size of a sealed blob holding n bytes of plaintext.
+func SealedBlobSize(n int) int {
+	return nonceLen + n + 16
+}
+
+func newBlobGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("Invalid key length %d (expected %d)", len(key), KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create AES cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create GCM: %w", err)
+	}
+	return gcm, nil
+}
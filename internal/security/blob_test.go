@@ -0,0 +1,51 @@
+package security
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSealBlobRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	key, err := NewRandomKey()
+	if err != nil {
+		t.Fatalf("NewRandomKey returned error: %v", err)
+	}
+	plaintext := []byte("chunk content")
+	sealed, err := SealBlob(key, plaintext)
+	if err != nil {
+		t.Fatalf("SealBlob returned error: %v", err)
+	}
+	if len(sealed) != SealedBlobSize(len(plaintext)) {
+		t.Fatalf("expected sealed size %d, got %d", SealedBlobSize(len(plaintext)), len(sealed))
+	}
+
+	opened, err := OpenBlob(key, sealed)
+	if err != nil {
+		t.Fatalf("OpenBlob returned error: %v", err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Fatalf("expected %q, got %q", plaintext, opened)
+	}
+}
+
+func TestOpenBlobRejectsTamperedDataAndWrongKey(t *testing.T) {
+	t.Parallel()
+
+	key, _ := NewRandomKey()
+	other, _ := NewRandomKey()
+	sealed, err := SealBlob(key, []byte("chunk content"))
+	if err != nil {
+		t.Fatalf("SealBlob returned error: %v", err)
+	}
+
+	if _, err := OpenBlob(other, sealed); !errors.Is(err, ErrBlobAuthentication) {
+		t.Fatalf("expected authentication error for wrong key, got: %v", err)
+	}
+	sealed[len(sealed)-1] ^= 0xFF
+	if _, err := OpenBlob(key, sealed); !errors.Is(err, ErrBlobAuthentication) {
+		t.Fatalf("expected authentication error for tampered data, got: %v", err)
+	}
+}
@@ -120,9 +120,14 @@ func Encrypt(dst io.Writer, src io.Reader, password []byte, params Argon2Params)
 		return err
 	}
 
-	// Stream plaintext in chunks.
+	return encryptChunks(dst, src, gcm, 0)
+}
+
+// encryptChunks streams plaintext from src in chunkSize chunks and writes one frame
+// per chunk to dst, starting with chunk index first.
+func encryptChunks(dst io.Writer, src io.Reader, gcm cipher.AEAD, first uint64) error {
 	buf := make([]byte, chunkSize)
-	var chunkIndex uint64
+	chunkIndex := first
 
 	for {
 		n, readErr := io.ReadFull(src, buf)
@@ -158,52 +163,23 @@ func Encrypt(dst io.Writer, src io.Reader, password []byte, params Argon2Params)
 // plaintext to dst. The Argon2id parameters are read from the file header.
 // Returns ErrWrongPassword if authentication fails.
 func Decrypt(dst io.Writer, src io.Reader, password []byte) error {
-	salt, params, err := readHeader(src)
+	r, err := NewDecryptReader(src, password)
 	if err != nil {
 		return err
 	}
 
-	key := deriveKey(password, salt, params)
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return fmt.Errorf("Failed to create AES cipher: %w", err)
-	}
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return fmt.Errorf("Failed to create GCM: %w", err)
-	}
-
-	var chunkIndex uint64
-
 	for {
-		var length uint32
-		if err := binary.Read(src, binary.BigEndian, &length); err != nil {
-			if errors.Is(err, io.EOF) {
-				break
-			}
-			return fmt.Errorf("Failed to read chunk length: %w. Remedy: Check backup-part completeness and file readability.", err)
-		}
-		if length > maxEncryptedChunkSize {
-			return fmt.Errorf("Invalid encrypted chunk length: %d. Remedy: Use an unmodified backup created by this RestoreSafe version.", length)
-		}
-
-		encrypted := make([]byte, length)
-		if _, err := io.ReadFull(src, encrypted); err != nil {
-			return fmt.Errorf("Failed to read chunk data: %w. Remedy: Check backup-part completeness and file readability.", err)
+		plaintext, err := r.readChunk()
+		if errors.Is(err, io.EOF) {
+			break
 		}
-
-		nonce := chunkNonce(chunkIndex)
-		plaintext, err := gcm.Open(nil, nonce, encrypted, nil)
 		if err != nil {
-			return ErrWrongPassword
+			return err
 		}
 
 		if _, err := dst.Write(plaintext); err != nil {
 			return fmt.Errorf("Failed to write decrypted data: %w", err)
 		}
-
-		chunkIndex++
 	}
 
 	return nil
@@ -0,0 +1,184 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// headerLen is the byte length of the v2 file header written by writeHeader.
+const headerLen = len(magicPrefix) + 2 + 4 + saltLen + 4 + 4 + 4 + 4
+
+// frameLen is the on-disk size of one full chunk: 4-byte length prefix + sealed chunk.
+// Encrypt fills every chunk except the last one completely, so all non-final
+// frames have exactly this size.
+const frameLen = 4 + maxEncryptedChunkSize
+
+// DecryptReader decrypts a stream produced by Encrypt on demand.
+//
+// When the underlying source implements io.Seeker, Seek skips whole chunks
+// without reading or decrypting them. Skipped chunks are not authenticated;
+// only data actually returned by Read is.
+type DecryptReader struct {
+	src  io.Reader
+	gcm  cipher.AEAD
+	seek io.Seeker
+
+	chunk      []byte // current decrypted chunk
+	chunkStart int64  // plaintext offset of chunk[0]
+	chunkOff   int    // read position within chunk
+	nextIndex  uint64 // index of the next chunk frame in src
+	skip       int    // bytes to drop from the next loaded chunk after a Seek
+	short      bool   // a short (final) chunk has been read
+	pos        int64  // plaintext position
+	err        error
+}
+
+// NewDecryptReader reads the file header from src and derives the key.
+// src must be positioned at the start of the encrypted stream.
+// Returns ErrWrongPassword from Read if authentication of a chunk fails.
+func NewDecryptReader(src io.Reader, password []byte) (*DecryptReader, error) {
+	salt, params, err := readHeader(src)
+	if err != nil {
+		return nil, err
+	}
+
+	key := deriveKey(password, salt, params)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create AES cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create GCM: %w", err)
+	}
+
+	r := &DecryptReader{src: src, gcm: gcm}
+	if s, ok := src.(io.Seeker); ok {
+		r.seek = s
+	}
+	return r, nil
+}
+
+// Read implements io.Reader.
+func (r *DecryptReader) Read(p []byte) (int, error) {
+	for r.chunkOff >= len(r.chunk) {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if err := r.loadChunk(); err != nil {
+			r.err = err
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.chunk[r.chunkOff:])
+	r.chunkOff += n
+	r.pos += int64(n)
+	return n, nil
+}
+
+// Seek implements io.Seeker for io.SeekStart and io.SeekCurrent.
+// It is only supported when the underlying source is seekable.
+func (r *DecryptReader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = r.pos + offset
+	default:
+		return r.pos, fmt.Errorf("Seek relative to the end of an encrypted stream is not supported")
+	}
+	if target < 0 {
+		return r.pos, fmt.Errorf("Invalid seek to negative offset %d", target)
+	}
+	if target == r.pos {
+		return r.pos, nil
+	}
+	if r.seek == nil {
+		return r.pos, fmt.Errorf("Encrypted source is not seekable")
+	}
+
+	// Stay within the already decrypted chunk when possible.
+	if r.chunk != nil && target >= r.chunkStart && target < r.chunkStart+int64(len(r.chunk)) {
+		r.chunkOff = int(target - r.chunkStart)
+		r.pos = target
+		return r.pos, nil
+	}
+
+	index := target / chunkSize
+	if _, err := r.seek.Seek(int64(headerLen)+index*frameLen, io.SeekStart); err != nil {
+		return r.pos, fmt.Errorf("Failed to seek in encrypted source: %w", err)
+	}
+	r.chunk = nil
+	r.chunkOff = 0
+	r.chunkStart = index * chunkSize
+	r.nextIndex = uint64(index)
+	r.skip = int(target % chunkSize)
+	r.short = false
+	r.err = nil
+	r.pos = target
+	return r.pos, nil
+}
+
+// loadChunk reads, authenticates and decrypts the next chunk frame.
+func (r *DecryptReader) loadChunk() error {
+	start := int64(r.nextIndex) * chunkSize
+	plaintext, err := r.readChunk()
+	if err != nil {
+		return err
+	}
+
+	r.chunk = plaintext
+	r.chunkStart = start
+	r.chunkOff = 0
+	if r.skip > 0 {
+		// A seek landed inside this chunk; drop the bytes before the target.
+		if r.skip > len(plaintext) {
+			r.chunkOff = len(plaintext)
+			r.skip = 0
+			return io.EOF
+		}
+		r.chunkOff = r.skip
+		r.skip = 0
+	}
+	return nil
+}
+
+// readChunk reads and decrypts the next chunk frame from src.
+// Returns io.EOF at a clean end of stream.
+func (r *DecryptReader) readChunk() ([]byte, error) {
+	var length uint32
+	if err := binary.Read(r.src, binary.BigEndian, &length); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("Failed to read chunk length: %w. Remedy: Check backup-part completeness and file readability.", err)
+	}
+	if length > maxEncryptedChunkSize {
+		return nil, fmt.Errorf("Invalid encrypted chunk length: %d. Remedy: Use an unmodified backup created by this RestoreSafe version.", length)
+	}
+	if r.short {
+		return nil, fmt.Errorf("Invalid encrypted chunk layout: data follows a final chunk. Remedy: Use an unmodified backup created by this RestoreSafe version.")
+	}
+
+	encrypted := make([]byte, length)
+	if _, err := io.ReadFull(r.src, encrypted); err != nil {
+		return nil, fmt.Errorf("Failed to read chunk data: %w. Remedy: Check backup-part completeness and file readability.", err)
+	}
+
+	nonce := chunkNonce(r.nextIndex)
+	plaintext, err := r.gcm.Open(nil, nonce, encrypted, nil)
+	if err != nil {
+		return nil, ErrWrongPassword
+	}
+
+	r.nextIndex++
+	r.short = length < maxEncryptedChunkSize
+	return plaintext, nil
+}
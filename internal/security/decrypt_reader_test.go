@@ -0,0 +1,109 @@
+package security
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// encryptMultiChunk returns a plaintext spanning three chunks and its ciphertext.
+func encryptMultiChunk(t *testing.T, password []byte) ([]byte, []byte) {
+	t.Helper()
+
+	plaintext := make([]byte, 2*chunkSize+123)
+	for i := range plaintext {
+		plaintext[i] = byte(i % 251)
+	}
+
+	var encrypted bytes.Buffer
+	params := Argon2Params{Time: 1, MemoryKB: 8 * 1024, Threads: 1}
+	if err := Encrypt(&encrypted, bytes.NewReader(plaintext), password, params); err != nil {
+		t.Fatalf("Encrypt returned error: %v", err)
+	}
+	return plaintext, encrypted.Bytes()
+}
+
+func TestDecryptReaderReadsWholeStream(t *testing.T) {
+	password := []byte("reader-password")
+	plaintext, encrypted := encryptMultiChunk(t, password)
+
+	r, err := NewDecryptReader(bytes.NewReader(encrypted), password)
+	if err != nil {
+		t.Fatalf("NewDecryptReader returned error: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll returned error: %v", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Fatalf("decrypted stream mismatch: expected %d bytes, got %d", len(plaintext), len(got))
+	}
+}
+
+func TestDecryptReaderSeekAcrossChunks(t *testing.T) {
+	password := []byte("seek-password")
+	plaintext, encrypted := encryptMultiChunk(t, password)
+
+	r, err := NewDecryptReader(bytes.NewReader(encrypted), password)
+	if err != nil {
+		t.Fatalf("NewDecryptReader returned error: %v", err)
+	}
+
+	readAt := func(offset int64, whence int, want int64) {
+		t.Helper()
+		pos, err := r.Seek(offset, whence)
+		if err != nil {
+			t.Fatalf("Seek(%d, %d) returned error: %v", offset, whence, err)
+		}
+		if pos != want {
+			t.Fatalf("Seek(%d, %d): expected position %d, got %d", offset, whence, want, pos)
+		}
+		buf := make([]byte, 16)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatalf("read after seek to %d failed: %v", want, err)
+		}
+		if !bytes.Equal(buf, plaintext[want:want+16]) {
+			t.Fatalf("unexpected data at offset %d", want)
+		}
+	}
+
+	readAt(chunkSize+5, io.SeekStart, chunkSize+5)
+	readAt(3, io.SeekStart, 3)
+	readAt(chunkSize, io.SeekCurrent, chunkSize+3+16)
+	readAt(2*chunkSize+100, io.SeekStart, 2*chunkSize+100)
+
+	if _, err := r.Seek(int64(len(plaintext))+10, io.SeekStart); err != nil {
+		t.Fatalf("Seek past end returned error: %v", err)
+	}
+	if n, err := r.Read(make([]byte, 1)); n != 0 || !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF after seeking past end, got n=%d err=%v", n, err)
+	}
+}
+
+func TestDecryptReaderSeekRequiresSeekableSource(t *testing.T) {
+	password := []byte("pipe-password")
+	_, encrypted := encryptMultiChunk(t, password)
+
+	r, err := NewDecryptReader(io.MultiReader(bytes.NewReader(encrypted)), password)
+	if err != nil {
+		t.Fatalf("NewDecryptReader returned error: %v", err)
+	}
+	_, err = r.Seek(chunkSize+1, io.SeekStart)
+	if err == nil || !strings.Contains(err.Error(), "not seekable") {
+		t.Fatalf("expected not-seekable error, got: %v", err)
+	}
+}
+
+func TestDecryptReaderWrongPassword(t *testing.T) {
+	_, encrypted := encryptMultiChunk(t, []byte("correct-password"))
+
+	r, err := NewDecryptReader(bytes.NewReader(encrypted), []byte("wrong-password"))
+	if err != nil {
+		t.Fatalf("NewDecryptReader returned error: %v", err)
+	}
+	if _, err := r.Read(make([]byte, 1)); !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword, got: %v", err)
+	}
+}
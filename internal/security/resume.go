@@ -0,0 +1,56 @@
+package security
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// StreamLayout describes how Encrypt lays out a stream: a header of HeaderSize
+// bytes, then one frame of FrameSize bytes per ChunkSize bytes of plaintext. Only
+// the final frame may be shorter.
+type StreamLayout struct {
+	HeaderSize int64
+	FrameSize  int64
+	ChunkSize  int64
+}
+
+// Layout returns the layout of the streams written by Encrypt.
+func Layout() StreamLayout {
+	return StreamLayout{HeaderSize: int64(headerLen), FrameSize: frameLen, ChunkSize: chunkSize}
+}
+
+// Resumer continues a stream written by Encrypt that was interrupted after its
+// first frames were stored, with the key and nonce sequence of that stream.
+type Resumer struct {
+	gcm cipher.AEAD
+}
+
+// NewResumer reads the header and the first frame of an interrupted stream from
+// src and derives its key. The first frame authenticates the password; a wrong
+// password returns ErrWrongPassword.
+func NewResumer(src io.Reader, password []byte) (*Resumer, error) {
+	r, err := NewDecryptReader(src, password)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.readChunk(); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("Encrypted stream holds no chunk to resume from. Remedy: Start a new backup run.")
+		}
+		return nil, err
+	}
+	return &Resumer{gcm: r.gcm}, nil
+}
+
+// Encrypt reads plaintext from src and writes the frames of the stream from chunk
+// index next on, without a header, so that they follow the next stored frames.
+//
+// The frames reuse the nonces of the interrupted stream from index next on. The
+// caller must make sure that any frame of index next or later that was already
+// stored is written again with the same plaintext, since the same nonce with
+// different plaintext would weaken the encryption.
+func (r *Resumer) Encrypt(dst io.Writer, src io.Reader, next uint64) error {
+	return encryptChunks(dst, src, r.gcm, next)
+}
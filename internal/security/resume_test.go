@@ -0,0 +1,39 @@
+package security
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestResumerContinuesStreamWithSameFrames(t *testing.T) {
+	password := []byte("resume-password")
+	plaintext, encrypted := encryptMultiChunk(t, password)
+
+	// The stream was interrupted after its header and first frame were stored.
+	layout := Layout()
+	stored := encrypted[:layout.HeaderSize+layout.FrameSize]
+
+	r, err := NewResumer(bytes.NewReader(stored), password)
+	if err != nil {
+		t.Fatalf("NewResumer returned error: %v", err)
+	}
+	var rest bytes.Buffer
+	if err := r.Encrypt(&rest, bytes.NewReader(plaintext[layout.ChunkSize:]), 1); err != nil {
+		t.Fatalf("Encrypt returned error: %v", err)
+	}
+
+	resumed := append(append([]byte{}, stored...), rest.Bytes()...)
+	if !bytes.Equal(resumed, encrypted) {
+		t.Fatalf("resumed stream differs from the uninterrupted stream")
+	}
+}
+
+func TestNewResumerRejectsWrongPassword(t *testing.T) {
+	_, encrypted := encryptMultiChunk(t, []byte("right-password"))
+
+	_, err := NewResumer(bytes.NewReader(encrypted), []byte("wrong-password"))
+	if !errors.Is(err, ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword, got %v", err)
+	}
+}
@@ -3,6 +3,7 @@ package startup
 import (
 	"RestoreSafe/internal/catalog"
 	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/repository"
 	"RestoreSafe/internal/security"
 	"RestoreSafe/internal/util"
 	"fmt"
@@ -11,6 +12,7 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 )
 
 type healthSeverity int
@@ -30,6 +32,9 @@ const (
 	healthScopeBackupInventory = "Backup inventory"
 	healthScopeBackupSet       = "Backup set"
 	healthScopeChallengeFile   = "Challenge file"
+	healthScopeManifestFile    = "Manifest file"
+	healthScopeBackupChain     = "Backup chain"
+	healthScopeRepository      = "Repository"
 )
 
 type healthItem struct {
@@ -110,9 +115,16 @@ func collectStartupHealthItemsWithConfigPath(cfg *util.Config, exeDir, configPat
 		}
 	}
 
+	backupDirs := []string{backupDir}
 	items = append(items, checkBackupDirectoryHealth(backupDir)...)
+	for _, dir := range cfg.BackupDestinations()[1:] {
+		dir = util.ResolveDir(dir, exeDir)
+		backupDirs = append(backupDirs, dir)
+		items = append(items, checkSecondaryBackupDirectoryHealth(dir)...)
+	}
 	items = append(items, checkYubiKeyHealth(cfg)...)
 	items = append(items, checkBackupInventoryHealth(backupDir)...)
+	items = append(items, checkIncompleteRunHealth(backupDirs)...)
 
 	// Prefer a source that shares the target volume so staging is detected when
 	// only some sources are on the same drive as the target (mirrors backup/workflow.go).
@@ -156,7 +168,7 @@ func checkConfigFileHealth(configPathDisplay string) []healthItem {
 }
 
 func checkBackupDirectoryHealth(backupDir string) []healthItem {
-	info, err := os.Stat(backupDir)
+	info, err := util.StorageFor(backupDir).Stat(backupDir)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return []healthItem{{
@@ -188,6 +200,41 @@ func checkBackupDirectoryHealth(backupDir string) []healthItem {
 	)
 }
 
+// checkSecondaryBackupDirectoryHealth checks a backup directory after the first one
+// of backup_directories. Its errors are warnings, since a backup continues with the
+// other backup directories.
+func checkSecondaryBackupDirectoryHealth(backupDir string) []healthItem {
+	items := checkBackupDirectoryHealth(backupDir)
+	for i := range items {
+		if items[i].Severity == healthError {
+			items[i].Severity = healthWarn
+			items[i].Detail += " A backup skips this directory and writes to the other backup directories."
+		}
+	}
+	return items
+}
+
+// checkIncompleteRunHealth reports the incomplete runs in backupDirs: runs that were
+// interrupted before every source succeeded, and copies of a run left by a backup
+// directory that failed while the run was written to several directories.
+func checkIncompleteRunHealth(backupDirs []string) []healthItem {
+	var items []healthItem
+	for _, dir := range backupDirs {
+		runs, err := catalog.FindIncompleteRuns(dir)
+		if err != nil {
+			continue
+		}
+		for _, run := range runs {
+			items = append(items, healthItem{
+				Severity: healthWarn,
+				Scope:    healthScopeBackupSet,
+				Detail:   fmt.Sprintf("Run %s in %s is incomplete: %s. Remedy: Its backup sets are hidden from restore; delete the run with cleanup-incomplete, or copy it from another backup directory with sync.", run.String(), filepath.ToSlash(dir), run.Reason),
+			})
+		}
+	}
+	return items
+}
+
 func checkTempDirHealth() []healthItem {
 	return probeWriteAccess(
 		os.TempDir(),
@@ -201,7 +248,12 @@ func checkTempDirHealth() []healthItem {
 // and delete access. It returns health items using the given scope and remedy strings.
 func probeWriteAccess(dir, scope, writeErrRemedy, cleanupErrRemedy string) []healthItem {
 	display := filepath.ToSlash(dir)
-	probe, err := os.CreateTemp(dir, ".restoresafe-health-*.tmp")
+	storage := util.StorageFor(dir)
+	probePath := filepath.Join(dir, fmt.Sprintf(".restoresafe-health-%d.tmp", time.Now().UnixNano()))
+	probe, err := storage.CreateNew(probePath)
+	if err == nil {
+		err = probe.Close()
+	}
 	if err != nil {
 		return []healthItem{{
 			Severity: healthError,
@@ -209,15 +261,13 @@ func probeWriteAccess(dir, scope, writeErrRemedy, cleanupErrRemedy string) []hea
 			Detail:   fmt.Sprintf("%s is not writable: %v. Remedy: %s", display, err, writeErrRemedy),
 		}}
 	}
-	probePath := probe.Name()
-	probe.Close()
 
 	items := []healthItem{{
 		Severity: healthOK,
 		Scope:    scope,
 		Detail:   display,
 	}}
-	if err := os.Remove(probePath); err != nil {
+	if err := storage.Remove(probePath); err != nil {
 		items = append(items, healthItem{
 			Severity: healthWarn,
 			Scope:    scope,
@@ -298,15 +348,40 @@ func buildBackupInventoryIssueItems(backupDir string, index []util.BackupEntry)
 			Detail:   fmt.Sprintf("Failed to inspect challenge files: %v. Remedy: Check read permissions in backup directory.", err),
 		}}
 	}
+	manifestFiles, err := listManifestFiles(backupDir)
+	if err != nil {
+		return []healthItem{{
+			Severity: healthError,
+			Scope:    healthScopeBackupInventory,
+			Detail:   fmt.Sprintf("Failed to inspect manifest files: %v. Remedy: Check read permissions in backup directory.", err),
+		}}
+	}
+
+	runInfoFiles, err := listRunInfoFiles(backupDir)
+	if err != nil {
+		return []healthItem{{
+			Severity: healthError,
+			Scope:    healthScopeBackupInventory,
+			Detail:   fmt.Sprintf("Failed to inspect run metadata files: %v. Remedy: Check read permissions in backup directory.", err),
+		}}
+	}
 
 	sorted := catalog.SortedEntries(index)
 	runHasChallenge := make(map[string]bool)
 	entryHasChallenge := make(map[string]bool)
 	expectedChallengeFiles := make(map[string]bool)
+	runHasManifest := make(map[string]bool)
+	entryHasManifest := make(map[string]bool)
+	expectedManifestFiles := make(map[string]bool)
+	expectedRunInfoFiles := make(map[string]bool)
 	items := make([]healthItem, 0)
 	structuralIssues := 0
+	snapshots := 0
 
 	for _, entry := range sorted {
+		if catalog.IsSnapshot(backupDir, entry) {
+			snapshots++
+		}
 		_, _, err := catalog.InspectBackupParts(backupDir, entry)
 		entryLabel := entry.String()
 		if err != nil {
@@ -323,6 +398,42 @@ func buildBackupInventoryIssueItems(backupDir string, index []util.BackupEntry)
 		entryHasChallenge[entryLabel] = hasChallenge
 		expectedChallengeFiles[challengeBase] = true
 		runHasChallenge[entry.RunKey()] = runHasChallenge[entry.RunKey()] || hasChallenge
+
+		manifestBase := filepath.Base(util.ManifestFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID))
+		hasManifest := manifestFiles[manifestBase]
+		entryHasManifest[entryLabel] = hasManifest
+		expectedManifestFiles[manifestBase] = true
+		runHasManifest[entry.RunKey()] = runHasManifest[entry.RunKey()] || hasManifest
+
+		expectedRunInfoFiles[filepath.Base(util.RunInfoFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID))] = true
+		// An incremental backup cannot be restored without its parents and its manifest.
+		chain, err := catalog.ResolveChain(backupDir, entry)
+		switch {
+		case err != nil:
+			structuralIssues++
+			items = append(items, healthItem{
+				Severity: healthError,
+				Scope:    healthScopeBackupChain,
+				Detail:   err.Error(),
+			})
+		case len(chain) > 1 && !hasManifest:
+			structuralIssues++
+			items = append(items, healthItem{
+				Severity: healthError,
+				Scope:    healthScopeBackupChain,
+				Detail:   fmt.Sprintf("Incremental backup %s is missing its %s file. Remedy: Put the matching manifest in the same directory as the .enc files; an incremental backup cannot be restored without it.", entryLabel, util.ManifestFileSuffix),
+			})
+		}
+	}
+
+	// Snapshots only list chunk IDs; the content is in the repository directory.
+	if snapshots > 0 && !repository.Exists(backupDir) {
+		structuralIssues++
+		items = append(items, healthItem{
+			Severity: healthError,
+			Scope:    healthScopeRepository,
+			Detail:   fmt.Sprintf("%d snapshot(s) found, but the %s directory or its keys are missing. Remedy: Restore the %s directory from a copy of the backup directory; snapshots cannot be restored without it.", snapshots, util.RepositoryDirName, util.RepositoryDirName),
+		})
 	}
 
 	for _, entry := range sorted {
@@ -334,15 +445,51 @@ func buildBackupInventoryIssueItems(backupDir string, index []util.BackupEntry)
 				Detail:   fmt.Sprintf("%s is missing its .challenge file for a YubiKey-protected backup run. Remedy: Put the matching .challenge file in the same directory as the .enc files.", entry.String()),
 			})
 		}
+		// Backups created before manifests were introduced have none; only a run
+		// with some manifests present is expected to have one for every directory.
+		if runHasManifest[entry.RunKey()] && !entryHasManifest[entry.String()] {
+			items = append(items, healthItem{
+				Severity: healthWarn,
+				Scope:    healthScopeManifestFile,
+				Detail:   fmt.Sprintf("%s is missing its %s file. Remedy: Put the matching manifest in the same directory as the .enc files; list, verify and restore fall back to the backup parts without it.", entry.String(), util.ManifestFileSuffix),
+			})
+		}
 	}
 
-	for _, orphan := range orphanChallengeFiles(challengeFiles, expectedChallengeFiles) {
+	// The files of incomplete runs are reported by checkIncompleteRunHealth.
+	if runs, err := catalog.FindIncompleteRuns(backupDir); err == nil {
+		for _, run := range runs {
+			for _, path := range run.Files {
+				name := filepath.Base(path)
+				expectedChallengeFiles[name] = true
+				expectedManifestFiles[name] = true
+				expectedRunInfoFiles[name] = true
+			}
+		}
+	}
+
+	for _, orphan := range orphanSidecarFiles(challengeFiles, expectedChallengeFiles) {
 		items = append(items, healthItem{
 			Severity: healthWarn,
 			Scope:    healthScopeChallengeFile,
 			Detail:   fmt.Sprintf("%s has no matching backup parts. Remedy: Remove the file or restore the related backup parts.", orphan),
 		})
 	}
+	for _, orphan := range orphanSidecarFiles(manifestFiles, expectedManifestFiles) {
+		items = append(items, healthItem{
+			Severity: healthWarn,
+			Scope:    healthScopeManifestFile,
+			Detail:   fmt.Sprintf("%s has no matching backup parts. Remedy: Remove the file or restore the related backup parts.", orphan),
+		})
+	}
+
+	for _, orphan := range orphanSidecarFiles(runInfoFiles, expectedRunInfoFiles) {
+		items = append(items, healthItem{
+			Severity: healthWarn,
+			Scope:    healthScopeBackupChain,
+			Detail:   fmt.Sprintf("%s has no matching backup parts. Remedy: Remove the file or restore the related backup parts.", orphan),
+		})
+	}
 
 	if structuralIssues == 0 {
 		items = append(items, healthItem{
@@ -356,7 +503,19 @@ func buildBackupInventoryIssueItems(backupDir string, index []util.BackupEntry)
 }
 
 func listChallengeFiles(backupDir string) (map[string]bool, error) {
-	entries, err := os.ReadDir(backupDir)
+	return listFilesWithSuffix(backupDir, ".challenge")
+}
+
+func listManifestFiles(backupDir string) (map[string]bool, error) {
+	return listFilesWithSuffix(backupDir, util.ManifestFileSuffix)
+}
+
+func listRunInfoFiles(backupDir string) (map[string]bool, error) {
+	return listFilesWithSuffix(backupDir, util.RunInfoFileSuffix)
+}
+
+func listFilesWithSuffix(backupDir, suffix string) (map[string]bool, error) {
+	entries, err := util.StorageFor(backupDir).List(backupDir)
 	if err != nil {
 		return nil, err
 	}
@@ -366,7 +525,7 @@ func listChallengeFiles(backupDir string) (map[string]bool, error) {
 		if entry.IsDir() {
 			continue
 		}
-		if strings.HasSuffix(entry.Name(), ".challenge") {
+		if strings.HasSuffix(entry.Name(), suffix) {
 			files[entry.Name()] = true
 		}
 	}
@@ -374,7 +533,8 @@ func listChallengeFiles(backupDir string) (map[string]bool, error) {
 	return files, nil
 }
 
-func orphanChallengeFiles(actual, expected map[string]bool) []string {
+// orphanSidecarFiles returns the names in actual that belong to no backup entry.
+func orphanSidecarFiles(actual, expected map[string]bool) []string {
 	orphans := make([]string, 0)
 	for name := range actual {
 		if !expected[name] {
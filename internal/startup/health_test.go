@@ -95,11 +95,11 @@ func TestListChallengeFilesEmptyDirectoryReturnsEmpty(t *testing.T) {
 	}
 }
 
-func TestOrphanChallengeFilesReturnsEmptyWhenAllExpected(t *testing.T) {
+func TestOrphanSidecarFilesReturnsEmptyWhenAllExpected(t *testing.T) {
 	t.Parallel()
 	actual := map[string]bool{"a.challenge": true, "b.challenge": true}
 	expected := map[string]bool{"a.challenge": true, "b.challenge": true}
-	if orphans := orphanChallengeFiles(actual, expected); len(orphans) != 0 {
+	if orphans := orphanSidecarFiles(actual, expected); len(orphans) != 0 {
 		t.Fatalf("expected no orphans when all files are expected, got: %v", orphans)
 	}
 }
@@ -136,6 +136,43 @@ func TestBuildBackupInventoryIssueItemsDetectsOrphanChallengeFile(t *testing.T)
 	}
 }
 
+func TestBuildBackupInventoryIssueItemsWarnsOnMissingManifestInRun(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	docs := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-14", ID: util.BackupID("ABC123")}
+	pics := util.BackupEntry{DirectoryName: "Pics", Date: "2026-03-14", ID: util.BackupID("ABC123")}
+	for _, entry := range []util.BackupEntry{docs, pics} {
+		part := util.PartFileName(dir, entry.DirectoryName, entry.Date, entry.ID, 1)
+		if err := os.WriteFile(part, []byte("x"), 0o600); err != nil {
+			t.Fatalf("failed to write part file: %v", err)
+		}
+	}
+	if err := os.WriteFile(util.ManifestFileName(dir, docs.DirectoryName, docs.Date, docs.ID), []byte("x"), 0o600); err != nil {
+		t.Fatalf("failed to write manifest: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "[Other]_2025-01-01_XYZ999.manifest.enc"), []byte("x"), 0o600); err != nil {
+		t.Fatalf("failed to write orphan manifest: %v", err)
+	}
+
+	items := buildBackupInventoryIssueItems(dir, []util.BackupEntry{docs, pics})
+
+	var details []string
+	for _, item := range items {
+		if item.Scope == healthScopeManifestFile {
+			if item.Severity != healthWarn {
+				t.Fatalf("expected manifest issues as warnings, got: %#v", item)
+			}
+			details = append(details, item.Detail)
+		}
+	}
+	if len(details) != 2 {
+		t.Fatalf("expected missing and orphan manifest warnings, got: %v", details)
+	}
+	if !strings.Contains(details[0], pics.String()) || !strings.Contains(details[1], "[Other]_2025-01-01_XYZ999.manifest.enc") {
+		t.Fatalf("unexpected manifest warnings: %v", details)
+	}
+}
+
 func TestPrintStartupHealthCheckShowsTempDirItemsWithNote(t *testing.T) {
 	t.Parallel()
 	items := []healthItem{
@@ -191,13 +228,13 @@ func TestHealthSeverityLabel(t *testing.T) {
 	}
 }
 
-func TestOrphanChallengeFilesReturnsSortedList(t *testing.T) {
+func TestOrphanSidecarFilesReturnsSortedList(t *testing.T) {
 	t.Parallel()
 
 	actual := map[string]bool{"b.challenge": true, "a.challenge": true, "c.challenge": true}
 	expected := map[string]bool{"b.challenge": true}
 
-	orphans := orphanChallengeFiles(actual, expected)
+	orphans := orphanSidecarFiles(actual, expected)
 	if len(orphans) != 2 {
 		t.Fatalf("expected 2 orphan files, got %d", len(orphans))
 	}
@@ -353,3 +390,55 @@ func TestPrintStartupHealthCheckGroupsScopes(t *testing.T) {
 		t.Fatalf("expected Backup directory title, got output: %q", output)
 	}
 }
+
+func TestBuildBackupInventoryIssueItemsDetectsMissingRepository(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	entry := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-14", ID: util.BackupID("SNP001")}
+	if err := os.WriteFile(util.SnapshotFileName(dir, entry.DirectoryName, entry.Date, entry.ID), []byte("x"), 0o600); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+
+	items := buildBackupInventoryIssueItems(dir, []util.BackupEntry{entry})
+
+	hasRepositoryError := false
+	for _, item := range items {
+		if item.Severity == healthError && item.Scope == healthScopeRepository {
+			hasRepositoryError = true
+			break
+		}
+	}
+	if !hasRepositoryError {
+		t.Fatalf("expected missing repository error, got items: %#v", items)
+	}
+}
+
+func TestCheckIncompleteRunHealthWarnsOnMarkedRun(t *testing.T) {
+	t.Parallel()
+	complete, failed := t.TempDir(), t.TempDir()
+	marker := util.IncompleteRunFileName(failed, "2026-05-02", util.BackupID("INC001"))
+	if err := os.WriteFile(marker, []byte("Backup run 2026-05-02_INC001 is incomplete in this directory: disk full\n"), 0o600); err != nil {
+		t.Fatalf("failed to write marker: %v", err)
+	}
+
+	items := checkIncompleteRunHealth([]string{complete, failed})
+	if len(items) != 1 || items[0].Severity != healthWarn || items[0].Scope != healthScopeBackupSet {
+		t.Fatalf("expected one warning for the incomplete run, got: %#v", items)
+	}
+	if !strings.Contains(items[0].Detail, "Run 2026-05-02_INC001") || !strings.Contains(items[0].Detail, "is incomplete: disk full.") {
+		t.Fatalf("expected the run and reason in the warning, got %q", items[0].Detail)
+	}
+}
+
+func TestCheckSecondaryBackupDirectoryHealthDowngradesErrors(t *testing.T) {
+	t.Parallel()
+	file := filepath.Join(t.TempDir(), "not-a-directory")
+	if err := os.WriteFile(file, []byte("x"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	items := checkSecondaryBackupDirectoryHealth(file)
+	if len(items) != 1 || items[0].Severity != healthWarn || !strings.Contains(items[0].Detail, "skips this directory") {
+		t.Fatalf("expected a warning for the unusable secondary directory, got: %#v", items)
+	}
+}
@@ -0,0 +1,64 @@
+// Package storage connects remote backup directories configured as storage URLs.
+package storage
+
+import (
+	"RestoreSafe/internal/storage/s3"
+	"RestoreSafe/internal/storage/sftp"
+	"RestoreSafe/internal/storage/webdav"
+	"RestoreSafe/internal/util"
+	"strings"
+)
+
+// Mount connects the storage of every backup directory of cfg that is a storage
+// URL, so that util.StorageFor serves its paths. Local paths need no mount. The
+// returned function disconnects the storages.
+func Mount(cfg *util.Config) (func(), error) {
+	var unmounts []func()
+	unmountAll := func() {
+		for _, unmount := range unmounts {
+			unmount()
+		}
+	}
+	for _, dir := range cfg.BackupDestinations() {
+		unmount, err := mount(dir, cfg)
+		if err != nil {
+			unmountAll()
+			return nil, err
+		}
+		unmounts = append(unmounts, unmount)
+	}
+	return unmountAll, nil
+}
+
+func mount(dir string, cfg *util.Config) (func(), error) {
+	if !util.IsStorageURL(dir) {
+		return func() {}, nil
+	}
+	scheme, _, _ := strings.Cut(util.CleanStoragePath(dir), "://")
+	switch scheme {
+	case "s3":
+		return s3.Mount(dir, cfg.S3)
+	case "sftp":
+		return sftp.Mount(dir, cfg.SFTP)
+	case "dav", "davs":
+		return webdav.Mount(dir, cfg.WebDAV)
+	}
+	// Config validation rejects other schemes; paths below an unmounted URL
+	// report that no storage is configured.
+	return func() {}, nil
+}
+
+// MountDirectory connects the storage of dir, a directory that is not a backup
+// directory of cfg such as the target of a sync, with the settings of cfg. The
+// backup directories of cfg are connected by Mount and are left as they are.
+func MountDirectory(dir string, cfg *util.Config) (func(), error) {
+	for _, backupDir := range cfg.BackupDestinations() {
+		if util.CleanStoragePath(backupDir) == util.CleanStoragePath(dir) {
+			return func() {}, nil
+		}
+	}
+	if err := cfg.ValidateStorageDirectory(dir); err != nil {
+		return nil, err
+	}
+	return mount(dir, cfg)
+}
@@ -0,0 +1,173 @@
+// Package s3 stores backup directories in S3-compatible object storage such as AWS
+// S3, MinIO or Backblaze B2, addressed as s3://bucket/prefix.
+package s3
+
+import (
+	"RestoreSafe/internal/util"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// client sends signed requests to one bucket.
+type client struct {
+	endpoint   *url.URL
+	bucket     string
+	region     string
+	creds      credentials
+	pathStyle  bool
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+func newClient(bucket string, cfg util.S3Config) (*client, error) {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid 's3.endpoint' %q: %w. Remedy: Set 's3.endpoint' to the base URL of the service, e.g. 'https://minio.example.com:9000'.", endpoint, err)
+	}
+	creds := credentials{AccessKeyID: cfg.AccessKeyID, SecretAccessKey: cfg.SecretAccessKey}
+	if creds.AccessKeyID == "" && creds.SecretAccessKey == "" {
+		creds = credentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return nil, fmt.Errorf("No S3 credentials found for bucket %q. Remedy: Set 's3.access_key_id' and 's3.secret_access_key' in config.yaml or the environment variables AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.", bucket)
+	}
+	return &client{
+		endpoint:   u,
+		bucket:     bucket,
+		region:     cfg.Region,
+		creds:      creds,
+		pathStyle:  cfg.PathStyle,
+		httpClient: &http.Client{Timeout: 10 * time.Minute},
+		now:        time.Now,
+	}, nil
+}
+
+// objectURL returns the URL of key in the bucket, or of the bucket itself for an empty key.
+func (c *client) objectURL(key string, query url.Values) *url.URL {
+	u := *c.endpoint
+	path := u.Path + "/" + key
+	if c.pathStyle {
+		path = u.Path + "/" + c.bucket
+		if key != "" {
+			path += "/" + key
+		}
+	} else {
+		u.Host = c.bucket + "." + u.Host
+	}
+	u.Path = path
+	u.RawPath = uriEncode(path, false)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// do sends a signed request for key and returns the response. A response with an
+// error status is closed and returned as an error naming op and key.
+func (c *client) do(method, key string, query url.Values, header http.Header, body []byte, op string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.objectURL(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	signRequest(req, payloadHash, c.creds, c.region, c.now())
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("S3 %s of %s failed: %w. Remedy: Check 's3.endpoint' and the network connection.", op, c.displayPath(key), err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, c.responseError(resp, op, key)
+	}
+	return resp, nil
+}
+
+// doXML sends a request and decodes the XML response body into out. Some S3
+// operations report a failure in the body of a 200 response, which is returned as an error.
+func (c *client) doXML(method, key string, query url.Values, header http.Header, body []byte, op string, out any) error {
+	resp, err := c.do(method, key, query, header, body, op)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("S3 %s of %s failed: %w. Remedy: Check the network connection.", op, c.displayPath(key), err)
+	}
+	var failure errorResponse
+	if xml.Unmarshal(data, &failure) == nil && failure.XMLName.Local == "Error" {
+		return c.serviceError(resp.StatusCode, failure, op, key)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := xml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("S3 %s of %s returned an unreadable response: %w. Remedy: Check that 's3.endpoint' points to an S3-compatible service.", op, c.displayPath(key), err)
+	}
+	return nil
+}
+
+// errorResponse is the XML body of a failed S3 request.
+type errorResponse struct {
+	XMLName xml.Name
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (c *client) responseError(resp *http.Response, op, key string) error {
+	var failure errorResponse
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	_ = xml.Unmarshal(data, &failure)
+	return c.serviceError(resp.StatusCode, failure, op, key)
+}
+
+// serviceError maps an S3 error to the fs errors callers check for.
+func (c *client) serviceError(status int, failure errorResponse, op, key string) error {
+	path := c.displayPath(key)
+	switch {
+	case failure.Code == "NoSuchBucket":
+		return fmt.Errorf("S3 bucket %q does not exist. Remedy: Create the bucket or correct the bucket name in backup_directory.", c.bucket)
+	case status == http.StatusNotFound || failure.Code == "NoSuchKey":
+		return &fs.PathError{Op: op, Path: path, Err: fs.ErrNotExist}
+	case status == http.StatusPreconditionFailed:
+		return &fs.PathError{Op: op, Path: path, Err: fs.ErrExist}
+	}
+	detail := http.StatusText(status)
+	if failure.Code != "" {
+		detail = failure.Code + ": " + failure.Message
+	}
+	remedy := "Check 's3.endpoint', 's3.region' and the bucket name."
+	if status == http.StatusForbidden || status == http.StatusUnauthorized {
+		remedy = "Check the S3 credentials and the permissions of the key for this bucket."
+	}
+	return fmt.Errorf("S3 %s of %s failed with status %d (%s). Remedy: %s", op, path, status, detail, remedy)
+}
+
+func (c *client) displayPath(key string) string {
+	return "s3://" + c.bucket + "/" + key
+}
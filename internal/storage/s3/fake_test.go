@@ -0,0 +1,265 @@
+package s3
+
+import (
+	"RestoreSafe/internal/util"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	fakeAccessKey = "AKIDFAKE"
+	fakeSecretKey = "fake-secret"
+)
+
+// fakeS3 is an in-process S3 service for one path-style bucket. It checks the
+// signature of every request and supports the operations Storage uses.
+type fakeS3 struct {
+	bucket   string
+	pageSize int
+
+	mu         sync.Mutex
+	objects    map[string][]byte
+	uploads    map[string]map[int][]byte
+	nextUpload int
+	completed  int
+	aborted    int
+}
+
+// newFakeS3 starts a fake service and returns it with a Storage connected to it.
+func newFakeS3(t testing.TB, bucket string) (*fakeS3, *Storage) {
+	t.Helper()
+	fake := &fakeS3{bucket: bucket, pageSize: 1000, objects: make(map[string][]byte), uploads: make(map[string]map[int][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	s, err := New(bucket, fakeConfig(server.URL))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return fake, s
+}
+
+func fakeConfig(endpoint string) util.S3Config {
+	return util.S3Config{Endpoint: endpoint, Region: "eu-central-1", AccessKeyID: fakeAccessKey, SecretAccessKey: fakeSecretKey, PathStyle: true}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.validSignature(r) {
+		writeFakeError(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		writeFakeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	query := r.URL.Query()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && key == "":
+		f.list(w, query)
+	case r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("Last-Modified", time.Date(2026, 3, 18, 12, 0, 0, 0, time.UTC).Format(http.TimeFormat))
+	case r.Method == http.MethodGet:
+		f.get(w, r, key)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			writeFakeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		parts[number] = body
+		w.Header().Set("ETag", fmt.Sprintf("\"etag-%d\"", number))
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		data, ok := f.objects[strings.TrimPrefix(source, "/"+f.bucket+"/")]
+		if !ok {
+			writeFakeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		f.objects[key] = data
+		fmt.Fprint(w, "<CopyObjectResult><ETag>\"copy\"</ETag></CopyObjectResult>")
+	case r.Method == http.MethodPut:
+		if f.rejectExisting(w, r, key) {
+			return
+		}
+		f.objects[key] = body
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.nextUpload++
+		id := strconv.Itoa(f.nextUpload)
+		f.uploads[id] = make(map[int][]byte)
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		f.complete(w, r, key, query.Get("uploadId"), body)
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		f.aborted++
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeFakeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// validSignature signs a copy of r as the client would have and compares the result.
+func (f *fakeS3) validSignature(r *http.Request) bool {
+	date, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	check, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	if err != nil {
+		return false
+	}
+	for name, values := range r.Header {
+		lower := strings.ToLower(name)
+		if lower == "range" || (strings.HasPrefix(lower, "x-amz-") && lower != "x-amz-date" && lower != "x-amz-content-sha256") {
+			check.Header[name] = values
+		}
+	}
+	signRequest(check, r.Header.Get("X-Amz-Content-Sha256"), credentials{AccessKeyID: fakeAccessKey, SecretAccessKey: fakeSecretKey}, "eu-central-1", date)
+	return check.Header.Get("Authorization") == r.Header.Get("Authorization")
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, query url.Values) {
+	prefix, delimiter := query.Get("prefix"), query.Get("delimiter")
+	limit := f.pageSize
+	if maxKeys, err := strconv.Atoi(query.Get("max-keys")); err == nil && maxKeys < limit {
+		limit = maxKeys
+	}
+	keys := make([]string, 0, len(f.objects))
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > query.Get("continuation-token") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	var result listResult
+	seen := make(map[string]bool)
+	count := 0
+	for _, key := range keys {
+		rest := strings.TrimPrefix(key, prefix)
+		i := strings.Index(rest, delimiter)
+		sub := ""
+		if delimiter != "" && i >= 0 {
+			sub = prefix + rest[:i+1]
+			if seen[sub] {
+				continue
+			}
+		}
+		if count == limit {
+			result.IsTruncated = true
+			break
+		}
+		count++
+		if sub != "" {
+			seen[sub] = true
+			result.CommonPrefixes = append(result.CommonPrefixes, struct {
+				Prefix string `xml:"Prefix"`
+			}{sub})
+			// Continue after every key below the sub-prefix.
+			result.NextContinuationToken = sub + "\xff"
+			continue
+		}
+		result.Contents = append(result.Contents, struct {
+			Key          string    `xml:"Key"`
+			Size         int64     `xml:"Size"`
+			LastModified time.Time `xml:"LastModified"`
+		}{key, int64(len(f.objects[key])), time.Date(2026, 3, 18, 12, 0, 0, 0, time.UTC)})
+		result.NextContinuationToken = key
+	}
+	data, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"ListBucketResult"`
+		listResult
+	}{listResult: result})
+	w.Write(data) //nolint:errcheck
+}
+
+func (f *fakeS3) get(w http.ResponseWriter, r *http.Request, key string) {
+	data, ok := f.objects[key]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+	spec, ok := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !ok {
+		w.Write(data) //nolint:errcheck
+		return
+	}
+	firstText, lastText, _ := strings.Cut(spec, "-")
+	first, _ := strconv.Atoi(firstText)
+	last, _ := strconv.Atoi(lastText)
+	if last >= len(data) {
+		last = len(data) - 1
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", first, last, len(data)))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(data[first : last+1]) //nolint:errcheck
+}
+
+func (f *fakeS3) complete(w http.ResponseWriter, r *http.Request, key, uploadID string, body []byte) {
+	parts, ok := f.uploads[uploadID]
+	if !ok {
+		writeFakeError(w, http.StatusNotFound, "NoSuchUpload")
+		return
+	}
+	var request struct {
+		Parts []completedPart `xml:"Part"`
+	}
+	if err := xml.Unmarshal(body, &request); err != nil {
+		writeFakeError(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+	if f.rejectExisting(w, r, key) {
+		return
+	}
+	var data []byte
+	for i, part := range request.Parts {
+		if part.PartNumber != i+1 || part.ETag != fmt.Sprintf("\"etag-%d\"", i+1) {
+			writeFakeError(w, http.StatusBadRequest, "InvalidPart")
+			return
+		}
+		data = append(data, parts[part.PartNumber]...)
+	}
+	f.objects[key] = data
+	delete(f.uploads, uploadID)
+	f.completed++
+	fmt.Fprint(w, "<CompleteMultipartUploadResult><ETag>\"done\"</ETag></CompleteMultipartUploadResult>")
+}
+
+// rejectExisting answers 412 for a conditional write of an existing object.
+func (f *fakeS3) rejectExisting(w http.ResponseWriter, r *http.Request, key string) bool {
+	if _, exists := f.objects[key]; exists && r.Header.Get("If-None-Match") == "*" {
+		writeFakeError(w, http.StatusPreconditionFailed, "PreconditionFailed")
+		return true
+	}
+	return false
+}
+
+func writeFakeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
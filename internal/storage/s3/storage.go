@@ -0,0 +1,473 @@
+package s3
+
+import (
+	"RestoreSafe/internal/util"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Storage is a util.Storage holding the objects of one bucket. Directories are key
+// prefixes ending in "/": they exist while they contain objects, and MkdirAll does
+// nothing. Files are written with multipart uploads of PartSizeMB each, so a split
+// part is uploaded while the split writer produces it without a local copy.
+type Storage struct {
+	client   *client
+	partSize int
+}
+
+// New returns the Storage of bucket using the connection settings in cfg.
+func New(bucket string, cfg util.S3Config) (*Storage, error) {
+	c, err := newClient(bucket, cfg)
+	if err != nil {
+		return nil, err
+	}
+	partSizeMB := cfg.PartSizeMB
+	if partSizeMB == 0 {
+		partSizeMB = util.DefaultS3PartSizeMB
+	}
+	return &Storage{client: c, partSize: partSizeMB * 1024 * 1024}, nil
+}
+
+// Mount makes a Storage for the bucket of backupDir, an s3://bucket/prefix URL, the
+// util.Storage of every path in that bucket. The returned function removes the mount.
+func Mount(backupDir string, cfg util.S3Config) (func(), error) {
+	bucket, _, _ := strings.Cut(strings.TrimPrefix(util.CleanStoragePath(backupDir), "s3://"), "/")
+	s, err := New(bucket, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return util.MountStorage("s3://"+bucket, s), nil
+}
+
+// key returns the object key of path, which must lie in the bucket of s.
+func (s *Storage) key(path string) (string, error) {
+	rest, ok := strings.CutPrefix(util.CleanStoragePath(path), "s3://")
+	bucket, key, _ := strings.Cut(rest, "/")
+	if !ok || bucket != s.client.bucket {
+		return "", fmt.Errorf("Path %s is not in S3 bucket %q. Remedy: Check backup_directory in config.yaml.", path, s.client.bucket)
+	}
+	return key, nil
+}
+
+// listResult is the response of ListObjectsV2.
+type listResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	CommonPrefixes []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+// list returns one page of the objects and sub-prefixes directly below prefix.
+func (s *Storage) list(prefix, token string, maxKeys int) (listResult, error) {
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}, "delimiter": {"/"}}
+	if token != "" {
+		query.Set("continuation-token", token)
+	}
+	if maxKeys > 0 {
+		query.Set("max-keys", strconv.Itoa(maxKeys))
+	}
+	var result listResult
+	err := s.client.doXML(http.MethodGet, "", query, nil, nil, "list", &result)
+	return result, err
+}
+
+func (s *Storage) List(dir string) ([]fs.DirEntry, error) {
+	key, err := s.key(dir)
+	if err != nil {
+		return nil, err
+	}
+	prefix := ""
+	if key != "" {
+		prefix = key + "/"
+	}
+	var entries []fs.DirEntry
+	token := ""
+	for {
+		page, err := s.list(prefix, token, 0)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			if name := strings.TrimPrefix(object.Key, prefix); name != "" {
+				entries = append(entries, fs.FileInfoToDirEntry(objectInfo{name: name, size: object.Size, modTime: object.LastModified}))
+			}
+		}
+		for _, sub := range page.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(sub.Prefix, prefix), "/")
+			entries = append(entries, fs.FileInfoToDirEntry(objectInfo{name: name, dir: true}))
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			break
+		}
+		token = page.NextContinuationToken
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (s *Storage) Stat(path string) (fs.FileInfo, error) {
+	key, err := s.key(path)
+	if err != nil {
+		return nil, err
+	}
+	name := key[strings.LastIndexByte(key, '/')+1:]
+	if key == "" {
+		return objectInfo{name: s.client.bucket, dir: true}, nil
+	}
+	info, err := s.head(key)
+	if err == nil {
+		return info, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	page, listErr := s.list(key+"/", "", 1)
+	if listErr != nil {
+		return nil, listErr
+	}
+	if len(page.Contents) == 0 && len(page.CommonPrefixes) == 0 {
+		return nil, err
+	}
+	return objectInfo{name: name, dir: true}, nil
+}
+
+// head returns the size and modification time of the object at key.
+func (s *Storage) head(key string) (objectInfo, error) {
+	resp, err := s.client.do(http.MethodHead, key, nil, nil, nil, "stat")
+	if err != nil {
+		return objectInfo{}, err
+	}
+	resp.Body.Close()
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return objectInfo{name: key[strings.LastIndexByte(key, '/')+1:], size: resp.ContentLength, modTime: modTime}, nil
+}
+
+func (s *Storage) Open(path string) (util.StorageFile, error) {
+	key, err := s.key(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.head(key)
+	if err != nil {
+		return nil, err
+	}
+	return &objectReader{storage: s, key: key, size: info.size}, nil
+}
+
+func (s *Storage) Create(path string) (util.StorageWriter, error) {
+	key, err := s.key(path)
+	if err != nil {
+		return nil, err
+	}
+	return &objectWriter{storage: s, key: key}, nil
+}
+
+// CreateNew fails early when the object exists and asks the service to reject the
+// upload with If-None-Match if another writer creates it in the meantime.
+func (s *Storage) CreateNew(path string) (util.StorageWriter, error) {
+	key, err := s.key(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.head(key); err == nil {
+		return nil, &fs.PathError{Op: "create", Path: path, Err: fs.ErrExist}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return &objectWriter{storage: s, key: key, exclusive: true}, nil
+}
+
+func (s *Storage) MkdirAll(string) error { return nil }
+
+// Rename copies the object on the server and deletes the original. Objects larger
+// than 5 GiB cannot be copied in one request and fail with an error from the service.
+func (s *Storage) Rename(oldPath, newPath string) error {
+	oldKey, err := s.key(oldPath)
+	if err != nil {
+		return err
+	}
+	newKey, err := s.key(newPath)
+	if err != nil {
+		return err
+	}
+	header := http.Header{"X-Amz-Copy-Source": {uriEncode("/"+s.client.bucket+"/"+oldKey, false)}}
+	if err := s.client.doXML(http.MethodPut, newKey, nil, header, nil, "rename", nil); err != nil {
+		return err
+	}
+	return s.removeKey(oldKey)
+}
+
+// Remove deletes the object at path. Directories vanish with their last object, so
+// removing one does nothing.
+func (s *Storage) Remove(path string) error {
+	key, err := s.key(path)
+	if err != nil {
+		return err
+	}
+	if key == "" {
+		return nil
+	}
+	return s.removeKey(key)
+}
+
+func (s *Storage) removeKey(key string) error {
+	resp, err := s.client.do(http.MethodDelete, key, nil, nil, nil, "remove")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// CreatesAtomically reports that an object appears only once its multipart
+// upload is completed by Close.
+func (s *Storage) CreatesAtomically() bool { return true }
+
+// FreeSpace always fails: object storage has no fixed capacity, so space checks
+// are skipped and the preflight reports the free space as unknown.
+func (s *Storage) FreeSpace(string) (uint64, error) {
+	return 0, errors.New("not reported by object storage")
+}
+
+// objectReader reads an object with ranged GET requests. Sequential reads share one
+// response body from the current offset; Seek and ReadAt start new requests.
+type objectReader struct {
+	storage *Storage
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (r *objectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.get(r.offset, r.size-1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == io.EOF && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *objectReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p))
+	if end > r.size {
+		end = r.size
+	}
+	body, err := r.get(off, end-1)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p[:end-off])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *objectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position %d", offset)
+	}
+	if offset != r.offset {
+		r.closeBody()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+func (r *objectReader) Close() error {
+	r.closeBody()
+	return nil
+}
+
+func (r *objectReader) closeBody() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
+
+// get requests the bytes first to last of the object.
+func (r *objectReader) get(first, last int64) (io.ReadCloser, error) {
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", first, last)}}
+	resp, err := r.storage.client.do(http.MethodGet, r.key, nil, header, nil, "read")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent && first > 0 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 read of %s ignored the requested range. Remedy: Check that 's3.endpoint' points to an S3-compatible service.", r.storage.client.displayPath(r.key))
+	}
+	return resp.Body, nil
+}
+
+// objectWriter uploads an object. Data is buffered up to the part size; the first
+// full part starts a multipart upload, and Close uploads the rest and completes
+// it. Objects smaller than one part are stored with a single PUT on Close.
+type objectWriter struct {
+	storage   *Storage
+	key       string
+	exclusive bool
+	buf       bytes.Buffer
+	uploadID  string
+	parts     []completedPart
+	err       error
+	closed    bool
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (w *objectWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.buf.Write(p)
+	for w.buf.Len() >= w.storage.partSize {
+		if w.err = w.uploadPart(w.buf.Next(w.storage.partSize)); w.err != nil {
+			w.abort()
+			return 0, w.err
+		}
+	}
+	return len(p), nil
+}
+
+// Sync does nothing: an object is stored only when Close completes the upload.
+func (w *objectWriter) Sync() error { return w.err }
+
+func (w *objectWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err != nil {
+		return w.err
+	}
+	header := http.Header{}
+	if w.exclusive {
+		header.Set("If-None-Match", "*")
+	}
+	if w.uploadID == "" {
+		resp, err := w.storage.client.do(http.MethodPut, w.key, nil, header, w.buf.Bytes(), "write")
+		if err != nil {
+			w.err = err
+			return err
+		}
+		return resp.Body.Close()
+	}
+	if w.buf.Len() > 0 {
+		if w.err = w.uploadPart(w.buf.Bytes()); w.err != nil {
+			w.abort()
+			return w.err
+		}
+	}
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: w.parts})
+	if err != nil {
+		w.err = err
+		return err
+	}
+	if w.err = w.storage.client.doXML(http.MethodPost, w.key, url.Values{"uploadId": {w.uploadID}}, header, body, "write", nil); w.err != nil {
+		w.abort()
+	}
+	return w.err
+}
+
+// uploadPart sends data as the next part, starting the multipart upload first if needed.
+func (w *objectWriter) uploadPart(data []byte) error {
+	client := w.storage.client
+	if w.uploadID == "" {
+		var started struct {
+			UploadID string `xml:"UploadId"`
+		}
+		if err := client.doXML(http.MethodPost, w.key, url.Values{"uploads": {""}}, nil, nil, "write", &started); err != nil {
+			return err
+		}
+		w.uploadID = started.UploadID
+	}
+	number := len(w.parts) + 1
+	query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {w.uploadID}}
+	resp, err := client.do(http.MethodPut, w.key, query, nil, data, "write")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	w.parts = append(w.parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	return nil
+}
+
+// abort cancels a started multipart upload so the service frees its parts.
+func (w *objectWriter) abort() {
+	if w.uploadID == "" {
+		return
+	}
+	if resp, err := w.storage.client.do(http.MethodDelete, w.key, url.Values{"uploadId": {w.uploadID}}, nil, nil, "write"); err == nil {
+		resp.Body.Close()
+	}
+	w.uploadID = ""
+}
+
+type objectInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i objectInfo) Name() string       { return i.name }
+func (i objectInfo) Size() int64        { return i.size }
+func (i objectInfo) ModTime() time.Time { return i.modTime }
+func (i objectInfo) IsDir() bool        { return i.dir }
+func (i objectInfo) Sys() any           { return nil }
+
+func (i objectInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o750
+	}
+	return 0o600
+}
@@ -0,0 +1,199 @@
+package s3
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func writeObject(t *testing.T, s *Storage, path string, data []byte) {
+	t.Helper()
+	w, err := s.Create(path)
+	if err != nil {
+		t.Fatalf("Create(%s) failed: %v", path, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write(%s) failed: %v", path, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close(%s) failed: %v", path, err)
+	}
+}
+
+func TestStorageUploadsLargeFilesInParts(t *testing.T) {
+	t.Parallel()
+
+	fake, s := newFakeS3(t, "backups")
+	s.partSize = 16
+	payload := bytes.Repeat([]byte("0123456789"), 5)
+	writeObject(t, s, "s3://backups/office/large.enc", payload)
+	writeObject(t, s, "s3://backups/office/small.enc", []byte("tiny"))
+
+	if fake.completed != 1 {
+		t.Fatalf("expected one multipart upload for the large file, got %d", fake.completed)
+	}
+	if !bytes.Equal(fake.objects["office/large.enc"], payload) || string(fake.objects["office/small.enc"]) != "tiny" {
+		t.Fatalf("unexpected stored objects %q", fake.objects)
+	}
+}
+
+func TestStorageReadsRanges(t *testing.T) {
+	t.Parallel()
+
+	_, s := newFakeS3(t, "backups")
+	writeObject(t, s, "s3://backups/data.bin", []byte("abcdefghijklmnopqrstuvwxyz"))
+
+	f, err := s.Open("s3://backups/data.bin")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	buf := make([]byte, 4)
+	if n, err := f.ReadAt(buf, 10); err != nil || string(buf[:n]) != "klmn" {
+		t.Fatalf("unexpected ReadAt result %q, %v", buf[:n], err)
+	}
+	if n, err := f.ReadAt(buf, 24); err != io.EOF || string(buf[:n]) != "yz" {
+		t.Fatalf("expected a short read at the end, got %q, %v", buf[:n], err)
+	}
+	if _, err := f.Seek(20, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	rest, err := io.ReadAll(f)
+	if err != nil || string(rest) != "uvwxyz" {
+		t.Fatalf("unexpected content after Seek %q, %v", rest, err)
+	}
+	if _, err := s.Open("s3://backups/missing.bin"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist for a missing object, got %v", err)
+	}
+}
+
+func TestStorageListsStatsRenamesAndRemoves(t *testing.T) {
+	t.Parallel()
+
+	fake, s := newFakeS3(t, "backups")
+	fake.pageSize = 2
+	for _, name := range []string{"a.enc", "b.enc", "c.enc", "repository/packs/00/p1", "repository/config"} {
+		writeObject(t, s, "s3://backups/office/"+name, []byte(name))
+	}
+
+	entries, err := s.List("s3://backups/office")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, ",") != "a.enc,b.enc,c.enc,repository" || !entries[3].IsDir() {
+		t.Fatalf("unexpected entries over several pages: %v", names)
+	}
+	if empty, err := s.List("s3://backups/elsewhere"); err != nil || len(empty) != 0 {
+		t.Fatalf("expected an empty listing for an unused prefix, got %v, %v", empty, err)
+	}
+
+	if info, err := s.Stat("s3://backups/office/repository"); err != nil || !info.IsDir() {
+		t.Fatalf("expected a prefix to be a directory, got %v, %v", info, err)
+	}
+	if info, err := s.Stat("s3://backups/office/a.enc"); err != nil || info.IsDir() || info.Size() != 5 {
+		t.Fatalf("unexpected file info %v, %v", info, err)
+	}
+	if _, err := s.Stat("s3://backups/office/none"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+
+	if _, err := s.CreateNew("s3://backups/office/a.enc"); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected fs.ErrExist from CreateNew, got %v", err)
+	}
+	if err := s.Rename("s3://backups/office/a.enc", "s3://backups/office/[x] a.enc"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	if _, ok := fake.objects["office/a.enc"]; ok || string(fake.objects["office/[x] a.enc"]) != "a.enc" {
+		t.Fatalf("expected the object under its new key only, got %v", fake.objects)
+	}
+	if err := s.Remove("s3://backups/office/b.enc"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, ok := fake.objects["office/b.enc"]; ok {
+		t.Fatal("expected the object to be deleted")
+	}
+	if _, err := s.FreeSpace("s3://backups/office"); err == nil {
+		t.Fatal("expected free space to be unknown")
+	}
+}
+
+func TestStorageReportsRejectedCredentials(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeS3{bucket: "backups", pageSize: 1000, objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	cfg := fakeConfig(server.URL)
+	cfg.SecretAccessKey = "wrong"
+	s, err := New("backups", cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	_, err = s.List("s3://backups")
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") || !strings.Contains(err.Error(), "Remedy: Check the S3 credentials") {
+		t.Fatalf("expected an access error with a remedy, got %v", err)
+	}
+}
+
+func TestNewRequiresCredentials(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	if _, err := New("backups", util.S3Config{Region: "us-east-1"}); err == nil || !strings.Contains(err.Error(), "No S3 credentials") {
+		t.Fatalf("expected a missing credentials error, got %v", err)
+	}
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	if _, err := New("backups", util.S3Config{Region: "us-east-1"}); err != nil {
+		t.Fatalf("expected credentials from the environment, got %v", err)
+	}
+}
+
+func TestMountedStorageHoldsBackupSet(t *testing.T) {
+	fake := &fakeS3{bucket: "mounted", pageSize: 1000, objects: make(map[string][]byte), uploads: make(map[string]map[int][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	unmount, err := Mount("s3://mounted/office", fakeConfig(server.URL))
+	if err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+	t.Cleanup(unmount)
+
+	backupDir := "s3://mounted/office"
+	password := []byte("s3-password")
+	entry := util.BackupEntry{DirectoryName: "crm.dump", Date: "2026-03-18", ID: "S3AB12"}
+	content := bytes.Repeat([]byte("row;"), 1000)
+	testutil.CreateStreamBackup(t, backupDir, entry, content, password)
+
+	index, err := catalog.ScanBackups(backupDir)
+	if err != nil || len(index) != 1 || index[0].DirectoryName != "crm.dump" {
+		t.Fatalf("expected the backup set to be listed from S3, got %+v, %v", index, err)
+	}
+	entries, ok, err := manifest.LoadForBackup(backupDir, index[0], password)
+	if err != nil || !ok || len(entries) != 1 || entries[0].Size != int64(len(content)) {
+		t.Fatalf("expected the manifest to be read from S3, got %#v, ok=%v, err=%v", entries, ok, err)
+	}
+	parts, err := catalog.CollectParts(backupDir, index[0])
+	if err != nil || len(parts) != 1 {
+		t.Fatalf("expected one part, got %v, %v", parts, err)
+	}
+	if err := util.StorageFor(parts[0]).Remove(parts[0]); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if parts, _ := catalog.CollectParts(backupDir, index[0]); len(parts) != 0 {
+		t.Fatalf("expected the part to be deleted, got %v", parts)
+	}
+}
@@ -0,0 +1,102 @@
+package sftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Extensions of OpenSSH's sftp-server used where the server offers them.
+const (
+	extPosixRename = "posix-rename@openssh.com"
+	extFsync       = "fsync@openssh.com"
+	extStatVFS     = "statvfs@openssh.com"
+)
+
+// conn is an SFTP session on an SSH connection. The client keeps up to maxInFlight
+// read or write requests of a file in flight.
+type conn struct {
+	client *ssh.Client
+	sftp   *sftp.Client
+	lost   chan struct{}
+}
+
+// newConn starts the sftp subsystem on client.
+func newConn(client *ssh.Client) (*conn, error) {
+	s, err := sftp.NewClient(client, sftp.UseConcurrentWrites(true), sftp.MaxConcurrentRequestsPerFile(maxInFlight))
+	if err != nil {
+		return nil, fmt.Errorf("SFTP subsystem could not be started: %w. Remedy: Enable the SFTP subsystem in the SSH server configuration.", err)
+	}
+	c := &conn{client: client, sftp: s, lost: make(chan struct{})}
+	go func() {
+		s.Wait() //nolint:errcheck
+		close(c.lost)
+	}()
+	return c, nil
+}
+
+// alive reports whether the connection can still send requests.
+func (c *conn) alive() bool {
+	select {
+	case <-c.lost:
+		return false
+	default:
+		return true
+	}
+}
+
+func (c *conn) close() {
+	c.sftp.Close()
+	c.client.Close()
+}
+
+// hasExtension reports whether the server offers the extension name.
+func (c *conn) hasExtension(name string) bool {
+	_, ok := c.sftp.HasExtension(name)
+	return ok
+}
+
+// remoteError turns an error of the SFTP client into the error of op on path:
+// missing files and denied access as *fs.PathError, other server replies with a
+// remedy.
+func remoteError(op, path string, err error) error {
+	switch {
+	case err == nil || err == io.EOF:
+		return err
+	case errors.Is(err, fs.ErrNotExist):
+		return &fs.PathError{Op: op, Path: path, Err: fs.ErrNotExist}
+	case errors.Is(err, fs.ErrPermission):
+		return &fs.PathError{Op: op, Path: path, Err: fs.ErrPermission}
+	case errors.Is(err, sftp.ErrSSHFxConnectionLost):
+		return fmt.Errorf("SFTP connection lost: %v. Remedy: Check the network connection to the SFTP server.", err)
+	}
+	return fmt.Errorf("SFTP %s of %s failed: %v. Remedy: Check the permissions and free space of the backup directory on the SFTP server.", op, path, err)
+}
+
+func (c *conn) stat(path string) (fs.FileInfo, error) {
+	info, err := c.sftp.Stat(path)
+	return info, remoteError("stat", path, err)
+}
+
+func (c *conn) remove(path string) error {
+	return remoteError("remove", path, c.sftp.Remove(path))
+}
+
+// rename moves oldPath to newPath. With replace, an existing newPath is replaced,
+// atomically where the server offers posix-rename; without it, the plain SFTP
+// rename fails if newPath exists.
+func (c *conn) rename(oldPath, newPath string, replace bool) error {
+	if replace && c.hasExtension(extPosixRename) {
+		return remoteError("rename", oldPath, c.sftp.PosixRename(oldPath, newPath))
+	}
+	if replace {
+		if err := c.remove(newPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return remoteError("rename", oldPath, c.sftp.Rename(oldPath, newPath))
+}
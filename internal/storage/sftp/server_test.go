@@ -0,0 +1,130 @@
+package sftp
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testServer is an in-process SSH server whose sftp subsystem serves the local
+// file system; the tests keep their files below root. It stands in for the remote
+// backup host.
+type testServer struct {
+	root           string
+	addr           string
+	keyFile        string
+	knownHostsFile string
+}
+
+// startTestServer starts a server for root that accepts one client key, and writes
+// that key and a known_hosts file with the server key to a temp directory.
+func startTestServer(t testing.TB) *testServer {
+	t.Helper()
+	dir := t.TempDir()
+	srv := &testServer{root: t.TempDir()}
+
+	_, hostKey, _ := ed25519.GenerateKey(rand.Reader)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("host key: %v", err)
+	}
+	clientPub, clientKey, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := ssh.MarshalPrivateKey(clientKey, "")
+	if err != nil {
+		t.Fatalf("client key: %v", err)
+	}
+	srv.keyFile = filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(srv.keyFile, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("failed to write client key: %v", err)
+	}
+	authorized, err := ssh.NewPublicKey(clientPub)
+	if err != nil {
+		t.Fatalf("client public key: %v", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	srv.addr = listener.Addr().String()
+	srv.knownHostsFile = filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{srv.addr}, hostSigner.PublicKey()) + "\n"
+	if err := os.WriteFile(srv.knownHostsFile, []byte(line), 0o600); err != nil {
+		t.Fatalf("failed to write known_hosts: %v", err)
+	}
+
+	go func() {
+		for {
+			nc, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serveConn(nc, config)
+		}
+	}()
+	return srv
+}
+
+func (srv *testServer) serveConn(nc net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(nc, config)
+	if err != nil {
+		nc.Close()
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "only sessions")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range channelRequests {
+				isSFTP := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(isSFTP, nil)
+				if isSFTP {
+					go srv.serveSFTP(channel)
+				}
+			}
+		}()
+	}
+}
+
+// serveSFTP answers SFTP requests on channel until the client disconnects.
+func (srv *testServer) serveSFTP(channel ssh.Channel) {
+	defer channel.Close()
+	server, err := sftp.NewServer(channel)
+	if err != nil {
+		return
+	}
+	server.Serve() //nolint:errcheck
+}
+
+// url returns the sftp:// URL of the local path root/rel on the server.
+func (srv *testServer) url(rel string) string {
+	return "sftp://backup@" + srv.addr + "/" + strings.TrimPrefix(filepath.ToSlash(filepath.Join(srv.root, rel)), "/")
+}
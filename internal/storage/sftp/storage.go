@@ -0,0 +1,428 @@
+// Package sftp stores backup directories on SSH servers, addressed as
+// sftp://user@host[:port]/path.
+package sftp
+
+import (
+	"RestoreSafe/internal/util"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// KeyPassphraseEnv holds the passphrase of an encrypted private key.
+const KeyPassphraseEnv = "RESTORESAFE_SFTP_KEY_PASSPHRASE"
+
+// maxInFlight is the number of read or write requests of a file sent before waiting
+// for the first reply, so throughput does not collapse to one packet per round trip.
+const maxInFlight = 32
+
+// Storage is a util.Storage on an SFTP server. It connects on first use and
+// reconnects after the connection is lost. Files are written under a temporary
+// name in the same directory and renamed into place once complete.
+type Storage struct {
+	root   string
+	addr   string
+	config *ssh.ClientConfig
+
+	mu   sync.Mutex
+	conn *conn
+}
+
+// New returns the Storage of the SFTP server in backupDir, an
+// sftp://user@host[:port]/path URL, authenticating with the key from cfg.
+func New(backupDir string, cfg util.SFTPConfig) (*Storage, error) {
+	u, err := url.Parse(util.CleanStoragePath(backupDir))
+	if err != nil || u.User == nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("Invalid SFTP backup directory %q. Remedy: Use the form 'sftp://user@host/path'.", backupDir)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "22"
+	}
+	signer, err := loadPrivateKey(cfg.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	hostKeys, err := loadKnownHosts(cfg.KnownHostsFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Storage{
+		root: "sftp://" + u.User.Username() + "@" + u.Host,
+		addr: net.JoinHostPort(u.Hostname(), port),
+		config: &ssh.ClientConfig{
+			User:            u.User.Username(),
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeys,
+			Timeout:         30 * time.Second,
+		},
+	}, nil
+}
+
+// Mount makes a Storage for the server of backupDir the util.Storage of every path
+// on that server. The returned function removes the mount and disconnects.
+func Mount(backupDir string, cfg util.SFTPConfig) (func(), error) {
+	s, err := New(backupDir, cfg)
+	if err != nil {
+		return nil, err
+	}
+	unmount := util.MountStorage(s.root, s)
+	return func() {
+		unmount()
+		s.Close()
+	}, nil
+}
+
+// Close disconnects from the server.
+func (s *Storage) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.close()
+		s.conn = nil
+	}
+}
+
+func loadPrivateKey(file string) (ssh.Signer, error) {
+	candidates := []string{file}
+	if file == "" {
+		home, _ := os.UserHomeDir()
+		candidates = []string{
+			filepath.Join(home, ".ssh", "id_ed25519"),
+			filepath.Join(home, ".ssh", "id_ecdsa"),
+			filepath.Join(home, ".ssh", "id_rsa"),
+		}
+	}
+	for _, candidate := range candidates {
+		data, err := os.ReadFile(candidate)
+		if errors.Is(err, fs.ErrNotExist) && file == "" {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("SSH private key could not be read: %w. Remedy: Check 'sftp.private_key_file' in config.yaml.", err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		var missing *ssh.PassphraseMissingError
+		if errors.As(err, &missing) {
+			passphrase := os.Getenv(KeyPassphraseEnv)
+			if passphrase == "" {
+				return nil, fmt.Errorf("SSH private key %s is protected by a passphrase. Remedy: Set the environment variable %s to the passphrase.", candidate, KeyPassphraseEnv)
+			}
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("SSH private key %s could not be loaded: %w. Remedy: Use an OpenSSH private key file and check %s.", candidate, err, KeyPassphraseEnv)
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("No SSH private key found in %s. Remedy: Set 'sftp.private_key_file' in config.yaml or create a key with ssh-keygen.", filepath.Dir(candidates[0]))
+}
+
+func loadKnownHosts(file string) (ssh.HostKeyCallback, error) {
+	if file == "" {
+		home, _ := os.UserHomeDir()
+		file = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(file)
+	if err != nil {
+		return nil, fmt.Errorf("SSH known_hosts file could not be read: %w. Remedy: Connect to the server once with ssh to record its host key, or set 'sftp.known_hosts_file' in config.yaml.", err)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			if len(keyErr.Want) == 0 {
+				return fmt.Errorf("Host key of %s is not in %s. Remedy: Connect to the server once with ssh and confirm its fingerprint, or add it with ssh-keyscan.", hostname, file)
+			}
+			return fmt.Errorf("Host key of %s does not match the key in %s (%s). Remedy: Verify with the server administrator whether the host key changed before updating known_hosts.", hostname, file, ssh.FingerprintSHA256(key))
+		}
+		return err
+	}, nil
+}
+
+// session returns the open connection, connecting if there is none or the last one was lost.
+func (s *Storage) session() (*conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil && s.conn.alive() {
+		return s.conn, nil
+	}
+	if s.conn != nil {
+		s.conn.close()
+		s.conn = nil
+	}
+	client, err := ssh.Dial("tcp", s.addr, s.config)
+	if err != nil {
+		return nil, fmt.Errorf("SFTP connection to %s failed: %w. Remedy: Check the host, the network connection and that the key is authorized for user %q.", s.addr, err, s.config.User)
+	}
+	c, err := newConn(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	s.conn = c
+	return c, nil
+}
+
+// remotePath returns the path on the server of p, which must lie on the server of s.
+func (s *Storage) remotePath(p string) (*conn, string, error) {
+	clean := util.CleanStoragePath(p)
+	rest, ok := strings.CutPrefix(clean, s.root)
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return nil, "", fmt.Errorf("Path %s is not on SFTP server %s. Remedy: Check backup_directory in config.yaml.", p, s.root)
+	}
+	if rest == "" {
+		rest = "/"
+	}
+	c, err := s.session()
+	return c, rest, err
+}
+
+func (s *Storage) List(dir string) ([]fs.DirEntry, error) {
+	c, remote, err := s.remotePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := c.sftp.ReadDir(remote)
+	if err != nil {
+		return nil, remoteError("list", remote, err)
+	}
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (s *Storage) Stat(p string) (fs.FileInfo, error) {
+	c, remote, err := s.remotePath(p)
+	if err != nil {
+		return nil, err
+	}
+	return c.stat(remote)
+}
+
+func (s *Storage) Open(p string) (util.StorageFile, error) {
+	c, remote, err := s.remotePath(p)
+	if err != nil {
+		return nil, err
+	}
+	f, err := c.sftp.Open(remote)
+	if err != nil {
+		return nil, remoteError("open", remote, err)
+	}
+	return &fileReader{file: f, path: remote}, nil
+}
+
+func (s *Storage) Create(p string) (util.StorageWriter, error) {
+	return s.create(p, false)
+}
+
+// CreateNew fails early when the file exists; the final rename without replace
+// also fails if another writer creates the file in the meantime.
+func (s *Storage) CreateNew(p string) (util.StorageWriter, error) {
+	return s.create(p, true)
+}
+
+func (s *Storage) create(p string, exclusive bool) (util.StorageWriter, error) {
+	c, remote, err := s.remotePath(p)
+	if err != nil {
+		return nil, err
+	}
+	if exclusive {
+		if _, err := c.stat(remote); err == nil {
+			return nil, &fs.PathError{Op: "create", Path: p, Err: fs.ErrExist}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	temp := path.Join(path.Dir(remote), "."+path.Base(remote)+"."+hex.EncodeToString(suffix)+".tmp")
+	f, err := c.sftp.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|os.O_EXCL)
+	if err != nil {
+		return nil, remoteError("open", temp, err)
+	}
+	// The parts are encrypted, so a server that keeps its default mode is no risk.
+	f.Chmod(0o600) //nolint:errcheck
+	return &fileWriter{conn: c, file: f, temp: temp, path: remote, exclusive: exclusive}, nil
+}
+
+func (s *Storage) MkdirAll(dir string) error {
+	c, remote, err := s.remotePath(dir)
+	if err != nil {
+		return err
+	}
+	return mkdirAll(c, remote)
+}
+
+func mkdirAll(c *conn, dir string) error {
+	if info, err := c.stat(dir); err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return &fs.PathError{Op: "mkdir", Path: dir, Err: fs.ErrExist}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if parent := path.Dir(dir); parent != dir {
+		if err := mkdirAll(c, parent); err != nil {
+			return err
+		}
+	}
+	if err := c.sftp.Mkdir(dir); err != nil {
+		// Another writer may have created it in the meantime.
+		if info, statErr := c.stat(dir); statErr == nil && info.IsDir() {
+			return nil
+		}
+		return remoteError("mkdir", dir, err)
+	}
+	return remoteError("mkdir", dir, c.sftp.Chmod(dir, 0o750))
+}
+
+func (s *Storage) Rename(oldPath, newPath string) error {
+	c, oldRemote, err := s.remotePath(oldPath)
+	if err != nil {
+		return err
+	}
+	_, newRemote, err := s.remotePath(newPath)
+	if err != nil {
+		return err
+	}
+	return c.rename(oldRemote, newRemote, true)
+}
+
+// Remove deletes the file at p, or the directory if p is an empty directory.
+func (s *Storage) Remove(p string) error {
+	c, remote, err := s.remotePath(p)
+	if err != nil {
+		return err
+	}
+	return c.remove(remote)
+}
+
+// CreatesAtomically reports that files are uploaded under a temporary name and
+// renamed into place by Close.
+func (s *Storage) CreatesAtomically() bool { return true }
+
+// FreeSpace asks the server with the statvfs@openssh.com extension. Servers
+// without it report the free space as unknown.
+func (s *Storage) FreeSpace(dir string) (uint64, error) {
+	c, remote, err := s.remotePath(dir)
+	if err != nil {
+		return 0, err
+	}
+	if !c.hasExtension(extStatVFS) {
+		return 0, errors.New("not reported by the SFTP server")
+	}
+	vfs, err := c.sftp.StatVFS(remote)
+	if err != nil {
+		return 0, remoteError("statvfs", remote, err)
+	}
+	fragmentSize := vfs.Frsize
+	if fragmentSize == 0 {
+		fragmentSize = vfs.Bsize
+	}
+	return fragmentSize * vfs.Bavail, nil
+}
+
+// fileReader reads a remote file; the client pipelines the READ requests.
+type fileReader struct {
+	file *sftp.File
+	path string
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	n, err := r.file.Read(p)
+	return n, remoteError("read", r.path, err)
+}
+
+func (r *fileReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.file.ReadAt(p, off)
+	return n, remoteError("read", r.path, err)
+}
+
+func (r *fileReader) Seek(offset int64, whence int) (int64, error) {
+	return r.file.Seek(offset, whence)
+}
+
+func (r *fileReader) Close() error {
+	return remoteError("close", r.path, r.file.Close())
+}
+
+// fileWriter writes a temporary remote file and renames it to its final name on
+// Close; the client pipelines the WRITE requests.
+type fileWriter struct {
+	conn      *conn
+	file      *sftp.File
+	temp      string
+	path      string
+	exclusive bool
+	err       error
+	closed    bool
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.file.Write(p)
+	if err != nil {
+		w.err = remoteError("write", w.path, err)
+	}
+	return n, w.err
+}
+
+// Sync flushes the written data to disk where the server offers fsync@openssh.com.
+func (w *fileWriter) Sync() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.conn.hasExtension(extFsync) {
+		w.err = remoteError("sync", w.path, w.file.Sync())
+	}
+	return w.err
+}
+
+func (w *fileWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	syncErr := w.Sync()
+	closeErr := remoteError("close", w.temp, w.file.Close())
+	if err := errors.Join(syncErr, closeErr); err != nil {
+		w.err = err
+		w.conn.remove(w.temp) //nolint:errcheck
+		return err
+	}
+	if err := w.conn.rename(w.temp, w.path, !w.exclusive); err != nil {
+		w.conn.remove(w.temp) //nolint:errcheck
+		if w.exclusive {
+			if _, statErr := w.conn.stat(w.path); statErr == nil {
+				err = &fs.PathError{Op: "create", Path: w.path, Err: fs.ErrExist}
+			}
+		}
+		w.err = err
+		return err
+	}
+	return nil
+}
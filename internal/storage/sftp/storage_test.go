@@ -0,0 +1,215 @@
+package sftp
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestStorage(t *testing.T, srv *testServer) *Storage {
+	t.Helper()
+	s, err := New(srv.url("backups"), util.SFTPConfig{PrivateKeyFile: srv.keyFile, KnownHostsFile: srv.knownHostsFile})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+func writeRemote(t *testing.T, s *Storage, path string, data []byte) {
+	t.Helper()
+	w, err := s.Create(path)
+	if err != nil {
+		t.Fatalf("Create(%s) failed: %v", path, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write(%s) failed: %v", path, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close(%s) failed: %v", path, err)
+	}
+}
+
+func TestStorageWritesAtomicallyAndReadsBack(t *testing.T) {
+	t.Parallel()
+
+	srv := startTestServer(t)
+	s := newTestStorage(t, srv)
+	root := srv.url("backups")
+	if err := s.MkdirAll(root + "/office"); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 20000) // 320 KB, several pipelined requests
+	writeRemote(t, s, root+"/office/part-001.enc", payload)
+	writeRemote(t, s, root+"/office/part-001.enc", payload[:1000])
+
+	local, err := os.ReadDir(filepath.Join(srv.root, "backups", "office"))
+	if err != nil || len(local) != 1 || local[0].Name() != "part-001.enc" {
+		t.Fatalf("expected only the final file on the server, got %v, %v", local, err)
+	}
+
+	writeRemote(t, s, root+"/office/part-002.enc", payload)
+	f, err := s.Open(root + "/office/part-002.enc")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	got, err := io.ReadAll(f)
+	if err != nil || !bytes.Equal(got, payload) {
+		t.Fatalf("unexpected content (%d bytes), %v", len(got), err)
+	}
+	buf := make([]byte, 6)
+	if n, err := f.ReadAt(buf, int64(len(payload))-4); err != io.EOF || string(buf[:n]) != "cdef" {
+		t.Fatalf("expected a short read at the end, got %q, %v", buf[:n], err)
+	}
+	if _, err := f.Seek(16, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	if n, err := f.Read(buf); err != nil || string(buf[:n]) != "012345"[:n] {
+		t.Fatalf("unexpected content after Seek %q, %v", buf[:n], err)
+	}
+	f.Close()
+}
+
+func TestStorageListsStatsRenamesAndRemoves(t *testing.T) {
+	t.Parallel()
+
+	srv := startTestServer(t)
+	s := newTestStorage(t, srv)
+	root := srv.url("backups")
+	if err := s.MkdirAll(root + "/repository/packs"); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	for _, name := range []string{"a.enc", "b.enc", "c.enc"} {
+		writeRemote(t, s, root+"/"+name, []byte(name))
+	}
+
+	entries, err := s.List(root)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, ",") != "a.enc,b.enc,c.enc,repository" || !entries[3].IsDir() {
+		t.Fatalf("unexpected entries %v", names)
+	}
+	if info, err := s.Stat(root + "/a.enc"); err != nil || info.IsDir() || info.Size() != 5 {
+		t.Fatalf("unexpected file info %v, %v", info, err)
+	}
+	if _, err := s.Stat(root + "/none"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+
+	if _, err := s.CreateNew(root + "/a.enc"); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected fs.ErrExist from CreateNew, got %v", err)
+	}
+	if err := s.Rename(root+"/a.enc", root+"/b.enc"); err != nil {
+		t.Fatalf("Rename over an existing file failed: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(srv.root, "backups", "b.enc")); err != nil || string(data) != "a.enc" {
+		t.Fatalf("expected the renamed content, got %q, %v", data, err)
+	}
+	if err := s.Remove(root + "/b.enc"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if err := s.Remove(root + "/repository/packs"); err != nil {
+		t.Fatalf("Remove of an empty directory failed: %v", err)
+	}
+	if err := s.Remove(root + "/b.enc"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist for a removed file, got %v", err)
+	}
+	if free, err := s.FreeSpace(root); err != nil || free == 0 {
+		t.Fatalf("unexpected free space %d, %v", free, err)
+	}
+}
+
+func TestStorageRejectsUnknownHostKey(t *testing.T) {
+	t.Parallel()
+
+	srv := startTestServer(t)
+	other := startTestServer(t)
+	s, err := New(srv.url("backups"), util.SFTPConfig{PrivateKeyFile: srv.keyFile, KnownHostsFile: other.knownHostsFile})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(s.Close)
+
+	_, err = s.List(srv.url("backups"))
+	if err == nil || !strings.Contains(err.Error(), "is not in") {
+		t.Fatalf("expected the unknown host key to be rejected, got %v", err)
+	}
+}
+
+func TestNewReportsMissingKey(t *testing.T) {
+	t.Parallel()
+
+	_, err := New("sftp://backup@127.0.0.1/backups", util.SFTPConfig{PrivateKeyFile: filepath.Join(t.TempDir(), "missing")})
+	if err == nil || !strings.Contains(err.Error(), "Remedy:") {
+		t.Fatalf("expected a missing key error with a remedy, got %v", err)
+	}
+}
+
+func TestMountedStorageHoldsBackupSet(t *testing.T) {
+	srv := startTestServer(t)
+	backupDir := srv.url("backups/office")
+	unmount, err := Mount(backupDir, util.SFTPConfig{PrivateKeyFile: srv.keyFile, KnownHostsFile: srv.knownHostsFile})
+	if err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+	t.Cleanup(unmount)
+	if err := util.StorageFor(backupDir).MkdirAll(backupDir); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+
+	password := []byte("sftp-password")
+	entry := util.BackupEntry{DirectoryName: "crm.dump", Date: "2026-03-18", ID: "SF12AB"}
+	content := bytes.Repeat([]byte("row;"), 1000)
+	testutil.CreateStreamBackup(t, backupDir, entry, content, password)
+
+	index, err := catalog.ScanBackups(backupDir)
+	if err != nil || len(index) != 1 || index[0].DirectoryName != "crm.dump" {
+		t.Fatalf("expected the backup set to be listed over SFTP, got %+v, %v", index, err)
+	}
+	entries, ok, err := manifest.LoadForBackup(backupDir, index[0], password)
+	if err != nil || !ok || len(entries) != 1 || entries[0].Size != int64(len(content)) {
+		t.Fatalf("expected the manifest to be read over SFTP, got %#v, ok=%v, err=%v", entries, ok, err)
+	}
+	parts, err := catalog.CollectParts(backupDir, index[0])
+	if err != nil || len(parts) != 1 {
+		t.Fatalf("expected one part, got %v, %v", parts, err)
+	}
+	if _, err := os.Stat(filepath.Join(srv.root, "backups", "office", filepath.Base(filepath.FromSlash(util.CleanStoragePath(parts[0]))))); err != nil {
+		t.Fatalf("expected the part on the server: %v", err)
+	}
+}
+
+func TestStorageReconnectsAfterLostConnection(t *testing.T) {
+	t.Parallel()
+
+	srv := startTestServer(t)
+	s := newTestStorage(t, srv)
+	root := srv.url("backups")
+	if err := s.MkdirAll(root); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	lost := s.conn
+	lost.client.Close()
+	<-lost.lost
+
+	if _, err := s.List(root); err != nil {
+		t.Fatalf("expected List to reconnect, got %v", err)
+	}
+	if s.conn == lost {
+		t.Fatal("expected a new connection")
+	}
+}
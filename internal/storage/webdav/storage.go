@@ -0,0 +1,588 @@
+// Package webdav stores backup directories on WebDAV servers such as Nextcloud,
+// addressed as davs://host/path (HTTPS) or dav://host/path (HTTP).
+package webdav
+
+import (
+	"RestoreSafe/internal/util"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables used when the webdav section of config.yaml has no credentials.
+const (
+	UsernameEnv = "RESTORESAFE_WEBDAV_USERNAME"
+	PasswordEnv = "RESTORESAFE_WEBDAV_PASSWORD"
+)
+
+// Storage is a util.Storage on a WebDAV server. Files are uploaded with a streamed
+// PUT under a temporary name and moved into place with MOVE once complete.
+type Storage struct {
+	root       string
+	base       url.URL
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// New returns the Storage of the WebDAV server in backupDir using the credentials
+// from cfg or the environment.
+func New(backupDir string, cfg util.WebDAVConfig) (*Storage, error) {
+	clean := util.CleanStoragePath(backupDir)
+	u, err := url.Parse(clean)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("Invalid WebDAV backup directory %q. Remedy: Use the form 'davs://host/path'.", backupDir)
+	}
+	s := &Storage{
+		root:       u.Scheme + "://" + u.Host,
+		base:       url.URL{Scheme: "https", Host: u.Host},
+		username:   cfg.Username,
+		password:   cfg.Password,
+		httpClient: &http.Client{},
+	}
+	if u.Scheme == "dav" {
+		s.base.Scheme = "http"
+	}
+	if s.username == "" {
+		s.username = os.Getenv(UsernameEnv)
+	}
+	if s.password == "" {
+		s.password = os.Getenv(PasswordEnv)
+	}
+	return s, nil
+}
+
+// Mount makes a Storage for the server of backupDir the util.Storage of every path
+// on that server. The returned function removes the mount.
+func Mount(backupDir string, cfg util.WebDAVConfig) (func(), error) {
+	s, err := New(backupDir, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return util.MountStorage(s.root, s), nil
+}
+
+// remotePath returns the path on the server of p, which must lie on the server of s.
+func (s *Storage) remotePath(p string) (string, error) {
+	rest, ok := strings.CutPrefix(util.CleanStoragePath(p), s.root)
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return "", fmt.Errorf("Path %s is not on WebDAV server %s. Remedy: Check backup_directory in config.yaml.", p, s.root)
+	}
+	if rest == "" {
+		rest = "/"
+	}
+	return rest, nil
+}
+
+func (s *Storage) url(remote string) string {
+	u := s.base
+	u.Path = remote
+	return u.String()
+}
+
+// do sends a request for remote. A response with a status outside 2xx is closed
+// and returned as an error naming op and remote.
+func (s *Storage) do(method, remote string, header http.Header, body io.Reader, op string) (*http.Response, error) {
+	req, err := http.NewRequest(method, s.url(remote), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if s.username != "" || s.password != "" {
+		req.SetBasicAuth(s.username, s.password)
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("WebDAV %s of %s failed: %w. Remedy: Check the server address in backup_directory and the network connection.", op, remote, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, s.statusError(resp.StatusCode, op, remote)
+	}
+	return resp, nil
+}
+
+// statusError maps a failed WebDAV status to the fs errors callers check for.
+func (s *Storage) statusError(code int, op, remote string) error {
+	switch code {
+	case http.StatusNotFound:
+		return &fs.PathError{Op: op, Path: remote, Err: fs.ErrNotExist}
+	case http.StatusPreconditionFailed:
+		return &fs.PathError{Op: op, Path: remote, Err: fs.ErrExist}
+	}
+	remedy := "Check the server address and path in backup_directory."
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		remedy = fmt.Sprintf("Check 'webdav.username' and 'webdav.password' in config.yaml or %s and %s; for Nextcloud, use an app password.", UsernameEnv, PasswordEnv)
+	case http.StatusInsufficientStorage:
+		remedy = "Free space or raise the quota of the WebDAV account."
+	case http.StatusConflict:
+		remedy = "Check that the parent folder exists on the server."
+	}
+	return fmt.Errorf("WebDAV %s of %s failed with status %d %s. Remedy: %s", op, remote, code, http.StatusText(code), remedy)
+}
+
+// multistatus is the response of PROPFIND.
+type multistatus struct {
+	Responses []struct {
+		Href      string `xml:"DAV: href"`
+		Propstats []struct {
+			Status string `xml:"DAV: status"`
+			Prop   struct {
+				ContentLength  string    `xml:"DAV: getcontentlength"`
+				LastModified   string    `xml:"DAV: getlastmodified"`
+				Collection     *struct{} `xml:"DAV: resourcetype>collection"`
+				QuotaAvailable string    `xml:"DAV: quota-available-bytes"`
+			} `xml:"DAV: prop"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>` +
+	`<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/><d:getlastmodified/><d:quota-available-bytes/></d:prop></d:propfind>`
+
+// propEntry is a file or collection reported by PROPFIND.
+type propEntry struct {
+	path  string
+	info  entryInfo
+	quota string
+}
+
+// propfind returns remote itself with depth "0", and also its children with depth "1".
+func (s *Storage) propfind(remote, depth, op string) ([]propEntry, error) {
+	header := http.Header{"Depth": {depth}, "Content-Type": {"application/xml; charset=utf-8"}}
+	resp, err := s.do("PROPFIND", remote, header, strings.NewReader(propfindBody), op)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var result multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("WebDAV %s of %s returned an unreadable response: %w. Remedy: Check that backup_directory points to a WebDAV folder.", op, remote, err)
+	}
+	entries := make([]propEntry, 0, len(result.Responses))
+	for _, r := range result.Responses {
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		entry := propEntry{path: strings.TrimSuffix(href.Path, "/")}
+		entry.info.name = path.Base(entry.path)
+		for _, ps := range r.Propstats {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			entry.info.dir = entry.info.dir || ps.Prop.Collection != nil
+			if size, err := strconv.ParseInt(ps.Prop.ContentLength, 10, 64); err == nil {
+				entry.info.size = size
+			}
+			if modTime, err := http.ParseTime(ps.Prop.LastModified); err == nil {
+				entry.info.modTime = modTime
+			}
+			entry.quota = ps.Prop.QuotaAvailable
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (s *Storage) List(dir string) ([]fs.DirEntry, error) {
+	remote, err := s.remotePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	found, err := s.propfind(remote, "1", "list")
+	if err != nil {
+		return nil, err
+	}
+	self := strings.TrimSuffix(remote, "/")
+	var entries []fs.DirEntry
+	for _, entry := range found {
+		if entry.path != self {
+			entries = append(entries, fs.FileInfoToDirEntry(entry.info))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (s *Storage) Stat(p string) (fs.FileInfo, error) {
+	remote, err := s.remotePath(p)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.stat(remote)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *Storage) stat(remote string) (entryInfo, error) {
+	found, err := s.propfind(remote, "0", "stat")
+	if err != nil {
+		return entryInfo{}, err
+	}
+	if len(found) == 0 {
+		return entryInfo{}, &fs.PathError{Op: "stat", Path: remote, Err: fs.ErrNotExist}
+	}
+	info := found[0].info
+	info.name = path.Base(remote)
+	return info, nil
+}
+
+func (s *Storage) Open(p string) (util.StorageFile, error) {
+	remote, err := s.remotePath(p)
+	if err != nil {
+		return nil, err
+	}
+	info, err := s.stat(remote)
+	if err != nil {
+		return nil, err
+	}
+	if info.dir {
+		return nil, &fs.PathError{Op: "open", Path: remote, Err: fs.ErrInvalid}
+	}
+	return &fileReader{storage: s, remote: remote, size: info.size}, nil
+}
+
+func (s *Storage) Create(p string) (util.StorageWriter, error) {
+	return s.create(p, false)
+}
+
+// CreateNew fails early when the file exists; the final MOVE with Overwrite: F
+// also fails if another writer creates the file in the meantime.
+func (s *Storage) CreateNew(p string) (util.StorageWriter, error) {
+	return s.create(p, true)
+}
+
+func (s *Storage) create(p string, exclusive bool) (util.StorageWriter, error) {
+	remote, err := s.remotePath(p)
+	if err != nil {
+		return nil, err
+	}
+	if exclusive {
+		if _, err := s.stat(remote); err == nil {
+			return nil, &fs.PathError{Op: "create", Path: p, Err: fs.ErrExist}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	temp := path.Join(path.Dir(remote), "."+path.Base(remote)+"."+hex.EncodeToString(suffix)+".tmp")
+
+	// The body is streamed with chunked transfer encoding while the caller writes.
+	pr, pw := io.Pipe()
+	w := &uploadWriter{storage: s, temp: temp, remote: remote, exclusive: exclusive, pipe: pw, done: make(chan error, 1)}
+	go func() {
+		resp, err := s.do(http.MethodPut, temp, nil, pr, "write")
+		if err == nil {
+			resp.Body.Close()
+		}
+		pr.CloseWithError(errors.Join(err, io.ErrClosedPipe))
+		w.done <- err
+	}()
+	return w, nil
+}
+
+func (s *Storage) MkdirAll(dir string) error {
+	remote, err := s.remotePath(dir)
+	if err != nil {
+		return err
+	}
+	return s.mkdirAll(remote)
+}
+
+func (s *Storage) mkdirAll(remote string) error {
+	if info, err := s.stat(remote); err == nil {
+		if info.dir {
+			return nil
+		}
+		return &fs.PathError{Op: "mkdir", Path: remote, Err: fs.ErrExist}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if parent := path.Dir(remote); parent != remote {
+		if err := s.mkdirAll(parent); err != nil {
+			return err
+		}
+	}
+	resp, err := s.do("MKCOL", remote+"/", nil, nil, "mkdir")
+	if err != nil {
+		// Another writer may have created it in the meantime.
+		if info, statErr := s.stat(remote); statErr == nil && info.dir {
+			return nil
+		}
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *Storage) Rename(oldPath, newPath string) error {
+	oldRemote, err := s.remotePath(oldPath)
+	if err != nil {
+		return err
+	}
+	newRemote, err := s.remotePath(newPath)
+	if err != nil {
+		return err
+	}
+	return s.move(oldRemote, newRemote, true)
+}
+
+func (s *Storage) move(oldRemote, newRemote string, overwrite bool) error {
+	header := http.Header{"Destination": {s.url(newRemote)}, "Overwrite": {"F"}}
+	if overwrite {
+		header.Set("Overwrite", "T")
+	}
+	resp, err := s.do("MOVE", oldRemote, header, nil, "rename")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Remove deletes the file at p, or the directory if p is an empty directory.
+// WebDAV deletes collections with their content, so a directory is checked first.
+func (s *Storage) Remove(p string) error {
+	remote, err := s.remotePath(p)
+	if err != nil {
+		return err
+	}
+	info, err := s.stat(remote)
+	if err != nil {
+		return err
+	}
+	target := remote
+	if info.dir {
+		children, err := s.propfind(remote, "1", "remove")
+		if err != nil {
+			return err
+		}
+		if len(children) > 1 {
+			return &fs.PathError{Op: "remove", Path: remote, Err: errors.New("directory not empty")}
+		}
+		target += "/"
+	}
+	resp, err := s.do(http.MethodDelete, target, nil, nil, "remove")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// CreatesAtomically reports that files are uploaded under a temporary name and
+// moved into place by Close.
+func (s *Storage) CreatesAtomically() bool { return true }
+
+// FreeSpace reads the quota-available-bytes property (RFC 4331). Servers without
+// it, or with an unlimited quota, report the free space as unknown.
+func (s *Storage) FreeSpace(dir string) (uint64, error) {
+	remote, err := s.remotePath(dir)
+	if err != nil {
+		return 0, err
+	}
+	found, err := s.propfind(remote, "0", "stat")
+	if err != nil {
+		return 0, err
+	}
+	if len(found) > 0 {
+		if available, err := strconv.ParseInt(found[0].quota, 10, 64); err == nil && available >= 0 {
+			return uint64(available), nil
+		}
+	}
+	return 0, errors.New("not reported by the WebDAV server")
+}
+
+// fileReader reads a remote file with ranged GET requests. Sequential reads share
+// one response body from the current offset; Seek and ReadAt start new requests.
+type fileReader struct {
+	storage *Storage
+	remote  string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (r *fileReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.get(r.offset, r.size-1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	if err == io.EOF && r.offset < r.size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (r *fileReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), r.size)
+	body, err := r.get(off, end-1)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p[:end-off])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *fileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("negative position %d", offset)
+	}
+	if offset != r.offset {
+		r.closeBody()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+func (r *fileReader) Close() error {
+	r.closeBody()
+	return nil
+}
+
+func (r *fileReader) closeBody() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
+
+// get requests the bytes first to last of the file.
+func (r *fileReader) get(first, last int64) (io.ReadCloser, error) {
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", first, last)}}
+	resp, err := r.storage.do(http.MethodGet, r.remote, header, nil, "read")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent && first > 0 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("WebDAV read of %s ignored the requested range. Remedy: Use a WebDAV server that supports HTTP range requests.", r.remote)
+	}
+	return resp.Body, nil
+}
+
+// uploadWriter streams a PUT of the temporary file and moves it to its final name on Close.
+type uploadWriter struct {
+	storage   *Storage
+	temp      string
+	remote    string
+	exclusive bool
+	pipe      *io.PipeWriter
+	done      chan error
+	err       error
+	closed    bool
+}
+
+func (w *uploadWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.pipe.Write(p)
+	if err != nil {
+		// The upload ended early; its own error explains why.
+		w.err = w.finish()
+		if w.err == nil {
+			w.err = err
+		}
+	}
+	return n, w.err
+}
+
+// Sync does nothing: a file is stored only when Close completes the upload.
+func (w *uploadWriter) Sync() error { return w.err }
+
+func (w *uploadWriter) Close() error {
+	if w.closed {
+		return w.err
+	}
+	w.closed = true
+	if w.err == nil {
+		w.pipe.Close()
+		w.err = w.finish()
+	}
+	if w.err == nil {
+		w.err = w.storage.move(w.temp, w.remote, !w.exclusive)
+	}
+	if w.err != nil {
+		if resp, err := w.storage.do(http.MethodDelete, w.temp, nil, nil, "remove"); err == nil {
+			resp.Body.Close()
+		}
+	}
+	return w.err
+}
+
+// finish waits for the upload request to end and returns its error.
+func (w *uploadWriter) finish() error {
+	if w.done == nil {
+		return nil
+	}
+	err := <-w.done
+	w.done = nil
+	return err
+}
+
+// entryInfo is the fs.FileInfo of a remote file or collection.
+type entryInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i entryInfo) Name() string       { return i.name }
+func (i entryInfo) Size() int64        { return i.size }
+func (i entryInfo) ModTime() time.Time { return i.modTime }
+func (i entryInfo) IsDir() bool        { return i.dir }
+func (i entryInfo) Sys() any           { return nil }
+
+func (i entryInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o750
+	}
+	return 0o600
+}
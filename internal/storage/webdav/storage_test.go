@@ -0,0 +1,219 @@
+package webdav
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/testutil"
+	"RestoreSafe/internal/util"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+// startTestServer serves a temp directory over WebDAV with basic authentication
+// and returns the directory and the davs-style root URL of the server.
+func startTestServer(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	handler := &webdav.Handler{FileSystem: webdav.Dir(dir), LockSystem: webdav.NewMemLS()}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "backup" || password != "app-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return dir, "dav://" + strings.TrimPrefix(srv.URL, "http://")
+}
+
+func newTestStorage(t *testing.T, root string) *Storage {
+	t.Helper()
+	s, err := New(root+"/backups", util.WebDAVConfig{Username: "backup", Password: "app-password"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return s
+}
+
+func writeRemote(t *testing.T, s *Storage, path string, data []byte) {
+	t.Helper()
+	w, err := s.Create(path)
+	if err != nil {
+		t.Fatalf("Create(%s) failed: %v", path, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("Write(%s) failed: %v", path, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close(%s) failed: %v", path, err)
+	}
+}
+
+func TestStorageWritesAtomicallyAndReadsBack(t *testing.T) {
+	t.Parallel()
+
+	dir, root := startTestServer(t)
+	s := newTestStorage(t, root)
+	if err := s.MkdirAll(root + "/backups/office"); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	payload := bytes.Repeat([]byte("0123456789abcdef"), 20000)
+	writeRemote(t, s, root+"/backups/office/part-001.enc", payload)
+	writeRemote(t, s, root+"/backups/office/part-001.enc", payload[:1000])
+
+	local, err := os.ReadDir(filepath.Join(dir, "backups", "office"))
+	if err != nil || len(local) != 1 || local[0].Name() != "part-001.enc" {
+		t.Fatalf("expected only the final file on the server, got %v, %v", local, err)
+	}
+
+	writeRemote(t, s, root+"/backups/office/part-002.enc", payload)
+	f, err := s.Open(root + "/backups/office/part-002.enc")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	got, err := io.ReadAll(f)
+	if err != nil || !bytes.Equal(got, payload) {
+		t.Fatalf("unexpected content (%d bytes), %v", len(got), err)
+	}
+	buf := make([]byte, 6)
+	if n, err := f.ReadAt(buf, int64(len(payload))-4); err != io.EOF || string(buf[:n]) != "cdef" {
+		t.Fatalf("expected a short read at the end, got %q, %v", buf[:n], err)
+	}
+	if _, err := f.Seek(16, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	if n, err := f.Read(buf); err != nil || string(buf[:n]) != "012345" {
+		t.Fatalf("unexpected content after Seek %q, %v", buf[:n], err)
+	}
+}
+
+func TestStorageListsStatsRenamesAndRemoves(t *testing.T) {
+	t.Parallel()
+
+	dir, root := startTestServer(t)
+	s := newTestStorage(t, root)
+	base := root + "/backups"
+	if err := s.MkdirAll(base + "/repository/packs"); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	for _, name := range []string{"a.enc", "b.enc", "c.enc"} {
+		writeRemote(t, s, base+"/"+name, []byte(name))
+	}
+
+	entries, err := s.List(base)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if strings.Join(names, ",") != "a.enc,b.enc,c.enc,repository" || !entries[3].IsDir() {
+		t.Fatalf("unexpected entries %v", names)
+	}
+	if info, err := s.Stat(base + "/a.enc"); err != nil || info.IsDir() || info.Size() != 5 {
+		t.Fatalf("unexpected file info %v, %v", info, err)
+	}
+	if _, err := s.Stat(base + "/none"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+
+	if _, err := s.CreateNew(base + "/a.enc"); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected fs.ErrExist from CreateNew, got %v", err)
+	}
+	if err := s.Rename(base+"/a.enc", base+"/b.enc"); err != nil {
+		t.Fatalf("Rename over an existing file failed: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "backups", "b.enc")); err != nil || string(data) != "a.enc" {
+		t.Fatalf("expected the renamed content, got %q, %v", data, err)
+	}
+	if err := s.Remove(base + "/repository"); err == nil {
+		t.Fatal("expected Remove of a non-empty directory to fail")
+	}
+	if err := s.Remove(base + "/repository/packs"); err != nil {
+		t.Fatalf("Remove of an empty directory failed: %v", err)
+	}
+	if err := s.Remove(base + "/b.enc"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if err := s.Remove(base + "/b.enc"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist for a removed file, got %v", err)
+	}
+	// The x/net server does not report a quota.
+	if _, err := s.FreeSpace(base); err == nil {
+		t.Fatal("expected the free space to be unknown")
+	}
+}
+
+func TestStorageReportsRejectedCredentials(t *testing.T) {
+	t.Parallel()
+
+	_, root := startTestServer(t)
+	s, err := New(root+"/backups", util.WebDAVConfig{Username: "backup", Password: "wrong"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	_, err = s.List(root + "/backups")
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "Remedy:") {
+		t.Fatalf("expected a credentials error with a remedy, got %v", err)
+	}
+}
+
+func TestNewUsesEnvironmentCredentials(t *testing.T) {
+	t.Setenv(UsernameEnv, "backup")
+	t.Setenv(PasswordEnv, "app-password")
+
+	_, root := startTestServer(t)
+	s, err := New(root+"/backups", util.WebDAVConfig{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := s.MkdirAll(root + "/backups"); err != nil {
+		t.Fatalf("expected the environment credentials to be used, got %v", err)
+	}
+}
+
+func TestMountedStorageHoldsBackupSet(t *testing.T) {
+	dir, root := startTestServer(t)
+	backupDir := root + "/backups/office"
+	unmount, err := Mount(backupDir, util.WebDAVConfig{Username: "backup", Password: "app-password"})
+	if err != nil {
+		t.Fatalf("Mount failed: %v", err)
+	}
+	t.Cleanup(unmount)
+	if err := util.StorageFor(backupDir).MkdirAll(backupDir); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+
+	password := []byte("webdav-password")
+	entry := util.BackupEntry{DirectoryName: "crm.dump", Date: "2026-03-18", ID: "WD12AB"}
+	content := bytes.Repeat([]byte("row;"), 1000)
+	testutil.CreateStreamBackup(t, backupDir, entry, content, password)
+
+	index, err := catalog.ScanBackups(backupDir)
+	if err != nil || len(index) != 1 || index[0].DirectoryName != "crm.dump" {
+		t.Fatalf("expected the backup set to be listed over WebDAV, got %+v, %v", index, err)
+	}
+	entries, ok, err := manifest.LoadForBackup(backupDir, index[0], password)
+	if err != nil || !ok || len(entries) != 1 || entries[0].Size != int64(len(content)) {
+		t.Fatalf("expected the manifest to be read over WebDAV, got %#v, ok=%v, err=%v", entries, ok, err)
+	}
+	parts, err := catalog.CollectParts(backupDir, index[0])
+	if err != nil || len(parts) != 1 {
+		t.Fatalf("expected one part, got %v, %v", parts, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "backups", "office", filepath.Base(filepath.FromSlash(util.CleanStoragePath(parts[0]))))); err != nil {
+		t.Fatalf("expected the part on the server: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package testutil
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"bufio"
+	"io"
+	"os"
+	"testing"
+)
+
+// CreateChainBackup writes an encrypted backup of srcDir with a manifest. With a
+// parent, files whose size is unchanged are left out of the archive and recorded
+// as stored in the parent, as an incremental backup run does. A single file as
+// srcDir is archived like a single-file backup source.
+func CreateChainBackup(t testing.TB, srcDir, backupDir string, entry util.BackupEntry, parent *util.BackupEntry, password []byte) int {
+	t.Helper()
+
+	header := manifest.Header{Backup: entry.String()}
+	var parentIndex manifest.Index
+	if parent != nil {
+		header.Parent = parent.String()
+		entries, ok, err := manifest.LoadForBackup(backupDir, *parent, password)
+		if err != nil || !ok {
+			t.Fatalf("failed to load parent manifest: ok=%v err=%v", ok, err)
+		}
+		parentIndex = manifest.NewIndex(entries)
+	}
+
+	mw, err := manifest.Create(util.ManifestFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID), header, password, security.DefaultArgon2Params)
+	if err != nil {
+		t.Fatalf("manifest.Create failed: %v", err)
+	}
+	seen := make(map[string]bool)
+	opts := util.TarWriteOptions{
+		OnEntry: func(e util.TarEntry) error {
+			me := manifest.EntryFromTar(e)
+			seen[me.Path] = true
+			if e.Skipped {
+				prev := parentIndex[me.Path]
+				me.SHA256, me.HeaderOffset, me.DataOffset, me.Stored = prev.SHA256, prev.HeaderOffset, prev.DataOffset, prev.Stored
+				if me.Stored == "" {
+					me.Stored = parent.String()
+				}
+			}
+			return mw.Add(me)
+		},
+	}
+	runInfo := catalog.RunInfo{Type: catalog.BackupTypeFull}
+	if util.IsRegularFile(srcDir) {
+		opts.FileName = entry.DirectoryName
+		runInfo.Source = catalog.SourceTypeFile
+	}
+	if parent != nil {
+		runInfo.Type, runInfo.Parent = catalog.BackupTypeIncremental, catalog.NewIncrementalRunInfo(*parent).Parent
+		opts.SkipContent = func(_, name string, info os.FileInfo) (bool, error) {
+			prev, ok := parentIndex[name]
+			return ok && prev.Type == "file" && prev.Size == info.Size(), nil
+		}
+	}
+
+	sw := util.NewWriter(func(seq int) string {
+		return util.PartFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID, seq)
+	}, 1024*1024)
+	bw := bufio.NewWriterSize(sw, util.SplitWriteBufferSize)
+	pr, pw := io.Pipe()
+	tarErrCh := make(chan error, 1)
+	go func() {
+		err := util.WriteTarWithOptions(pw, srcDir, opts, backupDir)
+		pw.CloseWithError(err) //nolint:errcheck
+		tarErrCh <- err
+	}()
+	encryptErr := security.Encrypt(bw, pr, password, security.DefaultArgon2Params)
+	pr.Close() //nolint:errcheck
+	if encryptErr != nil {
+		t.Fatalf("security.Encrypt failed: %v", encryptErr)
+	}
+	if err := bw.Flush(); err != nil {
+		t.Fatalf("failed to flush split buffer: %v", err)
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatalf("failed to close split writer: %v", err)
+	}
+	if err := <-tarErrCh; err != nil {
+		t.Fatalf("WriteTarWithOptions failed: %v", err)
+	}
+
+	for path := range parentIndex {
+		if !seen[path] {
+			if err := mw.Add(manifest.Entry{Path: path, Type: manifest.TypeDeleted}); err != nil {
+				t.Fatalf("failed to add deletion marker: %v", err)
+			}
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("failed to close manifest: %v", err)
+	}
+	if runInfo.IsIncremental() || runInfo.IsFile() {
+		if err := catalog.WriteRunInfo(backupDir, entry, runInfo); err != nil {
+			t.Fatalf("WriteRunInfo failed: %v", err)
+		}
+	}
+	return len(sw.Paths())
+}
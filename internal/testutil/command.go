@@ -0,0 +1,54 @@
+package testutil
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"testing"
+)
+
+const helperCommandEnv = "RESTORESAFE_HELPER_COMMAND"
+
+// HelperCommand returns a command line that runs the current test binary as a
+// stand-in for an external program. The test package must call RunHelperCommand
+// from a test named TestHelperCommand. The helper copies its standard input to
+// stdinFile (if not empty), prints stdout and stderr and exits with exitCode.
+func HelperCommand(t *testing.T, stdout, stderr string, exitCode int, stdinFile string) (string, []string) {
+	t.Helper()
+	t.Setenv(helperCommandEnv, "1")
+	return os.Args[0], []string{"-test.run=^TestHelperCommand$", "--", stdout, stderr, strconv.Itoa(exitCode), stdinFile}
+}
+
+// RunHelperCommand acts as the program started by HelperCommand and exits. In a
+// regular test run it returns immediately.
+func RunHelperCommand() {
+	if os.Getenv(helperCommandEnv) != "1" {
+		return
+	}
+	args := os.Args
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	if len(args) != 4 {
+		fmt.Fprintf(os.Stderr, "helper command: unexpected arguments %q\n", args)
+		os.Exit(2)
+	}
+	if args[3] != "" {
+		data, err := io.ReadAll(os.Stdin)
+		if err == nil {
+			err = os.WriteFile(args[3], data, 0o600)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "helper command: %v\n", err)
+			os.Exit(2)
+		}
+	}
+	fmt.Fprint(os.Stdout, args[0])
+	fmt.Fprint(os.Stderr, args[1])
+	exitCode, _ := strconv.Atoi(args[2])
+	os.Exit(exitCode)
+}
@@ -0,0 +1,25 @@
+package testutil
+
+import (
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/repository"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"testing"
+)
+
+// CreateSnapshotBackup stores srcDir in the chunked repository of backupDir, creating
+// the repository if needed, and writes the snapshot of entry.
+func CreateSnapshotBackup(t testing.TB, srcDir, backupDir string, entry util.BackupEntry, password []byte) {
+	t.Helper()
+
+	repo, err := repository.OpenOrCreate(backupDir, password, security.DefaultArgon2Params, 1024*1024)
+	if err != nil {
+		t.Fatalf("repository.OpenOrCreate failed: %v", err)
+	}
+	defer repo.Close()
+	path := util.SnapshotFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID)
+	if err := repo.SnapshotDirectory(srcDir, entry.DirectoryName, path, manifest.Header{Backup: entry.String()}, password, security.DefaultArgon2Params); err != nil {
+		t.Fatalf("SnapshotDirectory failed: %v", err)
+	}
+}
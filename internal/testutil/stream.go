@@ -0,0 +1,58 @@
+package testutil
+
+import (
+	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/security"
+	"RestoreSafe/internal/util"
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+// CreateStreamBackup writes an encrypted backup of content as the output of a command
+// source: the raw stream split into parts, a manifest listing it as one file named
+// after the backup, and run metadata marking the stream.
+func CreateStreamBackup(t testing.TB, backupDir string, entry util.BackupEntry, content []byte, password []byte) int {
+	t.Helper()
+
+	sw := util.NewWriter(func(seq int) string {
+		return util.PartFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID, seq)
+	}, 1024*1024)
+	bw := bufio.NewWriterSize(sw, util.SplitWriteBufferSize)
+	if err := security.Encrypt(bw, bytes.NewReader(content), password, security.DefaultArgon2Params); err != nil {
+		t.Fatalf("security.Encrypt failed: %v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		t.Fatalf("failed to flush split buffer: %v", err)
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatalf("failed to close split writer: %v", err)
+	}
+
+	mw, err := manifest.Create(util.ManifestFileName(backupDir, entry.DirectoryName, entry.Date, entry.ID), manifest.Header{Backup: entry.String()}, password, security.DefaultArgon2Params)
+	if err != nil {
+		t.Fatalf("manifest.Create failed: %v", err)
+	}
+	sum := sha256.Sum256(content)
+	if err := mw.Add(manifest.Entry{
+		Path:    entry.DirectoryName,
+		Type:    "file",
+		Size:    int64(len(content)),
+		ModTime: time.Date(2026, 3, 18, 12, 0, 0, 0, time.UTC),
+		Mode:    0o640,
+		SHA256:  hex.EncodeToString(sum[:]),
+	}); err != nil {
+		t.Fatalf("failed to add manifest entry: %v", err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("failed to close manifest: %v", err)
+	}
+	if err := catalog.WriteRunInfo(backupDir, entry, catalog.RunInfo{Type: catalog.BackupTypeFull, Source: catalog.SourceTypeCommand}); err != nil {
+		t.Fatalf("WriteRunInfo failed: %v", err)
+	}
+	return len(sw.Paths())
+}
@@ -2,8 +2,11 @@ package util
 
 import (
 	"archive/tar"
+	"bytes"
+	"crypto/sha256"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path"
@@ -11,11 +14,52 @@ import (
 	"strings"
 )
 
+// TarEntry describes one entry written by WriteTarIndexed.
+type TarEntry struct {
+	Header       *tar.Header
+	HeaderOffset int64  // position of the entry's first header block in the TAR stream
+	DataOffset   int64  // position of the entry's content in the TAR stream
+	SHA256       []byte // content hash of regular files; nil for other entry types
+	// Skipped is set for regular files left out of the archive by TarWriteOptions.SkipContent.
+	// Header describes the file; offsets and SHA256 are not set.
+	Skipped bool
+}
+
+// TarWriteOptions controls WriteTarWithOptions.
+type TarWriteOptions struct {
+	// OnEntry, when set, receives every entry once it has been written completely,
+	// including its stream offsets and, for regular files, the SHA-256 of the content.
+	OnEntry func(TarEntry) error
+	// SkipContent, when set, is asked for every regular file before it is written.
+	// Returning true leaves the file out of the archive; it is still reported to
+	// OnEntry with Skipped set. name is the path inside the archive.
+	SkipContent func(path, name string, info os.FileInfo) (bool, error)
+	// FileName names the only entry of the archive when srcDir is a single file.
+	// It defaults to the base name of the file.
+	FileName string
+}
+
 // WriteTar walks srcDir and writes all files as a TAR stream to w.
-// File paths inside the archive are relative to srcDir.
+// File paths inside the archive are relative to srcDir. When srcDir is a single
+// file, the archive holds just that file.
 // Any provided exclude directories are skipped.
 func WriteTar(w io.Writer, srcDir string, excludeDirs ...string) error {
-	tw := tar.NewWriter(w)
+	return WriteTarWithOptions(w, srcDir, TarWriteOptions{}, excludeDirs...)
+}
+
+// WriteTarIndexed works like WriteTar and additionally reports every entry to
+// onEntry once it has been written completely, including its stream offsets and,
+// for regular files, the SHA-256 of the content. A nil onEntry disables indexing.
+func WriteTarIndexed(w io.Writer, srcDir string, onEntry func(TarEntry) error, excludeDirs ...string) error {
+	return WriteTarWithOptions(w, srcDir, TarWriteOptions{OnEntry: onEntry}, excludeDirs...)
+}
+
+// WriteTarWithOptions works like WriteTar with the indexing and content skipping
+// described by opts.
+func WriteTarWithOptions(w io.Writer, srcDir string, opts TarWriteOptions, excludeDirs ...string) error {
+	onEntry := opts.OnEntry
+	cw := &offsetWriter{w: w}
+	tw := tar.NewWriter(cw)
 	defer tw.Close()
 
 	srcDir = filepath.Clean(srcDir)
@@ -53,6 +97,12 @@ func WriteTar(w io.Writer, srcDir string, excludeDirs ...string) error {
 			return fmt.Errorf("Failed to compute relative path: %w", err)
 		}
 		rel = filepath.ToSlash(rel)
+		if rel == "." && !info.IsDir() {
+			rel = opts.FileName
+			if rel == "" {
+				rel = filepath.Base(srcDir)
+			}
+		}
 
 		hdr, err := tar.FileInfoHeader(info, "")
 		if err != nil {
@@ -60,54 +110,198 @@ func WriteTar(w io.Writer, srcDir string, excludeDirs ...string) error {
 		}
 		hdr.Name = rel
 
+		if opts.SkipContent != nil && info.Mode().IsRegular() {
+			skip, err := opts.SkipContent(path, rel, info)
+			if err != nil {
+				return err
+			}
+			if skip {
+				if onEntry != nil {
+					return onEntry(TarEntry{Header: hdr, Skipped: true})
+				}
+				return nil
+			}
+		}
+
+		// Flush pads the previous entry so the offset below is where this header starts.
+		if err := tw.Flush(); err != nil {
+			return fmt.Errorf("Failed to finish TAR entry before %q: %w", path, err)
+		}
+		entry := TarEntry{Header: hdr, HeaderOffset: cw.n}
 		if err := tw.WriteHeader(hdr); err != nil {
 			return fmt.Errorf("Failed to write TAR header for %q: %w", path, err)
 		}
+		entry.DataOffset = cw.n
 
-		if info.IsDir() || !info.Mode().IsRegular() {
-			return nil
+		if !info.IsDir() && info.Mode().IsRegular() {
+			sum, err := copyFileToTar(tw, path, onEntry != nil)
+			if err != nil {
+				return err
+			}
+			entry.SHA256 = sum
 		}
 
-		f, err := os.Open(path)
-		if err != nil {
-			return fmt.Errorf("Failed to open file %q: %w", path, err)
+		if onEntry != nil {
+			return onEntry(entry)
 		}
+		return nil
+	})
+}
 
-		if _, err := io.Copy(tw, f); err != nil {
-			f.Close() //nolint:errcheck
-			return fmt.Errorf("Failed to copy file content %q: %w", path, err)
-		}
+// copyFileToTar copies the file at path into tw and returns its SHA-256 when withHash is set.
+func copyFileToTar(tw *tar.Writer, path string, withHash bool) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open file %q: %w", path, err)
+	}
+
+	var dst io.Writer = tw
+	var sum hash.Hash
+	if withHash {
+		sum = sha256.New()
+		dst = io.MultiWriter(tw, sum)
+	}
+	if _, err := io.Copy(dst, f); err != nil {
+		f.Close() //nolint:errcheck
+		return nil, fmt.Errorf("Failed to copy file content %q: %w", path, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("Failed to close file %q: %w", path, err)
+	}
+	if sum == nil {
+		return nil, nil
+	}
+	return sum.Sum(nil), nil
+}
 
-		if err := f.Close(); err != nil {
-			return fmt.Errorf("Failed to close file %q: %w", path, err)
+// offsetWriter counts the bytes written to w.
+type offsetWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.Write(p)
+	o.n += int64(n)
+	return n, err
+}
+
+// TarCopier writes entries read from other TAR archives into a new TAR stream and
+// reports their offsets and content hashes like WriteTarIndexed.
+type TarCopier struct {
+	cw *offsetWriter
+	tw *tar.Writer
+}
+
+// NewTarCopier starts a TAR stream on w.
+func NewTarCopier(w io.Writer) *TarCopier {
+	cw := &offsetWriter{w: w}
+	return &TarCopier{cw: cw, tw: tar.NewWriter(cw)}
+}
+
+// Copy writes hdr and, for regular files, the content read from body.
+func (c *TarCopier) Copy(hdr *tar.Header, body io.Reader) (TarEntry, error) {
+	if err := c.tw.Flush(); err != nil {
+		return TarEntry{}, fmt.Errorf("Failed to finish TAR entry before %q: %w", hdr.Name, err)
+	}
+	entry := TarEntry{Header: hdr, HeaderOffset: c.cw.n}
+	if err := c.tw.WriteHeader(hdr); err != nil {
+		return TarEntry{}, fmt.Errorf("Failed to write TAR header for %q: %w", hdr.Name, err)
+	}
+	entry.DataOffset = c.cw.n
+
+	if hdr.Typeflag == tar.TypeReg {
+		sum := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(c.tw, sum), io.LimitReader(body, hdr.Size)); err != nil {
+			return TarEntry{}, fmt.Errorf("Failed to copy TAR entry content %q: %w", hdr.Name, err)
 		}
+		entry.SHA256 = sum.Sum(nil)
+	}
+	return entry, nil
+}
 
-		return nil
-	})
+// Close writes the TAR footer.
+func (c *TarCopier) Close() error {
+	return c.tw.Close()
+}
+
+// ExtractOptions controls which entries ExtractTarSelected materialises and where.
+type ExtractOptions struct {
+	// Selector limits extraction to matching entries; nil extracts everything.
+	Selector *PathSelector
+	// Flatten writes selected files directly into destDir without their directory structure.
+	Flatten bool
+	// Conflict decides how files that already exist in destDir are handled.
+	// The zero value fails on the first existing file.
+	Conflict ConflictPolicy
+	// OnConflict, when set, is called with every conflict decision.
+	OnConflict func(ConflictDecision)
+	// Include, when set, further limits extraction to entries for which it returns true.
+	Include func(name string) bool
+	// ExpectedSHA256, when set, returns the expected content hash of a regular file
+	// entry. Files whose content does not match are not moved into place.
+	ExpectedSHA256 func(name string) ([]byte, bool)
+	// Names maps archive paths to names the destination accepts. Share one NameMapper
+	// across the extractions into one directory; when nil, every extraction uses a new
+	// NameMapper with the rules of this system.
+	Names *NameMapper
+	// OnFileWritten, when set, is called with the archive name of every regular file
+	// once it is in place. An error stops the extraction.
+	OnFileWritten func(name string) error
+}
+
+// ArchiveTempSuffix ends the names of files that are still being extracted; they
+// are renamed into place once complete.
+const ArchiveTempSuffix = ".restoresafe-tmp"
+
+// ExtractStats summarises the entries written by ExtractTarSelected.
+type ExtractStats struct {
+	Files       int
+	Bytes       int64
+	Skipped     int
+	Overwritten int
+	Renamed     int
+	Verified    int // files whose content matched ExpectedSHA256
+}
+
+// Add accumulates the counters of other into s.
+func (s *ExtractStats) Add(other ExtractStats) {
+	s.Files += other.Files
+	s.Bytes += other.Bytes
+	s.Skipped += other.Skipped
+	s.Overwritten += other.Overwritten
+	s.Renamed += other.Renamed
+	s.Verified += other.Verified
+}
+
+// TarSelectionStats summarises the regular files in an archive that match a selector.
+type TarSelectionStats struct {
+	Files     int
+	Bytes     int64
+	Conflicts int // matching files whose target already exists in the destination
 }
 
 // ExtractTar reads a TAR stream from r and extracts all entries to destDir.
 func ExtractTar(r io.Reader, destDir string) error {
-	tr := tar.NewReader(r)
+	_, err := ExtractTarSelected(r, destDir, ExtractOptions{})
+	return err
+}
 
-	for {
-		hdr, err := tr.Next()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("Failed to read TAR entry: %w. Remedy: Check password/challenge and .enc part completeness.", err)
-		}
+// ExtractTarSelected reads a TAR stream from r and extracts the entries chosen by
+// opts to destDir. Entries that are not selected are skipped; when r implements
+// io.Seeker their content is skipped without being read. Files are written under
+// a temporary name and renamed into place once complete.
+func ExtractTarSelected(r io.Reader, destDir string, opts ExtractOptions) (ExtractStats, error) {
+	var stats ExtractStats
+	targets := newExtractTargets(destDir, opts)
 
-		if err := validateTarPath(hdr.Name); err != nil {
+	err := WalkTar(r, func(hdr *tar.Header, body io.Reader) error {
+		target, ok, err := targets.resolve(hdr)
+		if err != nil || !ok {
 			return err
 		}
 
-		target := filepath.Join(destDir, filepath.FromSlash(hdr.Name))
-		if !strings.HasPrefix(filepath.Clean(target)+string(os.PathSeparator), filepath.Clean(destDir)+string(os.PathSeparator)) {
-			return fmt.Errorf("Invalid path in archive (path traversal): %q. Remedy: Do not use this backup; use only unmodified, trusted backup files.", hdr.Name)
-		}
-
 		switch hdr.Typeflag {
 		case tar.TypeDir:
 			if err := os.MkdirAll(target, 0o750); err != nil {
@@ -117,17 +311,164 @@ func ExtractTar(r io.Reader, destDir string) error {
 			if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
 				return fmt.Errorf("Failed to create parent directory: %w. Remedy: Check write permissions in the restore destination.", err)
 			}
-			if err := writeArchiveFile(target, tr); err != nil {
+			if existing, err := os.Lstat(target); err == nil {
+				writeTo, decision, err := resolveConflict(opts.Conflict, hdr.Name, target, existing, hdr.ModTime)
+				if err != nil {
+					return err
+				}
+				if opts.OnConflict != nil {
+					opts.OnConflict(decision)
+				}
+				switch decision.Action {
+				case ConflictActionSkipped:
+					stats.Skipped++
+					return nil
+				case ConflictActionOverwritten:
+					stats.Overwritten++
+				case ConflictActionRenamed:
+					stats.Renamed++
+				}
+				target = writeTo
+			} else if !os.IsNotExist(err) {
+				return fmt.Errorf("Failed to check restore target %q: %w", target, err)
+			}
+			var want []byte
+			if opts.ExpectedSHA256 != nil {
+				want, _ = opts.ExpectedSHA256(hdr.Name)
+			}
+			if err := writeArchiveFile(target, body, want); err != nil {
 				return err
 			}
+			if want != nil {
+				stats.Verified++
+			}
+			stats.Files++
+			stats.Bytes += hdr.Size
+			if opts.OnFileWritten != nil {
+				return opts.OnFileWritten(hdr.Name)
+			}
+		}
+		return nil
+	})
+
+	return stats, err
+}
+
+// ScanTarSelection counts the regular files in a TAR stream that match opts.Selector.
+// When destDir is not empty, matching files whose target already exists there are
+// counted as conflicts. File contents are skipped; when r implements io.Seeker they
+// are not read at all.
+func ScanTarSelection(r io.Reader, destDir string, opts ExtractOptions) (TarSelectionStats, error) {
+	scan := newSelectionScan(destDir, opts)
+	err := WalkTar(r, func(hdr *tar.Header, _ io.Reader) error {
+		return scan.add(hdr)
+	})
+	return scan.stats, err
+}
+
+// ScanHeaderSelection is ScanTarSelection for headers that are already known,
+// e.g. from a backup manifest, so the archive does not need to be read.
+func ScanHeaderSelection(headers []*tar.Header, destDir string, opts ExtractOptions) (TarSelectionStats, error) {
+	scan := newSelectionScan(destDir, opts)
+	for _, hdr := range headers {
+		if err := scan.add(hdr); err != nil {
+			return scan.stats, err
 		}
 	}
+	return scan.stats, nil
+}
+
+type selectionScan struct {
+	destDir string
+	targets *extractTargets
+	stats   TarSelectionStats
+}
+
+func newSelectionScan(destDir string, opts ExtractOptions) *selectionScan {
+	return &selectionScan{destDir: destDir, targets: newExtractTargets(destDir, opts)}
+}
 
+func (s *selectionScan) add(hdr *tar.Header) error {
+	if hdr.Typeflag != tar.TypeReg {
+		return nil
+	}
+	target, ok, err := s.targets.resolve(hdr)
+	if err != nil || !ok {
+		return err
+	}
+	s.stats.Files++
+	s.stats.Bytes += hdr.Size
+	if s.destDir != "" {
+		if _, err := os.Lstat(target); err == nil {
+			s.stats.Conflicts++
+		}
+	}
 	return nil
 }
 
+// extractTargets maps archive entries to destination paths for one extraction.
+type extractTargets struct {
+	destDir   string
+	opts      ExtractOptions
+	flattened map[string]string
+}
+
+func newExtractTargets(destDir string, opts ExtractOptions) *extractTargets {
+	if opts.Names == nil {
+		opts.Names = NewNameMapper(TargetNameRules())
+	}
+	return &extractTargets{destDir: destDir, opts: opts, flattened: make(map[string]string)}
+}
+
+// resolve returns the destination path of hdr, or ok=false when the entry is not extracted.
+func (t *extractTargets) resolve(hdr *tar.Header) (string, bool, error) {
+	if !t.opts.Selector.Match(hdr.Name) {
+		return "", false, nil
+	}
+	if t.opts.Include != nil && !t.opts.Include(hdr.Name) {
+		return "", false, nil
+	}
+
+	name := hdr.Name
+	if t.opts.Flatten {
+		if hdr.Typeflag != tar.TypeReg {
+			return "", false, nil
+		}
+		name = path.Base(path.Clean(strings.ReplaceAll(hdr.Name, "\\", "/")))
+		key := strings.ToLower(name)
+		if previous, exists := t.flattened[key]; exists {
+			return "", false, fmt.Errorf("Flattened restore would write %q twice (from %q and %q). Remedy: Keep the directory structure or narrow the file selection.", name, previous, hdr.Name)
+		}
+		t.flattened[key] = hdr.Name
+	}
+	relative := filepath.FromSlash(t.opts.Names.Map(name))
+
+	if t.destDir == "" {
+		return relative, true, nil
+	}
+	target := filepath.Join(t.destDir, relative)
+	if !strings.HasPrefix(filepath.Clean(target)+string(os.PathSeparator), filepath.Clean(t.destDir)+string(os.PathSeparator)) {
+		return "", false, fmt.Errorf("Invalid path in archive (path traversal): %q. Remedy: Do not use this backup; use only unmodified, trusted backup files.", hdr.Name)
+	}
+	return target, true, nil
+}
+
 // ValidateTar verifies that all TAR headers and regular-file payloads can be consumed.
 func ValidateTar(r io.Reader) error {
+	return WalkTar(r, func(hdr *tar.Header, body io.Reader) error {
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := io.Copy(io.Discard, body); err != nil {
+				return fmt.Errorf("Failed to read TAR entry payload %q: %w. Remedy: Check .enc part completeness and create a new backup if needed.", hdr.Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// WalkTar iterates over all entries of a TAR stream, validating each entry path
+// before handing the header and its payload reader to fn. Payload bytes that fn
+// does not read are skipped.
+func WalkTar(r io.Reader, fn func(hdr *tar.Header, body io.Reader) error) error {
 	tr := tar.NewReader(r)
 
 	for {
@@ -143,26 +484,51 @@ func ValidateTar(r io.Reader) error {
 			return err
 		}
 
-		if hdr.Typeflag == tar.TypeReg {
-			if _, err := io.Copy(io.Discard, tr); err != nil {
-				return fmt.Errorf("Failed to read TAR entry payload %q: %w. Remedy: Check .enc part completeness and create a new backup if needed.", hdr.Name, err)
-			}
+		if err := fn(hdr, tr); err != nil {
+			return err
 		}
 	}
 
 	return nil
 }
 
-func writeArchiveFile(target string, r io.Reader) error {
-	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+// writeArchiveFile writes r to a temporary file next to target and renames it
+// into place, so target never holds partially restored content. When wantSHA256
+// is not nil, the content must have this hash or the file is discarded.
+func writeArchiveFile(target string, r io.Reader, wantSHA256 []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(target), filepath.Base(target)+".*"+ArchiveTempSuffix)
 	if err != nil {
 		return fmt.Errorf("Failed to create archive file %q: %w. Remedy: Check write permissions in the restore destination.", target, err)
 	}
-	defer f.Close()
+	tempPath := f.Name()
 
-	if _, err := io.Copy(f, r); err != nil {
+	var dst io.Writer = f
+	sum := sha256.New()
+	if wantSHA256 != nil {
+		dst = io.MultiWriter(f, sum)
+	}
+	if _, err := io.Copy(dst, r); err != nil {
+		f.Close()           //nolint:errcheck
+		os.Remove(tempPath) //nolint:errcheck
 		return fmt.Errorf("Failed to write file content %q: %w", target, err)
 	}
+	if wantSHA256 != nil && !bytes.Equal(sum.Sum(nil), wantSHA256) {
+		f.Close()           //nolint:errcheck
+		os.Remove(tempPath) //nolint:errcheck
+		return fmt.Errorf("Integrity check failed for %q: the restored content does not match the hash recorded in the manifest. Remedy: Do not use this backup for this file; restore it from another backup run.", target)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tempPath) //nolint:errcheck
+		return fmt.Errorf("Failed to close file %q: %w", target, err)
+	}
+	if err := os.Chmod(tempPath, 0o640); err != nil {
+		os.Remove(tempPath) //nolint:errcheck
+		return fmt.Errorf("Failed to set permissions on %q: %w", target, err)
+	}
+	if err := os.Rename(tempPath, target); err != nil {
+		os.Remove(tempPath) //nolint:errcheck
+		return fmt.Errorf("Failed to move restored file into place at %q: %w. Remedy: Check that the file is not open in another program.", target, err)
+	}
 	return nil
 }
 
@@ -176,7 +542,8 @@ func validateTarPath(name string) error {
 	if strings.HasPrefix(cleaned, "/") || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
 		return fmt.Errorf("Invalid path in archive (path traversal): %q. Remedy: Do not use this backup; use only unmodified, trusted backup files.", name)
 	}
-	if strings.Contains(cleaned, ":") {
+	// Other colons are escaped by NameMapper where the destination does not accept them.
+	if hasDriveLetter(cleaned) {
 		return fmt.Errorf("Invalid path in archive (absolute path): %q. Remedy: Do not use this backup; use only unmodified, trusted backup files.", name)
 	}
 	if vol := filepath.VolumeName(filepath.FromSlash(cleaned)); vol != "" {
@@ -185,3 +552,12 @@ func validateTarPath(name string) error {
 
 	return nil
 }
+
+// hasDriveLetter reports whether name starts with a Windows drive such as C:.
+func hasDriveLetter(name string) bool {
+	if len(name) < 2 || name[1] != ':' {
+		return false
+	}
+	c := name[0]
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
@@ -3,11 +3,13 @@ package util
 import (
 	"archive/tar"
 	"bytes"
+	"crypto/sha256"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestValidateTarAcceptsRegularArchive(t *testing.T) {
@@ -55,6 +57,41 @@ func TestValidateTarRejectsAbsolutePath(t *testing.T) {
 	}
 }
 
+func TestExtractTarSelectedMapsNamesForDestination(t *testing.T) {
+	t.Parallel()
+
+	archiveBytes := makeTarBytes(t, []tarEntry{
+		{name: "notes/10:30 meeting.txt", typeflag: tar.TypeReg, mode: 0o640, body: "colon"},
+		{name: "notes/CON.txt", typeflag: tar.TypeReg, mode: 0o640, body: "reserved"},
+		{name: "notes/Readme", typeflag: tar.TypeReg, mode: 0o640, body: "upper"},
+		{name: "notes/readme", typeflag: tar.TypeReg, mode: 0o640, body: "lower"},
+	})
+	dest := t.TempDir()
+	names := NewNameMapper(windowsRules)
+
+	stats, err := ExtractTarSelected(bytes.NewReader(archiveBytes), dest, ExtractOptions{Names: names})
+	if err != nil {
+		t.Fatalf("ExtractTarSelected returned error: %v", err)
+	}
+	if stats.Files != 4 {
+		t.Fatalf("expected 4 files, got %+v", stats)
+	}
+	for name, want := range map[string]string{
+		"10~3A~30 meeting.txt": "colon",
+		"CO~4E~.txt":           "reserved",
+		"Readme":               "upper",
+		"readme~2":             "lower",
+	} {
+		got, err := os.ReadFile(filepath.Join(dest, "notes", name))
+		if err != nil || string(got) != want {
+			t.Fatalf("expected %q with %q, got %q (err=%v)", name, want, got, err)
+		}
+	}
+	if got := len(names.Renames()); got != 3 {
+		t.Fatalf("expected 3 renames, got %d", got)
+	}
+}
+
 func TestValidateTarRejectsEmptyPath(t *testing.T) {
 	t.Parallel()
 
@@ -210,3 +247,482 @@ func makeTarBytes(t *testing.T, entries []tarEntry) []byte {
 
 	return buf.Bytes()
 }
+
+func TestExtractTarSelectedKeepsStructure(t *testing.T) {
+	t.Parallel()
+
+	archiveBytes := makeTarBytes(t, []tarEntry{
+		{name: "docs", typeflag: tar.TypeDir, mode: 0o750},
+		{name: "docs/a.txt", typeflag: tar.TypeReg, mode: 0o640, body: "alpha"},
+		{name: "docs/sub", typeflag: tar.TypeDir, mode: 0o750},
+		{name: "docs/sub/b.txt", typeflag: tar.TypeReg, mode: 0o640, body: "beta"},
+		{name: "other.txt", typeflag: tar.TypeReg, mode: 0o640, body: "other"},
+	})
+	selector, err := NewPathSelector([]string{"docs/sub"})
+	if err != nil {
+		t.Fatalf("NewPathSelector returned error: %v", err)
+	}
+
+	dest := t.TempDir()
+	stats, err := ExtractTarSelected(bytes.NewReader(archiveBytes), dest, ExtractOptions{Selector: selector})
+	if err != nil {
+		t.Fatalf("ExtractTarSelected returned error: %v", err)
+	}
+	if stats.Files != 1 || stats.Bytes != 4 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if got, err := os.ReadFile(filepath.Join(dest, "docs", "sub", "b.txt")); err != nil || string(got) != "beta" {
+		t.Fatalf("expected docs/sub/b.txt to be restored, got %q (err=%v)", got, err)
+	}
+	for _, skipped := range []string{filepath.Join("docs", "a.txt"), "other.txt"} {
+		if _, err := os.Stat(filepath.Join(dest, skipped)); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be skipped, stat err=%v", skipped, err)
+		}
+	}
+}
+
+func TestExtractTarSelectedFlattens(t *testing.T) {
+	t.Parallel()
+
+	archiveBytes := makeTarBytes(t, []tarEntry{
+		{name: "a/one.xlsx", typeflag: tar.TypeReg, mode: 0o640, body: "1"},
+		{name: "b/c/two.xlsx", typeflag: tar.TypeReg, mode: 0o640, body: "22"},
+		{name: "b/notes.txt", typeflag: tar.TypeReg, mode: 0o640, body: "n"},
+	})
+	selector, err := NewPathSelector([]string{"**/*.xlsx"})
+	if err != nil {
+		t.Fatalf("NewPathSelector returned error: %v", err)
+	}
+
+	dest := t.TempDir()
+	stats, err := ExtractTarSelected(bytes.NewReader(archiveBytes), dest, ExtractOptions{Selector: selector, Flatten: true})
+	if err != nil {
+		t.Fatalf("ExtractTarSelected returned error: %v", err)
+	}
+	if stats.Files != 2 {
+		t.Fatalf("expected 2 restored files, got %d", stats.Files)
+	}
+	entries, err := os.ReadDir(dest)
+	if err != nil {
+		t.Fatalf("failed to read destination: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name() != "one.xlsx" || entries[1].Name() != "two.xlsx" {
+		t.Fatalf("expected only flattened files in destination, got %v", entries)
+	}
+}
+
+func TestExtractTarSelectedFlattenRejectsDuplicateNames(t *testing.T) {
+	t.Parallel()
+
+	archiveBytes := makeTarBytes(t, []tarEntry{
+		{name: "a/report.pdf", typeflag: tar.TypeReg, mode: 0o640, body: "1"},
+		{name: "b/Report.pdf", typeflag: tar.TypeReg, mode: 0o640, body: "2"},
+	})
+	selector, err := NewPathSelector([]string{"*/*.pdf"})
+	if err != nil {
+		t.Fatalf("NewPathSelector returned error: %v", err)
+	}
+
+	_, err = ExtractTarSelected(bytes.NewReader(archiveBytes), t.TempDir(), ExtractOptions{Selector: selector, Flatten: true})
+	if err == nil {
+		t.Fatal("expected duplicate-name error, got nil")
+	}
+	if !strings.Contains(err.Error(), "twice") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestScanTarSelectionCountsMatches(t *testing.T) {
+	t.Parallel()
+
+	archiveBytes := makeTarBytes(t, []tarEntry{
+		{name: "docs", typeflag: tar.TypeDir, mode: 0o750},
+		{name: "docs/a.txt", typeflag: tar.TypeReg, mode: 0o640, body: "alpha"},
+		{name: "docs/b.txt", typeflag: tar.TypeReg, mode: 0o640, body: "beta"},
+		{name: "c.bin", typeflag: tar.TypeReg, mode: 0o640, body: "gamma"},
+	})
+	selector, err := NewPathSelector([]string{"docs"})
+	if err != nil {
+		t.Fatalf("NewPathSelector returned error: %v", err)
+	}
+
+	stats, err := ScanTarSelection(bytes.NewReader(archiveBytes), "", ExtractOptions{Selector: selector})
+	if err != nil {
+		t.Fatalf("ScanTarSelection returned error: %v", err)
+	}
+	if stats.Files != 2 || stats.Bytes != 9 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestExtractTarSelectedConflictPolicies(t *testing.T) {
+	t.Parallel()
+
+	archiveMTime := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	archiveBytes := makeTarBytesWithModTime(t, "a.txt", "from backup", archiveMTime)
+
+	cases := []struct {
+		policy       ConflictPolicy
+		existingTime time.Time
+		wantContent  string
+		wantAction   ConflictAction
+		wantRenamed  bool
+	}{
+		{policy: ConflictSkip, existingTime: archiveMTime.Add(-time.Hour), wantContent: "existing", wantAction: ConflictActionSkipped},
+		{policy: ConflictOverwrite, existingTime: archiveMTime.Add(time.Hour), wantContent: "from backup", wantAction: ConflictActionOverwritten},
+		{policy: ConflictOverwriteNewer, existingTime: archiveMTime.Add(-time.Hour), wantContent: "from backup", wantAction: ConflictActionOverwritten},
+		{policy: ConflictOverwriteNewer, existingTime: archiveMTime, wantContent: "existing", wantAction: ConflictActionSkipped},
+		{policy: ConflictRename, existingTime: archiveMTime, wantContent: "existing", wantAction: ConflictActionRenamed, wantRenamed: true},
+	}
+	for _, tc := range cases {
+		dest := t.TempDir()
+		existing := filepath.Join(dest, "a.txt")
+		if err := os.WriteFile(existing, []byte("existing"), 0o600); err != nil {
+			t.Fatalf("failed to create existing file: %v", err)
+		}
+		if err := os.Chtimes(existing, tc.existingTime, tc.existingTime); err != nil {
+			t.Fatalf("failed to set existing file time: %v", err)
+		}
+
+		var decisions []ConflictDecision
+		opts := ExtractOptions{Conflict: tc.policy, OnConflict: func(d ConflictDecision) { decisions = append(decisions, d) }}
+		if _, err := ExtractTarSelected(bytes.NewReader(archiveBytes), dest, opts); err != nil {
+			t.Fatalf("%s: ExtractTarSelected returned error: %v", tc.policy, err)
+		}
+
+		if got, _ := os.ReadFile(existing); string(got) != tc.wantContent {
+			t.Fatalf("%s: expected existing path to contain %q, got %q", tc.policy, tc.wantContent, got)
+		}
+		if len(decisions) != 1 || decisions[0].Action != tc.wantAction {
+			t.Fatalf("%s: unexpected decisions: %+v", tc.policy, decisions)
+		}
+		renamed := filepath.Join(dest, "a (restored).txt")
+		if got, err := os.ReadFile(renamed); tc.wantRenamed && (err != nil || string(got) != "from backup") {
+			t.Fatalf("%s: expected renamed copy with backup content, got %q (err=%v)", tc.policy, got, err)
+		}
+		entries, _ := os.ReadDir(dest)
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".restoresafe-tmp") {
+				t.Fatalf("%s: temporary file left behind: %s", tc.policy, entry.Name())
+			}
+		}
+	}
+}
+
+func TestExtractTarSelectedFailsOnExistingFileByDefault(t *testing.T) {
+	t.Parallel()
+
+	dest := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dest, "a.txt"), []byte("existing"), 0o600); err != nil {
+		t.Fatalf("failed to create existing file: %v", err)
+	}
+
+	archiveBytes := makeTarBytesWithModTime(t, "a.txt", "from backup", time.Now())
+	_, err := ExtractTarSelected(bytes.NewReader(archiveBytes), dest, ExtractOptions{})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected already-exists error, got: %v", err)
+	}
+}
+
+func TestScanTarSelectionCountsConflicts(t *testing.T) {
+	t.Parallel()
+
+	dest := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dest, "docs"), 0o750); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dest, "docs", "a.txt"), []byte("x"), 0o600); err != nil {
+		t.Fatalf("failed to create existing file: %v", err)
+	}
+	archiveBytes := makeTarBytes(t, []tarEntry{
+		{name: "docs", typeflag: tar.TypeDir, mode: 0o750},
+		{name: "docs/a.txt", typeflag: tar.TypeReg, mode: 0o640, body: "alpha"},
+		{name: "docs/b.txt", typeflag: tar.TypeReg, mode: 0o640, body: "beta"},
+	})
+
+	stats, err := ScanTarSelection(bytes.NewReader(archiveBytes), dest, ExtractOptions{})
+	if err != nil {
+		t.Fatalf("ScanTarSelection returned error: %v", err)
+	}
+	if stats.Files != 2 || stats.Conflicts != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func makeTarBytesWithModTime(t *testing.T, name, body string, modTime time.Time) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	hdr := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o640, Size: int64(len(body)), ModTime: modTime}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatalf("failed to write tar header: %v", err)
+	}
+	if _, err := io.WriteString(tw, body); err != nil {
+		t.Fatalf("failed to write tar body: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestWriteTarIndexedReportsOffsetsAndHashes(t *testing.T) {
+	t.Parallel()
+
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("alpha"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	var entries []TarEntry
+	var archive bytes.Buffer
+	err := WriteTarIndexed(&archive, src, func(e TarEntry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WriteTarIndexed returned error: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Header.Name != "." || entries[1].Header.Name != "a.txt" {
+		t.Fatalf("unexpected entries: %#v", entries)
+	}
+	if entries[0].SHA256 != nil {
+		t.Fatalf("expected no hash for the root directory")
+	}
+
+	file := entries[1]
+	want := sha256.Sum256([]byte("alpha"))
+	if !bytes.Equal(file.SHA256, want[:]) {
+		t.Fatalf("unexpected hash %x", file.SHA256)
+	}
+	data := archive.Bytes()
+	if got := string(data[file.DataOffset : file.DataOffset+5]); got != "alpha" {
+		t.Fatalf("expected content at data offset, got %q", got)
+	}
+	hdr, err := tar.NewReader(bytes.NewReader(data[file.HeaderOffset:])).Next()
+	if err != nil || hdr.Name != "a.txt" {
+		t.Fatalf("expected header at offset %d, got %v, %v", file.HeaderOffset, hdr, err)
+	}
+}
+
+func TestWriteTarWithOptionsSkipsContentButReportsEntry(t *testing.T) {
+	t.Parallel()
+
+	src := t.TempDir()
+	for name, body := range map[string]string{"keep.txt": "keep", "skip.txt": "skip"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(body), 0o600); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	reported := make(map[string]TarEntry)
+	var archive bytes.Buffer
+	err := WriteTarWithOptions(&archive, src, TarWriteOptions{
+		OnEntry: func(e TarEntry) error {
+			reported[e.Header.Name] = e
+			return nil
+		},
+		SkipContent: func(_, name string, _ os.FileInfo) (bool, error) {
+			return name == "skip.txt", nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("WriteTarWithOptions returned error: %v", err)
+	}
+	if !reported["skip.txt"].Skipped || reported["keep.txt"].Skipped {
+		t.Fatalf("unexpected skip flags: %#v", reported)
+	}
+
+	var names []string
+	if err := WalkTar(&archive, func(hdr *tar.Header, _ io.Reader) error {
+		names = append(names, hdr.Name)
+		return nil
+	}); err != nil {
+		t.Fatalf("WalkTar returned error: %v", err)
+	}
+	if strings.Join(names, ",") != ".,keep.txt" {
+		t.Fatalf("expected skipped file to be left out of the archive, got %v", names)
+	}
+}
+
+func TestExtractTarSelectedHonoursInclude(t *testing.T) {
+	t.Parallel()
+
+	archiveBytes := makeTarBytes(t, []tarEntry{
+		{name: "a.txt", typeflag: tar.TypeReg, mode: 0o640, body: "a"},
+		{name: "b.txt", typeflag: tar.TypeReg, mode: 0o640, body: "b"},
+	})
+	dest := t.TempDir()
+	stats, err := ExtractTarSelected(bytes.NewReader(archiveBytes), dest, ExtractOptions{
+		Include: func(name string) bool { return name == "b.txt" },
+	})
+	if err != nil {
+		t.Fatalf("ExtractTarSelected returned error: %v", err)
+	}
+	if stats.Files != 1 {
+		t.Fatalf("expected 1 extracted file, got %+v", stats)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected a.txt not to be extracted, stat err: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "b.txt")); err != nil {
+		t.Fatalf("expected b.txt to be extracted: %v", err)
+	}
+}
+
+func TestExtractTarSelectedReportsWrittenFilesAndStopsOnError(t *testing.T) {
+	t.Parallel()
+
+	archiveBytes := makeTarBytes(t, []tarEntry{
+		{name: "dir", typeflag: tar.TypeDir, mode: 0o750},
+		{name: "dir/a.txt", typeflag: tar.TypeReg, mode: 0o640, body: "a"},
+		{name: "dir/b.txt", typeflag: tar.TypeReg, mode: 0o640, body: "b"},
+	})
+	dest := t.TempDir()
+	var written []string
+	_, err := ExtractTarSelected(bytes.NewReader(archiveBytes), dest, ExtractOptions{
+		OnFileWritten: func(name string) error {
+			if _, err := os.Stat(filepath.Join(dest, filepath.FromSlash(name))); err != nil {
+				t.Fatalf("expected %s to be in place when reported: %v", name, err)
+			}
+			written = append(written, name)
+			return io.ErrShortWrite
+		},
+	})
+	if err != io.ErrShortWrite {
+		t.Fatalf("expected the callback error, got %v", err)
+	}
+	if len(written) != 1 || written[0] != "dir/a.txt" {
+		t.Fatalf("expected only dir/a.txt to be reported, got %v", written)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "dir", "b.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected dir/b.txt not to be extracted, stat err: %v", err)
+	}
+}
+
+func TestTarCopierReportsOffsetsAndHashes(t *testing.T) {
+	t.Parallel()
+
+	source := makeTarBytes(t, []tarEntry{
+		{name: "docs", typeflag: tar.TypeDir, mode: 0o750},
+		{name: "docs/a.txt", typeflag: tar.TypeReg, mode: 0o640, body: "alpha"},
+	})
+
+	var archive bytes.Buffer
+	copier := NewTarCopier(&archive)
+	var entries []TarEntry
+	if err := WalkTar(bytes.NewReader(source), func(hdr *tar.Header, body io.Reader) error {
+		entry, err := copier.Copy(hdr, body)
+		entries = append(entries, entry)
+		return err
+	}); err != nil {
+		t.Fatalf("copying entries failed: %v", err)
+	}
+	if err := copier.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	if len(entries) != 2 || entries[0].SHA256 != nil {
+		t.Fatalf("unexpected entries: %#v", entries)
+	}
+	file := entries[1]
+	want := sha256.Sum256([]byte("alpha"))
+	if !bytes.Equal(file.SHA256, want[:]) {
+		t.Fatalf("unexpected hash %x", file.SHA256)
+	}
+	data := archive.Bytes()
+	if got := string(data[file.DataOffset : file.DataOffset+5]); got != "alpha" {
+		t.Fatalf("expected content at data offset, got %q", got)
+	}
+	if err := ValidateTar(bytes.NewReader(data)); err != nil {
+		t.Fatalf("copied archive is invalid: %v", err)
+	}
+}
+
+func TestExtractTarSelectedRejectsHashMismatch(t *testing.T) {
+	t.Parallel()
+
+	archiveBytes := makeTarBytes(t, []tarEntry{
+		{name: "good.txt", typeflag: tar.TypeReg, mode: 0o640, body: "good"},
+		{name: "bad.txt", typeflag: tar.TypeReg, mode: 0o640, body: "tampered"},
+	})
+	good := sha256.Sum256([]byte("good"))
+	expected := map[string][]byte{"good.txt": good[:], "bad.txt": good[:]}
+	opts := ExtractOptions{ExpectedSHA256: func(name string) ([]byte, bool) {
+		sum, ok := expected[name]
+		return sum, ok
+	}}
+
+	dest := t.TempDir()
+	stats, err := ExtractTarSelected(bytes.NewReader(archiveBytes), dest, opts)
+	if err == nil || !strings.Contains(err.Error(), "Integrity check failed") {
+		t.Fatalf("expected integrity error, got: %v", err)
+	}
+	if stats.Verified != 1 {
+		t.Fatalf("expected 1 verified file before the mismatch, got %+v", stats)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "bad.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected mismatching file not to be written, stat err: %v", err)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dest, "*.restoresafe-tmp"))
+	if len(leftovers) != 0 {
+		t.Fatalf("expected temporary files to be removed, got %v", leftovers)
+	}
+}
+
+func TestScanHeaderSelectionMatchesScanTarSelection(t *testing.T) {
+	t.Parallel()
+
+	headers := []*tar.Header{
+		{Name: "docs", Typeflag: tar.TypeDir, Mode: 0o750},
+		{Name: "docs/a.txt", Typeflag: tar.TypeReg, Mode: 0o640, Size: 5},
+		{Name: "c.bin", Typeflag: tar.TypeReg, Mode: 0o640, Size: 5},
+	}
+	selector, err := NewPathSelector([]string{"docs"})
+	if err != nil {
+		t.Fatalf("NewPathSelector returned error: %v", err)
+	}
+
+	stats, err := ScanHeaderSelection(headers, "", ExtractOptions{Selector: selector})
+	if err != nil {
+		t.Fatalf("ScanHeaderSelection returned error: %v", err)
+	}
+	if stats.Files != 1 || stats.Bytes != 5 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestWriteTarWithOptionsArchivesSingleFileUnderFileName(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	srcFile := filepath.Join(dir, "mail.pst")
+	if err := os.WriteFile(srcFile, []byte("mailbox"), 0o600); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+
+	var archive bytes.Buffer
+	if err := WriteTarWithOptions(&archive, srcFile, TarWriteOptions{FileName: "mail.pst__D-data"}); err != nil {
+		t.Fatalf("WriteTarWithOptions returned error: %v", err)
+	}
+
+	var names []string
+	if err := WalkTar(bytes.NewReader(archive.Bytes()), func(hdr *tar.Header, _ io.Reader) error {
+		names = append(names, hdr.Name)
+		return nil
+	}); err != nil {
+		t.Fatalf("WalkTar returned error: %v", err)
+	}
+	if len(names) != 1 || names[0] != "mail.pst__D-data" {
+		t.Fatalf("expected one entry named after FileName, got %v", names)
+	}
+
+	destDir := filepath.Join(dir, "restore")
+	if err := ExtractTar(bytes.NewReader(archive.Bytes()), destDir); err != nil {
+		t.Fatalf("ExtractTar returned error: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(destDir, "mail.pst__D-data")); err != nil || string(got) != "mailbox" {
+		t.Fatalf("expected extracted file content %q, got %q, %v", "mailbox", got, err)
+	}
+}
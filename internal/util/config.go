@@ -2,6 +2,7 @@ package util
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strings"
 
@@ -49,14 +50,157 @@ type Argon2Config struct {
 type Config struct {
 	SourceDirectories      []string     `yaml:"source_directories"`
 	BackupDirectory       string       `yaml:"backup_directory"`
+	BackupDirectories     []string     `yaml:"backup_directories"`
 	SplitSizeMB        int64        `yaml:"split_size_mb"`
 	RetentionKeep      int          `yaml:"retention_keep"`
 	LogLevel           string       `yaml:"log_level"`
 	IODiagnostics      bool         `yaml:"io_diagnostics"`
+	IORetry            IORetryConfig `yaml:"io_retry"`
+	Spanning           SpanningConfig `yaml:"spanning"`
 	AuthenticationMode AuthMode     `yaml:"authentication_mode"`
 	Argon2             Argon2Config `yaml:"argon2"`
+	BackupMode         BackupMode   `yaml:"backup_mode"`
+	MaxIncrementalChain int         `yaml:"max_incremental_chain"`
+	RepositoryFormat    RepositoryFormat `yaml:"repository_format"`
+	CommandSources      []CommandSource  `yaml:"command_sources"`
+	S3                  S3Config         `yaml:"s3"`
+	SFTP                SFTPConfig       `yaml:"sftp"`
+	WebDAV              WebDAVConfig     `yaml:"webdav"`
 }
 
+// S3Config holds the connection settings used when backup_directory is an
+// s3://bucket/prefix URL. Empty credentials are taken from the environment
+// variables AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type S3Config struct {
+	// Endpoint is the base URL of an S3-compatible service such as MinIO or
+	// Backblaze B2. Empty selects AWS S3 in Region.
+	Endpoint        string `yaml:"endpoint"`
+	Region          string `yaml:"region"`
+	AccessKeyID     string `yaml:"access_key_id"`
+	SecretAccessKey string `yaml:"secret_access_key"`
+	// PathStyle addresses buckets as endpoint/bucket instead of bucket.endpoint,
+	// as most self-hosted services require.
+	PathStyle bool `yaml:"path_style"`
+	// PartSizeMB is the size of each multipart upload request; it bounds the memory
+	// used per uploaded file.
+	PartSizeMB int `yaml:"part_size_mb"`
+}
+
+// SFTPConfig holds the SSH settings used when backup_directory is an
+// sftp://user@host/path URL. Authentication uses a private key; a passphrase for
+// it is taken from the environment variable RESTORESAFE_SFTP_KEY_PASSPHRASE.
+type SFTPConfig struct {
+	// PrivateKeyFile is the OpenSSH private key. Empty selects the first of
+	// id_ed25519, id_ecdsa and id_rsa in the .ssh folder of the user profile.
+	PrivateKeyFile string `yaml:"private_key_file"`
+	// KnownHostsFile lists the accepted host keys. Empty selects known_hosts in
+	// the .ssh folder of the user profile.
+	KnownHostsFile string `yaml:"known_hosts_file"`
+}
+
+// WebDAVConfig holds the credentials used when backup_directory is a
+// davs://host/path (HTTPS) or dav://host/path (HTTP) URL. Empty values are taken
+// from the environment variables RESTORESAFE_WEBDAV_USERNAME and
+// RESTORESAFE_WEBDAV_PASSWORD.
+type WebDAVConfig struct {
+	Username string `yaml:"username"`
+	// Password is sent with HTTP basic authentication; for Nextcloud, use an app password.
+	Password string `yaml:"password"`
+}
+
+// IORetryConfig sets how reads and writes of part files are retried after a
+// transient network error, such as an SMB share that briefly disconnects.
+type IORetryConfig struct {
+	// Attempts is the number of attempts of one read or write, including the
+	// first; 1 disables retrying.
+	Attempts int `yaml:"attempts"`
+	// InitialDelayMS is the wait before the first retry; it doubles with every
+	// further retry up to MaxDelayMS.
+	InitialDelayMS int `yaml:"initial_delay_ms"`
+	MaxDelayMS     int `yaml:"max_delay_ms"`
+}
+
+// Defaults of the io_retry section.
+const (
+	DefaultIORetryAttempts       = 5
+	DefaultIORetryInitialDelayMS = 500
+	DefaultIORetryMaxDelayMS     = 30000
+)
+
+// SpanningConfig sets how a backup run is spread over removable media, such as a
+// rotation of USB disks or BD-R discs, inserted one after another at the backup
+// directory (see MediaSpan).
+type SpanningConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MediaSizeMB is the capacity of one medium; 0 uses the free space of each
+	// inserted medium.
+	MediaSizeMB int `yaml:"media_size_mb"`
+	// ReserveMB is left free on each medium for manifests, labels and the log file.
+	ReserveMB int `yaml:"reserve_mb"`
+}
+
+// DefaultSpanningReserveMB is used when spanning.reserve_mb is 0.
+const DefaultSpanningReserveMB = 64
+
+// DefaultS3Region is used when s3.region is empty.
+const DefaultS3Region = "us-east-1"
+
+// DefaultS3PartSizeMB is used when s3.part_size_mb is 0. MinS3PartSizeMB is the
+// smallest part size S3 accepts for all but the last part of an upload.
+const (
+	DefaultS3PartSizeMB = 16
+	MinS3PartSizeMB     = 5
+)
+
+// CommandSource backs up the standard output of a command, such as a database dump,
+// without writing it to disk first.
+type CommandSource struct {
+	// Name is the backup name of the source and the name of the restored file.
+	Name    string   `yaml:"name"`
+	Command string   `yaml:"command"`
+	Args    []string `yaml:"args"`
+	// RestoreCommand, when set, can receive the restored stream on its standard input
+	// instead of it being written to a file.
+	RestoreCommand string   `yaml:"restore_command"`
+	RestoreArgs    []string `yaml:"restore_args"`
+}
+
+// FindCommandSource returns the command source backed up as name.
+func (c *Config) FindCommandSource(name string) (CommandSource, bool) {
+	for _, source := range c.CommandSources {
+		if strings.EqualFold(source.Name, name) {
+			return source, true
+		}
+	}
+	return CommandSource{}, false
+}
+
+// BackupMode selects whether a backup run stores every file or only the changes
+// since the previous run of the same source directory.
+type BackupMode string
+
+// BackupMode values.
+const (
+	BackupModeFull        BackupMode = "full"
+	BackupModeIncremental BackupMode = "incremental"
+)
+
+// RepositoryFormat selects how backup runs are stored in the backup directory.
+type RepositoryFormat string
+
+// RepositoryFormat values.
+const (
+	// RepositoryFormatSplitTar stores every run as one encrypted TAR in split parts.
+	RepositoryFormatSplitTar RepositoryFormat = "split-tar"
+	// RepositoryFormatChunked stores deduplicated, encrypted chunks in a shared
+	// repository and every run as a snapshot that refers to them.
+	RepositoryFormatChunked RepositoryFormat = "chunked"
+)
+
+// DefaultMaxIncrementalChain is the number of incremental runs allowed after a full
+// backup before the next run is a full backup again.
+const DefaultMaxIncrementalChain = 6
+
 // UseYubiKey reports whether the configured authentication mode requires a YubiKey.
 func (c *Config) UseYubiKey() bool {
 	return c.AuthenticationMode == AuthModePasswordYubiKey || c.AuthenticationMode == AuthModeYubiKey
@@ -94,6 +238,9 @@ func Load(path string) (*Config, error) {
 }
 
 func (c *Config) withDefaults() {
+	if c.BackupDirectory == "" && len(c.BackupDirectories) > 0 {
+		c.BackupDirectory = c.BackupDirectories[0]
+	}
 	if c.SplitSizeMB <= 0 {
 		c.SplitSizeMB = DefaultSplitSizeMB
 	}
@@ -112,14 +259,44 @@ func (c *Config) withDefaults() {
 	if c.Argon2.Threads == 0 {
 		c.Argon2.Threads = 4
 	}
+	if c.BackupMode == "" {
+		c.BackupMode = BackupModeFull
+	}
+	if c.MaxIncrementalChain == 0 {
+		c.MaxIncrementalChain = DefaultMaxIncrementalChain
+	}
+	if c.RepositoryFormat == "" {
+		c.RepositoryFormat = RepositoryFormatSplitTar
+	}
+	if c.S3.Region == "" {
+		c.S3.Region = DefaultS3Region
+	}
+	if c.S3.PartSizeMB == 0 {
+		c.S3.PartSizeMB = DefaultS3PartSizeMB
+	}
+	if c.IORetry.Attempts == 0 {
+		c.IORetry.Attempts = DefaultIORetryAttempts
+	}
+	if c.IORetry.InitialDelayMS == 0 {
+		c.IORetry.InitialDelayMS = DefaultIORetryInitialDelayMS
+	}
+	if c.IORetry.MaxDelayMS == 0 {
+		c.IORetry.MaxDelayMS = DefaultIORetryMaxDelayMS
+	}
+	if c.Spanning.ReserveMB == 0 {
+		c.Spanning.ReserveMB = DefaultSpanningReserveMB
+	}
 }
 
 func (c *Config) validate() error {
-	if len(c.SourceDirectories) == 0 {
+	if len(c.SourceDirectories) == 0 && len(c.CommandSources) == 0 {
 		return fmt.Errorf("No 'source_directories' specified in config file. Remedy: Add at least one source directory under 'source_directories', e.g. ['C:/Users/Name/Documents'].")
 	}
 	if c.BackupDirectory == "" {
-		return fmt.Errorf("No 'backup_directory' specified in config file. Remedy: Set a backup directory, e.g. 'C:/Backups'.")
+		return fmt.Errorf("No 'backup_directory' specified in config file. Remedy: Set a backup directory, e.g. 'C:/Backups', or several under 'backup_directories'.")
+	}
+	if err := c.validateBackupDirectories(); err != nil {
+		return err
 	}
 	switch c.LogLevel {
 	case "debug", "info":
@@ -143,5 +320,166 @@ func (c *Config) validate() error {
 	if c.Argon2.Threads < 1 {
 		return fmt.Errorf("Invalid 'argon2.threads': %d (minimum 1). Remedy: Set 'argon2.threads' to 1 or higher; the recommended value is 4.", c.Argon2.Threads)
 	}
+	switch c.BackupMode {
+	case BackupModeFull, BackupModeIncremental:
+	default:
+		return fmt.Errorf("Invalid 'backup_mode': %q (allowed: full, incremental). Remedy: Set 'backup_mode' to 'full' or 'incremental'.", c.BackupMode)
+	}
+	if c.MaxIncrementalChain < 1 {
+		return fmt.Errorf("Invalid 'max_incremental_chain': %d (minimum 1). Remedy: Set 'max_incremental_chain' to 1 or higher; the default is %d.", c.MaxIncrementalChain, DefaultMaxIncrementalChain)
+	}
+	switch c.RepositoryFormat {
+	case RepositoryFormatSplitTar, RepositoryFormatChunked:
+	default:
+		return fmt.Errorf("Invalid 'repository_format': %q (allowed: split-tar, chunked). Remedy: Set 'repository_format' to 'split-tar' or 'chunked'.", c.RepositoryFormat)
+	}
+	if c.RepositoryFormat == RepositoryFormatChunked && len(c.BackupDestinations()) > 1 {
+		return fmt.Errorf("'repository_format: chunked' cannot be combined with several 'backup_directories'. Remedy: Use 'repository_format: split-tar' or a single backup directory.")
+	}
+	if c.IORetry.Attempts < 1 {
+		return fmt.Errorf("Invalid 'io_retry.attempts': %d (minimum 1). Remedy: Set 'io_retry.attempts' to 1 (no retry) or higher; the default is %d.", c.IORetry.Attempts, DefaultIORetryAttempts)
+	}
+	if c.IORetry.InitialDelayMS < 1 || c.IORetry.MaxDelayMS < c.IORetry.InitialDelayMS {
+		return fmt.Errorf("Invalid 'io_retry' delays: initial_delay_ms %d, max_delay_ms %d. Remedy: Set 'io_retry.initial_delay_ms' to 1 or higher and 'io_retry.max_delay_ms' to at least that value; the defaults are %d and %d.", c.IORetry.InitialDelayMS, c.IORetry.MaxDelayMS, DefaultIORetryInitialDelayMS, DefaultIORetryMaxDelayMS)
+	}
+	if c.RepositoryFormat == RepositoryFormatChunked && c.BackupMode == BackupModeIncremental {
+		return fmt.Errorf("'backup_mode: incremental' cannot be combined with 'repository_format: chunked'. Remedy: Set 'backup_mode' to 'full'; the chunked repository already stores unchanged data only once.")
+	}
+	if err := c.validateSpanning(); err != nil {
+		return err
+	}
+	return validateCommandSources(c.CommandSources)
+}
+
+// validateSpanning checks the spanning section. A spanned run is written to one
+// local directory that every medium is mounted at, as full split-tar backups that
+// do not depend on runs stored on other media.
+func (c *Config) validateSpanning() error {
+	if c.Spanning.MediaSizeMB < 0 || c.Spanning.ReserveMB < 0 {
+		return fmt.Errorf("Invalid 'spanning' sizes: media_size_mb %d, reserve_mb %d. Remedy: Set 'spanning.media_size_mb' to 0 (free space of each medium) or the capacity of one medium, and 'spanning.reserve_mb' to 0 or higher.", c.Spanning.MediaSizeMB, c.Spanning.ReserveMB)
+	}
+	if !c.Spanning.Enabled {
+		return nil
+	}
+	if c.Spanning.MediaSizeMB > 0 && c.Spanning.MediaSizeMB <= c.Spanning.ReserveMB {
+		return fmt.Errorf("Invalid 'spanning.media_size_mb': %d is not larger than 'spanning.reserve_mb' (%d). Remedy: Set 'spanning.media_size_mb' to the capacity of one medium, e.g. 23000 for a 25 GB BD-R.", c.Spanning.MediaSizeMB, c.Spanning.ReserveMB)
+	}
+	if dirs := c.BackupDestinations(); len(dirs) > 1 || IsStorageURL(dirs[0]) {
+		return fmt.Errorf("'spanning' needs a single local 'backup_directory' on the removable media. Remedy: Set 'backup_directory' to a folder on the drive the media are inserted into, e.g. E:/RestoreSafe, or disable spanning.")
+	}
+	if c.RepositoryFormat == RepositoryFormatChunked || c.BackupMode == BackupModeIncremental {
+		return fmt.Errorf("'spanning' cannot be combined with 'repository_format: chunked' or 'backup_mode: incremental', which read earlier runs from the backup directory. Remedy: Use 'repository_format: split-tar' and 'backup_mode: full' for spanned backups.")
+	}
+	return nil
+}
+
+// BackupDestinations returns the directories every backup run is written to: the
+// entries of backup_directories, or backup_directory alone. The first one is the
+// backup directory of all other operations.
+func (c *Config) BackupDestinations() []string {
+	if len(c.BackupDirectories) > 0 {
+		return c.BackupDirectories
+	}
+	return []string{c.BackupDirectory}
+}
+
+// validateBackupDirectories checks backup_directories and every backup directory
+// given as a storage URL.
+func (c *Config) validateBackupDirectories() error {
+	if len(c.BackupDirectories) > 0 && c.BackupDirectory != c.BackupDirectories[0] {
+		return fmt.Errorf("Both 'backup_directory' and 'backup_directories' are set. Remedy: List every backup directory under 'backup_directories' and remove 'backup_directory'; the first entry is used for restore and the other operations.")
+	}
+	seen := make(map[string]bool)
+	for _, dir := range c.BackupDestinations() {
+		if strings.TrimSpace(dir) == "" {
+			return fmt.Errorf("'backup_directories' contains an empty entry. Remedy: Remove the empty entry or set a path, e.g. 'D:/Backups'.")
+		}
+		key := NormalizePathKey(dir)
+		if IsStorageURL(dir) {
+			key = CleanStoragePath(dir)
+		}
+		if seen[key] {
+			return fmt.Errorf("'backup_directories' lists %q more than once. Remedy: Remove the duplicate entry.", dir)
+		}
+		seen[key] = true
+		if err := c.validateStorageURL(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateStorageDirectory checks dir like a backup directory of c: a storage URL
+// must be of a supported type and complete. Local paths are not checked.
+func (c *Config) ValidateStorageDirectory(dir string) error {
+	return c.validateStorageURL(dir)
+}
+
+// validateStorageURL checks a backup directory given as a storage URL and the
+// settings of its storage.
+func (c *Config) validateStorageURL(dir string) error {
+	if !IsStorageURL(dir) {
+		return nil
+	}
+	scheme, rest, _ := strings.Cut(dir, ":")
+	switch strings.ToLower(scheme) {
+	case "s3":
+		if bucket, _, _ := strings.Cut(strings.TrimPrefix(rest, "//"), "/"); !strings.HasPrefix(rest, "//") || bucket == "" {
+			return fmt.Errorf("'backup_directory' %q names no bucket. Remedy: Use the form 's3://bucket/prefix'.", dir)
+		}
+		if c.S3.PartSizeMB < MinS3PartSizeMB {
+			return fmt.Errorf("Invalid 's3.part_size_mb': %d (minimum %d). Remedy: Set 's3.part_size_mb' to %d or higher; the default is %d.", c.S3.PartSizeMB, MinS3PartSizeMB, MinS3PartSizeMB, DefaultS3PartSizeMB)
+		}
+		if c.S3.Endpoint != "" {
+			if u, err := url.Parse(c.S3.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("Invalid 's3.endpoint': %q. Remedy: Set 's3.endpoint' to the base URL of the service, e.g. 'https://minio.example.com:9000'.", c.S3.Endpoint)
+			}
+		}
+	case "sftp":
+		u, err := url.Parse(dir)
+		if err != nil || u.User == nil || u.User.Username() == "" || u.Hostname() == "" {
+			return fmt.Errorf("'backup_directory' %q names no user or host. Remedy: Use the form 'sftp://user@host/path' or 'sftp://user@host:port/path'.", dir)
+		}
+		if _, hasPassword := u.User.Password(); hasPassword {
+			return fmt.Errorf("'backup_directory' %q contains a password. Remedy: Remove the password from the URL; SFTP access uses the key in 'sftp.private_key_file'.", u.Redacted())
+		}
+	case "dav", "davs":
+		u, err := url.Parse(dir)
+		if err != nil || u.Hostname() == "" {
+			return fmt.Errorf("'backup_directory' %q names no host. Remedy: Use the form 'davs://host/path', e.g. 'davs://cloud.example.com/remote.php/dav/files/name/Backups'.", dir)
+		}
+		if u.User != nil {
+			return fmt.Errorf("'backup_directory' %q contains credentials. Remedy: Remove them from the URL and set 'webdav.username' and 'webdav.password' instead.", u.Redacted())
+		}
+	default:
+		return fmt.Errorf("Unsupported 'backup_directory' %q: storage URLs of type %q are not supported. Remedy: Use a local or network path, or an s3://, sftp://, davs:// or dav:// URL.", dir, scheme)
+	}
+	return nil
+}
+
+// IsValidStreamName reports whether name can name the backup of a stream, which is
+// also the file name the stream is restored as.
+func IsValidStreamName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, "[]/\\:*?\"<>|")
+}
+
+func validateCommandSources(sources []CommandSource) error {
+	seen := make(map[string]bool)
+	for i, source := range sources {
+		name := strings.TrimSpace(source.Name)
+		if name == "" {
+			return fmt.Errorf("'command_sources' entry %d has no 'name'. Remedy: Give every command source a name, e.g. 'crm.dump'; it names the backup and the restored file.", i+1)
+		}
+		if name != source.Name || !IsValidStreamName(name) {
+			return fmt.Errorf("Invalid 'command_sources' name %q. Remedy: Use a plain file name without brackets, path separators or the characters : * ? \" < > |.", source.Name)
+		}
+		if seen[strings.ToLower(name)] {
+			return fmt.Errorf("Duplicate 'command_sources' name %q. Remedy: Give every command source a different name.", source.Name)
+		}
+		seen[strings.ToLower(name)] = true
+		if strings.TrimSpace(source.Command) == "" {
+			return fmt.Errorf("'command_sources' entry %q has no 'command'. Remedy: Set 'command' to the program whose output is backed up, e.g. 'C:/Program Files/PostgreSQL/16/bin/pg_dump.exe'.", source.Name)
+		}
+	}
 	return nil
 }
@@ -0,0 +1,129 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ConflictPolicy decides what happens when a restored file already exists at its target path.
+type ConflictPolicy string
+
+const (
+	// ConflictFail refuses to restore into an existing restore directory (default).
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictSkip keeps existing files.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictOverwrite replaces existing files.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictOverwriteNewer replaces existing files only when the backed-up file is newer.
+	ConflictOverwriteNewer ConflictPolicy = "overwrite-newer"
+	// ConflictRename restores next to existing files under a name with a " (restored N)" suffix.
+	ConflictRename ConflictPolicy = "rename"
+)
+
+// ConflictPolicyNames lists the accepted policy names in display order.
+var ConflictPolicyNames = []string{
+	string(ConflictFail),
+	string(ConflictSkip),
+	string(ConflictOverwrite),
+	string(ConflictOverwriteNewer),
+	string(ConflictRename),
+}
+
+// ParseConflictPolicy converts user input into a ConflictPolicy. An empty value selects ConflictFail.
+func ParseConflictPolicy(value string) (ConflictPolicy, error) {
+	normalized := strings.ToLower(strings.TrimSpace(value))
+	if normalized == "" {
+		return ConflictFail, nil
+	}
+	for _, name := range ConflictPolicyNames {
+		if normalized == name {
+			return ConflictPolicy(name), nil
+		}
+	}
+	return "", fmt.Errorf("Unknown conflict policy %q. Remedy: Use one of: %s.", value, strings.Join(ConflictPolicyNames, ", "))
+}
+
+// AllowsExisting reports whether the policy permits restoring into an existing directory.
+func (p ConflictPolicy) AllowsExisting() bool {
+	return p != "" && p != ConflictFail
+}
+
+// ConflictAction is the outcome of a conflict decision.
+type ConflictAction string
+
+const (
+	ConflictActionSkipped     ConflictAction = "skipped"
+	ConflictActionOverwritten ConflictAction = "overwritten"
+	ConflictActionRenamed     ConflictAction = "renamed"
+)
+
+// ConflictDecision records how one conflicting archive entry was handled.
+type ConflictDecision struct {
+	Path      string // archive entry path
+	Target    string // existing file on disk
+	Action    ConflictAction
+	RenamedTo string // final path when Action is ConflictActionRenamed
+	Reason    string
+}
+
+// resolveConflict decides how to restore an archive file whose target already exists.
+// It returns the path to write to, or an empty path when the entry must be skipped.
+func resolveConflict(policy ConflictPolicy, name, target string, existing os.FileInfo, archiveModTime time.Time) (string, ConflictDecision, error) {
+	decision := ConflictDecision{Path: name, Target: target}
+	if existing.IsDir() {
+		return "", decision, fmt.Errorf("Cannot restore file %q: a directory with the same name exists at %q. Remedy: Rename or move the existing directory and restore again.", name, target)
+	}
+
+	switch policy {
+	case ConflictSkip:
+		decision.Action = ConflictActionSkipped
+		decision.Reason = "existing file kept"
+		return "", decision, nil
+	case ConflictOverwrite:
+		decision.Action = ConflictActionOverwritten
+		return target, decision, nil
+	case ConflictOverwriteNewer:
+		backupTime := archiveModTime.Truncate(time.Second)
+		existingTime := existing.ModTime().Truncate(time.Second)
+		if !backupTime.After(existingTime) {
+			decision.Action = ConflictActionSkipped
+			decision.Reason = "existing file is not older than the backup"
+			return "", decision, nil
+		}
+		decision.Action = ConflictActionOverwritten
+		decision.Reason = "backup is newer"
+		return target, decision, nil
+	case ConflictRename:
+		renamed, err := nextFreeRestoreName(target)
+		if err != nil {
+			return "", decision, err
+		}
+		decision.Action = ConflictActionRenamed
+		decision.RenamedTo = renamed
+		return renamed, decision, nil
+	}
+	return "", decision, fmt.Errorf("File %q already exists at %q. Remedy: Choose a conflict policy (%s) or restore to a different destination.", name, target, strings.Join(ConflictPolicyNames[1:], ", "))
+}
+
+// nextFreeRestoreName returns "name (restored).ext", "name (restored 2).ext", ... for the first unused name.
+func nextFreeRestoreName(target string) (string, error) {
+	ext := filepath.Ext(target)
+	base := strings.TrimSuffix(target, ext)
+	for i := 1; i < 10000; i++ {
+		suffix := " (restored)"
+		if i > 1 {
+			suffix = fmt.Sprintf(" (restored %d)", i)
+		}
+		candidate := base + suffix + ext
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate, nil
+		} else if err != nil {
+			return "", fmt.Errorf("Failed to check restore target %q: %w", candidate, err)
+		}
+	}
+	return "", fmt.Errorf("No free name found to restore %q next to the existing file. Remedy: Clean up earlier restored copies or restore to a different destination.", target)
+}
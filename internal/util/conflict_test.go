@@ -0,0 +1,50 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseConflictPolicy(t *testing.T) {
+	t.Parallel()
+
+	for input, want := range map[string]ConflictPolicy{
+		"":                 ConflictFail,
+		"skip":             ConflictSkip,
+		"OVERWRITE":        ConflictOverwrite,
+		" overwrite-newer": ConflictOverwriteNewer,
+		"rename":           ConflictRename,
+	} {
+		got, err := ParseConflictPolicy(input)
+		if err != nil || got != want {
+			t.Fatalf("ParseConflictPolicy(%q): expected %q, got %q (err=%v)", input, want, got, err)
+		}
+	}
+	if _, err := ParseConflictPolicy("merge"); err == nil {
+		t.Fatal("expected error for unknown policy, got nil")
+	}
+	if ConflictFail.AllowsExisting() || !ConflictSkip.AllowsExisting() {
+		t.Fatal("unexpected AllowsExisting result")
+	}
+}
+
+func TestNextFreeRestoreNameCountsUp(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "report.xlsx")
+	for _, name := range []string{"report.xlsx", "report (restored).xlsx"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o600); err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+	}
+
+	got, err := nextFreeRestoreName(target)
+	if err != nil {
+		t.Fatalf("nextFreeRestoreName returned error: %v", err)
+	}
+	if want := filepath.Join(dir, "report (restored 2).xlsx"); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
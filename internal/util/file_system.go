@@ -22,6 +22,45 @@ func ValidateSourceDirectory(resolved string) error {
 	return nil
 }
 
+// ValidateSource checks that resolved is an accessible, readable directory or regular file.
+// Single files, such as containers or mail archives, are backed up as one archive entry.
+func ValidateSource(resolved string) error {
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return fmt.Errorf("Not found or inaccessible: %w. Remedy: Check the path in config.yaml and use forward slashes on Windows (e.g. C:/Users/Name/Documents).", err)
+	}
+	if info.IsDir() {
+		return ValidateSourceDirectory(resolved)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("Path is neither a directory nor a regular file. Remedy: Provide a directory or file path; devices, pipes and sockets cannot be backed up.")
+	}
+	f, err := os.Open(resolved)
+	if err != nil {
+		return fmt.Errorf("File not readable: %w. Remedy: Check permissions and ensure this user can read the file; close programs that lock it.", err)
+	}
+	return f.Close()
+}
+
+// IsRegularFile reports whether path is an existing regular file.
+func IsRegularFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// SourceSizeBytes returns the size of a single-file source or, for a directory,
+// the total size of its regular files.
+func SourceSizeBytes(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	if info.Mode().IsRegular() {
+		return info.Size(), nil
+	}
+	return DirectorySizeBytes(path)
+}
+
 // DirectorySizeBytes returns the total size of regular files under root.
 // Symlinks are skipped to avoid traversing external locations.
 func DirectorySizeBytes(root string) (int64, error) {
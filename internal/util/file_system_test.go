@@ -65,3 +65,28 @@ func TestDirectorySizeBytesMissingPathReturnsError(t *testing.T) {
 		t.Fatal("expected error for missing path, got nil")
 	}
 }
+
+func TestValidateSourceAcceptsRegularFileAndDirectory(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	filePath := filepath.Join(root, "vault.hc")
+	if err := os.WriteFile(filePath, []byte("container"), 0o600); err != nil {
+		t.Fatalf("failed to create file: %v", err)
+	}
+
+	if err := ValidateSource(root); err != nil {
+		t.Fatalf("expected directory to be accepted, got: %v", err)
+	}
+	if err := ValidateSource(filePath); err != nil {
+		t.Fatalf("expected regular file to be accepted, got: %v", err)
+	}
+	if err := ValidateSource(filepath.Join(root, "missing")); err == nil || !strings.Contains(err.Error(), "Remedy:") {
+		t.Fatalf("expected missing-path error with remedy, got: %v", err)
+	}
+
+	size, err := SourceSizeBytes(filePath)
+	if err != nil || size != int64(len("container")) {
+		t.Fatalf("expected file size %d, got %d, %v", len("container"), size, err)
+	}
+}
@@ -45,6 +45,16 @@ func FormatInsufficientRestoreSpaceMessage(neededBytes, availableBytes uint64) s
 	)
 }
 
+// FormatInsufficientExportSpaceMessage returns a consistent message for
+// selected export data exceeding currently free space at the export file.
+func FormatInsufficientExportSpaceMessage(neededBytes, availableBytes uint64) string {
+	return fmt.Sprintf(
+		"Insufficient free space for export: needed %s, available %s. Remedy: Free disk space or choose a different export file location.",
+		FormatBytesBinary(neededBytes),
+		FormatBytesBinary(availableBytes),
+	)
+}
+
 // IsSpaceInsufficient reports whether the estimated byte count exceeds available free bytes.
 // Returns false when estimatedBytes is zero or negative (unknown estimate).
 func IsSpaceInsufficient(estimatedBytes int64, freeBytes uint64) bool {
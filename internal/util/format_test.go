@@ -44,6 +44,16 @@ func TestFormatInsufficientRestoreSpaceMessage(t *testing.T) {
 	}
 }
 
+func TestFormatInsufficientExportSpaceMessage(t *testing.T) {
+	t.Parallel()
+
+	got := FormatInsufficientExportSpaceMessage(2*1024*1024, 512*1024)
+	want := "Insufficient free space for export: needed 2.00 MB, available 512.00 KB. Remedy: Free disk space or choose a different export file location."
+	if got != want {
+		t.Fatalf("unexpected message: got %q want %q", got, want)
+	}
+}
+
 func TestIsSpaceInsufficient(t *testing.T) {
 	t.Parallel()
 
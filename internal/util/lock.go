@@ -24,7 +24,14 @@ type BackupLock struct {
 //
 // If the lock file cannot be created (e.g. read-only media), locking is skipped
 // and a no-op BackupLock is returned so the caller can always call Release().
+//
+// A storage URL (S3, SFTP, WebDAV) is not locked either: these services offer no
+// lock that ends with the process, so two runs writing to the same remote
+// directory are not prevented. The returned BackupLock is a no-op.
 func AcquireBackupLock(backupDir string) (*BackupLock, error) {
+	if IsStorageURL(backupDir) {
+		return &BackupLock{}, nil
+	}
 	lockPath := filepath.Join(backupDir, lockFileName)
 	f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o600)
 	if err != nil {
@@ -45,9 +45,9 @@ func NewLogger(logPath string, levelStr string) (*Logger, error) {
 	tempPath := filepath.Join(os.TempDir(), base)
 
 	// If the original log file already exists, copy it to temp first (for appending).
-	if _, err := os.Stat(logPath); err == nil {
+	if _, err := StorageFor(logPath).Stat(logPath); err == nil {
 		// File exists; copy it to temp.
-		data, err := os.ReadFile(logPath)
+		data, err := ReadStorageFile(logPath)
 		if err != nil {
 			// Warn but continue; we'll create a new log in temp.
 			fmt.Fprintf(os.Stderr, "Warning: Existing log file could not be read: %v. Remedy: Check read permissions for the target log file.\n", err)
@@ -107,7 +107,7 @@ func (l *Logger) Close() {
 			return
 		}
 		// Overwrite the original file with the complete temp log content.
-		if err := os.WriteFile(l.originalPath, data, 0o600); err != nil {
+		if err := WriteStorageFile(l.originalPath, data); err != nil {
 			fmt.Fprintf(os.Stderr, "Error writing log file to backup directory: %v. Remedy: Check backup directory write permissions.\n", err)
 			fmt.Fprintf(os.Stderr, "Log file is located in temp directory: %s\n", l.actualPath)
 			// Intentionally do not remove the temp file — it is the user's only copy.
@@ -0,0 +1,298 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// NameRules describes the file names a restore destination accepts.
+type NameRules struct {
+	// Windows escapes the characters < > : " | ? * \, control characters, trailing
+	// dots and spaces and reserved device names such as CON or NUL.
+	Windows bool
+	// FoldCase treats names that differ only in case as the same name.
+	FoldCase bool
+	// Compose writes decomposed (NFD) accented letters in their composed (NFC) form,
+	// so both forms of a name are treated as the same name.
+	Compose bool
+	// MaxNameLength is the longest path segment the destination accepts, counted in
+	// UTF-16 code units with Windows rules and in bytes otherwise. Zero means no limit.
+	MaxNameLength int
+}
+
+// TargetNameRules returns the NameRules of the operating system RestoreSafe runs on.
+func TargetNameRules() NameRules {
+	switch runtime.GOOS {
+	case "windows":
+		return NameRules{Windows: true, FoldCase: true, Compose: true, MaxNameLength: 255}
+	case "darwin":
+		return NameRules{FoldCase: true, Compose: true, MaxNameLength: 255}
+	}
+	return NameRules{MaxNameLength: 255}
+}
+
+// Reasons recorded in a NameMapping.
+const (
+	RenameInvalidCharacter = "invalid character"
+	RenameEscapeCharacter  = "escape character"
+	RenameTrailingDot      = "trailing dot or space"
+	RenameReservedName     = "reserved name"
+	RenameNormalization    = "Unicode normalization"
+	RenameTooLong          = "name too long"
+	RenameCollision        = "name collision"
+)
+
+// NameMapping records an archive path that is restored under a different name.
+type NameMapping struct {
+	Archive  string // path in the backup, with forward slashes
+	Restored string // path written, relative to the restore directory, with forward slashes
+	Reasons  []string
+}
+
+// NameMapper maps archive paths to names the restore destination accepts. A character
+// the destination does not accept is written as ~HH~, the hexadecimal value of its
+// byte, so UnescapeName returns the original name. Names that would collide with a
+// name restored before get a ~2, ~3, ... suffix, and over-long names are shortened
+// with a hash of the original name. Every changed name is recorded for the rename report.
+type NameMapper struct {
+	rules   NameRules
+	mapped  map[string]string // archive path -> restored path
+	taken   map[string]bool   // collision keys of the restored paths
+	renames []NameMapping
+}
+
+// NewNameMapper returns a NameMapper for a destination with the given rules.
+func NewNameMapper(rules NameRules) *NameMapper {
+	return &NameMapper{rules: rules, mapped: make(map[string]string), taken: make(map[string]bool)}
+}
+
+// Map returns the path, relative to the restore directory and with forward slashes,
+// that the archive path name is restored to. Parent directories are mapped first, so
+// the files of a renamed directory follow it. The same name always maps to the same path.
+func (m *NameMapper) Map(name string) string {
+	clean := path.Clean(name)
+	if clean == "." || clean == "/" {
+		return clean
+	}
+	if restored, ok := m.mapped[clean]; ok {
+		return restored
+	}
+
+	parent, base := "", clean
+	if i := strings.LastIndexByte(clean, '/'); i >= 0 {
+		parent = m.Map(clean[:i])
+		base = clean[i+1:]
+	}
+
+	segment, reasons := m.rules.mapSegment(base)
+	restored := path.Join(parent, segment)
+	key := m.collisionKey(restored)
+	if m.taken[key] {
+		restored = m.freeName(parent, segment)
+		key = m.collisionKey(restored)
+		reasons = append(reasons, RenameCollision)
+	}
+	m.taken[key] = true
+	m.mapped[clean] = restored
+	if len(reasons) > 0 {
+		m.renames = append(m.renames, NameMapping{Archive: clean, Restored: restored, Reasons: reasons})
+	}
+	return restored
+}
+
+// Renames returns the names changed by Map, in the order they were first mapped.
+// The files inside a renamed directory are not listed separately.
+func (m *NameMapper) Renames() []NameMapping {
+	return append([]NameMapping(nil), m.renames...)
+}
+
+// WriteReport writes the renames as tab-separated lines of archive path, restored path
+// and reasons. Paths holding a tab, line break or other control character are quoted.
+func (m *NameMapper) WriteReport(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "# Names changed during restore because they are not valid on this system.\n# Archive path\tRestored as\tReason\n"); err != nil {
+		return err
+	}
+	for _, r := range m.renames {
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", reportField(r.Archive), reportField(r.Restored), strings.Join(r.Reasons, ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func reportField(s string) string {
+	for _, r := range s {
+		if r < 0x20 || r == 0x7F {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+func (m *NameMapper) collisionKey(restored string) string {
+	if m.rules.FoldCase {
+		return strings.ToLower(restored)
+	}
+	return restored
+}
+
+// freeName returns the first unused path parent/stem~N.ext for segment, starting at N=2.
+func (m *NameMapper) freeName(parent, segment string) string {
+	stem, ext := splitExtension(segment)
+	for n := 2; ; n++ {
+		candidate := path.Join(parent, stem+"~"+strconv.Itoa(n)+ext)
+		if !m.taken[m.collisionKey(candidate)] {
+			return candidate
+		}
+	}
+}
+
+// mapSegment returns the name a single path segment is restored under and the reasons
+// it was changed, if any.
+func (r NameRules) mapSegment(name string) (string, []string) {
+	var reasons []string
+	mapped := name
+	if r.Compose {
+		if composed := composeLatin(mapped); composed != mapped {
+			mapped = composed
+			reasons = append(reasons, RenameNormalization)
+		}
+	}
+	if r.Windows {
+		var escaped []string
+		mapped, escaped = escapeWindowsName(mapped)
+		reasons = append(reasons, escaped...)
+	}
+	if r.MaxNameLength > 0 && r.nameLength(mapped) > r.MaxNameLength {
+		mapped = r.shorten(name, mapped)
+		reasons = append(reasons, RenameTooLong)
+	}
+	return mapped, reasons
+}
+
+func (r NameRules) nameLength(name string) int {
+	if r.Windows {
+		return len(utf16.Encode([]rune(name)))
+	}
+	return len(name)
+}
+
+// shorten truncates mapped to MaxNameLength, keeping a short extension and replacing
+// the cut-off part by ~ and the first 8 hex digits of the SHA-256 of the original name.
+func (r NameRules) shorten(original, mapped string) string {
+	sum := sha256.Sum256([]byte(original))
+	stem, ext := splitExtension(mapped)
+	if len(ext) > 16 {
+		stem, ext = mapped, ""
+	}
+	suffix := "~" + hex.EncodeToString(sum[:4]) + ext
+	for stem != "" && r.nameLength(stem+suffix) > r.MaxNameLength {
+		_, size := utf8.DecodeLastRuneInString(stem)
+		stem = stem[:len(stem)-size]
+	}
+	// Do not leave half of an escape sequence behind.
+	if i := strings.LastIndexByte(stem, '~'); i >= 0 && len(stem)-i < 4 {
+		stem = stem[:i]
+	}
+	return stem + suffix
+}
+
+// splitExtension splits name into stem and extension. A leading dot does not start an extension.
+func splitExtension(name string) (string, string) {
+	ext := path.Ext(name)
+	if ext == name {
+		return name, ""
+	}
+	return strings.TrimSuffix(name, ext), ext
+}
+
+// windowsReservedNames are device names Windows does not accept as a file name, with or without extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true, "CONIN$": true, "CONOUT$": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// escapeWindowsName escapes the characters of name that Windows does not accept.
+func escapeWindowsName(name string) (string, []string) {
+	var b strings.Builder
+	var reasons []string
+	note := func(reason string) {
+		for _, r := range reasons {
+			if r == reason {
+				return
+			}
+		}
+		reasons = append(reasons, reason)
+	}
+
+	trailing := len(strings.TrimRight(name, ". "))
+	for i, c := range name {
+		switch {
+		case c < 0x20 || strings.ContainsRune(`<>:"|?*\`, c):
+			writeNameEscape(&b, byte(c))
+			note(RenameInvalidCharacter)
+		case c == '~' && isNameEscape(name, i):
+			writeNameEscape(&b, '~')
+			note(RenameEscapeCharacter)
+		case i >= trailing:
+			writeNameEscape(&b, byte(c))
+			note(RenameTrailingDot)
+		default:
+			b.WriteRune(c)
+		}
+	}
+
+	escaped := b.String()
+	stem, _, _ := strings.Cut(escaped, ".")
+	stem = strings.TrimRight(stem, " ")
+	if windowsReservedNames[strings.ToUpper(stem)] {
+		last := len(stem) - 1
+		var rb strings.Builder
+		rb.WriteString(stem[:last])
+		writeNameEscape(&rb, stem[last])
+		rb.WriteString(escaped[last+1:])
+		escaped = rb.String()
+		note(RenameReservedName)
+	}
+	return escaped, reasons
+}
+
+func writeNameEscape(b *strings.Builder, c byte) {
+	fmt.Fprintf(b, "~%02X~", c)
+}
+
+// isNameEscape reports whether an escape sequence ~HH~ starts at index i of name.
+func isNameEscape(name string, i int) bool {
+	return i+3 < len(name) && name[i] == '~' && isHexDigit(name[i+1]) && isHexDigit(name[i+2]) && name[i+3] == '~'
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'A' && c <= 'F') || (c >= 'a' && c <= 'f')
+}
+
+// UnescapeName reverses the ~HH~ escapes of a name written by NameMapper.
+func UnescapeName(name string) string {
+	if !strings.Contains(name, "~") {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if isNameEscape(name, i) {
+			v, _ := strconv.ParseUint(name[i+1:i+3], 16, 8)
+			b.WriteByte(byte(v))
+			i += 3
+			continue
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,185 @@
+package util
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+var windowsRules = NameRules{Windows: true, FoldCase: true, Compose: true, MaxNameLength: 255}
+
+func TestNameMapperEscapesInvalidCharacters(t *testing.T) {
+	t.Parallel()
+
+	m := NewNameMapper(windowsRules)
+	cases := map[string]string{
+		"report: 2026.txt":  "report~3A~ 2026.txt",
+		`a<b>c"d|e?f*g\h`:   "a~3C~b~3E~c~22~d~7C~e~3F~f~2A~g~5C~h",
+		"tab\there":         "tab~09~here",
+		"plain-name_1.txt":  "plain-name_1.txt",
+		"dir:1/file:2.json": "dir~3A~1/file~3A~2.json",
+	}
+	for name, want := range cases {
+		if got := m.Map(name); got != want {
+			t.Fatalf("Map(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestNameMapperEscapesTrailingDotsAndSpaces(t *testing.T) {
+	t.Parallel()
+
+	m := NewNameMapper(windowsRules)
+	if got := m.Map("notes."); got != "notes~2E~" {
+		t.Fatalf("expected the trailing dot to be escaped, got %q", got)
+	}
+	if got := m.Map("draft . "); got != "draft~20~~2E~~20~" {
+		t.Fatalf("expected all trailing dots and spaces to be escaped, got %q", got)
+	}
+	if got := m.Map("v1.2 final.txt"); got != "v1.2 final.txt" {
+		t.Fatalf("expected inner dots and spaces to be kept, got %q", got)
+	}
+}
+
+func TestNameMapperEscapesReservedNames(t *testing.T) {
+	t.Parallel()
+
+	m := NewNameMapper(windowsRules)
+	cases := map[string]string{
+		"CON":         "CO~4E~",
+		"nul.txt":     "nu~6C~.txt",
+		"com1.tar.gz": "com~31~.tar.gz",
+		"LPT9":        "LPT~39~",
+		"CONSOLE.txt": "CONSOLE.txt",
+		"COM10":       "COM10",
+		"aux/file":    "au~78~/file",
+	}
+	for name, want := range cases {
+		if got := m.Map(name); got != want {
+			t.Fatalf("Map(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestNameMapperEscapesLiteralEscapeSequences(t *testing.T) {
+	t.Parallel()
+
+	m := NewNameMapper(windowsRules)
+	if got := m.Map("a~3A~b"); got != "a~7E~3A~b" {
+		t.Fatalf("expected a literal escape sequence to be escaped, got %q", got)
+	}
+	if got := m.Map("backup~1.txt"); got != "backup~1.txt" {
+		t.Fatalf("expected a tilde outside an escape sequence to be kept, got %q", got)
+	}
+}
+
+func TestUnescapeNameReversesEscapes(t *testing.T) {
+	t.Parallel()
+
+	m := NewNameMapper(windowsRules)
+	for _, name := range []string{"a:b", "CON", "x~41~y", "end. ", `q"uote?`, "lpt1.log", "~7E~"} {
+		mapped := m.Map(name)
+		if got := UnescapeName(mapped); got != name {
+			t.Fatalf("UnescapeName(%q) = %q, want %q", mapped, got, name)
+		}
+	}
+}
+
+func TestNameMapperResolvesCaseCollisions(t *testing.T) {
+	t.Parallel()
+
+	m := NewNameMapper(windowsRules)
+	if got := m.Map("Docs/README.md"); got != "Docs/README.md" {
+		t.Fatalf("unexpected first name %q", got)
+	}
+	if got := m.Map("Docs/readme.md"); got != "Docs/readme~2.md" {
+		t.Fatalf("expected a case-only collision to get a suffix, got %q", got)
+	}
+	if got := m.Map("docs/other.txt"); got != "docs~2/other.txt" {
+		t.Fatalf("expected a colliding directory and its files to get a suffix, got %q", got)
+	}
+	if got := m.Map("Docs/README.md"); got != "Docs/README.md" {
+		t.Fatalf("expected a name to map to the same path again, got %q", got)
+	}
+
+	sensitive := NewNameMapper(NameRules{})
+	sensitive.Map("README.md")
+	if got := sensitive.Map("readme.md"); got != "readme.md" {
+		t.Fatalf("expected case-sensitive rules to keep both names, got %q", got)
+	}
+}
+
+func TestNameMapperComposesDecomposedNames(t *testing.T) {
+	t.Parallel()
+
+	nfd := "Cafe\u0301 Mu\u0308ller.txt"
+	nfc := "Caf\u00e9 M\u00fcller.txt"
+	m := NewNameMapper(windowsRules)
+	if got := m.Map(nfd); got != nfc {
+		t.Fatalf("expected the decomposed name in composed form, got %q", got)
+	}
+	if got := m.Map(nfc); got != "Caf\u00e9 M\u00fcller~2.txt" {
+		t.Fatalf("expected the composed twin to collide, got %q", got)
+	}
+
+	plain := NewNameMapper(NameRules{})
+	if got := plain.Map(nfd); got != nfd {
+		t.Fatalf("expected the name to be kept without Compose, got %q", got)
+	}
+}
+
+func TestNameMapperShortensLongNames(t *testing.T) {
+	t.Parallel()
+
+	long := strings.Repeat("ä", 200) + ".txt" // 400 bytes, 204 UTF-16 code units
+	linux := NewNameMapper(NameRules{MaxNameLength: 255})
+	got := linux.Map("dir/" + long)
+	base := strings.TrimPrefix(got, "dir/")
+	if len(base) > 255 || !strings.HasSuffix(base, ".txt") || !strings.Contains(base, "~") {
+		t.Fatalf("expected a name of at most 255 bytes keeping the extension, got %q (%d bytes)", base, len(base))
+	}
+	if other := linux.Map("dir/" + strings.Repeat("ä", 199) + "b.txt"); other == got {
+		t.Fatalf("expected different long names to stay different, both mapped to %q", got)
+	}
+
+	windows := NewNameMapper(windowsRules)
+	if got := windows.Map(long); got != long {
+		t.Fatalf("expected %d UTF-16 code units to fit on Windows, got %q", len(utf16.Encode([]rune(long))), got)
+	}
+	tooLong := strings.Repeat("x", 300)
+	if got := windows.Map(tooLong); len(got) != 255 {
+		t.Fatalf("expected the name to be shortened to 255 characters, got %d", len(got))
+	}
+}
+
+func TestNameMapperReportsRenames(t *testing.T) {
+	t.Parallel()
+
+	m := NewNameMapper(windowsRules)
+	m.Map("data/CON/a:b.txt")
+	m.Map("data/CON/ok.txt")
+	m.Map("Data/x.txt")
+
+	renames := m.Renames()
+	if len(renames) != 3 {
+		t.Fatalf("expected 3 renames, got %+v", renames)
+	}
+	if renames[0].Archive != "data/CON" || renames[0].Restored != "data/CO~4E~" || renames[0].Reasons[0] != RenameReservedName {
+		t.Fatalf("unexpected directory rename %+v", renames[0])
+	}
+	if renames[1].Restored != "data/CO~4E~/a~3A~b.txt" || renames[1].Reasons[0] != RenameInvalidCharacter {
+		t.Fatalf("unexpected file rename %+v", renames[1])
+	}
+	if renames[2].Archive != "Data" || renames[2].Restored != "Data~2" || renames[2].Reasons[0] != RenameCollision {
+		t.Fatalf("unexpected collision rename %+v", renames[2])
+	}
+
+	var report bytes.Buffer
+	if err := m.WriteReport(&report); err != nil {
+		t.Fatalf("WriteReport failed: %v", err)
+	}
+	if !strings.Contains(report.String(), "data/CON/a:b.txt\tdata/CO~4E~/a~3A~b.txt\tinvalid character\n") {
+		t.Fatalf("unexpected report:\n%s", report.String())
+	}
+}
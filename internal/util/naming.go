@@ -3,7 +3,16 @@
 // Naming scheme:
 //
 //	[SourceDirectoryName]_YYYY-MM-DD_ABC123-{Seq}.enc
+//	[SourceDirectoryName]_YYYY-MM-DD_ABC123-{Seq}.enc.partial  (part being written)
+//	[SourceDirectoryName]_YYYY-MM-DD_ABC123-{Seq}.enc.remnant  (unfinished part of an interrupted run being resumed)
 //	[SourceDirectoryName]_YYYY-MM-DD_ABC123.challenge  (YubiKey challenge file)
+//	[SourceDirectoryName]_YYYY-MM-DD_ABC123.manifest.enc  (encrypted manifest)
+//	[SourceDirectoryName]_YYYY-MM-DD_ABC123.run.json  (run metadata: full or incremental, parent)
+//	[SourceDirectoryName]_YYYY-MM-DD_ABC123.snapshot.enc  (encrypted snapshot of a chunked repository)
+//	repository/  (chunk packs and keys of the chunked repository format)
+//	YYYY-MM-DD_ABC123.incomplete  (run started or failed, not complete)
+//	YYYY-MM-DD_ABC123.complete  (run completed)
+//	YYYY-MM-DD_ABC123.checkpoint  (progress of an incomplete run, for resuming it)
 //
 // The backup ID (ABC123) is a random 6-character string drawn from [A-Z0-9].
 package util
@@ -63,6 +72,89 @@ func LogFileName(dir, date string, id BackupID) string {
 	return filepath.Join(dir, name)
 }
 
+// IncompleteRunFileName returns the path of the marker written to a backup
+// directory when a run starts, and to a backup directory that failed during a run
+// with several backup directories. It holds the reason, and the run's files in
+// that directory must not be relied on unless the run also has a completion marker.
+//
+//	{dir}/YYYY-MM-DD_{id}.incomplete
+func IncompleteRunFileName(dir, date string, id BackupID) string {
+	name := fmt.Sprintf("%s_%s%s", date, string(id), IncompleteRunFileSuffix)
+	return filepath.Join(dir, name)
+}
+
+// IncompleteRunFileSuffix is the file name suffix of incomplete-run markers.
+const IncompleteRunFileSuffix = ".incomplete"
+
+// CompleteRunFileName returns the path of the marker written once every backup set
+// of a run is complete.
+//
+//	{dir}/YYYY-MM-DD_{id}.complete
+func CompleteRunFileName(dir, date string, id BackupID) string {
+	name := fmt.Sprintf("%s_%s%s", date, string(id), CompleteRunFileSuffix)
+	return filepath.Join(dir, name)
+}
+
+// CompleteRunFileSuffix is the file name suffix of run-completion markers.
+const CompleteRunFileSuffix = ".complete"
+
+// CheckpointFileName returns the path of the checkpoint of an incomplete run. It
+// records the progress of the run so that an interrupted run can be resumed.
+//
+//	{dir}/YYYY-MM-DD_{id}.checkpoint
+func CheckpointFileName(dir, date string, id BackupID) string {
+	name := fmt.Sprintf("%s_%s%s", date, string(id), CheckpointFileSuffix)
+	return filepath.Join(dir, name)
+}
+
+// CheckpointFileSuffix is the file name suffix of run checkpoints.
+const CheckpointFileSuffix = ".checkpoint"
+
+// VolumeLabelFileName returns the path of the label a run spanning removable media
+// writes to each of its volumes (see MediaSpan).
+//
+//	{dir}/YYYY-MM-DD_{id}.volume
+func VolumeLabelFileName(dir, date string, id BackupID) string {
+	name := fmt.Sprintf("%s_%s%s", date, string(id), VolumeLabelFileSuffix)
+	return filepath.Join(dir, name)
+}
+
+// VolumeLabelFileSuffix is the file name suffix of volume labels.
+const VolumeLabelFileSuffix = ".volume"
+
+// runMarkerPattern matches:  {YYYY-MM-DD}_{ID}.incomplete, .complete, .checkpoint and .volume
+var runMarkerPattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})_([A-Z0-9]{6})(\.incomplete|\.complete|\.checkpoint|\.volume)$`)
+
+// ParseRunMarkerFileName tries to parse the name of a run marker, checkpoint or
+// volume label. suffix is IncompleteRunFileSuffix, CompleteRunFileSuffix,
+// CheckpointFileSuffix or VolumeLabelFileSuffix.
+func ParseRunMarkerFileName(basename string) (date string, id BackupID, suffix string, ok bool) {
+	m := runMarkerPattern.FindStringSubmatch(basename)
+	if m == nil {
+		return "", "", "", false
+	}
+	return m[1], BackupID(m[2]), m[3], true
+}
+
+// PartialFileSuffix is appended to the name of a part file while it is written.
+// Once the part is complete and synced, it is renamed to its final name.
+const PartialFileSuffix = ".partial"
+
+// PartialFileName returns the path a file is written to before it is renamed to path.
+func PartialFileName(path string) string {
+	return path + PartialFileSuffix
+}
+
+// RemnantFileSuffix is appended to the name of an unfinished part of an
+// interrupted run while the run is resumed. The resumed run must write the same
+// bytes again before the remnant is deleted.
+const RemnantFileSuffix = ".remnant"
+
+// RemnantFileName returns the path an unfinished part is kept at while its run is resumed.
+func RemnantFileName(path string) string {
+	return path + RemnantFileSuffix
+}
+
 // ChallengeFileName returns the path for the YubiKey challenge file.
 //
 //	{dir}/[directoryName]_YYYY-MM-DD_{id}.challenge
@@ -71,6 +163,44 @@ func ChallengeFileName(dir, directoryName, date string, id BackupID) string {
 	return filepath.Join(dir, name)
 }
 
+// ManifestFileName returns the path for the encrypted manifest of a backup directory.
+//
+//	{dir}/[directoryName]_YYYY-MM-DD_{id}.manifest.enc
+func ManifestFileName(dir, directoryName, date string, id BackupID) string {
+	name := fmt.Sprintf("[%s]_%s_%s%s", directoryName, date, string(id), ManifestFileSuffix)
+	return filepath.Join(dir, name)
+}
+
+// ManifestFileSuffix is the file name suffix of encrypted manifests.
+const ManifestFileSuffix = ".manifest.enc"
+
+// RunInfoFileName returns the path for the plain-text run metadata of a backup directory.
+//
+//	{dir}/[directoryName]_YYYY-MM-DD_{id}.run.json
+func RunInfoFileName(dir, directoryName, date string, id BackupID) string {
+	name := fmt.Sprintf("[%s]_%s_%s%s", directoryName, date, string(id), RunInfoFileSuffix)
+	return filepath.Join(dir, name)
+}
+
+// RunInfoFileSuffix is the file name suffix of run metadata files.
+const RunInfoFileSuffix = ".run.json"
+
+// SnapshotFileName returns the path for the encrypted snapshot of a backup directory
+// stored in the chunked repository format.
+//
+//	{dir}/[directoryName]_YYYY-MM-DD_{id}.snapshot.enc
+func SnapshotFileName(dir, directoryName, date string, id BackupID) string {
+	name := fmt.Sprintf("[%s]_%s_%s%s", directoryName, date, string(id), SnapshotFileSuffix)
+	return filepath.Join(dir, name)
+}
+
+// SnapshotFileSuffix is the file name suffix of repository snapshots.
+const SnapshotFileSuffix = ".snapshot.enc"
+
+// RepositoryDirName is the subdirectory of the backup directory that holds the
+// chunk packs of the chunked repository format.
+const RepositoryDirName = "repository"
+
 // BackupEntry represents one logical backup (all parts of one source directory).
 type BackupEntry struct {
 	DirectoryName string
@@ -116,6 +246,24 @@ func ParsePartFileName(basename string) (BackupEntry, int, bool) {
 	}, seq, true
 }
 
+// snapshotFilePattern matches:  [name]_{YYYY-MM-DD}_{ID}.snapshot.enc
+var snapshotFilePattern = regexp.MustCompile(
+	`^\[(.+?)\]_(\d{4}-\d{2}-\d{2})_([A-Z0-9]{6})\.snapshot\.enc$`,
+)
+
+// ParseSnapshotFileName tries to parse a .snapshot.enc filename.
+func ParseSnapshotFileName(basename string) (BackupEntry, bool) {
+	m := snapshotFilePattern.FindStringSubmatch(basename)
+	if m == nil {
+		return BackupEntry{}, false
+	}
+	return BackupEntry{
+		DirectoryName: m[1],
+		Date:          m[2],
+		ID:            BackupID(m[3]),
+	}, true
+}
+
 // DirectoryBaseName returns the last element of a path.
 func DirectoryBaseName(path string) string {
 	base := filepath.Base(strings.TrimRight(filepath.Clean(path), string(filepath.Separator)))
@@ -116,6 +116,23 @@ func TestLogAndChallengeFileName(t *testing.T) {
 	}
 }
 
+func TestSnapshotFileNameAndParseSnapshotFileNameRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	path := SnapshotFileName(t.TempDir(), "Photos [RAW]", "2026-03-15", BackupID("ZX9Q1P"))
+	entry, ok := ParseSnapshotFileName(filepath.Base(path))
+	if !ok {
+		t.Fatalf("expected snapshot file name %q to parse", filepath.Base(path))
+	}
+	want := BackupEntry{DirectoryName: "Photos [RAW]", Date: "2026-03-15", ID: BackupID("ZX9Q1P")}
+	if entry != want {
+		t.Fatalf("expected %#v, got %#v", want, entry)
+	}
+	if _, ok := ParseSnapshotFileName("[Photos]_2026-03-15_ZX9Q1P.manifest.enc"); ok {
+		t.Fatalf("expected a manifest file name not to parse as snapshot")
+	}
+}
+
 func TestDirectoryBaseName(t *testing.T) {
 	t.Parallel()
 
@@ -6,7 +6,11 @@ import (
 )
 
 // ResolveDir returns path unchanged if it is absolute, otherwise joins it with base.
+// A storage URL is returned in canonical form.
 func ResolveDir(path, base string) string {
+	if IsStorageURL(path) {
+		return CleanStoragePath(path)
+	}
 	if filepath.IsAbs(path) {
 		return path
 	}
@@ -0,0 +1,121 @@
+package util
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// PathSelector matches archive entry paths against user-supplied include patterns.
+//
+// Patterns use forward or backward slashes and are matched case-insensitively,
+// segment by segment, with the wildcards of path.Match (*, ?, [...]). A "**"
+// segment matches any number of path segments. A pattern that matches a
+// directory also selects everything below it, so "Projects/2025" restores the
+// whole subtree. A nil or empty selector matches every path.
+type PathSelector struct {
+	patterns []string
+	segments [][]string
+}
+
+// NewPathSelector compiles the given patterns. Blank patterns are ignored.
+func NewPathSelector(patterns []string) (*PathSelector, error) {
+	s := &PathSelector{}
+	for _, raw := range patterns {
+		normalized := normalizeSelectionPath(raw)
+		if normalized == "" {
+			continue
+		}
+		segments := strings.Split(strings.ToLower(normalized), "/")
+		for _, segment := range segments {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("Invalid file selection pattern %q: %w. Remedy: Check brackets and escape characters in the pattern.", raw, err)
+			}
+		}
+		s.patterns = append(s.patterns, normalized)
+		s.segments = append(s.segments, segments)
+	}
+	return s, nil
+}
+
+// ParseSelectionPatterns splits a semicolon-separated pattern list as entered at the prompt.
+func ParseSelectionPatterns(input string) []string {
+	patterns := make([]string, 0)
+	for _, part := range strings.Split(input, ";") {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			patterns = append(patterns, trimmed)
+		}
+	}
+	return patterns
+}
+
+// IsEmpty reports whether the selector matches everything.
+func (s *PathSelector) IsEmpty() bool {
+	return s == nil || len(s.segments) == 0
+}
+
+// Patterns returns the normalized patterns in input order.
+func (s *PathSelector) Patterns() []string {
+	if s == nil {
+		return nil
+	}
+	return s.patterns
+}
+
+// Match reports whether name (an archive entry path) or one of its parent
+// directories matches any pattern.
+func (s *PathSelector) Match(name string) bool {
+	if s.IsEmpty() {
+		return true
+	}
+	normalized := normalizeSelectionPath(name)
+	if normalized == "" {
+		return false
+	}
+	nameSegments := strings.Split(strings.ToLower(normalized), "/")
+	for _, patternSegments := range s.segments {
+		for end := len(nameSegments); end > 0; end-- {
+			if matchSegments(patternSegments, nameSegments[:end]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
+
+func normalizeSelectionPath(p string) string {
+	p = strings.TrimSpace(strings.ReplaceAll(p, "\\", "/"))
+	if p == "" {
+		return ""
+	}
+	p = path.Clean(p)
+	p = strings.TrimLeft(p, "/")
+	p = strings.TrimPrefix(p, "./")
+	if p == "." {
+		return ""
+	}
+	return p
+}
@@ -0,0 +1,72 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPathSelectorMatch(t *testing.T) {
+	t.Parallel()
+
+	selector, err := NewPathSelector([]string{`Reports\2025`, "*.xlsx", "photos/**/raw/*.cr3"})
+	if err != nil {
+		t.Fatalf("NewPathSelector returned error: %v", err)
+	}
+
+	cases := []struct {
+		name string
+		want bool
+	}{
+		{name: "Reports/2025", want: true},
+		{name: "reports/2025/q1/summary.pdf", want: true},
+		{name: "Reports/2024/summary.pdf", want: false},
+		{name: "Budget.XLSX", want: true},
+		{name: "finance/budget.xlsx", want: false},
+		{name: "Photos/raw/a.cr3", want: true},
+		{name: "Photos/2025/trip/raw/b.cr3", want: true},
+		{name: "Photos/2025/trip/b.cr3", want: false},
+	}
+	for _, tc := range cases {
+		if got := selector.Match(tc.name); got != tc.want {
+			t.Errorf("Match(%q): expected %v, got %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestPathSelectorEmptyMatchesEverything(t *testing.T) {
+	t.Parallel()
+
+	var nilSelector *PathSelector
+	if !nilSelector.IsEmpty() || !nilSelector.Match("any/file.txt") {
+		t.Fatal("expected nil selector to match everything")
+	}
+
+	selector, err := NewPathSelector([]string{"", "  ", "./"})
+	if err != nil {
+		t.Fatalf("NewPathSelector returned error: %v", err)
+	}
+	if !selector.IsEmpty() {
+		t.Fatalf("expected blank patterns to be ignored, got %v", selector.Patterns())
+	}
+}
+
+func TestNewPathSelectorRejectsInvalidPattern(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewPathSelector([]string{"reports/[2025"})
+	if err == nil {
+		t.Fatal("expected error for malformed pattern, got nil")
+	}
+	if !strings.Contains(err.Error(), "Invalid file selection pattern") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParseSelectionPatterns(t *testing.T) {
+	t.Parallel()
+
+	got := ParseSelectionPatterns(" Reports/2025 ;; *.xlsx;")
+	if len(got) != 2 || got[0] != "Reports/2025" || got[1] != "*.xlsx" {
+		t.Fatalf("unexpected patterns: %q", got)
+	}
+}
@@ -19,6 +19,10 @@ func TestResolveDir(t *testing.T) {
 	if got := ResolveDir(absolute, "ignored"); got != absolute {
 		t.Fatalf("expected absolute path unchanged, got %q", got)
 	}
+
+	if got := ResolveDir("s3://bucket/backups/", base); got != "s3://bucket/backups" {
+		t.Fatalf("expected storage URL unchanged, got %q", got)
+	}
 }
 
 func TestSameVolume(t *testing.T) {
@@ -0,0 +1,165 @@
+package util
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how reads and writes of part files are retried after a
+// transient error, such as a network share that briefly disconnects. The delay
+// before the first retry is InitialDelay; it doubles with every further retry up
+// to MaxDelay.
+type RetryPolicy struct {
+	// Attempts is the number of attempts of one operation, including the first;
+	// 1 disables retrying.
+	Attempts     int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+// DefaultRetryPolicy is used until SetIORetryPolicy is called.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:     DefaultIORetryAttempts,
+	InitialDelay: DefaultIORetryInitialDelayMS * time.Millisecond,
+	MaxDelay:     DefaultIORetryMaxDelayMS * time.Millisecond,
+}
+
+// Policy returns the retry policy configured by c.
+func (c IORetryConfig) Policy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:     c.Attempts,
+		InitialDelay: time.Duration(c.InitialDelayMS) * time.Millisecond,
+		MaxDelay:     time.Duration(c.MaxDelayMS) * time.Millisecond,
+	}
+}
+
+// IORetryTotals counts the retries of transient I/O errors.
+type IORetryTotals struct {
+	// Retries is the number of retries; Recovered and Failed count the operations
+	// that succeeded after retrying and those that still failed.
+	Retries   int64
+	Recovered int64
+	Failed    int64
+}
+
+var ioRetry = struct {
+	sync.RWMutex
+	policy RetryPolicy
+	log    *Logger
+
+	retries, recovered, failed atomic.Int64
+}{policy: DefaultRetryPolicy}
+
+// retrySleep waits before a retry; tests replace it.
+var retrySleep = time.Sleep
+
+// SetIORetryPolicy sets the retry policy of all part reads and writes.
+func SetIORetryPolicy(policy RetryPolicy) {
+	ioRetry.Lock()
+	defer ioRetry.Unlock()
+	ioRetry.policy = policy
+}
+
+// IORetryWatch logs the retries of one operation and counts them.
+type IORetryWatch struct {
+	previous *Logger
+}
+
+// WatchIORetries logs every retry of a part read or write to log and starts new
+// totals, until Stop is called.
+func WatchIORetries(log *Logger) *IORetryWatch {
+	ioRetry.Lock()
+	defer ioRetry.Unlock()
+	w := &IORetryWatch{previous: ioRetry.log}
+	ioRetry.log = log
+	ioRetry.retries.Store(0)
+	ioRetry.recovered.Store(0)
+	ioRetry.failed.Store(0)
+	return w
+}
+
+// Totals returns the retries since WatchIORetries.
+func (w *IORetryWatch) Totals() IORetryTotals {
+	return IORetryTotals{
+		Retries:   ioRetry.retries.Load(),
+		Recovered: ioRetry.recovered.Load(),
+		Failed:    ioRetry.failed.Load(),
+	}
+}
+
+// Stop ends logging the retries to the logger of the watch.
+func (w *IORetryWatch) Stop() {
+	ioRetry.Lock()
+	defer ioRetry.Unlock()
+	ioRetry.log = w.previous
+}
+
+// retryTransient handles err, the error of an operation described by what. While
+// err is transient and attempts are left, it waits and calls again, which repeats
+// the operation. It returns nil once again succeeds, or the last error.
+func retryTransient(what string, err error, again func() error) error {
+	if !IsTransientIOError(err) {
+		return err
+	}
+	ioRetry.RLock()
+	policy, log := ioRetry.policy, ioRetry.log
+	ioRetry.RUnlock()
+	if policy.Attempts <= 1 {
+		return err
+	}
+
+	delay := policy.InitialDelay
+	for attempt := 1; ; attempt++ {
+		if attempt >= policy.Attempts || !IsTransientIOError(err) {
+			ioRetry.failed.Add(1)
+			log.Warn("I/O error while %s persists after %d attempt(s): %v", what, attempt, err)
+			return err
+		}
+		log.Warn("Transient I/O error while %s (attempt %d of %d): %v. Retrying in %s.", what, attempt, policy.Attempts, err, delay)
+		ioRetry.retries.Add(1)
+		retrySleep(delay)
+		if delay *= 2; delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+		if err = again(); err == nil {
+			ioRetry.recovered.Add(1)
+			log.Info("Recovered from transient I/O error while %s after %d retry(s)", what, attempt)
+			return nil
+		}
+	}
+}
+
+// IsTransientIOError reports whether err is a network error that may go away when
+// the operation is repeated: a timeout, a reset or aborted connection, or a network
+// share or name that is not available for the moment.
+func IsTransientIOError(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	for _, errno := range []syscall.Errno{
+		syscall.ECONNRESET,
+		syscall.ECONNABORTED,
+		syscall.ETIMEDOUT,
+		syscall.ENETDOWN,
+		syscall.ENETUNREACH,
+		syscall.ENETRESET,
+		syscall.EHOSTUNREACH,
+	} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return isTransientPlatformError(err)
+}
@@ -0,0 +1,200 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// flakyStorage is a MemoryStorage whose next opens, reads and writes fail with a
+// connection reset; failed reads and writes transfer half of the requested bytes.
+type flakyStorage struct {
+	*MemoryStorage
+	failOpens, failReads, failWrites int
+}
+
+func (s *flakyStorage) Open(path string) (StorageFile, error) {
+	if s.failOpens > 0 {
+		s.failOpens--
+		return nil, &os.PathError{Op: "open", Path: path, Err: syscall.ECONNRESET}
+	}
+	f, err := s.MemoryStorage.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &flakyFile{StorageFile: f, storage: s}, nil
+}
+
+func (s *flakyStorage) Create(path string) (StorageWriter, error) {
+	w, err := s.MemoryStorage.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &flakyWriter{StorageWriter: w, storage: s}, nil
+}
+
+func (s *flakyStorage) Reopen(path string, size int64) (StorageWriter, error) {
+	data, err := ReadStorageFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) < size {
+		return nil, fmt.Errorf("the file holds %d of %d written bytes", len(data), size)
+	}
+	w, err := s.MemoryStorage.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data[:size]); err != nil {
+		return nil, err
+	}
+	return &flakyWriter{StorageWriter: w, storage: s}, nil
+}
+
+type flakyFile struct {
+	StorageFile
+	storage *flakyStorage
+}
+
+func (f *flakyFile) Read(p []byte) (int, error) {
+	if f.storage.failReads > 0 && len(p) > 1 {
+		f.storage.failReads--
+		n, _ := f.StorageFile.Read(p[:len(p)/2])
+		return n, &os.PathError{Op: "read", Path: "part", Err: syscall.ECONNRESET}
+	}
+	return f.StorageFile.Read(p)
+}
+
+type flakyWriter struct {
+	StorageWriter
+	storage *flakyStorage
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	if w.storage.failWrites > 0 && len(p) > 1 {
+		w.storage.failWrites--
+		n, _ := w.StorageWriter.Write(p[:len(p)/2])
+		return n, &os.PathError{Op: "write", Path: "part", Err: syscall.ECONNRESET}
+	}
+	return w.StorageWriter.Write(p)
+}
+
+// useRetryPolicy sets policy without waiting between retries for the test.
+func useRetryPolicy(t *testing.T, policy RetryPolicy) *IORetryWatch {
+	t.Helper()
+	previousSleep := retrySleep
+	retrySleep = func(time.Duration) {}
+	SetIORetryPolicy(policy)
+	watch := WatchIORetries(nil)
+	t.Cleanup(func() {
+		watch.Stop()
+		SetIORetryPolicy(DefaultRetryPolicy)
+		retrySleep = previousSleep
+	})
+	return watch
+}
+
+func TestSplitWriterAndReaderRetryTransientErrors(t *testing.T) {
+	watch := useRetryPolicy(t, RetryPolicy{Attempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	root := "flaky://" + t.Name()
+	s := &flakyStorage{MemoryStorage: NewMemoryStorage(), failWrites: 2}
+	t.Cleanup(MountStorage(root, s))
+
+	dir := filepath.Join(root, "parts")
+	w := NewWriter(func(seq int) string {
+		return filepath.Join(dir, fmt.Sprintf("data.part%d", seq))
+	}, 8)
+	payload := []byte("0123456789abcdefghij")
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	s.failReads = 2
+	r := NewSequentialReader(w.Paths())
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, payload) {
+		t.Fatalf("unexpected content %q, %v", got, err)
+	}
+
+	// The write of the first part fails again after it is reopened; each of the
+	// two reads recovers at once.
+	if totals := watch.Totals(); totals != (IORetryTotals{Retries: 4, Recovered: 3}) {
+		t.Fatalf("unexpected retry totals %+v", totals)
+	}
+}
+
+func TestSequentialReaderFailsWhenRetriesAreUsedUp(t *testing.T) {
+	watch := useRetryPolicy(t, RetryPolicy{Attempts: 2, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	root := "flaky://" + t.Name()
+	s := &flakyStorage{MemoryStorage: NewMemoryStorage()}
+	t.Cleanup(MountStorage(root, s))
+	path := filepath.Join(root, "data.part1")
+	if err := WriteStorageFile(path, []byte("0123456789")); err != nil {
+		t.Fatalf("failed to write part: %v", err)
+	}
+
+	s.failOpens = 5
+	r := NewSequentialReader([]string{path})
+	defer r.Close()
+	if _, err := io.ReadAll(r); !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("expected the connection reset, got %v", err)
+	}
+	if totals := watch.Totals(); totals.Retries != 1 || totals.Failed != 1 {
+		t.Fatalf("unexpected retry totals %+v", totals)
+	}
+}
+
+func TestLocalStorageReopenKeepsWrittenBytes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "part.partial")
+	if err := os.WriteFile(path, []byte("0123456789"), 0o600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	w, err := LocalStorage{}.Reopen(path, 4)
+	if err != nil {
+		t.Fatalf("Reopen returned error: %v", err)
+	}
+	if _, err := w.Write([]byte("xy")); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "0123xy" {
+		t.Fatalf("unexpected content %q", got)
+	}
+
+	// A file that lost bytes it had accepted cannot be continued.
+	if _, err := (LocalStorage{}).Reopen(path, 10); err == nil {
+		t.Fatal("expected Reopen to fail for a file shorter than the written bytes")
+	}
+}
+
+func TestIsTransientIOError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&os.PathError{Op: "read", Path: "p", Err: syscall.ECONNRESET}, true},
+		{fmt.Errorf("wrapped: %w", syscall.ETIMEDOUT), true},
+		{os.ErrDeadlineExceeded, true},
+		{&os.PathError{Op: "open", Path: "p", Err: syscall.ENOENT}, false},
+		{io.ErrUnexpectedEOF, false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := IsTransientIOError(c.err); got != c.want {
+			t.Fatalf("IsTransientIOError(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+//go:build windows
+
+package util
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// isTransientPlatformError reports whether err is a Windows error of a network
+// share that is briefly not available, e.g. while an SMB session reconnects.
+func isTransientPlatformError(err error) bool {
+	var errno windows.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	switch errno {
+	case windows.ERROR_NETNAME_DELETED,
+		windows.ERROR_BAD_NET_NAME,
+		windows.ERROR_BAD_NETPATH,
+		windows.ERROR_UNEXP_NET_ERR,
+		windows.ERROR_NETWORK_BUSY,
+		windows.ERROR_DEV_NOT_EXIST,
+		windows.ERROR_NET_WRITE_FAULT,
+		windows.ERROR_SEM_TIMEOUT,
+		windows.ERROR_VC_DISCONNECTED,
+		windows.ERROR_NETWORK_UNREACHABLE,
+		windows.ERROR_HOST_UNREACHABLE,
+		windows.ERROR_CONNECTION_ABORTED,
+		windows.ERROR_CONNECTION_INVALID:
+		return true
+	}
+	return false
+}
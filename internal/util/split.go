@@ -5,7 +5,6 @@ package util
 import (
 	"fmt"
 	"io"
-	"os"
 	"path/filepath"
 )
 
@@ -18,15 +17,33 @@ type NameFunc func(seq int) string
 
 // Writer writes data to a series of sequentially named files.
 // Each file is at most maxBytes bytes. When a file is full, it is closed and
-// the next file is opened transparently.
+// the next file is opened transparently. A part is written under its partial name
+// (see CreateAtomic) and gets its final name only once it is closed, so a crash
+// never leaves a truncated part under a part file name. Transient errors are
+// retried (see SetIORetryPolicy): a part that cannot be created is created again,
+// and a part whose write failed is reopened after the bytes written so far. With a
+// media span (see SetMediaSpan), a part also ends where the inserted medium is full.
 type Writer struct {
 	nameFunc     NameFunc
 	maxBytes     int64
 	seq          int
 	written      int64
-	current      *os.File
+	current      StorageWriter
 	paths        []string
 	onPartOpened func(seq int, path string)
+	onPartClosed func(seq int, path string, streamBytes int64)
+
+	// firstLimit and limit are the sizes of the first and later parts set by
+	// AlignParts; zero means maxBytes. headerSize and frameSize are its arguments.
+	firstLimit, limit     int64
+	headerSize, frameSize int64
+	// span is the media span of the run; volumeLimit is the size of the current
+	// part that still fits on the inserted medium, zero without a span.
+	span        *MediaSpan
+	volumeLimit int64
+	// streamBytes counts the bytes of the stream in all parts, including the parts
+	// passed to ResumeAfter.
+	streamBytes int64
 
 	fileWriteCalls int64
 	fileWriteBytes int64
@@ -58,6 +75,97 @@ func (s *Writer) SetPartOpenedHook(hook func(seq int, path string)) {
 	s.onPartOpened = hook
 }
 
+// SetPartClosedHook registers a callback invoked when a part file has been
+// completed under its final name. streamBytes is the size of all parts so far.
+func (s *Writer) SetPartClosedHook(hook func(seq int, path string, streamBytes int64)) {
+	if s == nil {
+		return
+	}
+	s.onPartClosed = hook
+}
+
+// AlignParts makes every part end at a frame boundary of a stream made of a
+// header of headerSize bytes and frames of frameSize bytes: the first part holds
+// the header and as many whole frames as fit into maxBytes, later parts as many
+// whole frames as fit. It returns false and keeps the part size when a part
+// cannot hold a single frame.
+func (s *Writer) AlignParts(headerSize, frameSize int64) bool {
+	if frameSize <= 0 || s.maxBytes-headerSize < frameSize {
+		return false
+	}
+	s.firstLimit = headerSize + (s.maxBytes-headerSize)/frameSize*frameSize
+	s.limit = s.maxBytes / frameSize * frameSize
+	s.headerSize, s.frameSize = headerSize, frameSize
+	return true
+}
+
+// SetMediaSpan makes the writer fill the media of span: a part ends where the
+// inserted medium is full, and the next part is written to the next medium. Parts
+// aligned by AlignParts stay aligned. A nil span is ignored.
+func (s *Writer) SetMediaSpan(span *MediaSpan) {
+	s.span = span
+}
+
+// ResumeAfter continues a stream whose first parts are already complete: paths
+// are these parts in order, and streamBytes is their total size. The next byte
+// written goes to part len(paths)+1.
+func (s *Writer) ResumeAfter(paths []string, streamBytes int64) {
+	s.seq = len(paths)
+	s.paths = append([]string(nil), paths...)
+	s.streamBytes = streamBytes
+}
+
+// partLimit returns the size of the current part.
+func (s *Writer) partLimit() int64 {
+	limit := s.limit
+	switch {
+	case s.limit == 0:
+		limit = s.maxBytes
+	case s.seq == 1:
+		limit = s.firstLimit
+	}
+	if s.volumeLimit > 0 && s.volumeLimit < limit {
+		return s.volumeLimit
+	}
+	return limit
+}
+
+// fitVolume limits the part about to be opened to the room left on the inserted
+// medium of the media span, and asks for the next medium when too little is left.
+func (s *Writer) fitVolume() error {
+	s.volumeLimit = 0
+	if s.span == nil {
+		return nil
+	}
+	minimum := min(s.partLimit(), s.span.minPart)
+	room := s.alignedRoom(s.span.remaining())
+	if room < minimum {
+		if err := s.span.NextVolume(); err != nil {
+			return err
+		}
+		if room = s.alignedRoom(s.span.remaining()); room < minimum {
+			return fmt.Errorf("The medium of volume %d has room for %s only. Remedy: Use larger media or lower 'spanning.reserve_mb'.", s.span.Volume(), FormatBytesBinary(uint64(room)))
+		}
+	}
+	s.volumeLimit = room
+	return nil
+}
+
+// alignedRoom returns the largest size up to room for the current part that ends
+// at a frame boundary set by AlignParts.
+func (s *Writer) alignedRoom(room int64) int64 {
+	switch {
+	case s.frameSize == 0:
+		return room
+	case s.seq == 1 && room < s.headerSize:
+		return 0
+	case s.seq == 1:
+		return s.headerSize + (room-s.headerSize)/s.frameSize*s.frameSize
+	default:
+		return room / s.frameSize * s.frameSize
+	}
+}
+
 // Write implements io.Writer. It splits data across files as needed.
 func (s *Writer) Write(p []byte) (int, error) {
 	if s.maxBytes <= 0 {
@@ -72,24 +180,22 @@ func (s *Writer) Write(p []byte) (int, error) {
 			}
 		}
 
-		remaining := s.maxBytes - s.written
+		limit := s.partLimit()
+		remaining := limit - s.written
 		n := int64(len(p))
 		if n > remaining {
 			n = remaining
 		}
 
-		written, err := s.current.Write(p[:n])
+		written, err := s.writePart(p[:n])
 		total += written
-		s.written += int64(written)
-		s.fileWriteCalls++
-		s.fileWriteBytes += int64(written)
 		p = p[written:]
 
 		if err != nil {
 			return total, fmt.Errorf("Failed to write to part file: %w", err)
 		}
 
-		if s.written >= s.maxBytes {
+		if s.written >= limit {
 			if err := s.closeCurrent(); err != nil {
 				return total, err
 			}
@@ -118,17 +224,62 @@ func (s *Writer) Stats() WriteStats {
 	}
 }
 
+// writePart writes b to the current part. After a transient error, the part is
+// reopened after the bytes written so far and the rest of b is written again.
+// Parts that cannot be reopened fail on the first error.
+func (s *Writer) writePart(b []byte) (int, error) {
+	total := 0
+	write := func() error {
+		n, err := s.current.Write(b[total:])
+		total += n
+		s.written += int64(n)
+		s.streamBytes += int64(n)
+		s.fileWriteCalls++
+		s.fileWriteBytes += int64(n)
+		s.span.add(int64(n))
+		return err
+	}
+	err := write()
+	if err == nil {
+		return total, nil
+	}
+	a, ok := s.current.(*AtomicWriter)
+	if !ok || !a.CanReopen() {
+		return total, err
+	}
+	what := fmt.Sprintf("writing part file %s", filepath.Base(s.paths[len(s.paths)-1]))
+	err = retryTransient(what, err, func() error {
+		if err := a.Reopen(s.written); err != nil {
+			return err
+		}
+		return write()
+	})
+	return total, err
+}
+
 func (s *Writer) openNext() error {
 	s.seq++
+	if err := s.fitVolume(); err != nil {
+		return err
+	}
 	path := filepath.Clean(s.nameFunc(s.seq))
+	storage := StorageFor(path)
 
-	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
-		return fmt.Errorf("Failed to create output directory: %w", err)
+	var f *AtomicWriter
+	create := func() error {
+		if err := storage.MkdirAll(filepath.Dir(path)); err != nil {
+			return fmt.Errorf("Failed to create output directory: %w", err)
+		}
+		var err error
+		if f, err = CreateAtomic(path); err != nil {
+			return fmt.Errorf("Failed to create part file %q: %w", path, err)
+		}
+		return nil
 	}
-
-	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
-	if err != nil {
-		return fmt.Errorf("Failed to create part file %q: %w", path, err)
+	if err := create(); err != nil {
+		if err := retryTransient(fmt.Sprintf("creating part file %s", filepath.Base(path)), err, create); err != nil {
+			return err
+		}
 	}
 
 	s.current = f
@@ -148,15 +299,27 @@ func (s *Writer) closeCurrent() error {
 	err := s.current.Close()
 	s.current = nil
 	s.partsClosed++
-	return err
+	if err != nil {
+		return fmt.Errorf("Failed to finalize part file: %w", err)
+	}
+	if s.onPartClosed != nil {
+		s.onPartClosed(s.seq, s.paths[len(s.paths)-1], s.streamBytes)
+	}
+	return nil
 }
 
 // SequentialReader joins multiple part files into a single io.Reader.
+// Transient errors are retried (see SetIORetryPolicy): a part whose read failed is
+// opened again and read on from the last offset read.
 type SequentialReader struct {
 	paths       []string
 	idx         int
-	current     *os.File
+	current     StorageFile
 	onFileOpen  func(partIndex, partTotal int) // called when a new part file is opened (1-based index)
+
+	pos    int64   // offset in the joined stream
+	offset int64   // offset in the current part
+	sizes  []int64 // part sizes, loaded on first Seek
 }
 
 // NewSequentialReader creates a reader that reads parts in order.
@@ -177,11 +340,12 @@ func (r *SequentialReader) Read(p []byte) (int, error) {
 			if r.idx >= len(r.paths) {
 				return 0, io.EOF
 			}
-			f, err := os.Open(r.paths[r.idx])
+			f, err := r.openPart(r.idx, 0)
 			if err != nil {
-				return 0, fmt.Errorf("Failed to open part file %q: %w. Remedy: Check that the part file exists and is readable.", r.paths[r.idx], err)
+				return 0, err
 			}
 			r.current = f
+			r.offset = 0
 			r.idx++
 			if r.onFileOpen != nil {
 				r.onFileOpen(r.idx, len(r.paths))
@@ -189,6 +353,13 @@ func (r *SequentialReader) Read(p []byte) (int, error) {
 		}
 
 		n, err := r.current.Read(p)
+		r.pos += int64(n)
+		r.offset += int64(n)
+		if err != nil && err != io.EOF && IsTransientIOError(err) {
+			if err = r.retryRead(err); err == nil && n == 0 {
+				continue
+			}
+		}
 		if err == io.EOF {
 			if closeErr := r.current.Close(); closeErr != nil {
 				r.current = nil
@@ -211,6 +382,127 @@ func (r *SequentialReader) Read(p []byte) (int, error) {
 	}
 }
 
+// Seek implements io.Seeker across all part files. Part sizes are read from
+// the file system on first use, so parts must not change while seeking.
+func (r *SequentialReader) Seek(offset int64, whence int) (int64, error) {
+	if err := r.loadSizes(); err != nil {
+		return r.pos, err
+	}
+
+	var total int64
+	for _, size := range r.sizes {
+		total += size
+	}
+
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = r.pos + offset
+	case io.SeekEnd:
+		target = total + offset
+	default:
+		return r.pos, fmt.Errorf("Invalid seek whence: %d", whence)
+	}
+	if target < 0 {
+		return r.pos, fmt.Errorf("Invalid seek to negative offset %d", target)
+	}
+	if target == r.pos {
+		return r.pos, nil
+	}
+
+	if r.current != nil {
+		if err := r.current.Close(); err != nil {
+			r.current = nil
+			return r.pos, fmt.Errorf("Failed to close part file: %w", err)
+		}
+		r.current = nil
+	}
+
+	var start int64
+	for i, size := range r.sizes {
+		if target < start+size {
+			f, err := r.openPart(i, target-start)
+			if err != nil {
+				return r.pos, err
+			}
+			r.current = f
+			r.offset = target - start
+			r.idx = i + 1
+			if r.onFileOpen != nil {
+				r.onFileOpen(r.idx, len(r.paths))
+			}
+			r.pos = target
+			return r.pos, nil
+		}
+		start += size
+	}
+
+	// Past the end: subsequent reads return io.EOF.
+	r.idx = len(r.paths)
+	r.pos = target
+	return r.pos, nil
+}
+
+// openPart opens part i at offset. Transient errors are retried.
+func (r *SequentialReader) openPart(i int, offset int64) (StorageFile, error) {
+	f, err := r.openPartAt(i, offset)
+	if err != nil {
+		err = retryTransient(fmt.Sprintf("opening part file %s", filepath.Base(r.paths[i])), err, func() error {
+			f, err = r.openPartAt(i, offset)
+			return err
+		})
+	}
+	return f, err
+}
+
+func (r *SequentialReader) openPartAt(i int, offset int64) (StorageFile, error) {
+	f, err := StorageFor(r.paths[i]).Open(r.paths[i])
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open part file %q: %w. Remedy: Check that the part file exists and is readable.", r.paths[i], err)
+	}
+	if offset > 0 {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close() //nolint:errcheck
+			return nil, fmt.Errorf("Failed to seek in part file %q: %w", r.paths[i], err)
+		}
+	}
+	return f, nil
+}
+
+// retryRead opens the current part again after the transient read error err and
+// continues at the offset read so far.
+func (r *SequentialReader) retryRead(err error) error {
+	i := r.idx - 1
+	r.current.Close() //nolint:errcheck
+	r.current = nil
+	return retryTransient(fmt.Sprintf("reading part file %s", filepath.Base(r.paths[i])), err, func() error {
+		f, err := r.openPartAt(i, r.offset)
+		if err != nil {
+			return err
+		}
+		r.current = f
+		return nil
+	})
+}
+
+func (r *SequentialReader) loadSizes() error {
+	if r.sizes != nil {
+		return nil
+	}
+	sizes := make([]int64, len(r.paths))
+	for i, path := range r.paths {
+		info, err := StorageFor(path).Stat(path)
+		if err != nil {
+			return fmt.Errorf("Failed to inspect part file %q: %w. Remedy: Check that the part file exists and is readable.", path, err)
+		}
+		sizes[i] = info.Size()
+	}
+	r.sizes = sizes
+	return nil
+}
+
 // Close closes any open file handle.
 func (r *SequentialReader) Close() error {
 	if r.current != nil {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -84,3 +85,146 @@ func TestSequentialReaderMissingPartFile(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 }
+
+func TestSequentialReaderSeekAcrossParts(t *testing.T) {
+	dir := t.TempDir()
+	nameFunc := func(seq int) string {
+		return filepath.Join(dir, fmt.Sprintf("part-%03d.bin", seq))
+	}
+
+	w := NewWriter(nameFunc, 4)
+	input := []byte("0123456789abcdef")
+	if _, err := w.Write(input); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	var opened []int
+	r := NewSequentialReader(w.Paths())
+	defer r.Close()
+	r.SetOnFileOpen(func(partIndex, _ int) { opened = append(opened, partIndex) })
+
+	cases := []struct {
+		offset int64
+		whence int
+		want   int64
+	}{
+		{offset: 9, whence: io.SeekStart, want: 9},
+		{offset: -6, whence: io.SeekCurrent, want: 5},
+		{offset: -3, whence: io.SeekEnd, want: 13},
+	}
+	for _, tc := range cases {
+		pos, err := r.Seek(tc.offset, tc.whence)
+		if err != nil {
+			t.Fatalf("Seek(%d, %d) returned error: %v", tc.offset, tc.whence, err)
+		}
+		if pos != tc.want {
+			t.Fatalf("Seek(%d, %d): expected position %d, got %d", tc.offset, tc.whence, tc.want, pos)
+		}
+		buf := make([]byte, 2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatalf("read after seek failed: %v", err)
+		}
+		if !bytes.Equal(buf, input[tc.want:tc.want+2]) {
+			t.Fatalf("unexpected data at offset %d: %q", tc.want, buf)
+		}
+	}
+
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll returned error: %v", err)
+	}
+	if string(rest) != "f" {
+		t.Fatalf("expected remaining data %q, got %q", "f", rest)
+	}
+	if len(opened) == 0 || opened[0] != 3 {
+		t.Fatalf("expected first opened part to be 3, got %v", opened)
+	}
+}
+
+func TestSplitWriterFinalizesPartsFromPartialFiles(t *testing.T) {
+	dir := t.TempDir()
+	nameFunc := func(seq int) string {
+		return filepath.Join(dir, fmt.Sprintf("part-%03d.bin", seq))
+	}
+
+	w := NewWriter(nameFunc, 5)
+	if _, err := w.Write([]byte("hello world")); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	// The third part is still open: it only exists under its partial name.
+	if _, err := os.Stat(PartialFileName(nameFunc(3))); err != nil {
+		t.Fatalf("expected the open part under its partial name: %v", err)
+	}
+	if _, err := os.Stat(nameFunc(3)); !os.IsNotExist(err) {
+		t.Fatalf("expected no final part file while it is written, got %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	partials, err := filepath.Glob(filepath.Join(dir, "*"+PartialFileSuffix))
+	if err != nil || len(partials) != 0 {
+		t.Fatalf("expected no partial files after Close, got %v, %v", partials, err)
+	}
+	for _, path := range w.Paths() {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("expected the finalized part %s: %v", filepath.Base(path), err)
+		}
+	}
+}
+
+func TestSplitWriterAlignsPartsToFramesAndResumes(t *testing.T) {
+	dir := t.TempDir()
+	nameFunc := func(seq int) string {
+		return filepath.Join(dir, fmt.Sprintf("part-%03d.bin", seq))
+	}
+
+	// A 2-byte header and 3-byte frames in parts of at most 8 bytes:
+	// part 1 holds the header and two frames, later parts two frames.
+	w := NewWriter(nameFunc, 8)
+	if !w.AlignParts(2, 3) {
+		t.Fatalf("AlignParts returned false for frames that fit")
+	}
+	var closed []int64
+	w.SetPartClosedHook(func(seq int, path string, streamBytes int64) {
+		closed = append(closed, streamBytes)
+	})
+	input := []byte("HHaaabbbcccdddee")
+	if _, err := w.Write(input); err != nil {
+		t.Fatalf("Write returned error: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+	if fmt.Sprint(closed) != "[8 14 16]" {
+		t.Fatalf("expected parts to close at 8, 14 and 16 bytes, got %v", closed)
+	}
+
+	// Resume after part 1 and write the rest again.
+	resumed := NewWriter(nameFunc, 8)
+	resumed.AlignParts(2, 3)
+	resumed.ResumeAfter(w.Paths()[:1], 8)
+	if _, err := resumed.Write(input[8:]); err != nil {
+		t.Fatalf("Write after resume returned error: %v", err)
+	}
+	if err := resumed.Close(); err != nil {
+		t.Fatalf("Close after resume returned error: %v", err)
+	}
+	if len(resumed.Paths()) != 3 {
+		t.Fatalf("expected 3 parts after resume, got %d", len(resumed.Paths()))
+	}
+	got, err := io.ReadAll(NewSequentialReader(resumed.Paths()))
+	if err != nil {
+		t.Fatalf("ReadAll returned error: %v", err)
+	}
+	if !bytes.Equal(got, input) {
+		t.Fatalf("expected %q after resume, got %q", input, got)
+	}
+
+	if NewWriter(nameFunc, 4).AlignParts(2, 3) {
+		t.Fatalf("AlignParts returned true although a frame does not fit")
+	}
+}
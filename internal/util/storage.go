@@ -0,0 +1,307 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Storage is the file system holding a backup directory. Paths are passed exactly as
+// they are built from backup_directory, e.g. with filepath.Join, so callers do not
+// need to know which Storage they use. Errors for missing files satisfy
+// errors.Is(err, fs.ErrNotExist).
+type Storage interface {
+	// List returns the entries of directory dir, sorted by name.
+	List(dir string) ([]fs.DirEntry, error)
+	// Stat returns information about the file or directory at path.
+	Stat(path string) (fs.FileInfo, error)
+	// Open opens the file at path for reading.
+	Open(path string) (StorageFile, error)
+	// Create creates or truncates the file at path for writing. On storages with
+	// directories, the parent directory must exist.
+	Create(path string) (StorageWriter, error)
+	// CreateNew is Create for a file that must not exist yet; it fails with
+	// fs.ErrExist otherwise.
+	CreateNew(path string) (StorageWriter, error)
+	// MkdirAll creates directory dir and any missing parents. Storages without
+	// directories accept it without doing anything.
+	MkdirAll(dir string) error
+	// Rename moves the file at oldPath to newPath, replacing an existing file.
+	Rename(oldPath, newPath string) error
+	// Remove deletes the file or empty directory at path.
+	Remove(path string) error
+	// FreeSpace returns the number of bytes available for new files in directory dir.
+	FreeSpace(dir string) (uint64, error)
+}
+
+// StorageFile is a file of a Storage opened for reading.
+type StorageFile interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+}
+
+// StorageWriter is a file of a Storage opened for writing. The file is complete
+// once Close returns without error; Sync commits the data written so far.
+type StorageWriter interface {
+	io.Writer
+	io.Closer
+	Sync() error
+}
+
+// LocalStorage is the Storage of local and mounted network paths.
+type LocalStorage struct{}
+
+func (LocalStorage) List(dir string) ([]fs.DirEntry, error) { return os.ReadDir(dir) }
+func (LocalStorage) Stat(path string) (fs.FileInfo, error)  { return os.Stat(path) }
+func (LocalStorage) Open(path string) (StorageFile, error)  { return os.Open(path) }
+func (LocalStorage) MkdirAll(dir string) error              { return os.MkdirAll(dir, 0o750) }
+func (LocalStorage) Rename(oldPath, newPath string) error   { return os.Rename(oldPath, newPath) }
+func (LocalStorage) Remove(path string) error               { return os.Remove(path) }
+func (LocalStorage) FreeSpace(dir string) (uint64, error)   { return QueryFreeSpaceBytes(dir) }
+
+func (s LocalStorage) Create(path string) (StorageWriter, error) {
+	return s.create(path, os.O_TRUNC)
+}
+
+func (s LocalStorage) CreateNew(path string) (StorageWriter, error) {
+	return s.create(path, os.O_EXCL)
+}
+
+func (LocalStorage) create(path string, flag int) (StorageWriter, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|flag, 0o600)
+}
+
+// Reopen opens the file at path again after a failed write. It fails when the file
+// lost some of the first size bytes, e.g. because a network share dropped data it
+// had accepted.
+func (LocalStorage) Reopen(path string, size int64) (StorageWriter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err == nil && info.Size() < size {
+		err = fmt.Errorf("the file holds %d of %d written bytes", info.Size(), size)
+	}
+	if err == nil {
+		err = f.Truncate(size)
+	}
+	if err == nil {
+		_, err = f.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		f.Close() //nolint:errcheck
+		return nil, err
+	}
+	return f, nil
+}
+
+var storageMounts = struct {
+	sync.RWMutex
+	roots map[string]Storage
+	// media are the MediaStorages mounted at local directories by MountMedia.
+	media map[string]Storage
+}{roots: make(map[string]Storage), media: make(map[string]Storage)}
+
+// MountStorage makes s the Storage of root, a URL such as mem://tests or
+// s3://bucket/prefix, and of every path below it. The returned function removes the mount.
+func MountStorage(root string, s Storage) func() {
+	root = CleanStoragePath(root)
+	storageMounts.Lock()
+	storageMounts.roots[root] = s
+	storageMounts.Unlock()
+	return func() {
+		storageMounts.Lock()
+		delete(storageMounts.roots, root)
+		storageMounts.Unlock()
+	}
+}
+
+// StorageFor returns the Storage that holds path: the mounted Storage for a storage
+// URL or a directory of removable media (see MountMedia), and LocalStorage for every
+// other path.
+func StorageFor(p string) Storage {
+	if !IsStorageURL(p) {
+		return localStorageFor(p)
+	}
+	clean := CleanStoragePath(p)
+	storageMounts.RLock()
+	defer storageMounts.RUnlock()
+	var found Storage
+	longest := -1
+	for root, s := range storageMounts.roots {
+		if (clean == root || strings.HasPrefix(clean, root+"/")) && len(root) > longest {
+			found, longest = s, len(root)
+		}
+	}
+	if found == nil {
+		return unmountedStorage{}
+	}
+	return found
+}
+
+// IsStorageURL reports whether p is a storage URL such as s3://bucket/prefix rather
+// than a local path. A URL needs scheme://; filepath.Join turns it into scheme:/ or
+// scheme:\, which is accepted too. Windows drive letters are not taken for a URL
+// scheme, and a relative path such as backup:old is not a URL.
+func IsStorageURL(p string) bool {
+	scheme, rest, ok := strings.Cut(p, ":")
+	if !ok || len(scheme) < 2 || !strings.HasPrefix(rest, "/") && !strings.HasPrefix(rest, `\`) {
+		return false
+	}
+	for i, c := range scheme {
+		letter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || !(c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.')) {
+			return false
+		}
+	}
+	return true
+}
+
+// CleanStoragePath returns p in canonical form. A storage URL is returned as
+// scheme://a/b with forward slashes, however filepath.Join has changed it; a
+// local path is cleaned with filepath.Clean.
+func CleanStoragePath(p string) string {
+	if !IsStorageURL(p) {
+		return filepath.Clean(p)
+	}
+	scheme, rest, _ := strings.Cut(p, ":")
+	rest = path.Clean("/" + strings.ReplaceAll(rest, `\`, "/"))
+	return strings.ToLower(scheme) + ":/" + rest
+}
+
+// unmountedStorage is returned for storage URLs without a mounted Storage.
+type unmountedStorage struct{}
+
+func (unmountedStorage) err(p string) error {
+	return fmt.Errorf("No storage is configured for %q. Remedy: Check backup_directory in config.yaml; use a local path or a supported storage URL.", p)
+}
+
+func (s unmountedStorage) List(dir string) ([]fs.DirEntry, error)    { return nil, s.err(dir) }
+func (s unmountedStorage) Stat(p string) (fs.FileInfo, error)        { return nil, s.err(p) }
+func (s unmountedStorage) Open(p string) (StorageFile, error)        { return nil, s.err(p) }
+func (s unmountedStorage) Create(p string) (StorageWriter, error)    { return nil, s.err(p) }
+func (s unmountedStorage) CreateNew(p string) (StorageWriter, error) { return nil, s.err(p) }
+func (s unmountedStorage) MkdirAll(dir string) error                 { return s.err(dir) }
+func (s unmountedStorage) Rename(oldPath, _ string) error            { return s.err(oldPath) }
+func (s unmountedStorage) Remove(p string) error                     { return s.err(p) }
+func (s unmountedStorage) FreeSpace(dir string) (uint64, error)      { return 0, s.err(dir) }
+
+// ReadStorageFile reads the whole file at path from its Storage.
+func ReadStorageFile(path string) ([]byte, error) {
+	f, err := StorageFor(path).Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// WriteStorageFile writes data to the file at path in its Storage, replacing an existing file.
+func WriteStorageFile(path string, data []byte) error {
+	w, err := StorageFor(path).Create(path)
+	if err != nil {
+		return err
+	}
+	_, writeErr := w.Write(data)
+	return errors.Join(writeErr, w.Close())
+}
+
+// AtomicStorage is implemented by Storages whose files appear under their name
+// only once Close has completed them, such as object storage uploads.
+type AtomicStorage interface {
+	CreatesAtomically() bool
+}
+
+// ReopenStorage is implemented by Storages that can open a file for writing again
+// after a write failed, so the write can be retried.
+type ReopenStorage interface {
+	// Reopen opens the file at path for writing, keeps its first size bytes and
+	// continues after them.
+	Reopen(path string, size int64) (StorageWriter, error)
+}
+
+// AtomicWriter writes a file that appears under its name only once Close has
+// completed it. Abort discards the file instead.
+type AtomicWriter struct {
+	StorageWriter
+	storage Storage
+	partial string
+	path    string
+	closed  bool
+}
+
+// CreateAtomic creates the file at path in its Storage so that path holds either
+// nothing or the complete file. The data is written to PartialFileName(path), and
+// Close syncs it and renames it to path. Storages that complete files atomically
+// themselves write path directly.
+func CreateAtomic(path string) (*AtomicWriter, error) {
+	s := StorageFor(path)
+	target := PartialFileName(path)
+	if a, ok := s.(AtomicStorage); ok && a.CreatesAtomically() {
+		target = path
+	}
+	w, err := s.Create(target)
+	if err != nil {
+		return nil, err
+	}
+	return &AtomicWriter{StorageWriter: w, storage: s, partial: target, path: path}, nil
+}
+
+// Close syncs the file and gives it its final name.
+func (w *AtomicWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := errors.Join(w.StorageWriter.Sync(), w.StorageWriter.Close())
+	if err == nil && w.partial != w.path {
+		err = w.storage.Rename(w.partial, w.path)
+	}
+	if err != nil {
+		w.storage.Remove(w.partial) //nolint:errcheck
+	}
+	return err
+}
+
+// CanReopen reports whether Reopen is supported: for files written under their
+// partial name on a Storage that implements ReopenStorage. Storages that complete
+// files atomically reconnect on their own.
+func (w *AtomicWriter) CanReopen() bool {
+	_, ok := w.storage.(ReopenStorage)
+	return ok && w.partial != w.path
+}
+
+// Reopen opens the file again after a failed write and continues after its first
+// size bytes, discarding anything written after them.
+func (w *AtomicWriter) Reopen(size int64) error {
+	r, ok := w.storage.(ReopenStorage)
+	if !ok {
+		return errors.ErrUnsupported
+	}
+	w.StorageWriter.Close() //nolint:errcheck
+	sw, err := r.Reopen(w.partial, size)
+	if err != nil {
+		return err
+	}
+	w.StorageWriter = sw
+	return nil
+}
+
+// Abort closes the file and deletes it.
+func (w *AtomicWriter) Abort() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	w.StorageWriter.Close()     //nolint:errcheck
+	w.storage.Remove(w.partial) //nolint:errcheck
+}
@@ -0,0 +1,234 @@
+package util
+
+import (
+	"bytes"
+	"io/fs"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStorage is a Storage that keeps its files in memory. Mounted with
+// MountStorage, it lets tests run backup and restore workflows without a backup
+// directory on disk.
+type MemoryStorage struct {
+	mu       sync.Mutex
+	files    map[string]*memoryFile
+	dirs     map[string]bool
+	capacity uint64
+}
+
+type memoryFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+// NewMemoryStorage returns an empty MemoryStorage with practically unlimited free space.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{files: make(map[string]*memoryFile), dirs: make(map[string]bool), capacity: math.MaxInt64}
+}
+
+// SetCapacity limits the total size of the files in s, as reported by FreeSpace.
+func (s *MemoryStorage) SetCapacity(bytes uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.capacity = bytes
+}
+
+func (s *MemoryStorage) List(dir string) ([]fs.DirEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dir = CleanStoragePath(dir)
+	if !s.isDir(dir) {
+		return nil, &fs.PathError{Op: "list", Path: dir, Err: fs.ErrNotExist}
+	}
+	children := make(map[string]fs.FileInfo)
+	prefix := dir + "/"
+	for name, f := range s.files {
+		if rest, ok := strings.CutPrefix(name, prefix); ok {
+			child, _, nested := strings.Cut(rest, "/")
+			if nested {
+				children[child] = memoryInfo{name: child, dir: true}
+			} else {
+				children[child] = memoryInfo{name: child, size: int64(len(f.data)), modTime: f.modTime}
+			}
+		}
+	}
+	for name := range s.dirs {
+		if rest, ok := strings.CutPrefix(name, prefix); ok {
+			child, _, _ := strings.Cut(rest, "/")
+			if _, exists := children[child]; !exists {
+				children[child] = memoryInfo{name: child, dir: true}
+			}
+		}
+	}
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, info := range children {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (s *MemoryStorage) Stat(path string) (fs.FileInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path = CleanStoragePath(path)
+	if f, ok := s.files[path]; ok {
+		return memoryInfo{name: baseName(path), size: int64(len(f.data)), modTime: f.modTime}, nil
+	}
+	if s.isDir(path) {
+		return memoryInfo{name: baseName(path), dir: true}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+}
+
+func (s *MemoryStorage) Open(path string) (StorageFile, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[CleanStoragePath(path)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	return memoryReader{bytes.NewReader(f.data)}, nil
+}
+
+func (s *MemoryStorage) Create(path string) (StorageWriter, error) {
+	return s.create(path, false)
+}
+
+func (s *MemoryStorage) CreateNew(path string) (StorageWriter, error) {
+	return s.create(path, true)
+}
+
+// create registers an empty file at path; the content becomes visible on Close.
+func (s *MemoryStorage) create(path string, exclusive bool) (StorageWriter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path = CleanStoragePath(path)
+	if _, exists := s.files[path]; exists && exclusive {
+		return nil, &fs.PathError{Op: "create", Path: path, Err: fs.ErrExist}
+	}
+	if s.dirs[path] {
+		return nil, &fs.PathError{Op: "create", Path: path, Err: fs.ErrInvalid}
+	}
+	s.files[path] = &memoryFile{modTime: time.Now()}
+	return &memoryWriter{storage: s, path: path}, nil
+}
+
+func (s *MemoryStorage) MkdirAll(dir string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirs[CleanStoragePath(dir)] = true
+	return nil
+}
+
+func (s *MemoryStorage) Rename(oldPath, newPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oldPath, newPath = CleanStoragePath(oldPath), CleanStoragePath(newPath)
+	f, ok := s.files[oldPath]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: oldPath, Err: fs.ErrNotExist}
+	}
+	delete(s.files, oldPath)
+	s.files[newPath] = f
+	return nil
+}
+
+func (s *MemoryStorage) Remove(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	path = CleanStoragePath(path)
+	if _, ok := s.files[path]; ok {
+		delete(s.files, path)
+		return nil
+	}
+	if !s.isDir(path) {
+		return &fs.PathError{Op: "remove", Path: path, Err: fs.ErrNotExist}
+	}
+	for name := range s.files {
+		if strings.HasPrefix(name, path+"/") {
+			return &fs.PathError{Op: "remove", Path: path, Err: fs.ErrExist}
+		}
+	}
+	delete(s.dirs, path)
+	return nil
+}
+
+func (s *MemoryStorage) FreeSpace(string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var used uint64
+	for _, f := range s.files {
+		used += uint64(len(f.data))
+	}
+	if used >= s.capacity {
+		return 0, nil
+	}
+	return s.capacity - used, nil
+}
+
+// isDir reports whether dir was created with MkdirAll or holds files. s.mu must be held.
+func (s *MemoryStorage) isDir(dir string) bool {
+	for name := range s.dirs {
+		if name == dir || strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	for name := range s.files {
+		if strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func baseName(path string) string {
+	return path[strings.LastIndexByte(path, '/')+1:]
+}
+
+type memoryReader struct {
+	*bytes.Reader
+}
+
+func (memoryReader) Close() error { return nil }
+
+type memoryWriter struct {
+	storage *MemoryStorage
+	path    string
+	buf     bytes.Buffer
+}
+
+func (w *memoryWriter) Write(p []byte) (int, error) { return w.buf.Write(p) }
+func (w *memoryWriter) Sync() error                 { return w.flush() }
+func (w *memoryWriter) Close() error                { return w.flush() }
+
+func (w *memoryWriter) flush() error {
+	w.storage.mu.Lock()
+	defer w.storage.mu.Unlock()
+	w.storage.files[w.path] = &memoryFile{data: bytes.Clone(w.buf.Bytes()), modTime: time.Now()}
+	return nil
+}
+
+type memoryInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i memoryInfo) Name() string       { return i.name }
+func (i memoryInfo) Size() int64        { return i.size }
+func (i memoryInfo) ModTime() time.Time { return i.modTime }
+func (i memoryInfo) IsDir() bool        { return i.dir }
+func (i memoryInfo) Sys() any           { return nil }
+
+func (i memoryInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0o750
+	}
+	return 0o600
+}
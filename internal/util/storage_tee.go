@@ -0,0 +1,341 @@
+package util
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// TeeStorage is a Storage that writes every file to several backup directories at
+// once. A path below its root stands for the same relative path in each directory.
+//
+// A directory whose operation fails is dropped for the rest of the run, and the
+// others continue; Failures reports the dropped directories. An operation fails
+// only when no directory is left, with the error of the last one, so a TeeStorage
+// of one directory behaves like that directory. Reads are served by the first
+// directory that has not failed.
+type TeeStorage struct {
+	root  string
+	dirs  []string
+	mu    sync.Mutex
+	fails []error
+}
+
+// errAllTeeDirsFailed is returned when every directory was dropped by earlier failures.
+var errAllTeeDirsFailed = errors.New("Every backup directory has failed. Remedy: See the earlier errors in the log file.")
+
+// TeeFailure is a backup directory dropped by a TeeStorage.
+type TeeFailure struct {
+	Dir string
+	Err error
+}
+
+// NewTeeStorage returns a TeeStorage for dirs whose paths start with root, a
+// storage URL such as tee://run. Mount it with MountStorage(root, s).
+func NewTeeStorage(root string, dirs []string) *TeeStorage {
+	return &TeeStorage{root: CleanStoragePath(root), dirs: dirs, fails: make([]error, len(dirs))}
+}
+
+// Failures returns the directories that failed, in configuration order.
+func (t *TeeStorage) Failures() []TeeFailure {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var failures []TeeFailure
+	for i, err := range t.fails {
+		if err != nil {
+			failures = append(failures, TeeFailure{Dir: t.dirs[i], Err: err})
+		}
+	}
+	return failures
+}
+
+// Failed reports whether dir has been dropped.
+func (t *TeeStorage) Failed(dir string) bool {
+	for _, failure := range t.Failures() {
+		if failure.Dir == dir {
+			return true
+		}
+	}
+	return false
+}
+
+// fail drops directory i after err; the first error is kept.
+func (t *TeeStorage) fail(i int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fails[i] == nil {
+		t.fails[i] = err
+	}
+}
+
+// isDropped reports whether directory i has failed.
+func (t *TeeStorage) isDropped(i int) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.fails[i] != nil
+}
+
+// healthy returns the indexes of the directories not dropped yet.
+func (t *TeeStorage) healthy() []int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var indexes []int
+	for i, err := range t.fails {
+		if err == nil {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// target returns the path of p in directory i.
+func (t *TeeStorage) target(i int, p string) (string, error) {
+	rest, ok := strings.CutPrefix(CleanStoragePath(p), t.root)
+	if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+		return "", fmt.Errorf("Path %s is not below %s.", p, t.root)
+	}
+	if rest == "" {
+		return t.dirs[i], nil
+	}
+	return filepath.Join(t.dirs[i], filepath.FromSlash(strings.TrimPrefix(rest, "/"))), nil
+}
+
+// isResult reports whether err answers the operation rather than showing that the
+// directory is unusable, like a missing file for Stat or an existing one for CreateNew.
+func isResult(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrExist)
+}
+
+// write runs op for path p in every healthy directory i. A result error such as a
+// missing file is returned only when op succeeded in no directory, so a file that is
+// already gone from one directory is still removed or renamed in the others.
+func (t *TeeStorage) write(p string, op func(i int, target string) error) error {
+	var result, last error
+	succeeded := false
+	for _, i := range t.healthy() {
+		target, err := t.target(i, p)
+		if err != nil {
+			return err
+		}
+		err = op(i, target)
+		switch {
+		case err == nil:
+			succeeded = true
+		case isResult(err):
+			if result == nil {
+				result = err
+			}
+		default:
+			t.fail(i, err)
+			last = err
+		}
+	}
+	if !succeeded {
+		return cmp.Or(result, last, errAllTeeDirsFailed)
+	}
+	return nil
+}
+
+// read runs op for path p in the first healthy directory that can answer it.
+func (t *TeeStorage) read(p string, op func(s Storage, target string) error) error {
+	var last error
+	for _, i := range t.healthy() {
+		target, err := t.target(i, p)
+		if err != nil {
+			return err
+		}
+		err = op(StorageFor(target), target)
+		if err == nil || isResult(err) {
+			return err
+		}
+		t.fail(i, err)
+		last = err
+	}
+	return cmp.Or(last, errAllTeeDirsFailed)
+}
+
+func (t *TeeStorage) List(dir string) (entries []fs.DirEntry, err error) {
+	err = t.read(dir, func(s Storage, target string) error {
+		entries, err = s.List(target)
+		return err
+	})
+	return entries, err
+}
+
+func (t *TeeStorage) Stat(p string) (info fs.FileInfo, err error) {
+	err = t.read(p, func(s Storage, target string) error {
+		info, err = s.Stat(target)
+		return err
+	})
+	return info, err
+}
+
+func (t *TeeStorage) Open(p string) (f StorageFile, err error) {
+	err = t.read(p, func(s Storage, target string) error {
+		f, err = s.Open(target)
+		return err
+	})
+	return f, err
+}
+
+func (t *TeeStorage) Create(p string) (StorageWriter, error) {
+	return t.create(p, Storage.Create)
+}
+
+func (t *TeeStorage) CreateNew(p string) (StorageWriter, error) {
+	return t.create(p, Storage.CreateNew)
+}
+
+// create opens p in every healthy directory. Unlike the other writes, it fails when
+// a single directory answers with a result error such as an existing file, so all
+// directories keep the same files. The files it created in the other directories
+// are then removed again, so no directory is left with a file the caller does not
+// know about.
+func (t *TeeStorage) create(p string, open func(Storage, string) (StorageWriter, error)) (StorageWriter, error) {
+	w := &teeWriter{tee: t}
+	var result error
+	err := t.write(p, func(i int, target string) error {
+		f, err := open(StorageFor(target), target)
+		if err == nil {
+			w.files = append(w.files, teeFile{dir: i, path: target, w: f})
+		} else if isResult(err) && result == nil {
+			result = err
+		}
+		return err
+	})
+	if err = cmp.Or(err, result); err != nil {
+		for _, f := range w.files {
+			f.w.Close()                       //nolint:errcheck
+			StorageFor(f.path).Remove(f.path) //nolint:errcheck
+		}
+		return nil, err
+	}
+	return w, nil
+}
+
+func (t *TeeStorage) MkdirAll(dir string) error {
+	return t.write(dir, func(_ int, target string) error { return StorageFor(target).MkdirAll(target) })
+}
+
+func (t *TeeStorage) Remove(p string) error {
+	return t.write(p, func(_ int, target string) error { return StorageFor(target).Remove(target) })
+}
+
+func (t *TeeStorage) Rename(oldPath, newPath string) error {
+	return t.write(oldPath, func(i int, oldTarget string) error {
+		newTarget, err := t.target(i, newPath)
+		if err != nil {
+			return err
+		}
+		return StorageFor(oldTarget).Rename(oldTarget, newTarget)
+	})
+}
+
+// CreatesAtomically reports whether every directory completes its files atomically.
+func (t *TeeStorage) CreatesAtomically() bool {
+	for _, dir := range t.dirs {
+		if a, ok := StorageFor(dir).(AtomicStorage); !ok || !a.CreatesAtomically() {
+			return false
+		}
+	}
+	return true
+}
+
+// FreeSpace returns the smallest free space of the healthy directories that report it.
+func (t *TeeStorage) FreeSpace(dir string) (uint64, error) {
+	var free uint64
+	var firstErr error
+	known := false
+	for _, i := range t.healthy() {
+		target, err := t.target(i, dir)
+		if err != nil {
+			return 0, err
+		}
+		bytes, err := StorageFor(target).FreeSpace(target)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if !known || bytes < free {
+			free, known = bytes, true
+		}
+	}
+	if !known {
+		return 0, firstErr
+	}
+	return free, nil
+}
+
+// teeFile is the file at path in directory dir written by a teeWriter.
+type teeFile struct {
+	dir  int
+	path string
+	w    StorageWriter
+}
+
+// teeWriter writes to the same file in every healthy directory.
+type teeWriter struct {
+	tee    *TeeStorage
+	files  []teeFile
+	closed bool
+}
+
+// each runs op for the files whose directory has not failed, drops the directory
+// of a file whose op fails, and returns an error once no file is left.
+func (w *teeWriter) each(op func(StorageWriter) error) error {
+	var last error
+	active := w.files[:0]
+	for _, f := range w.files {
+		if w.tee.isDropped(f.dir) {
+			f.w.Close() //nolint:errcheck
+			continue
+		}
+		if err := op(f.w); err != nil {
+			w.tee.fail(f.dir, err)
+			f.w.Close() //nolint:errcheck
+			last = err
+			continue
+		}
+		active = append(active, f)
+	}
+	w.files = active
+	if len(w.files) == 0 {
+		return cmp.Or(last, errAllTeeDirsFailed)
+	}
+	return nil
+}
+
+func (w *teeWriter) Write(p []byte) (int, error) {
+	err := w.each(func(f StorageWriter) error {
+		n, err := f.Write(p)
+		if err == nil && n < len(p) {
+			err = io.ErrShortWrite
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *teeWriter) Sync() error {
+	return w.each(StorageWriter.Sync)
+}
+
+func (w *teeWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.each(StorageWriter.Close)
+	w.files = nil
+	return err
+}
@@ -0,0 +1,208 @@
+package util
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// brokenStorage is a MemoryStorage whose writes fail once limit bytes were written.
+type brokenStorage struct {
+	*MemoryStorage
+	limit   int
+	written int
+}
+
+var errDisconnected = errors.New("network name is no longer available")
+
+func (s *brokenStorage) Create(p string) (StorageWriter, error) {
+	w, err := s.MemoryStorage.Create(p)
+	if err != nil {
+		return nil, err
+	}
+	return &brokenWriter{StorageWriter: w, storage: s}, nil
+}
+
+type brokenWriter struct {
+	StorageWriter
+	storage *brokenStorage
+}
+
+func (w *brokenWriter) Write(p []byte) (int, error) {
+	if w.storage.written+len(p) > w.storage.limit {
+		return 0, errDisconnected
+	}
+	w.storage.written += len(p)
+	return w.StorageWriter.Write(p)
+}
+
+func mountTee(t *testing.T, dirs ...string) *TeeStorage {
+	t.Helper()
+	root := "tee://" + t.Name()
+	tee := NewTeeStorage(root, dirs)
+	t.Cleanup(MountStorage(root, tee))
+	return tee
+}
+
+func TestTeeStorageWritesEveryDirectory(t *testing.T) {
+	t.Parallel()
+
+	local := t.TempDir()
+	mem := NewMemoryStorage()
+	t.Cleanup(MountStorage("mem://"+t.Name(), mem))
+	tee := mountTee(t, local, "mem://"+t.Name()+"/copy")
+	root := "tee://" + t.Name()
+
+	if err := tee.MkdirAll(root); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := WriteStorageFile(filepath.Join(root, "a.enc"), []byte("payload")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	for _, p := range []string{filepath.Join(local, "a.enc"), "mem://" + t.Name() + "/copy/a.enc"} {
+		if data, err := ReadStorageFile(p); err != nil || string(data) != "payload" {
+			t.Fatalf("expected the file in %s, got %q, %v", p, data, err)
+		}
+	}
+	if _, err := tee.CreateNew(filepath.Join(root, "a.enc")); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected fs.ErrExist from CreateNew, got %v", err)
+	}
+	if err := tee.Rename(filepath.Join(root, "a.enc"), filepath.Join(root, "b.enc")); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	entries, err := tee.List(root)
+	if err != nil || len(entries) != 1 || entries[0].Name() != "b.enc" {
+		t.Fatalf("unexpected entries %v, %v", entries, err)
+	}
+	if failures := tee.Failures(); len(failures) != 0 {
+		t.Fatalf("expected no failed directory, got %v", failures)
+	}
+}
+
+func TestTeeStorageDropsFailedDirectory(t *testing.T) {
+	t.Parallel()
+
+	broken := &brokenStorage{MemoryStorage: NewMemoryStorage(), limit: 10}
+	t.Cleanup(MountStorage("mem://"+t.Name(), broken))
+	local := t.TempDir()
+	tee := mountTee(t, "mem://"+t.Name(), local)
+	root := "tee://" + t.Name()
+
+	w, err := tee.Create(filepath.Join(root, "part-001.enc"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	for range 4 {
+		if _, err := w.Write([]byte("0123456789")); err != nil {
+			t.Fatalf("expected the writes to continue on the healthy directory, got %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	failures := tee.Failures()
+	if len(failures) != 1 || failures[0].Dir != "mem://"+t.Name() || !errors.Is(failures[0].Err, errDisconnected) {
+		t.Fatalf("expected the broken directory to be dropped, got %+v", failures)
+	}
+	if !tee.Failed("mem://"+t.Name()) || tee.Failed(local) {
+		t.Fatal("unexpected Failed result")
+	}
+	f, err := tee.Open(filepath.Join(root, "part-001.enc"))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	if data, err := io.ReadAll(f); err != nil || len(data) != 40 {
+		t.Fatalf("expected the complete file from the healthy directory, got %d bytes, %v", len(data), err)
+	}
+}
+
+func TestTeeStorageFailsWhenNoDirectoryIsLeft(t *testing.T) {
+	t.Parallel()
+
+	broken := &brokenStorage{MemoryStorage: NewMemoryStorage(), limit: 0}
+	t.Cleanup(MountStorage("mem://"+t.Name(), broken))
+	tee := mountTee(t, "mem://"+t.Name())
+	root := "tee://" + t.Name()
+
+	w, err := tee.Create(filepath.Join(root, "part-001.enc"))
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := w.Write([]byte("x")); !errors.Is(err, errDisconnected) {
+		t.Fatalf("expected the error of the last directory, got %v", err)
+	}
+	if err := WriteStorageFile(filepath.Join(root, "other.enc"), nil); err == nil || !strings.Contains(err.Error(), "Every backup directory has failed") {
+		t.Fatalf("expected an error once every directory failed, got %v", err)
+	}
+}
+
+func TestTeeStorageRemovesCreatedFilesWhenCreateFails(t *testing.T) {
+	t.Parallel()
+
+	local := t.TempDir()
+	mem := NewMemoryStorage()
+	t.Cleanup(MountStorage("mem://"+t.Name(), mem))
+	copyDir := "mem://" + t.Name() + "/copy"
+	tee := mountTee(t, local, copyDir)
+	root := "tee://" + t.Name()
+
+	if err := tee.MkdirAll(root); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	if err := WriteStorageFile(copyDir+"/a.enc", []byte("existing")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if _, err := tee.CreateNew(filepath.Join(root, "a.enc")); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected fs.ErrExist from CreateNew, got %v", err)
+	}
+	if _, err := StorageFor(local).Stat(filepath.Join(local, "a.enc")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the file created in the first directory to be removed, got %v", err)
+	}
+	if data, err := ReadStorageFile(copyDir + "/a.enc"); err != nil || string(data) != "existing" {
+		t.Fatalf("expected the existing file to be kept, got %q, %v", data, err)
+	}
+}
+
+func TestTeeStorageRemovesAndRenamesWhereTheFileExists(t *testing.T) {
+	t.Parallel()
+
+	local := t.TempDir()
+	mem := NewMemoryStorage()
+	t.Cleanup(MountStorage("mem://"+t.Name(), mem))
+	copyDir := "mem://" + t.Name() + "/copy"
+	tee := mountTee(t, local, copyDir)
+	root := "tee://" + t.Name()
+
+	if err := tee.MkdirAll(root); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	// Only the second directory holds the files, e.g. after a failed earlier run.
+	for _, name := range []string{"a.enc", "b.enc"} {
+		if err := WriteStorageFile(copyDir+"/"+name, []byte(name)); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+	if err := tee.Rename(filepath.Join(root, "a.enc"), filepath.Join(root, "c.enc")); err != nil {
+		t.Fatalf("expected Rename to succeed in the directory holding the file, got %v", err)
+	}
+	if data, err := ReadStorageFile(copyDir + "/c.enc"); err != nil || string(data) != "a.enc" {
+		t.Fatalf("expected the renamed file, got %q, %v", data, err)
+	}
+	if err := tee.Remove(filepath.Join(root, "b.enc")); err != nil {
+		t.Fatalf("expected Remove to succeed in the directory holding the file, got %v", err)
+	}
+	if _, err := StorageFor(copyDir).Stat(copyDir + "/b.enc"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected the file to be removed, got %v", err)
+	}
+	if err := tee.Remove(filepath.Join(root, "b.enc")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist once no directory holds the file, got %v", err)
+	}
+	if failures := tee.Failures(); len(failures) != 0 {
+		t.Fatalf("expected no failed directory, got %v", failures)
+	}
+}
@@ -0,0 +1,171 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsStorageURLIgnoresDriveLetters(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]bool{
+		"s3://bucket/prefix": true,
+		"mem://tests":        true,
+		`C:\Backups`:         false,
+		"D:":                 false,
+		"/srv/backups":       false,
+		`\\server\share`:     false,
+		"relative/dir":       false,
+		"backup:old":         false,
+		"backup:old/2026":    false,
+		"./backup:old":       false,
+		"mem:":               false,
+		"s3:bucket":          false,
+	}
+	for p, want := range cases {
+		if got := IsStorageURL(p); got != want {
+			t.Fatalf("IsStorageURL(%q) = %v, want %v", p, got, want)
+		}
+	}
+	// filepath.Join leaves a single separator after the scheme.
+	if joined := filepath.Join("s3://bucket", "prefix"); !IsStorageURL(joined) {
+		t.Fatalf("IsStorageURL(%q) = false, want true", joined)
+	}
+}
+
+func TestCleanStoragePathNormalizesJoinedURLs(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"mem://x/a":                   "mem://x/a",
+		`mem:/x\a`:                    "mem://x/a",
+		"MEM://x//a/../b/":            "mem://x/b",
+		filepath.Join("mem://x", "a"): "mem://x/a",
+	}
+	for p, want := range cases {
+		if got := CleanStoragePath(p); got != want {
+			t.Fatalf("CleanStoragePath(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestStorageForUsesLongestMount(t *testing.T) {
+	outer, inner := NewMemoryStorage(), NewMemoryStorage()
+	t.Cleanup(MountStorage("mem://storage-for", outer))
+	t.Cleanup(MountStorage("mem://storage-for/inner", inner))
+
+	if got := StorageFor("mem://storage-for/a.txt"); got != outer {
+		t.Fatalf("expected the outer storage, got %T", got)
+	}
+	if got := StorageFor(filepath.Join("mem://storage-for/inner", "a.txt")); got != inner {
+		t.Fatalf("expected the inner storage, got %T", got)
+	}
+	if got := StorageFor("mem://storage-for-other/a.txt"); got == outer {
+		t.Fatal("expected a sibling root not to match the mount")
+	}
+	if _, ok := StorageFor(t.TempDir()).(LocalStorage); !ok {
+		t.Fatal("expected LocalStorage for a local path")
+	}
+
+	_, err := StorageFor("mem://not-mounted/a.txt").Stat("mem://not-mounted/a.txt")
+	if err == nil || !strings.Contains(err.Error(), "Remedy:") {
+		t.Fatalf("expected an error with a remedy for an unmounted URL, got %v", err)
+	}
+}
+
+func TestMemoryStorageFileOperations(t *testing.T) {
+	t.Parallel()
+
+	s := NewMemoryStorage()
+	if err := s.MkdirAll("mem://m/sub"); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	w, err := s.Create("mem://m/a.txt")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if _, err := s.CreateNew("mem://m/a.txt"); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("expected fs.ErrExist for CreateNew on an existing file, got %v", err)
+	}
+	entries, err := s.List("mem://m")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name() != "a.txt" || entries[1].Name() != "sub" || !entries[1].IsDir() {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	if info, err := s.Stat("mem://m/a.txt"); err != nil || info.Size() != 5 {
+		t.Fatalf("unexpected Stat result %v, %v", info, err)
+	}
+
+	if err := s.Rename("mem://m/a.txt", "mem://m/sub/b.txt"); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	f, err := s.Open("mem://m/sub/b.txt")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	data, err := io.ReadAll(f)
+	f.Close()
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("unexpected content %q, %v", data, err)
+	}
+	if _, err := s.Open("mem://m/a.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist for the renamed file, got %v", err)
+	}
+
+	s.SetCapacity(8)
+	if free, err := s.FreeSpace("mem://m"); err != nil || free != 3 {
+		t.Fatalf("expected 3 free bytes, got %d, %v", free, err)
+	}
+	if err := s.Remove("mem://m/sub/b.txt"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if _, err := s.Stat("mem://m/sub/b.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist after Remove, got %v", err)
+	}
+}
+
+func TestSplitWriterAndReaderUseMountedStorage(t *testing.T) {
+	root := "mem://" + t.Name()
+	s := NewMemoryStorage()
+	t.Cleanup(MountStorage(root, s))
+
+	dir := filepath.Join(root, "parts")
+	w := NewWriter(func(seq int) string {
+		return filepath.Join(dir, "data.part"+string(rune('0'+seq)))
+	}, 4)
+	payload := []byte("0123456789")
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if len(w.Paths()) != 3 {
+		t.Fatalf("expected 3 parts, got %v", w.Paths())
+	}
+	entries, err := s.List(dir)
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("expected 3 parts in memory storage, got %v, %v", entries, err)
+	}
+
+	r := NewSequentialReader(w.Paths())
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, payload) {
+		t.Fatalf("unexpected content %q, %v", got, err)
+	}
+}
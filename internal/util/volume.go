@@ -0,0 +1,557 @@
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VolumeLabel is the label a backup run spanning removable media writes to each of
+// its volumes. It names the run and the volume and lists the files of the run on
+// this and the earlier volumes, so the label of the last volume lists them all.
+type VolumeLabel struct {
+	Date   string   `json:"date"`
+	ID     BackupID `json:"id"`
+	Volume int      `json:"volume"`
+	// Last is set on the label of the last volume once the run is complete.
+	Last  bool         `json:"last,omitempty"`
+	Files []VolumeFile `json:"files"`
+}
+
+// VolumeFile is a file of a spanned run and the first volume that holds it.
+// Manifests and other set files are copied to every later volume as well.
+type VolumeFile struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Volume  int       `json:"volume"`
+}
+
+// Title returns the name to write on the medium of the volume, e.g.
+// "RestoreSafe 2026-10-19_AB12CD volume 2".
+func (l VolumeLabel) Title() string {
+	return volumeTitle(l.Date, l.ID, l.Volume)
+}
+
+func volumeTitle(date string, id BackupID, volume int) string {
+	return fmt.Sprintf("RestoreSafe %s_%s volume %d", date, string(id), volume)
+}
+
+// ReadVolumeLabel reads the volume label at path.
+func ReadVolumeLabel(path string) (VolumeLabel, error) {
+	return readVolumeLabel(StorageFor(path), path)
+}
+
+func readVolumeLabel(s Storage, path string) (VolumeLabel, error) {
+	var label VolumeLabel
+	f, err := s.Open(path)
+	if err != nil {
+		return label, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return label, err
+	}
+	if err := json.Unmarshal(data, &label); err != nil {
+		return label, fmt.Errorf("Failed to parse volume label %q: %w", filepath.Base(path), err)
+	}
+	return label, nil
+}
+
+func writeVolumeLabel(dir string, label VolumeLabel) error {
+	data, err := json.MarshalIndent(label, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := VolumeLabelFileName(dir, label.Date, label.ID)
+	if err := WriteStorageFile(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("Failed to write volume label %q: %w. Remedy: Check that the medium is writable.", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// spanMinPartBytes is the smallest part started on a medium; with less room left,
+// the next medium is requested instead. Tests lower it.
+var spanMinPartBytes int64 = 1024 * 1024
+
+// MediaSpan spreads the parts of a backup run over removable media, such as USB
+// disks or BD-R discs, that are inserted one after another at the backup directory.
+// Writers of the run (see SetMediaSpan) fill the inserted medium up to its
+// capacity: its free space when it was inserted, or the preset media size, less a
+// reserve for the files written after the parts. NextVolume then asks for the next
+// medium. Each medium gets a volume label (see VolumeLabel) and copies of the
+// manifests and other set files written so far, so the last volume holds everything
+// a restore starts with.
+type MediaSpan struct {
+	dir        string
+	tempDir    string
+	mediaSize  int64
+	reserve    int64
+	minPart    int64
+	prompt     func(message string) error
+	beforeSwap func(volume int) error
+	afterSwap  func(volume int) error
+
+	label    VolumeLabel
+	capacity int64
+	used     int64
+}
+
+var mediaSpans = struct {
+	sync.Mutex
+	dirs map[string]*MediaSpan
+}{dirs: make(map[string]*MediaSpan)}
+
+// StartMediaSpan starts spanning run date/id over the media inserted at dir, with the
+// medium inserted now as volume 1. mediaSize is the capacity of one medium, or 0 for
+// the free space of each medium; reserve bytes are left free on every medium. prompt
+// shows message, which asks for a medium, and returns once it is inserted, or returns
+// an error to stop the run. Close ends the span.
+func StartMediaSpan(dir, date string, id BackupID, mediaSize, reserve int64, prompt func(message string) error) (*MediaSpan, error) {
+	m := &MediaSpan{
+		dir:       dir,
+		mediaSize: mediaSize,
+		reserve:   reserve,
+		minPart:   spanMinPartBytes,
+		prompt:    prompt,
+		label:     VolumeLabel{Date: date, ID: id, Volume: 1},
+	}
+	if err := m.measure(); err != nil {
+		return nil, err
+	}
+	if m.remaining() < m.minPart {
+		return nil, fmt.Errorf("The medium at %s has no room for a backup: %s free, %s reserved. Remedy: Insert an empty medium or lower 'spanning.reserve_mb'.", filepath.ToSlash(dir), FormatBytesBinary(uint64(max(m.capacity+m.reserve, 0))), FormatBytesBinary(uint64(reserve)))
+	}
+	tempDir, err := os.MkdirTemp("", "restoresafe-span-*")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create a temporary directory: %w. Remedy: Check TEMP/TMP path and write permissions.", err)
+	}
+	m.tempDir = tempDir
+	if err := writeVolumeLabel(dir, m.label); err != nil {
+		os.RemoveAll(tempDir) //nolint:errcheck
+		return nil, err
+	}
+	mediaSpans.Lock()
+	mediaSpans.dirs[CleanStoragePath(dir)] = m
+	mediaSpans.Unlock()
+	return m, nil
+}
+
+// MediaSpanFor returns the media span started at dir, or nil.
+func MediaSpanFor(dir string) *MediaSpan {
+	mediaSpans.Lock()
+	defer mediaSpans.Unlock()
+	return mediaSpans.dirs[CleanStoragePath(dir)]
+}
+
+// Close ends the span and removes its temporary directory. It is safe to call on nil.
+func (m *MediaSpan) Close() {
+	if m == nil {
+		return
+	}
+	mediaSpans.Lock()
+	if mediaSpans.dirs[CleanStoragePath(m.dir)] == m {
+		delete(mediaSpans.dirs, CleanStoragePath(m.dir))
+	}
+	mediaSpans.Unlock()
+	os.RemoveAll(m.tempDir) //nolint:errcheck
+}
+
+// SetSwapHooks registers callbacks invoked by NextVolume: before with the number of
+// the full volume before its medium is removed, and after with the number of the new
+// volume once its medium is inserted and labelled.
+func (m *MediaSpan) SetSwapHooks(before, after func(volume int) error) {
+	m.beforeSwap, m.afterSwap = before, after
+}
+
+// Volume returns the number of the volume being written.
+func (m *MediaSpan) Volume() int {
+	return m.label.Volume
+}
+
+// TempDir returns a local directory for files of the run that stay open while parts
+// are written, such as a streamed manifest, so that no file on a medium is open when
+// the medium is changed. Place moves such a file onto the medium once it is closed.
+func (m *MediaSpan) TempDir() string {
+	return m.tempDir
+}
+
+// Place moves the file at path, a closed file in TempDir, into the backup directory
+// on the inserted medium.
+func (m *MediaSpan) Place(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(m.dir, filepath.Base(path))
+	if err := WriteStorageFile(target, data); err != nil {
+		return fmt.Errorf("Failed to write %q: %w. Remedy: Check that the medium is writable and lower 'spanning.media_size_mb' if it is full.", filepath.Base(target), err)
+	}
+	m.add(int64(len(data)))
+	return os.Remove(path)
+}
+
+// measure sets the capacity of the inserted medium.
+func (m *MediaSpan) measure() error {
+	free, err := StorageFor(m.dir).FreeSpace(m.dir)
+	if err != nil && m.mediaSize == 0 {
+		return fmt.Errorf("Failed to query the free space at %s: %w. Remedy: Set 'spanning.media_size_mb' to the capacity of one medium.", filepath.ToSlash(m.dir), err)
+	}
+	capacity := int64(free)
+	if m.mediaSize > 0 && (err != nil || m.mediaSize < capacity) {
+		capacity = m.mediaSize
+	}
+	m.capacity, m.used = capacity-m.reserve, 0
+	return nil
+}
+
+// remaining returns the number of bytes parts may still take on the inserted medium.
+func (m *MediaSpan) remaining() int64 {
+	return max(m.capacity-m.used, 0)
+}
+
+func (m *MediaSpan) add(n int64) {
+	if m != nil {
+		m.used += n
+	}
+}
+
+// record adds the files of the run on the inserted medium that its label does not
+// list yet, and returns the content of the set files on it other than parts.
+func (m *MediaSpan) record() (map[string][]byte, error) {
+	entries, err := StorageFor(m.dir).List(m.dir)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list %s: %w", filepath.ToSlash(m.dir), err)
+	}
+	listed := make(map[string]bool, len(m.label.Files))
+	for _, f := range m.label.Files {
+		listed[f.Name] = true
+	}
+	setFiles := make(map[string][]byte)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !isSpannedRunFile(name, m.label.Date, m.label.ID) {
+			continue
+		}
+		if !listed[name] {
+			info, err := e.Info()
+			if err != nil {
+				return nil, err
+			}
+			m.label.Files = append(m.label.Files, VolumeFile{Name: name, Size: info.Size(), ModTime: info.ModTime(), Volume: m.label.Volume})
+		}
+		if _, _, ok := ParsePartFileName(name); !ok {
+			data, err := ReadStorageFile(filepath.Join(m.dir, name))
+			if err != nil {
+				return nil, err
+			}
+			setFiles[name] = data
+		}
+	}
+	return setFiles, nil
+}
+
+// isSpannedRunFile reports whether name is a finished file of a backup set of run
+// date/id: a part, challenge, manifest or run metadata file.
+func isSpannedRunFile(name, date string, id BackupID) bool {
+	if strings.HasSuffix(name, PartialFileSuffix) || strings.HasSuffix(name, RemnantFileSuffix) {
+		return false
+	}
+	return strings.HasPrefix(name, "[") && strings.Contains(name, "]_"+date+"_"+string(id))
+}
+
+// NextVolume finishes the inserted medium and asks for the medium of the next
+// volume. The label of the finished volume lists the files written so far; the set
+// files on it other than parts are copied to the new medium.
+func (m *MediaSpan) NextVolume() error {
+	setFiles, err := m.record()
+	if err != nil {
+		return err
+	}
+	if err := writeVolumeLabel(m.dir, m.label); err != nil {
+		return err
+	}
+	finished := m.label.Volume
+	if m.beforeSwap != nil {
+		if err := m.beforeSwap(finished); err != nil {
+			return err
+		}
+	}
+
+	next := finished + 1
+	dir := filepath.ToSlash(m.dir)
+	message := fmt.Sprintf("Volume %d is full. Write %q on its medium, remove it and insert an empty medium for volume %d at %s.", finished, m.label.Title(), next, dir)
+	for {
+		if err := m.prompt(message); err != nil {
+			return fmt.Errorf("The medium for volume %d was not inserted: %w", next, err)
+		}
+		problem := m.checkMedium(setFiles)
+		if problem == "" {
+			break
+		}
+		message = fmt.Sprintf("%s Insert an empty medium for volume %d at %s.", problem, next, dir)
+	}
+
+	m.label.Volume = next
+	for name, data := range setFiles {
+		if err := WriteStorageFile(filepath.Join(m.dir, name), data); err != nil {
+			return fmt.Errorf("Failed to copy %q to volume %d: %w", name, next, err)
+		}
+		m.add(int64(len(data)))
+	}
+	if err := writeVolumeLabel(m.dir, m.label); err != nil {
+		return err
+	}
+	if m.afterSwap != nil {
+		return m.afterSwap(next)
+	}
+	return nil
+}
+
+// checkMedium measures the inserted medium and returns why it cannot take the next
+// volume, or "".
+func (m *MediaSpan) checkMedium(setFiles map[string][]byte) string {
+	s := StorageFor(m.dir)
+	if err := s.MkdirAll(m.dir); err != nil {
+		return fmt.Sprintf("%s is not available (%v).", filepath.ToSlash(m.dir), err)
+	}
+	if label, err := ReadVolumeLabel(VolumeLabelFileName(m.dir, m.label.Date, m.label.ID)); err == nil {
+		return fmt.Sprintf("This medium already holds volume %d of this run.", label.Volume)
+	}
+	if err := m.measure(); err != nil {
+		return err.Error()
+	}
+	needed := m.minPart
+	for _, data := range setFiles {
+		needed += int64(len(data))
+	}
+	if m.remaining() < needed {
+		return fmt.Sprintf("This medium has room for %s only.", FormatBytesBinary(uint64(m.remaining())))
+	}
+	return ""
+}
+
+// Finish records the files written to the last volume and marks its label as the
+// label of the last volume. It is safe to call on nil.
+func (m *MediaSpan) Finish() error {
+	if m == nil {
+		return nil
+	}
+	if _, err := m.record(); err != nil {
+		return err
+	}
+	m.label.Last = true
+	return writeVolumeLabel(m.dir, m.label)
+}
+
+// MediaStorage is the Storage of a backup directory on removable media that holds
+// runs spanning several media (see MediaSpan). Once it has listed the directory
+// with the last volume of a run inserted, its listing includes the files the run
+// wrote to its other volumes, and opening one of them asks for the medium that holds
+// it. Everything else is passed to the Storage of the inserted medium.
+type MediaStorage struct {
+	Storage
+	dir    string
+	prompt func(message string) error
+
+	mu    sync.Mutex
+	files map[string]mediaFile
+	// learned holds the names of the volume labels whose files are in files.
+	learned map[string]bool
+}
+
+// mediaFile is a file of a spanned run and the title of the volume that holds it.
+type mediaFile struct {
+	VolumeFile
+	title string
+}
+
+// MountMedia serves dir, the backup directory the removable media are inserted at,
+// by a MediaStorage that asks for a medium with prompt (see StartMediaSpan). The
+// returned function unmounts it.
+func MountMedia(dir string, prompt func(message string) error) func() {
+	m := &MediaStorage{Storage: StorageFor(dir), dir: CleanStoragePath(dir), prompt: prompt, files: make(map[string]mediaFile), learned: make(map[string]bool)}
+	if IsStorageURL(dir) {
+		return MountStorage(dir, m)
+	}
+	storageMounts.Lock()
+	storageMounts.media[m.dir] = m
+	storageMounts.Unlock()
+	return func() {
+		storageMounts.Lock()
+		delete(storageMounts.media, m.dir)
+		storageMounts.Unlock()
+	}
+}
+
+// localStorageFor returns the MediaStorage mounted at p or at its directory, and
+// LocalStorage for every other local path.
+func localStorageFor(p string) Storage {
+	storageMounts.RLock()
+	defer storageMounts.RUnlock()
+	if len(storageMounts.media) == 0 {
+		return LocalStorage{}
+	}
+	clean := filepath.Clean(p)
+	parent := filepath.Dir(clean)
+	for dir, s := range storageMounts.media {
+		if strings.EqualFold(clean, dir) || strings.EqualFold(parent, dir) {
+			return s
+		}
+	}
+	return LocalStorage{}
+}
+
+// List lists dir on the inserted medium. For the backup directory, it adds the files
+// of spanned runs on other volumes, as recorded by the label of their last volume.
+func (m *MediaStorage) List(dir string) ([]fs.DirEntry, error) {
+	entries, err := m.Storage.List(dir)
+	if err != nil || !m.isDir(dir) {
+		return entries, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	present := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		present[e.Name()] = true
+		if _, _, suffix, ok := ParseRunMarkerFileName(e.Name()); ok && suffix == VolumeLabelFileSuffix {
+			m.learn(filepath.Join(dir, e.Name()))
+		}
+	}
+	for name, f := range m.files {
+		if !present[name] {
+			entries = append(entries, fs.FileInfoToDirEntry(mediaFileInfo{f}))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// learn records the files listed by the volume label at path if it is the label of
+// the last volume. A label is read once, so files removed or renamed since are not
+// recorded again. m.mu must be held.
+func (m *MediaStorage) learn(path string) {
+	if m.learned[filepath.Base(path)] {
+		return
+	}
+	label, err := readVolumeLabel(m.Storage, path)
+	if err != nil || !label.Last {
+		return
+	}
+	m.learned[filepath.Base(path)] = true
+	for _, f := range label.Files {
+		m.files[f.Name] = mediaFile{VolumeFile: f, title: volumeTitle(label.Date, label.ID, f.Volume)}
+	}
+	// The completion marker is on the last volume only; the run is complete on all.
+	marker := filepath.Base(CompleteRunFileName(m.dir, label.Date, label.ID))
+	m.files[marker] = mediaFile{VolumeFile: VolumeFile{Name: marker, Volume: label.Volume}, title: label.Title()}
+}
+
+// isDir reports whether dir is the backup directory of m.
+func (m *MediaStorage) isDir(dir string) bool {
+	return strings.EqualFold(CleanStoragePath(dir), m.dir)
+}
+
+// lookup returns the file of a spanned run at path.
+func (m *MediaStorage) lookup(path string) (mediaFile, bool) {
+	if !m.isDir(filepath.Dir(path)) {
+		return mediaFile{}, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[filepath.Base(path)]
+	return f, ok
+}
+
+// Stat returns the information recorded in the volume label for a file on another
+// volume.
+func (m *MediaStorage) Stat(path string) (fs.FileInfo, error) {
+	info, err := m.Storage.Stat(path)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return info, err
+	}
+	if f, ok := m.lookup(path); ok {
+		return mediaFileInfo{f}, nil
+	}
+	return nil, err
+}
+
+// Open opens the file at path, asking for the medium that holds it while it is not
+// on the inserted medium.
+func (m *MediaStorage) Open(path string) (StorageFile, error) {
+	for {
+		file, err := m.Storage.Open(path)
+		if err == nil || !errors.Is(err, fs.ErrNotExist) {
+			return file, err
+		}
+		f, ok := m.lookup(path)
+		if !ok {
+			return nil, err
+		}
+		message := fmt.Sprintf("%s is on volume %d. Insert the medium %q at %s.", filepath.Base(path), f.Volume, f.title, filepath.ToSlash(m.dir))
+		if err := m.prompt(message); err != nil {
+			return nil, fmt.Errorf("The medium %q was not inserted: %w", f.title, err)
+		}
+	}
+}
+
+// Remove removes the file at path from the inserted medium and forgets it as a file
+// of a spanned run, so that listings no longer include it.
+func (m *MediaStorage) Remove(path string) error {
+	err := m.Storage.Remove(path)
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		m.forget(path)
+	}
+	return err
+}
+
+// Rename renames a file on the inserted medium. Both names are forgotten as files of
+// a spanned run, since the file is now at newPath on the inserted medium.
+func (m *MediaStorage) Rename(oldPath, newPath string) error {
+	if err := m.Storage.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	m.forget(oldPath)
+	m.forget(newPath)
+	return nil
+}
+
+// forget drops the file of a spanned run at path. A volume label at path is read
+// again when it is listed next.
+func (m *MediaStorage) forget(path string) {
+	if !m.isDir(filepath.Dir(path)) {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, filepath.Base(path))
+	delete(m.learned, filepath.Base(path))
+}
+
+// Reopen reopens a file of the inserted medium after a failed write.
+func (m *MediaStorage) Reopen(path string, size int64) (StorageWriter, error) {
+	r, ok := m.Storage.(ReopenStorage)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	return r.Reopen(path, size)
+}
+
+// mediaFileInfo describes a file on another volume.
+type mediaFileInfo struct{ f mediaFile }
+
+func (i mediaFileInfo) Name() string       { return i.f.Name }
+func (i mediaFileInfo) Size() int64        { return i.f.Size }
+func (i mediaFileInfo) Mode() fs.FileMode  { return 0o444 }
+func (i mediaFileInfo) ModTime() time.Time { return i.f.ModTime }
+func (i mediaFileInfo) IsDir() bool        { return false }
+func (i mediaFileInfo) Sys() any           { return nil }
@@ -0,0 +1,224 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// mediaDrive simulates a drive for removable media on a MemoryStorage: eject takes
+// the files of the inserted medium out, insert puts the files of a medium back.
+type mediaDrive struct {
+	t       *testing.T
+	storage *MemoryStorage
+	dir     string
+}
+
+func (d mediaDrive) eject() map[string][]byte {
+	d.t.Helper()
+	entries, err := d.storage.List(d.dir)
+	if err != nil {
+		d.t.Fatalf("failed to list the medium: %v", err)
+	}
+	files := make(map[string][]byte)
+	for _, e := range entries {
+		path := filepath.Join(d.dir, e.Name())
+		f, err := d.storage.Open(path)
+		if err != nil {
+			d.t.Fatalf("failed to open %s: %v", e.Name(), err)
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			d.t.Fatalf("failed to read %s: %v", e.Name(), err)
+		}
+		files[e.Name()] = data
+		if err := d.storage.Remove(path); err != nil {
+			d.t.Fatalf("failed to remove %s: %v", e.Name(), err)
+		}
+	}
+	return files
+}
+
+func (d mediaDrive) insert(files map[string][]byte) {
+	d.t.Helper()
+	for name, data := range files {
+		w, err := d.storage.Create(filepath.Join(d.dir, name))
+		if err == nil {
+			_, err = w.Write(data)
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			d.t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestMediaSpanWritesAndRestoresVolumes(t *testing.T) {
+	root := "mem://" + t.Name()
+	s := NewMemoryStorage()
+	t.Cleanup(MountStorage(root, s))
+	drive := mediaDrive{t: t, storage: s, dir: filepath.Join(root, "media")}
+	if err := s.MkdirAll(drive.dir); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	date, id := "2026-10-19", BackupID("AB12CD")
+	previousMinPart := spanMinPartBytes
+	spanMinPartBytes = 10
+	t.Cleanup(func() { spanMinPartBytes = previousMinPart })
+
+	var volumes []map[string][]byte
+	var messages []string
+	prompt := func(message string) error {
+		messages = append(messages, message)
+		// The full medium is inserted again once before it is swapped.
+		if len(messages) > 1 {
+			volumes = append(volumes, drive.eject())
+		}
+		return nil
+	}
+	span, err := StartMediaSpan(drive.dir, date, id, 100, 0, prompt)
+	if err != nil {
+		t.Fatalf("StartMediaSpan failed: %v", err)
+	}
+	defer span.Close()
+
+	challenge := []byte("challenge")
+	if err := WriteStorageFile(ChallengeFileName(drive.dir, "Docs", date, id), challenge); err != nil {
+		t.Fatalf("failed to write challenge: %v", err)
+	}
+	w := NewWriter(func(seq int) string {
+		return PartFileName(drive.dir, "Docs", date, id, seq)
+	}, 40)
+	w.SetMediaSpan(MediaSpanFor(drive.dir))
+	payload := bytes.Repeat([]byte("0123456789"), 25)
+	if _, err := w.Write(payload); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := span.Finish(); err != nil {
+		t.Fatalf("Finish failed: %v", err)
+	}
+	last, err := ReadVolumeLabel(VolumeLabelFileName(drive.dir, date, id))
+	if err != nil {
+		t.Fatalf("ReadVolumeLabel failed: %v", err)
+	}
+	volumes = append(volumes, drive.eject())
+
+	if len(volumes) < 3 || !strings.Contains(messages[1], "already holds volume 1") {
+		t.Fatalf("unexpected volumes %d, prompts %q", len(volumes), messages)
+	}
+	// Every volume holds a copy of the challenge file.
+	challengeName := filepath.Base(ChallengeFileName(drive.dir, "Docs", date, id))
+	for i, files := range volumes {
+		var partBytes int
+		for name, data := range files {
+			if _, _, ok := ParsePartFileName(name); ok {
+				partBytes += len(data)
+			}
+		}
+		if partBytes > 100 || !bytes.Equal(files[challengeName], challenge) {
+			t.Fatalf("volume %d holds %d part bytes and challenge %q", i+1, partBytes, files[challengeName])
+		}
+	}
+	if !last.Last || last.Volume != len(volumes) || len(last.Files) != len(w.Paths())+1 {
+		t.Fatalf("unexpected label of the last volume %+v", last)
+	}
+
+	// A restore starts with the last volume and is asked for the others.
+	drive.insert(volumes[len(volumes)-1])
+	volumePattern := regexp.MustCompile(`is on volume (\d+)\.`)
+	t.Cleanup(MountMedia(drive.dir, func(message string) error {
+		match := volumePattern.FindStringSubmatch(message)
+		if match == nil {
+			return fmt.Errorf("unexpected prompt %q", message)
+		}
+		volume, _ := strconv.Atoi(match[1])
+		drive.eject()
+		drive.insert(volumes[volume-1])
+		return nil
+	}))
+	entries, err := StorageFor(drive.dir).List(drive.dir)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var parts int
+	for _, e := range entries {
+		if _, _, ok := ParsePartFileName(e.Name()); ok {
+			parts++
+		}
+	}
+	if parts != len(w.Paths()) {
+		t.Fatalf("listing has %d of %d parts", parts, len(w.Paths()))
+	}
+	r := NewSequentialReader(w.Paths())
+	defer r.Close()
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, payload) {
+		t.Fatalf("unexpected content %q, %v", got, err)
+	}
+}
+
+func TestMediaStorageForgetsRemovedAndRenamedFiles(t *testing.T) {
+	root := "mem://" + t.Name()
+	s := NewMemoryStorage()
+	t.Cleanup(MountStorage(root, s))
+	drive := mediaDrive{t: t, storage: s, dir: filepath.Join(root, "media")}
+	if err := s.MkdirAll(drive.dir); err != nil {
+		t.Fatalf("MkdirAll failed: %v", err)
+	}
+	date, id := "2026-10-19", BackupID("AB12CD")
+	first := filepath.Base(PartFileName(drive.dir, "Docs", date, id, 1))
+	second := filepath.Base(PartFileName(drive.dir, "Docs", date, id, 2))
+	drive.insert(map[string][]byte{second: []byte("part 2")})
+	label := VolumeLabel{Date: date, ID: id, Volume: 2, Last: true, Files: []VolumeFile{
+		{Name: first, Size: 6, Volume: 1},
+		{Name: second, Size: 6, Volume: 2},
+	}}
+	if err := writeVolumeLabel(drive.dir, label); err != nil {
+		t.Fatalf("writeVolumeLabel failed: %v", err)
+	}
+	t.Cleanup(MountMedia(drive.dir, func(message string) error {
+		return fmt.Errorf("unexpected prompt %q", message)
+	}))
+	storage := StorageFor(drive.dir)
+	listed := func() map[string]bool {
+		t.Helper()
+		entries, err := storage.List(drive.dir)
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		names := make(map[string]bool)
+		for _, e := range entries {
+			names[e.Name()] = true
+		}
+		return names
+	}
+	if names := listed(); !names[first] || !names[second] {
+		t.Fatalf("expected both parts in the listing, got %v", names)
+	}
+
+	// The first part is on another medium; removing it drops it from the listing.
+	storage.Remove(filepath.Join(drive.dir, first)) //nolint:errcheck
+	if err := storage.Rename(filepath.Join(drive.dir, second), filepath.Join(drive.dir, second+".old")); err != nil {
+		t.Fatalf("Rename failed: %v", err)
+	}
+	names := listed()
+	if names[first] || names[second] || !names[second+".old"] {
+		t.Fatalf("expected the removed and renamed parts to be gone, got %v", names)
+	}
+	if _, err := storage.Stat(filepath.Join(drive.dir, second)); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist for the renamed part, got %v", err)
+	}
+}
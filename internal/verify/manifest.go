@@ -0,0 +1,111 @@
+package verify
+
+import (
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/util"
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// maxReportedMismatches limits how many manifest mismatches are listed in one error.
+const maxReportedMismatches = 10
+
+// validateTarAgainstManifest reads the TAR stream r completely and checks every entry
+// against the manifest: each recorded path must be present with the recorded type and
+// size, regular files must match their SHA-256, and the archive must not contain
+// entries the manifest does not list. Files an incremental manifest records as stored
+// in a parent backup are not expected in the archive.
+func validateTarAgainstManifest(r io.Reader, index manifest.Index) (int, error) {
+	seen := make(map[string]bool, len(index))
+	var mismatches []string
+	checked := 0
+
+	err := util.WalkTar(r, func(hdr *tar.Header, body io.Reader) error {
+		name := strings.TrimSuffix(hdr.Name, "/")
+		seen[name] = true
+		want, ok := index[name]
+		if !ok {
+			mismatches = append(mismatches, fmt.Sprintf("%s: not listed in the manifest", name))
+			return nil
+		}
+
+		got := manifest.EntryFromTar(util.TarEntry{Header: hdr})
+		if got.Type != want.Type {
+			mismatches = append(mismatches, fmt.Sprintf("%s: type %s, manifest records %s", name, got.Type, want.Type))
+			return nil
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil
+		}
+		if got.Size != want.Size {
+			mismatches = append(mismatches, fmt.Sprintf("%s: size %d, manifest records %d", name, got.Size, want.Size))
+			return nil
+		}
+
+		sum := sha256.New()
+		if _, err := io.Copy(sum, body); err != nil {
+			return fmt.Errorf("Failed to read TAR entry payload %q: %w. Remedy: Check .enc part completeness and create a new backup if needed.", hdr.Name, err)
+		}
+		if wantSum := want.Sum(); wantSum != nil {
+			if !bytes.Equal(sum.Sum(nil), wantSum) {
+				mismatches = append(mismatches, fmt.Sprintf("%s: content hash differs from the manifest", name))
+				return nil
+			}
+			checked++
+		}
+		return nil
+	})
+	if err != nil {
+		return checked, err
+	}
+
+	var missing []string
+	for name, want := range index {
+		if !seen[name] && want.InArchive() {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	for _, name := range missing {
+		mismatches = append(mismatches, fmt.Sprintf("%s: listed in the manifest but missing from the archive", name))
+	}
+
+	if len(mismatches) > 0 {
+		return checked, fmt.Errorf("Integrity check failed: %d entry(s) do not match the manifest:\n  %s. Remedy: Do not rely on this backup; create a new backup run.", len(mismatches), strings.Join(limitMismatches(mismatches), "\n  "))
+	}
+	return checked, nil
+}
+
+// validateStreamAgainstManifest reads the raw stream of a stream backup completely and
+// checks its size and SHA-256 against the single file the manifest records for it.
+func validateStreamAgainstManifest(r io.Reader, entries []manifest.Entry) (int, error) {
+	if len(entries) != 1 || entries[0].Type != "file" {
+		return 0, fmt.Errorf("Manifest of a stream backup must list exactly one file, found %d entry(s). Remedy: Restore the .manifest.enc file from a copy of the backup directory.", len(entries))
+	}
+	want := entries[0]
+	sum := sha256.New()
+	size, err := io.Copy(sum, r)
+	if err != nil {
+		return 0, err
+	}
+	if size != want.Size {
+		return 0, fmt.Errorf("Integrity check failed: stream %s has %d byte(s), manifest records %d. Remedy: Do not rely on this backup; create a new backup run.", want.Path, size, want.Size)
+	}
+	if !bytes.Equal(sum.Sum(nil), want.Sum()) {
+		return 0, fmt.Errorf("Integrity check failed: content hash of stream %s differs from the manifest. Remedy: Do not rely on this backup; create a new backup run.", want.Path)
+	}
+	return 1, nil
+}
+
+func limitMismatches(mismatches []string) []string {
+	if len(mismatches) <= maxReportedMismatches {
+		return mismatches
+	}
+	limited := append([]string(nil), mismatches[:maxReportedMismatches]...)
+	return append(limited, fmt.Sprintf("... and %d more", len(mismatches)-maxReportedMismatches))
+}
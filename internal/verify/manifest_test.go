@@ -0,0 +1,97 @@
+package verify
+
+import (
+	"RestoreSafe/internal/manifest"
+	"RestoreSafe/internal/util"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func indexedArchive(t *testing.T, files map[string]string) ([]byte, manifest.Index) {
+	t.Helper()
+	src := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	var entries []manifest.Entry
+	var archive bytes.Buffer
+	err := util.WriteTarIndexed(&archive, src, func(e util.TarEntry) error {
+		entries = append(entries, manifest.EntryFromTar(e))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WriteTarIndexed returned error: %v", err)
+	}
+	return archive.Bytes(), manifest.NewIndex(entries)
+}
+
+func TestValidateTarAgainstManifestAcceptsMatchingArchive(t *testing.T) {
+	t.Parallel()
+	archive, index := indexedArchive(t, map[string]string{"a.txt": "alpha", "b.txt": "bravo"})
+
+	checked, err := validateTarAgainstManifest(bytes.NewReader(archive), index)
+	if err != nil {
+		t.Fatalf("validateTarAgainstManifest returned error: %v", err)
+	}
+	if checked != 2 {
+		t.Fatalf("expected 2 checked files, got %d", checked)
+	}
+}
+
+func TestValidateTarAgainstManifestReportsMismatches(t *testing.T) {
+	t.Parallel()
+	archive, index := indexedArchive(t, map[string]string{"a.txt": "alpha", "b.txt": "bravo"})
+
+	a := index["a.txt"]
+	a.SHA256 = strings.Repeat("0", 64)
+	index["a.txt"] = a
+	index["gone.txt"] = manifest.Entry{Path: "gone.txt", Type: "file", Size: 1}
+
+	_, err := validateTarAgainstManifest(bytes.NewReader(archive), index)
+	if err == nil {
+		t.Fatal("expected integrity error, got nil")
+	}
+	msg := err.Error()
+	for _, want := range []string{"2 entry(s)", "a.txt: content hash differs", "gone.txt: listed in the manifest but missing"} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("expected %q in error, got: %v", want, msg)
+		}
+	}
+}
+
+func TestValidateTarAgainstManifestIgnoresFilesStoredInParent(t *testing.T) {
+	t.Parallel()
+	archive, index := indexedArchive(t, map[string]string{"a.txt": "alpha"})
+	index["unchanged.txt"] = manifest.Entry{Path: "unchanged.txt", Type: "file", Size: 1, Stored: "Docs_2026-03-13_FUL001"}
+
+	checked, err := validateTarAgainstManifest(bytes.NewReader(archive), index)
+	if err != nil {
+		t.Fatalf("validateTarAgainstManifest returned error: %v", err)
+	}
+	if checked != 1 {
+		t.Fatalf("expected 1 checked file, got %d", checked)
+	}
+}
+
+func TestValidateStreamAgainstManifestDetectsChangedOutput(t *testing.T) {
+	t.Parallel()
+	sum := sha256.Sum256([]byte("dump content"))
+	entries := []manifest.Entry{{Path: "crm.dump", Type: "file", Size: 12, SHA256: hex.EncodeToString(sum[:])}}
+
+	if checked, err := validateStreamAgainstManifest(strings.NewReader("dump content"), entries); err != nil || checked != 1 {
+		t.Fatalf("expected the matching output to pass, got checked=%d err=%v", checked, err)
+	}
+	if _, err := validateStreamAgainstManifest(strings.NewReader("dump c0ntent"), entries); err == nil || !strings.Contains(err.Error(), "content hash") {
+		t.Fatalf("expected a hash mismatch, got %v", err)
+	}
+	if _, err := validateStreamAgainstManifest(strings.NewReader("dump"), entries); err == nil || !strings.Contains(err.Error(), "manifest records 12") {
+		t.Fatalf("expected a size mismatch, got %v", err)
+	}
+}
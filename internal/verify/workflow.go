@@ -2,7 +2,9 @@ package verify
 
 import (
 	"RestoreSafe/internal/catalog"
+	"RestoreSafe/internal/manifest"
 	"RestoreSafe/internal/operation"
+	"RestoreSafe/internal/repository"
 	"RestoreSafe/internal/security"
 	"RestoreSafe/internal/util"
 	"errors"
@@ -47,6 +49,8 @@ func Run(cfg *util.Config, exeDir string) error {
 		warningCount++
 	}
 	defer log.Close()
+	ioRetries := util.WatchIORetries(log)
+	defer ioRetries.Stop()
 
 	preflight := buildVerifyPreflight(selected, backupDir)
 	printVerifyPreflightWithYubiKeyCheck(os.Stdout, cfg, backupDir, preflight, requiresYubiKey, yubiKeyOnly, security.CheckYubiKeyConnected)
@@ -82,6 +86,7 @@ func Run(cfg *util.Config, exeDir string) error {
 		return err
 	}
 
+	warningCount += operation.LogIORetries(ioRetries, log)
 	log.Info("Verification completed successfully.")
 	fmt.Printf("\nLog file: %s\n", logPath)
 	if warningCount > 0 {
@@ -197,11 +202,59 @@ func verifyEntry(entry util.BackupEntry, backupDir string, password []byte, log
 	if err != nil {
 		return 0, err
 	}
-	if len(parts) == 0 {
+	snapshot := len(parts) == 0 && catalog.IsSnapshot(backupDir, entry)
+	if len(parts) == 0 && !snapshot {
 		return 0, fmt.Errorf("No part files found for %s. Remedy: Ensure all .enc files for this backup are in the same backup directory.", entry.String())
 	}
 
+	// An incremental backup is only usable together with its parents.
+	chain, err := catalog.ResolveChain(backupDir, entry)
+	if err != nil {
+		return 0, err
+	}
+
 	log.Info("Processing backup directory: %s", entry.DirectoryName)
+	if len(chain) > 1 {
+		log.Info("  Incremental backup based on: %s", chain[len(chain)-2].String())
+	}
+
+	// With a manifest every file is checked against its recorded hash; otherwise
+	// only the structure of the archive can be validated.
+	consume := util.ValidateTar
+	checked := 0
+	entries, hasManifest, err := manifest.LoadForBackup(backupDir, entry, password)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to read manifest: %w", err)
+	}
+	if hasManifest {
+		index := manifest.NewIndex(entries)
+		consume = func(r io.Reader) error {
+			var validateErr error
+			checked, validateErr = validateTarAgainstManifest(r, index)
+			return validateErr
+		}
+	}
+	// The output of a command source or standard input is a raw stream, not a TAR.
+	if info, err := catalog.ReadRunInfo(backupDir, entry); err == nil && info.IsStream() {
+		if !hasManifest {
+			return 0, fmt.Errorf("Manifest of stream backup %s is missing. Remedy: Restore the .manifest.enc file from a copy of the backup directory; a stream backup cannot be verified without it.", entry.String())
+		}
+		consume = func(r io.Reader) error {
+			var validateErr error
+			checked, validateErr = validateStreamAgainstManifest(r, entries)
+			return validateErr
+		}
+	}
+
+	if snapshot {
+		// Every chunk is authenticated and checked against its keyed hash while the
+		// archive is rebuilt, and every file against its hash in the snapshot.
+		if err := verifySnapshot(backupDir, entries, password, consume); err != nil {
+			return 0, err
+		}
+		log.Info("  Integrity: %d file(s) match the hashes in the snapshot", checked)
+		return 1, nil
+	}
 
 	err = operation.RunDecryptPipeline(
 		parts,
@@ -210,16 +263,30 @@ func verifyEntry(entry util.BackupEntry, backupDir string, password []byte, log
 		entry.DirectoryName,
 		"verified",
 		"Archive validation",
-		util.ValidateTar,
+		consume,
 		nil,
 	)
 	if err != nil {
 		return 0, err
 	}
+	if hasManifest {
+		log.Info("  Integrity: %d file(s) match the hashes in the manifest", checked)
+	}
 
 	return len(parts), nil
 }
 
+func verifySnapshot(backupDir string, entries []manifest.Entry, password []byte, consume func(io.Reader) error) error {
+	repo, err := repository.Open(backupDir, password)
+	if err != nil {
+		return fmt.Errorf("Failed to open repository: %w", err)
+	}
+	defer repo.Close()
+	if err := repo.StreamTar(entries, consume); err != nil {
+		return fmt.Errorf("Archive validation failed: %w", err)
+	}
+	return nil
+}
 
 func verifySelectionWarningCount(selection string, index []util.BackupEntry) int {
 	normalized := strings.ToUpper(strings.TrimSpace(selection))
@@ -5,6 +5,8 @@ import (
 	"RestoreSafe/internal/testutil"
 	"RestoreSafe/internal/util"
 	"errors"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -42,3 +44,33 @@ func TestVerifyEntryRejectsWrongPassword(t *testing.T) {
 		t.Fatalf("expected ErrWrongPassword, got: %v", err)
 	}
 }
+
+func TestVerifyEntryChecksRepositorySnapshot(t *testing.T) {
+	password := []byte("repository-password")
+	srcDir := t.TempDir()
+	backupDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("alpha"), 0o600); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+	entry := util.BackupEntry{DirectoryName: "Docs", Date: "2026-03-12", ID: util.BackupID("SNP001")}
+	testutil.CreateSnapshotBackup(t, srcDir, backupDir, entry, password)
+
+	if _, err := verifyEntry(entry, backupDir, password, nil); err != nil {
+		t.Fatalf("verifyEntry failed for snapshot: %v", err)
+	}
+	if _, err := verifyEntry(entry, backupDir, []byte("wrong-pass"), nil); !errors.Is(err, security.ErrWrongPassword) {
+		t.Fatalf("expected ErrWrongPassword, got: %v", err)
+	}
+}
+
+func TestVerifyEntryChecksCommandOutput(t *testing.T) {
+	t.Parallel()
+	password := []byte("stream-password")
+	backupDir := t.TempDir()
+	entry := util.BackupEntry{DirectoryName: "crm.dump", Date: "2026-03-12", ID: util.BackupID("CMD001")}
+	testutil.CreateStreamBackup(t, backupDir, entry, []byte("dump content"), password)
+
+	if _, err := verifyEntry(entry, backupDir, password, nil); err != nil {
+		t.Fatalf("verifyEntry failed for command output: %v", err)
+	}
+}